@@ -0,0 +1,310 @@
+package accesslog
+
+import (
+    "bufio"
+    "compress/gzip"
+    "encoding/json"
+    "errors"
+    "io"
+    "log"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "sync"
+    "time"
+
+    "load-balancer/internal/metrics"
+)
+
+// Config describes an access log written to Path, one JSON line per
+// request. Lines are queued on a channel of Buffer entries (default 4096)
+// and written by a background writer, so a slow disk never holds up
+// requests: when the queue is full the line is dropped and counted in
+// lb_accesslog_dropped_total instead. Once the file reaches MaxBytes
+// (default 100 MiB) it is renamed with a timestamp suffix and a new one
+// started; with Compress the rotated file is gzipped in the background.
+// Only the newest MaxFiles (default 5) rotated files are kept.
+type Config struct {
+    Path     string
+    MaxBytes int64
+    MaxFiles int
+    Compress bool
+    Buffer   int
+    Registry *metrics.Registry
+}
+
+// Entry is one line of the access log.
+type Entry struct {
+    Time       time.Time `json:"time"`
+    Remote     string    `json:"remote"`
+    Method     string    `json:"method"`
+    Host       string    `json:"host"`
+    Path       string    `json:"path"`
+    Status     int       `json:"status"`
+    Bytes      int64     `json:"bytes"`
+    DurationMS float64   `json:"duration_ms"`
+    UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+type Logger struct {
+    config  Config
+    entries chan Entry
+    dropped *metrics.Counter
+    done    chan struct{}
+
+    // mux guards closing entries against a concurrent Log.
+    mux    sync.RWMutex
+    closed bool
+
+    file        *os.File
+    buffer      *bufio.Writer
+    size        int64
+    compressing sync.WaitGroup
+    compressMux sync.Mutex
+    closeOnce   sync.Once
+}
+
+func New(config Config) (*Logger, error) {
+    if config.Path == "" {
+        return nil, errors.New("accesslog: path is required")
+    }
+    if config.MaxBytes <= 0 {
+        config.MaxBytes = 100 << 20
+    }
+    if config.MaxFiles <= 0 {
+        config.MaxFiles = 5
+    }
+    if config.Buffer <= 0 {
+        config.Buffer = 4096
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+    logger := &Logger{
+        config:  config,
+        entries: make(chan Entry, config.Buffer),
+        dropped: config.Registry.Counter("lb_accesslog_dropped_total", "Access log lines dropped because the writer fell behind.", "path", config.Path),
+        done:    make(chan struct{}),
+    }
+    if err := logger.open(); err != nil {
+        return nil, err
+    }
+    go logger.run()
+    return logger, nil
+}
+
+// Middleware logs every request once it has been answered.
+func (logger *Logger) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        start := time.Now()
+        recorder := &recordingWriter{ResponseWriter: writer}
+        next.ServeHTTP(recorder, request)
+
+        entry := Entry{
+            Time:       start,
+            Remote:     request.RemoteAddr,
+            Method:     request.Method,
+            Host:       request.Host,
+            Path:       request.URL.Path,
+            Status:     recorder.status,
+            Bytes:      recorder.bytes,
+            DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+            UserAgent:  request.UserAgent(),
+        }
+        if entry.Status == 0 {
+            entry.Status = http.StatusOK
+        }
+        logger.Log(entry)
+    })
+}
+
+// Log queues entry for writing, dropping it if the queue is full or the
+// logger is closed.
+func (logger *Logger) Log(entry Entry) {
+    logger.mux.RLock()
+    defer logger.mux.RUnlock()
+
+    if logger.closed {
+        logger.dropped.Inc()
+        return
+    }
+    select {
+    case logger.entries <- entry:
+    default:
+        logger.dropped.Inc()
+    }
+}
+
+// Close writes the queued lines, closes the file and waits for rotated
+// files to finish compressing. Lines logged after Close are dropped.
+func (logger *Logger) Close() error {
+    var err error
+    logger.closeOnce.Do(func() {
+        logger.mux.Lock()
+        logger.closed = true
+        close(logger.entries)
+        logger.mux.Unlock()
+
+        <-logger.done
+        err = logger.buffer.Flush()
+        if closeErr := logger.file.Close(); err == nil {
+            err = closeErr
+        }
+        logger.compressing.Wait()
+    })
+    return err
+}
+
+// run writes queued lines, flushing whenever the queue runs empty so lines
+// reach the file promptly without a write per line under load.
+func (logger *Logger) run() {
+    defer close(logger.done)
+
+    encoder := json.NewEncoder(&sizeWriter{logger: logger})
+    for entry := range logger.entries {
+        if err := encoder.Encode(entry); err != nil {
+            log.Printf("accesslog: %v\n", err)
+        }
+        if logger.size >= logger.config.MaxBytes {
+            if err := logger.rotate(); err != nil {
+                log.Printf("accesslog: rotating %s: %v\n", logger.config.Path, err)
+            }
+        }
+        if len(logger.entries) == 0 {
+            logger.buffer.Flush()
+        }
+    }
+}
+
+func (logger *Logger) open() error {
+    file, err := os.OpenFile(logger.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+    if err != nil {
+        return err
+    }
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return err
+    }
+    logger.file, logger.buffer, logger.size = file, bufio.NewWriterSize(file, 64<<10), info.Size()
+    return nil
+}
+
+// rotate moves the current file aside and starts a new one. Rotated files
+// are compressed one at a time, so a burst of rotations costs one core at
+// most; a file pruned before its turn is skipped.
+func (logger *Logger) rotate() error {
+    if err := logger.buffer.Flush(); err != nil {
+        return err
+    }
+    if err := logger.file.Close(); err != nil {
+        return err
+    }
+    rotated := logger.config.Path + "." + time.Now().UTC().Format("20060102T150405.000000000")
+    if err := os.Rename(logger.config.Path, rotated); err != nil {
+        logger.open()
+        return err
+    }
+    if err := logger.open(); err != nil {
+        return err
+    }
+
+    if !logger.config.Compress {
+        logger.prune()
+        return nil
+    }
+    logger.compressing.Add(1)
+    go func() {
+        defer logger.compressing.Done()
+        logger.compressMux.Lock()
+        defer logger.compressMux.Unlock()
+        if err := compress(rotated); err != nil && !os.IsNotExist(err) {
+            log.Printf("accesslog: compressing %s: %v\n", rotated, err)
+        }
+        logger.prune()
+    }()
+    return nil
+}
+
+// prune removes rotated files beyond the newest MaxFiles.
+func (logger *Logger) prune() {
+    rotated, _ := filepath.Glob(logger.config.Path + ".*")
+    sort.Strings(rotated)
+    for len(rotated) > logger.config.MaxFiles {
+        os.Remove(rotated[0])
+        rotated = rotated[1:]
+    }
+}
+
+// compress replaces path with a gzipped copy, path.gz.
+func compress(path string) error {
+    source, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer source.Close()
+
+    target, err := os.Create(path + ".gz")
+    if err != nil {
+        return err
+    }
+    archive := gzip.NewWriter(target)
+    if _, err := io.Copy(archive, source); err != nil {
+        target.Close()
+        os.Remove(path + ".gz")
+        return err
+    }
+    if err := archive.Close(); err != nil {
+        target.Close()
+        os.Remove(path + ".gz")
+        return err
+    }
+    if err := target.Close(); err != nil {
+        os.Remove(path + ".gz")
+        return err
+    }
+    return os.Remove(path)
+}
+
+// sizeWriter writes to the logger's current file, keeping count of its
+// size.
+type sizeWriter struct {
+    logger *Logger
+}
+
+func (writer *sizeWriter) Write(p []byte) (int, error) {
+    n, err := writer.logger.buffer.Write(p)
+    writer.logger.size += int64(n)
+    return n, err
+}
+
+type recordingWriter struct {
+    http.ResponseWriter
+    status int
+    bytes  int64
+}
+
+func (writer *recordingWriter) WriteHeader(status int) {
+    if writer.status == 0 && status >= http.StatusOK {
+        writer.status = status
+    }
+    writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *recordingWriter) Write(p []byte) (int, error) {
+    if writer.status == 0 {
+        writer.status = http.StatusOK
+    }
+    n, err := writer.ResponseWriter.Write(p)
+    writer.bytes += int64(n)
+    return n, err
+}
+
+func (writer *recordingWriter) Flush() {
+    http.NewResponseController(writer.ResponseWriter).Flush()
+}
+
+func (writer *recordingWriter) Unwrap() http.ResponseWriter {
+    return writer.ResponseWriter
+}
@@ -0,0 +1,162 @@
+package accesslog
+
+import (
+    "bufio"
+    "compress/gzip"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "load-balancer/internal/metrics"
+)
+
+func TestLogger_Middleware(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "access.log")
+    logger, err := New(Config{Path: path, Registry: metrics.NewRegistry()})
+    if err != nil {
+        t.Fatalf("New() error: %v", err)
+    }
+
+    handler := logger.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/missing" {
+            http.NotFound(w, r)
+            return
+        }
+        w.Write([]byte("hello"))
+    }))
+    for _, path := range []string{"/", "/missing"} {
+        handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+    }
+    if err := logger.Close(); err != nil {
+        t.Fatalf("Close() error: %v", err)
+    }
+
+    entries := readEntries(t, path)
+    if len(entries) != 2 {
+        t.Fatalf("Expected 2 entries, got %d", len(entries))
+    }
+    tests := []struct {
+        path   string
+        status int
+        bytes  int64
+    }{
+        {path: "/", status: http.StatusOK, bytes: 5},
+        {path: "/missing", status: http.StatusNotFound, bytes: 19},
+    }
+    for i, tt := range tests {
+        if entry := entries[i]; entry.Path != tt.path || entry.Status != tt.status || entry.Bytes != tt.bytes {
+            t.Errorf("Expected %s %d %d bytes, got %s %d %d bytes", tt.path, tt.status, tt.bytes, entry.Path, entry.Status, entry.Bytes)
+        }
+    }
+}
+
+func TestLogger_Drops(t *testing.T) {
+    registry := metrics.NewRegistry()
+    path := filepath.Join(t.TempDir(), "access.log")
+    logger, err := New(Config{Path: path, Buffer: 1, Registry: registry})
+    if err != nil {
+        t.Fatalf("New() error: %v", err)
+    }
+
+    // Logging never waits for the writer: whatever does not fit in the
+    // queue is dropped and counted.
+    for i := 0; i < 1000; i++ {
+        logger.Log(Entry{Path: "/"})
+    }
+    logger.Close()
+
+    written := len(readEntries(t, path))
+    dropped := registry.Counter("lb_accesslog_dropped_total", "", "path", path).Value()
+    if written+int(dropped) != 1000 {
+        t.Errorf("Expected written and dropped to add up to 1000, got %d and %v", written, dropped)
+    }
+    if dropped == 0 {
+        t.Errorf("Expected lines dropped with a full queue")
+    }
+}
+
+func TestLogger_LogAfterClose(t *testing.T) {
+    registry := metrics.NewRegistry()
+    path := filepath.Join(t.TempDir(), "access.log")
+    logger, err := New(Config{Path: path, Registry: registry})
+    if err != nil {
+        t.Fatalf("New() error: %v", err)
+    }
+    logger.Close()
+
+    logger.Log(Entry{Path: "/late"})
+    if dropped := registry.Counter("lb_accesslog_dropped_total", "", "path", path).Value(); dropped != 1 {
+        t.Errorf("Expected the late line dropped, got %v dropped", dropped)
+    }
+}
+
+func TestLogger_Rotate(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "access.log")
+    logger, err := New(Config{Path: path, MaxBytes: 1024, MaxFiles: 2, Compress: true, Registry: metrics.NewRegistry()})
+    if err != nil {
+        t.Fatalf("New() error: %v", err)
+    }
+    for i := 0; i < 100; i++ {
+        logger.Log(Entry{Path: "/" + strings.Repeat("x", 100)})
+    }
+    logger.Close()
+
+    rotated, _ := filepath.Glob(path + ".*")
+    if len(rotated) != 2 {
+        t.Fatalf("Expected 2 rotated files kept, got %v", rotated)
+    }
+    for _, name := range rotated {
+        if !strings.HasSuffix(name, ".gz") {
+            t.Errorf("Expected %s compressed", name)
+            continue
+        }
+        file, err := os.Open(name)
+        if err != nil {
+            t.Fatalf("Open() error: %v", err)
+        }
+        archive, err := gzip.NewReader(file)
+        if err != nil {
+            t.Fatalf("Expected %s to be gzip, got %v", name, err)
+        }
+        var entry Entry
+        if err := json.NewDecoder(archive).Decode(&entry); err != nil {
+            t.Errorf("Expected %s to hold log lines, got %v", name, err)
+        }
+        file.Close()
+    }
+    if info, err := os.Stat(path); err != nil || info.Size() >= 1024 {
+        t.Errorf("Expected a fresh log under 1024 bytes, got %v", err)
+    }
+}
+
+func TestNew(t *testing.T) {
+    if _, err := New(Config{}); err == nil {
+        t.Errorf("Expected an error without a path")
+    }
+    if _, err := New(Config{Path: filepath.Join(t.TempDir(), "missing", "access.log")}); err == nil {
+        t.Errorf("Expected an error for a path that cannot be opened")
+    }
+}
+
+func readEntries(t *testing.T, path string) []Entry {
+    file, err := os.Open(path)
+    if err != nil {
+        t.Fatalf("Open() error: %v", err)
+    }
+    defer file.Close()
+
+    var entries []Entry
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        var entry Entry
+        if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+            t.Fatalf("Expected JSON lines, got %q: %v", scanner.Text(), err)
+        }
+        entries = append(entries, entry)
+    }
+    return entries
+}
@@ -0,0 +1,42 @@
+package admin
+
+import (
+    "encoding/json"
+    "net/http"
+
+    "load-balancer/internal/metrics"
+)
+
+type Server struct {
+    mux *http.ServeMux
+}
+
+func NewServer(registry *metrics.Registry) *Server {
+    server := &Server{mux: http.NewServeMux()}
+    if registry != nil {
+        server.mux.Handle("GET /metrics", registry.Handler())
+    }
+    return server
+}
+
+func (server *Server) Handle(pattern string, handler http.Handler) {
+    server.mux.Handle(pattern, handler)
+}
+
+func (server *Server) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+    server.mux.HandleFunc(pattern, handler)
+}
+
+func (server *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+    server.mux.ServeHTTP(writer, request)
+}
+
+func WriteJSON(writer http.ResponseWriter, status int, value any) {
+    writer.Header().Set("Content-Type", "application/json")
+    writer.WriteHeader(status)
+    json.NewEncoder(writer).Encode(value)
+}
+
+func WriteError(writer http.ResponseWriter, status int, message string) {
+    WriteJSON(writer, status, map[string]string{"error": message})
+}
@@ -0,0 +1,86 @@
+package admin
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "load-balancer/internal/metrics"
+)
+
+func TestServer_Routes(t *testing.T) {
+    registry := metrics.NewRegistry()
+    registry.Counter("lb_requests_total", "").Inc()
+
+    server := NewServer(registry)
+    server.HandleFunc("GET /admin/ping", func(w http.ResponseWriter, r *http.Request) {
+        WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+    })
+
+    tests := []struct {
+        name         string
+        method       string
+        path         string
+        expectedCode int
+        expectedBody string
+    }{
+        {
+            name:         "metrics",
+            method:       "GET",
+            path:         "/metrics",
+            expectedCode: http.StatusOK,
+            expectedBody: "lb_requests_total 1",
+        },
+        {
+            name:         "registered handler",
+            method:       "GET",
+            path:         "/admin/ping",
+            expectedCode: http.StatusOK,
+            expectedBody: `{"status":"ok"}`,
+        },
+        {
+            name:         "wrong method",
+            method:       "POST",
+            path:         "/admin/ping",
+            expectedCode: http.StatusMethodNotAllowed,
+        },
+        {
+            name:         "unknown path",
+            method:       "GET",
+            path:         "/admin/nope",
+            expectedCode: http.StatusNotFound,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rr := httptest.NewRecorder()
+            server.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+            if rr.Code != tt.expectedCode {
+                t.Errorf("Expected status %d, got %d", tt.expectedCode, rr.Code)
+            }
+            if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+                t.Errorf("Expected body to contain %q, got %q", tt.expectedBody, rr.Body.String())
+            }
+        })
+    }
+}
+
+func TestWriteError(t *testing.T) {
+    rr := httptest.NewRecorder()
+    WriteError(rr, http.StatusBadRequest, "bad input")
+
+    var body map[string]string
+    if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+        t.Fatalf("invalid JSON: %v", err)
+    }
+    if rr.Code != http.StatusBadRequest || body["error"] != "bad input" {
+        t.Errorf("Unexpected response %d %v", rr.Code, body)
+    }
+    if rr.Header().Get("Content-Type") != "application/json" {
+        t.Errorf("Unexpected content type %q", rr.Header().Get("Content-Type"))
+    }
+}
@@ -1,16 +1,40 @@
 package backend
 
 import (
+    "net/http"
     "net/url"
     "net/http/httputil"
     "sync"
+    "sync/atomic"
+    "time"
 )
 
+// Backend is one upstream server. Tier groups it for failover: a pool only
+// uses the backends of its lowest tier with any available. HealthPath and
+// HealthPort, when set, replace the URL's path and port for health checks,
+// for services that report their health apart from their traffic.
 type Backend struct {
-  URL          *url.URL
-  Alive        bool
-  mux          sync.RWMutex
-  ReverseProxy *httputil.ReverseProxy
+  URL           *url.URL
+  Alive         bool
+  Tier          int
+  HealthPath    string
+  HealthPort    string
+  mux           sync.RWMutex
+  ReverseProxy  *httputil.ReverseProxy
+  counters      counters
+  preconnector  *Preconnector
+  reaper        *ConnReaper
+  deprioritized atomic.Int64
+  draining      atomic.Bool
+  weight        weight
+  derating      atomic.Uint64
+  override      override
+  throughput    throughput
+  multiplexed   atomic.Bool
+  connections   atomic.Int64
+  counting      atomic.Bool
+  handshakes    HandshakeObserver
+  rtt           rtt
 }
 
 func (backend *Backend) SetAlive(alive bool) {
@@ -19,10 +43,63 @@ func (backend *Backend) SetAlive(alive bool) {
 	backend.mux.Unlock()
 }
 
+// IsAlive reports whether the backend should receive traffic: its health
+// check state, unless an override is in force.
 func (backend *Backend) IsAlive() bool {
+    backend.mux.RLock()
+    defer backend.mux.RUnlock()
+
+    switch state, _ := backend.overrideLocked(time.Now()); state {
+    case ForceUp:
+        return true
+    case ForceDown:
+        return false
+    }
+    return backend.Alive
+}
+
+// Healthy reports the health check state, ignoring any override.
+func (backend *Backend) Healthy() bool {
     backend.mux.RLock()
     alive := backend.Alive
     backend.mux.RUnlock()
 
     return alive
 }
+
+// Deprioritize keeps the backend in rotation but makes the balancer prefer
+// other backends until the given time.
+func (backend *Backend) Deprioritize(until time.Time) {
+    backend.deprioritized.Store(until.UnixNano())
+}
+
+func (backend *Backend) Deprioritized(now time.Time) bool {
+    return now.UnixNano() < backend.deprioritized.Load()
+}
+
+// SetDraining takes the backend out of rotation without marking it down:
+// requests already in flight finish, but no new ones are sent to it.
+func (backend *Backend) SetDraining(draining bool) {
+    backend.draining.Store(draining)
+}
+
+func (backend *Backend) Draining() bool {
+    return backend.draining.Load()
+}
+
+// Close releases the backend's idle upstream connections, including
+// preconnected ones, once it has left its pool. A backend using the shared
+// http.DefaultTransport, whether by leaving Transport nil or by setting it
+// explicitly, is left alone, since its idle connections belong to every
+// other user of that transport too.
+func (backend *Backend) Close() {
+    if preconnector := backend.Preconnector(); preconnector != nil {
+        preconnector.Drain()
+    }
+    if backend.ReverseProxy.Transport == http.DefaultTransport {
+        return
+    }
+    if closer, ok := backend.ReverseProxy.Transport.(interface{ CloseIdleConnections() }); ok {
+        closer.CloseIdleConnections()
+    }
+}
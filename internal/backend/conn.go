@@ -0,0 +1,52 @@
+package backend
+
+import (
+    "net"
+    "sync"
+    "time"
+)
+
+// TrackConn wraps conn, a proxied TCP connection to the backend, so it
+// counts as in flight until closed and its traffic shows in the backend's
+// byte counters as it flows: bytes written to the backend as BytesIn, bytes
+// read from it as BytesOut. Each connection counts as one request.
+func (backend *Backend) TrackConn(conn net.Conn) net.Conn {
+    backend.counters.inFlight.Add(1)
+    backend.counters.lastUsed.Store(time.Now().UnixNano())
+    return &trackedConn{Conn: conn, backend: backend}
+}
+
+type trackedConn struct {
+    net.Conn
+    backend *Backend
+    once    sync.Once
+}
+
+func (conn *trackedConn) Read(p []byte) (int, error) {
+    n, err := conn.Conn.Read(p)
+    conn.backend.counters.bytesOut.Add(uint64(n))
+    return n, err
+}
+
+func (conn *trackedConn) Write(p []byte) (int, error) {
+    n, err := conn.Conn.Write(p)
+    conn.backend.counters.bytesIn.Add(uint64(n))
+    return n, err
+}
+
+// CloseWrite half-closes the connection when the underlying one supports
+// it, so the backend sees the client's end of stream.
+func (conn *trackedConn) CloseWrite() error {
+    if closer, ok := conn.Conn.(interface{ CloseWrite() error }); ok {
+        return closer.CloseWrite()
+    }
+    return nil
+}
+
+func (conn *trackedConn) Close() error {
+    conn.once.Do(func() {
+        conn.backend.counters.inFlight.Add(-1)
+        conn.backend.counters.requests.Add(1)
+    })
+    return conn.Conn.Close()
+}
@@ -0,0 +1,64 @@
+package backend
+
+import (
+    "context"
+    "errors"
+    "net"
+    "sync"
+)
+
+// LimitConnections caps the connections open to the backend at max, for
+// backends that fall over beyond a known connection count. Requests above
+// the cap wait for a connection to come free, or share one as HTTP/2
+// streams when the backend speaks HTTP/2, until their context ends. Idle
+// connections are kept up to the cap so waiting requests reuse them rather
+// than reconnecting. Call it before preconnect or connection recycling is
+// enabled; calling it again only changes the cap.
+func (backend *Backend) LimitConnections(max int) error {
+    if max <= 0 {
+        return errors.New("connection limit must be positive")
+    }
+    transport, err := backend.httpTransport()
+    if err != nil {
+        return err
+    }
+    transport.MaxConnsPerHost = max
+    transport.MaxIdleConnsPerHost = max
+    if transport.MaxIdleConns > 0 && transport.MaxIdleConns < max {
+        transport.MaxIdleConns = max
+    }
+
+    if !backend.counting.CompareAndSwap(false, true) {
+        return nil
+    }
+    dial := transport.DialContext
+    if dial == nil {
+        dial = (&net.Dialer{}).DialContext
+    }
+    transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+        conn, err := dial(ctx, network, address)
+        if err != nil {
+            return nil, err
+        }
+        backend.connections.Add(1)
+        return &countedConn{Conn: conn, backend: backend}, nil
+    }
+    return nil
+}
+
+// Connections returns the connections open to the backend once
+// LimitConnections is in force, and zero before.
+func (backend *Backend) Connections() int64 {
+    return backend.connections.Load()
+}
+
+type countedConn struct {
+    net.Conn
+    backend *Backend
+    once    sync.Once
+}
+
+func (conn *countedConn) Close() error {
+    conn.once.Do(func() { conn.backend.connections.Add(-1) })
+    return conn.Conn.Close()
+}
@@ -0,0 +1,117 @@
+package backend
+
+import (
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestBackend_LimitConnections(t *testing.T) {
+    tests := []struct {
+        name               string
+        http2              bool
+        limit              int
+        expectedConcurrent int64
+    }{
+        {name: "http1 requests queue for a connection", limit: 2, expectedConcurrent: 2},
+        {name: "http2 requests share the connection", http2: true, limit: 1, expectedConcurrent: 6},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var open, maxOpen, active, maxActive atomic.Int64
+            raise := func(max *atomic.Int64, value int64) {
+                for current := max.Load(); value > current && !max.CompareAndSwap(current, value); current = max.Load() {
+                }
+            }
+            server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                raise(&maxActive, active.Add(1))
+                time.Sleep(50 * time.Millisecond)
+                active.Add(-1)
+            }))
+            server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+                switch state {
+                case http.StateNew:
+                    raise(&maxOpen, open.Add(1))
+                case http.StateClosed, http.StateHijacked:
+                    open.Add(-1)
+                }
+            }
+            if tt.http2 {
+                server.Config.Protocols = new(http.Protocols)
+                server.Config.Protocols.SetUnencryptedHTTP2(true)
+            }
+            server.Start()
+            defer server.Close()
+
+            serverURL, _ := url.Parse(server.URL)
+            backend := &Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)}
+            if tt.http2 {
+                backend.EnableHTTP2(true)
+            }
+            if err := backend.LimitConnections(tt.limit); err != nil {
+                t.Fatalf("LimitConnections() error: %v", err)
+            }
+
+            var wg sync.WaitGroup
+            for i := 0; i < 6; i++ {
+                wg.Add(1)
+                go func() {
+                    defer wg.Done()
+                    rr := httptest.NewRecorder()
+                    backend.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+                    if rr.Code != http.StatusOK {
+                        t.Errorf("Expected 200, got %d", rr.Code)
+                    }
+                }()
+            }
+            wg.Wait()
+
+            if maxOpen.Load() > int64(tt.limit) {
+                t.Errorf("Expected at most %d connections, the backend saw %d", tt.limit, maxOpen.Load())
+            }
+            if maxActive.Load() != tt.expectedConcurrent {
+                t.Errorf("Expected %d requests served at once, got %d", tt.expectedConcurrent, maxActive.Load())
+            }
+            if connections := backend.Connections(); connections < 1 || connections > int64(tt.limit) {
+                t.Errorf("Expected idle connections kept up to the limit, got %d", connections)
+            }
+        })
+    }
+}
+
+func TestBackend_LimitConnectionsLeavesDefaultTransport(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    defer server.Close()
+
+    serverURL, _ := url.Parse(server.URL)
+    backend := &Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)}
+    backend.ReverseProxy.Transport = http.DefaultTransport
+    for _, limit := range []int{1, 2} {
+        if err := backend.LimitConnections(limit); err != nil {
+            t.Fatalf("LimitConnections(%d) error: %v", limit, err)
+        }
+    }
+
+    if backend.ReverseProxy.Transport == http.DefaultTransport {
+        t.Fatal("Expected the backend to get its own transport")
+    }
+    if max := http.DefaultTransport.(*http.Transport).MaxConnsPerHost; max != 0 {
+        t.Errorf("Expected the default transport untouched, got MaxConnsPerHost %d", max)
+    }
+    if max := backend.ReverseProxy.Transport.(*http.Transport).MaxConnsPerHost; max != 2 {
+        t.Errorf("Expected the latest limit of 2, got %d", max)
+    }
+
+    backend.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+    if connections := backend.Connections(); connections != 1 {
+        t.Errorf("Expected 1 connection counted once, got %d", connections)
+    }
+    backend.Close()
+}
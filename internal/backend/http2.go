@@ -0,0 +1,42 @@
+package backend
+
+import (
+    "net/http"
+)
+
+// EnableHTTP2 makes the backend's transport speak HTTP/2, as gRPC upstreams
+// require, so concurrent requests share a connection as separate streams.
+// With cleartext the transport uses HTTP/2 with prior knowledge (h2c) for
+// http:// backends; otherwise HTTP/2 is negotiated over TLS, falling back to
+// HTTP/1.1. Call it before preconnect or connection recycling is enabled.
+func (backend *Backend) EnableHTTP2(cleartext bool) error {
+    transport, err := backend.httpTransport()
+    if err != nil {
+        return err
+    }
+    protocols := new(http.Protocols)
+    if cleartext {
+        protocols.SetUnencryptedHTTP2(true)
+    } else {
+        protocols.SetHTTP1(true)
+        protocols.SetHTTP2(true)
+    }
+    transport.Protocols = protocols
+    transport.ForceAttemptHTTP2 = true
+    backend.multiplexed.Store(true)
+    return nil
+}
+
+// Multiplexed reports whether the backend carries requests as HTTP/2
+// streams, where the connection count says little about its load.
+func (backend *Backend) Multiplexed() bool {
+    return backend.multiplexed.Load()
+}
+
+// ActiveStreams returns the requests in flight to the backend. Every
+// proxied request occupies one stream for its whole life, including
+// long-lived gRPC streaming calls, so this is the backend's stream count
+// however many connections carry them.
+func (backend *Backend) ActiveStreams() int64 {
+    return backend.counters.inFlight.Load()
+}
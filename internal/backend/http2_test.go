@@ -0,0 +1,43 @@
+package backend
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "testing"
+)
+
+func TestBackend_EnableHTTP2Cleartext(t *testing.T) {
+    server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("X-Proto", r.Proto)
+        w.Header().Set("Trailer", "Grpc-Status")
+        w.Write([]byte("ok"))
+        w.Header().Set("Grpc-Status", "0")
+    }))
+    server.Config.Protocols = new(http.Protocols)
+    server.Config.Protocols.SetUnencryptedHTTP2(true)
+    server.Start()
+    defer server.Close()
+
+    serverURL, _ := url.Parse(server.URL)
+    backend := &Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)}
+    if err := backend.EnableHTTP2(true); err != nil {
+        t.Fatalf("EnableHTTP2() error: %v", err)
+    }
+    if !backend.Multiplexed() {
+        t.Errorf("Expected the backend to be multiplexed")
+    }
+
+    rr := httptest.NewRecorder()
+    backend.ServeHTTP(rr, httptest.NewRequest("POST", "/pkg.Service/Call", nil))
+    if got := rr.Header().Get("X-Proto"); got != "HTTP/2.0" {
+        t.Errorf("Expected the upstream request over HTTP/2.0, got %q", got)
+    }
+    if got := rr.Result().Trailer.Get("Grpc-Status"); got != "0" {
+        t.Errorf("Expected the Grpc-Status trailer to be forwarded, got %q", got)
+    }
+    if streams := backend.ActiveStreams(); streams != 0 {
+        t.Errorf("Expected no active streams after the call, got %d", streams)
+    }
+}
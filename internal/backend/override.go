@@ -0,0 +1,67 @@
+package backend
+
+import (
+    "fmt"
+    "time"
+)
+
+// Override forces a backend's state regardless of what health checks say.
+type Override int
+
+const (
+    Auto Override = iota
+    ForceUp
+    ForceDown
+)
+
+func (override Override) String() string {
+    switch override {
+    case ForceUp:
+        return "force_up"
+    case ForceDown:
+        return "force_down"
+    }
+    return "auto"
+}
+
+func ParseOverride(value string) (Override, error) {
+    switch value {
+    case "auto":
+        return Auto, nil
+    case "force_up":
+        return ForceUp, nil
+    case "force_down":
+        return ForceDown, nil
+    }
+    return Auto, fmt.Errorf("unknown override %q", value)
+}
+
+type override struct {
+    state Override
+    until time.Time
+}
+
+// SetOverride forces the backend up or down until the given time, after
+// which it goes back to following its health checks. Auto clears any
+// override at once. Health checks keep running underneath, so the backend
+// resumes with an up-to-date state when the override expires.
+func (backend *Backend) SetOverride(state Override, until time.Time) {
+    backend.mux.Lock()
+    backend.override = override{state: state, until: until}
+    backend.mux.Unlock()
+}
+
+// Override returns the override in force at now and when it expires.
+func (backend *Backend) Override(now time.Time) (Override, time.Time) {
+    backend.mux.RLock()
+    defer backend.mux.RUnlock()
+
+    return backend.overrideLocked(now)
+}
+
+func (backend *Backend) overrideLocked(now time.Time) (Override, time.Time) {
+    if backend.override.state == Auto || !now.Before(backend.override.until) {
+        return Auto, time.Time{}
+    }
+    return backend.override.state, backend.override.until
+}
@@ -0,0 +1,51 @@
+package backend
+
+import (
+    "testing"
+    "time"
+)
+
+func TestBackend_Override(t *testing.T) {
+    tests := []struct {
+        name          string
+        healthy       bool
+        state         Override
+        ttl           time.Duration
+        expectedAlive bool
+        expectedState Override
+    }{
+        {name: "no override follows health", healthy: true, state: Auto, ttl: time.Hour, expectedAlive: true, expectedState: Auto},
+        {name: "force up over failing check", healthy: false, state: ForceUp, ttl: time.Hour, expectedAlive: true, expectedState: ForceUp},
+        {name: "force down over passing check", healthy: true, state: ForceDown, ttl: time.Hour, expectedAlive: false, expectedState: ForceDown},
+        {name: "expired override follows health", healthy: false, state: ForceUp, ttl: -time.Second, expectedAlive: false, expectedState: Auto},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := &Backend{Alive: tt.healthy}
+            backend.SetOverride(tt.state, time.Now().Add(tt.ttl))
+
+            if alive := backend.IsAlive(); alive != tt.expectedAlive {
+                t.Errorf("Expected alive %v, got %v", tt.expectedAlive, alive)
+            }
+            if healthy := backend.Healthy(); healthy != tt.healthy {
+                t.Errorf("Expected healthy %v, got %v", tt.healthy, healthy)
+            }
+            if state, _ := backend.Override(time.Now()); state != tt.expectedState {
+                t.Errorf("Expected override %v, got %v", tt.expectedState, state)
+            }
+        })
+    }
+}
+
+func TestParseOverride(t *testing.T) {
+    for _, state := range []Override{Auto, ForceUp, ForceDown} {
+        parsed, err := ParseOverride(state.String())
+        if err != nil || parsed != state {
+            t.Errorf("Expected %v to round-trip, got %v (%v)", state, parsed, err)
+        }
+    }
+    if _, err := ParseOverride("maybe"); err == nil {
+        t.Errorf("Expected an error for an unknown override")
+    }
+}
@@ -0,0 +1,266 @@
+package backend
+
+import (
+    "context"
+    "crypto/tls"
+    "errors"
+    "fmt"
+    "net"
+    "net/http"
+    "net/url"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+type Preconnector struct {
+    MinIdle    int
+    MaxIdleAge time.Duration
+
+    address   string
+    tlsConfig *tls.Config
+    dialer    func(ctx context.Context, network, address string) (net.Conn, error)
+
+    mux    sync.Mutex
+    idle   []idleConn
+    hits   atomic.Uint64
+    misses atomic.Uint64
+}
+
+type idleConn struct {
+    conn   net.Conn
+    dialed time.Time
+}
+
+// EnablePreconnect routes the backend's dials through a Preconnector that
+// keeps MinIdle handshaken connections ready, so the first request after an
+// idle period skips TCP and TLS setup. Calling it again adjusts the floor.
+func (backend *Backend) EnablePreconnect(minIdle int, maxIdleAge time.Duration) (*Preconnector, error) {
+    backend.mux.Lock()
+    defer backend.mux.Unlock()
+
+    if backend.preconnector != nil {
+        backend.preconnector.mux.Lock()
+        backend.preconnector.MinIdle = minIdle
+        backend.preconnector.MaxIdleAge = maxIdleAge
+        backend.preconnector.mux.Unlock()
+        return backend.preconnector, nil
+    }
+
+    transport, err := backend.httpTransport()
+    if err != nil {
+        return nil, err
+    }
+
+    preconnector := &Preconnector{
+        MinIdle:    minIdle,
+        MaxIdleAge: maxIdleAge,
+        address:    canonicalAddress(backend.URL),
+        dialer:     transport.DialContext,
+    }
+    if preconnector.dialer == nil {
+        preconnector.dialer = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+    }
+    if backend.URL.Scheme == "https" {
+        preconnector.tlsConfig = transport.TLSClientConfig.Clone()
+        if preconnector.tlsConfig == nil {
+            preconnector.tlsConfig = &tls.Config{}
+        }
+        if preconnector.tlsConfig.ServerName == "" {
+            preconnector.tlsConfig.ServerName = backend.URL.Hostname()
+        }
+        if len(preconnector.tlsConfig.NextProtos) == 0 && transport.ForceAttemptHTTP2 {
+            preconnector.tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+        }
+        transport.DialTLSContext = preconnector.dialTLS
+    }
+    transport.DialContext = preconnector.dial
+
+    backend.preconnector = preconnector
+    return preconnector, nil
+}
+
+func (backend *Backend) Preconnector() *Preconnector {
+    backend.mux.RLock()
+    preconnector := backend.preconnector
+    backend.mux.RUnlock()
+
+    return preconnector
+}
+
+func (backend *Backend) httpTransport() (*http.Transport, error) {
+    // The shared default transport is cloned rather than tuned, so other
+    // backends and clients keep their settings.
+    if backend.ReverseProxy.Transport == http.DefaultTransport {
+        backend.ReverseProxy.Transport = nil
+    }
+    switch transport := backend.ReverseProxy.Transport.(type) {
+    case nil:
+        clone := http.DefaultTransport.(*http.Transport).Clone()
+        backend.ReverseProxy.Transport = clone
+        return clone, nil
+    case *http.Transport:
+        return transport, nil
+    case *RecyclingTransport:
+        return nil, errors.New("preconnect: enable before connection recycling")
+    default:
+        return nil, fmt.Errorf("preconnect: unsupported transport %T", transport)
+    }
+}
+
+// Fill tops the idle set back up to MinIdle, discarding connections older
+// than MaxIdleAge first so backends never see connections they have timed out.
+func (preconnector *Preconnector) Fill(ctx context.Context) error {
+    preconnector.mux.Lock()
+    preconnector.expireLocked(time.Now())
+    missing := preconnector.MinIdle - len(preconnector.idle)
+    preconnector.mux.Unlock()
+
+    for i := 0; i < missing; i++ {
+        conn, err := preconnector.connect(ctx)
+        if err != nil {
+            return err
+        }
+
+        preconnector.mux.Lock()
+        if ctx.Err() != nil || len(preconnector.idle) >= preconnector.MinIdle {
+            preconnector.mux.Unlock()
+            conn.Close()
+            return nil
+        }
+        preconnector.idle = append(preconnector.idle, idleConn{conn: conn, dialed: time.Now()})
+        preconnector.mux.Unlock()
+    }
+    return nil
+}
+
+func (preconnector *Preconnector) Drain() {
+    preconnector.mux.Lock()
+    idle := preconnector.idle
+    preconnector.idle = nil
+    preconnector.mux.Unlock()
+
+    for _, entry := range idle {
+        entry.conn.Close()
+    }
+}
+
+func (preconnector *Preconnector) Idle() int {
+    preconnector.mux.Lock()
+    defer preconnector.mux.Unlock()
+
+    return len(preconnector.idle)
+}
+
+// Stats reports how many dials were served from the idle set and how many
+// had to open a fresh connection.
+func (preconnector *Preconnector) Stats() (hits, misses uint64) {
+    return preconnector.hits.Load(), preconnector.misses.Load()
+}
+
+func (preconnector *Preconnector) dial(ctx context.Context, network, address string) (net.Conn, error) {
+    if preconnector.tlsConfig == nil && address == preconnector.address {
+        if conn := preconnector.take(); conn != nil {
+            return conn, nil
+        }
+        preconnector.misses.Add(1)
+    }
+    return preconnector.dialer(ctx, network, address)
+}
+
+func (preconnector *Preconnector) dialTLS(ctx context.Context, network, address string) (net.Conn, error) {
+    if address == preconnector.address {
+        if conn := preconnector.take(); conn != nil {
+            return conn, nil
+        }
+        preconnector.misses.Add(1)
+        return preconnector.handshake(ctx, network, address)
+    }
+
+    config := preconnector.tlsConfig.Clone()
+    config.ServerName, _, _ = net.SplitHostPort(address)
+    return tlsDial(ctx, preconnector.dialer, network, address, config)
+}
+
+func (preconnector *Preconnector) connect(ctx context.Context) (net.Conn, error) {
+    if preconnector.tlsConfig != nil {
+        return preconnector.handshake(ctx, "tcp", preconnector.address)
+    }
+    return preconnector.dialer(ctx, "tcp", preconnector.address)
+}
+
+func (preconnector *Preconnector) handshake(ctx context.Context, network, address string) (net.Conn, error) {
+    return tlsDial(ctx, preconnector.dialer, network, address, preconnector.tlsConfig)
+}
+
+func tlsDial(ctx context.Context, dialer func(context.Context, string, string) (net.Conn, error), network, address string, config *tls.Config) (net.Conn, error) {
+    raw, err := dialer(ctx, network, address)
+    if err != nil {
+        return nil, err
+    }
+    conn := tls.Client(raw, config)
+    if err := conn.HandshakeContext(ctx); err != nil {
+        raw.Close()
+        return nil, err
+    }
+    return conn, nil
+}
+
+func (preconnector *Preconnector) take() net.Conn {
+    preconnector.mux.Lock()
+    defer preconnector.mux.Unlock()
+
+    preconnector.expireLocked(time.Now())
+    for len(preconnector.idle) > 0 {
+        last := len(preconnector.idle) - 1
+        entry := preconnector.idle[last]
+        preconnector.idle = preconnector.idle[:last]
+        if usable(entry.conn) {
+            preconnector.hits.Add(1)
+            return entry.conn
+        }
+        entry.conn.Close()
+    }
+    return nil
+}
+
+func (preconnector *Preconnector) expireLocked(now time.Time) {
+    if preconnector.MaxIdleAge <= 0 {
+        return
+    }
+    kept := preconnector.idle[:0]
+    for _, entry := range preconnector.idle {
+        if now.Sub(entry.dialed) >= preconnector.MaxIdleAge {
+            entry.conn.Close()
+            continue
+        }
+        kept = append(kept, entry)
+    }
+    preconnector.idle = kept
+}
+
+// usable peeks at the connection with a near-immediate deadline: an idle
+// connection the peer has closed reads EOF at once, while a healthy one times
+// out. An already-expired deadline would skip the read entirely.
+func usable(conn net.Conn) bool {
+    if err := conn.SetReadDeadline(time.Now().Add(time.Millisecond)); err != nil {
+        return false
+    }
+    var probe [1]byte
+    _, err := conn.Read(probe[:])
+    conn.SetReadDeadline(time.Time{})
+
+    var netErr net.Error
+    return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func canonicalAddress(target *url.URL) string {
+    port := target.Port()
+    if port == "" {
+        port = "80"
+        if target.Scheme == "https" {
+            port = "443"
+        }
+    }
+    return net.JoinHostPort(target.Hostname(), port)
+}
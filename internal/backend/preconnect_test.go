@@ -0,0 +1,174 @@
+package backend
+
+import (
+    "context"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "sync"
+    "testing"
+    "time"
+)
+
+func newHandshakeCountingServer(tlsServer bool) (*httptest.Server, func() int) {
+    var mux sync.Mutex
+    opened := 0
+
+    server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte("ok"))
+    }))
+    server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+        if state == http.StateNew {
+            mux.Lock()
+            opened++
+            mux.Unlock()
+        }
+    }
+    if tlsServer {
+        server.StartTLS()
+    } else {
+        server.Start()
+    }
+
+    count := func() int {
+        mux.Lock()
+        defer mux.Unlock()
+        return opened
+    }
+    return server, count
+}
+
+func TestBackend_EnablePreconnect(t *testing.T) {
+    tests := []struct {
+        name string
+        tls  bool
+    }{
+        {name: "plain http", tls: false},
+        {name: "tls", tls: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            server, opened := newHandshakeCountingServer(tt.tls)
+            defer server.Close()
+
+            serverURL, _ := url.Parse(server.URL)
+            proxy := httputil.NewSingleHostReverseProxy(serverURL)
+            proxy.Transport = server.Client().Transport.(*http.Transport).Clone()
+            backend := &Backend{URL: serverURL, Alive: true, ReverseProxy: proxy}
+
+            preconnector, err := backend.EnablePreconnect(2, time.Minute)
+            if err != nil {
+                t.Fatalf("EnablePreconnect() error: %v", err)
+            }
+            defer preconnector.Drain()
+            if err := preconnector.Fill(context.Background()); err != nil {
+                t.Fatalf("Fill() error: %v", err)
+            }
+            if preconnector.Idle() != 2 {
+                t.Fatalf("Expected 2 idle connections, got %d", preconnector.Idle())
+            }
+
+            rr := httptest.NewRecorder()
+            backend.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+            if rr.Code != http.StatusOK {
+                t.Fatalf("Expected status 200, got %d", rr.Code)
+            }
+
+            if got := opened(); got != 2 {
+                t.Errorf("Expected request to reuse a preconnected connection, server saw %d", got)
+            }
+            if hits, misses := preconnector.Stats(); hits != 1 || misses != 0 {
+                t.Errorf("Stats() = %d hits, %d misses; expected 1, 0", hits, misses)
+            }
+            if preconnector.Idle() != 1 {
+                t.Errorf("Expected 1 idle connection left, got %d", preconnector.Idle())
+            }
+        })
+    }
+}
+
+func TestPreconnector_DiscardsStaleConnections(t *testing.T) {
+    tests := []struct {
+        name       string
+        maxIdleAge time.Duration
+        closePeer  bool
+    }{
+        {name: "expired by age", maxIdleAge: 10 * time.Millisecond},
+        {name: "closed by backend", maxIdleAge: time.Minute, closePeer: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            listener, err := net.Listen("tcp", "127.0.0.1:0")
+            if err != nil {
+                t.Fatal(err)
+            }
+            defer listener.Close()
+
+            accepted := make(chan net.Conn, 1)
+            go func() {
+                conn, err := listener.Accept()
+                if err == nil {
+                    accepted <- conn
+                }
+            }()
+
+            serverURL, _ := url.Parse("http://" + listener.Addr().String())
+            backend := &Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)}
+
+            preconnector, err := backend.EnablePreconnect(1, tt.maxIdleAge)
+            if err != nil {
+                t.Fatalf("EnablePreconnect() error: %v", err)
+            }
+            if err := preconnector.Fill(context.Background()); err != nil {
+                t.Fatalf("Fill() error: %v", err)
+            }
+
+            peer := <-accepted
+            if tt.closePeer {
+                peer.Close()
+                time.Sleep(20 * time.Millisecond)
+            } else {
+                defer peer.Close()
+                time.Sleep(2 * tt.maxIdleAge)
+            }
+
+            if conn := preconnector.take(); conn != nil {
+                conn.Close()
+                t.Error("Expected stale connection to be discarded")
+            }
+        })
+    }
+}
+
+func TestBackend_EnablePreconnectAfterRecycling(t *testing.T) {
+    serverURL, _ := url.Parse("http://127.0.0.1:1")
+    backend := &Backend{URL: serverURL, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)}
+    backend.SetConnectionRecycling(10, 0)
+
+    if _, err := backend.EnablePreconnect(1, 0); err == nil {
+        t.Error("Expected error enabling preconnect on a recycling transport")
+    }
+}
+
+func TestCanonicalAddress(t *testing.T) {
+    tests := []struct {
+        raw      string
+        expected string
+    }{
+        {raw: "http://example.com", expected: "example.com:80"},
+        {raw: "https://example.com", expected: "example.com:443"},
+        {raw: "http://10.0.0.1:8080", expected: "10.0.0.1:8080"},
+        {raw: "https://[::1]", expected: "[::1]:443"},
+    }
+
+    for _, tt := range tests {
+        target, _ := url.Parse(tt.raw)
+        if got := canonicalAddress(target); got != tt.expected {
+            t.Errorf("canonicalAddress(%s) = %s, expected %s", tt.raw, got, tt.expected)
+        }
+    }
+}
@@ -0,0 +1,183 @@
+package backend
+
+import (
+    "context"
+    "crypto/tls"
+    "errors"
+    "net"
+    "net/http"
+    "net/http/httptrace"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// ConnReaper tracks a backend's upstream connections and closes those that
+// have carried no request for longer than MaxIdle. Unlike the transport's
+// own idle timeout it can report how many connections are open and idle.
+type ConnReaper struct {
+    MaxIdle time.Duration
+
+    dialer func(ctx context.Context, network, address string) (net.Conn, error)
+
+    mux    sync.Mutex
+    conns  map[*reapableConn]struct{}
+    reaped atomic.Uint64
+}
+
+type reapableConn struct {
+    net.Conn
+    reaper *ConnReaper
+
+    // busy, lastActive and reaped are guarded by reaper.mux.
+    busy       int
+    lastActive time.Time
+    reaped     bool
+    closeOnce  sync.Once
+}
+
+// EnableReaper routes the backend's dials through a ConnReaper. Calling it
+// again adjusts MaxIdle. It must come before EnablePreconnect so that
+// preconnected connections are tracked too.
+func (backend *Backend) EnableReaper(maxIdle time.Duration) (*ConnReaper, error) {
+    backend.mux.Lock()
+    defer backend.mux.Unlock()
+
+    if backend.reaper != nil {
+        backend.reaper.mux.Lock()
+        backend.reaper.MaxIdle = maxIdle
+        backend.reaper.mux.Unlock()
+        return backend.reaper, nil
+    }
+
+    if backend.preconnector != nil {
+        return nil, errors.New("reaper: enable before preconnect")
+    }
+    transport, err := backend.httpTransport()
+    if err != nil {
+        return nil, err
+    }
+    reaper := &ConnReaper{
+        MaxIdle: maxIdle,
+        dialer:  transport.DialContext,
+        conns:   make(map[*reapableConn]struct{}),
+    }
+    if reaper.dialer == nil {
+        reaper.dialer = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+    }
+    transport.DialContext = reaper.dial
+
+    backend.reaper = reaper
+    return reaper, nil
+}
+
+func (backend *Backend) Reaper() *ConnReaper {
+    backend.mux.RLock()
+    reaper := backend.reaper
+    backend.mux.RUnlock()
+
+    return reaper
+}
+
+func (reaper *ConnReaper) dial(ctx context.Context, network, address string) (net.Conn, error) {
+    conn, err := reaper.dialer(ctx, network, address)
+    if err != nil {
+        return nil, err
+    }
+    tracked := &reapableConn{Conn: conn, reaper: reaper, lastActive: time.Now()}
+
+    reaper.mux.Lock()
+    reaper.conns[tracked] = struct{}{}
+    reaper.mux.Unlock()
+    return tracked, nil
+}
+
+func (conn *reapableConn) Close() error {
+    conn.closeOnce.Do(func() {
+        conn.reaper.mux.Lock()
+        delete(conn.reaper.conns, conn)
+        conn.reaper.mux.Unlock()
+    })
+    return conn.Conn.Close()
+}
+
+// track marks the connections request is sent on as busy until done is
+// called.
+func (reaper *ConnReaper) track(request *http.Request) (*http.Request, func()) {
+    var mux sync.Mutex
+    var used []*reapableConn
+
+    trace := &httptrace.ClientTrace{
+        GotConn: func(info httptrace.GotConnInfo) {
+            conn := info.Conn
+            if tlsConn, ok := conn.(*tls.Conn); ok {
+                conn = tlsConn.NetConn()
+            }
+            tracked, ok := conn.(*reapableConn)
+            if !ok {
+                return
+            }
+            reaper.mux.Lock()
+            if tracked.reaped {
+                reaper.mux.Unlock()
+                return
+            }
+            tracked.busy++
+            reaper.mux.Unlock()
+
+            mux.Lock()
+            used = append(used, tracked)
+            mux.Unlock()
+        },
+    }
+    done := func() {
+        now := time.Now()
+        mux.Lock()
+        defer mux.Unlock()
+
+        reaper.mux.Lock()
+        for _, tracked := range used {
+            tracked.busy--
+            tracked.lastActive = now
+        }
+        reaper.mux.Unlock()
+    }
+    return request.WithContext(httptrace.WithClientTrace(request.Context(), trace)), done
+}
+
+// Reap closes the connections idle for longer than MaxIdle at now and
+// returns how many it closed. They are marked reaped and untracked before
+// the lock is released, so a request picking one up in the meantime cannot
+// mark it busy again and concurrent Reaps never close it twice.
+func (reaper *ConnReaper) Reap(now time.Time) int {
+    reaper.mux.Lock()
+    var idle []*reapableConn
+    for conn := range reaper.conns {
+        if conn.busy == 0 && now.Sub(conn.lastActive) > reaper.MaxIdle {
+            conn.reaped = true
+            delete(reaper.conns, conn)
+            idle = append(idle, conn)
+        }
+    }
+    reaper.mux.Unlock()
+
+    for _, conn := range idle {
+        conn.Close()
+    }
+    reaper.reaped.Add(uint64(len(idle)))
+    return len(idle)
+}
+
+// Stats reports the connections currently open, how many of those carry no
+// request, and how many have been reaped in total.
+func (reaper *ConnReaper) Stats() (open, idle int, reaped uint64) {
+    reaper.mux.Lock()
+    defer reaper.mux.Unlock()
+
+    for conn := range reaper.conns {
+        if conn.busy == 0 {
+            idle++
+        }
+    }
+    return len(reaper.conns), idle, reaper.reaped.Load()
+}
@@ -0,0 +1,89 @@
+package backend
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "testing"
+    "time"
+)
+
+func TestConnReaper_Reap(t *testing.T) {
+    release := make(chan struct{})
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/slow" {
+            <-release
+        }
+        w.Write([]byte("ok"))
+    }))
+    defer server.Close()
+
+    serverURL, _ := url.Parse(server.URL)
+    proxy := httputil.NewSingleHostReverseProxy(serverURL)
+    proxy.Transport = http.DefaultTransport.(*http.Transport).Clone()
+    backend := &Backend{URL: serverURL, Alive: true, ReverseProxy: proxy}
+
+    reaper, err := backend.EnableReaper(time.Minute)
+    if err != nil {
+        t.Fatalf("EnableReaper() error: %v", err)
+    }
+
+    rr := httptest.NewRecorder()
+    backend.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+    if rr.Code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", rr.Code)
+    }
+    if open, idle, _ := reaper.Stats(); open != 1 || idle != 1 {
+        t.Fatalf("Expected 1 open idle connection, got %d open %d idle", open, idle)
+    }
+
+    if reaped := reaper.Reap(time.Now()); reaped != 0 {
+        t.Errorf("Expected no connections reaped before MaxIdle, got %d", reaped)
+    }
+    if reaped := reaper.Reap(time.Now().Add(2 * time.Minute)); reaped != 1 {
+        t.Errorf("Expected the idle connection to be reaped, got %d", reaped)
+    }
+    if open, _, total := reaper.Stats(); open != 0 || total != 1 {
+        t.Errorf("Expected 0 open and 1 reaped, got %d open %d reaped", open, total)
+    }
+
+    done := make(chan struct{})
+    go func() {
+        backend.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+        close(done)
+    }()
+    deadline := time.Now().Add(2 * time.Second)
+    for {
+        if open, idle, _ := reaper.Stats(); open == 1 && idle == 0 {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("Expected a busy connection for the slow request")
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+    if reaped := reaper.Reap(time.Now().Add(time.Hour)); reaped != 0 {
+        t.Errorf("Expected busy connections never to be reaped, got %d", reaped)
+    }
+    close(release)
+    <-done
+
+    if _, err := backend.EnableReaper(time.Second); err != nil || reaper.MaxIdle != time.Second {
+        t.Errorf("Expected EnableReaper to adjust MaxIdle, got %s (%v)", reaper.MaxIdle, err)
+    }
+}
+
+func TestBackend_EnableReaperAfterPreconnect(t *testing.T) {
+    target, _ := url.Parse("http://127.0.0.1:1")
+    proxy := httputil.NewSingleHostReverseProxy(target)
+    proxy.Transport = http.DefaultTransport.(*http.Transport).Clone()
+    backend := &Backend{URL: target, ReverseProxy: proxy}
+
+    if _, err := backend.EnablePreconnect(1, time.Second); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := backend.EnableReaper(time.Second); err == nil {
+        t.Error("Expected an error enabling the reaper after preconnect")
+    }
+}
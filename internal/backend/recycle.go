@@ -0,0 +1,131 @@
+package backend
+
+import (
+    "io"
+    "net/http"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// drainedGrace is how long after a retired generation drains its idle
+// connections are closed once more: the transport hands a connection back
+// to its pool after the response body is read, racing the close that
+// follows the last body's Close.
+const drainedGrace = 100 * time.Millisecond
+
+type RecyclingTransport struct {
+    MaxRequests uint64
+    MaxLifetime time.Duration
+
+    base     *http.Transport
+    mux      sync.Mutex
+    current  *generation
+    recycled atomic.Uint64
+}
+
+type generation struct {
+    transport *http.Transport
+    created   time.Time
+    requests  uint64
+    inFlight  atomic.Int64
+    retired   atomic.Bool
+}
+
+func NewRecyclingTransport(base *http.Transport, maxRequests uint64, maxLifetime time.Duration) *RecyclingTransport {
+    if base == nil {
+        base = http.DefaultTransport.(*http.Transport)
+    }
+    transport := &RecyclingTransport{
+        MaxRequests: maxRequests,
+        MaxLifetime: maxLifetime,
+        base:        base,
+    }
+    transport.current = transport.newGeneration()
+    return transport
+}
+
+func (backend *Backend) SetConnectionRecycling(maxRequests uint64, maxLifetime time.Duration) {
+    base, _ := backend.ReverseProxy.Transport.(*http.Transport)
+    backend.ReverseProxy.Transport = NewRecyclingTransport(base, maxRequests, maxLifetime)
+}
+
+func (transport *RecyclingTransport) Recycled() uint64 {
+    return transport.recycled.Load()
+}
+
+func (transport *RecyclingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+    gen := transport.acquire()
+
+    response, err := gen.transport.RoundTrip(request)
+    if err != nil {
+        gen.release()
+        return nil, err
+    }
+    if response.StatusCode == http.StatusSwitchingProtocols {
+        gen.release()
+        return response, nil
+    }
+    response.Body = &generationBody{ReadCloser: response.Body, gen: gen}
+    return response, nil
+}
+
+func (transport *RecyclingTransport) CloseIdleConnections() {
+    transport.mux.Lock()
+    current := transport.current
+    transport.mux.Unlock()
+
+    current.transport.CloseIdleConnections()
+}
+
+func (transport *RecyclingTransport) acquire() *generation {
+    transport.mux.Lock()
+    defer transport.mux.Unlock()
+
+    gen := transport.current
+    expiredByCount := transport.MaxRequests > 0 && gen.requests >= transport.MaxRequests
+    expiredByAge := transport.MaxLifetime > 0 && time.Since(gen.created) >= transport.MaxLifetime
+    if expiredByCount || expiredByAge {
+        gen.retire()
+        gen = transport.newGeneration()
+        transport.current = gen
+        transport.recycled.Add(1)
+    }
+
+    gen.requests++
+    gen.inFlight.Add(1)
+    return gen
+}
+
+func (transport *RecyclingTransport) newGeneration() *generation {
+    return &generation{
+        transport: transport.base.Clone(),
+        created:   time.Now(),
+    }
+}
+
+func (gen *generation) retire() {
+    gen.retired.Store(true)
+    if gen.inFlight.Load() == 0 {
+        gen.transport.CloseIdleConnections()
+    }
+}
+
+func (gen *generation) release() {
+    if gen.inFlight.Add(-1) == 0 && gen.retired.Load() {
+        gen.transport.CloseIdleConnections()
+        time.AfterFunc(drainedGrace, gen.transport.CloseIdleConnections)
+    }
+}
+
+type generationBody struct {
+    io.ReadCloser
+    gen  *generation
+    once sync.Once
+}
+
+func (body *generationBody) Close() error {
+    err := body.ReadCloser.Close()
+    body.once.Do(body.gen.release)
+    return err
+}
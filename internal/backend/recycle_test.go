@@ -0,0 +1,189 @@
+package backend
+
+import (
+    "io"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "sync"
+    "testing"
+    "time"
+)
+
+func newConnectionCountingServer() (*httptest.Server, func() int) {
+    var mux sync.Mutex
+    connections := make(map[string]bool)
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        mux.Lock()
+        connections[r.RemoteAddr] = true
+        mux.Unlock()
+        w.Write([]byte("ok"))
+    }))
+
+    count := func() int {
+        mux.Lock()
+        defer mux.Unlock()
+        return len(connections)
+    }
+    return server, count
+}
+
+func TestRecyclingTransport_RoundTrip(t *testing.T) {
+    tests := []struct {
+        name                string
+        maxRequests         uint64
+        maxLifetime         time.Duration
+        requests            int
+        pause               time.Duration
+        expectedConnections int
+        expectedRecycled    uint64
+    }{
+        {
+            name:                "no limits reuses one connection",
+            requests:            4,
+            expectedConnections: 1,
+            expectedRecycled:    0,
+        },
+        {
+            name:                "recycle after two requests",
+            maxRequests:         2,
+            requests:            5,
+            expectedConnections: 3,
+            expectedRecycled:    2,
+        },
+        {
+            name:                "recycle after lifetime",
+            maxLifetime:         20 * time.Millisecond,
+            requests:            2,
+            pause:               30 * time.Millisecond,
+            expectedConnections: 2,
+            expectedRecycled:    1,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            server, connections := newConnectionCountingServer()
+            defer server.Close()
+
+            transport := NewRecyclingTransport(nil, tt.maxRequests, tt.maxLifetime)
+            defer transport.CloseIdleConnections()
+            client := &http.Client{Transport: transport}
+
+            for i := 0; i < tt.requests; i++ {
+                resp, err := client.Get(server.URL)
+                if err != nil {
+                    t.Fatalf("request %d failed: %v", i, err)
+                }
+                io.Copy(io.Discard, resp.Body)
+                resp.Body.Close()
+                time.Sleep(tt.pause)
+            }
+
+            if got := connections(); got != tt.expectedConnections {
+                t.Errorf("Expected %d upstream connections, got %d", tt.expectedConnections, got)
+            }
+            if got := transport.Recycled(); got != tt.expectedRecycled {
+                t.Errorf("Recycled() = %d, expected %d", got, tt.expectedRecycled)
+            }
+        })
+    }
+}
+
+func TestBackend_SetConnectionRecycling(t *testing.T) {
+    server, connections := newConnectionCountingServer()
+    defer server.Close()
+
+    serverURL, _ := url.Parse(server.URL)
+    backend := &Backend{
+        URL:          serverURL,
+        Alive:        true,
+        ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL),
+    }
+    backend.SetConnectionRecycling(1, 0)
+
+    transport, ok := backend.ReverseProxy.Transport.(*RecyclingTransport)
+    if !ok {
+        t.Fatalf("Expected RecyclingTransport, got %T", backend.ReverseProxy.Transport)
+    }
+
+    for i := 0; i < 3; i++ {
+        rr := httptest.NewRecorder()
+        backend.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+        if rr.Code != http.StatusOK {
+            t.Fatalf("request %d: expected status 200, got %d", i, rr.Code)
+        }
+    }
+
+    if got := connections(); got != 3 {
+        t.Errorf("Expected 3 upstream connections, got %d", got)
+    }
+    if got := transport.Recycled(); got != 2 {
+        t.Errorf("Recycled() = %d, expected 2", got)
+    }
+}
+
+func TestRecyclingTransport_ClosesDrainedGeneration(t *testing.T) {
+    release := make(chan struct{})
+    closed := make(chan struct{}, 2)
+    server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/slow" {
+            <-release
+        }
+        w.Write([]byte("ok"))
+    }))
+    server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+        if state == http.StateClosed {
+            closed <- struct{}{}
+        }
+    }
+    server.EnableHTTP2 = true
+    server.StartTLS()
+    defer server.Close()
+
+    transport := NewRecyclingTransport(server.Client().Transport.(*http.Transport), 1, 0)
+    defer transport.CloseIdleConnections()
+    client := &http.Client{Transport: transport}
+
+    slow := make(chan *http.Response)
+    go func() {
+        resp, err := client.Get(server.URL + "/slow")
+        if err != nil {
+            t.Errorf("slow request failed: %v", err)
+        }
+        slow <- resp
+    }()
+    for {
+        transport.mux.Lock()
+        started := transport.current.inFlight.Load() > 0
+        transport.mux.Unlock()
+        if started {
+            break
+        }
+        time.Sleep(time.Millisecond)
+    }
+
+    resp, err := client.Get(server.URL)
+    if err != nil {
+        t.Fatalf("request failed: %v", err)
+    }
+    io.Copy(io.Discard, resp.Body)
+    resp.Body.Close()
+
+    close(release)
+    resp = <-slow
+    if resp == nil {
+        return
+    }
+    io.Copy(io.Discard, resp.Body)
+    resp.Body.Close()
+
+    select {
+    case <-closed:
+    case <-time.After(2 * time.Second):
+        t.Errorf("Expected the retired generation's connection closed once it drained")
+    }
+}
@@ -0,0 +1,41 @@
+package backend
+
+import (
+    "math"
+    "time"
+)
+
+// rttWindow is the time constant of the connect RTT average, long enough to
+// ride out a single slow handshake.
+const rttWindow = 30 * time.Second
+
+// rtt is a decaying average of the time taken to open a TCP connection to
+// the backend.
+type rtt struct {
+    average time.Duration
+    sampled time.Time
+}
+
+// ObserveRTT folds a measured connect time into the backend's average.
+func (backend *Backend) ObserveRTT(sample time.Duration, now time.Time) {
+    backend.mux.Lock()
+    defer backend.mux.Unlock()
+
+    average := &backend.rtt
+    if average.sampled.IsZero() {
+        average.average, average.sampled = sample, now
+        return
+    }
+    weight := math.Exp(-float64(now.Sub(average.sampled)) / float64(rttWindow))
+    average.average = time.Duration(float64(average.average)*weight + float64(sample)*(1-weight))
+    average.sampled = now
+}
+
+// RTT returns the average connect time to the backend, or zero before it
+// has been measured.
+func (backend *Backend) RTT() time.Duration {
+    backend.mux.RLock()
+    defer backend.mux.RUnlock()
+
+    return backend.rtt.average
+}
@@ -0,0 +1,152 @@
+package backend
+
+import (
+    "context"
+    "io"
+    "net/http"
+    "sync/atomic"
+    "time"
+)
+
+type Stats struct {
+    Requests      uint64
+    Errors        uint64
+    ClientAborts  uint64
+    BytesIn       uint64
+    BytesOut      uint64
+    InFlight      int64
+    LastUsed      time.Time
+    TLSHandshakes uint64
+    TLSResumed    uint64
+    TLSFailures   uint64
+    WeightFactor  float64
+}
+
+type counters struct {
+    requests      atomic.Uint64
+    errors        atomic.Uint64
+    clientAborts  atomic.Uint64
+    bytesIn       atomic.Uint64
+    bytesOut      atomic.Uint64
+    inFlight      atomic.Int64
+    lastUsed      atomic.Int64
+    tlsHandshakes atomic.Uint64
+    tlsResumed    atomic.Uint64
+    tlsFailures   atomic.Uint64
+}
+
+func (backend *Backend) Stats() Stats {
+    stats := Stats{
+        Requests:      backend.counters.requests.Load(),
+        Errors:        backend.counters.errors.Load(),
+        ClientAborts:  backend.counters.clientAborts.Load(),
+        BytesIn:       backend.counters.bytesIn.Load(),
+        BytesOut:      backend.counters.bytesOut.Load(),
+        InFlight:      backend.counters.inFlight.Load(),
+        TLSHandshakes: backend.counters.tlsHandshakes.Load(),
+        TLSResumed:    backend.counters.tlsResumed.Load(),
+        TLSFailures:   backend.counters.tlsFailures.Load(),
+        WeightFactor:  backend.WeightFactor(),
+    }
+    if lastUsed := backend.counters.lastUsed.Load(); lastUsed != 0 {
+        stats.LastUsed = time.Unix(0, lastUsed)
+    }
+    return stats
+}
+
+// RestoreStats adds the cumulative counts in stats to the backend's, so
+// totals saved before a restart carry on. InFlight, LastUsed and
+// WeightFactor describe the present and are ignored.
+func (backend *Backend) RestoreStats(stats Stats) {
+    backend.counters.requests.Add(stats.Requests)
+    backend.counters.errors.Add(stats.Errors)
+    backend.counters.clientAborts.Add(stats.ClientAborts)
+    backend.counters.bytesIn.Add(stats.BytesIn)
+    backend.counters.bytesOut.Add(stats.BytesOut)
+    backend.counters.tlsHandshakes.Add(stats.TLSHandshakes)
+    backend.counters.tlsResumed.Add(stats.TLSResumed)
+    backend.counters.tlsFailures.Add(stats.TLSFailures)
+}
+
+// InFlight returns the requests currently being proxied to the backend,
+// counted around each Forward.
+func (backend *Backend) InFlight() int64 {
+    return backend.counters.inFlight.Load()
+}
+
+func (backend *Backend) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+    backend.Forward(backend.ReverseProxy, writer, request)
+}
+
+func (backend *Backend) Forward(handler http.Handler, writer http.ResponseWriter, request *http.Request) {
+    backend.counters.inFlight.Add(1)
+    backend.counters.lastUsed.Store(time.Now().UnixNano())
+    defer backend.counters.inFlight.Add(-1)
+
+    if request.Body != nil && request.Body != http.NoBody {
+        request.Body = &countingReader{ReadCloser: request.Body, count: &backend.counters.bytesIn}
+    }
+    recorder := &statsWriter{ResponseWriter: writer, count: &backend.counters.bytesOut}
+    if backend.URL != nil && backend.URL.Scheme == "https" {
+        request = backend.traceHandshakes(request)
+    }
+    if reaper := backend.Reaper(); reaper != nil {
+        var done func()
+        request, done = reaper.track(request)
+        defer done()
+    }
+
+    handler.ServeHTTP(recorder, request)
+
+    backend.counters.requests.Add(1)
+    switch {
+    case ClientGone(request):
+        backend.counters.clientAborts.Add(1)
+    case recorder.status >= http.StatusInternalServerError:
+        backend.counters.errors.Add(1)
+    }
+}
+
+// ClientGone reports whether the request was abandoned by the client, as
+// opposed to cut short by a timeout or cancelled by the balancer itself
+// (which cancels with its own cause).
+func ClientGone(request *http.Request) bool {
+    return context.Cause(request.Context()) == context.Canceled
+}
+
+type countingReader struct {
+    io.ReadCloser
+    count *atomic.Uint64
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+    n, err := reader.ReadCloser.Read(p)
+    reader.count.Add(uint64(n))
+    return n, err
+}
+
+type statsWriter struct {
+    http.ResponseWriter
+    status int
+    count  *atomic.Uint64
+}
+
+func (writer *statsWriter) WriteHeader(status int) {
+    if writer.status == 0 {
+        writer.status = status
+    }
+    writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *statsWriter) Write(p []byte) (int, error) {
+    if writer.status == 0 {
+        writer.status = http.StatusOK
+    }
+    n, err := writer.ResponseWriter.Write(p)
+    writer.count.Add(uint64(n))
+    return n, err
+}
+
+func (writer *statsWriter) Unwrap() http.ResponseWriter {
+    return writer.ResponseWriter
+}
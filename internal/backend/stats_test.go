@@ -0,0 +1,95 @@
+package backend
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestBackend_Stats(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        io.Copy(io.Discard, r.Body)
+        if r.URL.Path == "/fail" {
+            w.WriteHeader(http.StatusInternalServerError)
+            return
+        }
+        w.Write([]byte("hello"))
+    }))
+    defer server.Close()
+
+    serverURL, _ := url.Parse(server.URL)
+    backend := &Backend{
+        URL:          serverURL,
+        Alive:        true,
+        ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL),
+    }
+
+    if !backend.Stats().LastUsed.IsZero() {
+        t.Error("LastUsed should be zero before any request")
+    }
+
+    before := time.Now()
+    backend.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("payload")))
+    backend.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fail", nil))
+
+    stats := backend.Stats()
+
+    tests := []struct {
+        name     string
+        actual   uint64
+        expected uint64
+    }{
+        {name: "requests", actual: stats.Requests, expected: 2},
+        {name: "errors", actual: stats.Errors, expected: 1},
+        {name: "bytes in", actual: stats.BytesIn, expected: uint64(len("payload"))},
+        {name: "bytes out", actual: stats.BytesOut, expected: uint64(len("hello"))},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if tt.actual != tt.expected {
+                t.Errorf("Stats().%s = %d, expected %d", tt.name, tt.actual, tt.expected)
+            }
+        })
+    }
+
+    if stats.InFlight != 0 {
+        t.Errorf("Expected no in-flight requests, got %d", stats.InFlight)
+    }
+    if stats.LastUsed.Before(before) {
+        t.Errorf("LastUsed %v should not be before %v", stats.LastUsed, before)
+    }
+}
+
+func TestBackend_StatsInFlight(t *testing.T) {
+    backend := &Backend{Alive: true}
+
+    release := make(chan struct{})
+    started := make(chan struct{})
+    handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        close(started)
+        <-release
+    })
+
+    done := make(chan struct{})
+    go func() {
+        backend.Forward(handler, httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+        close(done)
+    }()
+
+    <-started
+    if inFlight := backend.Stats().InFlight; inFlight != 1 {
+        t.Errorf("Expected 1 in-flight request, got %d", inFlight)
+    }
+
+    close(release)
+    <-done
+    if inFlight := backend.Stats().InFlight; inFlight != 0 {
+        t.Errorf("Expected 0 in-flight requests after completion, got %d", inFlight)
+    }
+}
@@ -0,0 +1,48 @@
+package backend
+
+import (
+    "math"
+    "time"
+)
+
+// throughputWindow is the time constant of the throughput average: bursts
+// older than a few windows barely count.
+const throughputWindow = 5 * time.Second
+
+// throughput is a decaying average of the bytes per second moved through
+// the backend in both directions, sampled from its byte counters.
+type throughput struct {
+    bytes   uint64
+    sampled time.Time
+    rate    float64
+}
+
+// Throughput returns the bytes per second moved to and from the backend,
+// averaged over the last few seconds. Bytes are counted as they stream, so
+// long downloads in progress count towards it.
+func (backend *Backend) Throughput(now time.Time) float64 {
+    backend.mux.Lock()
+    defer backend.mux.Unlock()
+
+    // Loading the counters under the lock keeps concurrent callers from
+    // storing a newer total before an older one is compared against it.
+    total := backend.counters.bytesIn.Load() + backend.counters.bytesOut.Load()
+
+    sample := &backend.throughput
+    if sample.sampled.IsZero() {
+        sample.bytes, sample.sampled = total, now
+        return 0
+    }
+    elapsed := now.Sub(sample.sampled)
+    if elapsed <= 0 {
+        return sample.rate
+    }
+    var instant float64
+    if total > sample.bytes {
+        instant = float64(total-sample.bytes) / elapsed.Seconds()
+    }
+    weight := math.Exp(-float64(elapsed) / float64(throughputWindow))
+    sample.rate = sample.rate*weight + instant*(1-weight)
+    sample.bytes, sample.sampled = total, now
+    return sample.rate
+}
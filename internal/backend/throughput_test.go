@@ -0,0 +1,43 @@
+package backend
+
+import (
+    "testing"
+    "time"
+)
+
+func TestBackend_Throughput(t *testing.T) {
+    backend := &Backend{}
+    start := time.Unix(1000, 0)
+
+    if rate := backend.Throughput(start); rate != 0 {
+        t.Fatalf("Expected no throughput before any traffic, got %v", rate)
+    }
+
+    backend.counters.bytesOut.Add(1_000_000)
+    backend.counters.bytesIn.Add(1_000_000)
+    busy := backend.Throughput(start.Add(time.Second))
+    if busy <= 0 || busy >= 2_000_000 {
+        t.Errorf("Expected a rate between 0 and 2MB/s after one busy second, got %v", busy)
+    }
+
+    if rate := backend.Throughput(start.Add(time.Second)); rate != busy {
+        t.Errorf("Expected an unchanged rate without time passing, got %v want %v", rate, busy)
+    }
+
+    idle := backend.Throughput(start.Add(30 * time.Second))
+    if idle >= busy/100 {
+        t.Errorf("Expected the rate to decay after going idle, got %v from %v", idle, busy)
+    }
+}
+
+func TestBackend_ThroughputNeverUnderflows(t *testing.T) {
+    backend := &Backend{}
+    start := time.Unix(1000, 0)
+    backend.counters.bytesIn.Add(500)
+    backend.Throughput(start)
+    backend.throughput.bytes = 1000
+
+    if rate := backend.Throughput(start.Add(time.Second)); rate != 0 {
+        t.Errorf("Expected no throughput when the counters are behind the sample, got %v", rate)
+    }
+}
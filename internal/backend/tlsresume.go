@@ -0,0 +1,76 @@
+package backend
+
+import (
+    "crypto/tls"
+    "errors"
+    "net/http"
+    "net/http/httptrace"
+    "sync"
+    "time"
+)
+
+// HandshakeObserver is told about every TLS handshake to a backend: how long
+// it took, whether it resumed an earlier session and whether it failed.
+type HandshakeObserver func(elapsed time.Duration, resumed bool, err error)
+
+// EnableTLSResumption gives the backend's transport a session cache of
+// cacheSize entries, so new connections resume earlier sessions (tickets
+// or session IDs) instead of running a full handshake. observe, when not
+// nil, is called for each handshake. Enable it before preconnect, which
+// copies the TLS configuration and does its own handshakes.
+func (backend *Backend) EnableTLSResumption(cacheSize int, observe HandshakeObserver) error {
+    backend.mux.Lock()
+    defer backend.mux.Unlock()
+
+    if backend.preconnector != nil {
+        return errors.New("tls resumption: enable before preconnect")
+    }
+    transport, err := backend.httpTransport()
+    if err != nil {
+        return err
+    }
+    config := transport.TLSClientConfig.Clone()
+    if config == nil {
+        config = &tls.Config{}
+    }
+    if config.ClientSessionCache == nil {
+        config.ClientSessionCache = tls.NewLRUClientSessionCache(cacheSize)
+    }
+    transport.TLSClientConfig = config
+    backend.handshakes = observe
+    return nil
+}
+
+// traceHandshakes counts the TLS handshakes made while sending request.
+func (backend *Backend) traceHandshakes(request *http.Request) *http.Request {
+    backend.mux.RLock()
+    observe := backend.handshakes
+    backend.mux.RUnlock()
+
+    var mux sync.Mutex
+    var start time.Time
+    trace := &httptrace.ClientTrace{
+        TLSHandshakeStart: func() {
+            mux.Lock()
+            start = time.Now()
+            mux.Unlock()
+        },
+        TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+            mux.Lock()
+            elapsed := time.Since(start)
+            mux.Unlock()
+
+            backend.counters.tlsHandshakes.Add(1)
+            switch {
+            case err != nil:
+                backend.counters.tlsFailures.Add(1)
+            case state.DidResume:
+                backend.counters.tlsResumed.Add(1)
+            }
+            if observe != nil {
+                observe(elapsed, state.DidResume, err)
+            }
+        },
+    }
+    return request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+}
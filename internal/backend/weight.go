@@ -0,0 +1,76 @@
+package backend
+
+import (
+    "math"
+    "time"
+)
+
+const DefaultWeight = 1
+
+// weight moves linearly from one value to another over a transition period.
+// The zero value is DefaultWeight.
+type weight struct {
+    set      bool
+    from     float64
+    to       float64
+    start    time.Time
+    duration time.Duration
+}
+
+func (w *weight) at(now time.Time) float64 {
+    if !w.set {
+        return DefaultWeight
+    }
+    if w.duration <= 0 || !now.Before(w.start.Add(w.duration)) {
+        return w.to
+    }
+    progress := float64(now.Sub(w.start)) / float64(w.duration)
+    if progress < 0 {
+        progress = 0
+    }
+    return w.from + (w.to-w.from)*progress
+}
+
+// SetWeight changes the backend's weight to target, moving the effective
+// weight there gradually over transition, starting from wherever it is now.
+// A transition of zero applies the weight immediately.
+func (backend *Backend) SetWeight(target float64, transition time.Duration, now time.Time) {
+    backend.mux.Lock()
+    defer backend.mux.Unlock()
+
+    backend.weight = weight{
+        set:      true,
+        from:     backend.weight.at(now),
+        to:       target,
+        start:    now,
+        duration: transition,
+    }
+}
+
+// Weight returns the effective weight at now, and the weight it is moving
+// towards, both scaled by the weight factor.
+func (backend *Backend) Weight(now time.Time) (effective, target float64) {
+    factor := backend.WeightFactor()
+    backend.mux.RLock()
+    defer backend.mux.RUnlock()
+
+    if !backend.weight.set {
+        return DefaultWeight * factor, DefaultWeight * factor
+    }
+    return backend.weight.at(now) * factor, backend.weight.to * factor
+}
+
+// SetWeightFactor scales the backend's weight by factor, clamped to [0, 1],
+// on top of whatever weight is set, so a controller can send a degraded
+// backend less traffic without undoing the weights operators and schedules
+// set.
+func (backend *Backend) SetWeightFactor(factor float64) {
+    factor = math.Min(math.Max(factor, 0), 1)
+    backend.derating.Store(math.Float64bits(1 - factor))
+}
+
+// WeightFactor returns the factor the backend's weight is scaled by, 1
+// unless SetWeightFactor lowered it.
+func (backend *Backend) WeightFactor() float64 {
+    return 1 - math.Float64frombits(backend.derating.Load())
+}
@@ -0,0 +1,72 @@
+package backend
+
+import (
+    "testing"
+    "time"
+)
+
+func TestBackend_SetWeight(t *testing.T) {
+    backend := &Backend{}
+    start := time.Unix(1000, 0)
+
+    if effective, target := backend.Weight(start); effective != DefaultWeight || target != DefaultWeight {
+        t.Fatalf("Expected default weight %d, got %v towards %v", DefaultWeight, effective, target)
+    }
+
+    backend.SetWeight(11, 10*time.Second, start)
+
+    tests := []struct {
+        name     string
+        at       time.Duration
+        expected float64
+    }{
+        {name: "start of transition", at: 0, expected: 1},
+        {name: "halfway", at: 5 * time.Second, expected: 6},
+        {name: "end of transition", at: 10 * time.Second, expected: 11},
+        {name: "after transition", at: time.Minute, expected: 11},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            effective, target := backend.Weight(start.Add(tt.at))
+            if effective != tt.expected || target != 11 {
+                t.Errorf("Expected weight %v towards 11, got %v towards %v", tt.expected, effective, target)
+            }
+        })
+    }
+
+    backend.SetWeight(0, 4*time.Second, start.Add(5*time.Second))
+    if effective, _ := backend.Weight(start.Add(7 * time.Second)); effective != 3 {
+        t.Errorf("Expected a new transition to start from the current weight, got %v", effective)
+    }
+    backend.SetWeight(2, 0, start.Add(7*time.Second))
+    if effective, _ := backend.Weight(start.Add(7 * time.Second)); effective != 2 {
+        t.Errorf("Expected an immediate change without transition, got %v", effective)
+    }
+}
+
+func TestBackend_SetWeightFactor(t *testing.T) {
+    backend := &Backend{}
+    now := time.Unix(1000, 0)
+    backend.SetWeight(4, 0, now)
+
+    tests := []struct {
+        factor   float64
+        expected float64
+    }{
+        {factor: 0.5, expected: 2},
+        {factor: 1, expected: 4},
+        {factor: 2, expected: 4},
+        {factor: -1, expected: 0},
+    }
+
+    for _, tt := range tests {
+        backend.SetWeightFactor(tt.factor)
+        if effective, target := backend.Weight(now); effective != tt.expected || target != tt.expected {
+            t.Errorf("Factor %v: expected weight %v, got %v towards %v", tt.factor, tt.expected, effective, target)
+        }
+        if factor := backend.Stats().WeightFactor; factor != tt.expected/4 {
+            t.Errorf("Factor %v: Stats() reported %v", tt.factor, factor)
+        }
+    }
+}
@@ -0,0 +1,192 @@
+package balancer
+
+import (
+    "encoding/json"
+    "log"
+    "net/http"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/backend"
+)
+
+const defaultOverrideTTL = time.Hour
+
+type backendStatus struct {
+    URL             string     `json:"url"`
+    Alive           bool       `json:"alive"`
+    Healthy         bool       `json:"healthy"`
+    Override        string     `json:"override"`
+    OverrideExpires *time.Time `json:"override_expires,omitempty"`
+    Weight          float64    `json:"weight"`
+    TargetWeight    float64    `json:"target_weight"`
+    WeightFactor    float64    `json:"weight_factor"`
+    BytesPerSecond  float64    `json:"bytes_per_second"`
+    ActiveStreams   int64      `json:"active_streams"`
+    RTTSeconds      float64    `json:"rtt_seconds"`
+}
+
+func statusOf(peer *backend.Backend, now time.Time) backendStatus {
+    weight, target := peer.Weight(now)
+    override, until := peer.Override(now)
+    status := backendStatus{
+        URL:            peer.URL.String(),
+        Alive:          peer.IsAlive(),
+        Healthy:        peer.Healthy(),
+        Override:       override.String(),
+        Weight:         weight,
+        TargetWeight:   target,
+        WeightFactor:   peer.WeightFactor(),
+        BytesPerSecond: peer.Throughput(now),
+        ActiveStreams:  peer.ActiveStreams(),
+        RTTSeconds:     peer.RTT().Seconds(),
+    }
+    if override != backend.Auto {
+        status.OverrideExpires = &until
+    }
+    return status
+}
+
+type weightChange struct {
+    Backend    string  `json:"backend"`
+    Weight     float64 `json:"weight"`
+    Transition string  `json:"transition,omitempty"`
+}
+
+type overrideChange struct {
+    Backend string `json:"backend"`
+    State   string `json:"state"`
+    TTL     string `json:"ttl,omitempty"`
+}
+
+// Register exposes the pools' backends on the admin API. Weight changes
+// apply gradually when a transition is given; they steer traffic in pools
+// using the weighted_round_robin strategy. Backend statuses show the weight
+// factor RunAutoWeight applies on top. Overrides force a backend up or
+// down over its health checks for a TTL (an hour unless given), so a wrong
+// checker can be worked around during an incident without being forgotten.
+// A pool's strategy can be read and switched at /admin/pools/{pool}/strategy
+// without a restart. Explanations of routing decisions are served at
+// /admin/explain when the router explains requests (see SetExplain).
+// GET /admin/ready serves the pools' aggregate health as a readiness probe.
+func (router *Router) Register(server *admin.Server) {
+    router.registerReadiness(server)
+    router.registerExplain(server)
+    server.HandleFunc("GET /admin/pools/{pool}/backends", func(writer http.ResponseWriter, request *http.Request) {
+        pool := router.Pool(request.PathValue("pool"))
+        if pool == nil {
+            admin.WriteError(writer, http.StatusNotFound, "unknown pool")
+            return
+        }
+        now := time.Now()
+        statuses := []backendStatus{}
+        for _, peer := range pool.Backends() {
+            statuses = append(statuses, statusOf(peer, now))
+        }
+        admin.WriteJSON(writer, http.StatusOK, statuses)
+    })
+    server.HandleFunc("PUT /admin/pools/{pool}/weight", func(writer http.ResponseWriter, request *http.Request) {
+        pool := router.Pool(request.PathValue("pool"))
+        if pool == nil {
+            admin.WriteError(writer, http.StatusNotFound, "unknown pool")
+            return
+        }
+        var change weightChange
+        if err := json.NewDecoder(request.Body).Decode(&change); err != nil || change.Weight < 0 {
+            admin.WriteError(writer, http.StatusBadRequest, "invalid weight change")
+            return
+        }
+        var transition time.Duration
+        if change.Transition != "" {
+            parsed, err := time.ParseDuration(change.Transition)
+            if err != nil || parsed < 0 {
+                admin.WriteError(writer, http.StatusBadRequest, "invalid transition")
+                return
+            }
+            transition = parsed
+        }
+
+        for _, peer := range pool.Backends() {
+            if peer.URL.String() != change.Backend {
+                continue
+            }
+            now := time.Now()
+            peer.SetWeight(change.Weight, transition, now)
+            admin.WriteJSON(writer, http.StatusOK, statusOf(peer, now))
+            return
+        }
+        admin.WriteError(writer, http.StatusNotFound, "unknown backend")
+    })
+    server.HandleFunc("GET /admin/pools/{pool}/strategy", func(writer http.ResponseWriter, request *http.Request) {
+        pool := router.Pool(request.PathValue("pool"))
+        if pool == nil {
+            admin.WriteError(writer, http.StatusNotFound, "unknown pool")
+            return
+        }
+        config, ok := pool.StrategyConfig()
+        if !ok {
+            config.Name = "built-in"
+            if pool.strategy.Load() != nil {
+                config.Name = "custom"
+            }
+        }
+        admin.WriteJSON(writer, http.StatusOK, config)
+    })
+    server.HandleFunc("PUT /admin/pools/{pool}/strategy", func(writer http.ResponseWriter, request *http.Request) {
+        poolName := request.PathValue("pool")
+        pool := router.Pool(poolName)
+        if pool == nil {
+            admin.WriteError(writer, http.StatusNotFound, "unknown pool")
+            return
+        }
+        var config StrategyConfig
+        if err := json.NewDecoder(request.Body).Decode(&config); err != nil || config.Name == "" {
+            admin.WriteError(writer, http.StatusBadRequest, "invalid strategy")
+            return
+        }
+        if err := pool.UseStrategy(config); err != nil {
+            admin.WriteError(writer, http.StatusBadRequest, err.Error())
+            return
+        }
+        log.Printf("pool %s: switched to strategy %s\n", poolName, config.Name)
+        admin.WriteJSON(writer, http.StatusOK, config)
+    })
+    server.HandleFunc("PUT /admin/pools/{pool}/override", func(writer http.ResponseWriter, request *http.Request) {
+        pool := router.Pool(request.PathValue("pool"))
+        if pool == nil {
+            admin.WriteError(writer, http.StatusNotFound, "unknown pool")
+            return
+        }
+        var change overrideChange
+        if err := json.NewDecoder(request.Body).Decode(&change); err != nil {
+            admin.WriteError(writer, http.StatusBadRequest, "invalid override")
+            return
+        }
+        state, err := backend.ParseOverride(change.State)
+        if err != nil {
+            admin.WriteError(writer, http.StatusBadRequest, err.Error())
+            return
+        }
+        ttl := defaultOverrideTTL
+        if change.TTL != "" {
+            parsed, err := time.ParseDuration(change.TTL)
+            if err != nil || parsed <= 0 {
+                admin.WriteError(writer, http.StatusBadRequest, "invalid ttl")
+                return
+            }
+            ttl = parsed
+        }
+
+        for _, peer := range pool.Backends() {
+            if peer.URL.String() != change.Backend {
+                continue
+            }
+            now := time.Now()
+            peer.SetOverride(state, now.Add(ttl))
+            log.Printf("%s [override %s for %s]\n", peer.URL, state, ttl)
+            admin.WriteJSON(writer, http.StatusOK, statusOf(peer, now))
+            return
+        }
+        admin.WriteError(writer, http.StatusNotFound, "unknown backend")
+    })
+}
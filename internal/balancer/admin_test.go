@@ -0,0 +1,148 @@
+package balancer
+
+import (
+    "encoding/json"
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+
+    "load-balancer/internal/admin"
+)
+
+func TestRouter_RegisterWeights(t *testing.T) {
+    pool, closeServer := newTestPool(t, "ok")
+    defer closeServer()
+    peer := pool.Backends()[0]
+
+    router := NewRouter("web")
+    router.AddPool("web", pool)
+    server := admin.NewServer(nil)
+    router.Register(server)
+
+    tests := []struct {
+        name         string
+        method       string
+        path         string
+        body         string
+        expectedCode int
+    }{
+        {name: "gradual change", method: "PUT", path: "/admin/pools/web/weight", body: `{"backend":"` + peer.URL.String() + `","weight":5,"transition":"1h"}`, expectedCode: http.StatusOK},
+        {name: "unknown backend", method: "PUT", path: "/admin/pools/web/weight", body: `{"backend":"http://other","weight":5}`, expectedCode: http.StatusNotFound},
+        {name: "negative weight", method: "PUT", path: "/admin/pools/web/weight", body: `{"backend":"` + peer.URL.String() + `","weight":-1}`, expectedCode: http.StatusBadRequest},
+        {name: "bad transition", method: "PUT", path: "/admin/pools/web/weight", body: `{"backend":"` + peer.URL.String() + `","weight":2,"transition":"soon"}`, expectedCode: http.StatusBadRequest},
+        {name: "unknown pool", method: "GET", path: "/admin/pools/api/backends", expectedCode: http.StatusNotFound},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rr := httptest.NewRecorder()
+            server.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+            if rr.Code != tt.expectedCode {
+                t.Errorf("Expected status %d, got %d: %s", tt.expectedCode, rr.Code, rr.Body.String())
+            }
+        })
+    }
+
+    rr := httptest.NewRecorder()
+    server.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/pools/web/backends", nil))
+    var statuses []backendStatus
+    if err := json.NewDecoder(rr.Body).Decode(&statuses); err != nil || len(statuses) != 1 {
+        t.Fatalf("Expected one backend status, got %v (%v)", statuses, err)
+    }
+    if statuses[0].TargetWeight != 5 || statuses[0].Weight < 1 || statuses[0].Weight >= 1.01 {
+        t.Errorf("Expected weight just above 1 moving to 5, got %v towards %v", statuses[0].Weight, statuses[0].TargetWeight)
+    }
+}
+
+func TestRouter_RegisterOverrides(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    pool, closeServer := newTestPool(t, "ok")
+    defer closeServer()
+    peer := pool.Backends()[0]
+
+    router := NewRouter("web")
+    router.AddPool("web", pool)
+    server := admin.NewServer(nil)
+    router.Register(server)
+
+    tests := []struct {
+        name          string
+        body          string
+        expectedCode  int
+        expectedAlive bool
+    }{
+        {name: "force down", body: `{"backend":"` + peer.URL.String() + `","state":"force_down","ttl":"10m"}`, expectedCode: http.StatusOK, expectedAlive: false},
+        {name: "unknown state", body: `{"backend":"` + peer.URL.String() + `","state":"off"}`, expectedCode: http.StatusBadRequest, expectedAlive: false},
+        {name: "bad ttl", body: `{"backend":"` + peer.URL.String() + `","state":"auto","ttl":"-1m"}`, expectedCode: http.StatusBadRequest, expectedAlive: false},
+        {name: "unknown backend", body: `{"backend":"http://other","state":"auto"}`, expectedCode: http.StatusNotFound, expectedAlive: false},
+        {name: "back to auto", body: `{"backend":"` + peer.URL.String() + `","state":"auto"}`, expectedCode: http.StatusOK, expectedAlive: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rr := httptest.NewRecorder()
+            server.ServeHTTP(rr, httptest.NewRequest("PUT", "/admin/pools/web/override", strings.NewReader(tt.body)))
+            if rr.Code != tt.expectedCode {
+                t.Errorf("Expected status %d, got %d: %s", tt.expectedCode, rr.Code, rr.Body.String())
+            }
+            if peer.IsAlive() != tt.expectedAlive {
+                t.Errorf("Expected alive %v, got %v", tt.expectedAlive, peer.IsAlive())
+            }
+        })
+    }
+}
+
+func TestRouter_RegisterStrategy(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    pool, closeServer := newTestPool(t, "ok")
+    defer closeServer()
+
+    router := NewRouter("web")
+    router.AddPool("web", pool)
+    server := admin.NewServer(nil)
+    router.Register(server)
+
+    tests := []struct {
+        name         string
+        method       string
+        body         string
+        expectedCode int
+        expectedName string
+    }{
+        {name: "built-in by default", method: "GET", expectedCode: http.StatusOK, expectedName: "built-in"},
+        {name: "switch", method: "PUT", body: `{"name":"p2c","params":{"choices":"3"}}`, expectedCode: http.StatusOK, expectedName: "p2c"},
+        {name: "unknown strategy", method: "PUT", body: `{"name":"least_conn"}`, expectedCode: http.StatusBadRequest},
+        {name: "invalid params", method: "PUT", body: `{"name":"p2c","params":{"choices":"0"}}`, expectedCode: http.StatusBadRequest},
+        {name: "unchanged by rejected switches", method: "GET", expectedCode: http.StatusOK, expectedName: "p2c"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rr := httptest.NewRecorder()
+            server.ServeHTTP(rr, httptest.NewRequest(tt.method, "/admin/pools/web/strategy", strings.NewReader(tt.body)))
+            if rr.Code != tt.expectedCode {
+                t.Fatalf("Expected status %d, got %d: %s", tt.expectedCode, rr.Code, rr.Body.String())
+            }
+            var config StrategyConfig
+            if tt.expectedName != "" && (json.NewDecoder(rr.Body).Decode(&config) != nil || config.Name != tt.expectedName) {
+                t.Errorf("Expected strategy %s, got %+v", tt.expectedName, config)
+            }
+        })
+    }
+
+    if peer := pool.GetNextPeer(); peer == nil {
+        t.Error("Expected the switched strategy to pick a backend")
+    }
+    pool.SetStrategy(nil)
+    if _, ok := pool.StrategyConfig(); ok {
+        t.Error("Expected no strategy config after restoring the built-in one")
+    }
+}
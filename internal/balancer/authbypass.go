@@ -0,0 +1,64 @@
+package balancer
+
+import (
+    "net/http"
+    "path"
+    "strings"
+)
+
+// authenticate runs auth in front of next except for requests whose path
+// matches one of bypass. A pattern ending in "/*" matches everything below
+// that directory ("/.well-known/*"); any other pattern uses path.Match, so
+// "/login" matches only itself. Paths are cleaned before matching, so
+// "/.well-known/../admin" is authenticated like "/admin", and malformed
+// patterns match nothing.
+//
+// The headers auth passes to backends, headers, or every X-Auth-* header
+// when headers is empty, are removed from all requests first, so clients
+// cannot spoof them on bypassed paths either.
+func authenticate(auth func(next http.Handler) http.Handler, bypass, headers []string) func(next http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        authenticated := auth(next)
+        return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+            stripAuthHeaders(request.Header, headers)
+            if bypassed(bypass, request.URL.Path) {
+                next.ServeHTTP(writer, request)
+                return
+            }
+            authenticated.ServeHTTP(writer, request)
+        })
+    }
+}
+
+func bypassed(patterns []string, requestPath string) bool {
+    if len(patterns) == 0 {
+        return false
+    }
+    cleaned := path.Clean("/" + requestPath)
+    for _, pattern := range patterns {
+        if dir, ok := strings.CutSuffix(pattern, "/*"); ok {
+            if strings.HasPrefix(cleaned, dir+"/") {
+                return true
+            }
+            continue
+        }
+        if matched, _ := path.Match(pattern, cleaned); matched {
+            return true
+        }
+    }
+    return false
+}
+
+func stripAuthHeaders(header http.Header, names []string) {
+    if len(names) > 0 {
+        for _, name := range names {
+            header.Del(name)
+        }
+        return
+    }
+    for name := range header {
+        if strings.HasPrefix(name, "X-Auth-") {
+            delete(header, name)
+        }
+    }
+}
@@ -0,0 +1,106 @@
+package balancer
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "testing"
+
+    "load-balancer/internal/backend"
+)
+
+func TestRouter_AuthBypass(t *testing.T) {
+    app, closeApp := newTestPool(t, "app")
+    defer closeApp()
+
+    router := NewRouter("app")
+    router.AddPool("app", app)
+    router.AddRoute(Route{
+        Name: "app",
+        Pool: "app",
+        Auth: func(next http.Handler) http.Handler {
+            return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                if r.Header.Get("Authorization") == "" {
+                    http.Error(w, "Unauthorized", http.StatusUnauthorized)
+                    return
+                }
+                next.ServeHTTP(w, r)
+            })
+        },
+        AuthBypass: []string{"/login", "/health", "/.well-known/*", "/static/*.css", "/broken["},
+    })
+
+    tests := []struct {
+        name           string
+        path           string
+        expectedStatus int
+    }{
+        {name: "protected path", path: "/account", expectedStatus: http.StatusUnauthorized},
+        {name: "exact exception", path: "/login", expectedStatus: http.StatusOK},
+        {name: "exact exception does not cover children", path: "/login/admin", expectedStatus: http.StatusUnauthorized},
+        {name: "directory exception", path: "/.well-known/acme-challenge/token", expectedStatus: http.StatusOK},
+        {name: "directory itself is protected", path: "/.well-known", expectedStatus: http.StatusUnauthorized},
+        {name: "glob exception", path: "/static/site.css", expectedStatus: http.StatusOK},
+        {name: "glob does not cross directories", path: "/static/js/site.css", expectedStatus: http.StatusUnauthorized},
+        {name: "dot segments are cleaned", path: "/.well-known/../account", expectedStatus: http.StatusUnauthorized},
+        {name: "malformed pattern matches nothing", path: "/broken[", expectedStatus: http.StatusUnauthorized},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            request := httptest.NewRequest(http.MethodGet, "/", nil)
+            request.URL.Path = tt.path
+            rr := httptest.NewRecorder()
+            router.ServeHTTP(rr, request)
+
+            if rr.Code != tt.expectedStatus {
+                t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+            }
+        })
+    }
+}
+
+func TestRouter_AuthBypassStripsAuthHeaders(t *testing.T) {
+    var received http.Header
+    upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        received = r.Header.Clone()
+    }))
+    defer upstream.Close()
+    upstreamURL, _ := url.Parse(upstream.URL)
+    pool := NewServerPool()
+    pool.AddBackend(&backend.Backend{URL: upstreamURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(upstreamURL)})
+
+    tests := []struct {
+        name     string
+        headers  []string
+        spoofed  string
+        expected string
+    }{
+        {name: "X-Auth-* by default", spoofed: "X-Auth-Subject"},
+        {name: "declared header", headers: []string{"X-User"}, spoofed: "X-User"},
+        {name: "undeclared header passes", headers: []string{"X-User"}, spoofed: "X-Auth-Subject", expected: "admin"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            router := NewRouter("app")
+            router.AddPool("app", pool)
+            router.AddRoute(Route{
+                Name:        "app",
+                Pool:        "app",
+                Auth:        func(next http.Handler) http.Handler { return next },
+                AuthBypass:  []string{"/public/*"},
+                AuthHeaders: tt.headers,
+            })
+
+            request := httptest.NewRequest(http.MethodGet, "/public/page", nil)
+            request.Header.Set(tt.spoofed, "admin")
+            router.ServeHTTP(httptest.NewRecorder(), request)
+
+            if value := received.Get(tt.spoofed); value != tt.expected {
+                t.Errorf("Expected %s %q at the backend, got %q", tt.spoofed, tt.expected, value)
+            }
+        })
+    }
+}
@@ -0,0 +1,211 @@
+package balancer
+
+import (
+    "context"
+    "log"
+    "math"
+    "math/rand"
+    "slices"
+    "sync"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+// AutoWeightConfig controls the feedback controller that lowers the weight
+// of backends that are alive but degraded. Every Interval (default 10s)
+// each backend that served at least MinRequests (default 20) is scored on
+// its share of 5xx responses, tolerated up to ErrorRate (default 1%), and
+// its p95 latency, tolerated up to LatencySlack (default 1.5) times the
+// median p95 of the pool's backends or LatencyFloor (default 10ms),
+// whichever is higher, so backends are not told apart by noise in latencies
+// too low to matter. Beyond those the backend's weight
+// factor falls in proportion, to no less than MinFactor (default 0.1), so
+// a backend failing 5% of requests gets a fifth of its weight. The factor
+// moves halfway to its new value each interval, and back towards 1 while
+// the backend is healthy or serves too few requests to judge. Factors
+// scale the weights strategies pick by, and show in the backend's Stats, on
+// the admin API and in lb_backend_weight_factor. Only the strategies that
+// weigh backends act on them: hash, rendezvous, ip_hash, reported_load,
+// weighted_round_robin, weighted_least_connections, least_streams and
+// least_rtt. Under the built-in round robin or any other strategy the
+// factors are computed but change nothing, and the pool logs as much when
+// the controller starts.
+type AutoWeightConfig struct {
+    Name         string
+    Interval     time.Duration
+    ErrorRate    float64
+    LatencySlack float64
+    LatencyFloor time.Duration
+    MinFactor    float64
+    MinRequests  int
+    Registry     *metrics.Registry
+}
+
+// latencySamples is how many latencies are kept per backend and interval
+// to estimate the p95 from.
+const latencySamples = 1024
+
+type autoWeighting struct {
+    mux      sync.Mutex
+    backends map[*backend.Backend]*weightSamples
+}
+
+type weightSamples struct {
+    latencies []time.Duration
+    seen      int
+    requests  uint64
+    errors    uint64
+}
+
+// RunAutoWeight adjusts the weight factors of the pool's backends until
+// ctx is cancelled, then restores them to 1.
+func (serverpool *ServerPool) RunAutoWeight(ctx context.Context, config AutoWeightConfig) {
+    if config.Interval <= 0 {
+        config.Interval = 10 * time.Second
+    }
+    if config.ErrorRate <= 0 {
+        config.ErrorRate = 0.01
+    }
+    if config.LatencySlack <= 1 {
+        config.LatencySlack = 1.5
+    }
+    if config.LatencyFloor <= 0 {
+        config.LatencyFloor = 10 * time.Millisecond
+    }
+    if config.MinFactor <= 0 {
+        config.MinFactor = 0.1
+    }
+    if config.MinRequests <= 0 {
+        config.MinRequests = 20
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+
+    if !serverpool.weighsBackends() {
+        log.Printf("autoweight: pool %q does not use a weighted strategy; weight factors will have no effect\n", config.Name)
+    }
+
+    weighting := &autoWeighting{backends: make(map[*backend.Backend]*weightSamples)}
+    serverpool.autoWeight.Store(weighting)
+    defer func() {
+        serverpool.autoWeight.CompareAndSwap(weighting, nil)
+        for _, peer := range serverpool.Backends() {
+            peer.SetWeightFactor(1)
+        }
+    }()
+
+    ticker := time.NewTicker(config.Interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            weighting.adjust(serverpool.Backends(), config)
+        }
+    }
+}
+
+// weightedStrategies are the registered strategies that pick by weight.
+var weightedStrategies = []string{"hash", "rendezvous", "ip_hash", "reported_load", "weighted_round_robin", "weighted_least_connections", "least_streams", "least_rtt"}
+
+// weighsBackends reports whether the pool's strategy picks by weight, as far
+// as can be told: a strategy set directly with SetStrategy is given the
+// benefit of the doubt.
+func (serverpool *ServerPool) weighsBackends() bool {
+    if serverpool.strategy.Load() == nil {
+        return false
+    }
+    config, ok := serverpool.StrategyConfig()
+    return !ok || slices.Contains(weightedStrategies, config.Name)
+}
+
+// observe records how long peer took to answer.
+func (weighting *autoWeighting) observe(peer *backend.Backend, elapsed time.Duration) {
+    weighting.mux.Lock()
+    defer weighting.mux.Unlock()
+
+    samples := weighting.samples(peer)
+    samples.seen++
+    if len(samples.latencies) < latencySamples {
+        samples.latencies = append(samples.latencies, elapsed)
+    } else if i := rand.Intn(samples.seen); i < latencySamples {
+        samples.latencies[i] = elapsed
+    }
+}
+
+func (weighting *autoWeighting) samples(peer *backend.Backend) *weightSamples {
+    samples, ok := weighting.backends[peer]
+    if !ok {
+        stats := peer.Stats()
+        samples = &weightSamples{requests: stats.Requests, errors: stats.Errors}
+        weighting.backends[peer] = samples
+    }
+    return samples
+}
+
+// adjust scores the interval that just ended and moves each backend's
+// weight factor towards its score.
+func (weighting *autoWeighting) adjust(backends []*backend.Backend, config AutoWeightConfig) {
+    type interval struct {
+        requests uint64
+        errors   uint64
+        p95      time.Duration
+    }
+    intervals := make([]interval, len(backends))
+    var p95s []time.Duration
+
+    weighting.mux.Lock()
+    for peer := range weighting.backends {
+        if !slices.Contains(backends, peer) {
+            delete(weighting.backends, peer)
+        }
+    }
+    for i, peer := range backends {
+        samples := weighting.samples(peer)
+        stats := peer.Stats()
+        intervals[i] = interval{requests: stats.Requests - samples.requests, errors: stats.Errors - samples.errors}
+        if intervals[i].requests >= uint64(config.MinRequests) && len(samples.latencies) > 0 {
+            slices.Sort(samples.latencies)
+            intervals[i].p95 = samples.latencies[(len(samples.latencies)*95-1)/100]
+            p95s = append(p95s, intervals[i].p95)
+        }
+        samples.requests, samples.errors = stats.Requests, stats.Errors
+        samples.latencies, samples.seen = samples.latencies[:0], 0
+    }
+    weighting.mux.Unlock()
+
+    var median time.Duration
+    if len(p95s) > 0 {
+        slices.Sort(p95s)
+        median = p95s[len(p95s)/2]
+    }
+
+    for i, peer := range backends {
+        target := 1.0
+        if intervals[i].requests >= uint64(config.MinRequests) {
+            if errorRate := float64(intervals[i].errors) / float64(intervals[i].requests); errorRate > config.ErrorRate {
+                target *= config.ErrorRate / errorRate
+            }
+            if allowed := math.Max(float64(median)*config.LatencySlack, float64(config.LatencyFloor)); float64(intervals[i].p95) > allowed {
+                target *= allowed / float64(intervals[i].p95)
+            }
+            target = math.Max(target, config.MinFactor)
+        }
+
+        previous := peer.WeightFactor()
+        factor := previous + (target-previous)/2
+        if math.Abs(1-factor) < 0.01 {
+            factor = 1
+        }
+        peer.SetWeightFactor(factor)
+        config.Registry.Gauge("lb_backend_weight_factor", "Factor the backend's weight is scaled by for its observed errors and latency.", "pool", config.Name, "backend", peer.URL.String()).Set(factor)
+        if math.Abs(factor-previous) >= 0.1 {
+            log.Printf("%s [weight factor %.2f, was %.2f: %d of %d requests failed, p95 %s against a pool median of %s]\n", peer.URL, factor, previous, intervals[i].errors, intervals[i].requests, intervals[i].p95, median)
+        }
+    }
+}
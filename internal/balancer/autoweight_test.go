@@ -0,0 +1,104 @@
+package balancer
+
+import (
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "os"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+func TestAutoWeighting_Adjust(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    var failing, slow atomic.Bool
+    newBackend := func(handler http.HandlerFunc) *backend.Backend {
+        server := httptest.NewServer(handler)
+        t.Cleanup(server.Close)
+        serverURL, _ := url.Parse(server.URL)
+        return &backend.Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)}
+    }
+    healthy := newBackend(func(w http.ResponseWriter, r *http.Request) {})
+    erroring := newBackend(func(w http.ResponseWriter, r *http.Request) {
+        if failing.Load() && r.URL.Query().Get("n") == "0" {
+            w.WriteHeader(http.StatusInternalServerError)
+        }
+    })
+    lagging := newBackend(func(w http.ResponseWriter, r *http.Request) {
+        if slow.Load() {
+            time.Sleep(20 * time.Millisecond)
+        }
+    })
+    backends := []*backend.Backend{healthy, erroring, lagging}
+
+    pool := NewServerPool()
+    pool.SetBackends(backends)
+    weighting := &autoWeighting{backends: make(map[*backend.Backend]*weightSamples)}
+    pool.autoWeight.Store(weighting)
+    config := AutoWeightConfig{ErrorRate: 0.01, LatencySlack: 1.5, LatencyFloor: 10 * time.Millisecond, MinFactor: 0.1, MinRequests: 20, Registry: metrics.NewRegistry()}
+
+    // round sends each backend 20 requests, one in ten failing on the
+    // erroring backend while it fails, then adjusts.
+    round := func() {
+        for _, peer := range backends {
+            for i := 0; i < 20; i++ {
+                request := httptest.NewRequest("GET", "/?n="+string(rune('0'+i%10)), nil)
+                pool.forward(peer, peer.ReverseProxy, httptest.NewRecorder(), request)
+            }
+        }
+        weighting.adjust(backends, config)
+    }
+
+    failing.Store(true)
+    slow.Store(true)
+    for i := 0; i < 5; i++ {
+        round()
+    }
+    if factor := healthy.WeightFactor(); factor != 1 {
+        t.Errorf("Expected the healthy backend's factor to stay 1, got %v", factor)
+    }
+    if factor := erroring.WeightFactor(); factor > 0.2 {
+        t.Errorf("Expected the erroring backend's factor near 0.1, got %v", factor)
+    }
+    if factor := lagging.WeightFactor(); factor > 0.75 {
+        t.Errorf("Expected the slow backend's factor lowered, got %v", factor)
+    }
+    if weight, _ := erroring.Weight(time.Now()); weight != erroring.WeightFactor() {
+        t.Errorf("Expected the factor to scale the weight, got %v", weight)
+    }
+
+    failing.Store(false)
+    slow.Store(false)
+    for i := 0; i < 10; i++ {
+        round()
+    }
+    for _, peer := range backends {
+        if factor := peer.WeightFactor(); factor != 1 {
+            t.Errorf("Expected %s back to a factor of 1 once healthy, got %v", peer.URL, factor)
+        }
+    }
+}
+
+func TestAutoWeighting_TooFewRequests(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    peer := newStrategyBackends("a:80")[0]
+    peer.SetWeightFactor(0.2)
+    weighting := &autoWeighting{backends: make(map[*backend.Backend]*weightSamples)}
+    config := AutoWeightConfig{ErrorRate: 0.01, LatencySlack: 1.5, LatencyFloor: 10 * time.Millisecond, MinFactor: 0.1, MinRequests: 20, Registry: metrics.NewRegistry()}
+
+    weighting.adjust([]*backend.Backend{peer}, config)
+    if factor := peer.WeightFactor(); factor != 0.6 {
+        t.Errorf("Expected an idle backend to recover halfway to 1, got %v", factor)
+    }
+}
@@ -0,0 +1,83 @@
+package balancer
+
+import (
+    "context"
+    "net"
+    "net/http"
+    "slices"
+    "sync"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+type connAffinityKey struct{}
+
+// connPins holds the backends one client connection is pinned to, by the
+// affinity strategy that pinned it, since a connection's requests may go
+// to several pools.
+type connPins struct {
+    mux  sync.Mutex
+    pins map[*connAffinity]*backend.Backend
+}
+
+// ConnContext gives each client connection a place to keep its pins, so
+// ConnAffinity can tell the requests of one connection from another's. Set
+// it as the http.Server's ConnContext; the pins go with the connection.
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+    return context.WithValue(ctx, connAffinityKey{}, &connPins{pins: make(map[*connAffinity]*backend.Backend)})
+}
+
+// ConnAffinity wraps base so every request on a client keep-alive
+// connection, pipelined or not, goes to the backend the connection's first
+// request went to, for backends that keep state per connection. A
+// connection moves to base's next pick only when its backend stops being a
+// candidate. Requests on connections not set up by ConnContext are picked
+// by base alone. A nil base picks round robin.
+func ConnAffinity(base Strategy) Strategy {
+    if base == nil {
+        base = &roundRobin{}
+    }
+    return &connAffinity{base: base}
+}
+
+type connAffinity struct {
+    base Strategy
+}
+
+func (strategy *connAffinity) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    if request == nil {
+        return strategy.base.Pick(request, candidates)
+    }
+    pins, ok := request.Context().Value(connAffinityKey{}).(*connPins)
+    if !ok {
+        return strategy.base.Pick(request, candidates)
+    }
+
+    pins.mux.Lock()
+    defer pins.mux.Unlock()
+
+    if pinned := pins.pins[strategy]; pinned != nil && slices.Contains(candidates, pinned) {
+        explaining(request).add("candidates", "connection pinned to %s", pinned.URL)
+        return pinned
+    }
+    peer := strategy.base.Pick(request, candidates)
+    if peer != nil {
+        pins.pins[strategy] = peer
+    }
+    return peer
+}
+
+// Observe passes latency on to base when it learns from it.
+func (strategy *connAffinity) Observe(peer *backend.Backend, elapsed time.Duration) {
+    if observer, ok := strategy.base.(LatencyObserver); ok {
+        observer.Observe(peer, elapsed)
+    }
+}
+
+// ObserveResponse passes responses on to base when it learns from them.
+func (strategy *connAffinity) ObserveResponse(peer *backend.Backend, response *http.Response) {
+    if observer, ok := strategy.base.(ResponseObserver); ok {
+        observer.ObserveResponse(peer, response)
+    }
+}
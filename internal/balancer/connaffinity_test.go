@@ -0,0 +1,68 @@
+package balancer
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "testing"
+
+    "load-balancer/internal/backend"
+)
+
+func TestConnAffinity(t *testing.T) {
+    var backends []*backend.Backend
+    for _, name := range []string{"a", "b", "c"} {
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            io.WriteString(w, name)
+        }))
+        defer server.Close()
+        serverURL, _ := url.Parse(server.URL)
+        backends = append(backends, &backend.Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)})
+    }
+    pool := NewServerPool()
+    pool.SetBackends(backends)
+    pool.SetStrategy(ConnAffinity(nil))
+
+    balancer := httptest.NewUnstartedServer(http.HandlerFunc(pool.LoadBalancerHandler))
+    balancer.Config.ConnContext = ConnContext
+    balancer.Start()
+    defer balancer.Close()
+
+    get := func(client *http.Client) string {
+        response, err := client.Get(balancer.URL)
+        if err != nil {
+            t.Fatalf("GET error: %v", err)
+        }
+        defer response.Body.Close()
+        body, _ := io.ReadAll(response.Body)
+        return string(body)
+    }
+
+    keepAlive := &http.Client{Transport: &http.Transport{MaxConnsPerHost: 1}}
+    pinned := get(keepAlive)
+    for i := 0; i < 10; i++ {
+        if got := get(keepAlive); got != pinned {
+            t.Fatalf("Expected every request on the connection to reach %s, got %s", pinned, got)
+        }
+    }
+
+    seen := make(map[string]bool)
+    for i := 0; i < 6; i++ {
+        seen[get(&http.Client{Transport: &http.Transport{DisableKeepAlives: true}})] = true
+    }
+    if len(seen) != len(backends) {
+        t.Errorf("Expected new connections spread over %d backends, got %d", len(backends), len(seen))
+    }
+
+    // The connection moves when its backend leaves the candidates.
+    backends[map[string]int{"a": 0, "b": 1, "c": 2}[pinned]].SetAlive(false)
+    moved := get(keepAlive)
+    if moved == pinned {
+        t.Fatalf("Expected the connection to move off %s once it is down", pinned)
+    }
+    if got := get(keepAlive); got != moved {
+        t.Errorf("Expected the connection pinned to %s after moving, got %s", moved, got)
+    }
+}
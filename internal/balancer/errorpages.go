@@ -0,0 +1,205 @@
+package balancer
+
+import (
+    "bytes"
+    "fmt"
+    "html/template"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+
+    "load-balancer/internal/requestid"
+)
+
+// ErrorPagesConfig replaces the plain-text bodies of the balancer's own
+// error responses, such as 503 with no healthy backend or 504 on a response
+// timeout, with HTML pages in the client's language. Pages maps a status
+// code to html/template sources by language tag ("en", "pt-BR"); the
+// language is negotiated from Accept-Language, with a tag also matching
+// pages for its base language, and falls back to DefaultLanguage (default
+// "en"). Statuses without a page in either keep the plain-text body.
+// Errors returned by backends are passed through untouched.
+//
+// Templates are given an ErrorPage.
+type ErrorPagesConfig struct {
+    Pages           map[int]map[string]string
+    DefaultLanguage string
+}
+
+// ErrorPage is what error page templates are rendered with.
+type ErrorPage struct {
+    Status     int
+    StatusText string
+    Message    string
+    RequestID  string
+    RetryAfter string
+    Language   string
+}
+
+type ErrorPages struct {
+    defaultLanguage string
+    pages           map[int]map[string]*errorPageTemplate
+}
+
+type errorPageTemplate struct {
+    language string
+    template *template.Template
+}
+
+func NewErrorPages(config ErrorPagesConfig) (*ErrorPages, error) {
+    if config.DefaultLanguage == "" {
+        config.DefaultLanguage = "en"
+    }
+    pages := &ErrorPages{defaultLanguage: strings.ToLower(config.DefaultLanguage), pages: make(map[int]map[string]*errorPageTemplate)}
+    for status, languages := range config.Pages {
+        if status < 400 || status > 599 {
+            return nil, fmt.Errorf("balancer: error page for status %d: not an error status", status)
+        }
+        pages.pages[status] = make(map[string]*errorPageTemplate, len(languages))
+        for language, source := range languages {
+            parsed, err := template.New(fmt.Sprintf("%d.%s", status, language)).Parse(source)
+            if err != nil {
+                return nil, fmt.Errorf("balancer: error page for status %d in %q: %w", status, language, err)
+            }
+            pages.pages[status][strings.ToLower(language)] = &errorPageTemplate{language: language, template: parsed}
+        }
+    }
+    return pages, nil
+}
+
+// Middleware makes the balancer's error responses to the requests passing
+// through use the pages.
+func (pages *ErrorPages) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        next.ServeHTTP(&errorPageWriter{ResponseWriter: writer, pages: pages, request: request}, request)
+    })
+}
+
+// negotiate picks the page for status in the language the client prefers
+// most, nil when there is none.
+func (pages *ErrorPages) negotiate(status int, acceptLanguage string) *errorPageTemplate {
+    languages := pages.pages[status]
+    if len(languages) == 0 {
+        return nil
+    }
+    for _, tag := range acceptedLanguages(acceptLanguage) {
+        if tag == "*" {
+            break
+        }
+        if page, ok := languages[tag]; ok {
+            return page
+        }
+        if base, _, found := strings.Cut(tag, "-"); found {
+            if page, ok := languages[base]; ok {
+                return page
+            }
+        }
+    }
+    return languages[pages.defaultLanguage]
+}
+
+// acceptedLanguages returns the lowercased tags of an Accept-Language
+// header, most preferred first, leaving out those the client refuses.
+func acceptedLanguages(header string) []string {
+    type accepted struct {
+        tag     string
+        quality float64
+    }
+    var tags []accepted
+    for _, part := range strings.Split(header, ",") {
+        tag, params, _ := strings.Cut(part, ";")
+        tag = strings.ToLower(strings.TrimSpace(tag))
+        if tag == "" {
+            continue
+        }
+        quality := 1.0
+        if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+            parsed, err := strconv.ParseFloat(value, 64)
+            if err != nil {
+                continue
+            }
+            quality = parsed
+        }
+        if quality > 0 {
+            tags = append(tags, accepted{tag: tag, quality: quality})
+        }
+    }
+    sort.SliceStable(tags, func(i, j int) bool { return tags[i].quality > tags[j].quality })
+
+    result := make([]string, len(tags))
+    for i, tag := range tags {
+        result[i] = tag.tag
+    }
+    return result
+}
+
+// errorPageWriter marks the responses whose balancer errors get pages; it
+// does nothing to the responses themselves.
+type errorPageWriter struct {
+    http.ResponseWriter
+    pages   *ErrorPages
+    request *http.Request
+}
+
+// serve writes the page for status to writer, reporting false when there
+// is no page for it.
+func (pageWriter *errorPageWriter) serve(writer http.ResponseWriter, message string, status int) bool {
+    page := pageWriter.pages.negotiate(status, pageWriter.request.Header.Get("Accept-Language"))
+    if page == nil {
+        return false
+    }
+    header := writer.Header()
+    data := ErrorPage{
+        Status:     status,
+        StatusText: http.StatusText(status),
+        Message:    message,
+        RequestID:  header.Get(requestid.Header),
+        RetryAfter: header.Get("Retry-After"),
+        Language:   page.language,
+    }
+    if data.RequestID == "" {
+        data.RequestID = pageWriter.request.Header.Get(requestid.Header)
+    }
+    var body bytes.Buffer
+    if err := page.template.Execute(&body, data); err != nil {
+        return false
+    }
+
+    header.Del("Content-Length")
+    header.Set("Content-Type", "text/html; charset=utf-8")
+    header.Set("Content-Language", page.language)
+    header.Set("X-Content-Type-Options", "nosniff")
+    header.Add("Vary", "Accept-Language")
+    writer.WriteHeader(status)
+    writer.Write(body.Bytes())
+    return true
+}
+
+func (pageWriter *errorPageWriter) Flush() {
+    http.NewResponseController(pageWriter.ResponseWriter).Flush()
+}
+
+func (pageWriter *errorPageWriter) Unwrap() http.ResponseWriter {
+    return pageWriter.ResponseWriter
+}
+
+// serveError answers with one of the balancer's own errors: the error page
+// for status when the request came through ErrorPages.Middleware and one
+// fits, and http.Error's plain text otherwise.
+func serveError(writer http.ResponseWriter, message string, status int) {
+    for current := writer; ; {
+        if pageWriter, ok := current.(*errorPageWriter); ok {
+            if pageWriter.serve(writer, message, status) {
+                return
+            }
+            break
+        }
+        unwrapper, ok := current.(interface{ Unwrap() http.ResponseWriter })
+        if !ok {
+            break
+        }
+        current = unwrapper.Unwrap()
+    }
+    http.Error(writer, message, status)
+}
@@ -0,0 +1,97 @@
+package balancer
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestErrorPages_Middleware(t *testing.T) {
+    pages, err := NewErrorPages(ErrorPagesConfig{Pages: map[int]map[string]string{
+        http.StatusServiceUnavailable: {
+            "en": "<p>Temporarily unavailable, retry in {{.RetryAfter}}s</p>",
+            "de": "<p>Vorübergehend nicht verfügbar</p>",
+            "pt-BR": "<p>Temporariamente indisponível</p>",
+        },
+        http.StatusGatewayTimeout: {
+            "en": "<p>Timed out ({{.RequestID}})</p>",
+        },
+    }})
+    if err != nil {
+        t.Fatalf("NewErrorPages() error: %v", err)
+    }
+
+    // The pool has no backends, so the balancer answers 503 itself.
+    down := pages.Middleware(http.HandlerFunc(NewServerPool().LoadBalancerHandler))
+    backendError := pages.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        http.Error(w, "backend says no", http.StatusServiceUnavailable)
+    }))
+    timedOut := pages.Middleware(ResponseTimeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        <-r.Context().Done()
+    })))
+    forbidden := pages.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        serveError(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+    }))
+
+    tests := []struct {
+        name             string
+        handler          http.Handler
+        acceptLanguage   string
+        expectedStatus   int
+        expectedLanguage string
+        expectedBody     string
+    }{
+        {name: "preferred language", handler: down, acceptLanguage: "de-AT, en;q=0.5", expectedStatus: 503, expectedLanguage: "de", expectedBody: "Vorübergehend"},
+        {name: "regional page", handler: down, acceptLanguage: "pt-BR", expectedStatus: 503, expectedLanguage: "pt-BR", expectedBody: "Temporariamente"},
+        {name: "quality order", handler: down, acceptLanguage: "de;q=0.3, pt-br;q=0.8", expectedStatus: 503, expectedLanguage: "pt-BR", expectedBody: "Temporariamente"},
+        {name: "refused language", handler: down, acceptLanguage: "de;q=0, fr", expectedStatus: 503, expectedLanguage: "en", expectedBody: "retry in"},
+        {name: "no header", handler: down, expectedStatus: 503, expectedLanguage: "en", expectedBody: "Temporarily"},
+        {name: "timeout with request id", handler: timedOut, acceptLanguage: "de", expectedStatus: 504, expectedLanguage: "en", expectedBody: "Timed out (req-1)"},
+        {name: "status without a page", handler: forbidden, acceptLanguage: "de", expectedStatus: 403, expectedBody: "Forbidden"},
+        {name: "backend error untouched", handler: backendError, acceptLanguage: "de", expectedStatus: 503, expectedBody: "backend says no"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            request := httptest.NewRequest("GET", "/", nil)
+            request.Header.Set("X-Request-Id", "req-1")
+            if tt.acceptLanguage != "" {
+                request.Header.Set("Accept-Language", tt.acceptLanguage)
+            }
+            rr := httptest.NewRecorder()
+            tt.handler.ServeHTTP(rr, request)
+
+            if rr.Code != tt.expectedStatus {
+                t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+            }
+            if language := rr.Header().Get("Content-Language"); language != tt.expectedLanguage {
+                t.Errorf("Expected language %q, got %q", tt.expectedLanguage, language)
+            }
+            if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+                t.Errorf("Expected body containing %q, got %q", tt.expectedBody, rr.Body.String())
+            }
+        })
+    }
+}
+
+func TestNewErrorPages(t *testing.T) {
+    tests := []struct {
+        name    string
+        pages   map[int]map[string]string
+        wantErr bool
+    }{
+        {name: "valid", pages: map[int]map[string]string{503: {"en": "{{.StatusText}}"}}},
+        {name: "bad template", pages: map[int]map[string]string{503: {"en": "{{.StatusText"}}, wantErr: true},
+        {name: "not an error status", pages: map[int]map[string]string{200: {"en": "ok"}}, wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if _, err := NewErrorPages(ErrorPagesConfig{Pages: tt.pages}); (err != nil) != tt.wantErr {
+                t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+            }
+        })
+    }
+}
@@ -0,0 +1,102 @@
+package balancer
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+// Errors returned when the balancer cannot hand a request to a backend.
+// Each maps to its own status code and lb_balancer_errors_total reason, so
+// clients and operators can tell a misconfiguration from an outage from
+// overload.
+var (
+    // ErrPoolNotFound means a route or script named a pool the router does
+    // not have. Served as 502.
+    ErrPoolNotFound = errors.New("pool not found")
+    // ErrNoHealthyBackend means no backend in the pool is alive and in
+    // rotation. Served as 503.
+    ErrNoHealthyBackend = errors.New("no healthy backend available")
+    // ErrBackendSaturated means alive backends exist but all are at the
+    // pool's in-flight limit. Served as 429 with Retry-After.
+    ErrBackendSaturated = errors.New("all backends are saturated")
+)
+
+// StatusCode returns the response status for an error from the balancer.
+func StatusCode(err error) int {
+    switch {
+    case errors.Is(err, ErrPoolNotFound):
+        return http.StatusBadGateway
+    case errors.Is(err, ErrNoHealthyBackend):
+        return http.StatusServiceUnavailable
+    case errors.Is(err, ErrBackendSaturated):
+        return http.StatusTooManyRequests
+    }
+    return http.StatusInternalServerError
+}
+
+func errorReason(err error) string {
+    switch {
+    case errors.Is(err, ErrPoolNotFound):
+        return "pool_not_found"
+    case errors.Is(err, ErrNoHealthyBackend):
+        return "no_healthy_backend"
+    case errors.Is(err, ErrBackendSaturated):
+        return "backend_saturated"
+    }
+    return "internal"
+}
+
+// writeError answers the client for err and counts it by reason in
+// registry.
+func writeError(registry *metrics.Registry, writer http.ResponseWriter, err error) {
+    registry.Counter("lb_balancer_errors_total", "Requests the balancer could not hand to a backend, by reason.", "reason", errorReason(err)).Inc()
+    status := StatusCode(err)
+    if errors.Is(err, ErrBackendSaturated) {
+        writer.Header().Set("Retry-After", "1")
+    }
+    serveError(writer, http.StatusText(status), status)
+}
+
+// Lookup returns the named pool, or an error wrapping ErrPoolNotFound.
+func (router *Router) Lookup(name string) (*ServerPool, error) {
+    pool := router.Pool(name)
+    if pool == nil {
+        return nil, fmt.Errorf("%w: %q", ErrPoolNotFound, name)
+    }
+    return pool, nil
+}
+
+// SetMaxInFlight caps the requests each backend in the pool may have in
+// flight; saturated backends are skipped. Zero removes the cap.
+func (serverpool *ServerPool) SetMaxInFlight(limit int64) {
+    serverpool.maxInFlight.Store(limit)
+}
+
+func (serverpool *ServerPool) saturated(peer *backend.Backend) bool {
+    limit := serverpool.maxInFlight.Load()
+    return limit > 0 && peer.Stats().InFlight >= limit
+}
+
+// Pick selects a backend for request the way the pool's handler would,
+// returning ErrNoHealthyBackend or ErrBackendSaturated when there is none.
+func (serverpool *ServerPool) Pick(request *http.Request) (*backend.Backend, error) {
+    return serverpool.pick(request, nil)
+}
+
+func (serverpool *ServerPool) pick(request *http.Request, exclude map[*backend.Backend]bool) (*backend.Backend, error) {
+    if peer := serverpool.nextPeer(request, exclude); peer != nil {
+        return peer, nil
+    }
+    if serverpool.maxInFlight.Load() > 0 {
+        for _, peer := range serverpool.Backends() {
+            if !exclude[peer] && !peer.Draining() && peer.IsAlive() {
+                return nil, ErrBackendSaturated
+            }
+        }
+    }
+    return nil, ErrNoHealthyBackend
+}
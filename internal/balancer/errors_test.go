@@ -0,0 +1,116 @@
+package balancer
+
+import (
+    "errors"
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "testing"
+
+    "load-balancer/internal/metrics"
+)
+
+func TestServerPool_PickErrors(t *testing.T) {
+    pool, closeServer := newTestPool(t, "ok")
+    defer closeServer()
+    peer := pool.Backends()[0]
+
+    tests := []struct {
+        name         string
+        alive        bool
+        maxInFlight  int64
+        inFlight     bool
+        expectedErr  error
+        expectedCode int
+    }{
+        {name: "healthy backend", alive: true, expectedCode: http.StatusOK},
+        {name: "no healthy backend", alive: false, expectedErr: ErrNoHealthyBackend, expectedCode: http.StatusServiceUnavailable},
+        {name: "under the in-flight limit", alive: true, maxInFlight: 2, inFlight: true, expectedCode: http.StatusOK},
+        {name: "saturated backend", alive: true, maxInFlight: 1, inFlight: true, expectedErr: ErrBackendSaturated, expectedCode: http.StatusTooManyRequests},
+        {name: "down and saturated", alive: false, maxInFlight: 1, inFlight: true, expectedErr: ErrNoHealthyBackend, expectedCode: http.StatusServiceUnavailable},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            peer.SetAlive(tt.alive)
+            pool.SetMaxInFlight(tt.maxInFlight)
+
+            release := make(chan struct{})
+            defer close(release)
+            if tt.inFlight {
+                started := make(chan struct{})
+                go peer.Forward(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                    close(started)
+                    <-release
+                }), httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+                <-started
+            }
+
+            _, err := pool.Pick(httptest.NewRequest("GET", "/", nil))
+            if (tt.expectedErr == nil) != (err == nil) || (err != nil && !errors.Is(err, tt.expectedErr)) {
+                t.Errorf("Expected error %v, got %v", tt.expectedErr, err)
+            }
+            if err != nil {
+                if code := StatusCode(err); code != tt.expectedCode {
+                    t.Errorf("Expected status %d, got %d", tt.expectedCode, code)
+                }
+            }
+
+            rr := httptest.NewRecorder()
+            pool.LoadBalancerHandler(rr, httptest.NewRequest("GET", "/", nil))
+            if rr.Code != tt.expectedCode {
+                t.Errorf("Expected handler status %d, got %d", tt.expectedCode, rr.Code)
+            }
+        })
+    }
+}
+
+func TestRouter_PoolNotFound(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    router := NewRouter("missing")
+    if _, err := router.Lookup("missing"); !errors.Is(err, ErrPoolNotFound) {
+        t.Errorf("Expected ErrPoolNotFound, got %v", err)
+    }
+
+    counter := metrics.Default.Counter("lb_balancer_errors_total", "", "reason", "pool_not_found")
+    before := counter.Value()
+    rr := httptest.NewRecorder()
+    router.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+    if rr.Code != http.StatusBadGateway {
+        t.Errorf("Expected status %d, got %d", http.StatusBadGateway, rr.Code)
+    }
+    if got := counter.Value() - before; got != 1 {
+        t.Errorf("Expected 1 pool_not_found error counted, got %v", got)
+    }
+}
+
+func TestRouter_CountsErrorsInItsRegistry(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    pool, closeServer := newTestPool(t, "ok")
+    defer closeServer()
+    pool.Backends()[0].SetAlive(false)
+
+    registry := metrics.NewRegistry()
+    router := NewRouter("api")
+    router.SetRegistry(registry)
+    router.AddPool("api", pool)
+
+    before := metrics.Default.Counter("lb_balancer_errors_total", "", "reason", "no_healthy_backend").Value()
+    rr := httptest.NewRecorder()
+    router.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+    if rr.Code != http.StatusServiceUnavailable {
+        t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+    }
+    if got := registry.Counter("lb_balancer_errors_total", "", "reason", "no_healthy_backend").Value(); got != 1 {
+        t.Errorf("Expected 1 no_healthy_backend error in the router's registry, got %v", got)
+    }
+    if got := metrics.Default.Counter("lb_balancer_errors_total", "", "reason", "no_healthy_backend").Value() - before; got != 0 {
+        t.Errorf("Expected no error counted in metrics.Default, got %v", got)
+    }
+}
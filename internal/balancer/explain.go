@@ -0,0 +1,337 @@
+package balancer
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/subtle"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/backend"
+)
+
+// ExplainConfig enables explaining requests: recording why each was routed
+// where it was, from the routes it was matched against to the backends it
+// was sent to, like EXPLAIN for the balancer. A request is explained when
+// it carries Header (default X-Explain) set to Token, or every request is
+// while All is set, which can be switched on the admin API. Explanations
+// are logged and the latest Keep (default 100) are served on the admin
+// API; header-triggered requests also get a summary in their response's
+// X-Explain header and its ID in X-Explain-Id. Without a Token only All
+// explains requests, so clients cannot ask for the balancer's internals.
+type ExplainConfig struct {
+    Header string
+    Token  string
+    All    bool
+    Keep   int
+}
+
+// Explanation is the decision log of one request.
+type Explanation struct {
+    ID      string        `json:"id"`
+    Method  string        `json:"method"`
+    Host    string        `json:"host"`
+    Path    string        `json:"path"`
+    Start   time.Time     `json:"start"`
+    Status  int           `json:"status"`
+    Elapsed string        `json:"elapsed"`
+    Steps   []ExplainStep `json:"steps"`
+
+    mux      sync.Mutex
+    route    string
+    pool     string
+    backend  string
+    attempts int
+}
+
+// ExplainStep is one decision, At its offset from the start of the request.
+// Stage is one of route, script, failover, pool, stale, fallback,
+// candidates, attempt, retry or response.
+type ExplainStep struct {
+    At     string `json:"at"`
+    Stage  string `json:"stage"`
+    Detail string `json:"detail"`
+}
+
+type explainContextKey struct{}
+
+type explainer struct {
+    mux    sync.Mutex
+    config ExplainConfig
+    recent []*Explanation
+}
+
+// SetExplain enables explaining requests as described by config.
+func (router *Router) SetExplain(config ExplainConfig) {
+    if config.Header == "" {
+        config.Header = "X-Explain"
+    }
+    if config.Keep <= 0 {
+        config.Keep = 100
+    }
+    router.mux.Lock()
+    router.explainer = &explainer{config: config}
+    router.mux.Unlock()
+}
+
+// explaining returns the explanation of request, or nil when it is not
+// being explained.
+func explaining(request *http.Request) *Explanation {
+    if request == nil {
+        return nil
+    }
+    explanation, _ := request.Context().Value(explainContextKey{}).(*Explanation)
+    return explanation
+}
+
+// start begins explaining request if it asks for it or every request is
+// explained. The returned header reports whether the client gets the
+// summary.
+func (explainer *explainer) start(request *http.Request) (*Explanation, bool) {
+    explainer.mux.Lock()
+    config := explainer.config
+    explainer.mux.Unlock()
+
+    header := config.Token != "" && subtle.ConstantTimeCompare([]byte(request.Header.Get(config.Header)), []byte(config.Token)) == 1
+    if !header && !config.All {
+        return nil, false
+    }
+    request.Header.Del(config.Header)
+    id := make([]byte, 8)
+    rand.Read(id)
+    return &Explanation{ID: hex.EncodeToString(id), Method: request.Method, Host: request.Host, Path: request.URL.Path, Start: time.Now()}, header
+}
+
+func (explainer *explainer) finish(explanation *Explanation) {
+    explanation.mux.Lock()
+    explanation.Elapsed = time.Since(explanation.Start).Round(time.Microsecond).String()
+    data, _ := json.Marshal(explanation)
+    explanation.mux.Unlock()
+    log.Printf("explain: %s\n", data)
+
+    explainer.mux.Lock()
+    defer explainer.mux.Unlock()
+    explainer.recent = append(explainer.recent, explanation)
+    if len(explainer.recent) > explainer.config.Keep {
+        explainer.recent = explainer.recent[len(explainer.recent)-explainer.config.Keep:]
+    }
+}
+
+func (explanation *Explanation) add(stage, format string, args ...any) {
+    if explanation == nil {
+        return
+    }
+    explanation.mux.Lock()
+    defer explanation.mux.Unlock()
+
+    explanation.Steps = append(explanation.Steps, ExplainStep{
+        At:     time.Since(explanation.Start).Round(time.Microsecond).String(),
+        Stage:  stage,
+        Detail: fmt.Sprintf(format, args...),
+    })
+}
+
+// note sets a field of the summary: the route, the pool or, once per
+// attempt, the backend.
+func (explanation *Explanation) note(field, value string) {
+    if explanation == nil {
+        return
+    }
+    explanation.mux.Lock()
+    defer explanation.mux.Unlock()
+
+    switch field {
+    case "route":
+        explanation.route = value
+    case "pool":
+        explanation.pool = value
+    case "backend":
+        explanation.backend = value
+        explanation.attempts++
+    }
+}
+
+// summary is the one-line form of the explanation sent to the client.
+func (explanation *Explanation) summary() string {
+    explanation.mux.Lock()
+    defer explanation.mux.Unlock()
+
+    return fmt.Sprintf("route=%s pool=%s backend=%s attempts=%d", explanation.route, explanation.pool, explanation.backend, explanation.attempts)
+}
+
+// explainMatch records how each route's predicates compared with request,
+// mirroring Match.
+func (router *Router) explainMatch(explanation *Explanation, request *http.Request, matched *Route) {
+    router.mux.RLock()
+    routes := router.routes
+    router.mux.RUnlock()
+
+    for _, route := range routes {
+        if route == matched {
+            break
+        }
+        if route.Host != "" && !strings.EqualFold(route.Host, stripPort(request.Host)) {
+            explanation.add("route", "skipped %s: host %q is not %q", route.Name, stripPort(request.Host), route.Host)
+            continue
+        }
+        explanation.add("route", "skipped %s: path %q lacks prefix %q", route.Name, request.URL.Path, route.PathPrefix)
+    }
+    var predicates []string
+    if matched.Host != "" {
+        predicates = append(predicates, "host "+matched.Host)
+    }
+    if matched.PathPrefix != "" {
+        predicates = append(predicates, "prefix "+matched.PathPrefix)
+    }
+    if len(predicates) == 0 {
+        predicates = append(predicates, "everything")
+    }
+    explanation.add("route", "matched %s on %s", matched.Name, strings.Join(predicates, ", "))
+    explanation.note("route", matched.Name)
+}
+
+// explainCandidates records what a pool's selection had to choose from.
+func explainCandidates(explanation *Explanation, serverpool *ServerPool, tier int, candidates []*backend.Backend, now time.Time) {
+    if explanation == nil {
+        return
+    }
+    described := make([]string, len(candidates))
+    for i, peer := range candidates {
+        weight, _ := peer.Weight(now)
+        described[i] = fmt.Sprintf("%s (in_flight=%d weight=%g)", peer.URL, peer.InFlight(), weight)
+    }
+    strategy := "built-in round robin"
+    if config, ok := serverpool.StrategyConfig(); ok {
+        strategy = config.Name
+    } else if serverpool.strategy.Load() != nil {
+        strategy = "custom strategy"
+    }
+    explanation.add("candidates", "%s over tier %d: %s", strategy, tier, strings.Join(described, ", "))
+}
+
+// explainWriter adds the summary to the response headers of requests that
+// asked for it, and records the status.
+type explainWriter struct {
+    http.ResponseWriter
+    explanation *Explanation
+    header      bool
+    written     bool
+}
+
+func (writer *explainWriter) WriteHeader(status int) {
+    if !writer.written && status >= http.StatusOK {
+        writer.written = true
+        writer.explanation.mux.Lock()
+        writer.explanation.Status = status
+        writer.explanation.mux.Unlock()
+        writer.explanation.add("response", "status %d", status)
+        if writer.header {
+            writer.Header().Set("X-Explain", writer.explanation.summary())
+            writer.Header().Set("X-Explain-Id", writer.explanation.ID)
+        }
+    }
+    writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *explainWriter) Write(p []byte) (int, error) {
+    if !writer.written {
+        writer.WriteHeader(http.StatusOK)
+    }
+    return writer.ResponseWriter.Write(p)
+}
+
+func (writer *explainWriter) Flush() {
+    http.NewResponseController(writer.ResponseWriter).Flush()
+}
+
+func (writer *explainWriter) Unwrap() http.ResponseWriter {
+    return writer.ResponseWriter
+}
+
+// explain wraps serve, which routes request, in an explanation when the
+// router explains it.
+func (router *Router) explain(writer http.ResponseWriter, request *http.Request, serve func(http.ResponseWriter, *http.Request, *Explanation)) {
+    router.mux.RLock()
+    explainer := router.explainer
+    router.mux.RUnlock()
+
+    var explanation *Explanation
+    header := false
+    if explainer != nil {
+        explanation, header = explainer.start(request)
+    }
+    if explanation == nil {
+        serve(writer, request, nil)
+        return
+    }
+    defer explainer.finish(explanation)
+    request = request.WithContext(context.WithValue(request.Context(), explainContextKey{}, explanation))
+    serve(&explainWriter{ResponseWriter: writer, explanation: explanation, header: header}, request, explanation)
+}
+
+type explainChange struct {
+    All bool `json:"all"`
+}
+
+// registerExplain serves recent explanations at GET /admin/explain (or one
+// by ID at /admin/explain/{id}) and switches explaining every request with
+// PUT /admin/explain {"all": true}.
+func (router *Router) registerExplain(server *admin.Server) {
+    current := func(writer http.ResponseWriter) *explainer {
+        router.mux.RLock()
+        explainer := router.explainer
+        router.mux.RUnlock()
+        if explainer == nil {
+            admin.WriteError(writer, http.StatusNotFound, "explaining is not enabled")
+        }
+        return explainer
+    }
+    server.HandleFunc("GET /admin/explain", func(writer http.ResponseWriter, request *http.Request) {
+        explainer := current(writer)
+        if explainer == nil {
+            return
+        }
+        explainer.mux.Lock()
+        recent := append([]*Explanation(nil), explainer.recent...)
+        explainer.mux.Unlock()
+        admin.WriteJSON(writer, http.StatusOK, recent)
+    })
+    server.HandleFunc("GET /admin/explain/{id}", func(writer http.ResponseWriter, request *http.Request) {
+        explainer := current(writer)
+        if explainer == nil {
+            return
+        }
+        explainer.mux.Lock()
+        defer explainer.mux.Unlock()
+        for _, explanation := range explainer.recent {
+            if explanation.ID == request.PathValue("id") {
+                admin.WriteJSON(writer, http.StatusOK, explanation)
+                return
+            }
+        }
+        admin.WriteError(writer, http.StatusNotFound, "unknown explanation")
+    })
+    server.HandleFunc("PUT /admin/explain", func(writer http.ResponseWriter, request *http.Request) {
+        explainer := current(writer)
+        if explainer == nil {
+            return
+        }
+        var change explainChange
+        if err := json.NewDecoder(request.Body).Decode(&change); err != nil {
+            admin.WriteError(writer, http.StatusBadRequest, "invalid explain change")
+            return
+        }
+        explainer.mux.Lock()
+        explainer.config.All = change.All
+        explainer.mux.Unlock()
+        log.Printf("explain: explaining every request set to %v\n", change.All)
+        admin.WriteJSON(writer, http.StatusOK, change)
+    })
+}
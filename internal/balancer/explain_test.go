@@ -0,0 +1,105 @@
+package balancer
+
+import (
+    "encoding/json"
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+
+    "load-balancer/internal/admin"
+)
+
+func TestRouter_Explain(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    web, closeWeb := newTestPool(t, "web")
+    defer closeWeb()
+    api, closeAPI := newTestPool(t, "api")
+    defer closeAPI()
+
+    router := NewRouter("web")
+    router.AddPool("web", web)
+    router.AddPool("api", api)
+    router.AddRoute(Route{Name: "admin", Host: "admin.example.com"})
+    router.AddRoute(Route{Name: "api", PathPrefix: "/api", Pool: "api"})
+    router.SetExplain(ExplainConfig{Token: "secret"})
+    server := admin.NewServer(nil)
+    router.Register(server)
+
+    tests := []struct {
+        name            string
+        header          string
+        expectedSummary string
+    }{
+        {name: "explained", header: "secret", expectedSummary: "route=api pool=api backend=" + api.Backends()[0].URL.String() + " attempts=1"},
+        {name: "wrong token", header: "guess"},
+        {name: "not asked"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            request := httptest.NewRequest("GET", "http://example.com/api/users", nil)
+            if tt.header != "" {
+                request.Header.Set("X-Explain", tt.header)
+            }
+            rr := httptest.NewRecorder()
+            router.ServeHTTP(rr, request)
+            if rr.Body.String() != "api" {
+                t.Fatalf("Expected the api pool to answer, got %q", rr.Body.String())
+            }
+            if summary := rr.Header().Get("X-Explain"); summary != tt.expectedSummary {
+                t.Errorf("Expected summary %q, got %q", tt.expectedSummary, summary)
+            }
+        })
+    }
+
+    rr := httptest.NewRecorder()
+    server.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/explain", nil))
+    var explanations []*Explanation
+    if err := json.NewDecoder(rr.Body).Decode(&explanations); err != nil || len(explanations) != 1 {
+        t.Fatalf("Expected one explanation, got %d (%v)", len(explanations), err)
+    }
+    var stages []string
+    for _, step := range explanations[0].Steps {
+        stages = append(stages, step.Stage+": "+step.Detail)
+    }
+    steps := strings.Join(stages, "\n")
+    for _, expected := range []string{
+        `route: skipped admin: host "example.com" is not "admin.example.com"`,
+        "route: matched api on prefix /api",
+        "pool: api is healthy",
+        "candidates: built-in round robin over tier 0: " + api.Backends()[0].URL.String() + " (in_flight=0 weight=1)",
+        "attempt: sent to " + api.Backends()[0].URL.String(),
+        "response: status 200",
+    } {
+        if !strings.Contains(steps, expected) {
+            t.Errorf("Expected step %q in:\n%s", expected, steps)
+        }
+    }
+    if explanations[0].Status != http.StatusOK {
+        t.Errorf("Expected status 200, got %d", explanations[0].Status)
+    }
+
+    // Switched on at runtime, every request is explained, without telling
+    // the client.
+    rr = httptest.NewRecorder()
+    server.ServeHTTP(rr, httptest.NewRequest("PUT", "/admin/explain", strings.NewReader(`{"all":true}`)))
+    if rr.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d", rr.Code)
+    }
+    rr = httptest.NewRecorder()
+    router.ServeHTTP(rr, httptest.NewRequest("GET", "http://example.com/", nil))
+    if rr.Header().Get("X-Explain") != "" {
+        t.Error("Expected no summary for requests that did not ask")
+    }
+    rr = httptest.NewRecorder()
+    server.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/explain", nil))
+    if err := json.NewDecoder(rr.Body).Decode(&explanations); err != nil || len(explanations) != 2 {
+        t.Errorf("Expected two explanations, got %d (%v)", len(explanations), err)
+    }
+}
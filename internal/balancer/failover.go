@@ -0,0 +1,48 @@
+package balancer
+
+import "math/rand"
+
+// Failover sends part of a route's traffic to a secondary pool while the
+// primary is degraded. Once the share of alive primary backends drops below
+// Threshold, Spill of the requests (0 to 1) go to Secondary; with no alive
+// primary backends all of them do. Traffic returns to the primary as soon as
+// its health recovers.
+type Failover struct {
+    Secondary string
+    Threshold float64
+    Spill     float64
+}
+
+// healthyFraction is the share of the pool's backends currently alive, or
+// zero for an empty pool.
+func (serverpool *ServerPool) healthyFraction() float64 {
+    backends := serverpool.Backends()
+    if len(backends) == 0 {
+        return 0
+    }
+    alive := 0
+    for _, peer := range backends {
+        if peer.IsAlive() {
+            alive++
+        }
+    }
+    return float64(alive) / float64(len(backends))
+}
+
+func (router *Router) failover(failover *Failover, poolName string) string {
+    primary := router.Pool(poolName)
+    if primary == nil || router.Pool(failover.Secondary) == nil {
+        return poolName
+    }
+
+    healthy := primary.healthyFraction()
+    switch {
+    case healthy >= failover.Threshold:
+        return poolName
+    case healthy == 0:
+        return failover.Secondary
+    case rand.Float64() < failover.Spill:
+        return failover.Secondary
+    }
+    return poolName
+}
@@ -0,0 +1,71 @@
+package balancer
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "testing"
+
+    "load-balancer/internal/backend"
+)
+
+func TestRouter_Failover(t *testing.T) {
+    secondary, closeSecondary := newTestPool(t, "secondary")
+    defer closeSecondary()
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte("primary"))
+    }))
+    defer server.Close()
+    serverURL, _ := url.Parse(server.URL)
+    primary := NewServerPool()
+    for i := 0; i < 4; i++ {
+        primary.AddBackend(&backend.Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)})
+    }
+
+    tests := []struct {
+        name     string
+        alive    int
+        spill    float64
+        minShare float64
+        maxShare float64
+    }{
+        {name: "healthy primary keeps all traffic", alive: 4, spill: 1, minShare: 0, maxShare: 0},
+        {name: "at threshold keeps all traffic", alive: 2, spill: 1, minShare: 0, maxShare: 0},
+        {name: "below threshold spills configured fraction", alive: 1, spill: 0.3, minShare: 0.2, maxShare: 0.4},
+        {name: "no alive primary sends everything", alive: 0, spill: 0.3, minShare: 1, maxShare: 1},
+        {name: "recovered primary takes traffic back", alive: 4, spill: 0.3, minShare: 0, maxShare: 0},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for i, peer := range primary.Backends() {
+                peer.SetAlive(i < tt.alive)
+            }
+            router := NewRouter("primary")
+            router.AddPool("primary", primary)
+            router.AddPool("secondary", secondary)
+            router.AddRoute(Route{
+                Name:     "api",
+                Pool:     "primary",
+                Failover: &Failover{Secondary: "secondary", Threshold: 0.5, Spill: tt.spill},
+            })
+
+            spilled := 0
+            const requests = 400
+            for i := 0; i < requests; i++ {
+                rr := httptest.NewRecorder()
+                router.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+                if rr.Body.String() == "secondary" {
+                    spilled++
+                }
+            }
+
+            share := float64(spilled) / requests
+            if share < tt.minShare || share > tt.maxShare {
+                t.Errorf("Expected spilled share between %v and %v, got %v", tt.minShare, tt.maxShare, share)
+            }
+        })
+    }
+}
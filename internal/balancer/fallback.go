@@ -0,0 +1,146 @@
+package balancer
+
+import (
+    "bytes"
+    "io"
+    "log"
+    "net/http"
+)
+
+// Fallback retries a route's request against another pool (a static-content
+// or read-replica pool, say) when the primary pool is missing or answers
+// with a 5xx. The primary's error response is held back until it is known
+// whether the fallback will be tried, so the client only sees the fallback's
+// answer. Request bodies larger than MaxBodyBytes (default 1 MiB) cannot be
+// replayed and surface the primary's response as is, as do the responses
+// to non-idempotent requests such as POST, which the primary may already
+// have acted on. Those only fall back when the primary pool is missing.
+type Fallback struct {
+    Pool         string
+    MaxBodyBytes int64
+}
+
+func (router *Router) serveFallback(fallback *Fallback, primary *ServerPool, writer http.ResponseWriter, request *http.Request) {
+    limit := fallback.MaxBodyBytes
+    if limit <= 0 {
+        limit = 1 << 20
+    }
+    secondary := router.Pool(fallback.Pool)
+    ok := primary == nil || isIdempotent(request.Method)
+    var body []byte
+    if ok {
+        body, ok = bufferRequestBody(request, limit)
+    }
+    if !ok || secondary == nil || secondary == primary {
+        if primary == nil {
+            writeError(router.metricsRegistry(), writer, ErrPoolNotFound)
+            return
+        }
+        primary.LoadBalancerHandler(writer, request)
+        return
+    }
+
+    if primary != nil {
+        held := &fallbackWriter{ResponseWriter: writer, header: make(http.Header)}
+        primary.LoadBalancerHandler(held, request)
+        if !held.failed {
+            held.commit()
+            return
+        }
+        log.Printf("router: primary pool answered %d, falling back to %q\n", held.status, fallback.Pool)
+        explaining(request).add("fallback", "primary pool answered %d: sent to %s", held.status, fallback.Pool)
+        if body != nil {
+            request.Body = io.NopCloser(bytes.NewReader(body))
+        }
+    }
+    explaining(request).note("pool", fallback.Pool)
+    secondary.LoadBalancerHandler(writer, request)
+}
+
+// bufferRequestBody reads the body so it can be sent twice, reporting false
+// when it is larger than limit. The bytes already read are put back in front
+// of the remainder either way.
+func bufferRequestBody(request *http.Request, limit int64) ([]byte, bool) {
+    if request.Body == nil || request.Body == http.NoBody {
+        return nil, true
+    }
+    body, err := io.ReadAll(io.LimitReader(request.Body, limit+1))
+    if err != nil || int64(len(body)) > limit {
+        request.Body = struct {
+            io.Reader
+            io.Closer
+        }{io.MultiReader(bytes.NewReader(body), request.Body), request.Body}
+        return nil, false
+    }
+    request.Body.Close()
+    request.Body = io.NopCloser(bytes.NewReader(body))
+    return body, true
+}
+
+// fallbackWriter keeps headers to itself until the status is known. A 5xx is
+// swallowed along with its body; anything else is passed through.
+type fallbackWriter struct {
+    http.ResponseWriter
+    header    http.Header
+    status    int
+    failed    bool
+    committed bool
+}
+
+func (writer *fallbackWriter) Header() http.Header {
+    if writer.committed {
+        return writer.ResponseWriter.Header()
+    }
+    return writer.header
+}
+
+func (writer *fallbackWriter) WriteHeader(status int) {
+    if writer.committed || writer.failed {
+        return
+    }
+    if status < http.StatusOK {
+        writer.ResponseWriter.WriteHeader(status)
+        return
+    }
+    writer.status = status
+    if status >= http.StatusInternalServerError {
+        writer.failed = true
+        return
+    }
+    writer.commit()
+}
+
+func (writer *fallbackWriter) Write(p []byte) (int, error) {
+    if writer.status == 0 {
+        writer.WriteHeader(http.StatusOK)
+    }
+    if writer.failed {
+        return len(p), nil
+    }
+    return writer.ResponseWriter.Write(p)
+}
+
+func (writer *fallbackWriter) Flush() {
+    if writer.committed {
+        http.NewResponseController(writer.ResponseWriter).Flush()
+    }
+}
+
+func (writer *fallbackWriter) Unwrap() http.ResponseWriter {
+    return writer.ResponseWriter
+}
+
+// commit copies the held headers out and sends the status, if any.
+func (writer *fallbackWriter) commit() {
+    if writer.committed || writer.failed {
+        return
+    }
+    writer.committed = true
+    header := writer.ResponseWriter.Header()
+    for key, values := range writer.header {
+        header[key] = values
+    }
+    if writer.status != 0 {
+        writer.ResponseWriter.WriteHeader(writer.status)
+    }
+}
@@ -0,0 +1,92 @@
+package balancer
+
+import (
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "os"
+    "strings"
+    "testing"
+
+    "load-balancer/internal/backend"
+)
+
+func TestRouter_Fallback(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        w.Header().Set("X-Served-By", "replica")
+        w.Write([]byte("replica:" + string(body)))
+    }))
+    defer replica.Close()
+    replicaURL, _ := url.Parse(replica.URL)
+    replicaPool := NewServerPool()
+    replicaPool.AddBackend(&backend.Backend{URL: replicaURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(replicaURL)})
+
+    status := http.StatusOK
+    primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("X-Primary", "true")
+        w.WriteHeader(status)
+        w.Write([]byte("primary"))
+    }))
+    defer primary.Close()
+    primaryURL, _ := url.Parse(primary.URL)
+    primaryPool := NewServerPool()
+    primaryPool.AddBackend(&backend.Backend{URL: primaryURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(primaryURL)})
+
+    tests := []struct {
+        name         string
+        method       string
+        status       int
+        pool         string
+        body         string
+        maxBodyBytes int64
+        expectedCode int
+        expectedBody string
+    }{
+        {name: "success is passed through", status: http.StatusOK, pool: "primary", expectedCode: http.StatusOK, expectedBody: "primary"},
+        {name: "client error is passed through", status: http.StatusNotFound, pool: "primary", expectedCode: http.StatusNotFound, expectedBody: "primary"},
+        {name: "server error falls back", status: http.StatusInternalServerError, pool: "primary", expectedCode: http.StatusOK, expectedBody: "replica:"},
+        {name: "body is replayed to fallback", status: http.StatusBadGateway, pool: "primary", body: "payload", expectedCode: http.StatusOK, expectedBody: "replica:payload"},
+        {name: "oversized body surfaces primary error", status: http.StatusBadGateway, pool: "primary", body: "payload", maxBodyBytes: 3, expectedCode: http.StatusBadGateway, expectedBody: "primary"},
+        {name: "missing primary pool falls back", status: http.StatusOK, pool: "missing", expectedCode: http.StatusOK, expectedBody: "replica:"},
+        {name: "non-idempotent request surfaces primary error", method: "POST", status: http.StatusBadGateway, pool: "primary", body: "payload", expectedCode: http.StatusBadGateway, expectedBody: "primary"},
+        {name: "non-idempotent request falls back from missing pool", method: "POST", pool: "missing", body: "payload", expectedCode: http.StatusOK, expectedBody: "replica:payload"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            status = tt.status
+            router := NewRouter("primary")
+            router.AddPool("primary", primaryPool)
+            router.AddPool("replica", replicaPool)
+            router.AddRoute(Route{
+                Name:     "api",
+                Pool:     tt.pool,
+                Fallback: &Fallback{Pool: "replica", MaxBodyBytes: tt.maxBodyBytes},
+            })
+
+            method := tt.method
+            if method == "" {
+                method = "PUT"
+            }
+            rr := httptest.NewRecorder()
+            router.ServeHTTP(rr, httptest.NewRequest(method, "/", strings.NewReader(tt.body)))
+
+            if rr.Code != tt.expectedCode {
+                t.Errorf("Expected status %d, got %d", tt.expectedCode, rr.Code)
+            }
+            if rr.Body.String() != tt.expectedBody {
+                t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body.String())
+            }
+            if strings.HasPrefix(tt.expectedBody, "replica") && rr.Header().Get("X-Primary") != "" {
+                t.Errorf("Expected primary headers to be discarded on fallback")
+            }
+        })
+    }
+}
@@ -0,0 +1,203 @@
+package balancer
+
+import (
+    "context"
+    "log"
+    "sync"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+// HealthCheckConfig controls a pool's health checks. Protocol selects how a
+// backend is probed: "http" (default) expects a 2xx for GET on its URL,
+// "tcp" only connects, and "mysql" and "redis" speak enough of the database
+// protocol to tell a wedged server from one that merely accepts connections
+// (see probe). MySQLUser and RedisPassword authenticate those checks.
+// "exec" runs Command on this host instead of contacting the backend (see
+// execProbe).
+type HealthCheckConfig struct {
+    Interval      time.Duration
+    Timeout       time.Duration
+    Concurrency   int
+    Protocol      string
+    MySQLUser     string
+    RedisPassword string
+    Command       []string
+}
+
+func (config *HealthCheckConfig) withDefaults() HealthCheckConfig {
+    result := *config
+    if result.Interval <= 0 {
+        result.Interval = 10 * time.Second
+    }
+    if result.Timeout <= 0 {
+        result.Timeout = 2 * time.Second
+    }
+    if result.Concurrency <= 0 {
+        result.Concurrency = 10
+    }
+    if result.Protocol == "" {
+        result.Protocol = "http"
+    }
+    return result
+}
+
+// RunHealthChecks checks the pool's backends every Interval until ctx is
+// cancelled, at most Concurrency at a time. Each pool runs its own loop and
+// workers, so a pool of many slow backends only delays its own rounds; a
+// round that overruns Interval skips the missed ticks rather than queueing
+// them.
+func (serverpool *ServerPool) RunHealthChecks(ctx context.Context, config HealthCheckConfig) {
+    config = config.withDefaults()
+    probe := config.probe()
+
+    ticker := time.NewTicker(config.Interval)
+    defer ticker.Stop()
+    // Once the loop stops no round is coming, so 503s stop promising one.
+    defer serverpool.observeHealthRound(0, time.Time{})
+
+    for {
+        serverpool.checkRound(ctx, probe, config.Concurrency)
+        serverpool.observeHealthRound(config.Interval, time.Now())
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+func (serverpool *ServerPool) checkRound(ctx context.Context, probe probe, concurrency int) {
+    slots := make(chan struct{}, concurrency)
+    var wg sync.WaitGroup
+    for _, peer := range serverpool.Backends() {
+        select {
+        case <-ctx.Done():
+            wg.Wait()
+            return
+        case slots <- struct{}{}:
+        }
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            defer func() { <-slots }()
+            serverpool.checkBackend(ctx, probe, peer)
+        }()
+    }
+    wg.Wait()
+}
+
+func (serverpool *ServerPool) checkBackend(ctx context.Context, probe probe, peer *backend.Backend) {
+    err := probe(ctx, peer)
+    if ctx.Err() != nil {
+        return
+    }
+    alive := err == nil
+
+    if alive && !peer.Healthy() && serverpool.startWarmUp(peer) {
+        log.Printf("%s [warming]\n", peer.URL)
+        return
+    }
+
+    if !alive {
+        serverpool.vetoAdmission(peer)
+        peer.SetAlive(false)
+        log.Printf("%s [down] %v\n", peer.URL, err)
+        return
+    }
+    if !peer.Healthy() {
+        serverpool.markUp(peer)
+        return
+    }
+    log.Printf("%s [up]\n", peer.URL)
+}
+
+// RunHealthChecks starts an independent health check loop for every pool,
+// using configs[name] or fallback for pools without their own entry, and
+// returns once ctx is cancelled and all loops have stopped.
+func (router *Router) RunHealthChecks(ctx context.Context, configs map[string]HealthCheckConfig, fallback HealthCheckConfig) {
+    router.mux.RLock()
+    pools := make(map[string]*ServerPool, len(router.pools))
+    for name, pool := range router.pools {
+        pools[name] = pool
+    }
+    router.mux.RUnlock()
+
+    var wg sync.WaitGroup
+    for name, pool := range pools {
+        config, ok := configs[name]
+        if !ok {
+            config = fallback
+        }
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            pool.RunHealthChecks(ctx, config)
+        }()
+    }
+    wg.Wait()
+}
+
+// HealthChecker runs health checks in the background between Start and
+// Stop, for callers that would rather not own the goroutine the
+// RunHealthChecks loops block.
+type HealthChecker struct {
+    run func(ctx context.Context)
+
+    mux    sync.Mutex
+    cancel context.CancelFunc
+    done   chan struct{}
+}
+
+// HealthChecker returns a checker running the pool's health checks with
+// config.
+func (serverpool *ServerPool) HealthChecker(config HealthCheckConfig) *HealthChecker {
+    return &HealthChecker{run: func(ctx context.Context) { serverpool.RunHealthChecks(ctx, config) }}
+}
+
+// HealthChecker returns a checker running every pool's health checks, as
+// RunHealthChecks does.
+func (router *Router) HealthChecker(configs map[string]HealthCheckConfig, fallback HealthCheckConfig) *HealthChecker {
+    return &HealthChecker{run: func(ctx context.Context) { router.RunHealthChecks(ctx, configs, fallback) }}
+}
+
+// Start begins checking until Stop is called or ctx is cancelled. The
+// first round runs straight away. Starting a running checker does nothing;
+// one whose ctx was cancelled starts again.
+func (checker *HealthChecker) Start(ctx context.Context) {
+    checker.mux.Lock()
+    defer checker.mux.Unlock()
+
+    if checker.done != nil {
+        select {
+        case <-checker.done:
+            checker.cancel()
+        default:
+            return
+        }
+    }
+    ctx, cancel := context.WithCancel(ctx)
+    done := make(chan struct{})
+    checker.cancel, checker.done = cancel, done
+    go func() {
+        defer close(done)
+        checker.run(ctx)
+    }()
+}
+
+// Stop ends checking and waits for checks in progress to return. The
+// checker may be started again afterwards; a Start racing with Stop waits
+// for the old loop to exit, so two never run at once.
+func (checker *HealthChecker) Stop() {
+    checker.mux.Lock()
+    defer checker.mux.Unlock()
+
+    if checker.cancel == nil {
+        return
+    }
+    checker.cancel()
+    <-checker.done
+    checker.cancel, checker.done = nil, nil
+}
@@ -0,0 +1,220 @@
+package balancer
+
+import (
+    "context"
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "os"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+func TestRouter_RunHealthChecksIsolatesPools(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    release := make(chan struct{})
+    slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        select {
+        case <-release:
+        case <-r.Context().Done():
+        }
+    }))
+    defer slowServer.Close()
+    defer close(release)
+
+    var fastChecks atomic.Int64
+    fastServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        fastChecks.Add(1)
+    }))
+    defer fastServer.Close()
+
+    slowURL, _ := url.Parse(slowServer.URL)
+    slow := NewServerPool()
+    for i := 0; i < 20; i++ {
+        slow.AddBackend(&backend.Backend{URL: slowURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(slowURL)})
+    }
+    fastURL, _ := url.Parse(fastServer.URL)
+    fast := NewServerPool()
+    fastBackend := &backend.Backend{URL: fastURL, ReverseProxy: httputil.NewSingleHostReverseProxy(fastURL)}
+    fast.AddBackend(fastBackend)
+
+    router := NewRouter("fast")
+    router.AddPool("slow", slow)
+    router.AddPool("fast", fast)
+
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    go func() {
+        router.RunHealthChecks(ctx, map[string]HealthCheckConfig{
+            "slow": {Interval: 10 * time.Millisecond, Timeout: 5 * time.Second, Concurrency: 1},
+        }, HealthCheckConfig{Interval: 10 * time.Millisecond})
+        close(done)
+    }()
+
+    deadline := time.Now().Add(2 * time.Second)
+    for fastChecks.Load() < 5 {
+        if time.Now().After(deadline) {
+            t.Fatalf("Expected the fast pool to keep its schedule, got %d checks", fastChecks.Load())
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+    if !fastBackend.IsAlive() {
+        t.Error("Expected fast backend to be marked alive")
+    }
+    for _, peer := range slow.Backends() {
+        if !peer.IsAlive() {
+            t.Error("Expected slow backends to keep their state while their checks are in flight")
+        }
+    }
+
+    cancel()
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatal("Expected RunHealthChecks to return after cancel")
+    }
+}
+
+func TestServerPool_RunHealthChecksConcurrency(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    var inFlight, peak atomic.Int64
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        current := inFlight.Add(1)
+        defer inFlight.Add(-1)
+        for {
+            previous := peak.Load()
+            if current <= previous || peak.CompareAndSwap(previous, current) {
+                break
+            }
+        }
+        time.Sleep(20 * time.Millisecond)
+    }))
+    defer server.Close()
+
+    serverURL, _ := url.Parse(server.URL)
+    pool := NewServerPool()
+    for i := 0; i < 12; i++ {
+        pool.AddBackend(&backend.Backend{URL: serverURL, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)})
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    client := &http.Client{Timeout: time.Second}
+    pool.checkRound(ctx, httpProbe(client), 3)
+
+    if peak.Load() != 3 {
+        t.Errorf("Expected at most 3 concurrent checks, got %d", peak.Load())
+    }
+    for _, peer := range pool.Backends() {
+        if !peer.IsAlive() {
+            t.Error("Expected every backend to be checked and marked alive")
+        }
+    }
+}
+
+func TestHealthChecker(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    var checks atomic.Int64
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        checks.Add(1)
+        if r.URL.Path == "/slow" {
+            select {
+            case <-time.After(time.Second):
+            case <-r.Context().Done():
+            }
+        }
+    }))
+    defer server.Close()
+
+    fastURL, _ := url.Parse(server.URL)
+    slowURL, _ := url.Parse(server.URL + "/slow")
+    pool := NewServerPool()
+    fast := &backend.Backend{URL: fastURL, ReverseProxy: httputil.NewSingleHostReverseProxy(fastURL)}
+    slow := &backend.Backend{URL: slowURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(slowURL)}
+    pool.AddBackend(fast)
+    pool.AddBackend(slow)
+
+    checker := pool.HealthChecker(HealthCheckConfig{Interval: 10 * time.Millisecond, Timeout: 50 * time.Millisecond})
+    checker.Start(context.Background())
+    checker.Start(context.Background())
+
+    deadline := time.Now().Add(2 * time.Second)
+    for checks.Load() < 6 {
+        if time.Now().After(deadline) {
+            t.Fatalf("Expected periodic checks, got %d", checks.Load())
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+    if !fast.IsAlive() {
+        t.Error("Expected fast backend to be marked alive")
+    }
+    if slow.IsAlive() {
+        t.Error("Expected backend slower than the timeout to be marked down")
+    }
+
+    checker.Stop()
+    time.Sleep(20 * time.Millisecond)
+    stopped := checks.Load()
+    time.Sleep(50 * time.Millisecond)
+    if checks.Load() != stopped {
+        t.Errorf("Expected no checks after Stop, got %d more", checks.Load()-stopped)
+    }
+    checker.Stop()
+}
+
+func TestHealthChecker_OneLoopAtATime(t *testing.T) {
+    var running, overlaps atomic.Int64
+    checker := &HealthChecker{run: func(ctx context.Context) {
+        if running.Add(1) > 1 {
+            overlaps.Add(1)
+        }
+        <-ctx.Done()
+        time.Sleep(time.Millisecond)
+        running.Add(-1)
+    }}
+
+    var wg sync.WaitGroup
+    for i := 0; i < 20; i++ {
+        wg.Add(2)
+        go func() {
+            defer wg.Done()
+            checker.Start(context.Background())
+        }()
+        go func() {
+            defer wg.Done()
+            checker.Stop()
+        }()
+    }
+    wg.Wait()
+    checker.Stop()
+
+    if overlaps.Load() != 0 {
+        t.Errorf("Expected one loop at a time, saw %d overlaps", overlaps.Load())
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    checker.Start(ctx)
+    for running.Load() != 1 {
+        time.Sleep(time.Millisecond)
+    }
+    cancel()
+    <-checker.done
+    checker.Start(context.Background())
+    for running.Load() != 1 {
+        time.Sleep(time.Millisecond)
+    }
+    checker.Stop()
+}
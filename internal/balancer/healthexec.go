@@ -0,0 +1,89 @@
+package balancer
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "os"
+    "os/exec"
+    "strings"
+    "sync"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+// maxExecOutput bounds the output of an exec check kept for its error.
+const maxExecOutput = 4096
+
+// execProbe judges a backend by running command on this host, for checks
+// only a local agent can answer. Exit status 0 means healthy; anything
+// else, or running past timeout, means unhealthy, with the command's output
+// as the reason. {url}, {host} and {port} in the arguments are replaced
+// with the backend's, which are also passed as LB_BACKEND_URL,
+// LB_BACKEND_HOST and LB_BACKEND_PORT in the environment.
+func execProbe(timeout time.Duration, command []string) probe {
+    return func(ctx context.Context, peer *backend.Backend) error {
+        if len(command) == 0 {
+            return errors.New("exec health check has no command")
+        }
+        ctx, cancel := context.WithTimeout(ctx, timeout)
+        defer cancel()
+
+        replacer := strings.NewReplacer("{url}", peer.URL.String(), "{host}", peer.URL.Hostname(), "{port}", peer.URL.Port())
+        args := make([]string, len(command))
+        for i, arg := range command {
+            args[i] = replacer.Replace(arg)
+        }
+
+        output := &limitedBuffer{limit: maxExecOutput}
+        cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+        cmd.Env = append(os.Environ(),
+            "LB_BACKEND_URL="+peer.URL.String(),
+            "LB_BACKEND_HOST="+peer.URL.Hostname(),
+            "LB_BACKEND_PORT="+peer.URL.Port(),
+        )
+        cmd.Stdout, cmd.Stderr = output, output
+        // A child the command left behind may hold the output open; don't
+        // wait for it past the timeout.
+        cmd.WaitDelay = time.Second
+
+        err := cmd.Run()
+        if err == nil {
+            return nil
+        }
+        if ctx.Err() == context.DeadlineExceeded {
+            err = fmt.Errorf("timeout after %s", timeout)
+        }
+        if text := strings.TrimSpace(output.String()); text != "" {
+            return fmt.Errorf("%w: %s", err, text)
+        }
+        return err
+    }
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the
+// rest, so a chatty check cannot grow memory.
+type limitedBuffer struct {
+    mux   sync.Mutex
+    buf   bytes.Buffer
+    limit int
+}
+
+func (buffer *limitedBuffer) Write(p []byte) (int, error) {
+    buffer.mux.Lock()
+    defer buffer.mux.Unlock()
+
+    if room := buffer.limit - buffer.buf.Len(); room > 0 {
+        buffer.buf.Write(p[:min(len(p), room)])
+    }
+    return len(p), nil
+}
+
+func (buffer *limitedBuffer) String() string {
+    buffer.mux.Lock()
+    defer buffer.mux.Unlock()
+
+    return buffer.buf.String()
+}
@@ -0,0 +1,223 @@
+package balancer
+
+import (
+    "bufio"
+    "context"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+// probe reports why peer is unhealthy, or nil when it is healthy.
+type probe func(ctx context.Context, peer *backend.Backend) error
+
+func (config HealthCheckConfig) probe() probe {
+    switch config.Protocol {
+    case "http":
+        return httpProbe(&http.Client{Timeout: config.Timeout})
+    case "tcp":
+        return dialProbe(config.Timeout, "", func(conn net.Conn) error { return nil })
+    case "mysql":
+        return dialProbe(config.Timeout, "3306", func(conn net.Conn) error { return checkMySQL(conn, config.MySQLUser) })
+    case "redis":
+        return dialProbe(config.Timeout, "6379", func(conn net.Conn) error { return checkRedis(conn, config.RedisPassword) })
+    case "exec":
+        return execProbe(config.Timeout, config.Command)
+    }
+    return func(ctx context.Context, peer *backend.Backend) error {
+        return fmt.Errorf("unsupported health check protocol %q", config.Protocol)
+    }
+}
+
+func httpProbe(client *http.Client) probe {
+    return func(ctx context.Context, peer *backend.Backend) error {
+        request, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL(peer).String(), nil)
+        if err != nil {
+            return err
+        }
+        resp, err := client.Do(request)
+        if err != nil {
+            return err
+        }
+        resp.Body.Close()
+        if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+            return fmt.Errorf("status %d", resp.StatusCode)
+        }
+        return nil
+    }
+}
+
+// healthURL is peer's URL with its health path and port, if it has them.
+// A health path may carry a query string.
+func healthURL(peer *backend.Backend) *url.URL {
+    target := *peer.URL
+    if peer.HealthPort != "" {
+        target.Host = net.JoinHostPort(target.Hostname(), peer.HealthPort)
+    }
+    if peer.HealthPath != "" {
+        path, query, _ := strings.Cut(peer.HealthPath, "?")
+        target.Path, target.RawPath, target.RawQuery = path, "", query
+    }
+    return &target
+}
+
+// dialProbe connects to the backend's host (adding defaultPort when the URL
+// has none) and hands the connection to check, which must finish within
+// timeout.
+func dialProbe(timeout time.Duration, defaultPort string, check func(conn net.Conn) error) probe {
+    return func(ctx context.Context, peer *backend.Backend) error {
+        ctx, cancel := context.WithTimeout(ctx, timeout)
+        defer cancel()
+
+        var dialer net.Dialer
+        conn, err := dialer.DialContext(ctx, "tcp", dialAddress(peer, defaultPort))
+        if err != nil {
+            return err
+        }
+        defer conn.Close()
+
+        deadline, _ := ctx.Deadline()
+        conn.SetDeadline(deadline)
+        return check(conn)
+    }
+}
+
+// dialAddress is the host and port to connect to peer on: its health port
+// if it has one, else its URL's port, else defaultPort.
+func dialAddress(peer *backend.Backend, defaultPort string) string {
+    if peer.HealthPort != "" {
+        return net.JoinHostPort(peer.URL.Hostname(), peer.HealthPort)
+    }
+    if peer.URL.Port() == "" && defaultPort != "" {
+        return net.JoinHostPort(peer.URL.Hostname(), defaultPort)
+    }
+    return peer.URL.Host
+}
+
+const (
+    mysqlClientLongPassword     = 0x00000001
+    mysqlClientProtocol41       = 0x00000200
+    mysqlClientSecureConnection = 0x00008000
+)
+
+// checkMySQL reads the server's initial handshake, which a server refusing
+// connections (too many clients, blocked host) replaces with an error
+// packet. With a user it also logs in, so a server that accepts connections
+// but cannot serve them fails the check, and quits cleanly so the check is
+// not counted against the host as an aborted connection. The user needs no
+// password and no privileges.
+func checkMySQL(conn net.Conn, user string) error {
+    reader := bufio.NewReader(conn)
+    handshake, err := readMySQLPacket(reader)
+    if err != nil {
+        return fmt.Errorf("mysql handshake: %w", err)
+    }
+    if err := mysqlError(handshake); err != nil {
+        return err
+    }
+    if handshake[0] != 10 {
+        return fmt.Errorf("mysql handshake: unsupported protocol version %d", handshake[0])
+    }
+    if user == "" {
+        return nil
+    }
+
+    response := binary.LittleEndian.AppendUint32(nil, mysqlClientLongPassword|mysqlClientProtocol41|mysqlClientSecureConnection)
+    response = binary.LittleEndian.AppendUint32(response, 1<<24)
+    response = append(response, 33)
+    response = append(response, make([]byte, 23)...)
+    response = append(response, user...)
+    response = append(response, 0, 0)
+    if err := writeMySQLPacket(conn, 1, response); err != nil {
+        return fmt.Errorf("mysql login: %w", err)
+    }
+    reply, err := readMySQLPacket(reader)
+    if err != nil {
+        return fmt.Errorf("mysql login: %w", err)
+    }
+    if err := mysqlError(reply); err != nil {
+        return err
+    }
+    if reply[0] != 0x00 {
+        return fmt.Errorf("mysql login: unexpected reply 0x%02x", reply[0])
+    }
+    writeMySQLPacket(conn, 0, []byte{0x01})
+    return nil
+}
+
+func readMySQLPacket(reader *bufio.Reader) ([]byte, error) {
+    var header [4]byte
+    if _, err := io.ReadFull(reader, header[:]); err != nil {
+        return nil, err
+    }
+    length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+    if length == 0 {
+        return nil, errors.New("empty packet")
+    }
+    payload := make([]byte, length)
+    if _, err := io.ReadFull(reader, payload); err != nil {
+        return nil, err
+    }
+    return payload, nil
+}
+
+func writeMySQLPacket(conn net.Conn, sequence byte, payload []byte) error {
+    packet := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), sequence}
+    _, err := conn.Write(append(packet, payload...))
+    return err
+}
+
+// mysqlError decodes an error packet, whose message may follow a "#" and a
+// five character SQL state.
+func mysqlError(payload []byte) error {
+    if payload[0] != 0xff || len(payload) < 3 {
+        return nil
+    }
+    code := binary.LittleEndian.Uint16(payload[1:3])
+    message := payload[3:]
+    if len(message) >= 6 && message[0] == '#' {
+        message = message[6:]
+    }
+    return fmt.Errorf("mysql error %d: %s", code, message)
+}
+
+// checkRedis authenticates when a password is set and expects PONG to a
+// PING. A server still loading its dataset or stuck in a busy script answers
+// with an error instead.
+func checkRedis(conn net.Conn, password string) error {
+    reader := bufio.NewReader(conn)
+    if password != "" {
+        if err := redisCommand(conn, reader, "+OK", "AUTH", password); err != nil {
+            return err
+        }
+    }
+    return redisCommand(conn, reader, "+PONG", "PING")
+}
+
+func redisCommand(conn net.Conn, reader *bufio.Reader, expected string, args ...string) error {
+    var command strings.Builder
+    command.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+    for _, arg := range args {
+        command.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+    }
+    if _, err := io.WriteString(conn, command.String()); err != nil {
+        return fmt.Errorf("redis %s: %w", args[0], err)
+    }
+    line, err := reader.ReadString('\n')
+    if err != nil {
+        return fmt.Errorf("redis %s: %w", args[0], err)
+    }
+    if reply := strings.TrimRight(line, "\r\n"); reply != expected {
+        return fmt.Errorf("redis %s: %s", args[0], strings.TrimPrefix(reply, "-"))
+    }
+    return nil
+}
@@ -0,0 +1,191 @@
+package balancer
+
+import (
+    "bufio"
+    "context"
+    "io"
+    "log"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+// serveTCP answers every connection with handle until the test ends.
+func serveTCP(t *testing.T, handle func(conn net.Conn)) *url.URL {
+    t.Helper()
+
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("listen: %v", err)
+    }
+    t.Cleanup(func() { listener.Close() })
+    go func() {
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            go func() {
+                defer conn.Close()
+                handle(conn)
+            }()
+        }
+    }()
+    return &url.URL{Scheme: "tcp", Host: listener.Addr().String()}
+}
+
+func mysqlPacket(sequence byte, payload []byte) []byte {
+    return append([]byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), sequence}, payload...)
+}
+
+func mysqlServer(reply []byte) func(conn net.Conn) {
+    return func(conn net.Conn) {
+        handshake := append([]byte{10}, "8.0.36\x00"...)
+        handshake = append(handshake, make([]byte, 40)...)
+        conn.Write(mysqlPacket(0, handshake))
+        if reply == nil {
+            return
+        }
+        reader := bufio.NewReader(conn)
+        if _, err := readMySQLPacket(reader); err != nil {
+            return
+        }
+        conn.Write(mysqlPacket(2, reply))
+        readMySQLPacket(reader)
+    }
+}
+
+func redisServer(replies map[string]string) func(conn net.Conn) {
+    return func(conn net.Conn) {
+        reader := bufio.NewReader(conn)
+        for {
+            line, err := reader.ReadString('\n')
+            if err != nil {
+                return
+            }
+            if !strings.HasPrefix(line, "$") {
+                continue
+            }
+            command, err := reader.ReadString('\n')
+            if err != nil {
+                return
+            }
+            if reply, ok := replies[strings.TrimSpace(command)]; ok {
+                io.WriteString(conn, reply+"\r\n")
+                if strings.TrimSpace(command) == "AUTH" {
+                    reader.ReadString('\n')
+                    reader.ReadString('\n')
+                }
+            }
+        }
+    }
+}
+
+func wedged(conn net.Conn) {
+    io.Copy(io.Discard, conn)
+}
+
+func TestHealthCheck_ProtocolProbes(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    mysqlErr := append([]byte{0xff, 0x10, 0x04}, "#08004Too many connections"...)
+
+    tests := []struct {
+        name          string
+        config        HealthCheckConfig
+        handle        func(conn net.Conn)
+        expectedAlive bool
+        expectedError string
+    }{
+        {name: "tcp connect", config: HealthCheckConfig{Protocol: "tcp"}, handle: wedged, expectedAlive: true},
+        {name: "mysql handshake", config: HealthCheckConfig{Protocol: "mysql"}, handle: mysqlServer(nil), expectedAlive: true},
+        {name: "mysql login", config: HealthCheckConfig{Protocol: "mysql", MySQLUser: "lb_check"}, handle: mysqlServer([]byte{0x00, 0, 0, 2, 0, 0, 0}), expectedAlive: true},
+        {name: "mysql refuses connections", config: HealthCheckConfig{Protocol: "mysql"}, handle: func(conn net.Conn) { conn.Write(mysqlPacket(0, mysqlErr)) }, expectedError: "Too many connections"},
+        {name: "mysql login rejected", config: HealthCheckConfig{Protocol: "mysql", MySQLUser: "nobody"}, handle: mysqlServer(append([]byte{0xff, 0x15, 0x04}, "#28000Access denied"...)), expectedError: "Access denied"},
+        {name: "mysql accepts but never answers", config: HealthCheckConfig{Protocol: "mysql"}, handle: wedged, expectedError: "timeout"},
+        {name: "redis ping", config: HealthCheckConfig{Protocol: "redis"}, handle: redisServer(map[string]string{"PING": "+PONG"}), expectedAlive: true},
+        {name: "redis auth", config: HealthCheckConfig{Protocol: "redis", RedisPassword: "secret"}, handle: redisServer(map[string]string{"AUTH": "+OK", "PING": "+PONG"}), expectedAlive: true},
+        {name: "redis loading", config: HealthCheckConfig{Protocol: "redis"}, handle: redisServer(map[string]string{"PING": "-LOADING Redis is loading the dataset in memory"}), expectedError: "LOADING"},
+        {name: "redis accepts but never answers", config: HealthCheckConfig{Protocol: "redis"}, handle: wedged, expectedError: "timeout"},
+        {name: "exec passes", config: HealthCheckConfig{Protocol: "exec", Command: []string{"sh", "-c", `test "$LB_BACKEND_PORT" = "$0"`, "{port}"}}, handle: wedged, expectedAlive: true},
+        {name: "exec fails", config: HealthCheckConfig{Protocol: "exec", Command: []string{"sh", "-c", "echo replication lag 300s; exit 2"}}, handle: wedged, expectedError: "replication lag 300s"},
+        {name: "exec hangs", config: HealthCheckConfig{Protocol: "exec", Command: []string{"sleep", "5"}}, handle: wedged, expectedError: "timeout"},
+        {name: "exec without command", config: HealthCheckConfig{Protocol: "exec"}, handle: wedged, expectedError: "no command"},
+        {name: "unsupported protocol", config: HealthCheckConfig{Protocol: "postgres"}, handle: wedged, expectedError: "unsupported"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            tt.config.Timeout = 200 * time.Millisecond
+            config := tt.config.withDefaults()
+            peer := &backend.Backend{URL: serveTCP(t, tt.handle), Alive: !tt.expectedAlive}
+
+            err := config.probe()(context.Background(), peer)
+            if tt.expectedError == "" && err != nil {
+                t.Errorf("Expected a healthy probe, got %v", err)
+            }
+            if tt.expectedError != "" && (err == nil || !strings.Contains(err.Error(), tt.expectedError)) {
+                t.Errorf("Expected an error containing %q, got %v", tt.expectedError, err)
+            }
+
+            NewServerPool().checkBackend(context.Background(), config.probe(), peer)
+            if peer.IsAlive() != tt.expectedAlive {
+                t.Errorf("Expected alive %v, got %v", tt.expectedAlive, peer.IsAlive())
+            }
+        })
+    }
+}
+
+func TestHealthCheck_HealthPathAndPort(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    traffic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/" {
+            http.NotFound(w, r)
+        }
+    }))
+    defer traffic.Close()
+    health := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/healthz" || r.URL.Query().Get("full") != "1" {
+            http.NotFound(w, r)
+        }
+    }))
+    defer health.Close()
+
+    trafficURL, _ := url.Parse(traffic.URL)
+    healthURL, _ := url.Parse(health.URL)
+    tests := []struct {
+        name          string
+        healthPath    string
+        healthPort    string
+        protocol      string
+        expectedAlive bool
+    }{
+        {name: "root of the traffic port", expectedAlive: true},
+        {name: "path only", healthPath: "/healthz?full=1", expectedAlive: false},
+        {name: "port only", healthPort: healthURL.Port(), expectedAlive: false},
+        {name: "path and port", healthPath: "/healthz?full=1", healthPort: healthURL.Port(), expectedAlive: true},
+        {name: "tcp on the health port", healthPort: healthURL.Port(), protocol: "tcp", expectedAlive: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            config := (&HealthCheckConfig{Protocol: tt.protocol}).withDefaults()
+            peer := &backend.Backend{URL: trafficURL, Alive: !tt.expectedAlive, HealthPath: tt.healthPath, HealthPort: tt.healthPort}
+
+            NewServerPool().checkBackend(context.Background(), config.probe(), peer)
+            if peer.IsAlive() != tt.expectedAlive {
+                t.Errorf("Expected alive %v, got %v", tt.expectedAlive, peer.IsAlive())
+            }
+        })
+    }
+}
@@ -0,0 +1,248 @@
+package balancer
+
+import (
+    "context"
+    "errors"
+    "log"
+    "net/http"
+    "sync"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+// HedgeConfig enables hedged requests: when an idempotent request without a
+// body has no response after Delay, a second copy goes to another backend
+// and whichever responds first is used; the other is cancelled. Every
+// request adds BudgetRatio to a budget capped at BudgetBurst and each hedge
+// spends one, so extra load stays near BudgetRatio of the traffic. Hedging
+// cannot be combined with hooks or Retry-After handling; SetHedging returns
+// an error when either is configured.
+type HedgeConfig struct {
+    Name        string
+    Delay       time.Duration
+    BudgetRatio float64
+    BudgetBurst float64
+    Registry    *metrics.Registry
+}
+
+type hedging struct {
+    config HedgeConfig
+
+    mux     sync.Mutex
+    balance float64
+
+    won    *metrics.Counter
+    lost   *metrics.Counter
+    denied *metrics.Counter
+}
+
+func (serverpool *ServerPool) SetHedging(config HedgeConfig) error {
+    if serverpool.hooks.Load() != nil {
+        return errors.New("balancer: hedging cannot be combined with hooks")
+    }
+    if serverpool.retry.Load() != nil {
+        return errors.New("balancer: hedging cannot be combined with Retry-After handling")
+    }
+    if config.Delay <= 0 {
+        config.Delay = 100 * time.Millisecond
+    }
+    if config.BudgetRatio <= 0 {
+        config.BudgetRatio = 0.1
+    }
+    if config.BudgetBurst <= 0 {
+        config.BudgetBurst = 10
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+    const name, help = "lb_hedge_requests_total", "Hedged requests by outcome: won, lost, or denied by the budget."
+    serverpool.hedge.Store(&hedging{
+        config:  config,
+        balance: config.BudgetBurst,
+        won:     config.Registry.Counter(name, help, "pool", config.Name, "outcome", "won"),
+        lost:    config.Registry.Counter(name, help, "pool", config.Name, "outcome", "lost"),
+        denied:  config.Registry.Counter(name, help, "pool", config.Name, "outcome", "denied"),
+    })
+    return nil
+}
+
+func (hedge *hedging) deposit() {
+    hedge.mux.Lock()
+    hedge.balance = min(hedge.balance+hedge.config.BudgetRatio, hedge.config.BudgetBurst)
+    hedge.mux.Unlock()
+}
+
+func (hedge *hedging) withdraw() bool {
+    hedge.mux.Lock()
+    defer hedge.mux.Unlock()
+
+    if hedge.balance < 1 {
+        return false
+    }
+    hedge.balance--
+    return true
+}
+
+// spendBudget reports whether a hedge may be sent.
+func (hedge *hedging) spendBudget() bool {
+    if !hedge.withdraw() {
+        hedge.denied.Inc()
+        return false
+    }
+    return true
+}
+
+func (serverpool *ServerPool) serveHedged(hedge *hedging, writer http.ResponseWriter, request *http.Request) {
+    primary, err := serverpool.pick(request, nil)
+    if err != nil {
+        serverpool.writeError(writer, err)
+        return
+    }
+
+    race := &hedgeRace{writer: writer, decided: make(chan struct{})}
+    race.start(serverpool, primary, request)
+
+    timer := time.NewTimer(hedge.config.Delay)
+    var hedged *hedgeAttempt
+    select {
+    case <-race.decided:
+    case <-request.Context().Done():
+    case <-timer.C:
+        if peer := serverpool.nextPeer(request, map[*backend.Backend]bool{primary: true}); peer != nil && hedge.spendBudget() {
+            hedged = race.start(serverpool, peer, request)
+        }
+    }
+    timer.Stop()
+    race.wg.Wait()
+
+    if hedged != nil {
+        if race.winner == hedged {
+            hedge.won.Inc()
+        } else {
+            hedge.lost.Inc()
+        }
+    }
+    // The winner's abort belongs to this request, so it is raised here,
+    // where the server recovers it, rather than in the attempt's goroutine.
+    if race.winner != nil && race.winner.aborted {
+        panic(http.ErrAbortHandler)
+    }
+}
+
+// hedgeRace lets the first attempt to produce a response write through to
+// the client and cancels the rest.
+type hedgeRace struct {
+    writer  http.ResponseWriter
+    wg      sync.WaitGroup
+    decided chan struct{}
+
+    mux      sync.Mutex
+    winner   *hedgeAttempt
+    attempts []*hedgeAttempt
+}
+
+var errHedgeLost = errors.New("another hedged request answered first")
+
+type hedgeAttempt struct {
+    race   *hedgeRace
+    cancel  context.CancelCauseFunc
+    header  http.Header
+    won     bool
+    aborted bool
+}
+
+func (race *hedgeRace) start(serverpool *ServerPool, peer *backend.Backend, request *http.Request) *hedgeAttempt {
+    ctx, cancel := context.WithCancelCause(request.Context())
+    attempt := &hedgeAttempt{race: race, cancel: cancel, header: make(http.Header)}
+
+    race.mux.Lock()
+    race.attempts = append(race.attempts, attempt)
+    race.mux.Unlock()
+
+    proxy := *peer.ReverseProxy
+    errorHandler := proxy.ErrorHandler
+    proxy.ErrorHandler = func(writer http.ResponseWriter, request *http.Request, err error) {
+        if errors.Is(err, context.Canceled) && !attempt.won {
+            return
+        }
+        if errorHandler != nil {
+            errorHandler(writer, request, err)
+            return
+        }
+        log.Printf("http: proxy error: %v\n", err)
+        writer.WriteHeader(http.StatusBadGateway)
+    }
+
+    race.wg.Add(1)
+    go func() {
+        defer race.wg.Done()
+        defer cancel(nil)
+        // ReverseProxy aborts a response it cannot finish copying by
+        // panicking, which would kill the process outside the handler's
+        // goroutine.
+        defer func() {
+            if recovered := recover(); recovered != nil {
+                if recovered != http.ErrAbortHandler {
+                    panic(recovered)
+                }
+                attempt.aborted = true
+            }
+        }()
+        serverpool.forward(peer, &proxy, attempt, request.WithContext(ctx))
+    }()
+    return attempt
+}
+
+func (race *hedgeRace) claim(attempt *hedgeAttempt) bool {
+    race.mux.Lock()
+    defer race.mux.Unlock()
+
+    if race.winner == nil {
+        race.winner = attempt
+        attempt.won = true
+        close(race.decided)
+        for _, other := range race.attempts {
+            if other != attempt {
+                other.cancel(errHedgeLost)
+            }
+        }
+    }
+    return attempt.won
+}
+
+func (attempt *hedgeAttempt) Header() http.Header {
+    if attempt.won {
+        return attempt.race.writer.Header()
+    }
+    return attempt.header
+}
+
+func (attempt *hedgeAttempt) WriteHeader(status int) {
+    if !attempt.won && !attempt.race.claim(attempt) {
+        return
+    }
+    header := attempt.race.writer.Header()
+    for name, values := range attempt.header {
+        header[name] = values
+    }
+    attempt.header = nil
+    attempt.race.writer.WriteHeader(status)
+}
+
+func (attempt *hedgeAttempt) Write(p []byte) (int, error) {
+    if !attempt.won {
+        attempt.WriteHeader(http.StatusOK)
+        if !attempt.won {
+            return 0, context.Canceled
+        }
+    }
+    return attempt.race.writer.Write(p)
+}
+
+func (attempt *hedgeAttempt) Flush() {
+    if attempt.won {
+        http.NewResponseController(attempt.race.writer).Flush()
+    }
+}
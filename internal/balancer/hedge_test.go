@@ -0,0 +1,202 @@
+package balancer
+
+import (
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+func newHedgePool(t *testing.T, handlers ...http.HandlerFunc) *ServerPool {
+    t.Helper()
+
+    pool := NewServerPool()
+    for _, handler := range handlers {
+        server := httptest.NewServer(handler)
+        t.Cleanup(server.Close)
+        serverURL, _ := url.Parse(server.URL)
+        pool.AddBackend(&backend.Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)})
+    }
+    return pool
+}
+
+func TestServerPool_Hedging(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    cancelled := make(chan time.Duration, 10)
+    slow := func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        select {
+        case <-time.After(time.Second):
+            w.Write([]byte("slow"))
+        case <-r.Context().Done():
+            cancelled <- time.Since(start)
+        }
+    }
+    fast := func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("X-Backend", "fast")
+        w.Write([]byte("fast"))
+    }
+
+    tests := []struct {
+        name         string
+        first        http.HandlerFunc
+        burst        float64
+        requests     int
+        expectedBody string
+        won          float64
+        lost         float64
+        denied       float64
+    }{
+        {name: "hedge wins over slow backend", first: slow, burst: 10, requests: 1, expectedBody: "fast", won: 1},
+        {name: "fast primary is not hedged", first: fast, burst: 10, requests: 1, expectedBody: "fast"},
+        {name: "exhausted budget denies hedge", first: slow, burst: 1, requests: 2, expectedBody: "slow", won: 1, denied: 1},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pool := newHedgePool(t, tt.first, fast)
+            registry := metrics.NewRegistry()
+            pool.SetHedging(HedgeConfig{Name: "api", Delay: 20 * time.Millisecond, BudgetRatio: 0.001, BudgetBurst: tt.burst, Registry: registry})
+
+            var rr *httptest.ResponseRecorder
+            for i := 0; i < tt.requests; i++ {
+                pool.current.Store(uint64(len(pool.backends) - 1))
+                rr = httptest.NewRecorder()
+                pool.LoadBalancerHandler(rr, httptest.NewRequest("GET", "/", nil))
+            }
+
+            if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != tt.expectedBody {
+                t.Errorf("Expected 200 %q, got %d %q", tt.expectedBody, rr.Code, rr.Body.String())
+            }
+            if tt.expectedBody == "fast" && rr.Header().Get("X-Backend") != "fast" {
+                t.Errorf("Expected winner's headers, got %v", rr.Header())
+            }
+
+            hedge := pool.hedge.Load()
+            if hedge.won.Value() != tt.won || hedge.lost.Value() != tt.lost || hedge.denied.Value() != tt.denied {
+                t.Errorf("Expected won=%v lost=%v denied=%v, got won=%v lost=%v denied=%v",
+                    tt.won, tt.lost, tt.denied, hedge.won.Value(), hedge.lost.Value(), hedge.denied.Value())
+            }
+        })
+    }
+
+    select {
+    case elapsed := <-cancelled:
+        if elapsed > 500*time.Millisecond {
+            t.Errorf("Expected losing request to be cancelled promptly, took %s", elapsed)
+        }
+    default:
+        t.Error("Expected the losing upstream request to be cancelled")
+    }
+}
+
+func TestServerPool_HedgedStreamAbortedByClient(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    stopped := make(chan struct{}, 1)
+    slow := func(w http.ResponseWriter, r *http.Request) {
+        <-r.Context().Done()
+    }
+    streaming := func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/short" {
+            w.Write([]byte("done"))
+            return
+        }
+        for {
+            if _, err := w.Write([]byte("chunk\n")); err != nil {
+                break
+            }
+            w.(http.Flusher).Flush()
+            select {
+            case <-r.Context().Done():
+                stopped <- struct{}{}
+                return
+            case <-time.After(10 * time.Millisecond):
+            }
+        }
+        stopped <- struct{}{}
+    }
+    pool := newHedgePool(t, slow, streaming)
+    pool.SetHedging(HedgeConfig{Name: "api", Delay: 20 * time.Millisecond, BudgetBurst: 10, Registry: metrics.NewRegistry()})
+    front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        pool.current.Store(uint64(len(pool.backends) - 1))
+        pool.LoadBalancerHandler(w, r)
+    }))
+    defer front.Close()
+
+    response, err := http.Get(front.URL + "/stream")
+    if err != nil {
+        t.Fatalf("GET /stream: %v", err)
+    }
+    buffer := make([]byte, 6)
+    if _, err := io.ReadFull(response.Body, buffer); err != nil {
+        t.Fatalf("Expected a first chunk from the hedged backend: %v", err)
+    }
+    response.Body.Close()
+
+    select {
+    case <-stopped:
+    case <-time.After(5 * time.Second):
+        t.Fatal("Expected the stream to end once the client went away")
+    }
+
+    // Had the aborted copy panicked outside the handler, the test binary
+    // would have died before getting here.
+    response, err = http.Get(front.URL + "/short")
+    if err != nil {
+        t.Fatalf("GET /short: %v", err)
+    }
+    body, _ := io.ReadAll(response.Body)
+    response.Body.Close()
+    if string(body) != "done" {
+        t.Errorf("Expected the balancer to keep serving, got %q", body)
+    }
+}
+
+func TestServerPool_IncompatibleFeatures(t *testing.T) {
+    hedging := func(pool *ServerPool) error { return pool.SetHedging(HedgeConfig{Registry: metrics.NewRegistry()}) }
+    hooks := func(pool *ServerPool) error { return pool.SetHooks(Hooks{}) }
+    retry := func(pool *ServerPool) error { return pool.SetRetryAfter(RetryAfterConfig{Retry: true}) }
+    eject := func(pool *ServerPool) error { return pool.SetRetryAfter(RetryAfterConfig{Eject: true}) }
+
+    tests := []struct {
+        name   string
+        first  func(pool *ServerPool) error
+        second func(pool *ServerPool) error
+        err    bool
+    }{
+        {name: "hooks after hedging", first: hedging, second: hooks, err: true},
+        {name: "hedging after hooks", first: hooks, second: hedging, err: true},
+        {name: "retry after hedging", first: hedging, second: retry, err: true},
+        {name: "hedging after retry", first: retry, second: hedging, err: true},
+        {name: "ejection after hedging", first: hedging, second: eject, err: true},
+        {name: "retry after hooks", first: hooks, second: retry, err: true},
+        {name: "hooks after retry", first: retry, second: hooks, err: true},
+        {name: "ejection with hooks", first: hooks, second: eject},
+        {name: "hooks with ejection", first: eject, second: hooks},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pool := NewServerPool()
+            if err := tt.first(pool); err != nil {
+                t.Fatalf("first setter error: %v", err)
+            }
+            if err := tt.second(pool); (err != nil) != tt.err {
+                t.Errorf("second setter error = %v, expected error %v", err, tt.err)
+            }
+        })
+    }
+}
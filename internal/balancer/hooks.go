@@ -0,0 +1,100 @@
+package balancer
+
+import (
+    "errors"
+    "net/http"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+type HookEvent struct {
+    Request   *http.Request
+    Backend   *backend.Backend
+    Start     time.Time
+    Selection time.Duration
+    Elapsed   time.Duration
+    Response  *http.Response
+    Err       error
+}
+
+type Hooks struct {
+    OnSelect   func(event *HookEvent) error
+    OnRequest  func(event *HookEvent) error
+    OnResponse func(event *HookEvent) error
+    OnError    func(event *HookEvent)
+}
+
+// SetHooks runs hooks around every request the pool serves. Hooks cannot be
+// combined with hedging or Retry-After retries, which send more than one
+// upstream request; SetHooks returns an error when either is configured.
+func (serverpool *ServerPool) SetHooks(hooks Hooks) error {
+    if serverpool.hedge.Load() != nil {
+        return errors.New("balancer: hooks cannot be combined with hedging")
+    }
+    if config := serverpool.retry.Load(); config != nil && config.Retry {
+        return errors.New("balancer: hooks cannot be combined with Retry-After retries")
+    }
+    serverpool.hooks.Store(&hooks)
+    return nil
+}
+
+func (serverpool *ServerPool) serveWithHooks(hooks *Hooks, writer http.ResponseWriter, request *http.Request) {
+    event := &HookEvent{Request: request, Start: time.Now()}
+
+    notify := func(err error) {
+        event.Err = err
+        event.Elapsed = time.Since(event.Start)
+        if hooks.OnError != nil {
+            hooks.OnError(event)
+        }
+    }
+    fail := func(writer http.ResponseWriter, err error, status int) {
+        notify(err)
+        serveError(writer, http.StatusText(status), status)
+    }
+
+    peer, err := serverpool.pick(request, nil)
+    event.Backend = peer
+    event.Selection = time.Since(event.Start)
+    if err != nil {
+        notify(err)
+        serverpool.writeError(writer, err)
+        return
+    }
+
+    if hooks.OnSelect != nil {
+        if err := hooks.OnSelect(event); err != nil {
+            fail(writer, err, http.StatusServiceUnavailable)
+            return
+        }
+    }
+    if hooks.OnRequest != nil {
+        if err := hooks.OnRequest(event); err != nil {
+            fail(writer, err, http.StatusForbidden)
+            return
+        }
+    }
+
+    proxy := *peer.ReverseProxy
+    modifyResponse := proxy.ModifyResponse
+    proxy.ModifyResponse = func(response *http.Response) error {
+        if modifyResponse != nil {
+            if err := modifyResponse(response); err != nil {
+                return err
+            }
+        }
+        serverpool.observeRetryAfter(peer, response)
+        event.Response = response
+        event.Elapsed = time.Since(event.Start)
+        if hooks.OnResponse != nil {
+            return hooks.OnResponse(event)
+        }
+        return nil
+    }
+    proxy.ErrorHandler = func(writer http.ResponseWriter, request *http.Request, err error) {
+        fail(writer, err, http.StatusBadGateway)
+    }
+
+    serverpool.forward(peer, &proxy, writer, event.Request)
+}
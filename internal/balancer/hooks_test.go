@@ -0,0 +1,166 @@
+package balancer
+
+import (
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "testing"
+
+    "load-balancer/internal/backend"
+)
+
+func TestServerPool_Hooks(t *testing.T) {
+    backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("X-Seen-Tenant", r.Header.Get("X-Tenant"))
+        w.WriteHeader(http.StatusTeapot)
+    }))
+    defer backendServer.Close()
+
+    backendURL, _ := url.Parse(backendServer.URL)
+    testBackend := &backend.Backend{
+        URL:          backendURL,
+        Alive:        true,
+        ReverseProxy: httputil.NewSingleHostReverseProxy(backendURL),
+    }
+    pool := NewServerPool()
+    pool.AddBackend(testBackend)
+
+    var calls []string
+    var responseEvent *HookEvent
+    pool.SetHooks(Hooks{
+        OnSelect: func(event *HookEvent) error {
+            calls = append(calls, "select")
+            if event.Backend != testBackend {
+                t.Error("OnSelect should receive the chosen backend")
+            }
+            return nil
+        },
+        OnRequest: func(event *HookEvent) error {
+            calls = append(calls, "request")
+            event.Request.Header.Set("X-Tenant", "acme")
+            return nil
+        },
+        OnResponse: func(event *HookEvent) error {
+            calls = append(calls, "response")
+            responseEvent = event
+            return nil
+        },
+        OnError: func(event *HookEvent) {
+            calls = append(calls, "error")
+        },
+    })
+
+    rr := httptest.NewRecorder()
+    pool.LoadBalancerHandler(rr, httptest.NewRequest("GET", "/", nil))
+
+    if rr.Code != http.StatusTeapot {
+        t.Errorf("Expected status 418, got %d", rr.Code)
+    }
+    if rr.Header().Get("X-Seen-Tenant") != "acme" {
+        t.Error("OnRequest mutation should reach the backend")
+    }
+    expected := []string{"select", "request", "response"}
+    if len(calls) != len(expected) {
+        t.Fatalf("Expected hook calls %v, got %v", expected, calls)
+    }
+    for i := range expected {
+        if calls[i] != expected[i] {
+            t.Errorf("Expected hook calls %v, got %v", expected, calls)
+            break
+        }
+    }
+    if responseEvent.Response == nil || responseEvent.Response.StatusCode != http.StatusTeapot {
+        t.Error("OnResponse should receive the upstream response")
+    }
+    if responseEvent.Elapsed < responseEvent.Selection {
+        t.Error("Elapsed should include selection time")
+    }
+}
+
+func TestServerPool_HooksVetoAndErrors(t *testing.T) {
+    veto := errors.New("veto")
+
+    tests := []struct {
+        name         string
+        alive        bool
+        hooks        func(got *error) Hooks
+        expectedCode int
+        expectedErr  error
+    }{
+        {
+            name:  "select veto",
+            alive: true,
+            hooks: func(got *error) Hooks {
+                return Hooks{
+                    OnSelect: func(event *HookEvent) error { return veto },
+                    OnError:  func(event *HookEvent) { *got = event.Err },
+                }
+            },
+            expectedCode: http.StatusServiceUnavailable,
+            expectedErr:  veto,
+        },
+        {
+            name:  "request veto",
+            alive: true,
+            hooks: func(got *error) Hooks {
+                return Hooks{
+                    OnRequest: func(event *HookEvent) error { return veto },
+                    OnError:   func(event *HookEvent) { *got = event.Err },
+                }
+            },
+            expectedCode: http.StatusForbidden,
+            expectedErr:  veto,
+        },
+        {
+            name:  "response veto",
+            alive: true,
+            hooks: func(got *error) Hooks {
+                return Hooks{
+                    OnResponse: func(event *HookEvent) error { return veto },
+                    OnError:    func(event *HookEvent) { *got = event.Err },
+                }
+            },
+            expectedCode: http.StatusBadGateway,
+            expectedErr:  veto,
+        },
+        {
+            name:  "no alive backend",
+            alive: false,
+            hooks: func(got *error) Hooks {
+                return Hooks{OnError: func(event *HookEvent) { *got = event.Err }}
+            },
+            expectedCode: http.StatusServiceUnavailable,
+            expectedErr:  ErrNoHealthyBackend,
+        },
+    }
+
+    backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    defer backendServer.Close()
+    backendURL, _ := url.Parse(backendServer.URL)
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pool := NewServerPool()
+            pool.AddBackend(&backend.Backend{
+                URL:          backendURL,
+                Alive:        tt.alive,
+                ReverseProxy: httputil.NewSingleHostReverseProxy(backendURL),
+            })
+
+            var got error
+            pool.SetHooks(tt.hooks(&got))
+
+            rr := httptest.NewRecorder()
+            pool.LoadBalancerHandler(rr, httptest.NewRequest("GET", "/", nil))
+
+            if rr.Code != tt.expectedCode {
+                t.Errorf("Expected status %d, got %d", tt.expectedCode, rr.Code)
+            }
+            if !errors.Is(got, tt.expectedErr) {
+                t.Errorf("OnError received %v, expected %v", got, tt.expectedErr)
+            }
+        })
+    }
+}
@@ -0,0 +1,153 @@
+package balancer
+
+import (
+    "fmt"
+    "math"
+    "math/rand"
+    "net/http"
+    "net/http/httputil"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+// ResponseObserver is implemented by strategies that learn from what
+// backends put in their responses. ObserveResponse sees each response
+// before it is sent on and may change its headers.
+type ResponseObserver interface {
+    ObserveResponse(peer *backend.Backend, response *http.Response)
+}
+
+// reportedLoad spreads requests by the load backends report about
+// themselves in the header param (default X-Backend-Load), as a fraction
+// ("0.7") or a percentage ("70%"). Each backend gets traffic in proportion
+// to its weight times its spare capacity, 1 less its load, so a backend at
+// 90% gets a fifth of what one at 50% does; a fully loaded one still gets
+// a trickle, so it can report when it recovers. A report fades towards no
+// load with the decay param as its time constant (default 10s), so a
+// backend that stops answering with the header is not avoided for good.
+// The header is taken off the response before it reaches the client.
+type reportedLoad struct {
+    header string
+    decay  time.Duration
+
+    mux   sync.Mutex
+    loads map[*backend.Backend]*latencyAverage
+}
+
+// minSpare is the share of a fully loaded backend's traffic it keeps.
+const minSpare = 0.02
+
+func newReportedLoad(params map[string]string) (Strategy, error) {
+    header := params["header"]
+    if header == "" {
+        header = "X-Backend-Load"
+    }
+    decay := 10 * time.Second
+    if value := params["decay"]; value != "" {
+        parsed, err := time.ParseDuration(value)
+        if err != nil || parsed <= 0 {
+            return nil, fmt.Errorf("invalid decay %q", value)
+        }
+        decay = parsed
+    }
+    return &reportedLoad{header: http.CanonicalHeaderKey(header), decay: decay, loads: make(map[*backend.Backend]*latencyAverage)}, nil
+}
+
+func (strategy *reportedLoad) ObserveResponse(peer *backend.Backend, response *http.Response) {
+    value := response.Header.Get(strategy.header)
+    response.Header.Del(strategy.header)
+    load, ok := parseLoad(value)
+    if !ok {
+        return
+    }
+
+    strategy.mux.Lock()
+    strategy.loads[peer] = &latencyAverage{value: load, updated: time.Now()}
+    strategy.mux.Unlock()
+}
+
+// SetMembers forgets the reports of backends that have left the pool.
+func (strategy *reportedLoad) SetMembers(backends []*backend.Backend) {
+    strategy.mux.Lock()
+    forget(strategy.loads, backends)
+    strategy.mux.Unlock()
+}
+
+// load is peer's last report, faded by its age.
+func (strategy *reportedLoad) load(peer *backend.Backend, now time.Time) float64 {
+    report, ok := strategy.loads[peer]
+    if !ok {
+        return 0
+    }
+    return report.value * math.Exp(-float64(now.Sub(report.updated))/float64(strategy.decay))
+}
+
+func (strategy *reportedLoad) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    if len(candidates) == 0 {
+        return nil
+    }
+    now := time.Now()
+    shares := make([]float64, len(candidates))
+    total := 0.0
+
+    strategy.mux.Lock()
+    for i, peer := range candidates {
+        weight, _ := peer.Weight(now)
+        if weight <= 0 {
+            continue
+        }
+        shares[i] = weight * math.Max(1-strategy.load(peer, now), minSpare)
+        total += shares[i]
+    }
+    strategy.mux.Unlock()
+
+    if total == 0 {
+        return nil
+    }
+    point := rand.Float64() * total
+    for i, share := range shares {
+        if point < share {
+            return candidates[i]
+        }
+        point -= share
+    }
+    for i := len(candidates) - 1; i >= 0; i-- {
+        if shares[i] > 0 {
+            return candidates[i]
+        }
+    }
+    return nil
+}
+
+// parseLoad reads a load report, clamped to [0, 1].
+func parseLoad(value string) (float64, bool) {
+    value = strings.TrimSpace(value)
+    scale := 1.0
+    if strings.HasSuffix(value, "%") {
+        value, scale = strings.TrimSpace(strings.TrimSuffix(value, "%")), 100
+    }
+    load, err := strconv.ParseFloat(value, 64)
+    if err != nil || math.IsNaN(load) {
+        return 0, false
+    }
+    return math.Min(math.Max(load/scale, 0), 1), true
+}
+
+// observeResponses returns a copy of proxy that shows peer's responses to
+// observer.
+func observeResponses(observer ResponseObserver, peer *backend.Backend, proxy *httputil.ReverseProxy) *httputil.ReverseProxy {
+    observed := *proxy
+    modifyResponse := proxy.ModifyResponse
+    observed.ModifyResponse = func(response *http.Response) error {
+        observer.ObserveResponse(peer, response)
+        if modifyResponse != nil {
+            return modifyResponse(response)
+        }
+        return nil
+    }
+    return &observed
+}
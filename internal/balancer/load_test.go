@@ -0,0 +1,99 @@
+package balancer
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+func TestParseLoad(t *testing.T) {
+    tests := []struct {
+        value    string
+        expected float64
+        ok       bool
+    }{
+        {value: "0.7", expected: 0.7, ok: true},
+        {value: "70%", expected: 0.7, ok: true},
+        {value: " 25 % ", expected: 0.25, ok: true},
+        {value: "1.5", expected: 1, ok: true},
+        {value: "-3", expected: 0, ok: true},
+        {value: "", ok: false},
+        {value: "busy", ok: false},
+        {value: "NaN", ok: false},
+    }
+
+    for _, tt := range tests {
+        load, ok := parseLoad(tt.value)
+        if ok != tt.ok || (ok && (load < tt.expected-1e-9 || load > tt.expected+1e-9)) {
+            t.Errorf("parseLoad(%q) = %v, %v; expected %v, %v", tt.value, load, ok, tt.expected, tt.ok)
+        }
+    }
+}
+
+func TestReportedLoad_Pick(t *testing.T) {
+    backends := newStrategyBackends("busy:80", "half:80", "idle:80")
+    strategy, _ := NewStrategy(StrategyConfig{Name: "reported_load", Params: map[string]string{"decay": "1h"}})
+    observer := strategy.(ResponseObserver)
+    for i, load := range []string{"90%", "0.5"} {
+        response := &http.Response{Header: http.Header{"X-Backend-Load": []string{load}}}
+        observer.ObserveResponse(backends[i], response)
+        if response.Header.Get("X-Backend-Load") != "" {
+            t.Error("Expected the load header taken off the response")
+        }
+    }
+
+    counts := make(map[*backend.Backend]int)
+    for i := 0; i < 16000; i++ {
+        counts[strategy.Pick(nil, backends)]++
+    }
+    // Spare capacity 0.1 : 0.5 : 1 of 16000 picks.
+    for i, expected := range []int{1000, 5000, 10000} {
+        if got := counts[backends[i]]; got < expected*8/10 || got > expected*12/10 {
+            t.Errorf("Expected about %d picks of %s, got %d", expected, backends[i].URL.Host, got)
+        }
+    }
+}
+
+func TestReportedLoad_Decay(t *testing.T) {
+    backends := newStrategyBackends("a:80", "b:80")
+    strategy, _ := NewStrategy(StrategyConfig{Name: "reported_load", Params: map[string]string{"decay": "10s"}})
+    loaded := strategy.(*reportedLoad)
+    loaded.loads[backends[0]] = &latencyAverage{value: 1, updated: time.Now().Add(-time.Minute)}
+
+    if load := loaded.load(backends[0], time.Now()); load > 0.01 {
+        t.Errorf("Expected a minute-old report to have faded, got load %v", load)
+    }
+    if load := loaded.load(backends[1], time.Now()); load != 0 {
+        t.Errorf("Expected no load for a backend without reports, got %v", load)
+    }
+}
+
+func TestServerPool_ReportedLoad(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("X-Backend-Load", "100%")
+    }))
+    defer server.Close()
+    serverURL, _ := url.Parse(server.URL)
+    peer := &backend.Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)}
+
+    pool := NewServerPool()
+    pool.AddBackend(peer)
+    if err := pool.UseStrategy(StrategyConfig{Name: "reported_load"}); err != nil {
+        t.Fatalf("UseStrategy() error: %v", err)
+    }
+
+    rr := httptest.NewRecorder()
+    pool.LoadBalancerHandler(rr, httptest.NewRequest("GET", "/", nil))
+    if rr.Header().Get("X-Backend-Load") != "" {
+        t.Error("Expected the load header kept from the client")
+    }
+    strategy := *pool.strategy.Load()
+    if load := strategy.(*reportedLoad).load(peer, time.Now()); load < 0.99 {
+        t.Errorf("Expected the backend's report recorded, got load %v", load)
+    }
+}
@@ -0,0 +1,38 @@
+package balancer
+
+import (
+    "net/http"
+    "slices"
+    "strings"
+)
+
+// allowMethods answers 405 for requests whose method is not in methods,
+// listing them in the Allow header, so junk methods never reach a backend.
+// Methods are matched case-sensitively as HTTP requires; HEAD is allowed
+// wherever GET is.
+func allowMethods(methods []string) func(next http.Handler) http.Handler {
+    var allowed []string
+    add := func(method string) {
+        if !slices.Contains(allowed, method) {
+            allowed = append(allowed, method)
+        }
+    }
+    for _, method := range methods {
+        add(method)
+        if method == http.MethodGet {
+            add(http.MethodHead)
+        }
+    }
+    allow := strings.Join(allowed, ", ")
+
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+            if !slices.Contains(allowed, request.Method) {
+                writer.Header().Set("Allow", allow)
+                serveError(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+                return
+            }
+            next.ServeHTTP(writer, request)
+        })
+    }
+}
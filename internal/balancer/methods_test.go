@@ -0,0 +1,45 @@
+package balancer
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestRouter_AllowedMethods(t *testing.T) {
+    app, closeApp := newTestPool(t, "app")
+    defer closeApp()
+
+    router := NewRouter("app")
+    router.AddPool("app", app)
+    router.AddRoute(Route{Name: "api", PathPrefix: "/api", Pool: "app", Methods: []string{"GET", "POST"}})
+
+    tests := []struct {
+        name           string
+        method         string
+        path           string
+        expectedStatus int
+        expectedAllow  string
+    }{
+        {name: "allowed method", method: "POST", path: "/api/items", expectedStatus: http.StatusOK},
+        {name: "head allowed with get", method: "HEAD", path: "/api/items", expectedStatus: http.StatusOK},
+        {name: "other method", method: "DELETE", path: "/api/items", expectedStatus: http.StatusMethodNotAllowed, expectedAllow: "GET, HEAD, POST"},
+        {name: "junk method", method: "FOO", path: "/api/items", expectedStatus: http.StatusMethodNotAllowed, expectedAllow: "GET, HEAD, POST"},
+        {name: "methods are case sensitive", method: "get", path: "/api/items", expectedStatus: http.StatusMethodNotAllowed, expectedAllow: "GET, HEAD, POST"},
+        {name: "routes without methods allow all", method: "DELETE", path: "/other", expectedStatus: http.StatusOK},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rr := httptest.NewRecorder()
+            router.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+            if rr.Code != tt.expectedStatus {
+                t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+            }
+            if allow := rr.Header().Get("Allow"); allow != tt.expectedAllow {
+                t.Errorf("Expected Allow %q, got %q", tt.expectedAllow, allow)
+            }
+        })
+    }
+}
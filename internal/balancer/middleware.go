@@ -0,0 +1,134 @@
+package balancer
+
+import (
+    "fmt"
+    "net/http"
+    "sort"
+    "sync"
+)
+
+type Stage int
+
+const (
+    StageEdge      Stage = 100
+    StageSecurity  Stage = 200
+    StageTraffic   Stage = 300
+    StageTransform Stage = 400
+    StageRouting   Stage = 500
+)
+
+type Middleware struct {
+    Name    string
+    Stage   Stage
+    Handler func(next http.Handler) http.Handler
+}
+
+type Pipeline struct {
+    mux         sync.RWMutex
+    middlewares []Middleware
+    handler     http.Handler
+    chain       http.Handler
+}
+
+func NewPipeline(handler http.Handler) *Pipeline {
+    return &Pipeline{
+        handler: handler,
+        chain:   handler,
+    }
+}
+
+func (pipeline *Pipeline) Use(middlewares ...Middleware) {
+    pipeline.mux.Lock()
+    defer pipeline.mux.Unlock()
+
+    for _, middleware := range middlewares {
+        if idx := pipeline.indexOf(middleware.Name); idx >= 0 {
+            pipeline.middlewares[idx] = middleware
+            continue
+        }
+        pipeline.middlewares = append(pipeline.middlewares, middleware)
+    }
+    pipeline.rebuild()
+}
+
+func (pipeline *Pipeline) Before(name string, middleware Middleware) error {
+    return pipeline.insertRelative(name, middleware, 0)
+}
+
+func (pipeline *Pipeline) After(name string, middleware Middleware) error {
+    return pipeline.insertRelative(name, middleware, 1)
+}
+
+func (pipeline *Pipeline) Remove(name string) bool {
+    pipeline.mux.Lock()
+    defer pipeline.mux.Unlock()
+
+    idx := pipeline.indexOf(name)
+    if idx < 0 {
+        return false
+    }
+    pipeline.middlewares = append(pipeline.middlewares[:idx], pipeline.middlewares[idx+1:]...)
+    pipeline.rebuild()
+    return true
+}
+
+func (pipeline *Pipeline) Names() []string {
+    pipeline.mux.RLock()
+    defer pipeline.mux.RUnlock()
+
+    names := make([]string, len(pipeline.middlewares))
+    for i, middleware := range pipeline.middlewares {
+        names[i] = middleware.Name
+    }
+    return names
+}
+
+func (pipeline *Pipeline) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+    pipeline.mux.RLock()
+    chain := pipeline.chain
+    pipeline.mux.RUnlock()
+
+    chain.ServeHTTP(writer, request)
+}
+
+func (pipeline *Pipeline) insertRelative(name string, middleware Middleware, offset int) error {
+    pipeline.mux.Lock()
+    defer pipeline.mux.Unlock()
+
+    if pipeline.indexOf(middleware.Name) >= 0 {
+        return fmt.Errorf("middleware %q already registered", middleware.Name)
+    }
+    idx := pipeline.indexOf(name)
+    if idx < 0 {
+        return fmt.Errorf("middleware %q not found", name)
+    }
+
+    middleware.Stage = pipeline.middlewares[idx].Stage
+    idx += offset
+    pipeline.middlewares = append(pipeline.middlewares, Middleware{})
+    copy(pipeline.middlewares[idx+1:], pipeline.middlewares[idx:])
+    pipeline.middlewares[idx] = middleware
+    pipeline.rebuild()
+    return nil
+}
+
+func (pipeline *Pipeline) indexOf(name string) int {
+    for i, middleware := range pipeline.middlewares {
+        if middleware.Name == name {
+            return i
+        }
+    }
+    return -1
+}
+
+func (pipeline *Pipeline) rebuild() {
+    sort.SliceStable(pipeline.middlewares, func(i, j int) bool {
+        return pipeline.middlewares[i].Stage < pipeline.middlewares[j].Stage
+    })
+
+    chain := pipeline.handler
+    for i := len(pipeline.middlewares) - 1; i >= 0; i-- {
+        chain = pipeline.middlewares[i].Handler(chain)
+    }
+    pipeline.chain = chain
+}
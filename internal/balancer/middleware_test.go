@@ -0,0 +1,155 @@
+package balancer
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func recordingMiddleware(name string, stage Stage, trace *[]string) Middleware {
+    return Middleware{
+        Name:  name,
+        Stage: stage,
+        Handler: func(next http.Handler) http.Handler {
+            return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                *trace = append(*trace, name)
+                next.ServeHTTP(w, r)
+            })
+        },
+    }
+}
+
+func TestPipeline_Ordering(t *testing.T) {
+    var trace []string
+    final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        trace = append(trace, "handler")
+    })
+
+    pipeline := NewPipeline(final)
+    pipeline.Use(
+        recordingMiddleware("ratelimit", StageTraffic, &trace),
+        recordingMiddleware("logging", StageEdge, &trace),
+        recordingMiddleware("auth", StageSecurity, &trace),
+        recordingMiddleware("user", StageSecurity, &trace),
+    )
+
+    pipeline.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+    expected := []string{"logging", "auth", "user", "ratelimit", "handler"}
+    if !reflect.DeepEqual(trace, expected) {
+        t.Errorf("Expected order %v, got %v", expected, trace)
+    }
+    if !reflect.DeepEqual(pipeline.Names(), expected[:4]) {
+        t.Errorf("Names() = %v, expected %v", pipeline.Names(), expected[:4])
+    }
+}
+
+func TestPipeline_BeforeAfter(t *testing.T) {
+    var trace []string
+    pipeline := NewPipeline(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    pipeline.Use(
+        recordingMiddleware("logging", StageEdge, &trace),
+        recordingMiddleware("auth", StageSecurity, &trace),
+    )
+
+    if err := pipeline.Before("auth", recordingMiddleware("cors", StageRouting, &trace)); err != nil {
+        t.Fatalf("Before() error: %v", err)
+    }
+    if err := pipeline.After("auth", recordingMiddleware("audit", StageEdge, &trace)); err != nil {
+        t.Fatalf("After() error: %v", err)
+    }
+
+    expected := []string{"logging", "cors", "auth", "audit"}
+    if !reflect.DeepEqual(pipeline.Names(), expected) {
+        t.Errorf("Names() = %v, expected %v", pipeline.Names(), expected)
+    }
+
+    pipeline.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+    if !reflect.DeepEqual(trace, expected) {
+        t.Errorf("Expected execution order %v, got %v", expected, trace)
+    }
+
+    tests := []struct {
+        name   string
+        err    error
+        errMsg string
+    }{
+        {
+            name:   "unknown anchor",
+            err:    pipeline.Before("missing", recordingMiddleware("x", StageEdge, &trace)),
+            errMsg: "not found",
+        },
+        {
+            name:   "duplicate name",
+            err:    pipeline.After("auth", recordingMiddleware("logging", StageEdge, &trace)),
+            errMsg: "already registered",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if tt.err == nil || !strings.Contains(tt.err.Error(), tt.errMsg) {
+                t.Errorf("Expected error containing %q, got %v", tt.errMsg, tt.err)
+            }
+        })
+    }
+}
+
+func TestPipeline_UseReplacesAndRemove(t *testing.T) {
+    var trace []string
+    pipeline := NewPipeline(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    pipeline.Use(recordingMiddleware("auth", StageSecurity, &trace))
+    pipeline.Use(recordingMiddleware("auth", StageSecurity, &trace))
+
+    if len(pipeline.Names()) != 1 {
+        t.Errorf("Expected Use() to replace same-named middleware, got %v", pipeline.Names())
+    }
+
+    if !pipeline.Remove("auth") {
+        t.Error("Remove() should report true for registered middleware")
+    }
+    if pipeline.Remove("auth") {
+        t.Error("Remove() should report false for unknown middleware")
+    }
+
+    pipeline.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+    if len(trace) != 0 {
+        t.Errorf("Expected no middleware to run, got %v", trace)
+    }
+}
+
+func TestPipeline_WrapsLoadBalancerHandler(t *testing.T) {
+    pool, closePool := newTestPool(t, "ok")
+    defer closePool()
+
+    pipeline := NewPipeline(http.HandlerFunc(pool.LoadBalancerHandler))
+    pipeline.Use(Middleware{
+        Name:  "block",
+        Stage: StageSecurity,
+        Handler: func(next http.Handler) http.Handler {
+            return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                if r.Header.Get("X-Block") != "" {
+                    http.Error(w, "blocked", http.StatusForbidden)
+                    return
+                }
+                next.ServeHTTP(w, r)
+            })
+        },
+    })
+
+    rr := httptest.NewRecorder()
+    pipeline.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+    if rr.Code != http.StatusOK || rr.Body.String() != "ok" {
+        t.Errorf("Expected proxied 200 ok, got %d %q", rr.Code, rr.Body.String())
+    }
+
+    req := httptest.NewRequest("GET", "/", nil)
+    req.Header.Set("X-Block", "1")
+    rr = httptest.NewRecorder()
+    pipeline.ServeHTTP(rr, req)
+    if rr.Code != http.StatusForbidden {
+        t.Errorf("Expected status 403, got %d", rr.Code)
+    }
+}
@@ -0,0 +1,134 @@
+package balancer
+
+import (
+    "encoding/json"
+    "net/http"
+    "sort"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/metrics"
+)
+
+// PoolStatus summarizes a pool's health. Statuses are ordered, so a route's
+// MinPoolStatus can be compared against the current one; the zero value,
+// Critical, makes no demand.
+type PoolStatus int
+
+const (
+    Critical PoolStatus = iota
+    Degraded
+    Healthy
+)
+
+func (status PoolStatus) String() string {
+    switch status {
+    case Healthy:
+        return "healthy"
+    case Degraded:
+        return "degraded"
+    }
+    return "critical"
+}
+
+func (status PoolStatus) MarshalJSON() ([]byte, error) {
+    return json.Marshal(status.String())
+}
+
+// HealthThresholds set the share of alive backends a pool needs to count as
+// Healthy (default 1, all of them) and Degraded (default 0.5). Below the
+// Degraded threshold, or with no backends at all, the pool is Critical.
+type HealthThresholds struct {
+    Healthy  float64
+    Degraded float64
+}
+
+func (serverpool *ServerPool) SetHealthThresholds(thresholds HealthThresholds) {
+    if thresholds.Healthy <= 0 {
+        thresholds.Healthy = 1
+    }
+    if thresholds.Degraded <= 0 {
+        thresholds.Degraded = 0.5
+    }
+    serverpool.thresholds.Store(&thresholds)
+}
+
+func (serverpool *ServerPool) Status() PoolStatus {
+    thresholds := serverpool.thresholds.Load()
+    if thresholds == nil {
+        thresholds = &HealthThresholds{Healthy: 1, Degraded: 0.5}
+    }
+    if len(serverpool.Backends()) == 0 {
+        return Critical
+    }
+    healthy := serverpool.healthyFraction()
+    switch {
+    case healthy >= thresholds.Healthy:
+        return Healthy
+    case healthy >= thresholds.Degraded:
+        return Degraded
+    }
+    return Critical
+}
+
+// exportHealth publishes the pool's status (0 critical, 1 degraded,
+// 2 healthy) and healthy fraction as gauges.
+func exportHealth(registry *metrics.Registry, name string, pool *ServerPool) {
+    registry.GaugeFunc("lb_pool_status", "Pool health: 0 critical, 1 degraded, 2 healthy.", func() float64 {
+        return float64(pool.Status())
+    }, "pool", name)
+    registry.GaugeFunc("lb_pool_healthy_fraction", "Share of the pool's backends that are alive.", func() float64 {
+        return pool.healthyFraction()
+    }, "pool", name)
+}
+
+type ReadinessReport struct {
+    Ready  bool                  `json:"ready"`
+    Pools  map[string]PoolStatus `json:"pools"`
+    Failed []string              `json:"failed,omitempty"`
+}
+
+// Readiness reports the status of every pool. The balancer is ready when
+// the default pool is not critical and each route's pool meets the route's
+// MinPoolStatus.
+func (router *Router) Readiness() ReadinessReport {
+    router.mux.RLock()
+    pools := make(map[string]*ServerPool, len(router.pools))
+    for name, pool := range router.pools {
+        pools[name] = pool
+    }
+    required := map[string]PoolStatus{router.defaultPool: Degraded}
+    for _, route := range router.routes {
+        name := route.Pool
+        if name == "" {
+            name = router.defaultPool
+        }
+        if route.MinPoolStatus > required[name] {
+            required[name] = route.MinPoolStatus
+        }
+    }
+    router.mux.RUnlock()
+
+    result := ReadinessReport{Ready: true, Pools: make(map[string]PoolStatus, len(pools))}
+    for name, pool := range pools {
+        result.Pools[name] = pool.Status()
+    }
+    for name, minimum := range required {
+        if status, ok := result.Pools[name]; !ok || status < minimum {
+            result.Ready = false
+            result.Failed = append(result.Failed, name)
+        }
+    }
+    sort.Strings(result.Failed)
+    return result
+}
+
+func (router *Router) registerReadiness(server *admin.Server) {
+    server.HandleFunc("GET /admin/ready", func(writer http.ResponseWriter, request *http.Request) {
+        result := router.Readiness()
+        status := http.StatusOK
+        if !result.Ready {
+            status = http.StatusServiceUnavailable
+        }
+        admin.WriteJSON(writer, status, result)
+    })
+}
@@ -0,0 +1,131 @@
+package balancer
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+func TestServerPool_Status(t *testing.T) {
+    pool, closeServer := newTestPool(t, "ok")
+    defer closeServer()
+    peer := pool.Backends()[0]
+    for i := 0; i < 3; i++ {
+        pool.AddBackend(&backend.Backend{URL: peer.URL, Alive: true, ReverseProxy: peer.ReverseProxy})
+    }
+
+    tests := []struct {
+        name       string
+        alive      int
+        thresholds *HealthThresholds
+        expected   PoolStatus
+    }{
+        {name: "all alive", alive: 4, expected: Healthy},
+        {name: "one down is degraded by default", alive: 3, expected: Degraded},
+        {name: "half alive is degraded", alive: 2, expected: Degraded},
+        {name: "below half is critical", alive: 1, expected: Critical},
+        {name: "custom healthy threshold", alive: 3, thresholds: &HealthThresholds{Healthy: 0.75, Degraded: 0.5}, expected: Healthy},
+        {name: "custom degraded threshold", alive: 1, thresholds: &HealthThresholds{Healthy: 0.75, Degraded: 0.25}, expected: Degraded},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pool.thresholds.Store(nil)
+            if tt.thresholds != nil {
+                pool.SetHealthThresholds(*tt.thresholds)
+            }
+            for i, peer := range pool.Backends() {
+                peer.SetAlive(i < tt.alive)
+            }
+            if status := pool.Status(); status != tt.expected {
+                t.Errorf("Expected %v, got %v", tt.expected, status)
+            }
+        })
+    }
+
+    if status := NewServerPool().Status(); status != Critical {
+        t.Errorf("Expected an empty pool to be critical, got %v", status)
+    }
+}
+
+func TestRouter_AddPoolExportsToRegistry(t *testing.T) {
+    registry := metrics.NewRegistry()
+    router := NewRouter("app")
+    router.SetRegistry(registry)
+    router.AddPool("app", NewServerPool())
+
+    var builder strings.Builder
+    registry.WriteText(&builder)
+    if !strings.Contains(builder.String(), `lb_pool_status{pool="app"} 0`) {
+        t.Errorf("Expected the pool status in the router's registry, got:\n%s", builder.String())
+    }
+}
+
+func TestRouter_MinPoolStatus(t *testing.T) {
+    web, closeWeb := newTestPool(t, "web")
+    defer closeWeb()
+    static, closeStatic := newTestPool(t, "static")
+    defer closeStatic()
+    peer := web.Backends()[0]
+    for i := 0; i < 3; i++ {
+        web.AddBackend(&backend.Backend{URL: peer.URL, Alive: true, ReverseProxy: peer.ReverseProxy})
+    }
+
+    router := NewRouter("web")
+    router.AddPool("web", web)
+    router.AddPool("static", static)
+    router.AddRoute(Route{Name: "strict", PathPrefix: "/strict", Pool: "web", MinPoolStatus: Healthy})
+    router.AddRoute(Route{Name: "fallback", PathPrefix: "/fallback", Pool: "web", MinPoolStatus: Healthy, Fallback: &Fallback{Pool: "static"}})
+    router.AddRoute(Route{Name: "lenient", Pool: "web"})
+    server := admin.NewServer(nil)
+    router.Register(server)
+
+    tests := []struct {
+        name          string
+        alive         int
+        path          string
+        expectedCode  int
+        expectedBody  string
+        expectedReady bool
+    }{
+        {name: "healthy pool serves strict route", alive: 4, path: "/strict", expectedCode: http.StatusOK, expectedBody: "web", expectedReady: true},
+        {name: "degraded pool rejects strict route", alive: 3, path: "/strict", expectedCode: http.StatusServiceUnavailable, expectedReady: false},
+        {name: "degraded pool uses fallback", alive: 3, path: "/fallback", expectedCode: http.StatusOK, expectedBody: "static", expectedReady: false},
+        {name: "degraded pool serves lenient route", alive: 3, path: "/other", expectedCode: http.StatusOK, expectedBody: "web", expectedReady: false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for i, peer := range web.Backends() {
+                peer.SetAlive(i < tt.alive)
+            }
+            rr := httptest.NewRecorder()
+            router.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+            if rr.Code != tt.expectedCode {
+                t.Errorf("Expected status %d, got %d", tt.expectedCode, rr.Code)
+            }
+            if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+                t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body.String())
+            }
+
+            rr = httptest.NewRecorder()
+            server.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/ready", nil))
+            var report struct {
+                Ready bool              `json:"ready"`
+                Pools map[string]string `json:"pools"`
+            }
+            if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+                t.Fatalf("decode readiness: %v", err)
+            }
+            if report.Ready != tt.expectedReady {
+                t.Errorf("Expected ready %v, got %v (%v)", tt.expectedReady, report.Ready, report.Pools)
+            }
+        })
+    }
+}
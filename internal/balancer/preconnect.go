@@ -0,0 +1,72 @@
+package balancer
+
+import (
+    "context"
+    "log"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+type PreconnectConfig struct {
+    MinIdle    int
+    MaxIdleAge time.Duration
+    Interval   time.Duration
+    Timeout    time.Duration
+}
+
+// Preconnect keeps MinIdle spare connections open to every alive backend
+// until ctx is cancelled. Connections to backends marked down are closed.
+func (serverpool *ServerPool) Preconnect(ctx context.Context, config PreconnectConfig) {
+    if config.Interval <= 0 {
+        config.Interval = 5 * time.Second
+    }
+    if config.MaxIdleAge <= 0 {
+        config.MaxIdleAge = 30 * time.Second
+    }
+    if config.Timeout <= 0 {
+        config.Timeout = 2 * time.Second
+    }
+
+    ticker := time.NewTicker(config.Interval)
+    defer ticker.Stop()
+
+    for {
+        serverpool.refillPreconnected(ctx, config)
+
+        select {
+        case <-ctx.Done():
+            for _, peer := range serverpool.Backends() {
+                if preconnector := peer.Preconnector(); preconnector != nil {
+                    preconnector.Drain()
+                }
+            }
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+func (serverpool *ServerPool) refillPreconnected(ctx context.Context, config PreconnectConfig) {
+    for _, peer := range serverpool.Backends() {
+        preconnector, err := peer.EnablePreconnect(config.MinIdle, config.MaxIdleAge)
+        if err != nil {
+            log.Printf("%s %v\n", peer.URL, err)
+            continue
+        }
+        if !peer.IsAlive() {
+            preconnector.Drain()
+            continue
+        }
+        go fillPreconnected(ctx, peer, preconnector, config.Timeout)
+    }
+}
+
+func fillPreconnected(ctx context.Context, peer *backend.Backend, preconnector *backend.Preconnector, timeout time.Duration) {
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+
+    if err := preconnector.Fill(ctx); err != nil && ctx.Err() == nil {
+        log.Printf("%s preconnect failed: %v\n", peer.URL, err)
+    }
+}
@@ -0,0 +1,49 @@
+package balancer
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+func TestServerPool_Preconnect(t *testing.T) {
+    pool, closeServer := newTestPool(t, "ok")
+    defer closeServer()
+    peer := pool.Backends()[0]
+
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    go func() {
+        pool.Preconnect(ctx, PreconnectConfig{MinIdle: 3, Interval: 10 * time.Millisecond})
+        close(done)
+    }()
+
+    waitForIdle := func(expected int) {
+        t.Helper()
+        deadline := time.Now().Add(2 * time.Second)
+        for {
+            preconnector := peer.Preconnector()
+            if preconnector != nil && preconnector.Idle() == expected {
+                return
+            }
+            if time.Now().After(deadline) {
+                t.Fatalf("Expected %d idle connections", expected)
+            }
+            time.Sleep(5 * time.Millisecond)
+        }
+    }
+
+    waitForIdle(3)
+
+    peer.SetAlive(false)
+    waitForIdle(0)
+
+    peer.SetAlive(true)
+    waitForIdle(3)
+
+    cancel()
+    <-done
+    if idle := peer.Preconnector().Idle(); idle != 0 {
+        t.Errorf("Expected idle connections to be closed on shutdown, got %d", idle)
+    }
+}
@@ -0,0 +1,151 @@
+package balancer
+
+import (
+    "context"
+    "crypto/tls"
+    "log"
+    "net"
+    "net/http"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+// PreflightConfig makes a pool check every backend it gains, whether added
+// by configuration, the admin API or discovery, before putting it into
+// rotation rather than waiting for the next health check round: its host
+// is resolved, connected to and, for https backends, handshaken with, each
+// within Timeout (default 5 seconds), and then probed with HealthCheck when
+// it is set. A backend that passes goes on to warm-up, if the pool has one,
+// or straight into rotation; one that fails stays down until a health check
+// finds it up. Every result is logged and passed to Report.
+type PreflightConfig struct {
+    Timeout     time.Duration
+    HealthCheck *HealthCheckConfig
+    Report      func(result PreflightResult)
+}
+
+// PreflightResult is the outcome of a backend's preflight. Stage is where it
+// failed, one of dns, connect, tls or health, and empty when it passed.
+type PreflightResult struct {
+    Backend   *backend.Backend
+    Addresses []string
+    Stage     string
+    Elapsed   time.Duration
+    Err       error
+}
+
+func (serverpool *ServerPool) SetPreflight(config PreflightConfig) {
+    if config.Timeout <= 0 {
+        config.Timeout = 5 * time.Second
+    }
+    serverpool.preflight.Store(&config)
+}
+
+// admit holds a backend new to the pool out of rotation while it is
+// preflighted and warmed up, when the pool does either.
+func (serverpool *ServerPool) admit(peer *backend.Backend) {
+    if !peer.IsAlive() {
+        return
+    }
+    if config := serverpool.preflight.Load(); config != nil {
+        peer.SetAlive(false)
+        serverpool.startPreflight(peer, config)
+        return
+    }
+    if serverpool.warmUp.Load() != nil {
+        peer.SetAlive(false)
+        serverpool.startWarmUp(peer)
+    }
+}
+
+func (serverpool *ServerPool) startPreflight(peer *backend.Backend, config *PreflightConfig) {
+    state := &admission{}
+    if _, running := serverpool.preflighting.LoadOrStore(peer, state); running {
+        return
+    }
+
+    go func() {
+        defer serverpool.preflighting.Delete(peer)
+
+        result := preflight(context.Background(), peer, config)
+        if config.Report != nil {
+            config.Report(result)
+        }
+        if result.Err != nil {
+            log.Printf("%s [preflight failed at %s after %s] %v\n", peer.URL, result.Stage, result.Elapsed.Round(time.Millisecond), result.Err)
+            return
+        }
+        log.Printf("%s [preflight passed in %s, %v]\n", peer.URL, result.Elapsed.Round(time.Millisecond), result.Addresses)
+        if state.vetoed.Load() {
+            log.Printf("%s [down, failed a health check during preflight]\n", peer.URL)
+            return
+        }
+        if serverpool.startWarmUp(peer) {
+            log.Printf("%s [warming]\n", peer.URL)
+            return
+        }
+        serverpool.markUp(peer)
+    }()
+}
+
+func preflight(ctx context.Context, peer *backend.Backend, config *PreflightConfig) PreflightResult {
+    start := time.Now()
+    result := PreflightResult{Backend: peer}
+    fail := func(stage string, err error) PreflightResult {
+        result.Stage, result.Err, result.Elapsed = stage, err, time.Since(start)
+        return result
+    }
+
+    host := peer.URL.Hostname()
+    if net.ParseIP(host) != nil {
+        result.Addresses = []string{host}
+    } else {
+        lookupCtx, cancel := context.WithTimeout(ctx, config.Timeout)
+        addresses, err := net.DefaultResolver.LookupHost(lookupCtx, host)
+        cancel()
+        if err != nil {
+            return fail("dns", err)
+        }
+        result.Addresses = addresses
+    }
+
+    defaultPort := "80"
+    if peer.URL.Scheme == "https" {
+        defaultPort = "443"
+    }
+    dialCtx, cancel := context.WithTimeout(ctx, config.Timeout)
+    defer cancel()
+    var dialer net.Dialer
+    conn, err := dialer.DialContext(dialCtx, "tcp", dialAddress(peer, defaultPort))
+    if err != nil {
+        return fail("connect", err)
+    }
+    defer conn.Close()
+
+    if peer.URL.Scheme == "https" {
+        tlsConfig := &tls.Config{}
+        if peer.ReverseProxy != nil {
+            if transport, ok := peer.ReverseProxy.Transport.(*http.Transport); ok && transport.TLSClientConfig != nil {
+                tlsConfig = transport.TLSClientConfig.Clone()
+            }
+        }
+        if tlsConfig.ServerName == "" {
+            tlsConfig.ServerName = host
+        }
+        handshakeCtx, cancel := context.WithTimeout(ctx, config.Timeout)
+        defer cancel()
+        if err := tls.Client(conn, tlsConfig).HandshakeContext(handshakeCtx); err != nil {
+            return fail("tls", err)
+        }
+    }
+
+    if config.HealthCheck != nil {
+        healthCheck := config.HealthCheck.withDefaults()
+        if err := healthCheck.probe()(ctx, peer); err != nil {
+            return fail("health", err)
+        }
+    }
+    result.Elapsed = time.Since(start)
+    return result
+}
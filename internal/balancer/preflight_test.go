@@ -0,0 +1,155 @@
+package balancer
+
+import (
+    "io"
+    "log"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "os"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+func TestServerPool_PreflightOnAdd(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    defer healthy.Close()
+    failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusInternalServerError)
+    }))
+    defer failing.Close()
+    secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    defer secure.Close()
+    closed, _ := net.Listen("tcp", "127.0.0.1:0")
+    closed.Close()
+
+    tests := []struct {
+        name          string
+        target        string
+        transport     http.RoundTripper
+        healthCheck   *HealthCheckConfig
+        expectedStage string
+        expectedAlive bool
+    }{
+        {name: "reachable", target: healthy.URL, expectedAlive: true},
+        {name: "tls with the transport's roots", target: secure.URL, transport: secure.Client().Transport, expectedAlive: true},
+        {name: "tls with untrusted certificate", target: secure.URL, expectedStage: "tls"},
+        {name: "unresolvable", target: "http://backend.invalid", expectedStage: "dns"},
+        {name: "refused", target: "http://" + closed.Addr().String(), expectedStage: "connect"},
+        {name: "failing health probe", target: failing.URL, healthCheck: &HealthCheckConfig{Timeout: time.Second}, expectedStage: "health"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            results := make(chan PreflightResult, 1)
+            pool := NewServerPool()
+            pool.SetPreflight(PreflightConfig{Timeout: time.Second, HealthCheck: tt.healthCheck, Report: func(result PreflightResult) {
+                results <- result
+            }})
+
+            target, _ := url.Parse(tt.target)
+            proxy := httputil.NewSingleHostReverseProxy(target)
+            proxy.Transport = tt.transport
+            peer := &backend.Backend{URL: target, Alive: true, ReverseProxy: proxy}
+            pool.AddBackend(peer)
+            if peer.IsAlive() {
+                t.Fatal("Expected the backend held out of rotation during preflight")
+            }
+
+            var result PreflightResult
+            select {
+            case result = <-results:
+            case <-time.After(5 * time.Second):
+                t.Fatal("Expected a preflight result")
+            }
+            if result.Stage != tt.expectedStage || (result.Err == nil) != (tt.expectedStage == "") {
+                t.Errorf("Expected failure at %q, got %q: %v", tt.expectedStage, result.Stage, result.Err)
+            }
+
+            deadline := time.Now().Add(time.Second)
+            for peer.IsAlive() != tt.expectedAlive && time.Now().Before(deadline) {
+                time.Sleep(5 * time.Millisecond)
+            }
+            if peer.IsAlive() != tt.expectedAlive {
+                t.Errorf("Expected alive %v after preflight, got %v", tt.expectedAlive, peer.IsAlive())
+            }
+        })
+    }
+}
+
+func TestServerPool_PreflightThenWarmUp(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    server, hits := newWarmUpServer()
+    defer server.Close()
+
+    pool := NewServerPool()
+    pool.SetPreflight(PreflightConfig{})
+    pool.SetWarmUp(WarmUpConfig{Paths: []string{"/warm"}, Count: 2})
+
+    target, _ := url.Parse(server.URL)
+    existing := &backend.Backend{URL: target, Alive: true}
+    pool.SetBackends([]*backend.Backend{existing})
+    waitForAlive(t, existing)
+    if count := hits("/warm"); count != 2 {
+        t.Errorf("Expected warm-up after preflight, got %d warm-up requests", count)
+    }
+
+    // Backends already in the pool are not checked again.
+    pool.SetBackends([]*backend.Backend{existing})
+    if !existing.IsAlive() {
+        t.Error("Expected a backend already in the pool to stay in rotation")
+    }
+}
+
+func TestServerPool_PreflightHonoursFailedHealthCheck(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    var healthy atomic.Bool
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if !healthy.Load() {
+            w.WriteHeader(http.StatusServiceUnavailable)
+        }
+    }))
+    defer server.Close()
+
+    // Holding the report open keeps the backend in preflight while a
+    // health check fails.
+    reported, release := make(chan struct{}), make(chan struct{})
+    pool := NewServerPool()
+    pool.SetPreflight(PreflightConfig{Timeout: time.Second, Report: func(result PreflightResult) {
+        close(reported)
+        <-release
+    }})
+    serverURL, _ := url.Parse(server.URL)
+    peer := &backend.Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)}
+    pool.AddBackend(peer)
+
+    <-reported
+    pool.HealthCheck()
+    close(release)
+
+    deadline := time.Now().Add(2 * time.Second)
+    for {
+        if _, running := pool.preflighting.Load(peer); !running {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("preflight did not finish")
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+    if peer.IsAlive() {
+        t.Error("Expected a backend that failed a health check during preflight to stay down")
+    }
+}
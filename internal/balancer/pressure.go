@@ -0,0 +1,175 @@
+package balancer
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "log"
+    "math"
+    "net/http"
+    "sync/atomic"
+    "time"
+
+    "load-balancer/internal/metrics"
+)
+
+type PressureSample struct {
+    InFlight       int64
+    Queued         int64
+    AliveBackends  int
+    TotalBackends  int
+    TargetInFlight int64
+}
+
+type PressureSignal struct {
+    Pool            string    `json:"pool"`
+    InFlight        int64     `json:"in_flight"`
+    Queued          int64     `json:"queued"`
+    Capacity        int64     `json:"capacity"`
+    Pressure        float64   `json:"pressure"`
+    CurrentBackends int       `json:"current_backends"`
+    DesiredBackends int       `json:"desired_backends"`
+    Time            time.Time `json:"time"`
+}
+
+type PressureCalculator func(sample PressureSample) PressureSignal
+
+type PressureConfig struct {
+    TargetInFlight int64
+    Interval       time.Duration
+    WebhookURL     string
+    QueueDepth     func() int64
+    Calculator     PressureCalculator
+    Registry       *metrics.Registry
+}
+
+type PressureMonitor struct {
+    name    string
+    pool    *ServerPool
+    config  PressureConfig
+    client  *http.Client
+    last    atomic.Pointer[PressureSignal]
+    desired atomic.Int64
+
+    pressureGauge *metrics.Gauge
+    capacityGauge *metrics.Gauge
+    desiredGauge  *metrics.Gauge
+}
+
+func DefaultPressureCalculator(sample PressureSample) PressureSignal {
+    load := sample.InFlight + sample.Queued
+    signal := PressureSignal{
+        InFlight:        sample.InFlight,
+        Queued:          sample.Queued,
+        Capacity:        int64(sample.AliveBackends) * sample.TargetInFlight,
+        CurrentBackends: sample.AliveBackends,
+    }
+
+    if signal.Capacity > 0 {
+        signal.Pressure = float64(load) / float64(signal.Capacity)
+    } else {
+        signal.Pressure = float64(load) / float64(sample.TargetInFlight)
+    }
+
+    signal.DesiredBackends = int(math.Ceil(float64(load) / float64(sample.TargetInFlight)))
+    if signal.DesiredBackends < 1 {
+        signal.DesiredBackends = 1
+    }
+    return signal
+}
+
+func NewPressureMonitor(name string, pool *ServerPool, config PressureConfig) *PressureMonitor {
+    if config.TargetInFlight <= 0 {
+        config.TargetInFlight = 100
+    }
+    if config.Interval <= 0 {
+        config.Interval = 10 * time.Second
+    }
+    if config.Calculator == nil {
+        config.Calculator = DefaultPressureCalculator
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+
+    return &PressureMonitor{
+        name:          name,
+        pool:          pool,
+        config:        config,
+        client:        &http.Client{Timeout: 5 * time.Second},
+        pressureGauge: config.Registry.Gauge("lb_pool_pressure", "Ratio of in-flight plus queued requests to pool capacity.", "pool", name),
+        capacityGauge: config.Registry.Gauge("lb_pool_capacity", "Target in-flight capacity of the alive backends.", "pool", name),
+        desiredGauge:  config.Registry.Gauge("lb_pool_desired_backends", "Backends needed to serve the current load at target concurrency.", "pool", name),
+    }
+}
+
+func (monitor *PressureMonitor) Sample() PressureSignal {
+    sample := PressureSample{TargetInFlight: monitor.config.TargetInFlight}
+    for _, peer := range monitor.pool.Backends() {
+        sample.TotalBackends++
+        if peer.IsAlive() {
+            sample.AliveBackends++
+        }
+        sample.InFlight += peer.Stats().InFlight
+    }
+    if monitor.config.QueueDepth != nil {
+        sample.Queued = monitor.config.QueueDepth()
+    }
+
+    signal := monitor.config.Calculator(sample)
+    signal.Pool = monitor.name
+    signal.Time = time.Now()
+
+    monitor.last.Store(&signal)
+    monitor.pressureGauge.Set(signal.Pressure)
+    monitor.capacityGauge.Set(float64(signal.Capacity))
+    monitor.desiredGauge.Set(float64(signal.DesiredBackends))
+
+    if previous := monitor.desired.Swap(int64(signal.DesiredBackends)); previous != int64(signal.DesiredBackends) {
+        monitor.notify(signal)
+    }
+    return signal
+}
+
+func (monitor *PressureMonitor) Last() (PressureSignal, bool) {
+    signal := monitor.last.Load()
+    if signal == nil {
+        return PressureSignal{}, false
+    }
+    return *signal, true
+}
+
+func (monitor *PressureMonitor) Run(ctx context.Context) {
+    ticker := time.NewTicker(monitor.config.Interval)
+    defer ticker.Stop()
+
+    for {
+        monitor.Sample()
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+func (monitor *PressureMonitor) notify(signal PressureSignal) {
+    if monitor.config.WebhookURL == "" {
+        return
+    }
+
+    body, err := json.Marshal(signal)
+    if err != nil {
+        log.Printf("pressure webhook: %v\n", err)
+        return
+    }
+    resp, err := monitor.client.Post(monitor.config.WebhookURL, "application/json", bytes.NewReader(body))
+    if err != nil {
+        log.Printf("pressure webhook: %v\n", err)
+        return
+    }
+    resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        log.Printf("pressure webhook: unexpected status %d\n", resp.StatusCode)
+    }
+}
@@ -0,0 +1,134 @@
+package balancer
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "strings"
+    "sync"
+    "testing"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+func TestDefaultPressureCalculator(t *testing.T) {
+    tests := []struct {
+        name             string
+        sample           PressureSample
+        expectedPressure float64
+        expectedCapacity int64
+        expectedDesired  int
+    }{
+        {
+            name:             "idle pool",
+            sample:           PressureSample{AliveBackends: 3, TargetInFlight: 10},
+            expectedPressure: 0,
+            expectedCapacity: 30,
+            expectedDesired:  1,
+        },
+        {
+            name:             "half loaded",
+            sample:           PressureSample{InFlight: 10, Queued: 5, AliveBackends: 3, TargetInFlight: 10},
+            expectedPressure: 0.5,
+            expectedCapacity: 30,
+            expectedDesired:  2,
+        },
+        {
+            name:             "saturated",
+            sample:           PressureSample{InFlight: 40, Queued: 20, AliveBackends: 3, TargetInFlight: 10},
+            expectedPressure: 2,
+            expectedCapacity: 30,
+            expectedDesired:  6,
+        },
+        {
+            name:             "no alive backends",
+            sample:           PressureSample{InFlight: 5, AliveBackends: 0, TargetInFlight: 10},
+            expectedPressure: 0.5,
+            expectedCapacity: 0,
+            expectedDesired:  1,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            signal := DefaultPressureCalculator(tt.sample)
+            if signal.Pressure != tt.expectedPressure {
+                t.Errorf("Pressure = %v, expected %v", signal.Pressure, tt.expectedPressure)
+            }
+            if signal.Capacity != tt.expectedCapacity {
+                t.Errorf("Capacity = %d, expected %d", signal.Capacity, tt.expectedCapacity)
+            }
+            if signal.DesiredBackends != tt.expectedDesired {
+                t.Errorf("DesiredBackends = %d, expected %d", signal.DesiredBackends, tt.expectedDesired)
+            }
+        })
+    }
+}
+
+func TestPressureMonitor_Sample(t *testing.T) {
+    var mux sync.Mutex
+    var received []PressureSignal
+    webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var signal PressureSignal
+        if err := json.NewDecoder(r.Body).Decode(&signal); err != nil {
+            t.Errorf("webhook received invalid JSON: %v", err)
+        }
+        mux.Lock()
+        received = append(received, signal)
+        mux.Unlock()
+    }))
+    defer webhook.Close()
+
+    pool := NewServerPool()
+    for i := 0; i < 2; i++ {
+        testURL, _ := url.Parse("http://example.com:808" + string(rune('0'+i)))
+        pool.AddBackend(&backend.Backend{
+            URL:          testURL,
+            Alive:        i == 0,
+            ReverseProxy: httputil.NewSingleHostReverseProxy(testURL),
+        })
+    }
+
+    queued := int64(0)
+    registry := metrics.NewRegistry()
+    monitor := NewPressureMonitor("api", pool, PressureConfig{
+        TargetInFlight: 4,
+        WebhookURL:     webhook.URL,
+        QueueDepth:     func() int64 { return queued },
+        Registry:       registry,
+    })
+
+    if _, ok := monitor.Last(); ok {
+        t.Error("Last() should report no signal before the first sample")
+    }
+
+    signal := monitor.Sample()
+    if signal.Pool != "api" || signal.CurrentBackends != 1 || signal.Capacity != 4 {
+        t.Errorf("Unexpected signal %+v", signal)
+    }
+
+    monitor.Sample()
+    queued = 6
+    signal = monitor.Sample()
+    if signal.DesiredBackends != 2 || signal.Pressure != 1.5 {
+        t.Errorf("Unexpected signal under load %+v", signal)
+    }
+
+    mux.Lock()
+    defer mux.Unlock()
+    if len(received) != 2 {
+        t.Fatalf("Expected webhook only on desired-backend changes (2 calls), got %d", len(received))
+    }
+    if received[1].DesiredBackends != 2 {
+        t.Errorf("Expected webhook to report 2 desired backends, got %d", received[1].DesiredBackends)
+    }
+
+    var builder strings.Builder
+    registry.WriteText(&builder)
+    if !strings.Contains(builder.String(), `lb_pool_pressure{pool="api"} 1.5`) {
+        t.Errorf("Expected pressure gauge in metrics, got:\n%s", builder.String())
+    }
+}
@@ -0,0 +1,142 @@
+package balancer
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "net/http/httputil"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+// ProtocolErrorConfig guards the pool against backends that answer with
+// something other than sane HTTP: headers over MaxHeaderBytes (default 64
+// KiB) or a response the transport cannot parse. The client gets a clean 502
+// saying what was wrong instead of whatever the proxy made of it, the error
+// is counted per backend in lb_backend_protocol_errors_total, and a backend
+// with EjectAfter (default 5) protocol errors in a row is deprioritized for
+// EjectFor (default 30s), as backends asking to be retried later are.
+type ProtocolErrorConfig struct {
+    Name           string
+    MaxHeaderBytes int
+    EjectAfter     int
+    EjectFor       time.Duration
+    Registry       *metrics.Registry
+}
+
+// protocolError is a backend response rejected by the guard.
+type protocolError struct {
+    kind   string
+    detail string
+}
+
+func (err *protocolError) Error() string {
+    return err.detail
+}
+
+// SetProtocolErrors enables the guard described by config.
+func (serverpool *ServerPool) SetProtocolErrors(config ProtocolErrorConfig) {
+    if config.MaxHeaderBytes <= 0 {
+        config.MaxHeaderBytes = 64 << 10
+    }
+    if config.EjectAfter <= 0 {
+        config.EjectAfter = 5
+    }
+    if config.EjectFor <= 0 {
+        config.EjectFor = 30 * time.Second
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+    serverpool.protocol.Store(&config)
+}
+
+// guardProtocol returns a copy of proxy that turns protocol errors from
+// peer into 502s and keeps count of them.
+func (serverpool *ServerPool) guardProtocol(config *ProtocolErrorConfig, peer *backend.Backend, proxy *httputil.ReverseProxy) *httputil.ReverseProxy {
+    guarded := *proxy
+    modifyResponse := proxy.ModifyResponse
+    errorHandler := proxy.ErrorHandler
+    guarded.ModifyResponse = func(response *http.Response) error {
+        if size := headerBytes(response.Header); size > config.MaxHeaderBytes {
+            return &protocolError{kind: "headers_too_large", detail: fmt.Sprintf("response headers of %d bytes exceed the %d byte limit", size, config.MaxHeaderBytes)}
+        }
+        serverpool.protocolStreak(peer).Store(0)
+        if modifyResponse != nil {
+            return modifyResponse(response)
+        }
+        return nil
+    }
+    guarded.ErrorHandler = func(writer http.ResponseWriter, request *http.Request, err error) {
+        var rejected *protocolError
+        if !errors.As(err, &rejected) {
+            rejected = classifyProtocolError(err)
+        }
+        if rejected == nil {
+            if errorHandler != nil {
+                errorHandler(writer, request, err)
+                return
+            }
+            log.Printf("http: proxy error: %v\n", err)
+            writer.WriteHeader(http.StatusBadGateway)
+            return
+        }
+        serverpool.protocolErrorFrom(config, peer, rejected)
+        explaining(request).add("attempt", "%s sent an invalid response: %s", peer.URL, rejected.detail)
+        serveError(writer, "Bad Gateway: backend sent an invalid response ("+rejected.kind+")", http.StatusBadGateway)
+    }
+    return &guarded
+}
+
+// protocolErrorFrom counts a protocol error from peer, deprioritizing it
+// once it has sent EjectAfter in a row.
+func (serverpool *ServerPool) protocolErrorFrom(config *ProtocolErrorConfig, peer *backend.Backend, rejected *protocolError) {
+    config.Registry.Counter("lb_backend_protocol_errors_total", "Backend responses rejected as invalid HTTP, by kind.", "pool", config.Name, "backend", peer.URL.String(), "kind", rejected.kind).Inc()
+    log.Printf("%s [protocol error: %s]\n", peer.URL, rejected.detail)
+
+    streak := serverpool.protocolStreak(peer)
+    if streak.Add(1) < int64(config.EjectAfter) {
+        return
+    }
+    streak.Store(0)
+    peer.Deprioritize(time.Now().Add(config.EjectFor))
+    log.Printf("%s [deprioritized for %s after %d protocol errors in a row]\n", peer.URL, config.EjectFor, config.EjectAfter)
+}
+
+func (serverpool *ServerPool) protocolStreak(peer *backend.Backend) *atomic.Int64 {
+    streak, _ := serverpool.streaks.LoadOrStore(peer, new(atomic.Int64))
+    return streak.(*atomic.Int64)
+}
+
+// classifyProtocolError recognizes the transport's errors for responses it
+// could not parse, which it only reports as text.
+func classifyProtocolError(err error) *protocolError {
+    message := err.Error()
+    switch {
+    case strings.Contains(message, "server response headers exceeded"):
+        return &protocolError{kind: "headers_too_large", detail: message}
+    case strings.Contains(message, "malformed HTTP"),
+        strings.Contains(message, "malformed MIME header"),
+        strings.Contains(message, "bad Content-Length"),
+        strings.Contains(message, "invalid Trailer key"),
+        strings.Contains(message, "unsupported transfer encoding"):
+        return &protocolError{kind: "malformed", detail: message}
+    }
+    return nil
+}
+
+// headerBytes is the size of header as sent on the wire.
+func headerBytes(header http.Header) int {
+    size := 0
+    for key, values := range header {
+        for _, value := range values {
+            size += len(key) + len(value) + 4
+        }
+    }
+    return size
+}
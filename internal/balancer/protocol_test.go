@@ -0,0 +1,127 @@
+package balancer
+
+import (
+    "bufio"
+    "io"
+    "log"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+// newRawBackend answers every request with response, as sent.
+func newRawBackend(t *testing.T, response string) *backend.Backend {
+    t.Helper()
+
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("Listen() error: %v", err)
+    }
+    t.Cleanup(func() { listener.Close() })
+    go func() {
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            go func() {
+                defer conn.Close()
+                http.ReadRequest(bufio.NewReader(conn))
+                conn.Write([]byte(response))
+            }()
+        }
+    }()
+
+    serverURL, _ := url.Parse("http://" + listener.Addr().String())
+    return &backend.Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)}
+}
+
+func TestServerPool_ProtocolErrors(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    tests := []struct {
+        name           string
+        response       string
+        expectedStatus int
+        expectedKind   string
+    }{
+        {name: "valid", response: "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok", expectedStatus: http.StatusOK},
+        {name: "oversized headers", response: "HTTP/1.1 200 OK\r\nX-Junk: " + strings.Repeat("a", 2048) + "\r\nContent-Length: 0\r\n\r\n", expectedStatus: http.StatusBadGateway, expectedKind: "headers_too_large"},
+        {name: "garbage status line", response: "SSH-2.0-OpenSSH\r\n\r\n", expectedStatus: http.StatusBadGateway, expectedKind: "malformed"},
+        {name: "bad header line", response: "HTTP/1.1 200 OK\r\nno colon here\r\n\r\n", expectedStatus: http.StatusBadGateway, expectedKind: "malformed"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            registry := metrics.NewRegistry()
+            peer := newRawBackend(t, tt.response)
+            pool := NewServerPool()
+            pool.AddBackend(peer)
+            pool.SetProtocolErrors(ProtocolErrorConfig{Name: "web", MaxHeaderBytes: 1024, EjectAfter: 2, Registry: registry})
+
+            for i := 0; i < 2; i++ {
+                rr := httptest.NewRecorder()
+                pool.LoadBalancerHandler(rr, httptest.NewRequest("GET", "/", nil))
+                if rr.Code != tt.expectedStatus {
+                    t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+                }
+                if tt.expectedKind != "" && !strings.Contains(rr.Body.String(), tt.expectedKind) {
+                    t.Errorf("Expected the body to name %s, got %q", tt.expectedKind, rr.Body.String())
+                }
+                if rr.Header().Get("X-Junk") != "" {
+                    t.Error("Expected the oversized headers dropped")
+                }
+            }
+
+            if tt.expectedKind == "" {
+                if peer.Deprioritized(time.Now()) {
+                    t.Error("Expected a valid backend kept in rotation")
+                }
+                return
+            }
+            if count := registry.Counter("lb_backend_protocol_errors_total", "", "pool", "web", "backend", peer.URL.String(), "kind", tt.expectedKind).Value(); count != 2 {
+                t.Errorf("Expected 2 protocol errors counted, got %v", count)
+            }
+            if !peer.Deprioritized(time.Now()) {
+                t.Error("Expected the backend deprioritized after 2 protocol errors in a row")
+            }
+        })
+    }
+}
+
+func TestServerPool_ProtocolErrorsStreak(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    healthy := true
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if !healthy {
+            w.Header().Set("X-Junk", strings.Repeat("a", 2048))
+        }
+    }))
+    defer server.Close()
+    serverURL, _ := url.Parse(server.URL)
+    peer := &backend.Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)}
+    pool := NewServerPool()
+    pool.AddBackend(peer)
+    pool.SetProtocolErrors(ProtocolErrorConfig{MaxHeaderBytes: 1024, EjectAfter: 2, Registry: metrics.NewRegistry()})
+
+    // A valid response in between resets the count.
+    for _, state := range []bool{false, true, false} {
+        healthy = state
+        pool.LoadBalancerHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+    }
+    if peer.Deprioritized(time.Now()) {
+        t.Error("Expected protocol errors separated by a valid response not to eject the backend")
+    }
+}
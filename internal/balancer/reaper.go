@@ -0,0 +1,84 @@
+package balancer
+
+import (
+    "context"
+    "log"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+type ReaperConfig struct {
+    Name     string
+    MaxIdle  time.Duration
+    Interval time.Duration
+    Registry *metrics.Registry
+}
+
+// ReapIdleConnections closes upstream connections that have carried no
+// request for MaxIdle, checking every Interval until ctx is cancelled, and
+// exports per-backend open, idle and reaped connection counts.
+func (serverpool *ServerPool) ReapIdleConnections(ctx context.Context, config ReaperConfig) {
+    if config.MaxIdle <= 0 {
+        config.MaxIdle = 90 * time.Second
+    }
+    if config.Interval <= 0 {
+        config.Interval = 30 * time.Second
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+
+    ticker := time.NewTicker(config.Interval)
+    defer ticker.Stop()
+
+    skipped := make(map[*backend.Backend]bool)
+    for {
+        serverpool.reap(config, time.Now(), skipped)
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// reap enables a reaper on backends that have none yet, once: backends
+// where that fails are remembered in skipped, and left out, rather than
+// retried and logged on every pass.
+func (serverpool *ServerPool) reap(config ReaperConfig, now time.Time, skipped map[*backend.Backend]bool) {
+    peers := serverpool.Backends()
+    current := make(map[*backend.Backend]bool, len(peers))
+    for _, peer := range peers {
+        current[peer] = true
+    }
+    for peer := range skipped {
+        if !current[peer] {
+            delete(skipped, peer)
+        }
+    }
+
+    for _, peer := range peers {
+        reaper := peer.Reaper()
+        if reaper == nil {
+            if skipped[peer] {
+                continue
+            }
+            var err error
+            if reaper, err = peer.EnableReaper(config.MaxIdle); err != nil {
+                log.Printf("%s %v\n", peer.URL, err)
+                skipped[peer] = true
+                continue
+            }
+        }
+        labels := []string{"pool", config.Name, "backend", peer.URL.String()}
+        reaped := reaper.Reap(now)
+        config.Registry.Counter("lb_backend_connections_reaped_total", "Upstream connections closed after sitting idle too long.", labels...).Add(float64(reaped))
+
+        open, idle, _ := reaper.Stats()
+        config.Registry.Gauge("lb_backend_connections_open", "Upstream connections currently open.", labels...).Set(float64(open))
+        config.Registry.Gauge("lb_backend_connections_idle", "Open upstream connections carrying no request.", labels...).Set(float64(idle))
+    }
+}
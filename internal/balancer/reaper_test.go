@@ -0,0 +1,73 @@
+package balancer
+
+import (
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+func TestServerPool_ReapIdleConnections(t *testing.T) {
+    pool, closeServer := newTestPool(t, "ok")
+    defer closeServer()
+    peer := pool.Backends()[0]
+    peer.ReverseProxy.Transport = http.DefaultTransport.(*http.Transport).Clone()
+
+    registry := metrics.NewRegistry()
+    config := ReaperConfig{Name: "web", MaxIdle: time.Minute, Registry: registry}
+    skipped := make(map[*backend.Backend]bool)
+    pool.reap(config, time.Now(), skipped)
+
+    rr := httptest.NewRecorder()
+    pool.LoadBalancerHandler(rr, httptest.NewRequest("GET", "/", nil))
+
+    pool.reap(config, time.Now(), skipped)
+    var builder strings.Builder
+    registry.WriteText(&builder)
+    idle := "lb_backend_connections_idle{backend=\"" + peer.URL.String() + "\",pool=\"web\"} 1\n"
+    if !strings.Contains(builder.String(), idle) {
+        t.Errorf("Expected output to contain %q, got:\n%s", idle, builder.String())
+    }
+
+    pool.reap(config, time.Now().Add(2*time.Minute), skipped)
+    builder.Reset()
+    registry.WriteText(&builder)
+    for _, expected := range []string{
+        "lb_backend_connections_reaped_total{backend=\"" + peer.URL.String() + "\",pool=\"web\"} 1\n",
+        "lb_backend_connections_open{backend=\"" + peer.URL.String() + "\",pool=\"web\"} 0\n",
+    } {
+        if !strings.Contains(builder.String(), expected) {
+            t.Errorf("Expected output to contain %q, got:\n%s", expected, builder.String())
+        }
+    }
+}
+
+func TestServerPool_ReapSkipsBackendsOnce(t *testing.T) {
+    pool, closeServer := newTestPool(t, "ok")
+    defer closeServer()
+    peer := pool.Backends()[0]
+    peer.ReverseProxy.Transport = http.DefaultTransport.(*http.Transport).Clone()
+    if _, err := peer.EnablePreconnect(1, time.Second); err != nil {
+        t.Fatal(err)
+    }
+
+    var logged strings.Builder
+    log.SetOutput(&logged)
+    defer log.SetOutput(os.Stderr)
+
+    config := ReaperConfig{Name: "web", MaxIdle: time.Minute, Registry: metrics.NewRegistry()}
+    skipped := make(map[*backend.Backend]bool)
+    for i := 0; i < 3; i++ {
+        pool.reap(config, time.Now(), skipped)
+    }
+
+    if count := strings.Count(logged.String(), "enable before preconnect"); count != 1 {
+        t.Errorf("Expected the failure logged once, got %d times:\n%s", count, logged.String())
+    }
+}
@@ -0,0 +1,113 @@
+package balancer
+
+import (
+    "errors"
+    "math"
+    "net/http"
+    "strconv"
+    "sync/atomic"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+// defaultRecoveryWait is suggested when nothing indicates when the pool
+// might recover, such as when it runs no health checks.
+const defaultRecoveryWait = 10 * time.Second
+
+// RecoverySignals describes what might bring a pool with no healthy
+// backend back, as input to a RetryAfterPolicy.
+type RecoverySignals struct {
+    // HealthCheckInterval is the pool's health check cadence, zero when it
+    // runs no health checks.
+    HealthCheckInterval time.Duration
+    // NextHealthCheck is the time until the next health check round is
+    // due, zero when one is due now or none run.
+    NextHealthCheck time.Duration
+    // OverrideExpiry is the time until the first forced-down backend that
+    // passes its health checks returns, zero when there is none.
+    OverrideExpiry time.Duration
+    // Suggested is the balancer's own estimate: the earliest of the above,
+    // at least a second.
+    Suggested time.Duration
+}
+
+// RetryAfterPolicy decides the Retry-After sent with a 503 when a pool has
+// no healthy backend. Returning zero or less omits the header.
+type RetryAfterPolicy func(pool *ServerPool, signals RecoverySignals) time.Duration
+
+type recoveryState struct {
+    interval  atomic.Int64
+    lastCheck atomic.Int64
+    policy    atomic.Pointer[RetryAfterPolicy]
+}
+
+// SetRetryAfterPolicy replaces how the pool computes Retry-After for 503s;
+// nil restores the default of RecoverySignals.Suggested.
+func (serverpool *ServerPool) SetRetryAfterPolicy(policy RetryAfterPolicy) {
+    if policy == nil {
+        serverpool.recovery.policy.Store(nil)
+        return
+    }
+    serverpool.recovery.policy.Store(&policy)
+}
+
+func (serverpool *ServerPool) observeHealthRound(interval time.Duration, now time.Time) {
+    serverpool.recovery.interval.Store(int64(interval))
+    serverpool.recovery.lastCheck.Store(now.UnixNano())
+}
+
+// RecoverySignals reports when the pool might next have a healthy backend.
+func (serverpool *ServerPool) RecoverySignals(now time.Time) RecoverySignals {
+    signals := RecoverySignals{HealthCheckInterval: time.Duration(serverpool.recovery.interval.Load())}
+    if signals.HealthCheckInterval > 0 {
+        next := time.Unix(0, serverpool.recovery.lastCheck.Load()).Add(signals.HealthCheckInterval)
+        signals.NextHealthCheck = max(next.Sub(now), 0)
+    }
+    for _, peer := range serverpool.Backends() {
+        state, until := peer.Override(now)
+        if state != backend.ForceDown || !peer.Healthy() {
+            continue
+        }
+        if wait := until.Sub(now); signals.OverrideExpiry == 0 || wait < signals.OverrideExpiry {
+            signals.OverrideExpiry = wait
+        }
+    }
+
+    suggested := defaultRecoveryWait
+    if signals.HealthCheckInterval > 0 {
+        // A backend found healthy next round is usable right after it.
+        suggested = signals.NextHealthCheck
+    }
+    if signals.OverrideExpiry > 0 && signals.OverrideExpiry < suggested {
+        suggested = signals.OverrideExpiry
+    }
+    signals.Suggested = max(suggested, time.Second)
+    return signals
+}
+
+// writeError answers like writeError, adding a Retry-After computed from
+// the pool's recovery signals to 503s unless a backend already gave one.
+func (serverpool *ServerPool) writeError(writer http.ResponseWriter, err error) {
+    if errors.Is(err, ErrNoHealthyBackend) && writer.Header().Get("Retry-After") == "" {
+        signals := serverpool.RecoverySignals(time.Now())
+        wait := signals.Suggested
+        if policy := serverpool.recovery.policy.Load(); policy != nil {
+            wait = (*policy)(serverpool, signals)
+        }
+        if wait > 0 {
+            writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+        }
+    }
+    writeError(serverpool.metricsRegistry(), writer, err)
+}
+
+// metricsRegistry is the registry of the router the pool was added to, or
+// metrics.Default for a pool used on its own.
+func (serverpool *ServerPool) metricsRegistry() *metrics.Registry {
+    if registry := serverpool.registry.Load(); registry != nil {
+        return registry
+    }
+    return metrics.Default
+}
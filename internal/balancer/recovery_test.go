@@ -0,0 +1,85 @@
+package balancer
+
+import (
+    "context"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+func TestServerPool_NoHealthyRetryAfter(t *testing.T) {
+    pool, closeServer := newTestPool(t, "ok")
+    defer closeServer()
+    peer := pool.Backends()[0]
+
+    tests := []struct {
+        name      string
+        interval  time.Duration
+        lastCheck time.Duration
+        override  time.Duration
+        healthy   bool
+        policy    RetryAfterPolicy
+        expected  string
+    }{
+        {name: "no health checks", expected: "10"},
+        {name: "next round due", interval: 30 * time.Second, lastCheck: 12 * time.Second, expected: "18"},
+        {name: "round overdue", interval: 5 * time.Second, lastCheck: time.Minute, expected: "1"},
+        {name: "override ends first", interval: 30 * time.Second, override: 4 * time.Second, healthy: true, expected: "4"},
+        {name: "override on a failing backend", interval: 30 * time.Second, override: 4 * time.Second, expected: "30"},
+        {name: "policy", policy: func(pool *ServerPool, signals RecoverySignals) time.Duration { return 2 * signals.Suggested }, expected: "20"},
+        {name: "policy omits the header", policy: func(pool *ServerPool, signals RecoverySignals) time.Duration { return 0 }, expected: ""},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pool.recovery.interval.Store(int64(tt.interval))
+            pool.recovery.lastCheck.Store(time.Now().Add(-tt.lastCheck).UnixNano())
+            pool.SetRetryAfterPolicy(tt.policy)
+            peer.SetAlive(tt.healthy)
+            peer.SetOverride(backend.Auto, time.Time{})
+            if tt.override > 0 {
+                peer.SetOverride(backend.ForceDown, time.Now().Add(tt.override))
+            }
+
+            rr := httptest.NewRecorder()
+            pool.LoadBalancerHandler(rr, httptest.NewRequest("GET", "/", nil))
+            if rr.Code != 503 {
+                t.Fatalf("Expected status 503, got %d", rr.Code)
+            }
+            if retryAfter := rr.Header().Get("Retry-After"); retryAfter != tt.expected {
+                t.Errorf("Expected Retry-After %q, got %q", tt.expected, retryAfter)
+            }
+        })
+    }
+}
+
+func TestServerPool_NoHealthyRetryAfterWithHooks(t *testing.T) {
+    pool, closeServer := newTestPool(t, "ok")
+    defer closeServer()
+    pool.Backends()[0].SetAlive(false)
+    pool.SetHooks(Hooks{})
+
+    rr := httptest.NewRecorder()
+    pool.LoadBalancerHandler(rr, httptest.NewRequest("GET", "/", nil))
+    if rr.Code != 503 || rr.Header().Get("Retry-After") != "10" {
+        t.Errorf("Expected 503 with Retry-After 10, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+    }
+}
+
+func TestServerPool_RecoverySignalsAfterHealthChecksStop(t *testing.T) {
+    pool, closeServer := newTestPool(t, "ok")
+    defer closeServer()
+
+    checker := pool.HealthChecker(HealthCheckConfig{Interval: time.Hour})
+    checker.Start(context.Background())
+    for pool.RecoverySignals(time.Now()).HealthCheckInterval == 0 {
+        time.Sleep(time.Millisecond)
+    }
+    checker.Stop()
+
+    if signals := pool.RecoverySignals(time.Now()); signals.HealthCheckInterval != 0 || signals.Suggested != defaultRecoveryWait {
+        t.Errorf("Expected no health check cadence once stopped, got %+v", signals)
+    }
+}
@@ -0,0 +1,116 @@
+package balancer
+
+import (
+    "errors"
+    "log"
+    "net/http"
+    "strconv"
+    "sync"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+var errResponseTooLarge = errors.New("response exceeds the route's size limit")
+
+// limitResponse wraps writer to count the bytes peer sends back for the
+// request's route and, when the route sets MaxResponseBytes, to stop the
+// response once it grows past the limit. A response that declares a larger
+// Content-Length up front is replaced with a 502; one that only runs over
+// while streaming is cut off, which aborts the client connection.
+func limitResponse(peer *backend.Backend, writer http.ResponseWriter, request *http.Request) http.ResponseWriter {
+    traffic, limit := unrouted(), int64(0)
+    if route := RouteFromContext(request.Context()); route != nil && route.traffic != nil {
+        traffic, limit = route.traffic, route.MaxResponseBytes
+    }
+    return &limitWriter{
+        ResponseWriter: writer,
+        peer:           peer,
+        traffic:        traffic,
+        limit:          limit,
+        bytes:          traffic.sent(peer),
+    }
+}
+
+// routeTraffic holds a route's response counters, resolved once per route
+// and backend instead of on every response.
+type routeTraffic struct {
+    registry *metrics.Registry
+    route    string
+    exceeded *metrics.Counter
+    bytes    sync.Map
+}
+
+func newRouteTraffic(registry *metrics.Registry, route string, limit int64) *routeTraffic {
+    traffic := &routeTraffic{registry: registry, route: route}
+    if limit > 0 {
+        traffic.exceeded = registry.Counter("lb_response_limit_exceeded_total", "Responses aborted for exceeding the route's size limit.", "route", route)
+    }
+    return traffic
+}
+
+// unrouted counts responses served by pools used without a Router.
+var unrouted = sync.OnceValue(func() *routeTraffic {
+    return newRouteTraffic(metrics.Default, "", 0)
+})
+
+// sent is the counter of the bytes peer sends back on the route. Counters
+// are kept by URL, so a backend that leaves its pool is not kept alive.
+func (traffic *routeTraffic) sent(peer *backend.Backend) *metrics.Counter {
+    url := peer.URL.String()
+    if counter, ok := traffic.bytes.Load(url); ok {
+        return counter.(*metrics.Counter)
+    }
+    counter, _ := traffic.bytes.LoadOrStore(url, traffic.registry.Counter("lb_response_bytes_total", "Response body bytes sent by backends.", "route", traffic.route, "backend", url))
+    return counter.(*metrics.Counter)
+}
+
+type limitWriter struct {
+    http.ResponseWriter
+    peer     *backend.Backend
+    traffic  *routeTraffic
+    limit    int64
+    bytes    *metrics.Counter
+    written  int64
+    exceeded bool
+}
+
+func (writer *limitWriter) WriteHeader(status int) {
+    if writer.limit > 0 && status >= http.StatusOK && !writer.exceeded {
+        if length, err := strconv.ParseInt(writer.Header().Get("Content-Length"), 10, 64); err == nil && length > writer.limit {
+            writer.exceed(length)
+            header := writer.Header()
+            for key := range header {
+                delete(header, key)
+            }
+            serveError(writer.ResponseWriter, "Response too large", http.StatusBadGateway)
+            http.NewResponseController(writer.ResponseWriter).Flush()
+            return
+        }
+    }
+    writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *limitWriter) Write(p []byte) (int, error) {
+    if writer.exceeded {
+        return 0, errResponseTooLarge
+    }
+    if writer.limit > 0 && writer.written+int64(len(p)) > writer.limit {
+        writer.exceed(writer.written + int64(len(p)))
+        return 0, errResponseTooLarge
+    }
+    n, err := writer.ResponseWriter.Write(p)
+    writer.written += int64(n)
+    writer.bytes.Add(float64(n))
+    return n, err
+}
+
+func (writer *limitWriter) exceed(size int64) {
+    writer.exceeded = true
+    writer.traffic.exceeded.Inc()
+    log.Printf("%s [response on route %q reached %d bytes, over the %d byte limit; aborted]\n", writer.peer.URL, writer.traffic.route, size, writer.limit)
+}
+
+func (writer *limitWriter) Unwrap() http.ResponseWriter {
+    return writer.ResponseWriter
+}
@@ -0,0 +1,127 @@
+package balancer
+
+import (
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "os"
+    "strings"
+    "testing"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+func TestRouter_MaxResponseBytes(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body := strings.Repeat("x", 1000)
+        switch r.URL.Path {
+        case "/small":
+            w.Write([]byte("ok"))
+        case "/declared":
+            w.Header().Set("Content-Length", "1000")
+            w.Write([]byte(body))
+        case "/streamed":
+            for i := 0; i < 10; i++ {
+                w.Write([]byte(body[:100]))
+                w.(http.Flusher).Flush()
+            }
+        }
+    }))
+    defer upstream.Close()
+    upstreamURL, _ := url.Parse(upstream.URL)
+    pool := NewServerPool()
+    pool.AddBackend(&backend.Backend{URL: upstreamURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(upstreamURL)})
+
+    registry := metrics.NewRegistry()
+    router := NewRouter("app")
+    router.SetRegistry(registry)
+    router.AddPool("app", pool)
+    router.AddRoute(Route{Name: "limited", Pool: "app", MaxResponseBytes: 500})
+    front := httptest.NewServer(router)
+    defer front.Close()
+
+    tests := []struct {
+        name         string
+        path         string
+        expectedCode int
+        expectedBody string
+        expectError  bool
+    }{
+        {name: "under the limit", path: "/small", expectedCode: http.StatusOK, expectedBody: "ok"},
+        {name: "declared length over the limit", path: "/declared", expectedCode: http.StatusBadGateway, expectedBody: "Response too large\n"},
+        {name: "streamed body over the limit", path: "/streamed", expectedCode: http.StatusOK, expectError: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            response, err := http.Get(front.URL + tt.path)
+            if err != nil {
+                t.Fatalf("GET %s: %v", tt.path, err)
+            }
+            defer response.Body.Close()
+            body, err := io.ReadAll(response.Body)
+
+            if response.StatusCode != tt.expectedCode {
+                t.Errorf("Expected status %d, got %d", tt.expectedCode, response.StatusCode)
+            }
+            if tt.expectError {
+                if err == nil {
+                    t.Errorf("Expected the response to be cut off, got %d bytes", len(body))
+                }
+                return
+            }
+            if string(body) != tt.expectedBody {
+                t.Errorf("Expected body %q, got %q", tt.expectedBody, body)
+            }
+        })
+    }
+
+    exceeded := registry.Counter("lb_response_limit_exceeded_total", "", "route", "limited").Value()
+    if exceeded != 2 {
+        t.Errorf("Expected 2 exceeded responses, got %v", exceeded)
+    }
+    sent := registry.Counter("lb_response_bytes_total", "", "route", "limited", "backend", upstreamURL.String()).Value()
+    if sent < 2 || sent > 502 {
+        t.Errorf("Expected between 2 and 502 bytes counted, got %v", sent)
+    }
+}
+
+func TestRouter_CountsResponseBytesWithoutLimit(t *testing.T) {
+    upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte("hello"))
+    }))
+    defer upstream.Close()
+    upstreamURL, _ := url.Parse(upstream.URL)
+    pool := NewServerPool()
+    pool.AddBackend(&backend.Backend{URL: upstreamURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(upstreamURL)})
+
+    registry := metrics.NewRegistry()
+    router := NewRouter("app")
+    router.SetRegistry(registry)
+    router.AddPool("app", pool)
+    router.AddRoute(Route{Name: "open", Pool: "app", PathPrefix: "/open"})
+    front := httptest.NewServer(router)
+    defer front.Close()
+
+    for _, path := range []string{"/open", "/other"} {
+        response, err := http.Get(front.URL + path)
+        if err != nil {
+            t.Fatalf("GET %s: %v", path, err)
+        }
+        io.Copy(io.Discard, response.Body)
+        response.Body.Close()
+    }
+
+    for _, route := range []string{"open", "default"} {
+        if sent := registry.Counter("lb_response_bytes_total", "", "route", route, "backend", upstreamURL.String()).Value(); sent != 5 {
+            t.Errorf("Expected 5 bytes counted on route %s, got %v", route, sent)
+        }
+    }
+}
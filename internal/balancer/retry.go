@@ -0,0 +1,152 @@
+package balancer
+
+import (
+    "errors"
+    "log"
+    "net/http"
+    "strconv"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+var errRetryAfter = errors.New("backend asked the client to retry later")
+
+// RetryAfterConfig controls how the pool reacts when a backend answers 429
+// or 503 with a Retry-After header. Eject deprioritizes the backend for the
+// advertised delay (capped at MaxEjection); Retry resends idempotent requests
+// without a body to another backend, up to MaxAttempts in total. Retry
+// cannot be combined with hooks, and neither can be combined with hedging.
+type RetryAfterConfig struct {
+    Eject       bool
+    Retry       bool
+    MaxAttempts int
+    MaxEjection time.Duration
+}
+
+func (serverpool *ServerPool) SetRetryAfter(config RetryAfterConfig) error {
+    if serverpool.hedge.Load() != nil {
+        return errors.New("balancer: Retry-After handling cannot be combined with hedging")
+    }
+    if config.Retry && serverpool.hooks.Load() != nil {
+        return errors.New("balancer: Retry-After retries cannot be combined with hooks")
+    }
+    if config.MaxAttempts <= 0 {
+        config.MaxAttempts = 2
+    }
+    if config.MaxEjection <= 0 {
+        config.MaxEjection = 5 * time.Minute
+    }
+    serverpool.retry.Store(&config)
+    return nil
+}
+
+// observeRetryAfter reports whether response is a 429/503 carrying a usable
+// Retry-After, deprioritizing peer when ejection is enabled.
+func (serverpool *ServerPool) observeRetryAfter(peer *backend.Backend, response *http.Response) bool {
+    config := serverpool.retry.Load()
+    if config == nil {
+        return false
+    }
+    if response.StatusCode != http.StatusTooManyRequests && response.StatusCode != http.StatusServiceUnavailable {
+        return false
+    }
+    now := time.Now()
+    delay, ok := parseRetryAfter(response.Header.Get("Retry-After"), now)
+    if !ok {
+        return false
+    }
+    if config.Eject {
+        if delay > config.MaxEjection {
+            delay = config.MaxEjection
+        }
+        peer.Deprioritize(now.Add(delay))
+        log.Printf("%s [deprioritized for %s]\n", peer.URL, delay)
+    }
+    return true
+}
+
+func (serverpool *ServerPool) serveWithRetryAfter(config *RetryAfterConfig, writer http.ResponseWriter, request *http.Request) {
+    retryable := config.Retry && isIdempotent(request.Method) && (request.Body == nil || request.Body == http.NoBody)
+    tried := make(map[*backend.Backend]bool)
+    var retryAfter string
+
+    for attempt := 1; ; attempt++ {
+        peer, err := serverpool.pick(request, tried)
+        if err != nil {
+            if retryAfter != "" {
+                writer.Header().Set("Retry-After", retryAfter)
+            }
+            serverpool.writeError(writer, err)
+            return
+        }
+        tried[peer] = true
+
+        retried := false
+        proxy := *peer.ReverseProxy
+        modifyResponse := proxy.ModifyResponse
+        errorHandler := proxy.ErrorHandler
+        proxy.ModifyResponse = func(response *http.Response) error {
+            if modifyResponse != nil {
+                if err := modifyResponse(response); err != nil {
+                    return err
+                }
+            }
+            if !serverpool.observeRetryAfter(peer, response) {
+                return nil
+            }
+            if retryable && attempt < config.MaxAttempts && serverpool.hasCandidate(tried) {
+                retryAfter = response.Header.Get("Retry-After")
+                return errRetryAfter
+            }
+            return nil
+        }
+        proxy.ErrorHandler = func(writer http.ResponseWriter, request *http.Request, err error) {
+            if errors.Is(err, errRetryAfter) {
+                retried = true
+                return
+            }
+            if errorHandler != nil {
+                errorHandler(writer, request, err)
+                return
+            }
+            log.Printf("http: proxy error: %v\n", err)
+            writer.WriteHeader(http.StatusBadGateway)
+        }
+
+        serverpool.forward(peer, &proxy, writer, request)
+        if !retried {
+            return
+        }
+        explaining(request).add("retry", "%s asked to retry after %s: trying another backend", peer.URL, retryAfter)
+    }
+}
+
+func isIdempotent(method string) bool {
+    switch method {
+    case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+        return true
+    }
+    return false
+}
+
+// parseRetryAfter accepts both forms allowed by RFC 9110: delay-seconds and
+// an HTTP-date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+    if value == "" {
+        return 0, false
+    }
+    if seconds, err := strconv.Atoi(value); err == nil {
+        if seconds < 0 {
+            return 0, false
+        }
+        return time.Duration(seconds) * time.Second, true
+    }
+    if date, err := http.ParseTime(value); err == nil {
+        if delay := date.Sub(now); delay > 0 {
+            return delay, true
+        }
+        return 0, true
+    }
+    return 0, false
+}
@@ -0,0 +1,215 @@
+package balancer
+
+import (
+    "bytes"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "os"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+    now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+    tests := []struct {
+        value    string
+        expected time.Duration
+        ok       bool
+    }{
+        {value: "", ok: false},
+        {value: "120", expected: 2 * time.Minute, ok: true},
+        {value: "-1", ok: false},
+        {value: "Mon, 01 Jan 2024 12:00:30 GMT", expected: 30 * time.Second, ok: true},
+        {value: "Mon, 01 Jan 2024 11:00:00 GMT", expected: 0, ok: true},
+        {value: "soon", ok: false},
+    }
+
+    for _, tt := range tests {
+        delay, ok := parseRetryAfter(tt.value, now)
+        if ok != tt.ok || delay != tt.expected {
+            t.Errorf("parseRetryAfter(%q) = %v, %v; expected %v, %v", tt.value, delay, ok, tt.expected, tt.ok)
+        }
+    }
+}
+
+func newRetryAfterBackend(t *testing.T, name string, busy *atomic.Bool, hits *atomic.Int32) *backend.Backend {
+    t.Helper()
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        hits.Add(1)
+        if busy.Load() {
+            w.Header().Set("Retry-After", "30")
+            w.WriteHeader(http.StatusServiceUnavailable)
+            return
+        }
+        w.Write([]byte(name))
+    }))
+    t.Cleanup(server.Close)
+
+    serverURL, _ := url.Parse(server.URL)
+    return &backend.Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)}
+}
+
+func TestServerPool_RetryAfter(t *testing.T) {
+    log.SetOutput(&bytes.Buffer{})
+    defer log.SetOutput(os.Stderr)
+
+    tests := []struct {
+        name           string
+        config         RetryAfterConfig
+        method         string
+        expectedCode   int
+        expectedBody   string
+        expectedBusy   int32
+        expectDemotion bool
+    }{
+        {
+            name:           "idempotent request retried on another backend",
+            config:         RetryAfterConfig{Eject: true, Retry: true},
+            method:         "GET",
+            expectedCode:   http.StatusOK,
+            expectedBody:   "healthy",
+            expectedBusy:   1,
+            expectDemotion: true,
+        },
+        {
+            name:           "non-idempotent request passes the error through",
+            config:         RetryAfterConfig{Eject: true, Retry: true},
+            method:         "POST",
+            expectedCode:   http.StatusServiceUnavailable,
+            expectedBusy:   1,
+            expectDemotion: true,
+        },
+        {
+            name:         "retry without ejection",
+            config:       RetryAfterConfig{Retry: true},
+            method:       "GET",
+            expectedCode: http.StatusOK,
+            expectedBody: "healthy",
+            expectedBusy: 1,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var busyFlag, healthyFlag atomic.Bool
+            var busyHits, healthyHits atomic.Int32
+            busyFlag.Store(true)
+            busy := newRetryAfterBackend(t, "busy", &busyFlag, &busyHits)
+            healthy := newRetryAfterBackend(t, "healthy", &healthyFlag, &healthyHits)
+
+            pool := NewServerPool()
+            pool.AddBackend(busy)
+            pool.AddBackend(healthy)
+            pool.SetRetryAfter(tt.config)
+            pool.current.Store(uint64(len(pool.backends) - 1))
+
+            rr := httptest.NewRecorder()
+            pool.LoadBalancerHandler(rr, httptest.NewRequest(tt.method, "/", nil))
+
+            if rr.Code != tt.expectedCode {
+                t.Errorf("Expected status %d, got %d", tt.expectedCode, rr.Code)
+            }
+            if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+                t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body.String())
+            }
+            if busyHits.Load() != tt.expectedBusy {
+                t.Errorf("Expected %d requests to the busy backend, got %d", tt.expectedBusy, busyHits.Load())
+            }
+            if busy.Deprioritized(time.Now()) != tt.expectDemotion {
+                t.Errorf("Deprioritized() = %v, expected %v", busy.Deprioritized(time.Now()), tt.expectDemotion)
+            }
+        })
+    }
+}
+
+func TestServerPool_DeprioritizedBackendSkipped(t *testing.T) {
+    var busyFlag, healthyFlag atomic.Bool
+    var busyHits, healthyHits atomic.Int32
+    busy := newRetryAfterBackend(t, "busy", &busyFlag, &busyHits)
+    healthy := newRetryAfterBackend(t, "healthy", &healthyFlag, &healthyHits)
+
+    pool := NewServerPool()
+    pool.AddBackend(busy)
+    pool.AddBackend(healthy)
+    busy.Deprioritize(time.Now().Add(time.Minute))
+
+    for i := 0; i < 4; i++ {
+        if peer := pool.GetNextPeer(); peer != healthy {
+            t.Fatalf("request %d: expected the healthy backend, got %s", i, peer.URL)
+        }
+    }
+
+    healthy.SetAlive(false)
+    if peer := pool.GetNextPeer(); peer != busy {
+        t.Error("Expected a deprioritized backend to serve when it is the only alive one")
+    }
+}
+
+func TestServerPool_RetryAfterSingleBackend(t *testing.T) {
+    log.SetOutput(&bytes.Buffer{})
+    defer log.SetOutput(os.Stderr)
+
+    var busyFlag atomic.Bool
+    var hits atomic.Int32
+    busyFlag.Store(true)
+    only := newRetryAfterBackend(t, "only", &busyFlag, &hits)
+
+    pool := NewServerPool()
+    pool.AddBackend(only)
+    pool.SetRetryAfter(RetryAfterConfig{Eject: true, Retry: true, MaxAttempts: 3})
+
+    rr := httptest.NewRecorder()
+    pool.LoadBalancerHandler(rr, httptest.NewRequest("GET", "/", nil))
+
+    if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") != "30" {
+        t.Errorf("Expected backend 503 with Retry-After to pass through, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+    }
+    if hits.Load() != 1 || strings.TrimSpace(rr.Body.String()) != "" {
+        t.Errorf("Expected a single attempt, got %d", hits.Load())
+    }
+}
+
+type countingStrategy struct {
+    picks atomic.Int32
+}
+
+func (strategy *countingStrategy) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    strategy.picks.Add(1)
+    return candidates[0]
+}
+
+func TestServerPool_RetryAfterPicksOncePerAttempt(t *testing.T) {
+    log.SetOutput(&bytes.Buffer{})
+    defer log.SetOutput(os.Stderr)
+
+    var busyFlag, healthyFlag atomic.Bool
+    var busyHits, healthyHits atomic.Int32
+    busyFlag.Store(true)
+    busy := newRetryAfterBackend(t, "busy", &busyFlag, &busyHits)
+    healthy := newRetryAfterBackend(t, "healthy", &healthyFlag, &healthyHits)
+
+    pool := NewServerPool()
+    pool.AddBackend(busy)
+    pool.AddBackend(healthy)
+    strategy := &countingStrategy{}
+    pool.SetStrategy(strategy)
+    pool.SetRetryAfter(RetryAfterConfig{Retry: true})
+
+    rr := httptest.NewRecorder()
+    pool.LoadBalancerHandler(rr, httptest.NewRequest("GET", "/", nil))
+
+    if rr.Body.String() != "healthy" {
+        t.Errorf("Expected the retry to reach the healthy backend, got %q", rr.Body.String())
+    }
+    if picks := strategy.picks.Load(); picks != 2 {
+        t.Errorf("Expected one pick per attempt, got %d", picks)
+    }
+}
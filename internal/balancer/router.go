@@ -0,0 +1,287 @@
+package balancer
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "net"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "load-balancer/internal/metrics"
+    "load-balancer/internal/script"
+)
+
+type Route struct {
+    Name             string
+    Host             string
+    PathPrefix       string
+    Methods          []string
+    Pool             string
+    Timeout          time.Duration
+    Failover         *Failover
+    Fallback         *Fallback
+    Stale            *Stale
+    MaxResponseBytes int64
+    MinPoolStatus    PoolStatus
+    Middleware       []func(next http.Handler) http.Handler
+    Auth             func(next http.Handler) http.Handler
+    AuthBypass       []string
+    AuthHeaders      []string
+
+    chain   http.Handler
+    traffic *routeTraffic
+}
+
+type Router struct {
+    mux         sync.RWMutex
+    pools       map[string]*ServerPool
+    routes      []*Route
+    defaultPool string
+    script      *script.Program
+    fallback    *Route
+    explainer   *explainer
+    registry    *metrics.Registry
+}
+
+type routeContextKey struct{}
+type poolContextKey struct{}
+
+func NewRouter(defaultPool string) *Router {
+    router := &Router{
+        pools:       make(map[string]*ServerPool),
+        defaultPool: defaultPool,
+        registry:    metrics.Default,
+    }
+    router.fallback = &Route{Name: "default", Pool: defaultPool, chain: http.HandlerFunc(router.dispatch), traffic: newRouteTraffic(router.registry, "default", 0)}
+    return router
+}
+
+// SetRegistry makes the router report its pools' and routes' metrics to
+// registry instead of metrics.Default. Call it before adding pools and
+// routes.
+func (router *Router) SetRegistry(registry *metrics.Registry) {
+    router.mux.Lock()
+    router.registry = registry
+    fallback := *router.fallback
+    fallback.traffic = newRouteTraffic(registry, fallback.Name, 0)
+    router.fallback = &fallback
+    router.mux.Unlock()
+}
+
+func (router *Router) metricsRegistry() *metrics.Registry {
+    router.mux.RLock()
+    defer router.mux.RUnlock()
+
+    return router.registry
+}
+
+func RouteFromContext(ctx context.Context) *Route {
+    route, _ := ctx.Value(routeContextKey{}).(*Route)
+    return route
+}
+
+func WithPool(request *http.Request, pool string) *http.Request {
+    return request.WithContext(context.WithValue(request.Context(), poolContextKey{}, pool))
+}
+
+func (router *Router) AddPool(name string, pool *ServerPool) {
+    router.mux.Lock()
+    router.pools[name] = pool
+    registry := router.registry
+    router.mux.Unlock()
+
+    pool.registry.Store(registry)
+    exportHealth(registry, name, pool)
+}
+
+func (router *Router) Pool(name string) *ServerPool {
+    router.mux.RLock()
+    pool := router.pools[name]
+    router.mux.RUnlock()
+
+    return pool
+}
+
+// Pools returns the router's pools by name.
+func (router *Router) Pools() map[string]*ServerPool {
+    router.mux.RLock()
+    defer router.mux.RUnlock()
+
+    pools := make(map[string]*ServerPool, len(router.pools))
+    for name, pool := range router.pools {
+        pools[name] = pool
+    }
+    return pools
+}
+
+// Routes returns copies of the router's routes, in the order they match.
+func (router *Router) Routes() []Route {
+    router.mux.RLock()
+    defer router.mux.RUnlock()
+
+    routes := make([]Route, len(router.routes))
+    for i, route := range router.routes {
+        routes[i] = *route
+    }
+    return routes
+}
+
+func (router *Router) AddRoute(route Route) {
+    var chain http.Handler = http.HandlerFunc(router.dispatch)
+    for i := len(route.Middleware) - 1; i >= 0; i-- {
+        chain = route.Middleware[i](chain)
+    }
+    if route.Auth != nil {
+        chain = authenticate(route.Auth, route.AuthBypass, route.AuthHeaders)(chain)
+    }
+    if route.Timeout > 0 {
+        chain = ResponseTimeout(route.Timeout)(chain)
+    }
+    if len(route.Methods) > 0 {
+        chain = allowMethods(route.Methods)(chain)
+    }
+    route.chain = chain
+
+    router.mux.Lock()
+    route.traffic = newRouteTraffic(router.registry, route.Name, route.MaxResponseBytes)
+    router.routes = append(router.routes, &route)
+    router.mux.Unlock()
+}
+
+func (router *Router) SetScript(program *script.Program) {
+    router.mux.Lock()
+    router.script = program
+    router.mux.Unlock()
+}
+
+func (router *Router) Match(request *http.Request) *Route {
+    router.mux.RLock()
+    defer router.mux.RUnlock()
+
+    for _, route := range router.routes {
+        if route.Host != "" && !strings.EqualFold(route.Host, stripPort(request.Host)) {
+            continue
+        }
+        if !strings.HasPrefix(request.URL.Path, route.PathPrefix) {
+            continue
+        }
+        return route
+    }
+    return router.fallback
+}
+
+func (router *Router) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+    router.explain(writer, request, router.serve)
+}
+
+func (router *Router) serve(writer http.ResponseWriter, request *http.Request, explanation *Explanation) {
+    router.mux.RLock()
+    program := router.script
+    router.mux.RUnlock()
+
+    route := router.Match(request)
+    if explanation != nil {
+        router.explainMatch(explanation, request, route)
+    }
+    poolName := route.Pool
+    if poolName == "" {
+        poolName = router.defaultPool
+    }
+
+    scripted := false
+    if program != nil {
+        if decision, matched := program.Evaluate(request); matched {
+            if decision.Reject {
+                explanation.add("script", "rejected with %d", decision.Status)
+                serveError(writer, http.StatusText(decision.Status), decision.Status)
+                return
+            }
+            explanation.add("script", "sent to pool %s instead of %s", decision.Pool, poolName)
+            poolName, scripted = decision.Pool, true
+        }
+    }
+    if route.Failover != nil && !scripted {
+        primary := poolName
+        poolName = router.failover(route.Failover, poolName)
+        if explanation != nil {
+            healthy := 0.0
+            if pool := router.Pool(primary); pool != nil {
+                healthy = pool.healthyFraction()
+            }
+            explanation.add("failover", "pool %s is %.0f%% alive against a threshold of %.0f%%: sent to %s", primary, healthy*100, route.Failover.Threshold*100, poolName)
+        }
+    }
+
+    ctx := context.WithValue(request.Context(), routeContextKey{}, route)
+    ctx = context.WithValue(ctx, poolContextKey{}, poolName)
+    route.chain.ServeHTTP(writer, request.WithContext(ctx))
+}
+
+func (router *Router) dispatch(writer http.ResponseWriter, request *http.Request) {
+    poolName, _ := request.Context().Value(poolContextKey{}).(string)
+
+    pool := router.Pool(poolName)
+    route := RouteFromContext(request.Context())
+    explanation := explaining(request)
+    if explanation != nil {
+        explanation.note("pool", poolName)
+        if pool != nil {
+            explanation.add("pool", "%s is %s", poolName, pool.Status())
+        } else {
+            explanation.add("pool", "%s does not exist", poolName)
+        }
+    }
+    if route != nil && route.Stale != nil {
+        if router.outage(route, pool) && route.Stale.serve(writer, request, route.Name, router.metricsRegistry()) {
+            explanation.add("stale", "every backend is down: served the stored response")
+            return
+        }
+        recorded := route.Stale.record(writer, request)
+        defer route.Stale.store(request, recorded)
+        writer = recorded
+    }
+    if route != nil && pool != nil && pool.Status() < route.MinPoolStatus {
+        if route.Fallback == nil {
+            pool.writeError(writer, fmt.Errorf("%w: pool %q is %s", ErrNoHealthyBackend, poolName, pool.Status()))
+            return
+        }
+        // A pool below the route's minimum is treated as missing, so the
+        // fallback pool takes the request directly.
+        explanation.add("fallback", "pool %s is below the route's minimum of %s: sent to %s", poolName, route.MinPoolStatus, route.Fallback.Pool)
+        pool = nil
+    }
+    if route != nil && route.Fallback != nil {
+        router.serveFallback(route.Fallback, pool, writer, request)
+        return
+    }
+    if pool == nil {
+        log.Printf("router: no pool named %q\n", poolName)
+        writeError(router.metricsRegistry(), writer, fmt.Errorf("%w: %q", ErrPoolNotFound, poolName))
+        return
+    }
+    pool.LoadBalancerHandler(writer, request)
+}
+
+// outage reports whether no backend can take the route's requests: none
+// of pool's is alive, nor any of its fallback pool's.
+func (router *Router) outage(route *Route, pool *ServerPool) bool {
+    if pool != nil && pool.healthyFraction() > 0 {
+        return false
+    }
+    if route.Fallback != nil {
+        if fallback := router.Pool(route.Fallback.Pool); fallback != nil && fallback.healthyFraction() > 0 {
+            return false
+        }
+    }
+    return true
+}
+
+func stripPort(host string) string {
+    if hostname, _, err := net.SplitHostPort(host); err == nil {
+        return hostname
+    }
+    return host
+}
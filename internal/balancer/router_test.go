@@ -0,0 +1,200 @@
+package balancer
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "testing"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/script"
+)
+
+func newTestPool(t *testing.T, body string) (*ServerPool, func()) {
+    t.Helper()
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte(body))
+    }))
+
+    serverURL, _ := url.Parse(server.URL)
+    pool := NewServerPool()
+    pool.AddBackend(&backend.Backend{
+        URL:          serverURL,
+        Alive:        true,
+        ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL),
+    })
+    return pool, server.Close
+}
+
+func TestRouter_ServeHTTP(t *testing.T) {
+    stable, closeStable := newTestPool(t, "stable")
+    defer closeStable()
+    canary, closeCanary := newTestPool(t, "canary")
+    defer closeCanary()
+
+    program, err := script.Compile(`
+header("X-Canary") == "1" => pool "canary"
+path ^= "/admin" => reject 404
+path ^= "/missing" => pool "nowhere"
+`)
+    if err != nil {
+        t.Fatalf("Compile() error: %v", err)
+    }
+
+    router := NewRouter("stable")
+    router.AddPool("stable", stable)
+    router.AddPool("canary", canary)
+    router.SetScript(program)
+
+    tests := []struct {
+        name         string
+        path         string
+        canary       bool
+        expectedCode int
+        expectedBody string
+    }{
+        {
+            name:         "default pool when no rule matches",
+            path:         "/",
+            expectedCode: http.StatusOK,
+            expectedBody: "stable",
+        },
+        {
+            name:         "script selects pool",
+            path:         "/",
+            canary:       true,
+            expectedCode: http.StatusOK,
+            expectedBody: "canary",
+        },
+        {
+            name:         "script rejects request",
+            path:         "/admin/users",
+            expectedCode: http.StatusNotFound,
+        },
+        {
+            name:         "unknown pool",
+            path:         "/missing",
+            expectedCode: http.StatusBadGateway,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            req := httptest.NewRequest("GET", tt.path, nil)
+            if tt.canary {
+                req.Header.Set("X-Canary", "1")
+            }
+            rr := httptest.NewRecorder()
+
+            router.ServeHTTP(rr, req)
+
+            if rr.Code != tt.expectedCode {
+                t.Errorf("Expected status %d, got %d", tt.expectedCode, rr.Code)
+            }
+            if tt.expectedBody != "" {
+                body, _ := io.ReadAll(rr.Body)
+                if string(body) != tt.expectedBody {
+                    t.Errorf("Expected body %q, got %q", tt.expectedBody, string(body))
+                }
+            }
+        })
+    }
+}
+
+func TestRouter_WithoutScript(t *testing.T) {
+    stable, closeStable := newTestPool(t, "stable")
+    defer closeStable()
+
+    router := NewRouter("stable")
+    router.AddPool("stable", stable)
+
+    if router.Pool("stable") != stable {
+        t.Error("Pool() did not return the registered pool")
+    }
+    if router.Pool("other") != nil {
+        t.Error("Pool() should return nil for unknown pool")
+    }
+
+    rr := httptest.NewRecorder()
+    router.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+    if rr.Code != http.StatusOK {
+        t.Errorf("Expected status 200, got %d", rr.Code)
+    }
+}
+
+func TestRouter_Routes(t *testing.T) {
+    stable, closeStable := newTestPool(t, "stable")
+    defer closeStable()
+    api, closeAPI := newTestPool(t, "api")
+    defer closeAPI()
+
+    var seenRoute string
+    router := NewRouter("stable")
+    router.AddPool("stable", stable)
+    router.AddPool("api", api)
+    router.AddRoute(Route{
+        Name:       "api",
+        Host:       "shop.example.com",
+        PathPrefix: "/api/",
+        Pool:       "api",
+        Middleware: []func(http.Handler) http.Handler{
+            func(next http.Handler) http.Handler {
+                return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                    seenRoute = RouteFromContext(r.Context()).Name
+                    w.Header().Set("X-Route", "api")
+                    next.ServeHTTP(w, r)
+                })
+            },
+        },
+    })
+
+    tests := []struct {
+        name          string
+        host          string
+        path          string
+        expectedBody  string
+        expectedRoute string
+    }{
+        {
+            name:          "matching host and prefix",
+            host:          "shop.example.com:8080",
+            path:          "/api/orders",
+            expectedBody:  "api",
+            expectedRoute: "api",
+        },
+        {
+            name:         "wrong host falls back to default pool",
+            host:         "other.example.com",
+            path:         "/api/orders",
+            expectedBody: "stable",
+        },
+        {
+            name:         "wrong prefix falls back to default pool",
+            host:         "shop.example.com",
+            path:         "/home",
+            expectedBody: "stable",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            seenRoute = ""
+            req := httptest.NewRequest("GET", tt.path, nil)
+            req.Host = tt.host
+            rr := httptest.NewRecorder()
+
+            router.ServeHTTP(rr, req)
+
+            if rr.Body.String() != tt.expectedBody {
+                t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body.String())
+            }
+            if seenRoute != tt.expectedRoute {
+                t.Errorf("Route middleware saw %q, expected %q", seenRoute, tt.expectedRoute)
+            }
+        })
+    }
+}
@@ -0,0 +1,81 @@
+package balancer
+
+import (
+    "context"
+    "net"
+    "sync"
+    "time"
+
+    "load-balancer/internal/metrics"
+)
+
+// RTTProbeConfig controls connect RTT probing. Every Interval (default 5s)
+// each backend gets a fresh TCP connection, closed as soon as it opens, and
+// the time taken feeds the backend's RTT average. Connections that fail or
+// take longer than Timeout (default 1s) are left to the health checks.
+type RTTProbeConfig struct {
+    Name     string
+    Interval time.Duration
+    Timeout  time.Duration
+    Registry *metrics.Registry
+}
+
+// ProbeRTT measures connect RTT to the pool's backends until ctx is
+// cancelled and exports it per backend as lb_backend_rtt_seconds.
+func (serverpool *ServerPool) ProbeRTT(ctx context.Context, config RTTProbeConfig) {
+    if config.Interval <= 0 {
+        config.Interval = 5 * time.Second
+    }
+    if config.Timeout <= 0 {
+        config.Timeout = time.Second
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+
+    ticker := time.NewTicker(config.Interval)
+    defer ticker.Stop()
+
+    for {
+        serverpool.probeRTT(ctx, config)
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+func (serverpool *ServerPool) probeRTT(ctx context.Context, config RTTProbeConfig) {
+    var wg sync.WaitGroup
+    for _, peer := range serverpool.Backends() {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+
+            defaultPort := ""
+            switch peer.URL.Scheme {
+            case "http":
+                defaultPort = "80"
+            case "https":
+                defaultPort = "443"
+            }
+            ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+            defer cancel()
+
+            var dialer net.Dialer
+            start := time.Now()
+            conn, err := dialer.DialContext(ctx, "tcp", dialAddress(peer, defaultPort))
+            if err != nil {
+                return
+            }
+            elapsed := time.Since(start)
+            conn.Close()
+
+            peer.ObserveRTT(elapsed, time.Now())
+            config.Registry.Gauge("lb_backend_rtt_seconds", "Average time taken to open a TCP connection to the backend.", "pool", config.Name, "backend", peer.URL.String()).Set(peer.RTT().Seconds())
+        }()
+    }
+    wg.Wait()
+}
@@ -0,0 +1,41 @@
+package balancer
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+func TestServerPool_ProbeRTT(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    defer server.Close()
+
+    serverURL, _ := url.Parse(server.URL)
+    unreachable, _ := url.Parse("http://127.0.0.1:1")
+    pool := NewServerPool()
+    reachable := &backend.Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)}
+    down := &backend.Backend{URL: unreachable, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(unreachable)}
+    pool.AddBackend(reachable)
+    pool.AddBackend(down)
+
+    registry := metrics.NewRegistry()
+    pool.probeRTT(context.Background(), RTTProbeConfig{Name: "db", Timeout: time.Second, Registry: registry})
+
+    if rtt := reachable.RTT(); rtt <= 0 || rtt > time.Second {
+        t.Errorf("Expected a measured RTT, got %v", rtt)
+    }
+    if rtt := down.RTT(); rtt != 0 {
+        t.Errorf("Expected no RTT for an unreachable backend, got %v", rtt)
+    }
+    gauge := registry.Gauge("lb_backend_rtt_seconds", "", "pool", "db", "backend", serverURL.String()).Value()
+    if gauge != reachable.RTT().Seconds() {
+        t.Errorf("Expected lb_backend_rtt_seconds %v, got %v", reachable.RTT().Seconds(), gauge)
+    }
+}
@@ -0,0 +1,194 @@
+package balancer
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+// Profile is a set of backend weights (keyed by backend URL) and optionally
+// a strategy to use while it is active. Backends it does not list go back to
+// the default weight; without a strategy the pool goes back to the one it
+// had when the schedule started.
+type Profile struct {
+    Weights  map[string]float64 `json:"weights,omitempty"`
+    Strategy *StrategyConfig    `json:"strategy,omitempty"`
+}
+
+// ScheduleWindow activates Profile between Start and End ("15:04", local to
+// the schedule's timezone) on the listed Days ("mon" to "sun", every day
+// when empty). A window whose End is before its Start runs past midnight
+// and belongs to the day it starts on.
+type ScheduleWindow struct {
+    Name    string   `json:"name"`
+    Days    []string `json:"days,omitempty"`
+    Start   string   `json:"start"`
+    End     string   `json:"end"`
+    Profile Profile  `json:"profile"`
+}
+
+// ScheduleConfig describes a pool's time-of-day profiles as they appear in
+// configuration. The first matching window wins; Default applies outside
+// all of them. Weight changes move gradually over Transition.
+type ScheduleConfig struct {
+    Timezone   string           `json:"timezone,omitempty"`
+    Transition string           `json:"transition,omitempty"`
+    Windows    []ScheduleWindow `json:"windows"`
+    Default    Profile          `json:"default"`
+}
+
+type window struct {
+    name    string
+    days    [7]bool
+    start   time.Duration
+    end     time.Duration
+    profile Profile
+}
+
+type Schedule struct {
+    location   *time.Location
+    transition time.Duration
+    windows    []window
+    fallback   Profile
+}
+
+var weekdays = map[string]time.Weekday{
+    "sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+    "thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func NewSchedule(config ScheduleConfig) (*Schedule, error) {
+    schedule := &Schedule{location: time.UTC, fallback: config.Default}
+    if config.Timezone != "" {
+        location, err := time.LoadLocation(config.Timezone)
+        if err != nil {
+            return nil, fmt.Errorf("schedule: %w", err)
+        }
+        schedule.location = location
+    }
+    if config.Transition != "" {
+        transition, err := time.ParseDuration(config.Transition)
+        if err != nil || transition < 0 {
+            return nil, fmt.Errorf("schedule: invalid transition %q", config.Transition)
+        }
+        schedule.transition = transition
+    }
+    if config.Default.Strategy != nil {
+        if _, err := NewStrategy(*config.Default.Strategy); err != nil {
+            return nil, fmt.Errorf("schedule: %w", err)
+        }
+    }
+
+    for _, spec := range config.Windows {
+        w := window{name: spec.Name, profile: spec.Profile}
+        var err error
+        if w.start, err = parseClock(spec.Start); err != nil {
+            return nil, fmt.Errorf("schedule window %s: %w", spec.Name, err)
+        }
+        if w.end, err = parseClock(spec.End); err != nil {
+            return nil, fmt.Errorf("schedule window %s: %w", spec.Name, err)
+        }
+        for _, day := range spec.Days {
+            weekday, ok := weekdays[strings.ToLower(day)]
+            if !ok {
+                return nil, fmt.Errorf("schedule window %s: unknown day %q", spec.Name, day)
+            }
+            w.days[weekday] = true
+        }
+        if len(spec.Days) == 0 {
+            w.days = [7]bool{true, true, true, true, true, true, true}
+        }
+        if spec.Profile.Strategy != nil {
+            if _, err := NewStrategy(*spec.Profile.Strategy); err != nil {
+                return nil, fmt.Errorf("schedule window %s: %w", spec.Name, err)
+            }
+        }
+        schedule.windows = append(schedule.windows, w)
+    }
+    return schedule, nil
+}
+
+func parseClock(value string) (time.Duration, error) {
+    clock, err := time.Parse("15:04", value)
+    if err != nil {
+        return 0, fmt.Errorf("invalid time %q", value)
+    }
+    return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+// Active returns the name of the window in effect at now ("default" when
+// none is) and its profile.
+func (schedule *Schedule) Active(now time.Time) (string, Profile) {
+    local := now.In(schedule.location)
+    // The wall clock, not the time since midnight, which is an hour off
+    // on the days daylight saving starts or ends.
+    offset := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+    yesterday := (local.Weekday() + 6) % 7
+
+    for _, w := range schedule.windows {
+        if w.start <= w.end {
+            if w.days[local.Weekday()] && offset >= w.start && offset < w.end {
+                return w.name, w.profile
+            }
+            continue
+        }
+        if (w.days[local.Weekday()] && offset >= w.start) || (w.days[yesterday] && offset < w.end) {
+            return w.name, w.profile
+        }
+    }
+    return "default", schedule.fallback
+}
+
+// RunSchedule applies the schedule's active profile to the pool, checking
+// every minute until ctx is cancelled. Weights move over the schedule's
+// transition; strategies switch immediately.
+func (serverpool *ServerPool) RunSchedule(ctx context.Context, schedule *Schedule) {
+    ticker := time.NewTicker(time.Minute)
+    defer ticker.Stop()
+
+    base := baseStrategy{strategy: serverpool.strategy.Load(), config: serverpool.strategyConfig.Load()}
+    current := ""
+    for {
+        if name, profile := schedule.Active(time.Now()); name != current {
+            serverpool.applyProfile(profile, base, schedule.transition, time.Now())
+            log.Printf("schedule: profile %s active\n", name)
+            current = name
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// baseStrategy is the strategy a pool had before its schedule ran, put back
+// whenever the active profile does not name one.
+type baseStrategy struct {
+    strategy *Strategy
+    config   *StrategyConfig
+}
+
+func (serverpool *ServerPool) applyProfile(profile Profile, base baseStrategy, transition time.Duration, now time.Time) {
+    for _, peer := range serverpool.Backends() {
+        weight, ok := profile.Weights[peer.URL.String()]
+        if !ok {
+            weight = backend.DefaultWeight
+        }
+        peer.SetWeight(weight, transition, now)
+    }
+    if profile.Strategy == nil {
+        serverpool.strategy.Store(base.strategy)
+        serverpool.strategyConfig.Store(base.config)
+        serverpool.announceMembers()
+        return
+    }
+    if err := serverpool.UseStrategy(*profile.Strategy); err != nil {
+        log.Printf("schedule: %v\n", err)
+    }
+}
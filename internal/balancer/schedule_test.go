@@ -0,0 +1,111 @@
+package balancer
+
+import (
+    "net/url"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+func TestSchedule_Active(t *testing.T) {
+    schedule, err := NewSchedule(ScheduleConfig{
+        Timezone: "UTC",
+        Windows: []ScheduleWindow{
+            {Name: "business", Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"},
+            {Name: "overnight", Days: []string{"fri"}, Start: "22:00", End: "06:00"},
+        },
+    })
+    if err != nil {
+        t.Fatalf("NewSchedule() error: %v", err)
+    }
+
+    tests := []struct {
+        name     string
+        at       string
+        expected string
+    }{
+        {name: "weekday morning", at: "2026-10-14T09:00:00Z", expected: "business"},
+        {name: "weekday end is exclusive", at: "2026-10-14T17:00:00Z", expected: "default"},
+        {name: "weekend daytime", at: "2026-10-17T12:00:00Z", expected: "default"},
+        {name: "window starts friday night", at: "2026-10-16T23:30:00Z", expected: "overnight"},
+        {name: "window runs into saturday", at: "2026-10-17T05:59:00Z", expected: "overnight"},
+        {name: "no window from thursday night", at: "2026-10-16T05:00:00Z", expected: "default"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            now, _ := time.Parse(time.RFC3339, tt.at)
+            if name, _ := schedule.Active(now); name != tt.expected {
+                t.Errorf("Expected %s, got %s", tt.expected, name)
+            }
+        })
+    }
+}
+
+func TestSchedule_ActiveAcrossDaylightSaving(t *testing.T) {
+    schedule, err := NewSchedule(ScheduleConfig{
+        Timezone: "Europe/London",
+        Windows:  []ScheduleWindow{{Name: "business", Start: "09:00", End: "17:00"}},
+    })
+    if err != nil {
+        t.Fatalf("NewSchedule() error: %v", err)
+    }
+
+    // Clocks go back at 02:00 BST on 25 October 2026: 16:30 UTC is 16:30
+    // on the wall clock, but 17:30 after midnight.
+    now, _ := time.Parse(time.RFC3339, "2026-10-25T16:30:00Z")
+    if name, _ := schedule.Active(now); name != "business" {
+        t.Errorf("Expected business at 16:30 local time, got %s", name)
+    }
+}
+
+func TestNewSchedule_Invalid(t *testing.T) {
+    tests := []struct {
+        name   string
+        config ScheduleConfig
+    }{
+        {name: "unknown timezone", config: ScheduleConfig{Timezone: "Nowhere/Town"}},
+        {name: "bad transition", config: ScheduleConfig{Transition: "slowly"}},
+        {name: "bad start", config: ScheduleConfig{Windows: []ScheduleWindow{{Name: "w", Start: "9am", End: "17:00"}}}},
+        {name: "unknown day", config: ScheduleConfig{Windows: []ScheduleWindow{{Name: "w", Days: []string{"someday"}, Start: "09:00", End: "17:00"}}}},
+        {name: "unknown strategy", config: ScheduleConfig{Windows: []ScheduleWindow{{Name: "w", Start: "09:00", End: "17:00", Profile: Profile{Strategy: &StrategyConfig{Name: "fastest"}}}}}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if _, err := NewSchedule(tt.config); err == nil {
+                t.Errorf("Expected an error")
+            }
+        })
+    }
+}
+
+func TestServerPool_ApplyProfile(t *testing.T) {
+    onPrem, _ := url.Parse("http://on-prem")
+    cloud, _ := url.Parse("http://cloud")
+    pool := NewServerPool()
+    pool.AddBackend(&backend.Backend{URL: onPrem, Alive: true})
+    pool.AddBackend(&backend.Backend{URL: cloud, Alive: true})
+
+    start := time.Unix(1000, 0)
+    pool.applyProfile(Profile{
+        Weights:  map[string]float64{"http://on-prem": 9},
+        Strategy: &StrategyConfig{Name: "weighted_round_robin"},
+    }, baseStrategy{}, 10*time.Second, start)
+
+    if effective, target := pool.Backends()[0].Weight(start.Add(5 * time.Second)); effective != 5 || target != 9 {
+        t.Errorf("Expected on-prem halfway from 1 to 9, got %v towards %v", effective, target)
+    }
+    if _, target := pool.Backends()[1].Weight(start); target != backend.DefaultWeight {
+        t.Errorf("Expected unlisted backend at the default weight, got %v", target)
+    }
+    if pool.strategy.Load() == nil {
+        t.Errorf("Expected the profile's strategy to be set")
+    }
+
+    pool.applyProfile(Profile{}, baseStrategy{}, 0, start)
+    if pool.strategy.Load() != nil {
+        t.Errorf("Expected the base strategy back once no window names one")
+    }
+}
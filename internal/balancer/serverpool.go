@@ -1,17 +1,42 @@
 package balancer
 
 import (
-    "log"
+    "context"
     "net/http"
+    "slices"
+    "sync"
     "sync/atomic"
     "time"
 
     "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
 )
 
 type ServerPool struct {
-    backends []*backend.Backend
-    current  uint64
+    mux            sync.RWMutex
+    backends       []*backend.Backend
+    current        atomic.Uint64
+    hooks          atomic.Pointer[Hooks]
+    warmUp         atomic.Pointer[WarmUpConfig]
+    warming        sync.Map
+    preflight      atomic.Pointer[PreflightConfig]
+    preflighting   sync.Map
+    slowStart      atomic.Pointer[SlowStartConfig]
+    ramping        sync.Map
+    tiered         atomic.Bool
+    tier           atomic.Int64
+    retry          atomic.Pointer[RetryAfterConfig]
+    hedge          atomic.Pointer[hedging]
+    strategy       atomic.Pointer[Strategy]
+    strategyConfig atomic.Pointer[StrategyConfig]
+    thresholds     atomic.Pointer[HealthThresholds]
+    maxInFlight    atomic.Int64
+    tlsResumption  atomic.Pointer[TLSResumptionConfig]
+    protocol       atomic.Pointer[ProtocolErrorConfig]
+    streaks        sync.Map
+    autoWeight     atomic.Pointer[autoWeighting]
+    recovery       recoveryState
+    registry       atomic.Pointer[metrics.Registry]
 }
 
 func NewServerPool() *ServerPool {
@@ -19,61 +44,159 @@ func NewServerPool() *ServerPool {
 }
 
 func (serverPool *ServerPool) AddBackend(backend *backend.Backend) {
+    serverPool.setupTLSResumption(backend)
+    serverPool.admit(backend)
+    serverPool.noteTiers(backend)
+    serverPool.mux.Lock()
     serverPool.backends = append(serverPool.backends, backend)
+    serverPool.mux.Unlock()
+    serverPool.announceMembers()
+}
+
+// SetBackends replaces the pool's membership. Backends that were already in
+// the pool keep their state; new ones are set up and go through preflight
+// and warm-up as in AddBackend, and the state of departed ones is dropped.
+func (serverpool *ServerPool) SetBackends(backends []*backend.Backend) {
+    serverpool.mux.Lock()
+    existing := make(map[*backend.Backend]bool, len(serverpool.backends))
+    for _, peer := range serverpool.backends {
+        existing[peer] = true
+    }
+    serverpool.backends = append([]*backend.Backend(nil), backends...)
+    serverpool.mux.Unlock()
+    serverpool.noteTiers(backends...)
+    serverpool.announceMembers()
+
+    for peer := range existing {
+        if !slices.Contains(backends, peer) {
+            serverpool.streaks.Delete(peer)
+            serverpool.ramping.Delete(peer)
+        }
+    }
+
+    for _, peer := range backends {
+        if !existing[peer] {
+            serverpool.setupTLSResumption(peer)
+            serverpool.admit(peer)
+        }
+    }
+}
+
+func (serverpool *ServerPool) Backends() []*backend.Backend {
+    serverpool.mux.RLock()
+    defer serverpool.mux.RUnlock()
+
+    return append([]*backend.Backend(nil), serverpool.backends...)
 }
 
 func (serverpool *ServerPool) NextIndex() int {
-    if len(serverpool.backends) == 0 {
+    serverpool.mux.RLock()
+    count := len(serverpool.backends)
+    serverpool.mux.RUnlock()
+
+    if count == 0 {
         return 0
     }
-    return int(atomic.AddUint64(&serverpool.current, uint64(1)) % uint64(len(serverpool.backends)))
+    return int(serverpool.current.Add(1) % uint64(count))
 }
 
 func (serverpool *ServerPool) GetNextPeer() *backend.Backend {
-    if len(serverpool.backends) == 0 {
+    return serverpool.nextPeer(nil, nil)
+}
+
+// nextPeer picks a backend for request with the pool's strategy. Without
+// one it walks the ring from the next index, preferring alive backends that
+// are not deprioritized and falling back to any alive backend. Backends in
+// exclude are skipped entirely.
+func (serverpool *ServerPool) nextPeer(request *http.Request, exclude map[*backend.Backend]bool) *backend.Backend {
+    serverpool.mux.RLock()
+    backends := serverpool.backends
+    serverpool.mux.RUnlock()
+    if len(backends) == 0 {
         return nil
     }
     
-    next := serverpool.NextIndex()
-    length := len(serverpool.backends) + next
+    now := time.Now()
+    if strategy := serverpool.strategy.Load(); strategy != nil {
+        candidates := serverpool.candidates(backends, exclude, now)
+        explainCandidates(explaining(request), serverpool, serverpool.activeTier(backends, exclude), candidates, now)
+        return (*strategy).Pick(request, candidates)
+    }
+    tier := serverpool.activeTier(backends, exclude)
+    if explanation := explaining(request); explanation != nil {
+        var candidates []*backend.Backend
+        for _, peer := range backends {
+            if peer.Tier == tier && serverpool.available(peer, exclude) {
+                candidates = append(candidates, peer)
+            }
+        }
+        explainCandidates(explanation, serverpool, tier, candidates, now)
+    }
+    next := int(serverpool.current.Add(1) % uint64(len(backends)))
+    length := len(backends) + next
+    var fallback *backend.Backend
+    heldBack := false
     for i := next; i < length; i++ {
-        idx := i % len(serverpool.backends)
-        if serverpool.backends[idx].IsAlive() {
-            if i != next {
-                atomic.StoreUint64(&serverpool.current, uint64(idx))
+        idx := i % len(backends)
+        peer := backends[idx]
+        if peer.Tier != tier || !serverpool.available(peer, exclude) {
+            continue
+        }
+        if peer.Deprioritized(now) {
+            if fallback == nil {
+                fallback = peer
+            }
+            continue
+        }
+        if serverpool.holdBack(peer, now) {
+            heldBack = true
+            if fallback == nil {
+                fallback = peer
             }
-            return serverpool.backends[idx]
+            continue
         }
+        // Moving the index past a slow-starting backend that was passed
+        // over would give it the very next turn, doubling its share.
+        if i != next && !heldBack {
+            serverpool.current.Store(uint64(idx))
+        }
+        return peer
     }
-    return nil
+    return fallback
 }
 
+// HealthCheck checks every backend once with the default HTTP check. Use
+// RunHealthChecks or a HealthChecker for periodic checks with a configured
+// interval and timeout.
 func (serverpool *ServerPool) HealthCheck() {
-    for _, backend := range serverpool.backends {
-        timeout := 2 * time.Second
-        client := &http.Client{Timeout: timeout}
-        
-        alive := false
-        resp, err := client.Get(backend.URL.String())
-        if err == nil {
-            defer resp.Body.Close()
-            alive = resp.StatusCode >= 200 && resp.StatusCode < 300
-        }
-
-        backend.SetAlive(alive)
-        status := "up"
-        if !alive {
-            status = "down"
-        }
-        log.Printf("%s [%s]\n", backend.URL, status)
+    probe := (&HealthCheckConfig{}).withDefaults().probe()
+    for _, backend := range serverpool.Backends() {
+        serverpool.checkBackend(context.Background(), probe, backend)
     }
 }
 
 func (serverpool *ServerPool) LoadBalancerHandler(writer http.ResponseWriter, request *http.Request) {
-    peer := serverpool.GetNextPeer()
-    if peer != nil {
-        peer.ReverseProxy.ServeHTTP(writer, request)
+    hedge := serverpool.hedge.Load()
+    if hedge != nil {
+        hedge.deposit()
+    }
+    if config := serverpool.retry.Load(); config != nil && serverpool.hooks.Load() == nil {
+        serverpool.serveWithRetryAfter(config, writer, request)
+        return
+    }
+    if hooks := serverpool.hooks.Load(); hooks != nil {
+        serverpool.serveWithHooks(hooks, writer, request)
+        return
+    }
+    if hedge != nil && isIdempotent(request.Method) && (request.Body == nil || request.Body == http.NoBody) {
+        serverpool.serveHedged(hedge, writer, request)
+        return
+    }
+
+    peer, err := serverpool.pick(request, nil)
+    if err != nil {
+        serverpool.writeError(writer, err)
         return
     }
-    http.Error(writer, "Service not available", http.StatusServiceUnavailable)
+    serverpool.forward(peer, peer.ReverseProxy, writer, request)
 }
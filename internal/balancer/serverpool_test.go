@@ -27,8 +27,8 @@ func TestNewServerPool(t *testing.T) {
         t.Error("Expected backends slice to be nil initially")
     }
     
-    if pool.current != 0 {
-        t.Errorf("Expected current to be 0, got %d", pool.current)
+    if pool.current.Load() != 0 {
+        t.Errorf("Expected current to be 0, got %d", pool.current.Load())
     }
 }
 
@@ -309,8 +309,8 @@ func TestServerPool_ConcurrentAccess(t *testing.T) {
     wg.Wait()
 
     expectedCurrent := uint64(numGoroutines * numOperations)
-    if pool.current != expectedCurrent {
-        t.Logf("Current counter: %d, expected around: %d", pool.current, expectedCurrent)
+    if pool.current.Load() != expectedCurrent {
+        t.Logf("Current counter: %d, expected around: %d", pool.current.Load(), expectedCurrent)
     }
 }
 
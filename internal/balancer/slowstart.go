@@ -0,0 +1,72 @@
+package balancer
+
+import (
+    "log"
+    "math/rand"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+// SlowStartConfig ramps a backend's share of traffic up over Duration when
+// it comes back into rotation, whether from a health check, warm-up or
+// preflight, so a cold instance is not crashed again by a full share of
+// requests. Its share starts at Initial (default 0.1) of what it would
+// otherwise get and grows linearly to all of it. While ramping, a backend
+// is passed over for the rest of the share and only picked in full when no
+// other backend can take the request, as with deprioritized backends.
+type SlowStartConfig struct {
+    Duration time.Duration
+    Initial  float64
+}
+
+// SetSlowStart enables slow start for backends coming up from now on; a
+// zero Duration disables it.
+func (serverpool *ServerPool) SetSlowStart(config SlowStartConfig) {
+    if config.Duration <= 0 {
+        serverpool.slowStart.Store(nil)
+        return
+    }
+    if config.Initial <= 0 || config.Initial > 1 {
+        config.Initial = 0.1
+    }
+    serverpool.slowStart.Store(&config)
+}
+
+// markUp puts peer back into rotation, ramping it up when the pool slow
+// starts its backends.
+func (serverpool *ServerPool) markUp(peer *backend.Backend) {
+    peer.SetAlive(true)
+    if config := serverpool.slowStart.Load(); config != nil {
+        serverpool.ramping.Store(peer, time.Now())
+        log.Printf("%s [up, slow start over %s]\n", peer.URL, config.Duration)
+        return
+    }
+    log.Printf("%s [up]\n", peer.URL)
+}
+
+// rampShare is the share of its traffic peer gets at now: below one while it
+// is slow starting, one otherwise.
+func (serverpool *ServerPool) rampShare(peer *backend.Backend, now time.Time) float64 {
+    config := serverpool.slowStart.Load()
+    if config == nil {
+        return 1
+    }
+    value, ok := serverpool.ramping.Load(peer)
+    if !ok {
+        return 1
+    }
+    elapsed := now.Sub(value.(time.Time))
+    if elapsed >= config.Duration {
+        serverpool.ramping.CompareAndDelete(peer, value)
+        return 1
+    }
+    return config.Initial + (1-config.Initial)*float64(elapsed)/float64(config.Duration)
+}
+
+// holdBack reports whether peer, slow starting, should be passed over for
+// this request.
+func (serverpool *ServerPool) holdBack(peer *backend.Backend, now time.Time) bool {
+    share := serverpool.rampShare(peer, now)
+    return share < 1 && rand.Float64() >= share
+}
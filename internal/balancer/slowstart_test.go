@@ -0,0 +1,94 @@
+package balancer
+
+import (
+    "context"
+    "io"
+    "log"
+    "os"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+func TestServerPool_SlowStart(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    tests := []struct {
+        name     string
+        strategy string
+    }{
+        {name: "built-in round robin"},
+        {name: "strategy", strategy: "least_connections"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backends := newStrategyBackends("warm", "cold")
+            warm, cold := backends[0], backends[1]
+            cold.SetAlive(false)
+
+            pool := NewServerPool()
+            pool.SetBackends(backends)
+            pool.SetSlowStart(SlowStartConfig{Duration: time.Hour, Initial: 0.2})
+            if tt.strategy != "" {
+                strategy, _ := NewStrategy(StrategyConfig{Name: tt.strategy})
+                pool.SetStrategy(strategy)
+            }
+
+            // The health check finds the cold backend up again.
+            pool.checkBackend(context.Background(), func(ctx context.Context, peer *backend.Backend) error { return nil }, cold)
+            if !cold.IsAlive() {
+                t.Fatal("Expected the backend back in rotation")
+            }
+
+            picks := 0
+            for i := 0; i < 2000; i++ {
+                if pool.GetNextPeer() == cold {
+                    picks++
+                }
+            }
+            // At a fifth of its share, the cold backend gets a tenth of the
+            // traffic rather than half.
+            if picks < 100 || picks > 320 {
+                t.Errorf("Expected about 200 of 2000 picks while slow starting, got %d", picks)
+            }
+
+            warm.SetAlive(false)
+            if peer := pool.GetNextPeer(); peer != cold {
+                t.Errorf("Expected the slow-starting backend when it is the only one, got %v", peer)
+            }
+        })
+    }
+}
+
+func TestServerPool_SlowStartRamp(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    backends := newStrategyBackends("a")
+    pool := NewServerPool()
+    pool.SetBackends(backends)
+    pool.SetSlowStart(SlowStartConfig{Duration: 10 * time.Second})
+
+    pool.markUp(backends[0])
+    value, _ := pool.ramping.Load(backends[0])
+    start := value.(time.Time)
+    tests := []struct {
+        elapsed  time.Duration
+        expected float64
+    }{
+        {elapsed: 0, expected: 0.1},
+        {elapsed: 5 * time.Second, expected: 0.55},
+        {elapsed: 10 * time.Second, expected: 1},
+    }
+    for _, tt := range tests {
+        if share := pool.rampShare(backends[0], start.Add(tt.elapsed)); share < tt.expected-0.01 || share > tt.expected+0.01 {
+            t.Errorf("Expected share %v after %s, got %v", tt.expected, tt.elapsed, share)
+        }
+    }
+    if _, ramping := pool.ramping.Load(backends[0]); ramping {
+        t.Error("Expected the backend to stop ramping once its window ends")
+    }
+}
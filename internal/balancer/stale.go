@@ -0,0 +1,223 @@
+package balancer
+
+import (
+    "bytes"
+    "container/list"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "load-balancer/internal/metrics"
+    "load-balancer/internal/requestid"
+)
+
+// staleDroppedHeaders are not kept with a stored response: hop-by-hop
+// headers, and those describing the request that fetched it rather than
+// the content.
+var staleDroppedHeaders = []string{
+    "Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authenticate", "TE", "Trailer", "Transfer-Encoding", "Upgrade",
+    requestid.Header, "X-Explain", "X-Explain-Id", "Server-Timing",
+}
+
+// Stale keeps the latest 200 response to each of a route's GET requests and
+// serves it, marked with a Warning and X-Served-Stale header, while every
+// backend of the route's pool (and of its fallback pool, if any) is down,
+// rather than answering 503. It suits read-mostly content sites. Responses
+// that are private, no-store, set cookies or vary on everything are not
+// kept, nor are those to requests carrying Authorization or Cookie, which
+// are never answered stale either. At most MaxEntries responses (default
+// 1000) of up to MaxBodyBytes each (default 1 MiB) are kept, for up to
+// MaxAge (default 24 hours); HEAD requests are answered from the GET
+// response.
+type Stale struct {
+    MaxEntries   int
+    MaxBodyBytes int64
+    MaxAge       time.Duration
+
+    mux     sync.Mutex
+    entries map[string]*list.Element
+    order   *list.List
+}
+
+type staleEntry struct {
+    key    string
+    status int
+    header http.Header
+    body   []byte
+    vary   map[string]string
+    stored time.Time
+}
+
+func (stale *Stale) defaults() (int, int64, time.Duration) {
+    maxEntries, maxBodyBytes, maxAge := stale.MaxEntries, stale.MaxBodyBytes, stale.MaxAge
+    if maxEntries <= 0 {
+        maxEntries = 1000
+    }
+    if maxBodyBytes <= 0 {
+        maxBodyBytes = 1 << 20
+    }
+    if maxAge <= 0 {
+        maxAge = 24 * time.Hour
+    }
+    return maxEntries, maxBodyBytes, maxAge
+}
+
+func staleKey(request *http.Request) string {
+    return request.Host + " " + request.URL.RequestURI()
+}
+
+func staleCacheable(request *http.Request) bool {
+    return (request.Method == http.MethodGet || request.Method == http.MethodHead) && request.Header.Get("Authorization") == "" && request.Header.Get("Cookie") == ""
+}
+
+// serve answers request from the stored response, reporting whether there
+// was one to answer with.
+func (stale *Stale) serve(writer http.ResponseWriter, request *http.Request, route string, registry *metrics.Registry) bool {
+    if !staleCacheable(request) {
+        return false
+    }
+    _, _, maxAge := stale.defaults()
+
+    stale.mux.Lock()
+    element, ok := stale.entries[staleKey(request)]
+    var entry *staleEntry
+    if ok {
+        entry = element.Value.(*staleEntry)
+    }
+    stale.mux.Unlock()
+    if entry == nil || time.Since(entry.stored) > maxAge {
+        return false
+    }
+    for name, value := range entry.vary {
+        if request.Header.Get(name) != value {
+            return false
+        }
+    }
+
+    header := writer.Header()
+    for key, values := range entry.header {
+        header[key] = values
+    }
+    age := int(time.Since(entry.stored).Seconds())
+    if previous, err := strconv.Atoi(entry.header.Get("Age")); err == nil {
+        age += previous
+    }
+    header.Set("Age", strconv.Itoa(age))
+    header.Add("Warning", `111 - "Revalidation Failed"`)
+    header.Set("X-Served-Stale", "1")
+    writer.WriteHeader(entry.status)
+    if request.Method != http.MethodHead {
+        writer.Write(entry.body)
+    }
+    registry.Counter("lb_stale_responses_total", "Responses served from the stale cache while the pool was down.", "route", route).Inc()
+    return true
+}
+
+// record returns a writer that passes the response through and stores it
+// once store is called, if it may be kept.
+func (stale *Stale) record(writer http.ResponseWriter, request *http.Request) *staleWriter {
+    _, maxBodyBytes, _ := stale.defaults()
+    return &staleWriter{ResponseWriter: writer, limit: maxBodyBytes, keep: request.Method == http.MethodGet && staleCacheable(request)}
+}
+
+func (stale *Stale) store(request *http.Request, recorded *staleWriter) {
+    if !recorded.keep || recorded.status != http.StatusOK || recorded.header == nil {
+        return
+    }
+    cacheControl := strings.ToLower(strings.Join(recorded.header.Values("Cache-Control"), ","))
+    if strings.Contains(cacheControl, "no-store") || strings.Contains(cacheControl, "private") || recorded.header.Get("Set-Cookie") != "" {
+        return
+    }
+    vary := make(map[string]string)
+    for _, value := range recorded.header.Values("Vary") {
+        for _, name := range strings.Split(value, ",") {
+            name = strings.TrimSpace(name)
+            if name == "*" {
+                return
+            }
+            if name != "" {
+                vary[http.CanonicalHeaderKey(name)] = request.Header.Get(name)
+            }
+        }
+    }
+
+    maxEntries, _, _ := stale.defaults()
+    entry := &staleEntry{key: staleKey(request), status: recorded.status, header: staleHeader(recorded.header), body: recorded.body.Bytes(), vary: vary, stored: time.Now()}
+
+    stale.mux.Lock()
+    defer stale.mux.Unlock()
+    if stale.entries == nil {
+        stale.entries = make(map[string]*list.Element)
+        stale.order = list.New()
+    }
+    if element, ok := stale.entries[entry.key]; ok {
+        element.Value = entry
+        stale.order.MoveToFront(element)
+        return
+    }
+    stale.entries[entry.key] = stale.order.PushFront(entry)
+    for stale.order.Len() > maxEntries {
+        oldest := stale.order.Back()
+        stale.order.Remove(oldest)
+        delete(stale.entries, oldest.Value.(*staleEntry).key)
+    }
+}
+
+// staleHeader is header without staleDroppedHeaders and the headers
+// Connection names.
+func staleHeader(header http.Header) http.Header {
+    kept := header.Clone()
+    for _, value := range header.Values("Connection") {
+        for _, name := range strings.Split(value, ",") {
+            kept.Del(strings.TrimSpace(name))
+        }
+    }
+    for _, name := range staleDroppedHeaders {
+        kept.Del(name)
+    }
+    return kept
+}
+
+// staleWriter copies the response it passes through, giving up on keeping
+// it once the body runs over limit.
+type staleWriter struct {
+    http.ResponseWriter
+    limit  int64
+    keep   bool
+    status int
+    header http.Header
+    body   bytes.Buffer
+}
+
+func (writer *staleWriter) WriteHeader(status int) {
+    if writer.status == 0 && status >= http.StatusOK {
+        writer.status = status
+        writer.header = writer.ResponseWriter.Header().Clone()
+    }
+    writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *staleWriter) Write(p []byte) (int, error) {
+    if writer.status == 0 {
+        writer.WriteHeader(http.StatusOK)
+    }
+    if writer.keep {
+        if int64(writer.body.Len()+len(p)) > writer.limit {
+            writer.keep = false
+            writer.body = bytes.Buffer{}
+        } else {
+            writer.body.Write(p)
+        }
+    }
+    return writer.ResponseWriter.Write(p)
+}
+
+func (writer *staleWriter) Flush() {
+    http.NewResponseController(writer.ResponseWriter).Flush()
+}
+
+func (writer *staleWriter) Unwrap() http.ResponseWriter {
+    return writer.ResponseWriter
+}
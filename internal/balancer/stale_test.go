@@ -0,0 +1,105 @@
+package balancer
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "testing"
+
+    "load-balancer/internal/backend"
+)
+
+func TestRouter_ServeStale(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/private":
+            w.Header().Set("Cache-Control", "private")
+        case "/cookie":
+            w.Header().Set("Set-Cookie", "session=1")
+        case "/missing":
+            w.WriteHeader(http.StatusNotFound)
+        }
+        w.Header().Set("Content-Type", "text/plain")
+        w.Header().Set("X-Request-Id", "fetching-request")
+        w.Header().Set("Connection", "X-Hop")
+        w.Header().Set("X-Hop", "1")
+        w.Write([]byte("content of " + r.URL.Path))
+    }))
+    defer server.Close()
+
+    serverURL, _ := url.Parse(server.URL)
+    peer := &backend.Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)}
+    pool := NewServerPool()
+    pool.AddBackend(peer)
+    router := NewRouter("site")
+    router.AddPool("site", pool)
+    router.AddRoute(Route{Name: "site", Pool: "site", Stale: &Stale{MaxEntries: 10}})
+
+    for _, path := range []string{"/page", "/private", "/cookie", "/missing"} {
+        rr := httptest.NewRecorder()
+        router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+        if rr.Header().Get("X-Served-Stale") != "" {
+            t.Fatalf("Expected a fresh response for %s while the pool is up", path)
+        }
+    }
+    personal := httptest.NewRequest("GET", "/mine", nil)
+    personal.Header.Set("Cookie", "session=1")
+    router.ServeHTTP(httptest.NewRecorder(), personal)
+    peer.SetAlive(false)
+
+    tests := []struct {
+        name           string
+        method         string
+        path           string
+        authorization  string
+        cookie         string
+        expectedStatus int
+        expectedBody   string
+    }{
+        {name: "kept response", method: "GET", path: "/page", expectedStatus: http.StatusOK, expectedBody: "content of /page"},
+        {name: "head from kept response", method: "HEAD", path: "/page", expectedStatus: http.StatusOK},
+        {name: "never fetched", method: "GET", path: "/other", expectedStatus: http.StatusServiceUnavailable},
+        {name: "private response", method: "GET", path: "/private", expectedStatus: http.StatusServiceUnavailable},
+        {name: "response setting a cookie", method: "GET", path: "/cookie", expectedStatus: http.StatusServiceUnavailable},
+        {name: "error response", method: "GET", path: "/missing", expectedStatus: http.StatusServiceUnavailable},
+        {name: "authorized request", method: "GET", path: "/page", authorization: "Bearer x", expectedStatus: http.StatusServiceUnavailable},
+        {name: "request with a cookie", method: "GET", path: "/page", cookie: "session=1", expectedStatus: http.StatusServiceUnavailable},
+        {name: "response to a request with a cookie", method: "GET", path: "/mine", expectedStatus: http.StatusServiceUnavailable},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            request := httptest.NewRequest(tt.method, tt.path, nil)
+            if tt.authorization != "" {
+                request.Header.Set("Authorization", tt.authorization)
+            }
+            if tt.cookie != "" {
+                request.Header.Set("Cookie", tt.cookie)
+            }
+            rr := httptest.NewRecorder()
+            router.ServeHTTP(rr, request)
+
+            if rr.Code != tt.expectedStatus {
+                t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+            }
+            if tt.expectedStatus != http.StatusOK {
+                return
+            }
+            if rr.Body.String() != tt.expectedBody {
+                t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body.String())
+            }
+            if rr.Header().Get("X-Served-Stale") != "1" || rr.Header().Get("Warning") == "" || rr.Header().Get("Age") == "" {
+                t.Errorf("Expected the response marked stale, got headers %v", rr.Header())
+            }
+            if rr.Header().Get("Content-Type") != "text/plain" {
+                t.Errorf("Expected the kept headers, got %v", rr.Header())
+            }
+            for _, name := range []string{"X-Request-Id", "Connection", "X-Hop"} {
+                if value := rr.Header().Get(name); value != "" {
+                    t.Errorf("Expected %s not kept, got %q", name, value)
+                }
+            }
+        })
+    }
+}
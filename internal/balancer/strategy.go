@@ -0,0 +1,1089 @@
+package balancer
+
+import (
+    "fmt"
+    "hash/fnv"
+    "math"
+    "math/rand"
+    "net/http"
+    "net/http/httputil"
+    "slices"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/clientip"
+)
+
+// Strategy picks a backend for a request from the pool's candidates: the
+// alive, non-draining backends that are not deprioritized, or all alive,
+// non-draining backends when every one of them is. request is nil for
+// selections made outside a request, such as GetNextPeer.
+type Strategy interface {
+    Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend
+}
+
+// LatencyObserver is implemented by strategies that learn from how long
+// backends take to answer.
+type LatencyObserver interface {
+    Observe(peer *backend.Backend, elapsed time.Duration)
+}
+
+// MembershipObserver is implemented by strategies that precompute over the
+// pool's backends or keep state for each of them. The pool tells them its
+// full membership, whatever the backends' health, when the strategy is set
+// and whenever backends are added or replaced.
+type MembershipObserver interface {
+    SetMembers(backends []*backend.Backend)
+}
+
+// StrategyConfig names a registered strategy and its parameters, as they
+// appear in a pool's configuration.
+type StrategyConfig struct {
+    Name   string            `json:"name"`
+    Params map[string]string `json:"params,omitempty"`
+}
+
+type StrategyFactory func(params map[string]string) (Strategy, error)
+
+var (
+    strategiesMux sync.RWMutex
+    strategies    = map[string]StrategyFactory{
+        "round_robin": newRoundRobin,
+        "random":      newRandom,
+        "hash":        newHashStrategy,
+        "rendezvous":  newHashStrategy,
+        "ip_hash":     newIPHashStrategy,
+        "path_hash":   newPathHashStrategy,
+        "ring_hash":   newRingHashStrategy,
+        "maglev":      newMaglevStrategy,
+        "ewma":        newEWMAStrategy,
+        "p2c":         newP2CStrategy,
+
+        "weighted_round_robin": newWeightedRoundRobin,
+        "least_bandwidth":      newLeastBandwidth,
+        "least_streams":        newLeastStreams,
+        "least_rtt":            newLeastRTT,
+        "least_connections":    newLeastConnections,
+        "reported_load":        newReportedLoad,
+
+        "weighted_least_connections": newWeightedLeastConnections,
+    }
+)
+
+// RegisterStrategy makes a strategy available to NewStrategy by name,
+// replacing any strategy already registered under it.
+func RegisterStrategy(name string, factory StrategyFactory) {
+    strategiesMux.Lock()
+    strategies[name] = factory
+    strategiesMux.Unlock()
+}
+
+func NewStrategy(config StrategyConfig) (Strategy, error) {
+    strategiesMux.RLock()
+    factory, ok := strategies[config.Name]
+    strategiesMux.RUnlock()
+    if !ok {
+        return nil, fmt.Errorf("unknown strategy %q", config.Name)
+    }
+    strategy, err := factory(config.Params)
+    if err != nil {
+        return nil, fmt.Errorf("strategy %s: %w", config.Name, err)
+    }
+    return strategy, nil
+}
+
+// SetStrategy replaces the pool's selection strategy; nil restores the
+// built-in round robin.
+func (serverpool *ServerPool) SetStrategy(strategy Strategy) {
+    serverpool.strategyConfig.Store(nil)
+    if strategy == nil {
+        serverpool.strategy.Store(nil)
+        return
+    }
+    serverpool.strategy.Store(&strategy)
+    serverpool.announceMembers()
+}
+
+// UseStrategy switches the pool to the registered strategy config names.
+// The swap is atomic: requests already sent keep the backend they were
+// given, and the next pick uses the new strategy.
+func (serverpool *ServerPool) UseStrategy(config StrategyConfig) error {
+    strategy, err := NewStrategy(config)
+    if err != nil {
+        return err
+    }
+    serverpool.strategy.Store(&strategy)
+    serverpool.strategyConfig.Store(&config)
+    serverpool.announceMembers()
+    return nil
+}
+
+// announceMembers tells the pool's strategy, if it observes membership,
+// the pool's current backends.
+func (serverpool *ServerPool) announceMembers() {
+    if strategy := serverpool.strategy.Load(); strategy != nil {
+        if observer, ok := (*strategy).(MembershipObserver); ok {
+            observer.SetMembers(serverpool.Backends())
+        }
+    }
+}
+
+// StrategyConfig returns the config of the strategy set by UseStrategy, and
+// false when the pool uses the built-in round robin or a strategy set
+// directly with SetStrategy.
+func (serverpool *ServerPool) StrategyConfig() (StrategyConfig, bool) {
+    if config := serverpool.strategyConfig.Load(); config != nil && serverpool.strategy.Load() != nil {
+        return *config, true
+    }
+    return StrategyConfig{}, false
+}
+
+// candidates returns the backends a strategy may pick from, all of the
+// active tier.
+func (serverpool *ServerPool) candidates(backends []*backend.Backend, exclude map[*backend.Backend]bool, now time.Time) []*backend.Backend {
+    tier := serverpool.activeTier(backends, exclude)
+    var preferred, fallback []*backend.Backend
+    for _, peer := range backends {
+        if peer.Tier != tier || !serverpool.available(peer, exclude) {
+            continue
+        }
+        if peer.Deprioritized(now) || serverpool.holdBack(peer, now) {
+            fallback = append(fallback, peer)
+            continue
+        }
+        preferred = append(preferred, peer)
+    }
+    if len(preferred) == 0 {
+        return fallback
+    }
+    return preferred
+}
+
+// hasCandidate reports whether any backend outside exclude could take a
+// request. Unlike nextPeer it picks nothing, so the strategy, the round
+// robin index and slow start are left as they were.
+func (serverpool *ServerPool) hasCandidate(exclude map[*backend.Backend]bool) bool {
+    serverpool.mux.RLock()
+    defer serverpool.mux.RUnlock()
+
+    for _, peer := range serverpool.backends {
+        if serverpool.available(peer, exclude) {
+            return true
+        }
+    }
+    return false
+}
+
+// forward sends request to peer through handler, enforcing the route's
+// response size limit, guarding against invalid responses and showing the
+// strategy the responses or elapsed times when it learns from them, as
+// well as the automatic weighting when it runs.
+func (serverpool *ServerPool) forward(peer *backend.Backend, handler http.Handler, writer http.ResponseWriter, request *http.Request) {
+    if explanation := explaining(request); explanation != nil {
+        explanation.note("backend", peer.URL.String())
+        explanation.add("attempt", "sent to %s", peer.URL)
+        start := time.Now()
+        defer func() { explanation.add("attempt", "%s finished after %s", peer.URL, time.Since(start).Round(time.Microsecond)) }()
+    }
+    writer = limitResponse(peer, writer, request)
+    strategy := serverpool.strategy.Load()
+    if strategy != nil {
+        if observer, ok := (*strategy).(ResponseObserver); ok {
+            if proxy, ok := handler.(*httputil.ReverseProxy); ok {
+                handler = observeResponses(observer, peer, proxy)
+            }
+        }
+    }
+    if config := serverpool.protocol.Load(); config != nil {
+        if proxy, ok := handler.(*httputil.ReverseProxy); ok {
+            handler = serverpool.guardProtocol(config, peer, proxy)
+        }
+    }
+    var observer LatencyObserver
+    if strategy != nil {
+        observer, _ = (*strategy).(LatencyObserver)
+    }
+    weighting := serverpool.autoWeight.Load()
+    if observer == nil && weighting == nil {
+        peer.Forward(handler, writer, request)
+        return
+    }
+    start := time.Now()
+    peer.Forward(handler, writer, request)
+    if backend.ClientGone(request) {
+        return
+    }
+    elapsed := time.Since(start)
+    if observer != nil {
+        observer.Observe(peer, elapsed)
+    }
+    if weighting != nil {
+        weighting.observe(peer, elapsed)
+    }
+}
+
+type roundRobin struct {
+    next atomic.Uint64
+}
+
+func newRoundRobin(params map[string]string) (Strategy, error) {
+    return &roundRobin{}, nil
+}
+
+func (strategy *roundRobin) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    if len(candidates) == 0 {
+        return nil
+    }
+    return candidates[strategy.next.Add(1)%uint64(len(candidates))]
+}
+
+// random picks uniformly among the candidates. Unlike round robin it keeps
+// no position, so load balancers sharing a fleet cannot fall into step and
+// send their requests to the same backends in waves.
+type random struct{}
+
+func newRandom(params map[string]string) (Strategy, error) {
+    return random{}, nil
+}
+
+func (random) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    if len(candidates) == 0 {
+        return nil
+    }
+    return candidates[rand.Intn(len(candidates))]
+}
+
+// hashStrategy maps each request key to a backend with rendezvous hashing,
+// so only the keys of a removed backend move when membership changes.
+// Scores are weighted by the backends' weights, so a backend with twice
+// the weight owns twice the keys and one with a weight of zero none; equal
+// weights leave the mapping as unweighted rendezvous hashing has it. The
+// key param is "ip" (default), "host", "path", "header:<name>" or
+// "cookie:<name>". With the ip key, trusted_proxies lists the CIDRs of
+// proxies in front of the balancer whose X-Forwarded-For is believed, so
+// clients behind them are told apart. A header or cookie key, such as
+// "header:X-Tenant-ID" to pin each tenant to a backend, may be missing from
+// a request; such requests have nothing to pin them and go round robin.
+type hashStrategy struct {
+    key    func(request *http.Request) string
+    absent roundRobin
+}
+
+// newIPHashStrategy is the hash strategy keyed by client address.
+func newIPHashStrategy(params map[string]string) (Strategy, error) {
+    if key := params["key"]; key != "" && key != "ip" {
+        return nil, fmt.Errorf("ip_hash does not take a key, got %q", key)
+    }
+    return newHashStrategy(params)
+}
+
+func newHashStrategy(params map[string]string) (Strategy, error) {
+    key, err := hashKey(params)
+    if err != nil {
+        return nil, err
+    }
+    return &hashStrategy{key: key}, nil
+}
+
+// hashKey builds the request key of the hash strategies from their key and
+// trusted_proxies params.
+func hashKey(params map[string]string) (func(request *http.Request) string, error) {
+    key := params["key"]
+    if params["trusted_proxies"] != "" && key != "" && key != "ip" {
+        return nil, fmt.Errorf("trusted_proxies only applies to the ip hash key")
+    }
+    switch {
+    case key == "" || key == "ip":
+        trusted, err := clientip.ParseTrusted(params["trusted_proxies"])
+        if err != nil {
+            return nil, err
+        }
+        return func(request *http.Request) string { return clientip.FromRequest(request, trusted) }, nil
+    case key == "host":
+        return func(request *http.Request) string { return request.Host }, nil
+    case key == "path":
+        return func(request *http.Request) string { return request.URL.Path }, nil
+    case strings.HasPrefix(key, "header:"):
+        name := strings.TrimPrefix(key, "header:")
+        return func(request *http.Request) string { return request.Header.Get(name) }, nil
+    case strings.HasPrefix(key, "cookie:"):
+        name := strings.TrimPrefix(key, "cookie:")
+        return func(request *http.Request) string {
+            if cookie, err := request.Cookie(name); err == nil {
+                return cookie.Value
+            }
+            return ""
+        }, nil
+    }
+    return nil, fmt.Errorf("unsupported hash key %q", key)
+}
+
+func (strategy *hashStrategy) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    if len(candidates) == 0 {
+        return nil
+    }
+    key := ""
+    if request != nil {
+        key = strategy.key(request)
+        if key == "" {
+            return strategy.absent.Pick(request, candidates)
+        }
+    }
+
+    now := time.Now()
+    var best *backend.Backend
+    var bestScore float64
+    for _, peer := range candidates {
+        weight, _ := peer.Weight(now)
+        if weight <= 0 {
+            continue
+        }
+        hash := fnv.New64a()
+        hash.Write([]byte(peer.URL.String()))
+        hash.Write([]byte{0})
+        hash.Write([]byte(key))
+        // -weight/ln(u) for u uniform in (0, 1) is the weighted rendezvous
+        // score; it orders equal weights as u itself does.
+        u := (float64(mix(hash.Sum64())>>11) + 0.5) / (1 << 53)
+        if score := -weight / math.Log(u); best == nil || score > bestScore {
+            best, bestScore = peer, score
+        }
+    }
+    return best
+}
+
+// mix is the splitmix64 finalizer. FNV-1a alone barely changes the high
+// bits for keys differing in their last bytes, which would send most keys
+// to the same backend.
+func mix(x uint64) uint64 {
+    x ^= x >> 30
+    x *= 0xbf58476d1ce4e5b9
+    x ^= x >> 27
+    x *= 0x94d049bb133111eb
+    return x ^ x>>31
+}
+
+// ringHash maps each request key to a backend on a consistent-hash ring,
+// on which every backend owns vnodes points (default 100, at most
+// maxVnodes), so adding or removing a backend only remaps about its share
+// of the keys. It takes the same key and trusted_proxies params as the
+// hash strategy, and likewise sends requests missing their key round robin.
+// The ring holds every member of the pool and is only rebuilt when the
+// membership changes; a key whose backend is not a candidate, because it
+// is down, held back or already tried, walks on to the next point that is.
+type ringHash struct {
+    key    func(request *http.Request) string
+    vnodes int
+    absent roundRobin
+
+    mux       sync.RWMutex
+    announced bool
+    members   map[*backend.Backend]bool
+    points    []ringPoint
+}
+
+type ringPoint struct {
+    hash uint64
+    peer *backend.Backend
+}
+
+// maxVnodes bounds the ring at a few megabytes for a pool of a thousand
+// backends.
+const maxVnodes = 1000
+
+func newRingHashStrategy(params map[string]string) (Strategy, error) {
+    key, err := hashKey(params)
+    if err != nil {
+        return nil, err
+    }
+    vnodes := 100
+    if value := params["vnodes"]; value != "" {
+        parsed, err := strconv.Atoi(value)
+        if err != nil || parsed <= 0 || parsed > maxVnodes {
+            return nil, fmt.Errorf("invalid vnodes %q: must be between 1 and %d", value, maxVnodes)
+        }
+        vnodes = parsed
+    }
+    return &ringHash{key: key, vnodes: vnodes, members: make(map[*backend.Backend]bool)}, nil
+}
+
+// newPathHashStrategy is the ring hash strategy keyed by request path, so
+// each path keeps hitting the backend whose local cache holds it and a
+// backend going down only moves its own paths. With query set to true the
+// query string is part of the key, for backends caching by full URL.
+func newPathHashStrategy(params map[string]string) (Strategy, error) {
+    if key := params["key"]; key != "" {
+        return nil, fmt.Errorf("path_hash does not take a key, got %q", key)
+    }
+    query := false
+    if value := params["query"]; value != "" {
+        parsed, err := strconv.ParseBool(value)
+        if err != nil {
+            return nil, fmt.Errorf("invalid query %q", value)
+        }
+        query = parsed
+    }
+    strategy, err := newRingHashStrategy(map[string]string{"key": "path", "vnodes": params["vnodes"]})
+    if err != nil {
+        return nil, err
+    }
+    if query {
+        strategy.(*ringHash).key = func(request *http.Request) string { return request.URL.RequestURI() }
+    }
+    return strategy, nil
+}
+
+func (strategy *ringHash) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    if len(candidates) == 0 {
+        return nil
+    }
+    key := ""
+    if request != nil {
+        key = strategy.key(request)
+        if key == "" {
+            return strategy.absent.Pick(request, candidates)
+        }
+    }
+    hash := fnv.New64a()
+    hash.Write([]byte(key))
+    point := mix(hash.Sum64())
+
+    strategy.mux.RLock()
+    if !strategy.holds(candidates) {
+        strategy.mux.RUnlock()
+        strategy.mux.Lock()
+        if !strategy.holds(candidates) {
+            if !strategy.announced {
+                strategy.members = make(map[*backend.Backend]bool, len(candidates))
+            }
+            for _, peer := range candidates {
+                strategy.members[peer] = true
+            }
+            strategy.build()
+        }
+        strategy.mux.Unlock()
+        strategy.mux.RLock()
+    }
+    defer strategy.mux.RUnlock()
+
+    points := strategy.points
+    start := sort.Search(len(points), func(i int) bool { return points[i].hash >= point })
+    for i := range points {
+        if peer := points[(start+i)%len(points)].peer; slices.Contains(candidates, peer) {
+            return peer
+        }
+    }
+    return nil
+}
+
+// SetMembers rebuilds the ring for the pool's backends, dropping those that
+// left it.
+func (strategy *ringHash) SetMembers(backends []*backend.Backend) {
+    strategy.mux.Lock()
+    defer strategy.mux.Unlock()
+
+    strategy.announced = true
+    strategy.members = make(map[*backend.Backend]bool, len(backends))
+    for _, peer := range backends {
+        strategy.members[peer] = true
+    }
+    strategy.build()
+}
+
+// holds reports whether every candidate is on the ring. Otherwise Pick adds
+// them, or, for a strategy used outside a pool, builds the ring for just
+// the candidates.
+func (strategy *ringHash) holds(candidates []*backend.Backend) bool {
+    for _, peer := range candidates {
+        if !strategy.members[peer] {
+            return false
+        }
+    }
+    return true
+}
+
+// build places the members' virtual nodes on the ring.
+func (strategy *ringHash) build() {
+    points := make([]ringPoint, 0, len(strategy.members)*strategy.vnodes)
+    for peer := range strategy.members {
+        for i := 0; i < strategy.vnodes; i++ {
+            hash := fnv.New64a()
+            hash.Write([]byte(peer.URL.String()))
+            hash.Write([]byte{0})
+            hash.Write([]byte(strconv.Itoa(i)))
+            points = append(points, ringPoint{hash: mix(hash.Sum64()), peer: peer})
+        }
+    }
+    sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+    strategy.points = points
+}
+
+// maglev maps each request key to a backend through a Maglev lookup table
+// of table_size slots (a prime, default 65537, at most maxMaglevSize), so a
+// pick costs one hash and one table read rather than a hash per backend,
+// and membership changes move few more keys than those of the backends
+// that left. It takes the same key and trusted_proxies params as the hash
+// strategy, and likewise sends requests missing their key round robin. The
+// table holds every member of the pool; a slot whose backend is not a
+// candidate probes on to the next one that is. When the membership changes
+// the table is rebuilt in the background, and until it is ready, slots of
+// backends that went away probe on the same way.
+type maglev struct {
+    key    func(request *http.Request) string
+    size   int
+    absent roundRobin
+
+    table atomic.Pointer[maglevTable]
+
+    mux       sync.Mutex
+    announced bool
+    building  bool
+    pending   []*backend.Backend
+}
+
+type maglevTable struct {
+    members []*backend.Backend
+    entries []int32
+}
+
+// maxMaglevSize bounds the table at a few megabytes; Maglev wants it about
+// a hundred times the number of backends.
+const maxMaglevSize = 1000003
+
+func newMaglevStrategy(params map[string]string) (Strategy, error) {
+    key, err := hashKey(params)
+    if err != nil {
+        return nil, err
+    }
+    size := 65537
+    if value := params["table_size"]; value != "" {
+        parsed, err := strconv.Atoi(value)
+        if err != nil || parsed > maxMaglevSize || !prime(parsed) {
+            return nil, fmt.Errorf("invalid table_size %q: must be a prime of at most %d", value, maxMaglevSize)
+        }
+        size = parsed
+    }
+    return &maglev{key: key, size: size}, nil
+}
+
+func (strategy *maglev) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    if len(candidates) == 0 {
+        return nil
+    }
+    key := ""
+    if request != nil {
+        key = strategy.key(request)
+        if key == "" {
+            return strategy.absent.Pick(request, candidates)
+        }
+    }
+    hash := fnv.New64a()
+    hash.Write([]byte(key))
+    point := mix(hash.Sum64())
+
+    table := strategy.table.Load()
+    if table == nil || len(table.members) == 0 {
+        table = buildMaglev(slices.Clone(candidates), strategy.size)
+        strategy.table.Store(table)
+    }
+    slot := int(point % uint64(strategy.size))
+    if peer := table.members[table.entries[slot]]; slices.Contains(candidates, peer) {
+        return peer
+    }
+
+    for _, peer := range candidates {
+        if !slices.Contains(table.members, peer) {
+            strategy.grow(table, candidates)
+            break
+        }
+    }
+    for i := 1; i < len(table.entries); i++ {
+        if peer := table.members[table.entries[(slot+i)%len(table.entries)]]; slices.Contains(candidates, peer) {
+            return peer
+        }
+    }
+    return candidates[point%uint64(len(candidates))]
+}
+
+// SetMembers rebuilds the table for the pool's backends, dropping those
+// that left it.
+func (strategy *maglev) SetMembers(backends []*backend.Backend) {
+    strategy.mux.Lock()
+    strategy.announced = true
+    strategy.mux.Unlock()
+    strategy.rebuild(backends)
+}
+
+// grow rebuilds the table to take in candidates it lacks: added to the
+// announced members, or, for a strategy used outside a pool, in place of
+// them.
+func (strategy *maglev) grow(table *maglevTable, candidates []*backend.Backend) {
+    strategy.mux.Lock()
+    announced := strategy.announced
+    strategy.mux.Unlock()
+
+    members := slices.Clone(candidates)
+    if announced {
+        members = slices.Clone(table.members)
+        for _, peer := range candidates {
+            if !slices.Contains(members, peer) {
+                members = append(members, peer)
+            }
+        }
+    }
+    strategy.rebuild(members)
+}
+
+// rebuild builds a table for members in the background, at most one at a
+// time; changes arriving meanwhile are built next, latest first.
+func (strategy *maglev) rebuild(members []*backend.Backend) {
+    strategy.mux.Lock()
+    defer strategy.mux.Unlock()
+
+    strategy.pending = slices.Clone(members)
+    if strategy.building {
+        return
+    }
+    strategy.building = true
+    go func() {
+        for {
+            strategy.mux.Lock()
+            members := strategy.pending
+            strategy.pending = nil
+            if members == nil {
+                strategy.building = false
+                strategy.mux.Unlock()
+                return
+            }
+            strategy.mux.Unlock()
+            strategy.table.Store(buildMaglev(members, strategy.size))
+        }
+    }()
+}
+
+// buildMaglev fills the table by letting the members take turns claiming
+// the next free slot of their own permutation of the table, as in the
+// Maglev paper.
+func buildMaglev(members []*backend.Backend, size int) *maglevTable {
+    table := &maglevTable{members: members, entries: make([]int32, size)}
+    for i := range table.entries {
+        table.entries[i] = -1
+    }
+    if len(members) == 0 {
+        return table
+    }
+
+    offsets := make([]uint64, len(members))
+    skips := make([]uint64, len(members))
+    next := make([]uint64, len(members))
+    for i, peer := range members {
+        hash := fnv.New64a()
+        hash.Write([]byte(peer.URL.String()))
+        sum := hash.Sum64()
+        offsets[i] = mix(sum) % uint64(size)
+        skips[i] = mix(sum^0x9e3779b97f4a7c15)%uint64(size-1) + 1
+    }
+    for filled := 0; ; {
+        for i := range members {
+            slot := (offsets[i] + next[i]*skips[i]) % uint64(size)
+            for table.entries[slot] >= 0 {
+                next[i]++
+                slot = (offsets[i] + next[i]*skips[i]) % uint64(size)
+            }
+            table.entries[slot] = int32(i)
+            next[i]++
+            if filled++; filled == size {
+                return table
+            }
+        }
+    }
+}
+
+func prime(n int) bool {
+    if n < 2 {
+        return false
+    }
+    for i := 2; i*i <= n; i++ {
+        if n%i == 0 {
+            return false
+        }
+    }
+    return true
+}
+
+// ewmaStrategy prefers the backend with the lowest decayed average latency
+// weighted by its in-flight requests. The decay param is the time constant
+// of the average (default 10s). Backends with no observations are tried
+// first so every backend gets measured, and an average fades toward the
+// candidates' mean while its backend gets no traffic, so a backend avoided
+// for being slow takes spillover again after a few decay periods instead
+// of being shunned for good, without ever looking faster than the rest.
+type ewmaStrategy struct {
+    decay time.Duration
+
+    mux      sync.Mutex
+    averages map[*backend.Backend]*latencyAverage
+}
+
+type latencyAverage struct {
+    value   float64
+    updated time.Time
+}
+
+func newEWMAStrategy(params map[string]string) (Strategy, error) {
+    decay := 10 * time.Second
+    if value := params["decay"]; value != "" {
+        parsed, err := time.ParseDuration(value)
+        if err != nil || parsed <= 0 {
+            return nil, fmt.Errorf("invalid decay %q", value)
+        }
+        decay = parsed
+    }
+    return &ewmaStrategy{decay: decay, averages: make(map[*backend.Backend]*latencyAverage)}, nil
+}
+
+func (strategy *ewmaStrategy) Observe(peer *backend.Backend, elapsed time.Duration) {
+    now := time.Now()
+    strategy.mux.Lock()
+    defer strategy.mux.Unlock()
+
+    average, ok := strategy.averages[peer]
+    if !ok {
+        strategy.averages[peer] = &latencyAverage{value: float64(elapsed), updated: now}
+        return
+    }
+    weight := math.Exp(-float64(now.Sub(average.updated)) / float64(strategy.decay))
+    average.value = average.value*weight + float64(elapsed)*(1-weight)
+    average.updated = now
+}
+
+func (strategy *ewmaStrategy) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    strategy.mux.Lock()
+    defer strategy.mux.Unlock()
+
+    mean := 0.0
+    for _, peer := range candidates {
+        average, ok := strategy.averages[peer]
+        if !ok {
+            return peer
+        }
+        mean += average.value / float64(len(candidates))
+    }
+
+    now := time.Now()
+    var best *backend.Backend
+    bestCost := math.Inf(1)
+    for _, peer := range candidates {
+        average := strategy.averages[peer]
+        latency := mean + (average.value-mean)*math.Exp(-float64(now.Sub(average.updated))/float64(strategy.decay))
+        if cost := latency * float64(peer.InFlight()+1); cost < bestCost {
+            best, bestCost = peer, cost
+        }
+    }
+    return best
+}
+
+// SetMembers forgets the latencies of backends that have left the pool.
+func (strategy *ewmaStrategy) SetMembers(backends []*backend.Backend) {
+    strategy.mux.Lock()
+    forget(strategy.averages, backends)
+    strategy.mux.Unlock()
+}
+
+// p2cStrategy samples choices backends at random (default 2) and picks the
+// one with the fewest in-flight requests.
+type p2cStrategy struct {
+    choices int
+}
+
+func newP2CStrategy(params map[string]string) (Strategy, error) {
+    choices := 2
+    if value := params["choices"]; value != "" {
+        parsed, err := strconv.Atoi(value)
+        if err != nil || parsed < 1 {
+            return nil, fmt.Errorf("invalid choices %q", value)
+        }
+        choices = parsed
+    }
+    return &p2cStrategy{choices: choices}, nil
+}
+
+func (strategy *p2cStrategy) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    if len(candidates) == 0 {
+        return nil
+    }
+    // Sample without shuffling the whole pool: with a handful of choices,
+    // redrawing the rare repeat is cheaper than a permutation per request.
+    sampled := make([]int, 0, min(strategy.choices, len(candidates)))
+    for len(sampled) < cap(sampled) {
+        if i := rand.Intn(len(candidates)); !slices.Contains(sampled, i) {
+            sampled = append(sampled, i)
+        }
+    }
+
+    var best *backend.Backend
+    var bestInFlight int64
+    for _, i := range sampled {
+        if inFlight := candidates[i].InFlight(); best == nil || inFlight < bestInFlight {
+            best, bestInFlight = candidates[i], inFlight
+        }
+    }
+    return best
+}
+
+// weightedRoundRobin is nginx's smooth weighted round robin over the
+// backends' effective weights, so weight transitions shift traffic as they
+// progress. Backends with a weight of zero get no traffic.
+type weightedRoundRobin struct {
+    mux     sync.Mutex
+    current map[*backend.Backend]float64
+}
+
+func newWeightedRoundRobin(params map[string]string) (Strategy, error) {
+    return &weightedRoundRobin{current: make(map[*backend.Backend]float64)}, nil
+}
+
+func (strategy *weightedRoundRobin) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    now := time.Now()
+    strategy.mux.Lock()
+    defer strategy.mux.Unlock()
+
+    var best *backend.Backend
+    total := 0.0
+    for _, peer := range candidates {
+        weight, _ := peer.Weight(now)
+        if weight <= 0 {
+            continue
+        }
+        strategy.current[peer] += weight
+        total += weight
+        if best == nil || strategy.current[peer] > strategy.current[best] {
+            best = peer
+        }
+    }
+    if best != nil {
+        strategy.current[best] -= total
+    }
+    return best
+}
+
+// SetMembers forgets the backends that have left the pool.
+func (strategy *weightedRoundRobin) SetMembers(backends []*backend.Backend) {
+    strategy.mux.Lock()
+    forget(strategy.current, backends)
+    strategy.mux.Unlock()
+}
+
+// forget deletes the state kept for backends that are no longer members,
+// so a strategy does not keep removed backends alive.
+func forget[V any](state map[*backend.Backend]V, members []*backend.Backend) {
+    for peer := range state {
+        if !slices.Contains(members, peer) {
+            delete(state, peer)
+        }
+    }
+}
+
+// leastConnections picks the backend with the fewest requests in flight,
+// choosing at random among ties so an idle pool still spreads its load.
+// Unlike p2c it scans every candidate, which suits small pools with long
+// requests.
+type leastConnections struct{}
+
+func newLeastConnections(params map[string]string) (Strategy, error) {
+    return leastConnections{}, nil
+}
+
+func (leastConnections) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    var best *backend.Backend
+    var bestInFlight int64
+    for _, i := range rand.Perm(len(candidates)) {
+        peer := candidates[i]
+        if inFlight := peer.InFlight(); best == nil || inFlight < bestInFlight {
+            best, bestInFlight = peer, inFlight
+        }
+    }
+    return best
+}
+
+// weightedLeastConnections picks the backend with the lowest ratio of
+// requests in flight to effective weight, so a backend of weight 4 carries
+// four times the connections of one of weight 1 before it is passed over.
+// The request about to be sent is counted, so an idle pool still prefers
+// its heaviest backends. Backends with a weight of zero get no traffic.
+type weightedLeastConnections struct{}
+
+func newWeightedLeastConnections(params map[string]string) (Strategy, error) {
+    return weightedLeastConnections{}, nil
+}
+
+func (weightedLeastConnections) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    if len(candidates) == 0 {
+        return nil
+    }
+    // Scanning from a random offset breaks ties at random without
+    // allocating a permutation per request.
+    now := time.Now()
+    var best *backend.Backend
+    var bestLoad float64
+    start := rand.Intn(len(candidates))
+    for i := range candidates {
+        peer := candidates[(start+i)%len(candidates)]
+        weight, _ := peer.Weight(now)
+        if weight <= 0 {
+            continue
+        }
+        if load := float64(peer.InFlight()+1) / weight; best == nil || load < bestLoad {
+            best, bestLoad = peer, load
+        }
+    }
+    return best
+}
+
+// leastBandwidth picks the backend currently moving the fewest bytes per
+// second, breaking ties by in-flight requests. It suits pools serving large
+// downloads, where one request may outweigh hundreds of small ones.
+type leastBandwidth struct{}
+
+func newLeastBandwidth(params map[string]string) (Strategy, error) {
+    return leastBandwidth{}, nil
+}
+
+func (leastBandwidth) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    now := time.Now()
+    var best *backend.Backend
+    var bestRate float64
+    var bestInFlight int64
+    for _, i := range rand.Perm(len(candidates)) {
+        peer := candidates[i]
+        rate, inFlight := peer.Throughput(now), peer.Stats().InFlight
+        if best == nil || rate < bestRate || (rate == bestRate && inFlight < bestInFlight) {
+            best, bestRate, bestInFlight = peer, rate, inFlight
+        }
+    }
+    return best
+}
+
+// leastStreams picks the backend with the fewest active streams for its
+// weight, scanning every candidate. Unlike connection counts, streams
+// reflect the real load on HTTP/2 and gRPC backends, where one connection
+// multiplexes many calls. The max_streams param (unlimited by default) is
+// the most streams one backend should carry; backends at it are only used
+// when all are.
+type leastStreams struct {
+    maxStreams int64
+}
+
+func newLeastStreams(params map[string]string) (Strategy, error) {
+    strategy := &leastStreams{}
+    if value := params["max_streams"]; value != "" {
+        parsed, err := strconv.ParseInt(value, 10, 64)
+        if err != nil || parsed < 1 {
+            return nil, fmt.Errorf("invalid max_streams %q", value)
+        }
+        strategy.maxStreams = parsed
+    }
+    return strategy, nil
+}
+
+func (strategy *leastStreams) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    now := time.Now()
+    var best, full *backend.Backend
+    bestLoad, fullLoad := math.Inf(1), math.Inf(1)
+    for _, i := range rand.Perm(len(candidates)) {
+        peer := candidates[i]
+        weight, _ := peer.Weight(now)
+        if weight <= 0 {
+            continue
+        }
+        streams := peer.ActiveStreams()
+        load := float64(streams+1) / weight
+        if strategy.maxStreams > 0 && streams >= strategy.maxStreams {
+            if load < fullLoad {
+                full, fullLoad = peer, load
+            }
+            continue
+        }
+        if load < bestLoad {
+            best, bestLoad = peer, load
+        }
+    }
+    if best == nil {
+        return full
+    }
+    return best
+}
+
+// leastRTT picks backends at random with probability proportional to their
+// weight divided by their connect RTT raised to the bias param (default 2),
+// so nearer backends get most of the traffic without farther ones going
+// cold. Backends not yet measured count as the nearest measured one. RTT
+// comes from the pool's ProbeRTT loop; without it every backend counts as
+// equally near.
+type leastRTT struct {
+    bias float64
+}
+
+func newLeastRTT(params map[string]string) (Strategy, error) {
+    strategy := &leastRTT{bias: 2}
+    if value := params["bias"]; value != "" {
+        parsed, err := strconv.ParseFloat(value, 64)
+        if err != nil || parsed < 0 {
+            return nil, fmt.Errorf("invalid bias %q", value)
+        }
+        strategy.bias = parsed
+    }
+    return strategy, nil
+}
+
+func (strategy *leastRTT) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    now := time.Now()
+    var nearest time.Duration
+    for _, peer := range candidates {
+        if rtt := peer.RTT(); rtt > 0 && (nearest == 0 || rtt < nearest) {
+            nearest = rtt
+        }
+    }
+
+    scores := make([]float64, len(candidates))
+    total := 0.0
+    for i, peer := range candidates {
+        weight, _ := peer.Weight(now)
+        if weight <= 0 {
+            continue
+        }
+        rtt := peer.RTT()
+        if rtt <= 0 {
+            rtt = nearest
+        }
+        scores[i] = weight
+        if rtt > 0 {
+            scores[i] = weight / math.Pow(rtt.Seconds(), strategy.bias)
+        }
+        total += scores[i]
+    }
+    if total <= 0 {
+        return nil
+    }
+    target := rand.Float64() * total
+    for i, score := range scores {
+        if score <= 0 {
+            continue
+        }
+        if target < score {
+            return candidates[i]
+        }
+        target -= score
+    }
+    for i := len(scores) - 1; i >= 0; i-- {
+        if scores[i] > 0 {
+            return candidates[i]
+        }
+    }
+    return nil
+}
@@ -0,0 +1,809 @@
+package balancer
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "slices"
+    "strconv"
+    "sync"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+func newStrategyBackends(hosts ...string) []*backend.Backend {
+    var backends []*backend.Backend
+    for _, host := range hosts {
+        target, _ := url.Parse("http://" + host)
+        backends = append(backends, &backend.Backend{URL: target, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(target)})
+    }
+    return backends
+}
+
+func TestNewStrategy(t *testing.T) {
+    tests := []struct {
+        name    string
+        config  StrategyConfig
+        wantErr bool
+    }{
+        {name: "round robin", config: StrategyConfig{Name: "round_robin"}},
+        {name: "hash by header", config: StrategyConfig{Name: "hash", Params: map[string]string{"key": "header:X-User"}}},
+        {name: "ewma with decay", config: StrategyConfig{Name: "ewma", Params: map[string]string{"decay": "30s"}}},
+        {name: "p2c with sample size", config: StrategyConfig{Name: "p2c", Params: map[string]string{"choices": "3"}}},
+        {name: "random", config: StrategyConfig{Name: "random"}},
+        {name: "unknown strategy", config: StrategyConfig{Name: "fastest"}, wantErr: true},
+        {name: "bad hash key", config: StrategyConfig{Name: "hash", Params: map[string]string{"key": "body"}}, wantErr: true},
+        {name: "bad decay", config: StrategyConfig{Name: "ewma", Params: map[string]string{"decay": "-1s"}}, wantErr: true},
+        {name: "ip hash behind proxies", config: StrategyConfig{Name: "ip_hash", Params: map[string]string{"trusted_proxies": "10.0.0.0/8, 192.168.1.1"}}},
+        {name: "ip hash with another key", config: StrategyConfig{Name: "ip_hash", Params: map[string]string{"key": "path"}}, wantErr: true},
+        {name: "bad trusted proxy", config: StrategyConfig{Name: "ip_hash", Params: map[string]string{"trusted_proxies": "10.0.0.0/33"}}, wantErr: true},
+        {name: "trusted proxies without ip key", config: StrategyConfig{Name: "hash", Params: map[string]string{"key": "host", "trusted_proxies": "10.0.0.1"}}, wantErr: true},
+        {name: "ring hash with vnodes", config: StrategyConfig{Name: "ring_hash", Params: map[string]string{"key": "path", "vnodes": "50"}}},
+        {name: "bad vnodes", config: StrategyConfig{Name: "ring_hash", Params: map[string]string{"vnodes": "0"}}, wantErr: true},
+        {name: "too many vnodes", config: StrategyConfig{Name: "ring_hash", Params: map[string]string{"vnodes": "100000"}}, wantErr: true},
+        {name: "bad ring hash key", config: StrategyConfig{Name: "ring_hash", Params: map[string]string{"key": "body"}}, wantErr: true},
+        {name: "maglev with table size", config: StrategyConfig{Name: "maglev", Params: map[string]string{"key": "header:X-User", "table_size": "251"}}},
+        {name: "maglev table size not prime", config: StrategyConfig{Name: "maglev", Params: map[string]string{"table_size": "100"}}, wantErr: true},
+        {name: "maglev table size too large", config: StrategyConfig{Name: "maglev", Params: map[string]string{"table_size": "1000033"}}, wantErr: true},
+        {name: "path hash with query", config: StrategyConfig{Name: "path_hash", Params: map[string]string{"query": "true", "vnodes": "50"}}},
+        {name: "path hash with another key", config: StrategyConfig{Name: "path_hash", Params: map[string]string{"key": "ip"}}, wantErr: true},
+        {name: "bad path hash query", config: StrategyConfig{Name: "path_hash", Params: map[string]string{"query": "maybe"}}, wantErr: true},
+        {name: "bad choices", config: StrategyConfig{Name: "p2c", Params: map[string]string{"choices": "0"}}, wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            strategy, err := NewStrategy(tt.config)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+            }
+            if !tt.wantErr && strategy == nil {
+                t.Error("Expected a strategy")
+            }
+        })
+    }
+}
+
+func TestRegisterStrategy(t *testing.T) {
+    backends := newStrategyBackends("a:80", "b:80")
+    RegisterStrategy("last", func(params map[string]string) (Strategy, error) {
+        return lastStrategy{}, nil
+    })
+
+    strategy, err := NewStrategy(StrategyConfig{Name: "last"})
+    if err != nil {
+        t.Fatalf("NewStrategy() error: %v", err)
+    }
+    pool := NewServerPool()
+    for _, peer := range backends {
+        pool.AddBackend(peer)
+    }
+    pool.SetStrategy(strategy)
+    if peer := pool.GetNextPeer(); peer != backends[1] {
+        t.Errorf("Expected registered strategy to pick b, got %v", peer.URL)
+    }
+
+    backends[1].SetAlive(false)
+    if peer := pool.GetNextPeer(); peer != backends[0] {
+        t.Errorf("Expected dead backends to be excluded from candidates, got %v", peer.URL)
+    }
+}
+
+type lastStrategy struct{}
+
+func (lastStrategy) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    if len(candidates) == 0 {
+        return nil
+    }
+    return candidates[len(candidates)-1]
+}
+
+func TestHashStrategy(t *testing.T) {
+    backends := newStrategyBackends("a:80", "b:80", "c:80", "d:80")
+    strategy, _ := NewStrategy(StrategyConfig{Name: "hash", Params: map[string]string{"key": "header:X-User"}})
+
+    pick := func(user string, candidates []*backend.Backend) *backend.Backend {
+        request := httptest.NewRequest("GET", "/", nil)
+        request.Header.Set("X-User", user)
+        return strategy.Pick(request, candidates)
+    }
+
+    moved := 0
+    spread := make(map[*backend.Backend]bool)
+    for i := 0; i < 200; i++ {
+        user := string(rune('a'+i%26)) + string(rune('a'+i/26))
+        first := pick(user, backends)
+        if pick(user, backends) != first {
+            t.Fatalf("Expected the same key to map to the same backend")
+        }
+        spread[first] = true
+        if pick(user, backends[:3]) != first {
+            moved++
+        }
+    }
+    if len(spread) != 4 {
+        t.Errorf("Expected keys to spread over all 4 backends, got %d", len(spread))
+    }
+    if moved == 0 || moved > 100 {
+        t.Errorf("Expected only keys of the removed backend to move, %d of 200 moved", moved)
+    }
+}
+
+func TestHashStrategy_Weighted(t *testing.T) {
+    backends := newStrategyBackends("a:80", "b:80", "c:80")
+    strategy, _ := NewStrategy(StrategyConfig{Name: "rendezvous", Params: map[string]string{"key": "path"}})
+    pick := func(path string) *backend.Backend {
+        return strategy.Pick(httptest.NewRequest("GET", path, nil), backends)
+    }
+
+    before := make(map[string]*backend.Backend)
+    for i := 0; i < 900; i++ {
+        path := "/" + strconv.Itoa(i)
+        before[path] = pick(path)
+    }
+
+    now := time.Now()
+    backends[0].SetWeight(2, 0, now)
+    backends[2].SetWeight(0, 0, now)
+    counts := make(map[*backend.Backend]int)
+    for path, previous := range before {
+        peer := pick(path)
+        counts[peer]++
+        if previous == backends[0] && peer != backends[0] {
+            t.Fatalf("Expected keys of the heavier backend to stay put, %s moved", path)
+        }
+    }
+    if counts[backends[2]] != 0 {
+        t.Errorf("Expected no keys on a backend of weight zero, got %d", counts[backends[2]])
+    }
+    if ratio := float64(counts[backends[0]]) / float64(counts[backends[1]]); ratio < 1.6 || ratio > 2.5 {
+        t.Errorf("Expected about twice the keys on the backend of weight 2, got %d and %d", counts[backends[0]], counts[backends[1]])
+    }
+}
+
+func TestHashStrategy_AbsentKey(t *testing.T) {
+    backends := newStrategyBackends("a:80", "b:80", "c:80")
+
+    for _, name := range []string{"hash", "ring_hash", "maglev"} {
+        t.Run(name, func(t *testing.T) {
+            strategy, err := NewStrategy(StrategyConfig{Name: name, Params: map[string]string{"key": "header:X-Tenant-ID"}})
+            if err != nil {
+                t.Fatalf("NewStrategy() error: %v", err)
+            }
+
+            tenant := func() *http.Request {
+                request := httptest.NewRequest("GET", "/", nil)
+                request.Header.Set("X-Tenant-ID", "acme")
+                return request
+            }
+            home := strategy.Pick(tenant(), backends)
+            seen := make(map[*backend.Backend]bool)
+            for i := 0; i < 9; i++ {
+                if peer := strategy.Pick(tenant(), backends); peer != home {
+                    t.Fatalf("Expected the tenant pinned to %s, got %s", home.URL.Host, peer.URL.Host)
+                }
+                seen[strategy.Pick(httptest.NewRequest("GET", "/", nil), backends)] = true
+            }
+            if len(seen) != len(backends) {
+                t.Errorf("Expected requests without the header spread round robin over %d backends, got %d", len(backends), len(seen))
+            }
+        })
+    }
+}
+
+func TestRingHashStrategy(t *testing.T) {
+    backends := newStrategyBackends("a:80", "b:80", "c:80", "d:80", "e:80")
+    strategy, _ := NewStrategy(StrategyConfig{Name: "ring_hash", Params: map[string]string{"key": "path"}})
+
+    pick := func(path string, candidates []*backend.Backend) *backend.Backend {
+        return strategy.Pick(httptest.NewRequest("GET", path, nil), candidates)
+    }
+
+    counts := make(map[*backend.Backend]int)
+    removed, added := 0, 0
+    for i := 0; i < 1000; i++ {
+        path := "/item/" + strconv.Itoa(i)
+        first := pick(path, backends)
+        if pick(path, backends) != first {
+            t.Fatalf("Expected the same key to map to the same backend")
+        }
+        counts[first]++
+        if peer := pick(path, backends[:4]); peer != first {
+            removed++
+            if first != backends[4] {
+                t.Fatalf("Expected only keys of the removed backend to move, %s moved to %s", path, peer.URL.Host)
+            }
+        }
+        if pick(path, append(backends[:5:5], newStrategyBackends("f:80")...)) != first {
+            added++
+        }
+    }
+    for _, peer := range backends {
+        if counts[peer] < 100 || counts[peer] > 300 {
+            t.Errorf("Expected about 200 of 1000 keys on %s, got %d", peer.URL.Host, counts[peer])
+        }
+    }
+    if removed > 300 || added > 300 {
+        t.Errorf("Expected about a fifth of keys to move, %d moved on removal and %d on addition", removed, added)
+    }
+}
+
+func TestRingHashStrategy_KeepsRingForSubsets(t *testing.T) {
+    backends := newStrategyBackends("a:80", "b:80", "c:80")
+    pool := NewServerPool()
+    pool.SetBackends(backends)
+    if err := pool.UseStrategy(StrategyConfig{Name: "ring_hash", Params: map[string]string{"key": "path"}}); err != nil {
+        t.Fatal(err)
+    }
+    strategy := (*pool.strategy.Load()).(*ringHash)
+    ring := &strategy.points[0]
+
+    for i := 0; i < 100; i++ {
+        request := httptest.NewRequest("GET", "/item/"+strconv.Itoa(i), nil)
+        home := strategy.Pick(request, backends)
+        for _, excluded := range backends {
+            candidates := slices.DeleteFunc(slices.Clone(backends), func(peer *backend.Backend) bool { return peer == excluded })
+            peer := strategy.Pick(request, candidates)
+            if peer == excluded || (excluded != home && peer != home) {
+                t.Fatalf("Expected only keys of the excluded backend to move, got %s for %s", peer.URL.Host, request.URL.Path)
+            }
+        }
+    }
+    if &strategy.points[0] != ring {
+        t.Error("Expected picks over subsets of the pool to keep the ring")
+    }
+
+    pool.SetBackends(backends[:2])
+    if len(strategy.members) != 2 || len(strategy.points) != 2*strategy.vnodes {
+        t.Errorf("Expected the ring rebuilt without the removed backend, got %d members", len(strategy.members))
+    }
+}
+
+func TestMaglevStrategy(t *testing.T) {
+    var hosts []string
+    for i := 0; i < 20; i++ {
+        hosts = append(hosts, "backend-"+strconv.Itoa(i)+":80")
+    }
+    backends := newStrategyBackends(hosts...)
+    strategy, _ := NewStrategy(StrategyConfig{Name: "maglev", Params: map[string]string{"key": "path"}})
+    pick := func(path string, candidates []*backend.Backend) *backend.Backend {
+        return strategy.Pick(httptest.NewRequest("GET", path, nil), candidates)
+    }
+
+    before := make(map[string]*backend.Backend)
+    counts := make(map[*backend.Backend]int)
+    for i := 0; i < 2000; i++ {
+        path := "/item/" + strconv.Itoa(i)
+        before[path] = pick(path, backends)
+        counts[before[path]]++
+    }
+    for _, peer := range backends {
+        if counts[peer] < 50 || counts[peer] > 150 {
+            t.Errorf("Expected about 100 of 2000 keys on %s, got %d", peer.URL.Host, counts[peer])
+        }
+    }
+
+    // Until the rebuilt table is in, the old one must not hand out the
+    // backend that left.
+    removed, remaining := backends[7], append(slices.Clone(backends[:7]), backends[8:]...)
+    for path := range before {
+        if pick(path, remaining) == removed {
+            t.Fatalf("Expected the removed backend never to be picked")
+        }
+    }
+    maglev := strategy.(*maglev)
+    if !slices.Equal(maglev.table.Load().members, backends) {
+        t.Fatal("Expected picks over a subset of the backends to keep the table")
+    }
+    maglev.SetMembers(remaining)
+    for deadline := time.Now().Add(5 * time.Second); !slices.Equal(maglev.table.Load().members, remaining); {
+        if time.Now().After(deadline) {
+            t.Fatal("Expected the table to be rebuilt for the new members")
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+
+    moved := 0
+    for path, previous := range before {
+        peer := pick(path, remaining)
+        if peer == removed {
+            t.Fatalf("Expected the removed backend never to be picked")
+        }
+        if previous != removed && peer != previous {
+            moved++
+        }
+    }
+    if moved > 100 {
+        t.Errorf("Expected few keys of remaining backends to move, %d of 2000 moved", moved)
+    }
+}
+
+func TestPathHashStrategy(t *testing.T) {
+    backends := newStrategyBackends("a:80", "b:80", "c:80")
+
+    tests := []struct {
+        name     string
+        query    string
+        first    string
+        second   string
+        expected bool
+    }{
+        {name: "same path", first: "/img/logo.png", second: "/img/logo.png", expected: true},
+        {name: "query ignored", first: "/img/logo.png?v=1", second: "/img/logo.png?v=2", expected: true},
+        {name: "query included", query: "true", first: "/img/logo.png?v=1", second: "/img/logo.png?v=1", expected: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            strategy, err := NewStrategy(StrategyConfig{Name: "path_hash", Params: map[string]string{"query": tt.query}})
+            if err != nil {
+                t.Fatalf("NewStrategy() error: %v", err)
+            }
+            first := strategy.Pick(httptest.NewRequest("GET", tt.first, nil), backends)
+            second := strategy.Pick(httptest.NewRequest("GET", tt.second, nil), backends)
+            if (first == second) != tt.expected {
+                t.Errorf("Expected same backend %v, got %s and %s", tt.expected, first.URL.Host, second.URL.Host)
+            }
+        })
+    }
+
+    // With the query in the key, versions of a path spread over backends.
+    strategy, _ := NewStrategy(StrategyConfig{Name: "path_hash", Params: map[string]string{"query": "true"}})
+    seen := make(map[*backend.Backend]bool)
+    for i := 0; i < 50; i++ {
+        seen[strategy.Pick(httptest.NewRequest("GET", "/img/logo.png?v="+strconv.Itoa(i), nil), backends)] = true
+    }
+    if len(seen) != len(backends) {
+        t.Errorf("Expected versions spread over %d backends, got %d", len(backends), len(seen))
+    }
+}
+
+func TestIPHashStrategy_Failover(t *testing.T) {
+    backends := newStrategyBackends("a:80", "b:80", "c:80")
+    strategy, _ := NewStrategy(StrategyConfig{Name: "ip_hash", Params: map[string]string{"trusted_proxies": "10.0.0.1"}})
+
+    pick := func(client string, candidates []*backend.Backend) *backend.Backend {
+        request := httptest.NewRequest("GET", "/", nil)
+        request.RemoteAddr = "10.0.0.1:4000"
+        request.Header.Set("X-Forwarded-For", client)
+        return strategy.Pick(request, candidates)
+    }
+
+    home := pick("198.51.100.1", backends)
+    var rest []*backend.Backend
+    for _, peer := range backends {
+        if peer != home {
+            rest = append(rest, peer)
+        }
+    }
+    fallback := pick("198.51.100.1", rest)
+    if fallback == nil || fallback == home {
+        t.Fatalf("Expected a fallback backend, got %v", fallback)
+    }
+    for i := 0; i < 5; i++ {
+        if peer := pick("198.51.100.1", rest); peer != fallback {
+            t.Errorf("Expected the same fallback while %s is down, got %s", home.URL.Host, peer.URL.Host)
+        }
+    }
+    if peer := pick("198.51.100.1", backends); peer != home {
+        t.Errorf("Expected the client back on %s once it recovers, got %s", home.URL.Host, peer.URL.Host)
+    }
+}
+
+func TestEWMAStrategy(t *testing.T) {
+    backends := newStrategyBackends("slow:80", "fast:80", "new:80")
+    strategy, _ := NewStrategy(StrategyConfig{Name: "ewma", Params: map[string]string{"decay": "50ms"}})
+    observer := strategy.(LatencyObserver)
+
+    observer.Observe(backends[0], 100*time.Millisecond)
+    observer.Observe(backends[1], 10*time.Millisecond)
+
+    if peer := strategy.Pick(nil, backends); peer != backends[2] {
+        t.Errorf("Expected unmeasured backend first, got %v", peer.URL)
+    }
+    if peer := strategy.Pick(nil, backends[:2]); peer != backends[1] {
+        t.Errorf("Expected lowest latency backend, got %v", peer.URL)
+    }
+
+    for i := 0; i < 5; i++ {
+        observer.Observe(backends[1], 500*time.Millisecond)
+        time.Sleep(20 * time.Millisecond)
+    }
+    if peer := strategy.Pick(nil, backends[:2]); peer != backends[0] {
+        t.Errorf("Expected decayed average to move traffic away from the slowed backend, got %v", peer.URL)
+    }
+}
+
+func TestEWMAStrategy_IdleRecovery(t *testing.T) {
+    backends := newStrategyBackends("slow:80", "fast:80")
+    strategy, _ := NewStrategy(StrategyConfig{Name: "ewma", Params: map[string]string{"decay": "50ms"}})
+    observer := strategy.(LatencyObserver)
+
+    observer.Observe(backends[0], 100*time.Millisecond)
+    observer.Observe(backends[1], 10*time.Millisecond)
+
+    // Seven requests in flight make the fast backend cost 80ms, still
+    // cheaper than the slow one's 100ms.
+    release := make(chan struct{})
+    busy := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-release })
+    var done sync.WaitGroup
+    for i := 0; i < 7; i++ {
+        done.Add(1)
+        go func() {
+            defer done.Done()
+            backends[1].Forward(busy, httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+        }()
+    }
+    defer func() {
+        close(release)
+        done.Wait()
+    }()
+    for backends[1].Stats().InFlight < 7 {
+        time.Sleep(time.Millisecond)
+    }
+    if peer := strategy.Pick(nil, backends); peer != backends[1] {
+        t.Fatalf("Expected the fast backend, got %v", peer.URL)
+    }
+
+    // The slow backend gets no traffic, so only the fast one is measured.
+    for i := 0; i < 30; i++ {
+        observer.Observe(backends[1], 10*time.Millisecond)
+        time.Sleep(10 * time.Millisecond)
+    }
+    if peer := strategy.Pick(nil, backends); peer != backends[0] {
+        t.Errorf("Expected the idle backend to take spillover once its average faded, got %v", peer.URL)
+    }
+}
+
+func TestEWMAStrategy_IdleFadesTowardMean(t *testing.T) {
+    backends := newStrategyBackends("slow:80", "fast:80")
+    strategy, _ := NewStrategy(StrategyConfig{Name: "ewma", Params: map[string]string{"decay": "10ms"}})
+    observer := strategy.(LatencyObserver)
+
+    observer.Observe(backends[0], 100*time.Millisecond)
+    time.Sleep(100 * time.Millisecond)
+    observer.Observe(backends[1], 10*time.Millisecond)
+
+    for i := 0; i < 20; i++ {
+        if peer := strategy.Pick(nil, backends); peer != backends[1] {
+            t.Fatalf("Expected the idle slow backend never to look fastest, got %v", peer.URL)
+        }
+    }
+}
+
+func TestP2CStrategy(t *testing.T) {
+    release := make(chan struct{})
+    busy := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-release })
+    backends := newStrategyBackends("busy:80", "idle:80")
+
+    done := make(chan struct{})
+    go func() {
+        backends[0].Forward(busy, httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+        close(done)
+    }()
+    for backends[0].Stats().InFlight == 0 {
+        time.Sleep(time.Millisecond)
+    }
+
+    strategy, _ := NewStrategy(StrategyConfig{Name: "p2c", Params: map[string]string{"choices": "2"}})
+    for i := 0; i < 20; i++ {
+        if peer := strategy.Pick(nil, backends); peer != backends[1] {
+            t.Fatalf("Expected least loaded backend, got %v", peer.URL)
+        }
+    }
+    close(release)
+    <-done
+}
+
+func TestP2CStrategy_Spread(t *testing.T) {
+    backends := newStrategyBackends("a:80", "b:80", "c:80", "d:80", "e:80", "f:80", "g:80", "h:80")
+    strategy, _ := NewStrategy(StrategyConfig{Name: "p2c"})
+
+    counts := make(map[*backend.Backend]int)
+    for i := 0; i < 800; i++ {
+        counts[strategy.Pick(nil, backends)]++
+    }
+    for _, peer := range backends {
+        if counts[peer] < 40 {
+            t.Errorf("Expected equally loaded backends to share picks, %s got %d of 800", peer.URL.Host, counts[peer])
+        }
+    }
+}
+
+func TestRandomStrategy(t *testing.T) {
+    backends := newStrategyBackends("a:80", "b:80", "c:80", "d:80")
+    strategy, _ := NewStrategy(StrategyConfig{Name: "random"})
+
+    if peer := strategy.Pick(nil, nil); peer != nil {
+        t.Errorf("Expected no backend without candidates, got %v", peer.URL)
+    }
+    counts := make(map[*backend.Backend]int)
+    for i := 0; i < 800; i++ {
+        counts[strategy.Pick(nil, backends)]++
+    }
+    for _, peer := range backends {
+        if counts[peer] < 120 {
+            t.Errorf("Expected picks spread evenly, %s got %d of 800", peer.URL.Host, counts[peer])
+        }
+    }
+}
+
+func TestWeightedRoundRobinStrategy(t *testing.T) {
+    backends := newStrategyBackends("a:80", "b:80", "c:80")
+    now := time.Now()
+    backends[0].SetWeight(3, 0, now)
+    backends[2].SetWeight(0, 0, now)
+
+    strategy, _ := NewStrategy(StrategyConfig{Name: "weighted_round_robin"})
+    counts := make(map[*backend.Backend]int)
+    for i := 0; i < 400; i++ {
+        counts[strategy.Pick(nil, backends)]++
+    }
+
+    if counts[backends[0]] != 300 || counts[backends[1]] != 100 || counts[backends[2]] != 0 {
+        t.Errorf("Expected 300/100/0 split, got %d/%d/%d", counts[backends[0]], counts[backends[1]], counts[backends[2]])
+    }
+}
+
+func TestWeightedRoundRobinStrategy_HealthTransition(t *testing.T) {
+    backends := newStrategyBackends("heavy", "light")
+    backends[0].SetWeight(3, 0, time.Now())
+    pool := NewServerPool()
+    for _, peer := range backends {
+        pool.AddBackend(peer)
+    }
+    strategy, _ := NewStrategy(StrategyConfig{Name: "weighted_round_robin"})
+    pool.SetStrategy(strategy)
+
+    split := func() (int, int) {
+        counts := make(map[*backend.Backend]int)
+        for i := 0; i < 400; i++ {
+            counts[pool.GetNextPeer()]++
+        }
+        return counts[backends[0]], counts[backends[1]]
+    }
+
+    if heavy, light := split(); heavy != 300 || light != 100 {
+        t.Errorf("Expected 300/100 split, got %d/%d", heavy, light)
+    }
+
+    // The heavy backend fails and recovers; its weight must come back with it.
+    backends[0].SetAlive(false)
+    if peer := pool.GetNextPeer(); peer != backends[1] {
+        t.Fatalf("Expected the light backend while the heavy one is down, got %s", peer.URL.Host)
+    }
+    backends[0].SetAlive(true)
+    if heavy, light := split(); heavy < 299 || light > 101 {
+        t.Errorf("Expected the 3:1 split back after recovery, got %d/%d", heavy, light)
+    }
+}
+
+func TestWeightedRoundRobinStrategy_ForgetsRemovedBackends(t *testing.T) {
+    backends := newStrategyBackends("a:80", "b:80")
+    pool := NewServerPool()
+    pool.SetBackends(backends)
+    strategy, _ := NewStrategy(StrategyConfig{Name: "weighted_round_robin"})
+    pool.SetStrategy(strategy)
+    for i := 0; i < 4; i++ {
+        pool.GetNextPeer()
+    }
+
+    pool.SetBackends(backends[1:])
+    if current := strategy.(*weightedRoundRobin).current; len(current) > 1 {
+        t.Errorf("Expected only the remaining backend tracked, got %d", len(current))
+    }
+}
+
+func TestLeastBandwidth_Pick(t *testing.T) {
+    strategy, err := NewStrategy(StrategyConfig{Name: "least_bandwidth"})
+    if err != nil {
+        t.Fatalf("NewStrategy() error: %v", err)
+    }
+    candidates := newStrategyBackends("busy", "quiet")
+    busy, quiet := candidates[0], candidates[1]
+
+    strategy.Pick(nil, candidates)
+    download := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write(make([]byte, 1<<20))
+    })
+    busy.Forward(download, httptest.NewRecorder(), httptest.NewRequest("GET", "/file", nil))
+    time.Sleep(10 * time.Millisecond)
+
+    for i := 0; i < 10; i++ {
+        if peer := strategy.Pick(nil, candidates); peer != quiet {
+            t.Fatalf("Expected the quiet backend, got %s", peer.URL.Host)
+        }
+    }
+}
+
+func TestLeastConnections_Pick(t *testing.T) {
+    strategy, err := NewStrategy(StrategyConfig{Name: "least_connections"})
+    if err != nil {
+        t.Fatalf("NewStrategy() error: %v", err)
+    }
+    candidates := newStrategyBackends("a", "b", "c")
+
+    seen := make(map[*backend.Backend]bool)
+    for i := 0; i < 100; i++ {
+        seen[strategy.Pick(nil, candidates)] = true
+    }
+    if len(seen) != len(candidates) {
+        t.Errorf("Expected idle backends picked evenly, got %d of %d", len(seen), len(candidates))
+    }
+
+    release := make(chan struct{})
+    defer close(release)
+    for i, connections := range []int{2, 1, 3} {
+        for j := 0; j < connections; j++ {
+            started := make(chan struct{})
+            go candidates[i].Forward(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                close(started)
+                <-release
+            }), httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+            <-started
+        }
+    }
+    if inFlight := candidates[2].InFlight(); inFlight != 3 {
+        t.Errorf("Expected 3 in flight, got %d", inFlight)
+    }
+    for i := 0; i < 10; i++ {
+        if peer := strategy.Pick(nil, candidates); peer != candidates[1] {
+            t.Fatalf("Expected the backend with the fewest connections, got %s", peer.URL.Host)
+        }
+    }
+}
+
+func TestWeightedLeastConnections_Pick(t *testing.T) {
+    strategy, err := NewStrategy(StrategyConfig{Name: "weighted_least_connections"})
+    if err != nil {
+        t.Fatalf("NewStrategy() error: %v", err)
+    }
+    candidates := newStrategyBackends("small", "large", "drained")
+    now := time.Now()
+    candidates[1].SetWeight(3, 0, now)
+    candidates[2].SetWeight(0, 0, now)
+
+    release := make(chan struct{})
+    defer close(release)
+    hold := func(peer *backend.Backend) {
+        started := make(chan struct{})
+        go peer.Forward(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            close(started)
+            <-release
+        }), httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+        <-started
+    }
+
+    // Holding each pick open, the large backend should take three
+    // connections for every one the small backend takes.
+    counts := make(map[*backend.Backend]int)
+    for i := 0; i < 8; i++ {
+        peer := strategy.Pick(nil, candidates)
+        if peer == nil {
+            t.Fatal("Expected a backend, got nil")
+        }
+        counts[peer]++
+        hold(peer)
+    }
+    if counts[candidates[0]] != 2 || counts[candidates[1]] != 6 || counts[candidates[2]] != 0 {
+        t.Errorf("Expected connections split 2:6:0, got %d:%d:%d", counts[candidates[0]], counts[candidates[1]], counts[candidates[2]])
+    }
+}
+
+func TestWeightedLeastConnections_Ties(t *testing.T) {
+    strategy, _ := NewStrategy(StrategyConfig{Name: "weighted_least_connections"})
+    candidates := newStrategyBackends("a", "b", "c", "d")
+
+    counts := make(map[*backend.Backend]int)
+    for i := 0; i < 400; i++ {
+        counts[strategy.Pick(nil, candidates)]++
+    }
+    for _, peer := range candidates {
+        if counts[peer] < 40 {
+            t.Errorf("Expected tied backends to share picks, %s got %d of 400", peer.URL.Host, counts[peer])
+        }
+    }
+    if allocs := testing.AllocsPerRun(100, func() { strategy.Pick(nil, candidates) }); allocs != 0 {
+        t.Errorf("Expected Pick not to allocate, got %v allocations", allocs)
+    }
+}
+
+func TestLeastStreams_Pick(t *testing.T) {
+    candidates := newStrategyBackends("a", "b", "c")
+    release := make(chan struct{})
+    defer close(release)
+    hold := func(peer *backend.Backend, streams int) {
+        for i := 0; i < streams; i++ {
+            started := make(chan struct{})
+            go peer.Forward(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                close(started)
+                <-release
+            }), httptest.NewRecorder(), httptest.NewRequest("POST", "/pkg.Service/Stream", nil))
+            <-started
+        }
+    }
+    hold(candidates[0], 3)
+    hold(candidates[1], 1)
+    hold(candidates[2], 2)
+
+    tests := []struct {
+        name     string
+        params   map[string]string
+        weights  []float64
+        expected string
+    }{
+        {name: "fewest streams", expected: "b"},
+        {name: "weighted by capacity", weights: []float64{1, 1, 4}, expected: "c"},
+        {name: "all at the stream limit", params: map[string]string{"max_streams": "1"}, expected: "b"},
+        {name: "under the stream limit wins", params: map[string]string{"max_streams": "2"}, weights: []float64{10, 10, 1}, expected: "b"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            strategy, err := NewStrategy(StrategyConfig{Name: "least_streams", Params: tt.params})
+            if err != nil {
+                t.Fatalf("NewStrategy() error: %v", err)
+            }
+            for i, peer := range candidates {
+                weight := float64(backend.DefaultWeight)
+                if tt.weights != nil {
+                    weight = tt.weights[i]
+                }
+                peer.SetWeight(weight, 0, time.Now())
+            }
+            if peer := strategy.Pick(nil, candidates); peer.URL.Host != tt.expected {
+                t.Errorf("Expected %s, got %s", tt.expected, peer.URL.Host)
+            }
+        })
+    }
+
+    if _, err := NewStrategy(StrategyConfig{Name: "least_streams", Params: map[string]string{"max_streams": "0"}}); err == nil {
+        t.Errorf("Expected an error for max_streams 0")
+    }
+}
+
+func TestLeastRTT_Pick(t *testing.T) {
+    tests := []struct {
+        name         string
+        params       map[string]string
+        rtts         []time.Duration
+        minNearShare float64
+        maxNearShare float64
+    }{
+        {name: "nearer backend preferred", rtts: []time.Duration{10 * time.Millisecond, 40 * time.Millisecond}, minNearShare: 0.9, maxNearShare: 0.97},
+        {name: "no bias spreads evenly", params: map[string]string{"bias": "0"}, rtts: []time.Duration{10 * time.Millisecond, 40 * time.Millisecond}, minNearShare: 0.45, maxNearShare: 0.55},
+        {name: "unmeasured counts as nearest", rtts: []time.Duration{10 * time.Millisecond, 0}, minNearShare: 0.45, maxNearShare: 0.55},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            strategy, err := NewStrategy(StrategyConfig{Name: "least_rtt", Params: tt.params})
+            if err != nil {
+                t.Fatalf("NewStrategy() error: %v", err)
+            }
+            candidates := newStrategyBackends("near", "far")
+            for i, rtt := range tt.rtts {
+                if rtt > 0 {
+                    candidates[i].ObserveRTT(rtt, time.Now())
+                }
+            }
+
+            near := 0
+            for i := 0; i < 5000; i++ {
+                if strategy.Pick(nil, candidates) == candidates[0] {
+                    near++
+                }
+            }
+            if share := float64(near) / 5000; share < tt.minNearShare || share > tt.maxNearShare {
+                t.Errorf("Expected the near backend's share between %v and %v, got %v", tt.minNearShare, tt.maxNearShare, share)
+            }
+        })
+    }
+
+    if _, err := NewStrategy(StrategyConfig{Name: "least_rtt", Params: map[string]string{"bias": "-1"}}); err == nil {
+        t.Errorf("Expected an error for a negative bias")
+    }
+}
@@ -0,0 +1,49 @@
+package balancer
+
+import (
+    "log"
+
+    "load-balancer/internal/backend"
+)
+
+// available reports whether peer can take a request.
+func (serverpool *ServerPool) available(peer *backend.Backend, exclude map[*backend.Backend]bool) bool {
+    return !exclude[peer] && !peer.Draining() && peer.IsAlive() && !serverpool.saturated(peer)
+}
+
+// activeTier returns the tier requests go to: the lowest with a backend
+// available, one that is alive, not draining and below the in-flight limit.
+// Backends are grouped by their Tier, 0 being the most preferred, so a pool
+// fails over to tier 1 only when all of tier 0 is down, and tier 1 can hold
+// standbys that take no traffic otherwise. Strategies only see the backends
+// of the active tier. The pool logs when it fails over to another tier or
+// back; a backend's Tier must be set before it is added to the pool.
+func (serverpool *ServerPool) activeTier(backends []*backend.Backend, exclude map[*backend.Backend]bool) int {
+    if !serverpool.tiered.Load() {
+        return 0
+    }
+    tier, found := 0, false
+    for _, peer := range backends {
+        if (!found || peer.Tier < tier) && serverpool.available(peer, exclude) {
+            tier, found = peer.Tier, true
+        }
+    }
+    if !found || len(exclude) > 0 {
+        return tier
+    }
+    if previous := serverpool.tier.Swap(int64(tier)); previous != int64(tier) {
+        log.Printf("pool now serving from tier %d, was tier %d\n", tier, previous)
+    }
+    return tier
+}
+
+// noteTiers records whether any of backends is outside tier 0, so pools
+// that do not use tiers skip the extra pass.
+func (serverpool *ServerPool) noteTiers(backends ...*backend.Backend) {
+    for _, peer := range backends {
+        if peer.Tier != 0 {
+            serverpool.tiered.Store(true)
+            return
+        }
+    }
+}
@@ -0,0 +1,73 @@
+package balancer
+
+import (
+    "io"
+    "log"
+    "os"
+    "slices"
+    "testing"
+
+    "load-balancer/internal/backend"
+)
+
+func TestServerPool_Tiers(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    tests := []struct {
+        name     string
+        strategy string
+    }{
+        {name: "built-in round robin"},
+        {name: "strategy", strategy: "p2c"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backends := newStrategyBackends("primary-a", "primary-b", "standby", "last-resort")
+            backends[2].Tier = 1
+            backends[3].Tier = 2
+            pool := NewServerPool()
+            pool.SetBackends(backends)
+            if tt.strategy != "" {
+                strategy, _ := NewStrategy(StrategyConfig{Name: tt.strategy})
+                pool.SetStrategy(strategy)
+            }
+
+            steps := []struct {
+                down     []int
+                expected []*backend.Backend
+            }{
+                {expected: backends[:2]},
+                {down: []int{0}, expected: backends[1:2]},
+                {down: []int{0, 1}, expected: backends[2:3]},
+                {down: []int{0, 1, 2}, expected: backends[3:4]},
+                {expected: backends[:2]},
+            }
+            for i, step := range steps {
+                for j, peer := range backends {
+                    peer.SetAlive(!slices.Contains(step.down, j))
+                }
+                for k := 0; k < 20; k++ {
+                    peer := pool.GetNextPeer()
+                    if !slices.Contains(step.expected, peer) {
+                        t.Fatalf("Step %d: expected one of %d backends of the active tier, got %v", i, len(step.expected), peer.URL)
+                    }
+                }
+            }
+        })
+    }
+}
+
+func TestServerPool_TiersOnRetry(t *testing.T) {
+    backends := newStrategyBackends("primary", "standby")
+    backends[1].Tier = 1
+    pool := NewServerPool()
+    pool.SetBackends(backends)
+
+    // A retry that excludes the only primary goes to the standby tier.
+    peer, err := pool.pick(nil, map[*backend.Backend]bool{backends[0]: true})
+    if err != nil || peer != backends[1] {
+        t.Errorf("Expected the standby on retry, got %v (%v)", peer, err)
+    }
+}
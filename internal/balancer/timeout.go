@@ -0,0 +1,87 @@
+package balancer
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "time"
+
+    "load-balancer/internal/requestid"
+)
+
+var errResponseTimeout = errors.New("route response timeout")
+
+// ResponseTimeout cancels the upstream request once timeout elapses. If the
+// response has not started by then, the client gets a 504 carrying the
+// request ID instead of the proxy's generic error; a response that is
+// already streaming is aborted.
+func ResponseTimeout(timeout time.Duration) func(next http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+            id := requestid.Ensure(request)
+            ctx, cancel := context.WithTimeoutCause(request.Context(), timeout, errResponseTimeout)
+            defer cancel()
+
+            guard := &timeoutWriter{ResponseWriter: writer, ctx: ctx, requestID: id}
+            next.ServeHTTP(guard, request.WithContext(ctx))
+            if !guard.wroteHeader && guard.expired() {
+                guard.writeTimeout()
+            }
+        })
+    }
+}
+
+type timeoutWriter struct {
+    http.ResponseWriter
+    ctx         context.Context
+    requestID   string
+    wroteHeader bool
+    timedOut    bool
+}
+
+func (writer *timeoutWriter) expired() bool {
+    return context.Cause(writer.ctx) == errResponseTimeout
+}
+
+func (writer *timeoutWriter) WriteHeader(status int) {
+    if writer.wroteHeader {
+        return
+    }
+    if status < http.StatusOK {
+        writer.ResponseWriter.WriteHeader(status)
+        return
+    }
+    writer.wroteHeader = true
+    if writer.expired() {
+        writer.writeTimeout()
+        return
+    }
+    writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *timeoutWriter) Write(p []byte) (int, error) {
+    if !writer.wroteHeader {
+        writer.WriteHeader(http.StatusOK)
+    }
+    if writer.timedOut {
+        return len(p), nil
+    }
+    return writer.ResponseWriter.Write(p)
+}
+
+func (writer *timeoutWriter) writeTimeout() {
+    writer.wroteHeader = true
+    writer.timedOut = true
+
+    header := writer.ResponseWriter.Header()
+    for name := range header {
+        delete(header, name)
+    }
+    header.Set(requestid.Header, writer.requestID)
+    serveError(writer.ResponseWriter, fmt.Sprintf("Gateway Timeout (request id %s)", writer.requestID), http.StatusGatewayTimeout)
+}
+
+func (writer *timeoutWriter) Unwrap() http.ResponseWriter {
+    return writer.ResponseWriter
+}
@@ -0,0 +1,91 @@
+package balancer
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/requestid"
+)
+
+func TestRouter_RouteTimeout(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/slow":
+            select {
+            case <-time.After(2 * time.Second):
+            case <-r.Context().Done():
+                return
+            }
+        case "/stream":
+            w.WriteHeader(http.StatusOK)
+            w.Write([]byte("partial"))
+            w.(http.Flusher).Flush()
+            select {
+            case <-time.After(2 * time.Second):
+            case <-r.Context().Done():
+                return
+            }
+        }
+        w.Write([]byte("done"))
+    }))
+    defer server.Close()
+
+    serverURL, _ := url.Parse(server.URL)
+    pool := NewServerPool()
+    pool.AddBackend(&backend.Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)})
+
+    router := NewRouter("default")
+    router.AddPool("default", pool)
+    router.AddRoute(Route{Name: "api", PathPrefix: "/", Timeout: 100 * time.Millisecond})
+
+    tests := []struct {
+        name         string
+        path         string
+        requestID    string
+        expectedCode int
+        expectedBody string
+    }{
+        {name: "fast response", path: "/fast", expectedCode: http.StatusOK, expectedBody: "done"},
+        {name: "slow response times out", path: "/slow", expectedCode: http.StatusGatewayTimeout},
+        {name: "client request id is reported", path: "/slow", requestID: "req-42", expectedCode: http.StatusGatewayTimeout},
+        {name: "started response is cut short", path: "/stream", expectedCode: http.StatusOK, expectedBody: "partial"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            req := httptest.NewRequest("GET", tt.path, nil)
+            if tt.requestID != "" {
+                req.Header.Set(requestid.Header, tt.requestID)
+            }
+            rr := httptest.NewRecorder()
+
+            start := time.Now()
+            router.ServeHTTP(rr, req)
+            if elapsed := time.Since(start); elapsed > time.Second {
+                t.Errorf("Expected request to be cut off near the deadline, took %v", elapsed)
+            }
+
+            if rr.Code != tt.expectedCode {
+                t.Errorf("Expected status %d, got %d", tt.expectedCode, rr.Code)
+            }
+            if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+                t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body.String())
+            }
+            if tt.expectedCode == http.StatusGatewayTimeout {
+                id := rr.Header().Get(requestid.Header)
+                if id == "" || !strings.Contains(rr.Body.String(), id) {
+                    t.Errorf("Expected request id in header and body, got %q / %q", id, rr.Body.String())
+                }
+                if tt.requestID != "" && id != tt.requestID {
+                    t.Errorf("Expected request id %q, got %q", tt.requestID, id)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,65 @@
+package balancer
+
+import (
+    "log"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+// TLSResumptionConfig turns on TLS session resumption towards the pool's
+// HTTPS backends, with a session cache of CacheSize entries (default 64)
+// per backend, and exports handshake counts by result and handshake
+// latency per backend.
+type TLSResumptionConfig struct {
+    Name      string
+    CacheSize int
+    Registry  *metrics.Registry
+}
+
+// EnableTLSResumption applies config to the pool's backends, and to
+// backends added later. Call it before enabling preconnect.
+func (serverpool *ServerPool) EnableTLSResumption(config TLSResumptionConfig) {
+    if config.CacheSize <= 0 {
+        config.CacheSize = 64
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+    serverpool.tlsResumption.Store(&config)
+
+    for _, peer := range serverpool.Backends() {
+        serverpool.setupTLSResumption(peer)
+    }
+}
+
+func (serverpool *ServerPool) setupTLSResumption(peer *backend.Backend) {
+    config := serverpool.tlsResumption.Load()
+    if config == nil || peer.URL.Scheme != "https" {
+        return
+    }
+
+    labels := []string{"pool", config.Name, "backend", peer.URL.String()}
+    help := "TLS handshakes with backends, by result (full, resumed or failed)."
+    full := config.Registry.Counter("lb_backend_tls_handshakes_total", help, append(labels, "result", "full")...)
+    resumed := config.Registry.Counter("lb_backend_tls_handshakes_total", help, append(labels, "result", "resumed")...)
+    failed := config.Registry.Counter("lb_backend_tls_handshakes_total", help, append(labels, "result", "failed")...)
+    latency := config.Registry.Histogram("lb_backend_tls_handshake_seconds", "Time taken by TLS handshakes with backends.", metrics.DefaultBuckets, labels...)
+
+    err := peer.EnableTLSResumption(config.CacheSize, func(elapsed time.Duration, didResume bool, err error) {
+        switch {
+        case err != nil:
+            failed.Inc()
+            return
+        case didResume:
+            resumed.Inc()
+        default:
+            full.Inc()
+        }
+        latency.Observe(elapsed.Seconds())
+    })
+    if err != nil {
+        log.Printf("%s %v\n", peer.URL, err)
+    }
+}
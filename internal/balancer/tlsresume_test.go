@@ -0,0 +1,71 @@
+package balancer
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "testing"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+func TestServerPool_EnableTLSResumption(t *testing.T) {
+    server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte("ok"))
+    }))
+    defer server.Close()
+
+    tests := []struct {
+        name            string
+        enabled         bool
+        expectedResumed uint64
+    }{
+        {name: "without resumption every handshake is full", enabled: false, expectedResumed: 0},
+        {name: "with resumption later handshakes resume", enabled: true, expectedResumed: 2},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            registry := metrics.NewRegistry()
+            serverURL, _ := url.Parse(server.URL)
+            proxy := httputil.NewSingleHostReverseProxy(serverURL)
+            transport := server.Client().Transport.(*http.Transport).Clone()
+            proxy.Transport = transport
+            peer := &backend.Backend{URL: serverURL, Alive: true, ReverseProxy: proxy}
+
+            pool := NewServerPool()
+            if tt.enabled {
+                pool.EnableTLSResumption(TLSResumptionConfig{Name: "tls", Registry: registry})
+            }
+            pool.AddBackend(peer)
+
+            for i := 0; i < 3; i++ {
+                rr := httptest.NewRecorder()
+                pool.LoadBalancerHandler(rr, httptest.NewRequest("GET", "/", nil))
+                if rr.Code != http.StatusOK {
+                    t.Fatalf("Expected status 200, got %d", rr.Code)
+                }
+                proxy.Transport.(*http.Transport).CloseIdleConnections()
+            }
+
+            stats := peer.Stats()
+            if stats.TLSHandshakes != 3 || stats.TLSResumed != tt.expectedResumed {
+                t.Errorf("Expected 3 handshakes with %d resumed, got %d with %d resumed", tt.expectedResumed, stats.TLSHandshakes, stats.TLSResumed)
+            }
+            if !tt.enabled {
+                return
+            }
+            labels := []string{"pool", "tls", "backend", serverURL.String()}
+            resumed := registry.Counter("lb_backend_tls_handshakes_total", "", append(labels, "result", "resumed")...).Value()
+            full := registry.Counter("lb_backend_tls_handshakes_total", "", append(labels, "result", "full")...).Value()
+            if resumed != 2 || full != 1 {
+                t.Errorf("Expected 1 full and 2 resumed handshakes exported, got %v and %v", full, resumed)
+            }
+            if count := registry.Histogram("lb_backend_tls_handshake_seconds", "", metrics.DefaultBuckets, labels...).Count(); count != 3 {
+                t.Errorf("Expected 3 handshake latencies observed, got %d", count)
+            }
+        })
+    }
+}
@@ -0,0 +1,128 @@
+package balancer
+
+import (
+    "context"
+    "io"
+    "log"
+    "net/http"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+type WarmUpConfig struct {
+    Paths       []string
+    Count       int
+    Concurrency int
+    Timeout     time.Duration
+}
+
+func (serverpool *ServerPool) SetWarmUp(config WarmUpConfig) {
+    if config.Count <= 0 {
+        config.Count = 1
+    }
+    if config.Concurrency <= 0 {
+        config.Concurrency = 1
+    }
+    if config.Timeout <= 0 {
+        config.Timeout = 5 * time.Second
+    }
+    if len(config.Paths) == 0 {
+        config.Paths = []string{"/"}
+    }
+    serverpool.warmUp.Store(&config)
+}
+
+// admission tracks a backend held out of rotation while it is preflighted
+// or warmed up. A health check that fails meanwhile vetoes putting it back,
+// so the end of either does not override the check's verdict.
+type admission struct {
+    vetoed atomic.Bool
+}
+
+func (serverpool *ServerPool) startWarmUp(peer *backend.Backend) bool {
+    config := serverpool.warmUp.Load()
+    if config == nil {
+        return false
+    }
+    state := &admission{}
+    if _, warming := serverpool.warming.LoadOrStore(peer, state); warming {
+        return true
+    }
+
+    go func() {
+        defer serverpool.warming.Delete(peer)
+
+        failures := warmUp(peer, config)
+        if failures > 0 {
+            log.Printf("%s warm-up finished with %d failed requests\n", peer.URL, failures)
+        }
+        if state.vetoed.Load() {
+            log.Printf("%s [down, failed a health check while warming]\n", peer.URL)
+            return
+        }
+        serverpool.markUp(peer)
+    }()
+    return true
+}
+
+// vetoAdmission stops peer from entering rotation when its preflight or
+// warm-up ends.
+func (serverpool *ServerPool) vetoAdmission(peer *backend.Backend) {
+    for _, states := range []*sync.Map{&serverpool.preflighting, &serverpool.warming} {
+        if state, ok := states.Load(peer); ok {
+            state.(*admission).vetoed.Store(true)
+        }
+    }
+}
+
+func warmUp(peer *backend.Backend, config *WarmUpConfig) int64 {
+    transport := http.DefaultTransport
+    if peer.ReverseProxy != nil && peer.ReverseProxy.Transport != nil {
+        transport = peer.ReverseProxy.Transport
+    }
+    client := &http.Client{Transport: transport, Timeout: config.Timeout}
+
+    jobs := make(chan string)
+    var failures atomic.Int64
+    var wg sync.WaitGroup
+    for i := 0; i < config.Concurrency; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for path := range jobs {
+                if err := warmUpRequest(client, peer.URL.JoinPath(path).String()); err != nil {
+                    failures.Add(1)
+                }
+            }
+        }()
+    }
+
+    for _, path := range config.Paths {
+        for i := 0; i < config.Count; i++ {
+            jobs <- path
+        }
+    }
+    close(jobs)
+    wg.Wait()
+
+    return failures.Load()
+}
+
+func warmUpRequest(client *http.Client, target string) error {
+    request, err := http.NewRequestWithContext(context.Background(), http.MethodGet, target, nil)
+    if err != nil {
+        return err
+    }
+    request.Header.Set("User-Agent", "load-balancer-warmup")
+
+    response, err := client.Do(request)
+    if err != nil {
+        return err
+    }
+    defer response.Body.Close()
+    io.Copy(io.Discard, response.Body)
+    return nil
+}
@@ -0,0 +1,177 @@
+package balancer
+
+import (
+    "bytes"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "os"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+func newWarmUpServer() (*httptest.Server, func(path string) int) {
+    var mux sync.Mutex
+    hits := make(map[string]int)
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        mux.Lock()
+        hits[r.URL.Path]++
+        mux.Unlock()
+        w.WriteHeader(http.StatusOK)
+    }))
+
+    count := func(path string) int {
+        mux.Lock()
+        defer mux.Unlock()
+        return hits[path]
+    }
+    return server, count
+}
+
+func waitForAlive(t *testing.T, peer *backend.Backend) {
+    t.Helper()
+
+    deadline := time.Now().Add(2 * time.Second)
+    for !peer.IsAlive() {
+        if time.Now().After(deadline) {
+            t.Fatal("backend did not enter rotation after warm-up")
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+}
+
+func TestServerPool_WarmUpOnAdd(t *testing.T) {
+    log.SetOutput(&bytes.Buffer{})
+    defer log.SetOutput(os.Stderr)
+
+    server, hits := newWarmUpServer()
+    defer server.Close()
+
+    pool := NewServerPool()
+    pool.SetWarmUp(WarmUpConfig{
+        Paths:       []string{"/", "/catalog"},
+        Count:       3,
+        Concurrency: 2,
+    })
+
+    serverURL, _ := url.Parse(server.URL)
+    peer := &backend.Backend{
+        URL:          serverURL,
+        Alive:        true,
+        ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL),
+    }
+    pool.AddBackend(peer)
+
+    waitForAlive(t, peer)
+
+    tests := []struct {
+        path     string
+        expected int
+    }{
+        {path: "/", expected: 3},
+        {path: "/catalog", expected: 3},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.path, func(t *testing.T) {
+            if got := hits(tt.path); got != tt.expected {
+                t.Errorf("Expected %d warm-up requests to %s, got %d", tt.expected, tt.path, got)
+            }
+        })
+    }
+}
+
+func TestServerPool_WarmUpOnRevival(t *testing.T) {
+    log.SetOutput(&bytes.Buffer{})
+    defer log.SetOutput(os.Stderr)
+
+    server, hits := newWarmUpServer()
+    defer server.Close()
+
+    pool := NewServerPool()
+    serverURL, _ := url.Parse(server.URL)
+    peer := &backend.Backend{
+        URL:          serverURL,
+        Alive:        false,
+        ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL),
+    }
+    pool.AddBackend(peer)
+    pool.SetWarmUp(WarmUpConfig{Paths: []string{"/warm"}, Count: 2})
+
+    pool.HealthCheck()
+    waitForAlive(t, peer)
+
+    if got := hits("/warm"); got != 2 {
+        t.Errorf("Expected 2 warm-up requests, got %d", got)
+    }
+
+    pool.HealthCheck()
+    if got := hits("/warm"); got != 2 {
+        t.Errorf("Already alive backend should not be warmed again, got %d requests", got)
+    }
+}
+
+func TestServerPool_WithoutWarmUp(t *testing.T) {
+    pool := NewServerPool()
+    testURL, _ := url.Parse("http://example.com:8080")
+    peer := &backend.Backend{
+        URL:          testURL,
+        Alive:        true,
+        ReverseProxy: httputil.NewSingleHostReverseProxy(testURL),
+    }
+    pool.AddBackend(peer)
+
+    if !peer.IsAlive() {
+        t.Error("Backend should stay alive when warm-up is not configured")
+    }
+}
+
+func TestServerPool_WarmUpHonoursFailedHealthCheck(t *testing.T) {
+    log.SetOutput(&bytes.Buffer{})
+    defer log.SetOutput(os.Stderr)
+
+    release := make(chan struct{})
+    var healthy atomic.Bool
+    healthy.Store(true)
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/warm" {
+            <-release
+            return
+        }
+        if !healthy.Load() {
+            w.WriteHeader(http.StatusServiceUnavailable)
+        }
+    }))
+    defer server.Close()
+
+    pool := NewServerPool()
+    pool.SetWarmUp(WarmUpConfig{Paths: []string{"/warm"}})
+    serverURL, _ := url.Parse(server.URL)
+    peer := &backend.Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)}
+    pool.AddBackend(peer)
+
+    healthy.Store(false)
+    pool.HealthCheck()
+    close(release)
+
+    deadline := time.Now().Add(2 * time.Second)
+    for {
+        if _, warming := pool.warming.Load(peer); !warming {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("warm-up did not finish")
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+    if peer.IsAlive() {
+        t.Error("Expected a backend that failed a health check while warming to stay down")
+    }
+}
@@ -0,0 +1,284 @@
+package certs
+
+import (
+    "bytes"
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "sync"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/metrics"
+)
+
+// Config lists the certificates served for terminated TLS. Each chain should
+// include its issuer so OCSP responses can be fetched and checked.
+// Certificates expiring within WarnDays (default 14) are logged on every
+// check, which runs each Interval (default an hour).
+type Config struct {
+    Certificates []tls.Certificate
+    WarnDays     int
+    Interval     time.Duration
+    Client       *http.Client
+    Registry     *metrics.Registry
+}
+
+type CertificateStatus struct {
+    Hostnames      []string  `json:"hostnames"`
+    NotAfter       time.Time `json:"not_after"`
+    DaysLeft       float64   `json:"days_left"`
+    Expiring       bool      `json:"expiring"`
+    OCSP           string    `json:"ocsp"`
+    OCSPNextUpdate time.Time `json:"ocsp_next_update,omitempty"`
+    Error          string    `json:"error,omitempty"`
+}
+
+type entry struct {
+    certificate tls.Certificate
+    leaf        *x509.Certificate
+    issuer      *x509.Certificate
+    hostnames   []string
+    failures    *metrics.Counter
+
+    mux     sync.RWMutex
+    stapled *tls.Certificate
+    ocsp    string
+    status  ocspStatus
+    err     error
+}
+
+// Manager serves certificates with stapled OCSP responses and watches their
+// expiry.
+type Manager struct {
+    config  Config
+    entries []*entry
+}
+
+func NewManager(config Config) (*Manager, error) {
+    if len(config.Certificates) == 0 {
+        return nil, errors.New("certs: no certificates")
+    }
+    if config.WarnDays <= 0 {
+        config.WarnDays = 14
+    }
+    if config.Interval <= 0 {
+        config.Interval = time.Hour
+    }
+    if config.Client == nil {
+        config.Client = &http.Client{Timeout: 10 * time.Second}
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+
+    manager := &Manager{config: config}
+    for _, certificate := range config.Certificates {
+        if len(certificate.Certificate) == 0 {
+            return nil, errors.New("certs: empty certificate chain")
+        }
+        leaf := certificate.Leaf
+        if leaf == nil {
+            parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+            if err != nil {
+                return nil, fmt.Errorf("certs: %w", err)
+            }
+            leaf = parsed
+        }
+        item := &entry{certificate: certificate, leaf: leaf, hostnames: hostnames(leaf), ocsp: "none"}
+        if len(certificate.Certificate) > 1 {
+            if issuer, err := x509.ParseCertificate(certificate.Certificate[1]); err == nil {
+                item.issuer = issuer
+            }
+        }
+        stapled := certificate
+        item.stapled = &stapled
+
+        for _, hostname := range item.hostnames {
+            config.Registry.GaugeFunc("lb_tls_certificate_expiry_days", "Days until the certificate served for the hostname expires.", func() float64 {
+                return time.Until(leaf.NotAfter).Hours() / 24
+            }, "hostname", hostname)
+        }
+        config.Registry.GaugeFunc("lb_tls_ocsp_staple_valid", "Whether a current OCSP response is stapled for the certificate.", func() float64 {
+            if item.stapleValid(time.Now()) {
+                return 1
+            }
+            return 0
+        }, "hostname", item.hostnames[0])
+        item.failures = config.Registry.Counter("lb_tls_ocsp_fetch_failures_total", "OCSP responses that could not be fetched or verified.", "hostname", item.hostnames[0])
+        manager.entries = append(manager.entries, item)
+    }
+    return manager, nil
+}
+
+func hostnames(leaf *x509.Certificate) []string {
+    if len(leaf.DNSNames) > 0 {
+        return leaf.DNSNames
+    }
+    return []string{leaf.Subject.CommonName}
+}
+
+// Configure makes config serve the manager's certificates.
+func (manager *Manager) Configure(config *tls.Config) {
+    config.GetCertificate = manager.GetCertificate
+}
+
+// GetCertificate returns the first certificate the client supports, with
+// its OCSP response stapled when one is current.
+func (manager *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+    for _, item := range manager.entries {
+        if hello.SupportsCertificate(&item.certificate) == nil {
+            return item.current(), nil
+        }
+    }
+    return manager.entries[0].current(), nil
+}
+
+func (item *entry) current() *tls.Certificate {
+    item.mux.RLock()
+    defer item.mux.RUnlock()
+
+    return item.stapled
+}
+
+func (item *entry) stapleValid(now time.Time) bool {
+    item.mux.RLock()
+    defer item.mux.RUnlock()
+
+    return len(item.stapled.OCSPStaple) > 0 && (item.status.nextUpdate.IsZero() || now.Before(item.status.nextUpdate))
+}
+
+// Run checks expiry and refreshes OCSP staples every Interval until ctx is
+// cancelled.
+func (manager *Manager) Run(ctx context.Context) {
+    ticker := time.NewTicker(manager.config.Interval)
+    defer ticker.Stop()
+
+    for {
+        manager.Refresh(ctx, time.Now())
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// Refresh warns about expiring certificates and fetches a new OCSP response
+// for each certificate whose staple is missing or past half its validity.
+func (manager *Manager) Refresh(ctx context.Context, now time.Time) {
+    for _, item := range manager.entries {
+        if days := item.leaf.NotAfter.Sub(now).Hours() / 24; days < float64(manager.config.WarnDays) {
+            log.Printf("certs: certificate for %s expires in %.1f days (%s)\n", item.hostnames[0], days, item.leaf.NotAfter.Format(time.RFC3339))
+        }
+        if item.issuer == nil || len(item.leaf.OCSPServer) == 0 || !item.due(now) {
+            continue
+        }
+        status, raw, err := manager.fetch(ctx, item)
+        item.update(status, raw, err, now)
+        if err != nil {
+            item.failures.Inc()
+            log.Printf("certs: OCSP for %s: %v\n", item.hostnames[0], err)
+        }
+    }
+}
+
+func (item *entry) due(now time.Time) bool {
+    item.mux.RLock()
+    defer item.mux.RUnlock()
+
+    status := item.status
+    if len(item.stapled.OCSPStaple) == 0 || status.nextUpdate.IsZero() {
+        return true
+    }
+    return !now.Before(status.thisUpdate.Add(status.nextUpdate.Sub(status.thisUpdate) / 2))
+}
+
+func (manager *Manager) fetch(ctx context.Context, item *entry) (ocspStatus, []byte, error) {
+    body, err := createRequest(item.leaf, item.issuer)
+    if err != nil {
+        return ocspStatus{}, nil, err
+    }
+    request, err := http.NewRequestWithContext(ctx, http.MethodPost, item.leaf.OCSPServer[0], bytes.NewReader(body))
+    if err != nil {
+        return ocspStatus{}, nil, err
+    }
+    request.Header.Set("Content-Type", "application/ocsp-request")
+    response, err := manager.config.Client.Do(request)
+    if err != nil {
+        return ocspStatus{}, nil, err
+    }
+    defer response.Body.Close()
+    if response.StatusCode != http.StatusOK {
+        return ocspStatus{}, nil, fmt.Errorf("responder answered %d", response.StatusCode)
+    }
+    raw, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+    if err != nil {
+        return ocspStatus{}, nil, err
+    }
+    status, err := parseResponse(raw, item.leaf, item.issuer)
+    return status, raw, err
+}
+
+// update staples a good response. A failed fetch keeps the current staple
+// until it runs out; a revoked certificate loses its staple at once.
+func (item *entry) update(status ocspStatus, raw []byte, err error, now time.Time) {
+    item.mux.Lock()
+    defer item.mux.Unlock()
+
+    item.err = err
+    if err != nil {
+        if !item.status.nextUpdate.IsZero() && !now.Before(item.status.nextUpdate) {
+            item.unstapleLocked("expired")
+        }
+        return
+    }
+    item.status = status
+    if !status.good {
+        item.unstapleLocked("revoked")
+        log.Printf("certs: certificate for %s is not in good standing with its OCSP responder\n", item.hostnames[0])
+        return
+    }
+    stapled := item.certificate
+    stapled.OCSPStaple = raw
+    item.stapled, item.ocsp = &stapled, "good"
+}
+
+func (item *entry) unstapleLocked(reason string) {
+    stapled := item.certificate
+    item.stapled, item.ocsp = &stapled, reason
+}
+
+func (manager *Manager) Status(now time.Time) []CertificateStatus {
+    statuses := make([]CertificateStatus, 0, len(manager.entries))
+    for _, item := range manager.entries {
+        days := item.leaf.NotAfter.Sub(now).Hours() / 24
+        item.mux.RLock()
+        status := CertificateStatus{
+            Hostnames:      item.hostnames,
+            NotAfter:       item.leaf.NotAfter,
+            DaysLeft:       days,
+            Expiring:       days < float64(manager.config.WarnDays),
+            OCSP:           item.ocsp,
+            OCSPNextUpdate: item.status.nextUpdate,
+        }
+        if item.err != nil {
+            status.Error = item.err.Error()
+        }
+        item.mux.RUnlock()
+        statuses = append(statuses, status)
+    }
+    return statuses
+}
+
+func (manager *Manager) Register(server *admin.Server) {
+    server.HandleFunc("GET /admin/certificates", func(writer http.ResponseWriter, request *http.Request) {
+        admin.WriteJSON(writer, http.StatusOK, manager.Status(time.Now()))
+    })
+}
@@ -0,0 +1,216 @@
+package certs
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/asn1"
+    "io"
+    "log"
+    "math/big"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "testing"
+    "time"
+
+    "load-balancer/internal/metrics"
+)
+
+type testCA struct {
+    cert *x509.Certificate
+    key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+    t.Helper()
+
+    key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    template := &x509.Certificate{
+        SerialNumber:          big.NewInt(1),
+        Subject:               pkix.Name{CommonName: "Test CA"},
+        NotBefore:             time.Now().Add(-time.Hour),
+        NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+        IsCA:                  true,
+        BasicConstraintsValid: true,
+        KeyUsage:              x509.KeyUsageCertSign,
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+    if err != nil {
+        t.Fatalf("create CA: %v", err)
+    }
+    cert, _ := x509.ParseCertificate(der)
+    return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, hostname, ocspURL string, validFor time.Duration) tls.Certificate {
+    t.Helper()
+
+    key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    template := &x509.Certificate{
+        SerialNumber: big.NewInt(time.Now().UnixNano()),
+        Subject:      pkix.Name{CommonName: hostname},
+        DNSNames:     []string{hostname},
+        NotBefore:    time.Now().Add(-time.Hour),
+        NotAfter:     time.Now().Add(validFor),
+        OCSPServer:   []string{ocspURL},
+        KeyUsage:     x509.KeyUsageDigitalSignature,
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+    if err != nil {
+        t.Fatalf("create leaf: %v", err)
+    }
+    return tls.Certificate{Certificate: [][]byte{der, ca.cert.Raw}, PrivateKey: key}
+}
+
+// respond builds a basic OCSP response for the request, signed by key.
+func (ca *testCA) respond(t *testing.T, request []byte, revoked bool, key *ecdsa.PrivateKey) []byte {
+    t.Helper()
+
+    var parsed ocspRequest
+    if _, err := asn1.Unmarshal(request, &parsed); err != nil || len(parsed.TBSRequest.RequestList) != 1 {
+        t.Fatalf("malformed OCSP request: %v", err)
+    }
+    status := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0}
+    if revoked {
+        revokedAt, _ := asn1.MarshalWithParams(time.Now().UTC(), "generalized")
+        status = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: revokedAt}
+    }
+    responderKey, _ := asn1.Marshal(parsed.TBSRequest.RequestList[0].Cert.IssuerKeyHash)
+    now := time.Now().UTC().Truncate(time.Second)
+    tbs, err := asn1.Marshal(responseData{
+        ResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: responderKey},
+        ProducedAt:  now,
+        Responses: []singleResponse{{
+            CertID:     parsed.TBSRequest.RequestList[0].Cert,
+            Status:     status,
+            ThisUpdate: now,
+            NextUpdate: now.Add(4 * 24 * time.Hour),
+        }},
+    })
+    if err != nil {
+        t.Fatalf("marshal response data: %v", err)
+    }
+    digest := sha256.Sum256(tbs)
+    signature, _ := ecdsa.SignASN1(rand.Reader, key, digest[:])
+    basic, _ := asn1.Marshal(basicResponse{
+        TBSResponseData:    asn1.RawValue{FullBytes: tbs},
+        SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+        Signature:          asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+    })
+    raw, _ := asn1.Marshal(ocspResponse{ResponseBytes: responseBytes{ResponseType: oidOCSPBasic, Response: basic}})
+    return raw
+}
+
+func TestManager_OCSPStapling(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    ca := newTestCA(t)
+    impostor, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+    tests := []struct {
+        name           string
+        responderCode  int
+        revoked        bool
+        signer         *ecdsa.PrivateKey
+        expectedStaple bool
+        expectedOCSP   string
+        expectedFailed float64
+    }{
+        {name: "good response is stapled", responderCode: http.StatusOK, signer: ca.key, expectedStaple: true, expectedOCSP: "good"},
+        {name: "revoked certificate is not stapled", responderCode: http.StatusOK, revoked: true, signer: ca.key, expectedOCSP: "revoked"},
+        {name: "responder error", responderCode: http.StatusInternalServerError, signer: ca.key, expectedOCSP: "none", expectedFailed: 1},
+        {name: "forged signature", responderCode: http.StatusOK, signer: impostor, expectedOCSP: "none", expectedFailed: 1},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                body, _ := io.ReadAll(r.Body)
+                if tt.responderCode != http.StatusOK {
+                    w.WriteHeader(tt.responderCode)
+                    return
+                }
+                w.Header().Set("Content-Type", "application/ocsp-response")
+                w.Write(ca.respond(t, body, tt.revoked, tt.signer))
+            }))
+            defer responder.Close()
+
+            registry := metrics.NewRegistry()
+            manager, err := NewManager(Config{
+                Certificates: []tls.Certificate{ca.issue(t, "www.example.com", responder.URL, 90*24*time.Hour)},
+                Registry:     registry,
+            })
+            if err != nil {
+                t.Fatalf("NewManager() error: %v", err)
+            }
+            manager.Refresh(context.Background(), time.Now())
+
+            served, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.com"})
+            if err != nil {
+                t.Fatalf("GetCertificate() error: %v", err)
+            }
+            if stapled := len(served.OCSPStaple) > 0; stapled != tt.expectedStaple {
+                t.Errorf("Expected stapled %v, got %v", tt.expectedStaple, stapled)
+            }
+            if status := manager.Status(time.Now())[0]; status.OCSP != tt.expectedOCSP {
+                t.Errorf("Expected OCSP status %q, got %q (%s)", tt.expectedOCSP, status.OCSP, status.Error)
+            }
+            if failed := registry.Counter("lb_tls_ocsp_fetch_failures_total", "", "hostname", "www.example.com").Value(); failed != tt.expectedFailed {
+                t.Errorf("Expected %v fetch failures, got %v", tt.expectedFailed, failed)
+            }
+        })
+    }
+}
+
+func TestManager_Expiry(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    ca := newTestCA(t)
+    registry := metrics.NewRegistry()
+    manager, err := NewManager(Config{
+        Certificates: []tls.Certificate{
+            ca.issue(t, "soon.example.com", "http://127.0.0.1:1", 5*24*time.Hour),
+            ca.issue(t, "later.example.com", "http://127.0.0.1:1", 60*24*time.Hour),
+        },
+        Registry: registry,
+    })
+    if err != nil {
+        t.Fatalf("NewManager() error: %v", err)
+    }
+
+    tests := []struct {
+        hostname string
+        minDays  float64
+        maxDays  float64
+        expiring bool
+    }{
+        {hostname: "soon.example.com", minDays: 4.9, maxDays: 5, expiring: true},
+        {hostname: "later.example.com", minDays: 59.9, maxDays: 60, expiring: false},
+    }
+
+    statuses := manager.Status(time.Now())
+    for i, tt := range tests {
+        t.Run(tt.hostname, func(t *testing.T) {
+            days := registry.Gauge("lb_tls_certificate_expiry_days", "", "hostname", tt.hostname).Value()
+            if days < tt.minDays || days > tt.maxDays {
+                t.Errorf("Expected between %v and %v days left, got %v", tt.minDays, tt.maxDays, days)
+            }
+            if statuses[i].Expiring != tt.expiring {
+                t.Errorf("Expected expiring %v, got %v", tt.expiring, statuses[i].Expiring)
+            }
+        })
+    }
+
+    served, _ := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "later.example.com", SignatureSchemes: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256}, SupportedCurves: []tls.CurveID{tls.CurveP256}, SupportedVersions: []uint16{tls.VersionTLS13}})
+    if leaf, _ := x509.ParseCertificate(served.Certificate[0]); leaf.DNSNames[0] != "later.example.com" {
+        t.Errorf("Expected the certificate for later.example.com, got %v", leaf.DNSNames)
+    }
+}
@@ -0,0 +1,184 @@
+package certs
+
+import (
+    "bytes"
+    "crypto/sha1"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/asn1"
+    "errors"
+    "fmt"
+    "math/big"
+    "slices"
+    "time"
+)
+
+// The subset of RFC 6960 needed to ask a responder about one certificate
+// and check its answer before stapling it.
+
+var (
+    oidSHA1      = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+    oidOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+)
+
+var signatureAlgorithms = map[string]x509.SignatureAlgorithm{
+    "1.2.840.113549.1.1.5":  x509.SHA1WithRSA,
+    "1.2.840.113549.1.1.11": x509.SHA256WithRSA,
+    "1.2.840.113549.1.1.12": x509.SHA384WithRSA,
+    "1.2.840.113549.1.1.13": x509.SHA512WithRSA,
+    "1.2.840.10045.4.1":     x509.ECDSAWithSHA1,
+    "1.2.840.10045.4.3.2":   x509.ECDSAWithSHA256,
+    "1.2.840.10045.4.3.3":   x509.ECDSAWithSHA384,
+    "1.2.840.10045.4.3.4":   x509.ECDSAWithSHA512,
+    "1.3.101.112":           x509.PureEd25519,
+}
+
+type certID struct {
+    HashAlgorithm  pkix.AlgorithmIdentifier
+    IssuerNameHash []byte
+    IssuerKeyHash  []byte
+    SerialNumber   *big.Int
+}
+
+type ocspRequest struct {
+    TBSRequest tbsRequest
+}
+
+type tbsRequest struct {
+    RequestList []singleRequest
+}
+
+type singleRequest struct {
+    Cert certID
+}
+
+type ocspResponse struct {
+    Status        asn1.Enumerated
+    ResponseBytes responseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type responseBytes struct {
+    ResponseType asn1.ObjectIdentifier
+    Response     []byte
+}
+
+type basicResponse struct {
+    TBSResponseData    asn1.RawValue
+    SignatureAlgorithm pkix.AlgorithmIdentifier
+    Signature          asn1.BitString
+    Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type responseData struct {
+    Version     int `asn1:"optional,explicit,default:0,tag:0"`
+    ResponderID asn1.RawValue
+    ProducedAt  time.Time `asn1:"generalized"`
+    Responses   []singleResponse
+    Extensions  []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type singleResponse struct {
+    CertID     certID
+    Status     asn1.RawValue
+    ThisUpdate time.Time        `asn1:"generalized"`
+    NextUpdate time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+    Extensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+// ocspStatus is a verified responder answer for one certificate.
+type ocspStatus struct {
+    good       bool
+    thisUpdate time.Time
+    nextUpdate time.Time
+}
+
+func newCertID(leaf, issuer *x509.Certificate) (certID, error) {
+    var spki struct {
+        Algorithm pkix.AlgorithmIdentifier
+        PublicKey asn1.BitString
+    }
+    if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+        return certID{}, err
+    }
+    nameHash := sha1.Sum(issuer.RawSubject)
+    keyHash := sha1.Sum(spki.PublicKey.RightAlign())
+    return certID{
+        HashAlgorithm:  pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+        IssuerNameHash: nameHash[:],
+        IssuerKeyHash:  keyHash[:],
+        SerialNumber:   leaf.SerialNumber,
+    }, nil
+}
+
+func createRequest(leaf, issuer *x509.Certificate) ([]byte, error) {
+    id, err := newCertID(leaf, issuer)
+    if err != nil {
+        return nil, err
+    }
+    return asn1.Marshal(ocspRequest{TBSRequest: tbsRequest{RequestList: []singleRequest{{Cert: id}}}})
+}
+
+// parseResponse checks that raw is a successful answer about leaf, signed by
+// issuer or by a responder certificate issuer delegated OCSP signing to.
+func parseResponse(raw []byte, leaf, issuer *x509.Certificate) (ocspStatus, error) {
+    var response ocspResponse
+    if rest, err := asn1.Unmarshal(raw, &response); err != nil || len(rest) > 0 {
+        return ocspStatus{}, errors.New("ocsp: malformed response")
+    }
+    if response.Status != 0 {
+        return ocspStatus{}, fmt.Errorf("ocsp: responder returned status %d", response.Status)
+    }
+    if !response.ResponseBytes.ResponseType.Equal(oidOCSPBasic) {
+        return ocspStatus{}, errors.New("ocsp: unsupported response type")
+    }
+
+    var basic basicResponse
+    if _, err := asn1.Unmarshal(response.ResponseBytes.Response, &basic); err != nil {
+        return ocspStatus{}, errors.New("ocsp: malformed basic response")
+    }
+    var data responseData
+    if _, err := asn1.Unmarshal(basic.TBSResponseData.FullBytes, &data); err != nil {
+        return ocspStatus{}, errors.New("ocsp: malformed response data")
+    }
+    if err := verifySignature(&basic, issuer); err != nil {
+        return ocspStatus{}, err
+    }
+
+    want, err := newCertID(leaf, issuer)
+    if err != nil {
+        return ocspStatus{}, err
+    }
+    for _, single := range data.Responses {
+        id := single.CertID
+        if id.SerialNumber.Cmp(want.SerialNumber) != 0 || !bytes.Equal(id.IssuerNameHash, want.IssuerNameHash) || !bytes.Equal(id.IssuerKeyHash, want.IssuerKeyHash) {
+            continue
+        }
+        return ocspStatus{
+            good:       single.Status.Class == asn1.ClassContextSpecific && single.Status.Tag == 0,
+            thisUpdate: single.ThisUpdate,
+            nextUpdate: single.NextUpdate,
+        }, nil
+    }
+    return ocspStatus{}, errors.New("ocsp: response does not cover the certificate")
+}
+
+func verifySignature(basic *basicResponse, issuer *x509.Certificate) error {
+    algorithm, ok := signatureAlgorithms[basic.SignatureAlgorithm.Algorithm.String()]
+    if !ok {
+        return fmt.Errorf("ocsp: unsupported signature algorithm %s", basic.SignatureAlgorithm.Algorithm)
+    }
+    signed, signature := basic.TBSResponseData.FullBytes, basic.Signature.RightAlign()
+    if issuer.CheckSignature(algorithm, signed, signature) == nil {
+        return nil
+    }
+    for _, raw := range basic.Certificates {
+        responder, err := x509.ParseCertificate(raw.FullBytes)
+        if err != nil || responder.CheckSignatureFrom(issuer) != nil || !slices.Contains(responder.ExtKeyUsage, x509.ExtKeyUsageOCSPSigning) {
+            continue
+        }
+        if responder.CheckSignature(algorithm, signed, signature) == nil {
+            return nil
+        }
+    }
+    return errors.New("ocsp: response signature does not verify")
+}
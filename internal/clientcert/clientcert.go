@@ -0,0 +1,151 @@
+package clientcert
+
+import (
+    "crypto/x509"
+    "fmt"
+    "log"
+    "net/http"
+    "path"
+
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+)
+
+// PoolRule sends requests whose client certificate matches one of Match to
+// Pool.
+type PoolRule struct {
+    Match []string
+    Pool  string
+}
+
+// Config restricts and routes requests by the identity in their verified
+// client certificate. A certificate's identities are its URI, DNS and email
+// SANs as written, plus "OU=<unit>" for each organizational unit in its
+// subject. Patterns use path.Match syntax, so "spiffe://ns/payments/*"
+// matches every workload in the payments namespace.
+//
+// Deny is checked first. When Allow is set, only certificates matching it
+// get through; requests without a verified certificate are refused. The
+// first matching PoolRule picks the pool. The matched identity is logged
+// and sent to backends in Header (default X-Client-Identity).
+type Config struct {
+    Name     string
+    Allow    []string
+    Deny     []string
+    Pools    []PoolRule
+    Header   string
+    Registry *metrics.Registry
+}
+
+// Middleware enforces config, typically as part of a route's middleware.
+// The listener must request and verify client certificates for it to see
+// any.
+func Middleware(config Config) (func(http.Handler) http.Handler, error) {
+    for _, patterns := range append([][]string{config.Allow, config.Deny}, poolPatterns(config.Pools)...) {
+        for _, pattern := range patterns {
+            if _, err := path.Match(pattern, ""); err != nil {
+                return nil, fmt.Errorf("clientcert %s: invalid pattern %q", config.Name, pattern)
+            }
+        }
+    }
+    if config.Name == "" {
+        config.Name = "default"
+    }
+    if config.Header == "" {
+        config.Header = "X-Client-Identity"
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+            request.Header.Del(config.Header)
+            identities := Identities(request)
+
+            if identity, ok := match(identities, config.Deny); ok {
+                config.refuse(writer, request, identity, "denied")
+                return
+            }
+            identity, ok := match(identities, config.Allow)
+            if len(config.Allow) > 0 && !ok {
+                config.refuse(writer, request, first(identities), "not_allowed")
+                return
+            }
+            for _, rule := range config.Pools {
+                if matched, ok := match(identities, rule.Match); ok {
+                    identity = matched
+                    request = balancer.WithPool(request, rule.Pool)
+                    break
+                }
+            }
+            if identity == "" {
+                identity = first(identities)
+            }
+
+            config.Registry.Counter("lb_client_cert_decisions_total", "Requests allowed or refused by client certificate rules.", "rule", config.Name, "decision", "allowed").Inc()
+            if identity != "" {
+                request.Header.Set(config.Header, identity)
+                log.Printf("%s %s %s client identity %s\n", request.RemoteAddr, request.Method, request.URL.Path, identity)
+            }
+            next.ServeHTTP(writer, request)
+        })
+    }, nil
+}
+
+func (config Config) refuse(writer http.ResponseWriter, request *http.Request, identity, decision string) {
+    config.Registry.Counter("lb_client_cert_decisions_total", "Requests allowed or refused by client certificate rules.", "rule", config.Name, "decision", decision).Inc()
+    if identity == "" {
+        identity = "none"
+    }
+    log.Printf("%s %s %s client identity %s refused [%s]\n", request.RemoteAddr, request.Method, request.URL.Path, identity, decision)
+    http.Error(writer, "Forbidden", http.StatusForbidden)
+}
+
+// Identities returns the identities of the request's verified client
+// certificate, or nil when the client did not present one that verified.
+func Identities(request *http.Request) []string {
+    if request.TLS == nil || len(request.TLS.VerifiedChains) == 0 || len(request.TLS.VerifiedChains[0]) == 0 {
+        return nil
+    }
+    return identities(request.TLS.VerifiedChains[0][0])
+}
+
+func identities(leaf *x509.Certificate) []string {
+    var identities []string
+    for _, uri := range leaf.URIs {
+        identities = append(identities, uri.String())
+    }
+    identities = append(identities, leaf.DNSNames...)
+    identities = append(identities, leaf.EmailAddresses...)
+    for _, unit := range leaf.Subject.OrganizationalUnit {
+        identities = append(identities, "OU="+unit)
+    }
+    return identities
+}
+
+func match(identities, patterns []string) (string, bool) {
+    for _, identity := range identities {
+        for _, pattern := range patterns {
+            if ok, _ := path.Match(pattern, identity); ok {
+                return identity, true
+            }
+        }
+    }
+    return "", false
+}
+
+func first(identities []string) string {
+    if len(identities) == 0 {
+        return ""
+    }
+    return identities[0]
+}
+
+func poolPatterns(rules []PoolRule) [][]string {
+    patterns := make([][]string, len(rules))
+    for i, rule := range rules {
+        patterns[i] = rule.Match
+    }
+    return patterns
+}
@@ -0,0 +1,131 @@
+package clientcert
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "os"
+    "testing"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+)
+
+func newPool(t *testing.T, name string) *balancer.ServerPool {
+    t.Helper()
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("X-Pool", name)
+        w.Header().Set("X-Seen-Identity", r.Header.Get("X-Client-Identity"))
+    }))
+    t.Cleanup(server.Close)
+
+    serverURL, _ := url.Parse(server.URL)
+    pool := balancer.NewServerPool()
+    pool.AddBackend(&backend.Backend{
+        URL:          serverURL,
+        Alive:        true,
+        ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL),
+    })
+    return pool
+}
+
+func withCertificate(request *http.Request, uri string, units ...string) *http.Request {
+    if uri == "" && len(units) == 0 {
+        return request
+    }
+    leaf := &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: units}}
+    if uri != "" {
+        parsed, _ := url.Parse(uri)
+        leaf.URIs = []*url.URL{parsed}
+    }
+    request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}}
+    return request
+}
+
+func TestMiddleware(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    registry := metrics.NewRegistry()
+    access, err := Middleware(Config{
+        Name:     "payments",
+        Allow:    []string{"spiffe://ns/payments/*", "OU=payments-ops"},
+        Deny:     []string{"spiffe://ns/payments/legacy"},
+        Pools:    []PoolRule{{Match: []string{"spiffe://ns/payments/canary"}, Pool: "canary"}},
+        Registry: registry,
+    })
+    if err != nil {
+        t.Fatalf("Middleware() error: %v", err)
+    }
+
+    router := balancer.NewRouter("web")
+    router.AddPool("web", newPool(t, "web"))
+    router.AddPool("payments", newPool(t, "payments"))
+    router.AddPool("canary", newPool(t, "canary"))
+    router.AddRoute(balancer.Route{
+        Name:       "payments",
+        PathPrefix: "/payments",
+        Pool:       "payments",
+        Middleware: []func(http.Handler) http.Handler{access},
+    })
+
+    tests := []struct {
+        name             string
+        uri              string
+        units            []string
+        spoofed          string
+        expectedStatus   int
+        expectedPool     string
+        expectedIdentity string
+    }{
+        {name: "allowed workload", uri: "spiffe://ns/payments/api", expectedStatus: http.StatusOK, expectedPool: "payments", expectedIdentity: "spiffe://ns/payments/api"},
+        {name: "allowed by OU", uri: "spiffe://ns/ops/console", units: []string{"payments-ops"}, expectedStatus: http.StatusOK, expectedPool: "payments", expectedIdentity: "OU=payments-ops"},
+        {name: "routed to canary", uri: "spiffe://ns/payments/canary", expectedStatus: http.StatusOK, expectedPool: "canary", expectedIdentity: "spiffe://ns/payments/canary"},
+        {name: "other namespace", uri: "spiffe://ns/web/frontend", expectedStatus: http.StatusForbidden},
+        {name: "denied workload", uri: "spiffe://ns/payments/legacy", expectedStatus: http.StatusForbidden},
+        {name: "no certificate", expectedStatus: http.StatusForbidden},
+        {name: "spoofed header is replaced", uri: "spiffe://ns/payments/api", spoofed: "spiffe://ns/payments/admin", expectedStatus: http.StatusOK, expectedPool: "payments", expectedIdentity: "spiffe://ns/payments/api"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            request := withCertificate(httptest.NewRequest(http.MethodGet, "/payments/charge", nil), tt.uri, tt.units...)
+            if tt.spoofed != "" {
+                request.Header.Set("X-Client-Identity", tt.spoofed)
+            }
+            recorder := httptest.NewRecorder()
+            router.ServeHTTP(recorder, request)
+
+            if recorder.Code != tt.expectedStatus {
+                t.Fatalf("Expected status %d, got %d", tt.expectedStatus, recorder.Code)
+            }
+            if pool := recorder.Header().Get("X-Pool"); pool != tt.expectedPool {
+                t.Errorf("Expected pool %q, got %q", tt.expectedPool, pool)
+            }
+            if identity := recorder.Header().Get("X-Seen-Identity"); identity != tt.expectedIdentity {
+                t.Errorf("Expected identity %q, got %q", tt.expectedIdentity, identity)
+            }
+        })
+    }
+
+    if denied := registry.Counter("lb_client_cert_decisions_total", "", "rule", "payments", "decision", "denied").Value(); denied != 1 {
+        t.Errorf("Expected 1 denied request, got %v", denied)
+    }
+    if refused := registry.Counter("lb_client_cert_decisions_total", "", "rule", "payments", "decision", "not_allowed").Value(); refused != 2 {
+        t.Errorf("Expected 2 requests not allowed, got %v", refused)
+    }
+}
+
+func TestMiddleware_InvalidPattern(t *testing.T) {
+    if _, err := Middleware(Config{Allow: []string{"spiffe://ns/[payments"}, Registry: metrics.NewRegistry()}); err == nil {
+        t.Errorf("Expected an error for a malformed pattern")
+    }
+}
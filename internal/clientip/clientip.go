@@ -0,0 +1,78 @@
+package clientip
+
+import (
+    "fmt"
+    "net"
+    "net/http"
+    "strings"
+)
+
+// FromRequest is the address of the client behind request. When the peer
+// is a trusted proxy, X-Forwarded-For is walked from the right, skipping
+// the trusted hops, so a client cannot pick its address by forging the
+// header. With no trusted proxies it is the peer's address.
+func FromRequest(request *http.Request, trusted []*net.IPNet) string {
+    host, _, err := net.SplitHostPort(request.RemoteAddr)
+    if err != nil {
+        host = request.RemoteAddr
+    }
+    if !contains(trusted, host) {
+        return host
+    }
+    hops := strings.Split(strings.Join(request.Header.Values("X-Forwarded-For"), ","), ",")
+    for i := len(hops) - 1; i >= 0; i-- {
+        hop := strings.TrimSpace(hops[i])
+        if net.ParseIP(hop) == nil {
+            break
+        }
+        host = hop
+        if !contains(trusted, hop) {
+            break
+        }
+    }
+    return host
+}
+
+// Peer is the address of the peer that sent request, for callers that
+// trust no proxies.
+func Peer(request *http.Request) string {
+    return FromRequest(request, nil)
+}
+
+// ParseTrusted parses a comma-separated list of trusted proxies, each a
+// CIDR or a single address.
+func ParseTrusted(list string) ([]*net.IPNet, error) {
+    var networks []*net.IPNet
+    for _, item := range strings.Split(list, ",") {
+        item = strings.TrimSpace(item)
+        if item == "" {
+            continue
+        }
+        if !strings.Contains(item, "/") {
+            if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+                item += "/32"
+            } else {
+                item += "/128"
+            }
+        }
+        _, network, err := net.ParseCIDR(item)
+        if err != nil {
+            return nil, fmt.Errorf("invalid trusted proxy %q", item)
+        }
+        networks = append(networks, network)
+    }
+    return networks, nil
+}
+
+func contains(networks []*net.IPNet, address string) bool {
+    ip := net.ParseIP(address)
+    if ip == nil {
+        return false
+    }
+    for _, network := range networks {
+        if network.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,64 @@
+package clientip
+
+import (
+    "net/http/httptest"
+    "testing"
+)
+
+func TestFromRequest(t *testing.T) {
+    trusted, _ := ParseTrusted("10.0.0.0/8,192.168.1.1")
+
+    tests := []struct {
+        name       string
+        remoteAddr string
+        forwarded  []string
+        expected   string
+    }{
+        {name: "direct client", remoteAddr: "203.0.113.7:5000", expected: "203.0.113.7"},
+        {name: "forged header from untrusted peer", remoteAddr: "203.0.113.7:5000", forwarded: []string{"198.51.100.1"}, expected: "203.0.113.7"},
+        {name: "behind trusted proxy", remoteAddr: "10.1.2.3:5000", forwarded: []string{"198.51.100.1"}, expected: "198.51.100.1"},
+        {name: "chain of trusted proxies", remoteAddr: "10.1.2.3:5000", forwarded: []string{"198.51.100.9, 198.51.100.1, 192.168.1.1"}, expected: "198.51.100.1"},
+        {name: "repeated headers", remoteAddr: "10.1.2.3:5000", forwarded: []string{"198.51.100.9", "198.51.100.1, 10.0.0.5"}, expected: "198.51.100.1"},
+        {name: "trusted proxy without header", remoteAddr: "10.1.2.3:5000", expected: "10.1.2.3"},
+        {name: "garbage hop", remoteAddr: "10.1.2.3:5000", forwarded: []string{"198.51.100.1, unknown"}, expected: "10.1.2.3"},
+        {name: "address without port", remoteAddr: "203.0.113.7", expected: "203.0.113.7"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            request := httptest.NewRequest("GET", "/", nil)
+            request.RemoteAddr = tt.remoteAddr
+            for _, value := range tt.forwarded {
+                request.Header.Add("X-Forwarded-For", value)
+            }
+            if ip := FromRequest(request, trusted); ip != tt.expected {
+                t.Errorf("Expected %s, got %s", tt.expected, ip)
+            }
+        })
+    }
+}
+
+func TestParseTrusted(t *testing.T) {
+    tests := []struct {
+        name     string
+        list     string
+        expected int
+        err      bool
+    }{
+        {name: "empty", list: "", expected: 0},
+        {name: "cidrs and addresses", list: "10.0.0.0/8, 192.168.1.1,::1", expected: 3},
+        {name: "invalid", list: "10.0.0.0/8,proxy", err: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            networks, err := ParseTrusted(tt.list)
+            if (err != nil) != tt.err {
+                t.Fatalf("ParseTrusted() error = %v, expected error %v", err, tt.err)
+            }
+            if len(networks) != tt.expected {
+                t.Errorf("Expected %d networks, got %d", tt.expected, len(networks))
+            }
+        })
+    }
+}
@@ -0,0 +1,213 @@
+package coalesce
+
+import (
+    "bytes"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+)
+
+type Config struct {
+    VaryHeaders []string
+    MaxBodySize int
+}
+
+type Group struct {
+    config  Config
+    mux     sync.Mutex
+    calls   map[string]*call
+    leaders atomic.Uint64
+    shared  atomic.Uint64
+}
+
+type call struct {
+    done   chan struct{}
+    status int
+    header http.Header
+    body   bytes.Buffer
+    ok     bool
+}
+
+func NewGroup(config Config) *Group {
+    if config.MaxBodySize <= 0 {
+        config.MaxBodySize = 1 << 20
+    }
+    return &Group{config: config, calls: make(map[string]*call)}
+}
+
+func (group *Group) Stats() (leaders, shared uint64) {
+    return group.leaders.Load(), group.shared.Load()
+}
+
+func (group *Group) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        if !cacheable(request) {
+            next.ServeHTTP(writer, request)
+            return
+        }
+
+        key := group.key(request)
+        group.mux.Lock()
+        if existing, ok := group.calls[key]; ok {
+            group.mux.Unlock()
+            group.wait(existing, writer, request, next)
+            return
+        }
+        current := &call{done: make(chan struct{})}
+        group.calls[key] = current
+        group.mux.Unlock()
+
+        group.leaders.Add(1)
+        recorder := &teeWriter{ResponseWriter: writer, call: current, limit: group.config.MaxBodySize}
+        // A leader that panics, as ReverseProxy does when the upstream drops
+        // mid-body, leaves completed unset so waiters do not get the
+        // truncated body.
+        completed := false
+        defer func() {
+            group.mux.Lock()
+            delete(group.calls, key)
+            group.mux.Unlock()
+
+            current.status = recorder.status
+            current.header = writer.Header().Clone()
+            current.ok = completed && !recorder.overflow && recorder.status != 0 && recorder.status < http.StatusInternalServerError &&
+                group.shareable(current.header) && complete(request, current.header, current.body.Len())
+            close(current.done)
+        }()
+        next.ServeHTTP(recorder, request)
+        completed = true
+    })
+}
+
+func (group *Group) wait(existing *call, writer http.ResponseWriter, request *http.Request, next http.Handler) {
+    select {
+    case <-existing.done:
+    case <-request.Context().Done():
+        return
+    }
+
+    if !existing.ok {
+        next.ServeHTTP(writer, request)
+        return
+    }
+
+    group.shared.Add(1)
+    header := writer.Header()
+    for name, values := range existing.header {
+        header[name] = values
+    }
+    header.Set("X-Coalesced", "true")
+    writer.WriteHeader(existing.status)
+    writer.Write(existing.body.Bytes())
+}
+
+func (group *Group) key(request *http.Request) string {
+    var builder strings.Builder
+    builder.WriteString(request.Method)
+    builder.WriteByte(' ')
+    builder.WriteString(request.Host)
+    builder.WriteString(request.URL.RequestURI())
+    for _, name := range group.config.VaryHeaders {
+        builder.WriteByte('\n')
+        builder.WriteString(name)
+        builder.WriteByte(':')
+        builder.WriteString(strings.Join(request.Header.Values(name), ","))
+    }
+    return builder.String()
+}
+
+func cacheable(request *http.Request) bool {
+    if request.Method != http.MethodGet && request.Method != http.MethodHead {
+        return false
+    }
+    if request.Header.Get("Authorization") != "" || request.Header.Get("Cookie") != "" || request.Header.Get("Range") != "" {
+        return false
+    }
+    for _, directive := range strings.Split(request.Header.Get("Cache-Control"), ",") {
+        switch strings.TrimSpace(strings.ToLower(directive)) {
+        case "no-cache", "no-store":
+            return false
+        }
+    }
+    return true
+}
+
+// shareable reports whether a response may be handed to waiters. A
+// response that varies on a header the key leaves out could differ between
+// them, so it is not shared.
+func (group *Group) shareable(header http.Header) bool {
+    if header.Get("Set-Cookie") != "" {
+        return false
+    }
+    for _, value := range header.Values("Vary") {
+        for _, name := range strings.Split(value, ",") {
+            if name = strings.TrimSpace(name); name != "" && !group.varies(name) {
+                return false
+            }
+        }
+    }
+    for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+        switch strings.TrimSpace(strings.ToLower(directive)) {
+        case "private", "no-store":
+            return false
+        }
+    }
+    return true
+}
+
+// complete reports whether a body of size bytes is all of a response with
+// header, which it is not when the upstream dropped before the declared
+// Content-Length arrived. Responses to HEAD declare a length but carry no
+// body.
+func complete(request *http.Request, header http.Header, size int) bool {
+    if request.Method == http.MethodHead {
+        return true
+    }
+    length, err := strconv.Atoi(header.Get("Content-Length"))
+    return err != nil || length == size
+}
+
+func (group *Group) varies(name string) bool {
+    for _, vary := range group.config.VaryHeaders {
+        if strings.EqualFold(vary, name) {
+            return true
+        }
+    }
+    return false
+}
+
+type teeWriter struct {
+    http.ResponseWriter
+    call     *call
+    status   int
+    limit    int
+    overflow bool
+}
+
+func (writer *teeWriter) WriteHeader(status int) {
+    if writer.status == 0 && status >= http.StatusOK {
+        writer.status = status
+    }
+    writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *teeWriter) Write(p []byte) (int, error) {
+    if writer.status == 0 {
+        writer.status = http.StatusOK
+    }
+    if !writer.overflow {
+        if writer.call.body.Len()+len(p) > writer.limit {
+            writer.overflow = true
+            writer.call.body.Reset()
+        } else {
+            writer.call.body.Write(p)
+        }
+    }
+    return writer.ResponseWriter.Write(p)
+}
+
+func (writer *teeWriter) Unwrap() http.ResponseWriter {
+    return writer.ResponseWriter
+}
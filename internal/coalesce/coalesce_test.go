@@ -0,0 +1,283 @@
+package coalesce
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func runConcurrent(t *testing.T, handler http.Handler, requests []*http.Request) []*httptest.ResponseRecorder {
+    t.Helper()
+
+    recorders := make([]*httptest.ResponseRecorder, len(requests))
+    var wg sync.WaitGroup
+    for i, req := range requests {
+        recorders[i] = httptest.NewRecorder()
+        wg.Add(1)
+        go func(rr *httptest.ResponseRecorder, req *http.Request) {
+            defer wg.Done()
+            handler.ServeHTTP(rr, req)
+        }(recorders[i], req)
+    }
+    wg.Wait()
+    return recorders
+}
+
+func TestGroup_CoalescesIdenticalGets(t *testing.T) {
+    var upstreamCalls atomic.Int32
+    release := make(chan struct{})
+    upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        upstreamCalls.Add(1)
+        <-release
+        w.Header().Set("Content-Type", "text/plain")
+        w.Write([]byte("payload"))
+    })
+
+    group := NewGroup(Config{})
+    handler := group.Middleware(upstream)
+
+    var requests []*http.Request
+    for i := 0; i < 10; i++ {
+        requests = append(requests, httptest.NewRequest("GET", "/products?page=1", nil))
+    }
+
+    go func() {
+        deadline := time.Now().Add(2 * time.Second)
+        for time.Now().Before(deadline) {
+            group.mux.Lock()
+            waiting := len(group.calls)
+            group.mux.Unlock()
+            if waiting == 1 && upstreamCalls.Load() == 1 {
+                time.Sleep(20 * time.Millisecond)
+                break
+            }
+            time.Sleep(time.Millisecond)
+        }
+        close(release)
+    }()
+
+    recorders := runConcurrent(t, handler, requests)
+
+    if calls := upstreamCalls.Load(); calls != 1 {
+        t.Errorf("Expected 1 upstream call, got %d", calls)
+    }
+    coalesced := 0
+    for i, rr := range recorders {
+        if rr.Code != http.StatusOK || rr.Body.String() != "payload" {
+            t.Errorf("request %d: unexpected response %d %q", i, rr.Code, rr.Body.String())
+        }
+        if rr.Header().Get("X-Coalesced") == "true" {
+            coalesced++
+            if rr.Header().Get("Content-Type") != "text/plain" {
+                t.Errorf("request %d: headers not copied to waiter", i)
+            }
+        }
+    }
+    if coalesced != 9 {
+        t.Errorf("Expected 9 coalesced responses, got %d", coalesced)
+    }
+    if leaders, shared := group.Stats(); leaders != 1 || shared != 9 {
+        t.Errorf("Stats() = %d, %d; expected 1, 9", leaders, shared)
+    }
+}
+
+func TestGroup_Key(t *testing.T) {
+    group := NewGroup(Config{VaryHeaders: []string{"Accept-Language"}})
+
+    base := httptest.NewRequest("GET", "/a?x=1", nil)
+    base.Header.Set("Accept-Language", "en")
+
+    tests := []struct {
+        name   string
+        modify func(r *http.Request)
+        same   bool
+    }{
+        {name: "identical", modify: func(r *http.Request) {}, same: true},
+        {name: "different query", modify: func(r *http.Request) { r.URL.RawQuery = "x=2" }, same: false},
+        {name: "different vary header", modify: func(r *http.Request) { r.Header.Set("Accept-Language", "de") }, same: false},
+        {name: "non-vary header ignored", modify: func(r *http.Request) { r.Header.Set("User-Agent", "x") }, same: true},
+        {name: "different host", modify: func(r *http.Request) { r.Host = "other" }, same: false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            other := base.Clone(base.Context())
+            tt.modify(other)
+            if same := group.key(base) == group.key(other); same != tt.same {
+                t.Errorf("keys equal = %v, expected %v", same, tt.same)
+            }
+        })
+    }
+}
+
+func TestCacheable(t *testing.T) {
+    tests := []struct {
+        name     string
+        method   string
+        header   string
+        value    string
+        expected bool
+    }{
+        {name: "plain get", method: "GET", expected: true},
+        {name: "head", method: "HEAD", expected: true},
+        {name: "post", method: "POST", expected: false},
+        {name: "authorized", method: "GET", header: "Authorization", value: "Bearer x", expected: false},
+        {name: "cookie", method: "GET", header: "Cookie", value: "session=1", expected: false},
+        {name: "no-cache", method: "GET", header: "Cache-Control", value: "max-age=0, no-cache", expected: false},
+        {name: "range", method: "GET", header: "Range", value: "bytes=0-10", expected: false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            req := httptest.NewRequest(tt.method, "/", nil)
+            if tt.header != "" {
+                req.Header.Set(tt.header, tt.value)
+            }
+            if got := cacheable(req); got != tt.expected {
+                t.Errorf("cacheable() = %v, expected %v", got, tt.expected)
+            }
+        })
+    }
+}
+
+func TestGroup_UnshareableResponsesAreRetried(t *testing.T) {
+    var upstreamCalls atomic.Int32
+    upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        upstreamCalls.Add(1)
+        w.Header().Set("Set-Cookie", "session=1")
+        w.Write([]byte("private"))
+    })
+
+    group := NewGroup(Config{})
+    current := &call{done: make(chan struct{})}
+    group.calls[group.key(httptest.NewRequest("GET", "/me", nil))] = current
+
+    done := make(chan *httptest.ResponseRecorder)
+    go func() {
+        rr := httptest.NewRecorder()
+        group.Middleware(upstream).ServeHTTP(rr, httptest.NewRequest("GET", "/me", nil))
+        done <- rr
+    }()
+
+    current.header = http.Header{"Set-Cookie": {"session=other"}}
+    current.status = http.StatusOK
+    current.ok = group.shareable(current.header)
+    close(current.done)
+
+    rr := <-done
+    if upstreamCalls.Load() != 1 {
+        t.Errorf("Expected waiter to go upstream itself, got %d calls", upstreamCalls.Load())
+    }
+    if rr.Header().Get("Set-Cookie") != "session=1" {
+        t.Errorf("Waiter must not receive another client's cookie, got %q", rr.Header().Get("Set-Cookie"))
+    }
+}
+
+func TestGroup_SharesOnlyCompleteResponses(t *testing.T) {
+    tests := []struct {
+        name     string
+        leader   http.HandlerFunc
+        shared   bool
+        expected string
+    }{
+        {
+            name: "leader aborted mid-body",
+            leader: func(w http.ResponseWriter, r *http.Request) {
+                w.Write([]byte("part"))
+                panic(http.ErrAbortHandler)
+            },
+            expected: "fresh",
+        },
+        {
+            name: "upstream dropped before the declared length",
+            leader: func(w http.ResponseWriter, r *http.Request) {
+                w.Header().Set("Content-Length", "7")
+                w.Write([]byte("part"))
+            },
+            expected: "fresh",
+        },
+        {
+            name: "informational status before the response",
+            leader: func(w http.ResponseWriter, r *http.Request) {
+                w.Header().Set("Link", "</style.css>; rel=preload")
+                w.WriteHeader(http.StatusEarlyHints)
+                w.WriteHeader(http.StatusOK)
+                w.Write([]byte("payload"))
+            },
+            shared:   true,
+            expected: "payload",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var calls atomic.Int32
+            release := make(chan struct{})
+            upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                if calls.Add(1) == 1 {
+                    <-release
+                    tt.leader(w, r)
+                    return
+                }
+                w.Write([]byte("fresh"))
+            })
+            group := NewGroup(Config{})
+            handler := group.Middleware(upstream)
+
+            leaderDone := make(chan struct{})
+            go func() {
+                defer close(leaderDone)
+                defer func() { recover() }()
+                handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/page", nil))
+            }()
+            for calls.Load() == 0 {
+                time.Sleep(time.Millisecond)
+            }
+
+            waiter := make(chan *httptest.ResponseRecorder)
+            go func() {
+                rr := httptest.NewRecorder()
+                handler.ServeHTTP(rr, httptest.NewRequest("GET", "/page", nil))
+                waiter <- rr
+            }()
+            time.Sleep(20 * time.Millisecond)
+            close(release)
+            <-leaderDone
+
+            rr := <-waiter
+            if rr.Code != http.StatusOK || rr.Body.String() != tt.expected {
+                t.Errorf("Expected waiter to get 200 %q, got %d %q", tt.expected, rr.Code, rr.Body.String())
+            }
+            if shared := rr.Header().Get("X-Coalesced") == "true"; shared != tt.shared {
+                t.Errorf("Expected shared %v, got %v", tt.shared, shared)
+            }
+        })
+    }
+}
+
+func TestGroup_Shareable(t *testing.T) {
+    group := NewGroup(Config{VaryHeaders: []string{"Accept-Language"}})
+
+    tests := []struct {
+        name     string
+        header   http.Header
+        expected bool
+    }{
+        {name: "plain", header: http.Header{}, expected: true},
+        {name: "private", header: http.Header{"Cache-Control": {"private, max-age=60"}}, expected: false},
+        {name: "vary on a keyed header", header: http.Header{"Vary": {"accept-language"}}, expected: true},
+        {name: "vary on an unkeyed header", header: http.Header{"Vary": {"Accept-Language, Cookie"}}, expected: false},
+        {name: "vary star", header: http.Header{"Vary": {"*"}}, expected: false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := group.shareable(tt.header); got != tt.expected {
+                t.Errorf("shareable() = %v, expected %v", got, tt.expected)
+            }
+        })
+    }
+}
@@ -0,0 +1,234 @@
+package crash
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "os"
+    "path/filepath"
+    "runtime"
+    "runtime/debug"
+    "sort"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/requestid"
+)
+
+// Config describes where crash reports go. Dir is created if needed; Pools,
+// keyed by pool name, are the pools whose state each report records.
+type Config struct {
+    Dir   string
+    Pools map[string]*balancer.ServerPool
+}
+
+// Report is a crash report as written to disk, one JSON file per crash.
+type Report struct {
+    Time       time.Time                 `json:"time"`
+    PID        int                       `json:"pid"`
+    GoVersion  string                    `json:"go_version"`
+    Reason     string                    `json:"reason"`
+    Stack      string                    `json:"stack"`
+    Goroutines string                    `json:"goroutines"`
+    InFlight   []InFlight                `json:"in_flight"`
+    Pools      map[string][]BackendState `json:"pools"`
+}
+
+// InFlight is a request that was being served when the process crashed.
+type InFlight struct {
+    ID      string    `json:"id"`
+    Method  string    `json:"method"`
+    Host    string    `json:"host"`
+    Path    string    `json:"path"`
+    Started time.Time `json:"started"`
+}
+
+// BackendState is a backend's state and counters at the time of the crash.
+type BackendState struct {
+    URL      string `json:"url"`
+    Alive    bool   `json:"alive"`
+    Healthy  bool   `json:"healthy"`
+    Draining bool   `json:"draining"`
+    Override string `json:"override"`
+    InFlight int64  `json:"in_flight"`
+    Requests uint64 `json:"requests"`
+    Errors   uint64 `json:"errors"`
+}
+
+// Reporter writes a report when the process dies of a panic it guards or
+// a call to Fatal. Crashes of the runtime itself, such as concurrent map
+// writes, cannot be recovered from; their output goes to a runtime-<pid>.log
+// file in Dir instead, which Close removes when nothing was written.
+type Reporter struct {
+    config Config
+
+    mux      sync.Mutex
+    inFlight map[uint64]*InFlight
+    next     atomic.Uint64
+
+    once    sync.Once
+    runtime *os.File
+}
+
+func New(config Config) (*Reporter, error) {
+    if config.Dir == "" {
+        return nil, errors.New("crash: dir is required")
+    }
+    if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+        return nil, fmt.Errorf("crash: %w", err)
+    }
+    reporter := &Reporter{config: config, inFlight: make(map[uint64]*InFlight)}
+
+    file, err := os.Create(filepath.Join(config.Dir, fmt.Sprintf("runtime-%d.log", os.Getpid())))
+    if err != nil {
+        return nil, fmt.Errorf("crash: %w", err)
+    }
+    if err := debug.SetCrashOutput(file, debug.CrashOptions{}); err != nil {
+        file.Close()
+        os.Remove(file.Name())
+        return nil, fmt.Errorf("crash: %w", err)
+    }
+    reporter.runtime = file
+    return reporter, nil
+}
+
+// Close stops capturing runtime crashes on a clean shutdown.
+func (reporter *Reporter) Close() error {
+    debug.SetCrashOutput(nil, debug.CrashOptions{})
+    info, err := reporter.runtime.Stat()
+    reporter.runtime.Close()
+    if err == nil && info.Size() == 0 {
+        os.Remove(reporter.runtime.Name())
+    }
+    return nil
+}
+
+// Middleware tracks the requests in flight so a report can tell which ones
+// the crash cut short.
+func (reporter *Reporter) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        key := reporter.next.Add(1)
+        reporter.mux.Lock()
+        reporter.inFlight[key] = &InFlight{
+            ID:      requestid.Ensure(request),
+            Method:  request.Method,
+            Host:    request.Host,
+            Path:    request.URL.Path,
+            Started: time.Now(),
+        }
+        reporter.mux.Unlock()
+        defer func() {
+            reporter.mux.Lock()
+            delete(reporter.inFlight, key)
+            reporter.mux.Unlock()
+        }()
+        next.ServeHTTP(writer, request)
+    })
+}
+
+// Guard, deferred at the top of main and of long-lived goroutines, writes
+// a report for a panic before letting it take the process down.
+func (reporter *Reporter) Guard() {
+    if recovered := recover(); recovered != nil {
+        reporter.write(fmt.Sprintf("panic: %v", recovered))
+        panic(recovered)
+    }
+}
+
+// Go runs run in a goroutine under Guard.
+func (reporter *Reporter) Go(run func()) {
+    go func() {
+        defer reporter.Guard()
+        run()
+    }()
+}
+
+// Fatal writes a report for err and exits, in place of log.Fatal.
+func (reporter *Reporter) Fatal(err error) {
+    reporter.write(err.Error())
+    log.Printf("%v\n", err)
+    os.Exit(1)
+}
+
+// write saves one report. Only the first crash is reported: the others
+// are usually its consequences.
+func (reporter *Reporter) write(reason string) {
+    reporter.once.Do(func() {
+        path, err := reporter.save(reporter.report(reason))
+        if err != nil {
+            log.Printf("crash: could not write report: %v\n", err)
+            return
+        }
+        log.Printf("crash: report written to %s\n", path)
+    })
+}
+
+func (reporter *Reporter) report(reason string) Report {
+    now := time.Now()
+    report := Report{
+        Time:       now,
+        PID:        os.Getpid(),
+        GoVersion:  runtime.Version(),
+        Reason:     reason,
+        Stack:      string(debug.Stack()),
+        Goroutines: string(goroutines()),
+        InFlight:   []InFlight{},
+        Pools:      make(map[string][]BackendState),
+    }
+
+    reporter.mux.Lock()
+    for _, request := range reporter.inFlight {
+        report.InFlight = append(report.InFlight, *request)
+    }
+    reporter.mux.Unlock()
+    sort.Slice(report.InFlight, func(i, j int) bool { return report.InFlight[i].Started.Before(report.InFlight[j].Started) })
+
+    for name, pool := range reporter.config.Pools {
+        states := []BackendState{}
+        for _, peer := range pool.Backends() {
+            override, _ := peer.Override(now)
+            stats := peer.Stats()
+            states = append(states, BackendState{
+                URL:      peer.URL.String(),
+                Alive:    peer.IsAlive(),
+                Healthy:  peer.Healthy(),
+                Draining: peer.Draining(),
+                Override: override.String(),
+                InFlight: stats.InFlight,
+                Requests: stats.Requests,
+                Errors:   stats.Errors,
+            })
+        }
+        report.Pools[name] = states
+    }
+    return report
+}
+
+func (reporter *Reporter) save(report Report) (string, error) {
+    data, err := json.MarshalIndent(report, "", "  ")
+    if err != nil {
+        return "", err
+    }
+    path := filepath.Join(reporter.config.Dir, fmt.Sprintf("crash-%s-%d.json", report.Time.UTC().Format("20060102T150405Z"), report.PID))
+    if err := os.WriteFile(path, data, 0o644); err != nil {
+        return "", err
+    }
+    return path, nil
+}
+
+// goroutines dumps the stacks of all goroutines, growing the buffer until
+// the dump fits.
+func goroutines() []byte {
+    buf := make([]byte, 64<<10)
+    for {
+        n := runtime.Stack(buf, true)
+        if n < len(buf) {
+            return buf[:n]
+        }
+        buf = make([]byte, 2*len(buf))
+    }
+}
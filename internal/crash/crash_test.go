@@ -0,0 +1,87 @@
+package crash
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+)
+
+func TestReporter_Guard(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    dir := t.TempDir()
+    pool := balancer.NewServerPool()
+    peerURL, _ := url.Parse("http://a:80")
+    pool.AddBackend(&backend.Backend{URL: peerURL, Alive: true})
+
+    reporter, err := New(Config{Dir: dir, Pools: map[string]*balancer.ServerPool{"web": pool}})
+    if err != nil {
+        t.Fatalf("New() error: %v", err)
+    }
+
+    started := make(chan struct{})
+    release := make(chan struct{})
+    handler := reporter.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        close(started)
+        <-release
+    }))
+    done := make(chan struct{})
+    go func() {
+        request := httptest.NewRequest("GET", "/slow", nil)
+        request.Header.Set("X-Request-Id", "req-1")
+        handler.ServeHTTP(httptest.NewRecorder(), request)
+        close(done)
+    }()
+    <-started
+
+    var repanicked any
+    func() {
+        defer func() { repanicked = recover() }()
+        defer reporter.Guard()
+        panic("boom")
+    }()
+    close(release)
+    <-done
+    if repanicked != "boom" {
+        t.Errorf("Expected the panic to carry on after the report, got %v", repanicked)
+    }
+
+    reports, _ := filepath.Glob(filepath.Join(dir, "crash-*.json"))
+    if len(reports) != 1 {
+        t.Fatalf("Expected one report, got %d", len(reports))
+    }
+    data, _ := os.ReadFile(reports[0])
+    var report Report
+    if err := json.Unmarshal(data, &report); err != nil {
+        t.Fatalf("Expected a JSON report: %v", err)
+    }
+    if report.Reason != "panic: boom" {
+        t.Errorf("Expected reason %q, got %q", "panic: boom", report.Reason)
+    }
+    if !strings.Contains(report.Goroutines, "TestReporter_Guard") {
+        t.Error("Expected the goroutine dump in the report")
+    }
+    if len(report.InFlight) != 1 || report.InFlight[0].ID != "req-1" || report.InFlight[0].Path != "/slow" {
+        t.Errorf("Expected the in-flight request req-1, got %+v", report.InFlight)
+    }
+    if states := report.Pools["web"]; len(states) != 1 || states[0].URL != "http://a:80" || !states[0].Alive {
+        t.Errorf("Expected the state of pool web, got %+v", report.Pools)
+    }
+
+    reporter.Close()
+    if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("runtime-%d.log", os.Getpid()))); !os.IsNotExist(err) {
+        t.Errorf("Expected the empty runtime crash log removed on Close, got %v", err)
+    }
+}
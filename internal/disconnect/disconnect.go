@@ -0,0 +1,49 @@
+package disconnect
+
+import (
+    "log"
+    "net/http"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/clientip"
+    "load-balancer/internal/metrics"
+)
+
+// StatusClientClosedRequest is the non-standard status nginx logs when the
+// client goes away before the response is sent.
+const StatusClientClosedRequest = 499
+
+type Config struct {
+    Registry *metrics.Registry
+}
+
+// Middleware records requests whose client disconnected before the response
+// completed. The request context is cancelled as soon as the server notices
+// the disconnect, which aborts the upstream request; this middleware makes
+// those requests show up as 499 in logs and metrics instead of as backend
+// errors.
+func Middleware(config Config) func(http.Handler) http.Handler {
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+            start := time.Now()
+            next.ServeHTTP(writer, request)
+            if !backend.ClientGone(request) {
+                return
+            }
+
+            route := ""
+            if current := balancer.RouteFromContext(request.Context()); current != nil {
+                route = current.Name
+            }
+            config.Registry.Counter("lb_client_disconnects_total", "Requests abandoned by the client before the response completed.", "route", route).Inc()
+            log.Printf("%s %s %s %d client closed request after %s\n", clientip.Peer(request), request.Method, request.URL.RequestURI(), StatusClientClosedRequest, time.Since(start).Round(time.Millisecond))
+        })
+    }
+}
+
@@ -0,0 +1,89 @@
+package disconnect
+
+import (
+    "context"
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+)
+
+func TestMiddleware_ClientDisconnect(t *testing.T) {
+    var logs strings.Builder
+    log.SetOutput(&logs)
+    defer log.SetOutput(os.Stderr)
+
+    upstreamCancelled := make(chan time.Duration, 1)
+    upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/fast" {
+            w.Write([]byte("ok"))
+            return
+        }
+        start := time.Now()
+        select {
+        case <-r.Context().Done():
+            upstreamCancelled <- time.Since(start)
+        case <-time.After(5 * time.Second):
+        }
+    }))
+    defer upstream.Close()
+
+    upstreamURL, _ := url.Parse(upstream.URL)
+    peer := &backend.Backend{URL: upstreamURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(upstreamURL)}
+    pool := balancer.NewServerPool()
+    pool.AddBackend(peer)
+
+    registry := metrics.NewRegistry()
+    server := httptest.NewServer(Middleware(Config{Registry: registry})(http.HandlerFunc(pool.LoadBalancerHandler)))
+    defer server.Close()
+
+    response, err := http.Get(server.URL + "/fast")
+    if err != nil {
+        t.Fatal(err)
+    }
+    io.ReadAll(response.Body)
+    response.Body.Close()
+
+    ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+    defer cancel()
+    request, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/slow", nil)
+    if _, err := http.DefaultClient.Do(request); err == nil {
+        t.Fatal("Expected the client request to be cancelled")
+    }
+
+    select {
+    case elapsed := <-upstreamCancelled:
+        if elapsed > time.Second {
+            t.Errorf("Expected upstream request to be cancelled promptly, took %s", elapsed)
+        }
+    case <-time.After(2 * time.Second):
+        t.Fatal("Expected upstream request to be cancelled")
+    }
+
+    counter := registry.Counter("lb_client_disconnects_total", "", "route", "")
+    deadline := time.Now().Add(2 * time.Second)
+    for counter.Value() != 1 {
+        if time.Now().After(deadline) {
+            t.Fatalf("Expected 1 recorded disconnect, got %v", counter.Value())
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+
+    stats := peer.Stats()
+    if stats.ClientAborts != 1 || stats.Errors != 0 {
+        t.Errorf("Expected 1 client abort and no errors, got %d aborts and %d errors", stats.ClientAborts, stats.Errors)
+    }
+    if !strings.Contains(logs.String(), "GET /slow 499 client closed request") {
+        t.Errorf("Expected a 499 log line, got:\n%s", logs.String())
+    }
+}
@@ -0,0 +1,346 @@
+package discovery
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "net/http"
+    "net/http/httputil"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+)
+
+// BackendSpec is a discovered backend. A "tier" in Metadata sets the
+// backend's failover tier, and "health_path" and "health_port" where it is
+// health checked: a path starting with "/" and a port from 1 to 65535.
+// Specs with other values are skipped. A backend whose tier or health
+// metadata changes is replaced by a new one.
+type BackendSpec struct {
+    URL      string
+    Metadata map[string]string
+}
+
+// DiscoveryProvider is implemented by every discovery integration. Watch
+// sends the complete current backend set whenever it changes and closes the
+// channel once ctx is cancelled.
+type DiscoveryProvider interface {
+    Watch(ctx context.Context) <-chan []BackendSpec
+}
+
+// Static is a fixed backend list, sent once.
+type Static []BackendSpec
+
+func (static Static) Watch(ctx context.Context) <-chan []BackendSpec {
+    updates := make(chan []BackendSpec, 1)
+    updates <- append([]BackendSpec(nil), static...)
+    go func() {
+        <-ctx.Done()
+        close(updates)
+    }()
+    return updates
+}
+
+// ConflictPolicy decides how a Composite merges the sets reported by its
+// providers.
+type ConflictPolicy int
+
+const (
+    // PreferFirst takes the union of all providers; when two report the same
+    // URL, the spec from the earlier provider wins.
+    PreferFirst ConflictPolicy = iota
+    // PreferLast takes the union; the later provider wins on conflicts.
+    PreferLast
+    // Fallback uses only the first provider with a non-empty set, so later
+    // providers act as backups for earlier ones.
+    Fallback
+)
+
+// Composite combines several providers into one.
+type Composite struct {
+    Providers []DiscoveryProvider
+    Policy    ConflictPolicy
+}
+
+func Compose(policy ConflictPolicy, providers ...DiscoveryProvider) *Composite {
+    return &Composite{Providers: providers, Policy: policy}
+}
+
+type providerUpdate struct {
+    index int
+    specs []BackendSpec
+}
+
+func (composite *Composite) Watch(ctx context.Context) <-chan []BackendSpec {
+    updates := make(chan []BackendSpec)
+    received := make(chan providerUpdate)
+    for i, provider := range composite.Providers {
+        go func() {
+            for specs := range provider.Watch(ctx) {
+                select {
+                case received <- providerUpdate{index: i, specs: specs}:
+                case <-ctx.Done():
+                    return
+                }
+            }
+        }()
+    }
+
+    go func() {
+        defer close(updates)
+
+        latest := make([][]BackendSpec, len(composite.Providers))
+        var last []BackendSpec
+        sent := false
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case update := <-received:
+                latest[update.index] = update.specs
+            }
+
+            merged := composite.merge(latest)
+            if sent && equal(merged, last) {
+                continue
+            }
+            select {
+            case updates <- merged:
+                last, sent = merged, true
+            case <-ctx.Done():
+                return
+            }
+        }
+    }()
+    return updates
+}
+
+func (composite *Composite) merge(latest [][]BackendSpec) []BackendSpec {
+    if composite.Policy == Fallback {
+        for _, specs := range latest {
+            if len(specs) > 0 {
+                return sortedUnique(specs)
+            }
+        }
+        return []BackendSpec{}
+    }
+
+    order := make([]int, len(latest))
+    for i := range order {
+        order[i] = i
+        if composite.Policy == PreferLast {
+            order[i] = len(latest) - 1 - i
+        }
+    }
+    var all []BackendSpec
+    for _, i := range order {
+        all = append(all, latest[i]...)
+    }
+    return sortedUnique(all)
+}
+
+// sortedUnique keeps the first spec for each URL and sorts by URL.
+func sortedUnique(specs []BackendSpec) []BackendSpec {
+    seen := make(map[string]bool, len(specs))
+    result := make([]BackendSpec, 0, len(specs))
+    for _, spec := range specs {
+        if !seen[spec.URL] {
+            seen[spec.URL] = true
+            result = append(result, spec)
+        }
+    }
+    sort.Slice(result, func(i, j int) bool { return result[i].URL < result[j].URL })
+    return result
+}
+
+func equal(a, b []BackendSpec) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i].URL != b[i].URL || len(a[i].Metadata) != len(b[i].Metadata) {
+            return false
+        }
+        for key, value := range a[i].Metadata {
+            if b[i].Metadata[key] != value {
+                return false
+            }
+        }
+    }
+    return true
+}
+
+// SyncConfig controls how Sync retires backends that disappear from
+// discovery. They are drained at once but stay in the pool for Grace, so a
+// brief discovery flap does not reset their state; a garbage collection pass
+// every Interval then removes those still absent with no requests in flight
+// and closes their connections.
+type SyncConfig struct {
+    Grace    time.Duration
+    Interval time.Duration
+}
+
+type syncer struct {
+    pool   *balancer.ServerPool
+    config SyncConfig
+    absent map[*backend.Backend]time.Time
+}
+
+// Sync applies every update from provider to pool until ctx is cancelled.
+// Backends that stay in the set keep their health state. An empty update is
+// ignored rather than emptying the pool, since it more often means a broken
+// discovery source than a service with no instances.
+func Sync(ctx context.Context, provider DiscoveryProvider, pool *balancer.ServerPool, config SyncConfig) {
+    if config.Grace <= 0 {
+        config.Grace = 5 * time.Minute
+    }
+    if config.Interval <= 0 {
+        config.Interval = 30 * time.Second
+    }
+    syncer := &syncer{pool: pool, config: config, absent: make(map[*backend.Backend]time.Time)}
+
+    ticker := time.NewTicker(config.Interval)
+    defer ticker.Stop()
+
+    updates := provider.Watch(ctx)
+    for {
+        select {
+        case specs, ok := <-updates:
+            if !ok {
+                return
+            }
+            syncer.apply(specs, time.Now())
+        case <-ticker.C:
+            syncer.collect(time.Now())
+        }
+    }
+}
+
+func (syncer *syncer) apply(specs []BackendSpec, now time.Time) {
+    if len(specs) == 0 {
+        log.Printf("discovery: ignoring empty backend set\n")
+        return
+    }
+
+    current := syncer.pool.Backends()
+    backends, replaced := resolve(current, specs)
+    present := make(map[*backend.Backend]bool, len(backends))
+    for _, peer := range backends {
+        present[peer] = true
+        if _, ok := syncer.absent[peer]; ok {
+            delete(syncer.absent, peer)
+            peer.SetDraining(false)
+            log.Printf("%s [rediscovered]\n", peer.URL)
+        }
+    }
+    for _, peer := range current {
+        if present[peer] {
+            continue
+        }
+        if replaced[peer] {
+            // Requests in flight finish on the old backend's proxy; it just
+            // gets no new ones.
+            delete(syncer.absent, peer)
+            peer.Close()
+            log.Printf("%s [replaced, metadata changed]\n", peer.URL)
+            continue
+        }
+        if _, ok := syncer.absent[peer]; !ok {
+            syncer.absent[peer] = now
+            peer.SetDraining(true)
+            log.Printf("%s [draining, gone from discovery]\n", peer.URL)
+        }
+        backends = append(backends, peer)
+    }
+    syncer.pool.SetBackends(backends)
+}
+
+// collect removes backends absent for longer than the grace period once
+// they have no requests in flight.
+func (syncer *syncer) collect(now time.Time) {
+    removed := make(map[*backend.Backend]bool)
+    for peer, since := range syncer.absent {
+        if now.Sub(since) >= syncer.config.Grace && peer.Stats().InFlight == 0 {
+            removed[peer] = true
+        }
+    }
+    if len(removed) == 0 {
+        return
+    }
+
+    var remaining []*backend.Backend
+    for _, peer := range syncer.pool.Backends() {
+        if !removed[peer] {
+            remaining = append(remaining, peer)
+        }
+    }
+    syncer.pool.SetBackends(remaining)
+    for peer := range removed {
+        delete(syncer.absent, peer)
+        peer.Close()
+        log.Printf("%s [removed]\n", peer.URL)
+    }
+}
+
+// resolve maps specs to backends, reusing current ones by URL unless their
+// metadata changed, in which case they are reported in replaced.
+func resolve(current []*backend.Backend, specs []BackendSpec) (backends []*backend.Backend, replaced map[*backend.Backend]bool) {
+    existing := make(map[string]*backend.Backend, len(current))
+    for _, peer := range current {
+        existing[peer.URL.String()] = peer
+    }
+
+    replaced = make(map[*backend.Backend]bool)
+    backends = make([]*backend.Backend, 0, len(specs))
+    for _, spec := range specs {
+        target, err := url.Parse(spec.URL)
+        if err != nil || target.Host == "" {
+            log.Printf("discovery: invalid backend URL %q\n", spec.URL)
+            continue
+        }
+        if err := validateHealth(spec.Metadata); err != nil {
+            log.Printf("discovery: backend %s: %v\n", spec.URL, err)
+            continue
+        }
+        tier, _ := strconv.Atoi(spec.Metadata["tier"])
+        healthPath, healthPort := spec.Metadata["health_path"], spec.Metadata["health_port"]
+        if peer, ok := existing[target.String()]; ok {
+            if peer.Tier == tier && peer.HealthPath == healthPath && peer.HealthPort == healthPort {
+                backends = append(backends, peer)
+                continue
+            }
+            replaced[peer] = true
+        }
+        // Each backend gets its own transport so its connections can be
+        // closed when it is collected.
+        proxy := httputil.NewSingleHostReverseProxy(target)
+        proxy.Transport = http.DefaultTransport.(*http.Transport).Clone()
+        backends = append(backends, &backend.Backend{
+            URL:          target,
+            Alive:        true,
+            Tier:         tier,
+            HealthPath:   healthPath,
+            HealthPort:   healthPort,
+            ReverseProxy: proxy,
+        })
+    }
+    return backends, replaced
+}
+
+// validateHealth checks the health metadata of a spec.
+func validateHealth(metadata map[string]string) error {
+    if path := metadata["health_path"]; path != "" && !strings.HasPrefix(path, "/") {
+        return fmt.Errorf("invalid health_path %q: must start with /", path)
+    }
+    if port := metadata["health_port"]; port != "" {
+        if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+            return fmt.Errorf("invalid health_port %q: must be from 1 to 65535", port)
+        }
+    }
+    return nil
+}
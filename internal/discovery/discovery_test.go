@@ -0,0 +1,264 @@
+package discovery
+
+import (
+    "context"
+    "io"
+    "log"
+    "net/http/httputil"
+    "net/url"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+)
+
+type channelProvider chan []BackendSpec
+
+func (provider channelProvider) Watch(ctx context.Context) <-chan []BackendSpec {
+    return provider
+}
+
+func urls(specs []BackendSpec) string {
+    var result []string
+    for _, spec := range specs {
+        result = append(result, spec.URL+"@"+spec.Metadata["source"])
+    }
+    return strings.Join(result, ",")
+}
+
+func receive(t *testing.T, updates <-chan []BackendSpec) []BackendSpec {
+    t.Helper()
+
+    select {
+    case specs := <-updates:
+        return specs
+    case <-time.After(2 * time.Second):
+        t.Fatal("Timed out waiting for an update")
+    }
+    return nil
+}
+
+func TestComposite_Merge(t *testing.T) {
+    static := []BackendSpec{
+        {URL: "http://10.0.0.1:80", Metadata: map[string]string{"source": "static"}},
+        {URL: "http://10.0.0.2:80", Metadata: map[string]string{"source": "static"}},
+    }
+    dns := []BackendSpec{
+        {URL: "http://10.0.0.2:80", Metadata: map[string]string{"source": "dns"}},
+        {URL: "http://10.0.0.3:80", Metadata: map[string]string{"source": "dns"}},
+    }
+
+    tests := []struct {
+        name     string
+        policy   ConflictPolicy
+        latest   [][]BackendSpec
+        expected string
+    }{
+        {
+            name:     "prefer first",
+            policy:   PreferFirst,
+            latest:   [][]BackendSpec{static, dns},
+            expected: "http://10.0.0.1:80@static,http://10.0.0.2:80@static,http://10.0.0.3:80@dns",
+        },
+        {
+            name:     "prefer last",
+            policy:   PreferLast,
+            latest:   [][]BackendSpec{static, dns},
+            expected: "http://10.0.0.1:80@static,http://10.0.0.2:80@dns,http://10.0.0.3:80@dns",
+        },
+        {
+            name:     "fallback uses first non-empty provider",
+            policy:   Fallback,
+            latest:   [][]BackendSpec{nil, dns, static},
+            expected: "http://10.0.0.2:80@dns,http://10.0.0.3:80@dns",
+        },
+        {
+            name:   "fallback with nothing reported",
+            policy: Fallback,
+            latest: [][]BackendSpec{nil, {}},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            composite := &Composite{Policy: tt.policy}
+            if actual := urls(composite.merge(tt.latest)); actual != tt.expected {
+                t.Errorf("Expected %s, got %s", tt.expected, actual)
+            }
+        })
+    }
+}
+
+func TestComposite_Watch(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    dynamic := make(channelProvider)
+    composite := Compose(Fallback, dynamic, Static{{URL: "http://static:80", Metadata: map[string]string{"source": "static"}}})
+    updates := composite.Watch(ctx)
+
+    if actual := urls(receive(t, updates)); actual != "http://static:80@static" {
+        t.Errorf("Expected static fallback first, got %s", actual)
+    }
+
+    dynamic <- []BackendSpec{{URL: "http://dynamic:80", Metadata: map[string]string{"source": "dns"}}}
+    if actual := urls(receive(t, updates)); actual != "http://dynamic:80@dns" {
+        t.Errorf("Expected dynamic set once reported, got %s", actual)
+    }
+
+    dynamic <- []BackendSpec{}
+    if actual := urls(receive(t, updates)); actual != "http://static:80@static" {
+        t.Errorf("Expected static fallback once dynamic set is empty, got %s", actual)
+    }
+
+    cancel()
+    select {
+    case _, ok := <-updates:
+        if ok {
+            t.Error("Expected no further updates after cancel")
+        }
+    case <-time.After(2 * time.Second):
+        t.Error("Expected updates channel to close after cancel")
+    }
+}
+
+func TestSync(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    existingURL, _ := url.Parse("http://10.0.0.1:80")
+    existing := &backend.Backend{URL: existingURL, ReverseProxy: httputil.NewSingleHostReverseProxy(existingURL)}
+    pool := balancer.NewServerPool()
+    pool.AddBackend(existing)
+
+    updates := make(channelProvider)
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    go func() {
+        Sync(ctx, updates, pool, SyncConfig{})
+        close(done)
+    }()
+
+    updates <- []BackendSpec{{URL: "http://10.0.0.1:80"}, {URL: "http://10.0.0.2:80"}, {URL: "not a url"}}
+    updates <- []BackendSpec{}
+    close(updates)
+    <-done
+    cancel()
+
+    backends := pool.Backends()
+    if len(backends) != 2 {
+        t.Fatalf("Expected 2 backends after ignoring the empty update, got %d", len(backends))
+    }
+    if backends[0] != existing {
+        t.Error("Expected the existing backend to be kept")
+    }
+    if existing.IsAlive() {
+        t.Error("Expected the existing backend to keep its health state")
+    }
+    if backends[1].URL.String() != "http://10.0.0.2:80" || !backends[1].IsAlive() {
+        t.Errorf("Expected new alive backend http://10.0.0.2:80, got %s", backends[1].URL)
+    }
+}
+
+func TestSync_CollectsStaleBackends(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    pool := balancer.NewServerPool()
+    syncer := &syncer{pool: pool, config: SyncConfig{Grace: time.Minute}, absent: make(map[*backend.Backend]time.Time)}
+    start := time.Now()
+
+    syncer.apply([]BackendSpec{{URL: "http://a:80"}, {URL: "http://b:80"}, {URL: "http://c:80"}}, start)
+    backends := pool.Backends()
+    a, b, c := backends[0], backends[1], backends[2]
+
+    syncer.apply([]BackendSpec{{URL: "http://a:80"}}, start)
+    if len(pool.Backends()) != 3 || !b.Draining() || !c.Draining() || a.Draining() {
+        t.Fatalf("Expected b and c to stay in the pool draining")
+    }
+    if peer := pool.GetNextPeer(); peer != a {
+        t.Errorf("Expected only a in rotation, got %v", peer.URL)
+    }
+
+    syncer.apply([]BackendSpec{{URL: "http://a:80"}, {URL: "http://c:80"}}, start.Add(30*time.Second))
+    if c.Draining() {
+        t.Error("Expected rediscovered backend to return to rotation")
+    }
+
+    syncer.collect(start.Add(30 * time.Second))
+    if len(pool.Backends()) != 3 {
+        t.Errorf("Expected nothing collected within the grace period, got %d backends", len(pool.Backends()))
+    }
+
+    syncer.collect(start.Add(time.Minute))
+    remaining := pool.Backends()
+    if len(remaining) != 2 || remaining[0] != a || remaining[1] != c {
+        t.Errorf("Expected b to be collected after the grace period, got %v", remaining)
+    }
+    if len(syncer.absent) != 0 {
+        t.Errorf("Expected no backends left pending collection, got %d", len(syncer.absent))
+    }
+}
+
+func TestSync_HealthMetadata(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    pool := balancer.NewServerPool()
+    syncer := &syncer{pool: pool, config: SyncConfig{Grace: time.Minute}, absent: make(map[*backend.Backend]time.Time)}
+    now := time.Now()
+
+    syncer.apply([]BackendSpec{{URL: "http://a:80", Metadata: map[string]string{"health_path": "/healthz"}}}, now)
+    original := pool.Backends()[0]
+
+    syncer.apply([]BackendSpec{{URL: "http://a:80", Metadata: map[string]string{"health_path": "/healthz"}}}, now)
+    if pool.Backends()[0] != original {
+        t.Errorf("Expected the backend kept while its metadata is unchanged")
+    }
+
+    syncer.apply([]BackendSpec{{URL: "http://a:80", Metadata: map[string]string{"health_path": "/ready", "health_port": "9000"}}}, now)
+    backends := pool.Backends()
+    if len(backends) != 1 || backends[0] == original || backends[0].HealthPath != "/ready" || backends[0].HealthPort != "9000" {
+        t.Errorf("Expected the backend replaced with the new health metadata, got %+v", backends)
+    }
+
+    tests := []struct {
+        name     string
+        metadata map[string]string
+    }{
+        {name: "relative path", metadata: map[string]string{"health_path": "healthz"}},
+        {name: "port zero", metadata: map[string]string{"health_port": "0"}},
+        {name: "port too high", metadata: map[string]string{"health_port": "65536"}},
+        {name: "port not a number", metadata: map[string]string{"health_port": "http"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backends, _ := resolve(nil, []BackendSpec{{URL: "http://b:80", Metadata: tt.metadata}})
+            if len(backends) != 0 {
+                t.Errorf("Expected the spec skipped, got %d backends", len(backends))
+            }
+        })
+    }
+}
+
+func TestDNS_Watch(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    provider := &DNS{Name: "localhost", Port: "8080", Interval: time.Hour}
+    specs := receive(t, provider.Watch(ctx))
+
+    found := false
+    for _, spec := range specs {
+        if spec.URL == "http://127.0.0.1:8080" && spec.Metadata["source"] == "dns" {
+            found = true
+        }
+    }
+    if !found {
+        t.Errorf("Expected http://127.0.0.1:8080 among %v", specs)
+    }
+}
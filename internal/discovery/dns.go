@@ -0,0 +1,76 @@
+package discovery
+
+import (
+    "context"
+    "log"
+    "net"
+    "sort"
+    "time"
+)
+
+// DNS resolves Name every Interval and reports one backend per address.
+// Lookup failures keep the previous set.
+type DNS struct {
+    Name     string
+    Port     string
+    Scheme   string
+    Interval time.Duration
+    Resolver *net.Resolver
+}
+
+func (dns *DNS) Watch(ctx context.Context) <-chan []BackendSpec {
+    interval := dns.Interval
+    if interval <= 0 {
+        interval = 30 * time.Second
+    }
+    scheme := dns.Scheme
+    if scheme == "" {
+        scheme = "http"
+    }
+    resolver := dns.Resolver
+    if resolver == nil {
+        resolver = net.DefaultResolver
+    }
+
+    updates := make(chan []BackendSpec)
+    go func() {
+        defer close(updates)
+
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+
+        var last []BackendSpec
+        sent := false
+        for {
+            addrs, err := resolver.LookupHost(ctx, dns.Name)
+            if err != nil && ctx.Err() == nil {
+                log.Printf("discovery: resolving %s: %v\n", dns.Name, err)
+            }
+            if err == nil {
+                sort.Strings(addrs)
+                specs := make([]BackendSpec, 0, len(addrs))
+                for _, addr := range addrs {
+                    specs = append(specs, BackendSpec{
+                        URL:      scheme + "://" + net.JoinHostPort(addr, dns.Port),
+                        Metadata: map[string]string{"source": "dns", "name": dns.Name},
+                    })
+                }
+                if !sent || !equal(specs, last) {
+                    select {
+                    case updates <- specs:
+                        last, sent = specs, true
+                    case <-ctx.Done():
+                        return
+                    }
+                }
+            }
+
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+            }
+        }
+    }()
+    return updates
+}
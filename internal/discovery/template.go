@@ -0,0 +1,115 @@
+package discovery
+
+import (
+    "fmt"
+    "maps"
+    "strconv"
+    "strings"
+)
+
+// maxExpansion caps how many URLs one template may expand to, so a typo
+// such as {1-100000} fails instead of building a huge pool.
+const maxExpansion = 10000
+
+// Expand expands the URL templates of specs, as ExpandURL does, so large
+// static fleets are declared in a line each, and a config loader can build
+// Static from the result. Every backend a template expands to gets a copy
+// of its spec's Metadata.
+func Expand(specs []BackendSpec) ([]BackendSpec, error) {
+    var expanded []BackendSpec
+    for _, spec := range specs {
+        urls, err := ExpandURL(spec.URL)
+        if err != nil {
+            return nil, err
+        }
+        for _, url := range urls {
+            expanded = append(expanded, BackendSpec{URL: url, Metadata: maps.Clone(spec.Metadata)})
+        }
+        if len(expanded) > maxExpansion {
+            return nil, fmt.Errorf("backend templates expand to more than %d backends", maxExpansion)
+        }
+    }
+    return expanded, nil
+}
+
+// ExpandURL expands each {first-last} range and {a,b,c} list in template,
+// in any part of the URL, into every combination, in order. A range keeps
+// the width of a zero-padded first value, so {01-10} gives 01 to 10. A URL
+// without braces expands to itself.
+func ExpandURL(template string) ([]string, error) {
+    expanded := []string{""}
+    rest := template
+    for {
+        start := strings.IndexByte(rest, '{')
+        if start < 0 {
+            break
+        }
+        end := strings.IndexByte(rest[start:], '}')
+        if end < 0 {
+            return nil, fmt.Errorf("backend template %q: unclosed {", template)
+        }
+        end += start
+
+        options, err := expandGroup(rest[start+1 : end])
+        if err != nil {
+            return nil, fmt.Errorf("backend template %q: %w", template, err)
+        }
+        if len(expanded)*len(options) > maxExpansion {
+            return nil, fmt.Errorf("backend template %q expands to more than %d backends", template, maxExpansion)
+        }
+        prefix := rest[:start]
+        next := make([]string, 0, len(expanded)*len(options))
+        for _, head := range expanded {
+            for _, option := range options {
+                next = append(next, head+prefix+option)
+            }
+        }
+        expanded, rest = next, rest[end+1:]
+    }
+    if strings.IndexByte(rest, '}') >= 0 {
+        return nil, fmt.Errorf("backend template %q: unopened }", template)
+    }
+    for i := range expanded {
+        expanded[i] += rest
+    }
+    return expanded, nil
+}
+
+// expandGroup lists the values of one brace group.
+func expandGroup(group string) ([]string, error) {
+    if strings.Contains(group, ",") {
+        options := strings.Split(group, ",")
+        for _, option := range options {
+            if option == "" {
+                return nil, fmt.Errorf("empty item in {%s}", group)
+            }
+        }
+        return options, nil
+    }
+
+    from, to, ok := strings.Cut(group, "-")
+    if !ok {
+        return nil, fmt.Errorf("{%s} is neither a range nor a list", group)
+    }
+    first, err := strconv.Atoi(from)
+    if err != nil || first < 0 {
+        return nil, fmt.Errorf("invalid range start in {%s}", group)
+    }
+    last, err := strconv.Atoi(to)
+    if err != nil || last < first {
+        return nil, fmt.Errorf("invalid range end in {%s}", group)
+    }
+    if last-first >= maxExpansion {
+        return nil, fmt.Errorf("range {%s} is longer than %d", group, maxExpansion)
+    }
+    width := 0
+    if len(from) > 1 && from[0] == '0' {
+        width = len(from)
+    }
+
+    options := make([]string, 0, last-first+1)
+    for value := first; value <= last; value++ {
+        options = append(options, fmt.Sprintf("%0*d", width, value))
+    }
+    return options, nil
+}
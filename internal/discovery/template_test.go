@@ -0,0 +1,56 @@
+package discovery
+
+import (
+    "slices"
+    "testing"
+)
+
+func TestExpandURL(t *testing.T) {
+    tests := []struct {
+        template string
+        expected []string
+        wantErr  bool
+    }{
+        {template: "http://10.0.0.1:8080", expected: []string{"http://10.0.0.1:8080"}},
+        {template: "http://10.0.0.{1-3}:8080", expected: []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080", "http://10.0.0.3:8080"}},
+        {template: "http://10.0.0.1:{8080-8081}", expected: []string{"http://10.0.0.1:8080", "http://10.0.0.1:8081"}},
+        {template: "http://{web,api}-{1-2}.internal", expected: []string{"http://web-1.internal", "http://web-2.internal", "http://api-1.internal", "http://api-2.internal"}},
+        {template: "http://node{08-10}:80", expected: []string{"http://node08:80", "http://node09:80", "http://node10:80"}},
+        {template: "http://10.0.0.{3-1}:80", wantErr: true},
+        {template: "http://10.0.0.{1-x}:80", wantErr: true},
+        {template: "http://10.0.0.{1}:80", wantErr: true},
+        {template: "http://10.0.0.{1-3:80", wantErr: true},
+        {template: "http://10.0.0.1}:80", wantErr: true},
+        {template: "http://{a,,b}:80", wantErr: true},
+        {template: "http://10.{0-255}.{0-255}.1:80", wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.template, func(t *testing.T) {
+            urls, err := ExpandURL(tt.template)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+            }
+            if !slices.Equal(urls, tt.expected) {
+                t.Errorf("Expected %v, got %v", tt.expected, urls)
+            }
+        })
+    }
+}
+
+func TestExpand(t *testing.T) {
+    specs, err := Expand([]BackendSpec{
+        {URL: "http://10.0.0.{1-2}:8080", Metadata: map[string]string{"tier": "0"}},
+        {URL: "http://10.0.1.1:8080", Metadata: map[string]string{"tier": "1"}},
+    })
+    if err != nil {
+        t.Fatalf("Expand() error: %v", err)
+    }
+    if len(specs) != 3 {
+        t.Fatalf("Expected 3 backends, got %d", len(specs))
+    }
+    specs[0].Metadata["tier"] = "2"
+    if specs[1].Metadata["tier"] != "0" || specs[2].Metadata["tier"] != "1" {
+        t.Errorf("Expected each backend to keep its own copy of its template's metadata, got %v and %v", specs[1].Metadata, specs[2].Metadata)
+    }
+}
@@ -0,0 +1,151 @@
+package dns
+
+import (
+    "encoding/binary"
+    "errors"
+    "net/netip"
+    "strings"
+)
+
+const (
+    TypeA    uint16 = 1
+    TypeAAAA uint16 = 28
+    TypeANY  uint16 = 255
+
+    ClassINET uint16 = 1
+
+    RcodeSuccess        = 0
+    RcodeFormatError    = 1
+    RcodeServerFailure  = 2
+    RcodeNameError      = 3
+    RcodeNotImplemented = 4
+    RcodeRefused        = 5
+
+    headerLength   = 12
+    maxUDPResponse = 512
+)
+
+var errMalformed = errors.New("dns: malformed message")
+
+type header struct {
+    id      uint16
+    flags   uint16
+    qdCount uint16
+}
+
+type question struct {
+    name  string
+    qtype uint16
+    class uint16
+    raw   []byte
+}
+
+func (h header) opcode() int {
+    return int(h.flags>>11) & 0xF
+}
+
+func (h header) recursionDesired() bool {
+    return h.flags&0x0100 != 0
+}
+
+func parseHeader(message []byte) (header, error) {
+    if len(message) < headerLength {
+        return header{}, errMalformed
+    }
+    return header{
+        id:      binary.BigEndian.Uint16(message[0:2]),
+        flags:   binary.BigEndian.Uint16(message[2:4]),
+        qdCount: binary.BigEndian.Uint16(message[4:6]),
+    }, nil
+}
+
+// parseQuestion reads the first question. Queries never need compression, so
+// compression pointers in the question name are treated as malformed.
+func parseQuestion(message []byte) (question, error) {
+    offset := headerLength
+    var labels []string
+    for {
+        if offset >= len(message) {
+            return question{}, errMalformed
+        }
+        length := int(message[offset])
+        if length&0xC0 != 0 {
+            return question{}, errMalformed
+        }
+        offset++
+        if length == 0 {
+            break
+        }
+        if offset+length > len(message) {
+            return question{}, errMalformed
+        }
+        labels = append(labels, string(message[offset:offset+length]))
+        offset += length
+    }
+    if offset+4 > len(message) {
+        return question{}, errMalformed
+    }
+
+    return question{
+        name:  canonicalName(strings.Join(labels, ".")),
+        qtype: binary.BigEndian.Uint16(message[offset : offset+2]),
+        class: binary.BigEndian.Uint16(message[offset+2 : offset+4]),
+        raw:   message[headerLength : offset+4],
+    }, nil
+}
+
+func canonicalName(name string) string {
+    return strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+}
+
+type response struct {
+    header        header
+    question      *question
+    rcode         int
+    authoritative bool
+    answers       []netip.Addr
+    ttl           uint32
+}
+
+func (r *response) pack(limit int) []byte {
+    message := r.packAnswers(r.answers, false)
+    if limit > 0 && len(message) > limit {
+        message = r.packAnswers(nil, true)
+    }
+    return message
+}
+
+func (r *response) packAnswers(answers []netip.Addr, truncated bool) []byte {
+    flags := uint16(0x8000) | r.header.flags&0x7900 | uint16(r.rcode)
+    if r.authoritative {
+        flags |= 0x0400
+    }
+    if truncated {
+        flags |= 0x0200
+    }
+
+    message := make([]byte, headerLength, maxUDPResponse)
+    binary.BigEndian.PutUint16(message[0:2], r.header.id)
+    binary.BigEndian.PutUint16(message[2:4], flags)
+    if r.question == nil {
+        return message
+    }
+
+    binary.BigEndian.PutUint16(message[4:6], 1)
+    binary.BigEndian.PutUint16(message[6:8], uint16(len(answers)))
+    message = append(message, r.question.raw...)
+
+    for _, addr := range answers {
+        rtype, data := TypeA, addr.AsSlice()
+        if !addr.Is4() {
+            rtype = TypeAAAA
+        }
+        message = append(message, 0xC0, headerLength)
+        message = binary.BigEndian.AppendUint16(message, rtype)
+        message = binary.BigEndian.AppendUint16(message, ClassINET)
+        message = binary.BigEndian.AppendUint32(message, r.ttl)
+        message = binary.BigEndian.AppendUint16(message, uint16(len(data)))
+        message = append(message, data...)
+    }
+    return message
+}
@@ -0,0 +1,249 @@
+package dns
+
+import (
+    "context"
+    "encoding/binary"
+    "errors"
+    "io"
+    "log"
+    "net"
+    "net/netip"
+    "strings"
+    "sync"
+    "time"
+
+    "load-balancer/internal/balancer"
+)
+
+// Responder is an authoritative DNS server for a single zone. Each configured
+// name resolves to the addresses of the healthy backends in its pool, so
+// clients that connect directly still skip backends the balancer marked down.
+type Responder struct {
+    zone     string
+    ttl      uint32
+    resolver *net.Resolver
+
+    mux   sync.RWMutex
+    names map[string]*balancer.ServerPool
+}
+
+func NewResponder(zone string, ttl time.Duration) *Responder {
+    if ttl <= 0 {
+        ttl = 5 * time.Second
+    }
+    return &Responder{
+        zone:     canonicalName(zone),
+        ttl:      uint32(ttl / time.Second),
+        resolver: net.DefaultResolver,
+        names:    make(map[string]*balancer.ServerPool),
+    }
+}
+
+// AddName serves pool under name, which is relative to the zone; "" or "@"
+// is the zone apex.
+func (responder *Responder) AddName(name string, pool *balancer.ServerPool) {
+    fqdn := responder.zone
+    if name != "" && name != "@" {
+        fqdn = canonicalName(name + "." + strings.TrimSuffix(responder.zone, "."))
+    }
+
+    responder.mux.Lock()
+    responder.names[fqdn] = pool
+    responder.mux.Unlock()
+}
+
+// ListenAndServe answers queries over UDP and TCP on address until ctx is
+// cancelled.
+func (responder *Responder) ListenAndServe(ctx context.Context, address string) error {
+    packetConn, err := net.ListenPacket("udp", address)
+    if err != nil {
+        return err
+    }
+    listener, err := net.Listen("tcp", packetConn.LocalAddr().String())
+    if err != nil {
+        packetConn.Close()
+        return err
+    }
+
+    go func() {
+        <-ctx.Done()
+        packetConn.Close()
+        listener.Close()
+    }()
+
+    errs := make(chan error, 2)
+    go func() { errs <- responder.ServeUDP(ctx, packetConn) }()
+    go func() { errs <- responder.ServeTCP(ctx, listener) }()
+
+    err = <-errs
+    packetConn.Close()
+    listener.Close()
+    <-errs
+    if ctx.Err() != nil {
+        return nil
+    }
+    return err
+}
+
+// maxUDPQueries bounds the UDP queries answered at once. Each is answered
+// on its own goroutine, so one slow backend lookup does not hold up the
+// rest; queries arriving past the bound are dropped and the client retries.
+const maxUDPQueries = 256
+
+func (responder *Responder) ServeUDP(ctx context.Context, conn net.PacketConn) error {
+    slots := make(chan struct{}, maxUDPQueries)
+    var pending sync.WaitGroup
+    defer pending.Wait()
+
+    buffer := make([]byte, 4096)
+    for {
+        n, addr, err := conn.ReadFrom(buffer)
+        if err != nil {
+            if errors.Is(err, net.ErrClosed) {
+                return nil
+            }
+            return err
+        }
+        select {
+        case slots <- struct{}{}:
+        default:
+            continue
+        }
+        message := append([]byte(nil), buffer[:n]...)
+        pending.Add(1)
+        go func() {
+            defer func() {
+                <-slots
+                pending.Done()
+            }()
+            if reply := responder.Answer(ctx, message, maxUDPResponse); reply != nil {
+                conn.WriteTo(reply, addr)
+            }
+        }()
+    }
+}
+
+func (responder *Responder) ServeTCP(ctx context.Context, listener net.Listener) error {
+    for {
+        conn, err := listener.Accept()
+        if err != nil {
+            if errors.Is(err, net.ErrClosed) {
+                return nil
+            }
+            return err
+        }
+        go responder.serveStream(ctx, conn)
+    }
+}
+
+func (responder *Responder) serveStream(ctx context.Context, conn net.Conn) {
+    defer conn.Close()
+
+    for {
+        conn.SetDeadline(time.Now().Add(10 * time.Second))
+        var length [2]byte
+        if _, err := io.ReadFull(conn, length[:]); err != nil {
+            return
+        }
+        message := make([]byte, binary.BigEndian.Uint16(length[:]))
+        if _, err := io.ReadFull(conn, message); err != nil {
+            return
+        }
+
+        reply := responder.Answer(ctx, message, 0)
+        if reply == nil {
+            return
+        }
+        if _, err := conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(reply)))); err != nil {
+            return
+        }
+        if _, err := conn.Write(reply); err != nil {
+            return
+        }
+    }
+}
+
+// Answer builds the reply to a single query message. Replies longer than
+// limit are truncated so the client retries over TCP; a limit of 0 means
+// unlimited. Messages too short to carry a header get no reply.
+func (responder *Responder) Answer(ctx context.Context, message []byte, limit int) []byte {
+    h, err := parseHeader(message)
+    if err != nil || h.flags&0x8000 != 0 {
+        return nil
+    }
+
+    reply := &response{header: h, ttl: responder.ttl}
+    if h.opcode() != 0 {
+        reply.rcode = RcodeNotImplemented
+        return reply.pack(limit)
+    }
+    q, err := parseQuestion(message)
+    if err != nil || h.qdCount != 1 {
+        reply.rcode = RcodeFormatError
+        return reply.pack(limit)
+    }
+    reply.question = &q
+
+    if q.class != ClassINET || !inZone(q.name, responder.zone) {
+        reply.rcode = RcodeRefused
+        return reply.pack(limit)
+    }
+    reply.authoritative = true
+
+    responder.mux.RLock()
+    pool, ok := responder.names[q.name]
+    responder.mux.RUnlock()
+    if !ok {
+        reply.rcode = RcodeNameError
+        return reply.pack(limit)
+    }
+
+    for _, addr := range responder.healthyAddresses(ctx, pool) {
+        switch {
+        case q.qtype == TypeANY,
+            q.qtype == TypeA && addr.Is4(),
+            q.qtype == TypeAAAA && !addr.Is4():
+            reply.answers = append(reply.answers, addr)
+        }
+    }
+    return reply.pack(limit)
+}
+
+func (responder *Responder) healthyAddresses(ctx context.Context, pool *balancer.ServerPool) []netip.Addr {
+    seen := make(map[netip.Addr]bool)
+    var addrs []netip.Addr
+    for _, peer := range pool.Backends() {
+        if !peer.IsAlive() {
+            continue
+        }
+        for _, addr := range responder.lookup(ctx, peer.URL.Hostname()) {
+            if !seen[addr] {
+                seen[addr] = true
+                addrs = append(addrs, addr)
+            }
+        }
+    }
+    return addrs
+}
+
+func (responder *Responder) lookup(ctx context.Context, host string) []netip.Addr {
+    if addr, err := netip.ParseAddr(host); err == nil {
+        return []netip.Addr{addr.Unmap()}
+    }
+
+    ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+    defer cancel()
+    addrs, err := responder.resolver.LookupNetIP(ctx, "ip", host)
+    if err != nil {
+        log.Printf("dns: resolving backend %s: %v\n", host, err)
+        return nil
+    }
+    for i := range addrs {
+        addrs[i] = addrs[i].Unmap()
+    }
+    return addrs
+}
+
+func inZone(name, zone string) bool {
+    return name == zone || strings.HasSuffix(name, "."+zone)
+}
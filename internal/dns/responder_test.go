@@ -0,0 +1,260 @@
+package dns
+
+import (
+    "context"
+    "encoding/binary"
+    "net"
+    "net/http/httputil"
+    "net/netip"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+)
+
+func buildQuery(id uint16, name string, qtype uint16) []byte {
+    message := make([]byte, headerLength)
+    binary.BigEndian.PutUint16(message[0:2], id)
+    binary.BigEndian.PutUint16(message[2:4], 0x0100)
+    binary.BigEndian.PutUint16(message[4:6], 1)
+    for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+        message = append(message, byte(len(label)))
+        message = append(message, label...)
+    }
+    message = append(message, 0)
+    message = binary.BigEndian.AppendUint16(message, qtype)
+    return binary.BigEndian.AppendUint16(message, ClassINET)
+}
+
+type parsedReply struct {
+    id        uint16
+    rcode     int
+    aa        bool
+    truncated bool
+    answers   []netip.Addr
+    ttl       uint32
+}
+
+func parseReply(t *testing.T, message []byte) parsedReply {
+    t.Helper()
+
+    h, err := parseHeader(message)
+    if err != nil {
+        t.Fatalf("reply too short: %v", err)
+    }
+    reply := parsedReply{
+        id:        h.id,
+        rcode:     int(h.flags & 0xF),
+        aa:        h.flags&0x0400 != 0,
+        truncated: h.flags&0x0200 != 0,
+    }
+    if h.qdCount == 0 {
+        return reply
+    }
+    q, err := parseQuestion(message)
+    if err != nil {
+        t.Fatalf("reply question: %v", err)
+    }
+
+    offset := headerLength + len(q.raw)
+    count := int(binary.BigEndian.Uint16(message[6:8]))
+    for i := 0; i < count; i++ {
+        offset += 2
+        reply.ttl = binary.BigEndian.Uint32(message[offset+4 : offset+8])
+        length := int(binary.BigEndian.Uint16(message[offset+8 : offset+10]))
+        offset += 10
+        addr, _ := netip.AddrFromSlice(message[offset : offset+length])
+        reply.answers = append(reply.answers, addr)
+        offset += length
+    }
+    return reply
+}
+
+func newPool(hosts map[string]bool) *balancer.ServerPool {
+    pool := balancer.NewServerPool()
+    for host, alive := range hosts {
+        target, _ := url.Parse("http://" + host)
+        pool.AddBackend(&backend.Backend{
+            URL:          target,
+            Alive:        alive,
+            ReverseProxy: httputil.NewSingleHostReverseProxy(target),
+        })
+    }
+    return pool
+}
+
+func TestResponder_Answer(t *testing.T) {
+    responder := NewResponder("example.com", 5*time.Second)
+    responder.AddName("@", newPool(map[string]bool{"10.0.0.1:8080": true}))
+    responder.AddName("api", newPool(map[string]bool{
+        "10.0.0.2:8080":      true,
+        "10.0.0.3:8080":      false,
+        "[2001:db8::1]:8080": true,
+    }))
+    responder.AddName("down", newPool(map[string]bool{"10.0.0.9:80": false}))
+
+    tests := []struct {
+        name     string
+        query    string
+        qtype    uint16
+        rcode    int
+        aa       bool
+        expected []string
+    }{
+        {name: "apex", query: "example.com", qtype: TypeA, aa: true, expected: []string{"10.0.0.1"}},
+        {name: "only healthy A records", query: "API.example.com.", qtype: TypeA, aa: true, expected: []string{"10.0.0.2"}},
+        {name: "AAAA records", query: "api.example.com", qtype: TypeAAAA, aa: true, expected: []string{"2001:db8::1"}},
+        {name: "no healthy backends", query: "down.example.com", qtype: TypeA, aa: true},
+        {name: "unknown name in zone", query: "missing.example.com", qtype: TypeA, rcode: RcodeNameError, aa: true},
+        {name: "outside zone", query: "example.org", qtype: TypeA, rcode: RcodeRefused},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            reply := parseReply(t, responder.Answer(context.Background(), buildQuery(42, tt.query, tt.qtype), maxUDPResponse))
+
+            if reply.id != 42 {
+                t.Errorf("Expected id 42, got %d", reply.id)
+            }
+            if reply.rcode != tt.rcode {
+                t.Errorf("Expected rcode %d, got %d", tt.rcode, reply.rcode)
+            }
+            if reply.aa != tt.aa {
+                t.Errorf("Expected authoritative %v, got %v", tt.aa, reply.aa)
+            }
+            var actual []string
+            for _, addr := range reply.answers {
+                actual = append(actual, addr.String())
+            }
+            if strings.Join(actual, ",") != strings.Join(tt.expected, ",") {
+                t.Errorf("Expected answers %v, got %v", tt.expected, actual)
+            }
+            if len(reply.answers) > 0 && reply.ttl != 5 {
+                t.Errorf("Expected TTL 5, got %d", reply.ttl)
+            }
+        })
+    }
+}
+
+func TestResponder_AnswerMalformed(t *testing.T) {
+    responder := NewResponder("example.com", 0)
+
+    if reply := responder.Answer(context.Background(), []byte{1, 2, 3}, maxUDPResponse); reply != nil {
+        t.Errorf("Expected no reply to a truncated header, got %v", reply)
+    }
+
+    query := buildQuery(7, "example.com", TypeA)
+    reply := parseReply(t, responder.Answer(context.Background(), query[:headerLength+3], maxUDPResponse))
+    if reply.rcode != RcodeFormatError {
+        t.Errorf("Expected FORMERR, got %d", reply.rcode)
+    }
+}
+
+func TestResponder_Truncates(t *testing.T) {
+    hosts := make(map[string]bool)
+    for i := 1; i <= 40; i++ {
+        hosts[netip.AddrFrom4([4]byte{10, 0, 1, byte(i)}).String()] = true
+    }
+    responder := NewResponder("example.com", 0)
+    responder.AddName("big", newPool(hosts))
+
+    query := buildQuery(1, "big.example.com", TypeA)
+    udp := parseReply(t, responder.Answer(context.Background(), query, maxUDPResponse))
+    if !udp.truncated || len(udp.answers) != 0 {
+        t.Errorf("Expected truncated empty UDP reply, got truncated=%v with %d answers", udp.truncated, len(udp.answers))
+    }
+
+    tcp := parseReply(t, responder.Answer(context.Background(), query, 0))
+    if tcp.truncated || len(tcp.answers) != 40 {
+        t.Errorf("Expected 40 answers over TCP, got truncated=%v with %d answers", tcp.truncated, len(tcp.answers))
+    }
+}
+
+func TestResponder_ListenAndServe(t *testing.T) {
+    probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    address := probe.LocalAddr().String()
+    probe.Close()
+
+    pool := newPool(map[string]bool{"10.0.0.5:80": true})
+    responder := NewResponder("lb.test", time.Second)
+    responder.AddName("web", pool)
+
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan error)
+    go func() { done <- responder.ListenAndServe(ctx, address) }()
+    time.Sleep(50 * time.Millisecond)
+
+    resolver := &net.Resolver{
+        PreferGo: true,
+        Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+            return (&net.Dialer{}).DialContext(ctx, network, address)
+        },
+    }
+    addrs, err := resolver.LookupHost(context.Background(), "web.lb.test")
+    if err != nil {
+        t.Fatalf("LookupHost() error: %v", err)
+    }
+    if len(addrs) != 1 || addrs[0] != "10.0.0.5" {
+        t.Errorf("Expected [10.0.0.5], got %v", addrs)
+    }
+
+    pool.Backends()[0].SetAlive(false)
+    if addrs, err := resolver.LookupHost(context.Background(), "web.lb.test"); err == nil {
+        t.Errorf("Expected no addresses once the backend is down, got %v", addrs)
+    }
+
+    cancel()
+    if err := <-done; err != nil {
+        t.Errorf("ListenAndServe() error: %v", err)
+    }
+}
+
+func TestResponder_SlowLookupDoesNotStallUDP(t *testing.T) {
+    responder := NewResponder("lb.test", time.Second)
+    responder.resolver = &net.Resolver{
+        PreferGo: true,
+        Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+            <-ctx.Done()
+            return nil, ctx.Err()
+        },
+    }
+    responder.AddName("slow", newPool(map[string]bool{"backend.invalid:80": true}))
+    responder.AddName("fast", newPool(map[string]bool{"10.0.0.5:80": true}))
+
+    conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan error)
+    go func() { done <- responder.ServeUDP(ctx, conn) }()
+    defer func() {
+        cancel()
+        conn.Close()
+        <-done
+    }()
+
+    client, err := net.Dial("udp", conn.LocalAddr().String())
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+    client.Write(buildQuery(1, "slow.lb.test", TypeA))
+    client.Write(buildQuery(2, "fast.lb.test", TypeA))
+
+    client.SetReadDeadline(time.Now().Add(time.Second))
+    buffer := make([]byte, 512)
+    n, err := client.Read(buffer)
+    if err != nil {
+        t.Fatalf("Expected the fast query answered while the slow one resolves: %v", err)
+    }
+    if reply := parseReply(t, buffer[:n]); reply.id != 2 || len(reply.answers) != 1 {
+        t.Errorf("Expected the answer to query 2, got %+v", reply)
+    }
+}
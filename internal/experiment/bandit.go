@@ -0,0 +1,233 @@
+package experiment
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "math/rand"
+    "net/http"
+    "sync"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+)
+
+// BanditConfig describes a multi-armed bandit over pools, such as a stable
+// pool and a canary. Each request is rewarded when it is answered without a
+// 5xx and, if LatencyTarget is set, within it. The arm with the best reward
+// rate gets the traffic, bounded by exploration: every arm keeps at least
+// MinShare of it (default 0.05) so a recovering variant is noticed, and no
+// arm takes more than MaxShare (default 1). Observations lose half their
+// weight every HalfLife (default 5 minutes), so the bandit follows changes
+// in the variants. The chosen arm is sent to backends in Header, which
+// defaults to X-Bandit-<Name>. Use Middleware in a route's Middleware, so
+// the pool it picks is the one the route dispatches to.
+type BanditConfig struct {
+    Name          string
+    Arms          []string
+    MinShare      float64
+    MaxShare      float64
+    LatencyTarget time.Duration
+    HalfLife      time.Duration
+    Header        string
+    Registry      *metrics.Registry
+}
+
+type Bandit struct {
+    config BanditConfig
+
+    mux  sync.Mutex
+    arms []arm
+}
+
+type arm struct {
+    rewards float64
+    trials  float64
+    updated time.Time
+}
+
+// ArmStats is an arm's standing, as shown on the admin API.
+type ArmStats struct {
+    Arm        string  `json:"arm"`
+    Share      float64 `json:"share"`
+    Trials     float64 `json:"trials"`
+    RewardRate float64 `json:"reward_rate"`
+}
+
+func NewBandit(config BanditConfig) (*Bandit, error) {
+    if config.Name == "" {
+        return nil, errors.New("bandit: name is required")
+    }
+    if len(config.Arms) < 2 {
+        return nil, fmt.Errorf("bandit %s: at least two arms are required", config.Name)
+    }
+    if config.MinShare == 0 {
+        config.MinShare = 0.05
+    }
+    if config.MaxShare == 0 {
+        config.MaxShare = 1
+    }
+    if config.MinShare < 0 || config.MinShare*float64(len(config.Arms)) > 1 || config.MaxShare < config.MinShare || config.MaxShare > 1 {
+        return nil, fmt.Errorf("bandit %s: invalid exploration bounds", config.Name)
+    }
+    if config.HalfLife <= 0 {
+        config.HalfLife = 5 * time.Minute
+    }
+    if config.Header == "" {
+        config.Header = "X-Bandit-" + config.Name
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+
+    bandit := &Bandit{config: config, arms: make([]arm, len(config.Arms))}
+    for i, name := range config.Arms {
+        i := i
+        config.Registry.GaugeFunc("lb_bandit_share", "Share of traffic the bandit gives each arm.", func() float64 {
+            return bandit.shares()[i]
+        }, "bandit", config.Name, "arm", name)
+    }
+    return bandit, nil
+}
+
+// shares splits traffic between the arms: the exploration floor to each,
+// the rest to the best arm up to MaxShare, and what the best arm cannot
+// take evenly to the others.
+func (bandit *Bandit) shares() []float64 {
+    bandit.mux.Lock()
+    defer bandit.mux.Unlock()
+
+    n := len(bandit.arms)
+    best := 0
+    for i := range bandit.arms {
+        if rate(bandit.arms[i]) > rate(bandit.arms[best]) {
+            best = i
+        }
+    }
+    shares := make([]float64, n)
+    for i := range shares {
+        shares[i] = bandit.config.MinShare
+    }
+    rest := 1 - bandit.config.MinShare*float64(n)
+    extra := math.Min(rest, bandit.config.MaxShare-bandit.config.MinShare)
+    shares[best] += extra
+    for i := range shares {
+        if i != best {
+            shares[i] += (rest - extra) / float64(n-1)
+        }
+    }
+    return shares
+}
+
+// rate is an arm's reward rate, starting from one success in two trials so
+// arms without observations are neither trusted nor written off.
+func rate(arm arm) float64 {
+    return (arm.rewards + 1) / (arm.trials + 2)
+}
+
+// Pick chooses the arm for a request.
+func (bandit *Bandit) Pick() int {
+    shares := bandit.shares()
+    draw := rand.Float64()
+    for i, share := range shares {
+        if draw < share {
+            return i
+        }
+        draw -= share
+    }
+    return len(shares) - 1
+}
+
+func (bandit *Bandit) observe(i int, rewarded bool, now time.Time) {
+    bandit.mux.Lock()
+    defer bandit.mux.Unlock()
+
+    arm := &bandit.arms[i]
+    if !arm.updated.IsZero() {
+        decay := math.Exp2(-float64(now.Sub(arm.updated)) / float64(bandit.config.HalfLife))
+        arm.rewards *= decay
+        arm.trials *= decay
+    }
+    arm.trials++
+    if rewarded {
+        arm.rewards++
+    }
+    arm.updated = now
+}
+
+// Middleware routes each request to the pool of the arm it picks, and
+// rewards the arm by how the request went.
+func (bandit *Bandit) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        i := bandit.Pick()
+        name := bandit.config.Arms[i]
+        request.Header.Set(bandit.config.Header, name)
+        request = balancer.WithPool(request, name)
+
+        start := time.Now()
+        recorder := &statusWriter{ResponseWriter: writer, status: http.StatusOK}
+        next.ServeHTTP(recorder, request)
+        if backend.ClientGone(request) {
+            return
+        }
+        elapsed := time.Since(start)
+        rewarded := recorder.status < http.StatusInternalServerError && (bandit.config.LatencyTarget <= 0 || elapsed <= bandit.config.LatencyTarget)
+        bandit.observe(i, rewarded, time.Now())
+
+        result := "rewarded"
+        if !rewarded {
+            result = "unrewarded"
+        }
+        bandit.config.Registry.Counter("lb_bandit_requests_total", "Requests sent to each bandit arm, by whether they earned a reward.", "bandit", bandit.config.Name, "arm", name, "result", result).Inc()
+    })
+}
+
+func (bandit *Bandit) Stats() []ArmStats {
+    shares := bandit.shares()
+
+    bandit.mux.Lock()
+    defer bandit.mux.Unlock()
+    stats := make([]ArmStats, len(bandit.arms))
+    for i, arm := range bandit.arms {
+        stats[i] = ArmStats{Arm: bandit.config.Arms[i], Share: shares[i], Trials: arm.trials, RewardRate: rate(arm)}
+    }
+    return stats
+}
+
+func (bandit *Bandit) Register(server *admin.Server) {
+    server.HandleFunc("GET /admin/bandits/"+bandit.config.Name, func(writer http.ResponseWriter, request *http.Request) {
+        admin.WriteJSON(writer, http.StatusOK, map[string]any{
+            "bandit": bandit.config.Name,
+            "arms":   bandit.Stats(),
+        })
+    })
+}
+
+type statusWriter struct {
+    http.ResponseWriter
+    status  int
+    written bool
+}
+
+func (writer *statusWriter) WriteHeader(status int) {
+    if !writer.written && status >= http.StatusOK {
+        writer.status, writer.written = status, true
+    }
+    writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *statusWriter) Write(p []byte) (int, error) {
+    writer.written = true
+    return writer.ResponseWriter.Write(p)
+}
+
+func (writer *statusWriter) Flush() {
+    http.NewResponseController(writer.ResponseWriter).Flush()
+}
+
+func (writer *statusWriter) Unwrap() http.ResponseWriter {
+    return writer.ResponseWriter
+}
@@ -0,0 +1,109 @@
+package experiment
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "math"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+)
+
+func newStatusPool(t *testing.T, status int) *balancer.ServerPool {
+    t.Helper()
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(status)
+    }))
+    t.Cleanup(server.Close)
+
+    serverURL, _ := url.Parse(server.URL)
+    pool := balancer.NewServerPool()
+    pool.AddBackend(&backend.Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)})
+    return pool
+}
+
+func near(got, expected float64) bool {
+    return math.Abs(got-expected) < 1e-9
+}
+
+func TestNewBandit_Validation(t *testing.T) {
+    tests := []struct {
+        name    string
+        config  BanditConfig
+        wantErr bool
+    }{
+        {name: "defaults", config: BanditConfig{Name: "canary", Arms: []string{"stable", "canary"}}},
+        {name: "one arm", config: BanditConfig{Name: "canary", Arms: []string{"stable"}}, wantErr: true},
+        {name: "floors over everything", config: BanditConfig{Name: "canary", Arms: []string{"a", "b", "c"}, MinShare: 0.4}, wantErr: true},
+        {name: "cap under floor", config: BanditConfig{Name: "canary", Arms: []string{"a", "b"}, MinShare: 0.2, MaxShare: 0.1}, wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            tt.config.Registry = metrics.NewRegistry()
+            if _, err := NewBandit(tt.config); (err != nil) != tt.wantErr {
+                t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+            }
+        })
+    }
+}
+
+func TestBandit_Middleware(t *testing.T) {
+    registry := metrics.NewRegistry()
+    bandit, err := NewBandit(BanditConfig{Name: "canary", Arms: []string{"stable", "canary"}, MinShare: 0.1, Registry: registry})
+    if err != nil {
+        t.Fatalf("NewBandit() error: %v", err)
+    }
+
+    router := balancer.NewRouter("stable")
+    router.AddPool("stable", newStatusPool(t, http.StatusOK))
+    router.AddPool("canary", newStatusPool(t, http.StatusInternalServerError))
+    router.AddRoute(balancer.Route{Name: "app", Middleware: []func(http.Handler) http.Handler{bandit.Middleware}})
+
+    for i := 0; i < 200; i++ {
+        router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+    }
+
+    stats := bandit.Stats()
+    if !near(stats[0].Share, 0.9) || !near(stats[1].Share, 0.1) {
+        t.Errorf("Expected traffic shifted to the healthy arm within the exploration floor, got %+v", stats)
+    }
+    if stats[1].Trials == 0 || stats[1].RewardRate >= stats[0].RewardRate {
+        t.Errorf("Expected the failing arm explored and ranked below, got %+v", stats)
+    }
+    failed := registry.Counter("lb_bandit_requests_total", "", "bandit", "canary", "arm", "canary", "result", "unrewarded").Value()
+    if failed == 0 || failed > 60 {
+        t.Errorf("Expected the failing arm to get only exploration traffic, got %v of 200", failed)
+    }
+}
+
+func TestBandit_Shares(t *testing.T) {
+    bandit, _ := NewBandit(BanditConfig{Name: "bounded", Arms: []string{"a", "b", "c"}, MinShare: 0.1, MaxShare: 0.5, HalfLife: time.Minute, Registry: metrics.NewRegistry()})
+    now := time.Now()
+    for i := 0; i < 50; i++ {
+        bandit.observe(1, true, now)
+        bandit.observe(0, false, now)
+    }
+
+    shares := bandit.shares()
+    if !near(shares[1], 0.5) || !near(shares[0], 0.25) || !near(shares[2], 0.25) {
+        t.Errorf("Expected the best arm capped at half and the rest split, got %v", shares)
+    }
+
+    // An hour later the old failures have all but faded, and a few
+    // successes put the first arm back in front.
+    later := now.Add(time.Hour)
+    for i := 0; i < 5; i++ {
+        bandit.observe(0, true, later)
+    }
+    bandit.observe(1, false, later)
+    if shares := bandit.shares(); !near(shares[0], 0.5) {
+        t.Errorf("Expected decayed observations to let the first arm lead, got %v", shares)
+    }
+}
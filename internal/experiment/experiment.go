@@ -0,0 +1,153 @@
+package experiment
+
+import (
+    "errors"
+    "fmt"
+    "hash/fnv"
+    "net/http"
+    "strings"
+    "sync"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/clientip"
+    "load-balancer/internal/metrics"
+)
+
+// Variant receives Percent of the clients enrolled in an experiment. Pool,
+// when set, routes the variant's requests to that pool.
+type Variant struct {
+    Name    string
+    Percent float64
+    Pool    string
+}
+
+// Config describes an experiment. Key selects what identifies a client:
+// "ip" (default), "header:<name>" or "cookie:<name>". Clients falling
+// outside the variants' percentages are not enrolled. The assigned variant
+// is sent to backends in Header, which defaults to X-Experiment-<Name>.
+type Config struct {
+    Name     string
+    Key      string
+    Header   string
+    Variants []Variant
+    Registry *metrics.Registry
+}
+
+type Experiment struct {
+    config Config
+    key    func(request *http.Request) string
+
+    mux    sync.Mutex
+    counts map[string]uint64
+}
+
+func New(config Config) (*Experiment, error) {
+    if config.Name == "" {
+        return nil, errors.New("experiment: name is required")
+    }
+    total := 0.0
+    for _, variant := range config.Variants {
+        if variant.Name == "" || variant.Percent < 0 {
+            return nil, fmt.Errorf("experiment %s: invalid variant %q", config.Name, variant.Name)
+        }
+        total += variant.Percent
+    }
+    if total > 100 {
+        return nil, fmt.Errorf("experiment %s: variants add up to %v%%", config.Name, total)
+    }
+    if config.Header == "" {
+        config.Header = "X-Experiment-" + config.Name
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+
+    experiment := &Experiment{config: config, counts: make(map[string]uint64)}
+    switch key := config.Key; {
+    case key == "" || key == "ip":
+        experiment.key = clientip.Peer
+    case strings.HasPrefix(key, "header:"):
+        name := strings.TrimPrefix(key, "header:")
+        experiment.key = func(request *http.Request) string { return request.Header.Get(name) }
+    case strings.HasPrefix(key, "cookie:"):
+        name := strings.TrimPrefix(key, "cookie:")
+        experiment.key = func(request *http.Request) string {
+            if cookie, err := request.Cookie(name); err == nil {
+                return cookie.Value
+            }
+            return ""
+        }
+    default:
+        return nil, fmt.Errorf("experiment %s: unsupported key %q", config.Name, key)
+    }
+    return experiment, nil
+}
+
+// Assign returns the variant for request, or nil when the client is not
+// enrolled or has no key. The same key always gets the same variant, and
+// keys are bucketed independently per experiment.
+func (experiment *Experiment) Assign(request *http.Request) *Variant {
+    key := experiment.key(request)
+    if key == "" {
+        return nil
+    }
+    hash := fnv.New64a()
+    hash.Write([]byte(experiment.config.Name))
+    hash.Write([]byte{0})
+    hash.Write([]byte(key))
+    bucket := float64(hash.Sum64()%10000) / 100
+
+    for i := range experiment.config.Variants {
+        variant := &experiment.config.Variants[i]
+        if bucket < variant.Percent {
+            return variant
+        }
+        bucket -= variant.Percent
+    }
+    return nil
+}
+
+func (experiment *Experiment) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        request.Header.Del(experiment.config.Header)
+        variant := experiment.Assign(request)
+        if variant == nil {
+            next.ServeHTTP(writer, request)
+            return
+        }
+
+        experiment.mux.Lock()
+        experiment.counts[variant.Name]++
+        experiment.mux.Unlock()
+        experiment.config.Registry.Counter("lb_experiment_assignments_total", "Requests assigned to each experiment variant.", "experiment", experiment.config.Name, "variant", variant.Name).Inc()
+
+        request.Header.Set(experiment.config.Header, variant.Name)
+        if variant.Pool != "" {
+            request = balancer.WithPool(request, variant.Pool)
+        }
+        next.ServeHTTP(writer, request)
+    })
+}
+
+// Counts returns the requests assigned to each variant so far.
+func (experiment *Experiment) Counts() map[string]uint64 {
+    experiment.mux.Lock()
+    defer experiment.mux.Unlock()
+
+    counts := make(map[string]uint64, len(experiment.config.Variants))
+    for _, variant := range experiment.config.Variants {
+        counts[variant.Name] = experiment.counts[variant.Name]
+    }
+    return counts
+}
+
+func (experiment *Experiment) Register(server *admin.Server) {
+    server.HandleFunc("GET /admin/experiments/"+experiment.config.Name, func(writer http.ResponseWriter, request *http.Request) {
+        admin.WriteJSON(writer, http.StatusOK, map[string]any{
+            "experiment":  experiment.config.Name,
+            "assignments": experiment.Counts(),
+        })
+    })
+}
+
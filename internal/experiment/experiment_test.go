@@ -0,0 +1,142 @@
+package experiment
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "testing"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+)
+
+func newPool(t *testing.T, name string) *balancer.ServerPool {
+    t.Helper()
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("X-Pool", name)
+        w.Header().Set("X-Seen-Variant", r.Header.Get("X-Experiment-checkout"))
+    }))
+    t.Cleanup(server.Close)
+
+    serverURL, _ := url.Parse(server.URL)
+    pool := balancer.NewServerPool()
+    pool.AddBackend(&backend.Backend{
+        URL:          serverURL,
+        Alive:        true,
+        ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL),
+    })
+    return pool
+}
+
+func TestNew_Validation(t *testing.T) {
+    tests := []struct {
+        name    string
+        config  Config
+        wantErr bool
+    }{
+        {"valid", Config{Name: "a", Variants: []Variant{{Name: "x", Percent: 50}, {Name: "y", Percent: 50}}}, false},
+        {"missing name", Config{Variants: []Variant{{Name: "x", Percent: 50}}}, true},
+        {"over 100 percent", Config{Name: "a", Variants: []Variant{{Name: "x", Percent: 60}, {Name: "y", Percent: 50}}}, true},
+        {"negative percent", Config{Name: "a", Variants: []Variant{{Name: "x", Percent: -1}}}, true},
+        {"unsupported key", Config{Name: "a", Key: "query:id"}, true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            tt.config.Registry = metrics.NewRegistry()
+            _, err := New(tt.config)
+            if (err != nil) != tt.wantErr {
+                t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+            }
+        })
+    }
+}
+
+func TestExperiment_AssignIsStableAndProportional(t *testing.T) {
+    experiment, err := New(Config{
+        Name:     "checkout",
+        Key:      "header:X-User",
+        Variants: []Variant{{Name: "control", Percent: 50}, {Name: "treatment", Percent: 25}},
+        Registry: metrics.NewRegistry(),
+    })
+    if err != nil {
+        t.Fatalf("New() error: %v", err)
+    }
+
+    counts := make(map[string]int)
+    for i := 0; i < 4000; i++ {
+        request := httptest.NewRequest(http.MethodGet, "/", nil)
+        request.Header.Set("X-User", fmt.Sprintf("user-%d", i))
+
+        first, second := experiment.Assign(request), experiment.Assign(request)
+        if first != second {
+            t.Fatalf("Expected stable assignment for user-%d", i)
+        }
+        name := "none"
+        if first != nil {
+            name = first.Name
+        }
+        counts[name]++
+    }
+
+    expected := map[string]int{"control": 2000, "treatment": 1000, "none": 1000}
+    for name, want := range expected {
+        if got := counts[name]; got < want*9/10 || got > want*11/10 {
+            t.Errorf("Expected about %d requests in %s, got %d", want, name, got)
+        }
+    }
+
+    anonymous := httptest.NewRequest(http.MethodGet, "/", nil)
+    if variant := experiment.Assign(anonymous); variant != nil {
+        t.Errorf("Expected no variant without a key, got %s", variant.Name)
+    }
+}
+
+func TestExperiment_Middleware(t *testing.T) {
+    registry := metrics.NewRegistry()
+    experiment, err := New(Config{
+        Name:     "checkout",
+        Key:      "cookie:uid",
+        Variants: []Variant{{Name: "control", Percent: 50}, {Name: "treatment", Percent: 50, Pool: "canary"}},
+        Registry: registry,
+    })
+    if err != nil {
+        t.Fatalf("New() error: %v", err)
+    }
+
+    router := balancer.NewRouter("stable")
+    router.AddPool("stable", newPool(t, "stable"))
+    router.AddPool("canary", newPool(t, "canary"))
+    router.AddRoute(balancer.Route{Name: "app", Middleware: []func(http.Handler) http.Handler{experiment.Middleware}})
+
+    expectedPool := map[string]string{"control": "stable", "treatment": "canary"}
+    for i := 0; i < 20; i++ {
+        request := httptest.NewRequest(http.MethodGet, "/", nil)
+        request.AddCookie(&http.Cookie{Name: "uid", Value: fmt.Sprintf("u%d", i)})
+        request.Header.Set("X-Experiment-checkout", "spoofed")
+        variant := experiment.Assign(request)
+
+        recorder := httptest.NewRecorder()
+        router.ServeHTTP(recorder, request)
+
+        if got := recorder.Header().Get("X-Seen-Variant"); got != variant.Name {
+            t.Errorf("Expected variant header %q, got %q", variant.Name, got)
+        }
+        if got := recorder.Header().Get("X-Pool"); got != expectedPool[variant.Name] {
+            t.Errorf("Expected %s to be served by %s, got %s", variant.Name, expectedPool[variant.Name], got)
+        }
+    }
+
+    counts := experiment.Counts()
+    if counts["control"]+counts["treatment"] != 20 {
+        t.Errorf("Expected 20 assignments, got %v", counts)
+    }
+    counter := registry.Counter("lb_experiment_assignments_total", "", "experiment", "checkout", "variant", "treatment")
+    if uint64(counter.Value()) != counts["treatment"] {
+        t.Errorf("Expected metric %d, got %v", counts["treatment"], counter.Value())
+    }
+}
@@ -0,0 +1,81 @@
+package fastpath
+
+import (
+    "net/http"
+    "slices"
+    "strconv"
+    "strings"
+
+    "load-balancer/internal/metrics"
+)
+
+// Response is a fixed answer for requests to Path. Methods defaults to GET
+// and HEAD, Status to 200 and ContentType to text/plain.
+type Response struct {
+    Path        string
+    Methods     []string
+    Status      int
+    Body        string
+    ContentType string
+}
+
+// Config lists the paths answered by the balancer itself. Server-wide
+// "OPTIONS *" requests are always answered, with Allow listing AllowMethods
+// (a typical method set by default), since no backend can do better.
+type Config struct {
+    Responses    []Response
+    AllowMethods []string
+    Registry     *metrics.Registry
+}
+
+// Middleware answers configured infrastructure probes before backend
+// selection, so they neither reach nor depend on the backends.
+func Middleware(config Config) func(http.Handler) http.Handler {
+    if len(config.AllowMethods) == 0 {
+        config.AllowMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+
+    responses := make(map[string]Response, len(config.Responses))
+    for _, response := range config.Responses {
+        if len(response.Methods) == 0 {
+            response.Methods = []string{http.MethodGet, http.MethodHead}
+        }
+        if response.Status == 0 {
+            response.Status = http.StatusOK
+        }
+        if response.ContentType == "" {
+            response.ContentType = "text/plain; charset=utf-8"
+        }
+        responses[response.Path] = response
+    }
+    allow := strings.Join(config.AllowMethods, ", ")
+
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+            if request.Method == http.MethodOptions && request.RequestURI == "*" {
+                config.Registry.Counter("lb_fastpath_responses_total", "Requests answered by the balancer without a backend.", "path", "*").Inc()
+                writer.Header().Set("Allow", allow)
+                writer.Header().Set("Content-Length", "0")
+                writer.WriteHeader(http.StatusOK)
+                return
+            }
+
+            response, ok := responses[request.URL.Path]
+            if !ok || !slices.Contains(response.Methods, request.Method) {
+                next.ServeHTTP(writer, request)
+                return
+            }
+            config.Registry.Counter("lb_fastpath_responses_total", "Requests answered by the balancer without a backend.", "path", response.Path).Inc()
+            writer.Header().Set("Content-Type", response.ContentType)
+            writer.Header().Set("Content-Length", strconv.Itoa(len(response.Body)))
+            writer.Header().Set("Cache-Control", "no-store")
+            writer.WriteHeader(response.Status)
+            if request.Method != http.MethodHead {
+                writer.Write([]byte(response.Body))
+            }
+        })
+    }
+}
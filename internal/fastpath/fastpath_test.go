@@ -0,0 +1,72 @@
+package fastpath
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "load-balancer/internal/metrics"
+)
+
+func TestMiddleware(t *testing.T) {
+    registry := metrics.NewRegistry()
+    reached := false
+    handler := Middleware(Config{
+        Responses: []Response{
+            {Path: "/ping", Body: "pong"},
+            {Path: "/healthz", Methods: []string{http.MethodGet}, Status: http.StatusNoContent},
+        },
+        Registry: registry,
+    })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        reached = true
+        w.Write([]byte("backend"))
+    }))
+
+    tests := []struct {
+        name          string
+        method        string
+        target        string
+        expectedCode  int
+        expectedBody  string
+        expectedAllow string
+        reachBackend  bool
+    }{
+        {name: "configured path", method: "GET", target: "/ping", expectedCode: http.StatusOK, expectedBody: "pong"},
+        {name: "head has no body", method: "HEAD", target: "/ping", expectedCode: http.StatusOK},
+        {name: "custom status", method: "GET", target: "/healthz", expectedCode: http.StatusNoContent},
+        {name: "method not configured", method: "POST", target: "/ping", expectedCode: http.StatusOK, expectedBody: "backend", reachBackend: true},
+        {name: "other path", method: "GET", target: "/ping/more", expectedCode: http.StatusOK, expectedBody: "backend", reachBackend: true},
+        {name: "server-wide options", method: "OPTIONS", target: "*", expectedCode: http.StatusOK, expectedAllow: "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"},
+        {name: "path options", method: "OPTIONS", target: "/api", expectedCode: http.StatusOK, expectedBody: "backend", reachBackend: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            reached = false
+            request := httptest.NewRequest(tt.method, "/", nil)
+            request.RequestURI = tt.target
+            if tt.target != "*" {
+                request = httptest.NewRequest(tt.method, tt.target, nil)
+            }
+            rr := httptest.NewRecorder()
+            handler.ServeHTTP(rr, request)
+
+            if rr.Code != tt.expectedCode {
+                t.Errorf("Expected status %d, got %d", tt.expectedCode, rr.Code)
+            }
+            if rr.Body.String() != tt.expectedBody {
+                t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body.String())
+            }
+            if got := rr.Header().Get("Allow"); got != tt.expectedAllow {
+                t.Errorf("Expected Allow %q, got %q", tt.expectedAllow, got)
+            }
+            if reached != tt.reachBackend {
+                t.Errorf("Expected backend reached %v, got %v", tt.reachBackend, reached)
+            }
+        })
+    }
+
+    if got := registry.Counter("lb_fastpath_responses_total", "", "path", "/ping").Value(); got != 2 {
+        t.Errorf("Expected 2 answered pings, got %v", got)
+    }
+}
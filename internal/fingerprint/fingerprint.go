@@ -0,0 +1,158 @@
+package fingerprint
+
+import (
+    "crypto/md5"
+    "crypto/sha256"
+    "crypto/tls"
+    "encoding/hex"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+type Fingerprint struct {
+    JA3     string
+    JA3Hash string
+    JA4     string
+}
+
+func Compute(hello *tls.ClientHelloInfo) Fingerprint {
+    ja3 := JA3(hello)
+    sum := md5.Sum([]byte(ja3))
+    return Fingerprint{
+        JA3:     ja3,
+        JA3Hash: hex.EncodeToString(sum[:]),
+        JA4:     JA4(hello),
+    }
+}
+
+func isGREASE(value uint16) bool {
+    return value&0x0f0f == 0x0a0a && value>>8 == value&0xff
+}
+
+func JA3(hello *tls.ClientHelloInfo) string {
+    version := uint16(tls.VersionTLS12)
+    if max := maxVersion(hello.SupportedVersions); max != 0 && max < version {
+        version = max
+    }
+
+    var curves []uint16
+    for _, curve := range hello.SupportedCurves {
+        curves = append(curves, uint16(curve))
+    }
+    var points []uint16
+    for _, point := range hello.SupportedPoints {
+        points = append(points, uint16(point))
+    }
+
+    return strings.Join([]string{
+        strconv.Itoa(int(version)),
+        joinDecimal(hello.CipherSuites),
+        joinDecimal(hello.Extensions),
+        joinDecimal(curves),
+        joinDecimal(points),
+    }, ",")
+}
+
+func JA4(hello *tls.ClientHelloInfo) string {
+    version := "00"
+    switch maxVersion(hello.SupportedVersions) {
+    case tls.VersionTLS13:
+        version = "13"
+    case tls.VersionTLS12:
+        version = "12"
+    case tls.VersionTLS11:
+        version = "11"
+    case tls.VersionTLS10:
+        version = "10"
+    }
+
+    sni := "i"
+    if hello.ServerName != "" {
+        sni = "d"
+    }
+
+    alpn := "00"
+    if len(hello.SupportedProtos) > 0 && hello.SupportedProtos[0] != "" {
+        proto := hello.SupportedProtos[0]
+        alpn = string(proto[0]) + string(proto[len(proto)-1])
+    }
+
+    ciphers := filterGREASE(hello.CipherSuites)
+    extensions := filterGREASE(hello.Extensions)
+
+    var hashedExtensions []uint16
+    for _, extension := range extensions {
+        if extension != 0x0000 && extension != 0x0010 {
+            hashedExtensions = append(hashedExtensions, extension)
+        }
+    }
+    var signatures []uint16
+    for _, scheme := range hello.SignatureSchemes {
+        if !isGREASE(uint16(scheme)) {
+            signatures = append(signatures, uint16(scheme))
+        }
+    }
+
+    extensionInput := joinHex(sorted(hashedExtensions))
+    if len(signatures) > 0 {
+        extensionInput += "_" + joinHex(signatures)
+    }
+
+    return fmt.Sprintf("t%s%s%02d%02d%s_%s_%s",
+        version, sni, min(len(ciphers), 99), min(len(extensions), 99), alpn,
+        truncatedHash(joinHex(sorted(ciphers))),
+        truncatedHash(extensionInput),
+    )
+}
+
+func maxVersion(versions []uint16) uint16 {
+    var max uint16
+    for _, version := range versions {
+        if !isGREASE(version) && version > max {
+            max = version
+        }
+    }
+    return max
+}
+
+func filterGREASE(values []uint16) []uint16 {
+    filtered := make([]uint16, 0, len(values))
+    for _, value := range values {
+        if !isGREASE(value) {
+            filtered = append(filtered, value)
+        }
+    }
+    return filtered
+}
+
+func sorted(values []uint16) []uint16 {
+    copied := append([]uint16(nil), values...)
+    sort.Slice(copied, func(i, j int) bool { return copied[i] < copied[j] })
+    return copied
+}
+
+func joinDecimal(values []uint16) string {
+    parts := make([]string, 0, len(values))
+    for _, value := range filterGREASE(values) {
+        parts = append(parts, strconv.Itoa(int(value)))
+    }
+    return strings.Join(parts, "-")
+}
+
+func joinHex(values []uint16) string {
+    parts := make([]string, len(values))
+    for i, value := range values {
+        parts[i] = fmt.Sprintf("%04x", value)
+    }
+    return strings.Join(parts, ",")
+}
+
+func truncatedHash(input string) string {
+    if input == "" {
+        return "000000000000"
+    }
+    sum := sha256.Sum256([]byte(input))
+    return hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,103 @@
+package fingerprint
+
+import (
+    "crypto/tls"
+    "strings"
+    "testing"
+)
+
+func chromeLikeHello() *tls.ClientHelloInfo {
+    return &tls.ClientHelloInfo{
+        CipherSuites:      []uint16{0x0a0a, 0x1302, 0x1301},
+        Extensions:        []uint16{0x1a1a, 0x0000, 0x000a, 0x000b, 0x0010, 0x002b},
+        SupportedCurves:   []tls.CurveID{tls.X25519, tls.CurveP256},
+        SupportedPoints:   []uint8{0},
+        SupportedVersions: []uint16{0x3a3a, tls.VersionTLS13, tls.VersionTLS12},
+        SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256, tls.PSSWithSHA256},
+        SupportedProtos:   []string{"h2", "http/1.1"},
+        ServerName:        "shop.example.com",
+    }
+}
+
+func TestJA3(t *testing.T) {
+    hello := chromeLikeHello()
+    hello.CipherSuites = []uint16{0x0a0a, 0x1301, 0x1302}
+
+    fingerprint := Compute(hello)
+
+    if fingerprint.JA3 != "771,4865-4866,0-10-11-16-43,29-23,0" {
+        t.Errorf("JA3 = %q", fingerprint.JA3)
+    }
+    if fingerprint.JA3Hash != "aa5ea15175fa394afa3d3d74845ef0ad" {
+        t.Errorf("JA3Hash = %q", fingerprint.JA3Hash)
+    }
+}
+
+func TestJA4(t *testing.T) {
+    tests := []struct {
+        name     string
+        modify   func(hello *tls.ClientHelloInfo)
+        expected string
+    }{
+        {
+            name:     "tls 1.3 with sni and h2",
+            modify:   func(hello *tls.ClientHelloInfo) {},
+            expected: "t13d0205h2_62ed6f6ca7ad_5e08b9537ae3",
+        },
+        {
+            name: "no sni and http/1.1",
+            modify: func(hello *tls.ClientHelloInfo) {
+                hello.ServerName = ""
+                hello.SupportedProtos = []string{"http/1.1"}
+            },
+            expected: "t13i0205h1_62ed6f6ca7ad_5e08b9537ae3",
+        },
+        {
+            name: "no supported versions and no alpn",
+            modify: func(hello *tls.ClientHelloInfo) {
+                hello.SupportedVersions = nil
+                hello.SupportedProtos = nil
+            },
+            expected: "t00d020500_62ed6f6ca7ad_5e08b9537ae3",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            hello := chromeLikeHello()
+            tt.modify(hello)
+            if got := JA4(hello); got != tt.expected {
+                t.Errorf("JA4() = %q, expected %q", got, tt.expected)
+            }
+        })
+    }
+}
+
+func TestJA4_CipherOrderIndependent(t *testing.T) {
+    first := chromeLikeHello()
+    second := chromeLikeHello()
+    second.CipherSuites = []uint16{0x1301, 0x1302}
+
+    if JA4(first) != JA4(second) {
+        t.Error("JA4 should not depend on cipher order or GREASE values")
+    }
+    if JA3(first) == JA3(second) {
+        t.Error("JA3 should depend on cipher order")
+    }
+}
+
+func TestIsGREASE(t *testing.T) {
+    for _, value := range []uint16{0x0a0a, 0x1a1a, 0xfafa} {
+        if !isGREASE(value) {
+            t.Errorf("%#04x should be GREASE", value)
+        }
+    }
+    for _, value := range []uint16{0x0a1a, 0x1301, 0x0000} {
+        if isGREASE(value) {
+            t.Errorf("%#04x should not be GREASE", value)
+        }
+    }
+    if strings.Contains(joinDecimal([]uint16{0x0a0a, 1}), "2570") {
+        t.Error("joinDecimal should drop GREASE values")
+    }
+}
@@ -0,0 +1,120 @@
+package fingerprint
+
+import (
+    "context"
+    "crypto/tls"
+    "net"
+    "net/http"
+    "sync"
+)
+
+type Config struct {
+    JA3Header string
+    JA4Header string
+    Deny      []string
+}
+
+type Tracker struct {
+    conns sync.Map
+}
+
+type connContextKey struct{}
+
+func NewTracker() *Tracker {
+    return &Tracker{}
+}
+
+func (tracker *Tracker) Configure(server *http.Server) {
+    if server.TLSConfig == nil {
+        server.TLSConfig = &tls.Config{}
+    }
+    server.TLSConfig = tracker.WrapTLSConfig(server.TLSConfig)
+
+    connContext := server.ConnContext
+    server.ConnContext = func(ctx context.Context, conn net.Conn) context.Context {
+        if connContext != nil {
+            ctx = connContext(ctx, conn)
+        }
+        return tracker.ConnContext(ctx, conn)
+    }
+
+    connState := server.ConnState
+    server.ConnState = func(conn net.Conn, state http.ConnState) {
+        if connState != nil {
+            connState(conn, state)
+        }
+        tracker.ConnState(conn, state)
+    }
+}
+
+func (tracker *Tracker) WrapTLSConfig(config *tls.Config) *tls.Config {
+    wrapped := config.Clone()
+    getConfigForClient := config.GetConfigForClient
+    wrapped.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+        tracker.conns.Store(hello.Conn, Compute(hello))
+        if getConfigForClient != nil {
+            return getConfigForClient(hello)
+        }
+        return nil, nil
+    }
+    return wrapped
+}
+
+func (tracker *Tracker) ConnContext(ctx context.Context, conn net.Conn) context.Context {
+    if tlsConn, ok := conn.(*tls.Conn); ok {
+        conn = tlsConn.NetConn()
+    }
+    return context.WithValue(ctx, connContextKey{}, conn)
+}
+
+func (tracker *Tracker) ConnState(conn net.Conn, state http.ConnState) {
+    if state != http.StateClosed && state != http.StateHijacked {
+        return
+    }
+    if tlsConn, ok := conn.(*tls.Conn); ok {
+        conn = tlsConn.NetConn()
+    }
+    tracker.conns.Delete(conn)
+}
+
+func (tracker *Tracker) Lookup(request *http.Request) (Fingerprint, bool) {
+    conn, ok := request.Context().Value(connContextKey{}).(net.Conn)
+    if !ok {
+        return Fingerprint{}, false
+    }
+    fingerprint, ok := tracker.conns.Load(conn)
+    if !ok {
+        return Fingerprint{}, false
+    }
+    return fingerprint.(Fingerprint), true
+}
+
+func (tracker *Tracker) Middleware(config Config) func(next http.Handler) http.Handler {
+    if config.JA3Header == "" {
+        config.JA3Header = "X-JA3-Fingerprint"
+    }
+    if config.JA4Header == "" {
+        config.JA4Header = "X-JA4-Fingerprint"
+    }
+    denied := make(map[string]bool, len(config.Deny))
+    for _, value := range config.Deny {
+        denied[value] = true
+    }
+
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+            request.Header.Del(config.JA3Header)
+            request.Header.Del(config.JA4Header)
+
+            if fingerprint, ok := tracker.Lookup(request); ok {
+                if denied[fingerprint.JA3Hash] || denied[fingerprint.JA4] {
+                    http.Error(writer, "Forbidden", http.StatusForbidden)
+                    return
+                }
+                request.Header.Set(config.JA3Header, fingerprint.JA3Hash)
+                request.Header.Set(config.JA4Header, fingerprint.JA4)
+            }
+            next.ServeHTTP(writer, request)
+        })
+    }
+}
@@ -0,0 +1,90 @@
+package fingerprint
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func newFingerprintServer(t *testing.T, config Config) (*httptest.Server, *Tracker) {
+    t.Helper()
+
+    tracker := NewTracker()
+    handler := tracker.Middleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        io.WriteString(w, r.Header.Get("X-JA3-Fingerprint")+" "+r.Header.Get("X-JA4-Fingerprint"))
+    }))
+
+    server := httptest.NewUnstartedServer(handler)
+    tracker.Configure(server.Config)
+    server.TLS = server.Config.TLSConfig
+    server.StartTLS()
+    t.Cleanup(server.Close)
+    return server, tracker
+}
+
+func TestTracker_InjectsHeaders(t *testing.T) {
+    server, _ := newFingerprintServer(t, Config{})
+
+    req, _ := http.NewRequest("GET", server.URL, nil)
+    req.Header.Set("X-JA3-Fingerprint", "spoofed")
+    resp, err := server.Client().Do(req)
+    if err != nil {
+        t.Fatalf("request failed: %v", err)
+    }
+    defer resp.Body.Close()
+    body, _ := io.ReadAll(resp.Body)
+
+    parts := strings.Fields(string(body))
+    if len(parts) != 2 {
+        t.Fatalf("Expected JA3 and JA4 headers, got %q", body)
+    }
+    if len(parts[0]) != 32 || parts[0] == "spoofed" {
+        t.Errorf("Unexpected JA3 hash %q", parts[0])
+    }
+    if !strings.HasPrefix(parts[1], "t13") {
+        t.Errorf("Unexpected JA4 %q", parts[1])
+    }
+}
+
+func TestTracker_Deny(t *testing.T) {
+    probe, _ := newFingerprintServer(t, Config{})
+    resp, err := probe.Client().Get(probe.URL)
+    if err != nil {
+        t.Fatalf("probe request failed: %v", err)
+    }
+    body, _ := io.ReadAll(resp.Body)
+    resp.Body.Close()
+    ja4 := strings.Fields(string(body))[1]
+
+    server, _ := newFingerprintServer(t, Config{Deny: []string{ja4}})
+    resp, err = server.Client().Get(server.URL)
+    if err != nil {
+        t.Fatalf("request failed: %v", err)
+    }
+    resp.Body.Close()
+
+    if resp.StatusCode != http.StatusForbidden {
+        t.Errorf("Expected status 403 for denied fingerprint, got %d", resp.StatusCode)
+    }
+}
+
+func TestTracker_PlainHTTP(t *testing.T) {
+    tracker := NewTracker()
+    called := false
+    handler := tracker.Middleware(Config{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        called = true
+        if r.Header.Get("X-JA4-Fingerprint") != "" {
+            t.Error("plain HTTP requests should not carry a fingerprint")
+        }
+    }))
+
+    handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+    if !called {
+        t.Error("request should pass through without TLS")
+    }
+    if _, ok := tracker.Lookup(httptest.NewRequest("GET", "/", nil)); ok {
+        t.Error("Lookup() should fail without a tracked connection")
+    }
+}
@@ -0,0 +1,163 @@
+package geoip
+
+import (
+    "context"
+    "log"
+    "math/rand/v2"
+    "net"
+    "net/http"
+    "net/netip"
+    "os"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "load-balancer/internal/balancer"
+)
+
+type Location struct {
+    Country   string
+    Continent string
+}
+
+type Rule struct {
+    Countries  []string
+    Continents []string
+    Pool       string
+    Weight     int
+}
+
+type Config struct {
+    CountryHeader   string
+    ContinentHeader string
+    Rules           []Rule
+}
+
+type Resolver struct {
+    path    string
+    reader  atomic.Pointer[Reader]
+    modTime atomic.Int64
+    random  func(n int) int
+}
+
+func NewResolver(path string) (*Resolver, error) {
+    resolver := &Resolver{path: path, random: rand.IntN}
+    if err := resolver.Reload(); err != nil {
+        return nil, err
+    }
+    return resolver, nil
+}
+
+func (resolver *Resolver) Reload() error {
+    info, err := os.Stat(resolver.path)
+    if err != nil {
+        return err
+    }
+    reader, err := Open(resolver.path)
+    if err != nil {
+        return err
+    }
+    resolver.reader.Store(reader)
+    resolver.modTime.Store(info.ModTime().UnixNano())
+    return nil
+}
+
+func (resolver *Resolver) Watch(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+
+        info, err := os.Stat(resolver.path)
+        if err != nil || info.ModTime().UnixNano() == resolver.modTime.Load() {
+            continue
+        }
+        if err := resolver.Reload(); err != nil {
+            log.Printf("geoip: keeping previous database, reload failed: %v\n", err)
+            continue
+        }
+        log.Printf("geoip: reloaded %s\n", resolver.path)
+    }
+}
+
+func (resolver *Resolver) Lookup(addr netip.Addr) (Location, bool) {
+    record, err := resolver.reader.Load().Lookup(addr)
+    if err != nil {
+        return Location{}, false
+    }
+
+    var location Location
+    if country, ok := record["country"].(map[string]any); ok {
+        location.Country, _ = country["iso_code"].(string)
+    }
+    if continent, ok := record["continent"].(map[string]any); ok {
+        location.Continent, _ = continent["code"].(string)
+    }
+    return location, location.Country != "" || location.Continent != ""
+}
+
+func (resolver *Resolver) Middleware(config Config) func(next http.Handler) http.Handler {
+    if config.CountryHeader == "" {
+        config.CountryHeader = "X-Client-Country"
+    }
+    if config.ContinentHeader == "" {
+        config.ContinentHeader = "X-Client-Continent"
+    }
+
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+            request.Header.Del(config.CountryHeader)
+            request.Header.Del(config.ContinentHeader)
+
+            location, ok := resolver.Lookup(remoteAddr(request))
+            if ok {
+                if location.Country != "" {
+                    request.Header.Set(config.CountryHeader, location.Country)
+                }
+                if location.Continent != "" {
+                    request.Header.Set(config.ContinentHeader, location.Continent)
+                }
+                if pool := resolver.match(config.Rules, location); pool != "" {
+                    request = balancer.WithPool(request, pool)
+                }
+            }
+            next.ServeHTTP(writer, request)
+        })
+    }
+}
+
+func (resolver *Resolver) match(rules []Rule, location Location) string {
+    for _, rule := range rules {
+        if !contains(rule.Countries, location.Country) && !contains(rule.Continents, location.Continent) {
+            continue
+        }
+        if rule.Weight > 0 && rule.Weight < 100 && resolver.random(100) >= rule.Weight {
+            continue
+        }
+        return rule.Pool
+    }
+    return ""
+}
+
+func contains(values []string, value string) bool {
+    for _, candidate := range values {
+        if value != "" && strings.EqualFold(candidate, value) {
+            return true
+        }
+    }
+    return false
+}
+
+func remoteAddr(request *http.Request) netip.Addr {
+    host, _, err := net.SplitHostPort(request.RemoteAddr)
+    if err != nil {
+        host = request.RemoteAddr
+    }
+    addr, _ := netip.ParseAddr(host)
+    return addr
+}
@@ -0,0 +1,196 @@
+package geoip
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/netip"
+    "net/url"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+)
+
+func writeDatabase(t *testing.T, path string, entries map[string]map[string]any) {
+    t.Helper()
+
+    if err := os.WriteFile(path, buildTestDatabase(entries), 0o644); err != nil {
+        t.Fatalf("write database: %v", err)
+    }
+}
+
+func newPool(t *testing.T, name string) *balancer.ServerPool {
+    t.Helper()
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("X-Pool", name)
+        w.Header().Set("X-Seen-Country", r.Header.Get("X-Client-Country"))
+        w.Header().Set("X-Seen-Continent", r.Header.Get("X-Client-Continent"))
+    }))
+    t.Cleanup(server.Close)
+
+    serverURL, _ := url.Parse(server.URL)
+    pool := balancer.NewServerPool()
+    pool.AddBackend(&backend.Backend{
+        URL:          serverURL,
+        Alive:        true,
+        ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL),
+    })
+    return pool
+}
+
+func TestResolver_Middleware(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "country.mmdb")
+    writeDatabase(t, path, map[string]map[string]any{
+        "81.2.0.0/16":     countryRecord("GB", "EU"),
+        "203.0.113.0/24":  countryRecord("AU", "OC"),
+        "198.51.100.0/24": countryRecord("US", "NA"),
+    })
+
+    resolver, err := NewResolver(path)
+    if err != nil {
+        t.Fatalf("NewResolver() error: %v", err)
+    }
+
+    router := balancer.NewRouter("global")
+    router.AddPool("global", newPool(t, "global"))
+    router.AddPool("eu", newPool(t, "eu"))
+    router.AddPool("apac", newPool(t, "apac"))
+    router.AddRoute(balancer.Route{
+        Name: "all",
+        Pool: "global",
+        Middleware: []func(http.Handler) http.Handler{
+            resolver.Middleware(Config{Rules: []Rule{
+                {Continents: []string{"EU"}, Pool: "eu"},
+                {Countries: []string{"au", "NZ"}, Pool: "apac"},
+            }}),
+        },
+    })
+
+    tests := []struct {
+        name              string
+        remote            string
+        spoofed           string
+        expectedPool      string
+        expectedCountry   string
+        expectedContinent string
+    }{
+        {
+            name:              "EU continent rule",
+            remote:            "81.2.69.160:5000",
+            expectedPool:      "eu",
+            expectedCountry:   "GB",
+            expectedContinent: "EU",
+        },
+        {
+            name:              "country rule is case insensitive",
+            remote:            "203.0.113.7:5000",
+            expectedPool:      "apac",
+            expectedCountry:   "AU",
+            expectedContinent: "OC",
+        },
+        {
+            name:              "no rule keeps route pool",
+            remote:            "198.51.100.1:5000",
+            expectedPool:      "global",
+            expectedCountry:   "US",
+            expectedContinent: "NA",
+        },
+        {
+            name:         "unknown address strips spoofed header",
+            remote:       "192.0.2.1:5000",
+            spoofed:      "FR",
+            expectedPool: "global",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            req := httptest.NewRequest("GET", "/", nil)
+            req.RemoteAddr = tt.remote
+            if tt.spoofed != "" {
+                req.Header.Set("X-Client-Country", tt.spoofed)
+            }
+            rr := httptest.NewRecorder()
+
+            router.ServeHTTP(rr, req)
+
+            if got := rr.Header().Get("X-Pool"); got != tt.expectedPool {
+                t.Errorf("pool = %q, expected %q", got, tt.expectedPool)
+            }
+            if got := rr.Header().Get("X-Seen-Country"); got != tt.expectedCountry {
+                t.Errorf("country header = %q, expected %q", got, tt.expectedCountry)
+            }
+            if got := rr.Header().Get("X-Seen-Continent"); got != tt.expectedContinent {
+                t.Errorf("continent header = %q, expected %q", got, tt.expectedContinent)
+            }
+        })
+    }
+}
+
+func TestResolver_WeightedRule(t *testing.T) {
+    resolver := &Resolver{}
+    rules := []Rule{{Continents: []string{"EU"}, Pool: "eu", Weight: 30}}
+
+    tests := []struct {
+        roll     int
+        expected string
+    }{
+        {roll: 29, expected: "eu"},
+        {roll: 30, expected: ""},
+    }
+
+    for _, tt := range tests {
+        resolver.random = func(n int) int { return tt.roll }
+        if got := resolver.match(rules, Location{Continent: "EU"}); got != tt.expected {
+            t.Errorf("roll %d: match() = %q, expected %q", tt.roll, got, tt.expected)
+        }
+    }
+}
+
+func TestResolver_HotReload(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "country.mmdb")
+    writeDatabase(t, path, map[string]map[string]any{"81.2.0.0/16": countryRecord("GB", "EU")})
+
+    resolver, err := NewResolver(path)
+    if err != nil {
+        t.Fatalf("NewResolver() error: %v", err)
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    go resolver.Watch(ctx, 10*time.Millisecond)
+
+    addr := netip.MustParseAddr("81.2.1.1")
+    if location, _ := resolver.Lookup(addr); location.Country != "GB" {
+        t.Fatalf("Lookup() = %+v, expected GB", location)
+    }
+
+    writeDatabase(t, path, map[string]map[string]any{"81.2.0.0/16": countryRecord("IE", "EU")})
+    future := time.Now().Add(time.Minute)
+    os.Chtimes(path, future, future)
+
+    deadline := time.Now().Add(2 * time.Second)
+    for {
+        if location, _ := resolver.Lookup(addr); location.Country == "IE" {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("database was not reloaded")
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+
+    os.WriteFile(path, []byte("corrupt"), 0o644)
+    if err := resolver.Reload(); err == nil {
+        t.Error("Reload() should fail for a corrupt database")
+    }
+    if location, _ := resolver.Lookup(addr); location.Country != "IE" {
+        t.Errorf("previous database should stay active after failed reload, got %+v", location)
+    }
+}
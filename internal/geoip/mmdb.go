@@ -0,0 +1,301 @@
+package geoip
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "math"
+    "net/netip"
+    "os"
+)
+
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+var errNotFound = errors.New("geoip: address not found")
+
+type Reader struct {
+    buffer     []byte
+    nodeCount  uint
+    recordSize uint
+    ipVersion  uint
+    ipv4Start  uint
+    dataStart  uint
+    Metadata   map[string]any
+}
+
+func Open(path string) (*Reader, error) {
+    buffer, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    return NewReader(buffer)
+}
+
+func NewReader(buffer []byte) (*Reader, error) {
+    idx := bytes.LastIndex(buffer, metadataMarker)
+    if idx < 0 {
+        return nil, fmt.Errorf("geoip: metadata marker not found")
+    }
+
+    metadataStart := uint(idx + len(metadataMarker))
+    decoder := &decoder{buffer: buffer[metadataStart:]}
+    value, _, err := decoder.decode(0)
+    if err != nil {
+        return nil, fmt.Errorf("geoip: invalid metadata: %w", err)
+    }
+    metadata, ok := value.(map[string]any)
+    if !ok {
+        return nil, fmt.Errorf("geoip: metadata is not a map")
+    }
+
+    reader := &Reader{
+        buffer:     buffer,
+        nodeCount:  toUint(metadata["node_count"]),
+        recordSize: toUint(metadata["record_size"]),
+        ipVersion:  toUint(metadata["ip_version"]),
+        Metadata:   metadata,
+    }
+    switch reader.recordSize {
+    case 24, 28, 32:
+    default:
+        return nil, fmt.Errorf("geoip: unsupported record size %d", reader.recordSize)
+    }
+
+    treeSize := reader.recordSize * 2 / 8 * reader.nodeCount
+    reader.dataStart = treeSize + 16
+    if reader.dataStart > uint(idx) {
+        return nil, fmt.Errorf("geoip: search tree exceeds file size")
+    }
+
+    if reader.ipVersion == 6 {
+        node := uint(0)
+        for i := 0; i < 96 && node < reader.nodeCount; i++ {
+            node = reader.readNode(node, 0)
+        }
+        reader.ipv4Start = node
+    }
+    return reader, nil
+}
+
+func (reader *Reader) Lookup(addr netip.Addr) (map[string]any, error) {
+    addr = addr.Unmap()
+
+    node := uint(0)
+    bits := addr.AsSlice()
+    if addr.Is4() && reader.ipVersion == 6 {
+        node = reader.ipv4Start
+    } else if addr.Is6() && reader.ipVersion == 4 {
+        return nil, fmt.Errorf("geoip: IPv6 lookup in IPv4-only database")
+    }
+
+    for i := 0; i < len(bits)*8 && node < reader.nodeCount; i++ {
+        bit := uint(bits[i/8]>>(7-uint(i%8))) & 1
+        node = reader.readNode(node, bit)
+    }
+
+    if node == reader.nodeCount {
+        return nil, errNotFound
+    }
+    if node < reader.nodeCount {
+        return nil, fmt.Errorf("geoip: invalid search tree")
+    }
+
+    offset := node - reader.nodeCount - 16
+    decoder := &decoder{buffer: reader.buffer[reader.dataStart:]}
+    value, _, err := decoder.decode(offset)
+    if err != nil {
+        return nil, err
+    }
+    record, ok := value.(map[string]any)
+    if !ok {
+        return nil, fmt.Errorf("geoip: record is not a map")
+    }
+    return record, nil
+}
+
+func (reader *Reader) readNode(node, bit uint) uint {
+    switch reader.recordSize {
+    case 24:
+        offset := node*6 + bit*3
+        b := reader.buffer[offset : offset+3]
+        return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+    case 28:
+        offset := node * 7
+        b := reader.buffer[offset : offset+7]
+        if bit == 0 {
+            return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+        }
+        return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+    default:
+        offset := node*8 + bit*4
+        return uint(binary.BigEndian.Uint32(reader.buffer[offset : offset+4]))
+    }
+}
+
+const (
+    typeExtended = 0
+    typePointer  = 1
+    typeString   = 2
+    typeDouble   = 3
+    typeBytes    = 4
+    typeUint16   = 5
+    typeUint32   = 6
+    typeMap      = 7
+    typeInt32    = 8
+    typeUint64   = 9
+    typeUint128  = 10
+    typeArray    = 11
+    typeBool     = 14
+    typeFloat    = 15
+)
+
+type decoder struct {
+    buffer []byte
+}
+
+func (decoder *decoder) decode(offset uint) (any, uint, error) {
+    if offset >= uint(len(decoder.buffer)) {
+        return nil, 0, fmt.Errorf("offset %d out of range", offset)
+    }
+
+    control := decoder.buffer[offset]
+    offset++
+    kind := uint(control >> 5)
+
+    if kind == typePointer {
+        pointer, next, err := decoder.pointer(control, offset)
+        if err != nil {
+            return nil, 0, err
+        }
+        value, _, err := decoder.decode(pointer)
+        return value, next, err
+    }
+
+    if kind == typeExtended {
+        if offset >= uint(len(decoder.buffer)) {
+            return nil, 0, fmt.Errorf("truncated extended type")
+        }
+        kind = 7 + uint(decoder.buffer[offset])
+        offset++
+    }
+
+    size := uint(control & 0x1f)
+    if size >= 29 {
+        extra := size - 28
+        if offset+extra > uint(len(decoder.buffer)) {
+            return nil, 0, fmt.Errorf("truncated size")
+        }
+        var n uint
+        for _, b := range decoder.buffer[offset : offset+extra] {
+            n = n<<8 | uint(b)
+        }
+        offset += extra
+        switch size {
+        case 29:
+            size = 29 + n
+        case 30:
+            size = 285 + n
+        default:
+            size = 65821 + n
+        }
+    }
+
+    switch kind {
+    case typeMap:
+        result := make(map[string]any, size)
+        for i := uint(0); i < size; i++ {
+            key, next, err := decoder.decode(offset)
+            if err != nil {
+                return nil, 0, err
+            }
+            name, ok := key.(string)
+            if !ok {
+                return nil, 0, fmt.Errorf("map key is not a string")
+            }
+            value, after, err := decoder.decode(next)
+            if err != nil {
+                return nil, 0, err
+            }
+            result[name] = value
+            offset = after
+        }
+        return result, offset, nil
+    case typeArray:
+        result := make([]any, 0, size)
+        for i := uint(0); i < size; i++ {
+            value, next, err := decoder.decode(offset)
+            if err != nil {
+                return nil, 0, err
+            }
+            result = append(result, value)
+            offset = next
+        }
+        return result, offset, nil
+    case typeBool:
+        return size != 0, offset, nil
+    }
+
+    if offset+size > uint(len(decoder.buffer)) {
+        return nil, 0, fmt.Errorf("truncated value")
+    }
+    raw := decoder.buffer[offset : offset+size]
+    next := offset + size
+
+    switch kind {
+    case typeString:
+        return string(raw), next, nil
+    case typeBytes:
+        return append([]byte(nil), raw...), next, nil
+    case typeDouble:
+        if size != 8 {
+            return nil, 0, fmt.Errorf("invalid double size %d", size)
+        }
+        return math.Float64frombits(binary.BigEndian.Uint64(raw)), next, nil
+    case typeFloat:
+        if size != 4 {
+            return nil, 0, fmt.Errorf("invalid float size %d", size)
+        }
+        return float64(math.Float32frombits(binary.BigEndian.Uint32(raw))), next, nil
+    case typeUint16, typeUint32, typeUint64, typeUint128:
+        var n uint64
+        for _, b := range raw {
+            n = n<<8 | uint64(b)
+        }
+        return n, next, nil
+    case typeInt32:
+        var n uint32
+        for _, b := range raw {
+            n = n<<8 | uint32(b)
+        }
+        return int64(int32(n)), next, nil
+    }
+    return nil, 0, fmt.Errorf("unsupported data type %d", kind)
+}
+
+func (decoder *decoder) pointer(control byte, offset uint) (uint, uint, error) {
+    size := uint(control>>3)&0x3 + 1
+    if offset+size > uint(len(decoder.buffer)) {
+        return 0, 0, fmt.Errorf("truncated pointer")
+    }
+
+    var pointer uint
+    if size != 4 {
+        pointer = uint(control & 0x7)
+    }
+    for _, b := range decoder.buffer[offset : offset+size] {
+        pointer = pointer<<8 | uint(b)
+    }
+    switch size {
+    case 2:
+        pointer += 2048
+    case 3:
+        pointer += 526336
+    }
+    return pointer, offset + size, nil
+}
+
+func toUint(value any) uint {
+    n, _ := value.(uint64)
+    return uint(n)
+}
@@ -0,0 +1,245 @@
+package geoip
+
+import (
+    "bytes"
+    "net/netip"
+    "sort"
+    "testing"
+)
+
+type trieNode struct {
+    children [2]*trieNode
+    data     int
+}
+
+func encodeData(buffer *bytes.Buffer, value any) {
+    switch v := value.(type) {
+    case string:
+        writeControl(buffer, typeString, len(v))
+        buffer.WriteString(v)
+    case uint32:
+        raw := []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+        for len(raw) > 0 && raw[0] == 0 {
+            raw = raw[1:]
+        }
+        writeControl(buffer, typeUint32, len(raw))
+        buffer.Write(raw)
+    case uint16:
+        writeControl(buffer, typeUint16, 2)
+        buffer.Write([]byte{byte(v >> 8), byte(v)})
+    case bool:
+        b := 0
+        if v {
+            b = 1
+        }
+        writeControl(buffer, typeBool, b)
+    case []any:
+        writeControl(buffer, typeArray, len(v))
+        for _, item := range v {
+            encodeData(buffer, item)
+        }
+    case map[string]any:
+        writeControl(buffer, typeMap, len(v))
+        keys := make([]string, 0, len(v))
+        for key := range v {
+            keys = append(keys, key)
+        }
+        sort.Strings(keys)
+        for _, key := range keys {
+            encodeData(buffer, key)
+            encodeData(buffer, v[key])
+        }
+    default:
+        panic("unsupported test type")
+    }
+}
+
+func writeControl(buffer *bytes.Buffer, kind, size int) {
+    var control byte
+    extended := kind > 7
+    if !extended {
+        control = byte(kind << 5)
+    }
+    switch {
+    case size < 29:
+        control |= byte(size)
+        buffer.WriteByte(control)
+        if extended {
+            buffer.WriteByte(byte(kind - 7))
+        }
+    default:
+        control |= 29
+        buffer.WriteByte(control)
+        if extended {
+            buffer.WriteByte(byte(kind - 7))
+        }
+        buffer.WriteByte(byte(size - 29))
+    }
+}
+
+func buildTestDatabase(entries map[string]map[string]any) []byte {
+    var data bytes.Buffer
+    root := &trieNode{data: -1}
+
+    prefixes := make([]string, 0, len(entries))
+    for prefix := range entries {
+        prefixes = append(prefixes, prefix)
+    }
+    sort.Strings(prefixes)
+
+    for _, text := range prefixes {
+        prefix := netip.MustParsePrefix(text)
+        offset := data.Len()
+        encodeData(&data, entries[text])
+
+        bits := prefix.Addr().AsSlice()
+        node := root
+        for i := 0; i < prefix.Bits(); i++ {
+            bit := (bits[i/8] >> (7 - uint(i%8))) & 1
+            if node.children[bit] == nil {
+                node.children[bit] = &trieNode{data: -1}
+            }
+            node = node.children[bit]
+        }
+        node.data = offset
+    }
+
+    var nodes []*trieNode
+    index := make(map[*trieNode]int)
+    queue := []*trieNode{root}
+    for len(queue) > 0 {
+        node := queue[0]
+        queue = queue[1:]
+        if node.data >= 0 {
+            continue
+        }
+        index[node] = len(nodes)
+        nodes = append(nodes, node)
+        for _, child := range node.children {
+            if child != nil {
+                queue = append(queue, child)
+            }
+        }
+    }
+
+    nodeCount := len(nodes)
+    var tree bytes.Buffer
+    for _, node := range nodes {
+        for _, child := range node.children {
+            record := nodeCount
+            if child != nil && child.data >= 0 {
+                record = nodeCount + 16 + child.data
+            } else if child != nil {
+                record = index[child]
+            }
+            tree.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+        }
+    }
+
+    var file bytes.Buffer
+    file.Write(tree.Bytes())
+    file.Write(make([]byte, 16))
+    file.Write(data.Bytes())
+    file.Write(metadataMarker)
+    encodeData(&file, map[string]any{
+        "node_count":    uint32(nodeCount),
+        "record_size":   uint16(24),
+        "ip_version":    uint16(4),
+        "database_type": "Test-Country",
+    })
+    return file.Bytes()
+}
+
+func countryRecord(country, continent string) map[string]any {
+    return map[string]any{
+        "country":   map[string]any{"iso_code": country, "names": map[string]any{"en": country}},
+        "continent": map[string]any{"code": continent},
+        "flags":     []any{true, uint32(70000)},
+    }
+}
+
+func TestReader_Lookup(t *testing.T) {
+    database := buildTestDatabase(map[string]map[string]any{
+        "82.0.0.0/8":     countryRecord("DE", "EU"),
+        "81.2.0.0/16":    countryRecord("GB", "EU"),
+        "203.0.113.0/24": countryRecord("AU", "OC"),
+    })
+
+    reader, err := NewReader(database)
+    if err != nil {
+        t.Fatalf("NewReader() error: %v", err)
+    }
+    if reader.Metadata["database_type"] != "Test-Country" {
+        t.Errorf("Unexpected metadata %v", reader.Metadata)
+    }
+
+    tests := []struct {
+        name     string
+        addr     string
+        expected string
+        found    bool
+    }{
+        {name: "/8", addr: "82.10.0.1", expected: "DE", found: true},
+        {name: "/16", addr: "81.2.69.160", expected: "GB", found: true},
+        {name: "sibling of /16", addr: "81.3.0.1", found: false},
+        {name: "/24", addr: "203.0.113.9", expected: "AU", found: true},
+        {name: "not in database", addr: "8.8.8.8", found: false},
+        {name: "ipv4-mapped ipv6", addr: "::ffff:81.2.1.1", expected: "GB", found: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            record, err := reader.Lookup(netip.MustParseAddr(tt.addr))
+            if !tt.found {
+                if err == nil {
+                    t.Errorf("Lookup() expected not found, got %v", record)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("Lookup() error: %v", err)
+            }
+            country := record["country"].(map[string]any)
+            if country["iso_code"] != tt.expected {
+                t.Errorf("iso_code = %v, expected %s", country["iso_code"], tt.expected)
+            }
+            flags := record["flags"].([]any)
+            if flags[0] != true || flags[1] != uint64(70000) {
+                t.Errorf("Unexpected flags %v", flags)
+            }
+        })
+    }
+}
+
+func TestNewReader_Invalid(t *testing.T) {
+    tests := []struct {
+        name     string
+        database []byte
+    }{
+        {name: "no metadata", database: []byte("not a database")},
+        {name: "truncated metadata", database: append(append([]byte{}, metadataMarker...), 0xe0)},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if _, err := NewReader(tt.database); err == nil {
+                t.Error("NewReader() expected error")
+            }
+        })
+    }
+}
+
+func TestDecoder_Pointer(t *testing.T) {
+    var data bytes.Buffer
+    encodeData(&data, "shared")
+    data.Write([]byte{0x20, 0x00})
+
+    decoder := &decoder{buffer: data.Bytes()}
+    value, next, err := decoder.decode(uint(len("shared") + 1))
+    if err != nil {
+        t.Fatalf("decode() error: %v", err)
+    }
+    if value != "shared" || next != uint(data.Len()) {
+        t.Errorf("decode() = %v, %d", value, next)
+    }
+}
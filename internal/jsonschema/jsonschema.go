@@ -0,0 +1,462 @@
+package jsonschema
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "math"
+    "net/url"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// Schema validates JSON values against a JSON Schema. It supports the
+// keywords that matter for checking request payloads: type, enum, const,
+// properties, required, additionalProperties, items, min/max items,
+// lengths, numeric bounds, pattern, allOf, anyOf, oneOf, not, and local
+// $refs ("#/$defs/...", "#/components/schemas/..."), plus OpenAPI 3.0's
+// nullable. Other keywords, such as format, are ignored.
+type Schema struct {
+    root     any
+    node     any
+    patterns map[string]*regexp.Regexp
+}
+
+// ValidationError locates a problem by JSON pointer into the payload.
+type ValidationError struct {
+    Path    string `json:"path"`
+    Message string `json:"message"`
+}
+
+func (err ValidationError) Error() string {
+    if err.Path == "" {
+        return err.Message
+    }
+    return err.Path + ": " + err.Message
+}
+
+// Compile parses a JSON Schema document.
+func Compile(data []byte) (*Schema, error) {
+    return CompileRef(data, "#")
+}
+
+// CompileRef compiles the schema at ref, a JSON pointer fragment such as
+// "#/components/schemas/Pet", within document; $refs inside it resolve
+// against the whole document.
+func CompileRef(document []byte, ref string) (*Schema, error) {
+    var root any
+    if err := json.Unmarshal(document, &root); err != nil {
+        return nil, fmt.Errorf("jsonschema: %w", err)
+    }
+    node, err := resolve(root, ref)
+    if err != nil {
+        return nil, err
+    }
+    schema := &Schema{root: root, node: node, patterns: make(map[string]*regexp.Regexp)}
+    if err := schema.check(node, make(map[string]bool), make(map[string]bool)); err != nil {
+        return nil, err
+    }
+    return schema, nil
+}
+
+// check resolves every $ref and compiles every pattern up front, so
+// validation cannot fail on the schema itself. acyclic collects the $refs
+// known not to lead back to themselves without descending into the value.
+func (schema *Schema) check(node any, seen, acyclic map[string]bool) error {
+    switch node := node.(type) {
+    case bool:
+        return nil
+    case map[string]any:
+        if err := schema.loops(node, make(map[string]bool), acyclic); err != nil {
+            return err
+        }
+        if ref, ok := node["$ref"].(string); ok {
+            if seen[ref] {
+                return nil
+            }
+            seen[ref] = true
+            target, err := resolve(schema.root, ref)
+            if err != nil {
+                return err
+            }
+            return schema.check(target, seen, acyclic)
+        }
+        if pattern, ok := node["pattern"].(string); ok {
+            compiled, err := regexp.Compile(pattern)
+            if err != nil {
+                return fmt.Errorf("jsonschema: invalid pattern %q: %w", pattern, err)
+            }
+            schema.patterns[pattern] = compiled
+        }
+        for _, keyword := range []string{"items", "additionalProperties", "not"} {
+            if child, ok := node[keyword]; ok {
+                if err := schema.check(child, seen, acyclic); err != nil {
+                    return err
+                }
+            }
+        }
+        if properties, ok := node["properties"].(map[string]any); ok {
+            for _, child := range properties {
+                if err := schema.check(child, seen, acyclic); err != nil {
+                    return err
+                }
+            }
+        }
+        for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+            children, _ := node[keyword].([]any)
+            for _, child := range children {
+                if err := schema.check(child, seen, acyclic); err != nil {
+                    return err
+                }
+            }
+        }
+        return nil
+    }
+    return fmt.Errorf("jsonschema: schema must be an object or a boolean, got %T", node)
+}
+
+// loops rejects $refs that reach themselves again through $ref, allOf,
+// anyOf, oneOf or not alone, such as {"$ref": "#"}: validating them would
+// recurse on the same value forever. Recursion through properties or items
+// is fine, since each step goes one level deeper into the value.
+func (schema *Schema) loops(node any, visiting, acyclic map[string]bool) error {
+    rules, ok := node.(map[string]any)
+    if !ok {
+        return nil
+    }
+    if ref, ok := rules["$ref"].(string); ok {
+        if visiting[ref] {
+            return fmt.Errorf("jsonschema: $ref %q refers back to itself", ref)
+        }
+        if acyclic[ref] {
+            return nil
+        }
+        target, err := resolve(schema.root, ref)
+        if err != nil {
+            return err
+        }
+        visiting[ref] = true
+        if err := schema.loops(target, visiting, acyclic); err != nil {
+            return err
+        }
+        delete(visiting, ref)
+        acyclic[ref] = true
+        return nil
+    }
+    if err := schema.loops(rules["not"], visiting, acyclic); err != nil {
+        return err
+    }
+    for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+        children, _ := rules[keyword].([]any)
+        for _, child := range children {
+            if err := schema.loops(child, visiting, acyclic); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+func resolve(root any, ref string) (any, error) {
+    pointer, ok := strings.CutPrefix(ref, "#")
+    if !ok {
+        return nil, fmt.Errorf("jsonschema: only local $refs are supported, got %q", ref)
+    }
+    if unescaped, err := url.PathUnescape(pointer); err == nil {
+        pointer = unescaped
+    }
+    node := root
+    if pointer == "" {
+        return node, nil
+    }
+    for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+        token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+        switch current := node.(type) {
+        case map[string]any:
+            next, ok := current[token]
+            if !ok {
+                return nil, fmt.Errorf("jsonschema: $ref %q not found", ref)
+            }
+            node = next
+        case []any:
+            index, err := strconv.Atoi(token)
+            if err != nil || index < 0 || index >= len(current) {
+                return nil, fmt.Errorf("jsonschema: $ref %q not found", ref)
+            }
+            node = current[index]
+        default:
+            return nil, fmt.Errorf("jsonschema: $ref %q not found", ref)
+        }
+    }
+    return node, nil
+}
+
+// Decode parses data as a single JSON value, keeping numbers exact.
+func Decode(data []byte) (any, error) {
+    decoder := json.NewDecoder(bytes.NewReader(data))
+    decoder.UseNumber()
+    var value any
+    if err := decoder.Decode(&value); err != nil {
+        return nil, err
+    }
+    if decoder.More() {
+        return nil, fmt.Errorf("unexpected data after the JSON value")
+    }
+    return value, nil
+}
+
+// Validate returns every way value, as returned by Decode, breaks the
+// schema, sorted by path.
+func (schema *Schema) Validate(value any) []ValidationError {
+    var errs []ValidationError
+    schema.validate(schema.node, value, "", &errs)
+    sort.SliceStable(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+    return errs
+}
+
+func (schema *Schema) valid(node, value any, path string) bool {
+    var errs []ValidationError
+    schema.validate(node, value, path, &errs)
+    return len(errs) == 0
+}
+
+func (schema *Schema) validate(node, value any, path string, errs *[]ValidationError) {
+    fail := func(format string, args ...any) {
+        *errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+    }
+
+    rules, ok := node.(map[string]any)
+    if !ok {
+        if allowed, _ := node.(bool); !allowed {
+            fail("no value is allowed here")
+        }
+        return
+    }
+    if ref, ok := rules["$ref"].(string); ok {
+        target, _ := resolve(schema.root, ref)
+        schema.validate(target, value, path, errs)
+        return
+    }
+
+    // OpenAPI 3.0 marks nullable values with a keyword instead of a type.
+    if nullable, _ := rules["nullable"].(bool); nullable && value == nil {
+        return
+    }
+    if types := typeList(rules["type"]); len(types) > 0 && !matchesType(types, value) {
+        fail("expected %s, got %s", strings.Join(types, " or "), typeOf(value))
+        return
+    }
+    if enum, ok := rules["enum"].([]any); ok && !containsValue(enum, value) {
+        fail("value is not one of the allowed values")
+    }
+    if constant, ok := rules["const"]; ok && !equal(constant, value) {
+        fail("value must be %v", constant)
+    }
+
+    switch value := value.(type) {
+    case map[string]any:
+        properties, _ := rules["properties"].(map[string]any)
+        required, _ := rules["required"].([]any)
+        for _, name := range required {
+            if name, ok := name.(string); ok {
+                if _, present := value[name]; !present {
+                    fail("missing required property %q", name)
+                }
+            }
+        }
+        names := make([]string, 0, len(value))
+        for name := range value {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        for _, name := range names {
+            child := path + "/" + strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+            if property, ok := properties[name]; ok {
+                schema.validate(property, value[name], child, errs)
+                continue
+            }
+            if additional, ok := rules["additionalProperties"]; ok {
+                if allowed, isBool := additional.(bool); isBool && !allowed {
+                    *errs = append(*errs, ValidationError{Path: child, Message: "property is not allowed"})
+                    continue
+                }
+                schema.validate(additional, value[name], child, errs)
+            }
+        }
+    case []any:
+        if limit, ok := number(rules["minItems"]); ok && float64(len(value)) < limit {
+            fail("expected at least %v items, got %d", limit, len(value))
+        }
+        if limit, ok := number(rules["maxItems"]); ok && float64(len(value)) > limit {
+            fail("expected at most %v items, got %d", limit, len(value))
+        }
+        if items, ok := rules["items"]; ok {
+            for i, item := range value {
+                schema.validate(items, item, path+"/"+strconv.Itoa(i), errs)
+            }
+        }
+    case string:
+        length := float64(utf8.RuneCountInString(value))
+        if limit, ok := number(rules["minLength"]); ok && length < limit {
+            fail("expected at least %v characters", limit)
+        }
+        if limit, ok := number(rules["maxLength"]); ok && length > limit {
+            fail("expected at most %v characters", limit)
+        }
+        if pattern, ok := rules["pattern"].(string); ok && !schema.patterns[pattern].MatchString(value) {
+            fail("value does not match pattern %q", pattern)
+        }
+    case json.Number:
+        n, _ := value.Float64()
+        if limit, ok := number(rules["minimum"]); ok && n < limit {
+            fail("must be at least %v", limit)
+        }
+        if limit, ok := number(rules["maximum"]); ok && n > limit {
+            fail("must be at most %v", limit)
+        }
+        if limit, ok := number(rules["exclusiveMinimum"]); ok && n <= limit {
+            fail("must be greater than %v", limit)
+        }
+        if limit, ok := number(rules["exclusiveMaximum"]); ok && n >= limit {
+            fail("must be less than %v", limit)
+        }
+    }
+
+    if all, ok := rules["allOf"].([]any); ok {
+        for _, child := range all {
+            schema.validate(child, value, path, errs)
+        }
+    }
+    if choices, ok := rules["anyOf"].([]any); ok {
+        matched := false
+        for _, child := range choices {
+            if schema.valid(child, value, path) {
+                matched = true
+                break
+            }
+        }
+        if !matched {
+            fail("value does not match any of the allowed schemas")
+        }
+    }
+    if choices, ok := rules["oneOf"].([]any); ok {
+        matched := 0
+        for _, child := range choices {
+            if schema.valid(child, value, path) {
+                matched++
+            }
+        }
+        if matched != 1 {
+            fail("value must match exactly one schema, matched %d", matched)
+        }
+    }
+    if not, ok := rules["not"]; ok && schema.valid(not, value, path) {
+        fail("value matches a schema it must not match")
+    }
+}
+
+func typeList(value any) []string {
+    switch value := value.(type) {
+    case string:
+        return []string{value}
+    case []any:
+        types := make([]string, 0, len(value))
+        for _, item := range value {
+            if name, ok := item.(string); ok {
+                types = append(types, name)
+            }
+        }
+        return types
+    }
+    return nil
+}
+
+func matchesType(types []string, value any) bool {
+    actual := typeOf(value)
+    for _, expected := range types {
+        if expected == actual || (expected == "number" && actual == "integer") {
+            return true
+        }
+    }
+    return false
+}
+
+func typeOf(value any) string {
+    switch value := value.(type) {
+    case nil:
+        return "null"
+    case bool:
+        return "boolean"
+    case string:
+        return "string"
+    case []any:
+        return "array"
+    case map[string]any:
+        return "object"
+    case json.Number:
+        if n, err := value.Float64(); err == nil && n == math.Trunc(n) && !math.IsInf(n, 0) {
+            return "integer"
+        }
+        return "number"
+    case float64:
+        if value == math.Trunc(value) {
+            return "integer"
+        }
+        return "number"
+    }
+    return fmt.Sprintf("%T", value)
+}
+
+// number reads a numeric keyword, which plain json.Unmarshal of the schema
+// leaves as float64.
+func number(value any) (float64, bool) {
+    n, ok := value.(float64)
+    return n, ok
+}
+
+func containsValue(values []any, value any) bool {
+    for _, candidate := range values {
+        if equal(candidate, value) {
+            return true
+        }
+    }
+    return false
+}
+
+// equal compares a schema value (float64 numbers) with a payload value
+// (json.Number numbers).
+func equal(expected, actual any) bool {
+    if number, ok := actual.(json.Number); ok {
+        n, err := number.Float64()
+        expectedNumber, isNumber := expected.(float64)
+        return err == nil && isNumber && n == expectedNumber
+    }
+    switch expected := expected.(type) {
+    case []any:
+        actual, ok := actual.([]any)
+        if !ok || len(actual) != len(expected) {
+            return false
+        }
+        for i := range expected {
+            if !equal(expected[i], actual[i]) {
+                return false
+            }
+        }
+        return true
+    case map[string]any:
+        actual, ok := actual.(map[string]any)
+        if !ok || len(actual) != len(expected) {
+            return false
+        }
+        for name, value := range expected {
+            if !equal(value, actual[name]) {
+                return false
+            }
+        }
+        return true
+    }
+    return expected == actual
+}
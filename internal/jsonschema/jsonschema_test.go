@@ -0,0 +1,176 @@
+package jsonschema
+
+import (
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strings"
+    "testing"
+
+    "load-balancer/internal/metrics"
+)
+
+const orderSchema = `{
+  "type": "object",
+  "required": ["id", "items"],
+  "additionalProperties": false,
+  "properties": {
+    "id": {"type": "string", "pattern": "^ord-[0-9]+$"},
+    "note": {"type": "string", "maxLength": 10, "nullable": true},
+    "priority": {"enum": ["low", "high"]},
+    "items": {"type": "array", "minItems": 1, "items": {"$ref": "#/$defs/item"}},
+    "payment": {"oneOf": [
+      {"type": "object", "required": ["card"]},
+      {"type": "object", "required": ["iban"]}
+    ]}
+  },
+  "$defs": {
+    "item": {
+      "type": "object",
+      "required": ["sku", "quantity"],
+      "properties": {
+        "sku": {"type": "string", "minLength": 1},
+        "quantity": {"type": "integer", "minimum": 1, "maximum": 100}
+      }
+    }
+  }
+}`
+
+func TestCompile_Errors(t *testing.T) {
+    tests := []struct {
+        name   string
+        schema string
+    }{
+        {name: "not json", schema: "{"},
+        {name: "not a schema", schema: `"string"`},
+        {name: "missing ref", schema: `{"properties": {"a": {"$ref": "#/$defs/missing"}}}`},
+        {name: "remote ref", schema: `{"$ref": "https://example.com/schema.json"}`},
+        {name: "bad pattern", schema: `{"pattern": "("}`},
+        {name: "self ref", schema: `{"$ref": "#"}`},
+        {name: "ref cycle", schema: `{"$ref": "#/$defs/a", "$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"$ref": "#/$defs/a"}}}`},
+        {name: "ref cycle through allOf", schema: `{"properties": {"x": {"$ref": "#/$defs/a"}}, "$defs": {"a": {"allOf": [{"not": {"$ref": "#/$defs/a"}}]}}}`},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if _, err := Compile([]byte(tt.schema)); err == nil {
+                t.Errorf("Expected an error")
+            }
+        })
+    }
+}
+
+func TestSchema_RecursiveRef(t *testing.T) {
+    schema, err := Compile([]byte(`{"$ref": "#/$defs/node", "$defs": {"node": {"type": "object", "properties": {"children": {"type": "array", "items": {"$ref": "#/$defs/node"}}}}}}`))
+    if err != nil {
+        t.Fatalf("Compile() error: %v", err)
+    }
+    value, _ := Decode([]byte(`{"children": [{"children": []}, {"children": [1]}]}`))
+    if errs := schema.Validate(value); len(errs) != 1 || errs[0].Path != "/children/1/children/0" {
+        t.Errorf("Expected one error at /children/1/children/0, got %v", errs)
+    }
+}
+
+func TestSchema_Validate(t *testing.T) {
+    schema, err := Compile([]byte(orderSchema))
+    if err != nil {
+        t.Fatalf("Compile() error: %v", err)
+    }
+
+    tests := []struct {
+        name     string
+        payload  string
+        expected []string
+    }{
+        {name: "valid", payload: `{"id": "ord-1", "items": [{"sku": "a", "quantity": 2}], "note": null, "payment": {"card": "4111"}}`},
+        {name: "wrong root type", payload: `[]`, expected: []string{": expected object, got array"}},
+        {name: "missing required", payload: `{"id": "ord-1"}`, expected: []string{`: missing required property "items"`}},
+        {name: "unknown property", payload: `{"id": "ord-1", "items": [{"sku": "a", "quantity": 1}], "extra": true}`, expected: []string{"/extra: property is not allowed"}},
+        {name: "pattern and enum", payload: `{"id": "order", "items": [{"sku": "a", "quantity": 1}], "priority": "urgent"}`, expected: []string{`/id: value does not match pattern "^ord-[0-9]+$"`, "/priority: value is not one of the allowed values"}},
+        {name: "nested ref", payload: `{"id": "ord-1", "items": [{"sku": "", "quantity": 1.5}, {"sku": "b", "quantity": 500}]}`, expected: []string{"/items/0/quantity: expected integer, got number", "/items/0/sku: expected at least 1 characters", "/items/1/quantity: must be at most 100"}},
+        {name: "empty array", payload: `{"id": "ord-1", "items": []}`, expected: []string{"/items: expected at least 1 items, got 0"}},
+        {name: "one of matches both", payload: `{"id": "ord-1", "items": [{"sku": "a", "quantity": 1}], "payment": {"card": "1", "iban": "2"}}`, expected: []string{"/payment: value must match exactly one schema, matched 2"}},
+        {name: "string length counts characters", payload: `{"id": "ord-1", "items": [{"sku": "a", "quantity": 1}], "note": "ééééééééééé"}`, expected: []string{"/note: expected at most 10 characters"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            value, err := Decode([]byte(tt.payload))
+            if err != nil {
+                t.Fatalf("Decode() error: %v", err)
+            }
+            var got []string
+            for _, err := range schema.Validate(value) {
+                got = append(got, err.Path+": "+err.Message)
+            }
+            if !reflect.DeepEqual(got, tt.expected) {
+                t.Errorf("Expected %q, got %q", tt.expected, got)
+            }
+        })
+    }
+}
+
+func TestMiddleware(t *testing.T) {
+    schema, _ := Compile([]byte(orderSchema))
+    registry := metrics.NewRegistry()
+    var forwarded string
+    handler := Middleware(Config{Name: "orders", Schema: schema, MaxBodyBytes: 256, Registry: registry})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        forwarded = string(body)
+    }))
+
+    valid := `{"id": "ord-1", "items": [{"sku": "a", "quantity": 1}]}`
+    tests := []struct {
+        name            string
+        contentType     string
+        body            string
+        expectedStatus  int
+        expectedError   string
+        expectedDetails int
+    }{
+        {name: "valid body is forwarded", contentType: "application/json", body: valid, expectedStatus: http.StatusOK},
+        {name: "json suffix media type", contentType: "application/vnd.orders+json; charset=utf-8", body: valid, expectedStatus: http.StatusOK},
+        {name: "no body", expectedStatus: http.StatusOK},
+        {name: "not json", contentType: "text/plain", body: valid, expectedStatus: http.StatusUnsupportedMediaType, expectedError: "request body must be JSON"},
+        {name: "malformed", contentType: "application/json", body: `{"id":`, expectedStatus: http.StatusBadRequest, expectedError: "request body is not valid JSON", expectedDetails: 1},
+        {name: "trailing data", contentType: "application/json", body: valid + `{}`, expectedStatus: http.StatusBadRequest, expectedError: "request body is not valid JSON", expectedDetails: 1},
+        {name: "invalid", contentType: "application/json", body: `{"id": 1}`, expectedStatus: http.StatusBadRequest, expectedError: "request body does not match the schema", expectedDetails: 2},
+        {name: "too large", contentType: "application/json", body: `{"id": "` + strings.Repeat("x", 300) + `"}`, expectedStatus: http.StatusRequestEntityTooLarge, expectedError: "request body is too large"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            forwarded = ""
+            request := httptest.NewRequest(http.MethodPost, "/orders", nil)
+            if tt.body != "" {
+                request = httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(tt.body))
+            }
+            request.Header.Set("Content-Type", tt.contentType)
+            rr := httptest.NewRecorder()
+            handler.ServeHTTP(rr, request)
+
+            if rr.Code != tt.expectedStatus {
+                t.Fatalf("Expected status %d, got %d (%s)", tt.expectedStatus, rr.Code, rr.Body.String())
+            }
+            if tt.expectedStatus == http.StatusOK {
+                if forwarded != tt.body {
+                    t.Errorf("Expected the body %q to be forwarded, got %q", tt.body, forwarded)
+                }
+                return
+            }
+            var response errorResponse
+            if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+                t.Fatalf("Expected a JSON error, got %q", rr.Body.String())
+            }
+            if response.Error != tt.expectedError || len(response.Details) != tt.expectedDetails {
+                t.Errorf("Expected %q with %d details, got %+v", tt.expectedError, tt.expectedDetails, response)
+            }
+        })
+    }
+
+    if invalid := registry.Counter("lb_schema_rejections_total", "", "schema", "orders", "reason", "invalid").Value(); invalid != 1 {
+        t.Errorf("Expected 1 invalid body, got %v", invalid)
+    }
+}
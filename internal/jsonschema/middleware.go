@@ -0,0 +1,114 @@
+package jsonschema
+
+import (
+    "bytes"
+    "encoding/json"
+    "io"
+    "mime"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "load-balancer/internal/metrics"
+)
+
+// maxDetails caps the validation errors returned to the client.
+const maxDetails = 20
+
+// Config validates request bodies on a route. Schema applies to every
+// request with a body; Lookup, when set, picks a schema per request instead
+// (such as the operation's schema in an OpenAPI spec), falling back to
+// Schema when it returns nil. Bodies over MaxBodyBytes (default 1MiB) are
+// refused without being parsed.
+type Config struct {
+    Name         string
+    Schema       *Schema
+    Lookup       func(request *http.Request) *Schema
+    MaxBodyBytes int64
+    Registry     *metrics.Registry
+}
+
+type errorResponse struct {
+    Error   string            `json:"error"`
+    Details []ValidationError `json:"details,omitempty"`
+}
+
+// Middleware rejects request bodies that are not JSON (415), too large
+// (413), malformed or not valid against the schema (400), answering with a
+// JSON error listing where the payload went wrong. Requests without a body
+// or without a schema pass through untouched.
+func Middleware(config Config) func(http.Handler) http.Handler {
+    if config.MaxBodyBytes <= 0 {
+        config.MaxBodyBytes = 1 << 20
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+
+    reject := func(writer http.ResponseWriter, status int, reason string, response errorResponse) {
+        config.Registry.Counter("lb_schema_rejections_total", "Request bodies rejected by schema validation.", "schema", config.Name, "reason", reason).Inc()
+        if len(response.Details) > maxDetails {
+            response.Details = response.Details[:maxDetails]
+        }
+        writer.Header().Set("Content-Type", "application/json")
+        writer.WriteHeader(status)
+        json.NewEncoder(writer).Encode(response)
+    }
+
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+            schema := config.Schema
+            if config.Lookup != nil {
+                if found := config.Lookup(request); found != nil {
+                    schema = found
+                }
+            }
+            if schema == nil || request.Body == nil || request.Body == http.NoBody {
+                next.ServeHTTP(writer, request)
+                return
+            }
+
+            if !isJSON(request.Header.Get("Content-Type")) {
+                reject(writer, http.StatusUnsupportedMediaType, "content_type", errorResponse{Error: "request body must be JSON"})
+                return
+            }
+            if request.ContentLength > config.MaxBodyBytes {
+                reject(writer, http.StatusRequestEntityTooLarge, "too_large", errorResponse{Error: "request body is too large"})
+                return
+            }
+            body, err := io.ReadAll(io.LimitReader(request.Body, config.MaxBodyBytes+1))
+            request.Body.Close()
+            if err != nil {
+                reject(writer, http.StatusBadRequest, "unreadable", errorResponse{Error: "request body could not be read"})
+                return
+            }
+            if int64(len(body)) > config.MaxBodyBytes {
+                reject(writer, http.StatusRequestEntityTooLarge, "too_large", errorResponse{Error: "request body is too large"})
+                return
+            }
+
+            value, err := Decode(body)
+            if err != nil {
+                reject(writer, http.StatusBadRequest, "malformed", errorResponse{Error: "request body is not valid JSON", Details: []ValidationError{{Message: err.Error()}}})
+                return
+            }
+            if errs := schema.Validate(value); len(errs) > 0 {
+                reject(writer, http.StatusBadRequest, "invalid", errorResponse{Error: "request body does not match the schema", Details: errs})
+                return
+            }
+
+            request.Body = io.NopCloser(bytes.NewReader(body))
+            request.ContentLength = int64(len(body))
+            request.Header.Set("Content-Length", strconv.Itoa(len(body)))
+            next.ServeHTTP(writer, request)
+        })
+    }
+}
+
+func isJSON(contentType string) bool {
+    mediaType, _, err := mime.ParseMediaType(contentType)
+    if err != nil {
+        return false
+    }
+    return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,352 @@
+package learn
+
+import (
+    "errors"
+    "log"
+    "math"
+    "math/rand"
+    "net"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/balancer"
+)
+
+// Config describes a learn mode session, which watches live traffic and
+// suggests the routes and timeouts to configure for it.
+//
+// Requests are grouped by host and the first PrefixDepth path segments
+// (default 1, so /api/v1/users counts towards /api/); the TopRoutes
+// (default 10) busiest groups become route candidates. A candidate seen at
+// least MinSamples times (default 20) gets a timeout of its p99 latency
+// times Headroom (default 3), rounded up to 100ms and no lower than
+// MinTimeout (default a second). MaxKeys (default 1000) bounds the hosts
+// and groups tracked; later ones are ignored.
+type Config struct {
+    Name        string
+    PrefixDepth int
+    TopRoutes   int
+    MinSamples  int
+    Headroom    float64
+    MinTimeout  time.Duration
+    MaxKeys     int
+}
+
+// maxSamples bounds the latencies kept per group; beyond it a uniform
+// sample is kept.
+const maxSamples = 1024
+
+// Latency summarizes the latencies observed for a route candidate.
+type Latency struct {
+    P50 time.Duration `json:"p50"`
+    P90 time.Duration `json:"p90"`
+    P99 time.Duration `json:"p99"`
+    Max time.Duration `json:"max"`
+}
+
+type HostSuggestion struct {
+    Host     string `json:"host"`
+    Requests int64  `json:"requests"`
+}
+
+// RouteSuggestion is a route candidate. Timeout is zero when too few
+// requests were seen to recommend one.
+type RouteSuggestion struct {
+    Name       string        `json:"name"`
+    Host       string        `json:"host,omitempty"`
+    PathPrefix string        `json:"path_prefix"`
+    Timeout    time.Duration `json:"timeout"`
+    Requests   int64         `json:"requests"`
+    Latency    Latency       `json:"latency"`
+}
+
+// Blueprint is the configuration suggested by what was observed between
+// Started and Ended.
+type Blueprint struct {
+    Started  time.Time         `json:"started"`
+    Ended    time.Time         `json:"ended"`
+    Requests int64             `json:"requests"`
+    Hosts    []HostSuggestion  `json:"hosts"`
+    Routes   []RouteSuggestion `json:"routes"`
+}
+
+type groupKey struct {
+    host   string
+    prefix string
+}
+
+type group struct {
+    requests int64
+    samples  []time.Duration
+}
+
+type Learner struct {
+    config Config
+
+    mux      sync.Mutex
+    started  time.Time
+    until    time.Time
+    stopped  time.Time
+    requests int64
+    hosts    map[string]int64
+    groups   map[groupKey]*group
+}
+
+func New(config Config) (*Learner, error) {
+    if config.Name == "" {
+        return nil, errors.New("learn: name is required")
+    }
+    if config.PrefixDepth <= 0 {
+        config.PrefixDepth = 1
+    }
+    if config.TopRoutes <= 0 {
+        config.TopRoutes = 10
+    }
+    if config.MinSamples <= 0 {
+        config.MinSamples = 20
+    }
+    if config.Headroom <= 0 {
+        config.Headroom = 3
+    }
+    if config.MinTimeout <= 0 {
+        config.MinTimeout = time.Second
+    }
+    if config.MaxKeys <= 0 {
+        config.MaxKeys = 1000
+    }
+    return &Learner{config: config, hosts: make(map[string]int64), groups: make(map[groupKey]*group)}, nil
+}
+
+// Start discards what was learned so far and observes traffic for
+// duration.
+func (learner *Learner) Start(duration time.Duration) {
+    now := time.Now()
+    learner.mux.Lock()
+    learner.started, learner.until, learner.stopped = now, now.Add(duration), time.Time{}
+    learner.requests = 0
+    learner.hosts = make(map[string]int64)
+    learner.groups = make(map[groupKey]*group)
+    learner.mux.Unlock()
+
+    log.Printf("learn %s: observing traffic for %s\n", learner.config.Name, duration)
+}
+
+// Stop ends observation early, keeping what was learned.
+func (learner *Learner) Stop() {
+    now := time.Now()
+    learner.mux.Lock()
+    if learner.learningLocked(now) {
+        learner.stopped = now
+    }
+    learner.mux.Unlock()
+}
+
+func (learner *Learner) Learning() bool {
+    learner.mux.Lock()
+    defer learner.mux.Unlock()
+
+    return learner.learningLocked(time.Now())
+}
+
+func (learner *Learner) learningLocked(now time.Time) bool {
+    return learner.stopped.IsZero() && now.Before(learner.until)
+}
+
+// Middleware observes the requests passing through while learning.
+func (learner *Learner) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        if !learner.Learning() {
+            next.ServeHTTP(writer, request)
+            return
+        }
+        start := time.Now()
+        next.ServeHTTP(writer, request)
+        learner.observe(hostname(request.Host), prefix(request.URL.Path, learner.config.PrefixDepth), time.Since(start), time.Now())
+    })
+}
+
+func (learner *Learner) observe(host, prefix string, elapsed time.Duration, now time.Time) {
+    learner.mux.Lock()
+    defer learner.mux.Unlock()
+
+    if !learner.learningLocked(now) {
+        return
+    }
+    learner.requests++
+    if _, ok := learner.hosts[host]; ok || len(learner.hosts) < learner.config.MaxKeys {
+        learner.hosts[host]++
+    }
+    key := groupKey{host: host, prefix: prefix}
+    current, ok := learner.groups[key]
+    if !ok {
+        if len(learner.groups) >= learner.config.MaxKeys {
+            return
+        }
+        current = &group{}
+        learner.groups[key] = current
+    }
+    current.requests++
+    if len(current.samples) < maxSamples {
+        current.samples = append(current.samples, elapsed)
+    } else if i := rand.Int63n(current.requests); i < maxSamples {
+        current.samples[i] = elapsed
+    }
+}
+
+// Blueprint returns the configuration suggested by the traffic observed so
+// far: hosts and route candidates busiest first.
+func (learner *Learner) Blueprint() Blueprint {
+    learner.mux.Lock()
+    blueprint := Blueprint{Started: learner.started, Ended: learner.until, Requests: learner.requests}
+    if !learner.stopped.IsZero() {
+        blueprint.Ended = learner.stopped
+    }
+    if now := time.Now(); now.Before(blueprint.Ended) {
+        blueprint.Ended = now
+    }
+    for host, requests := range learner.hosts {
+        blueprint.Hosts = append(blueprint.Hosts, HostSuggestion{Host: host, Requests: requests})
+    }
+    for key, current := range learner.groups {
+        suggestion := RouteSuggestion{
+            Host:       key.host,
+            PathPrefix: key.prefix,
+            Requests:   current.requests,
+            Latency:    summarize(current.samples),
+        }
+        if len(current.samples) >= learner.config.MinSamples {
+            suggestion.Timeout = learner.timeout(suggestion.Latency.P99)
+        }
+        blueprint.Routes = append(blueprint.Routes, suggestion)
+    }
+    learner.mux.Unlock()
+
+    sort.Slice(blueprint.Hosts, func(i, j int) bool {
+        if blueprint.Hosts[i].Requests != blueprint.Hosts[j].Requests {
+            return blueprint.Hosts[i].Requests > blueprint.Hosts[j].Requests
+        }
+        return blueprint.Hosts[i].Host < blueprint.Hosts[j].Host
+    })
+    sort.Slice(blueprint.Routes, func(i, j int) bool {
+        a, b := blueprint.Routes[i], blueprint.Routes[j]
+        if a.Requests != b.Requests {
+            return a.Requests > b.Requests
+        }
+        if a.Host != b.Host {
+            return a.Host < b.Host
+        }
+        return a.PathPrefix < b.PathPrefix
+    })
+    if len(blueprint.Routes) > learner.config.TopRoutes {
+        blueprint.Routes = blueprint.Routes[:learner.config.TopRoutes]
+    }
+    nameRoutes(blueprint.Routes, len(blueprint.Hosts) > 1)
+    return blueprint
+}
+
+func (learner *Learner) timeout(p99 time.Duration) time.Duration {
+    step := 100 * time.Millisecond
+    timeout := time.Duration(math.Ceil(float64(p99)*learner.config.Headroom/float64(step))) * step
+    return max(timeout, learner.config.MinTimeout)
+}
+
+func summarize(samples []time.Duration) Latency {
+    if len(samples) == 0 {
+        return Latency{}
+    }
+    sorted := append([]time.Duration(nil), samples...)
+    sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+    percentile := func(p float64) time.Duration {
+        return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+    }
+    return Latency{P50: percentile(0.5), P90: percentile(0.9), P99: percentile(0.99), Max: sorted[len(sorted)-1]}
+}
+
+// nameRoutes names each route after its prefix, adding the host when
+// several hosts were seen.
+func nameRoutes(routes []RouteSuggestion, byHost bool) {
+    for i := range routes {
+        name := strings.ReplaceAll(strings.Trim(routes[i].PathPrefix, "/"), "/", "-")
+        if name == "" {
+            name = "root"
+        }
+        if byHost && routes[i].Host != "" {
+            name = routes[i].Host + "-" + name
+        }
+        routes[i].Name = name
+    }
+}
+
+// BalancerRoutes turns the blueprint's route candidates into routes to
+// pool, most specific first so a host-specific route is matched before the
+// others.
+func (blueprint Blueprint) BalancerRoutes(pool string) []*balancer.Route {
+    routes := make([]*balancer.Route, 0, len(blueprint.Routes))
+    for _, suggestion := range blueprint.Routes {
+        routes = append(routes, &balancer.Route{
+            Name:       suggestion.Name,
+            Host:       suggestion.Host,
+            PathPrefix: suggestion.PathPrefix,
+            Pool:       pool,
+            Timeout:    suggestion.Timeout,
+        })
+    }
+    sort.SliceStable(routes, func(i, j int) bool {
+        if (routes[i].Host != "") != (routes[j].Host != "") {
+            return routes[i].Host != ""
+        }
+        return len(routes[i].PathPrefix) > len(routes[j].PathPrefix)
+    })
+    return routes
+}
+
+// Register lets operators start and stop learning and fetch the blueprint:
+// POST /admin/learn/<name>/start?duration=10m, POST .../stop and GET
+// .../blueprint.
+func (learner *Learner) Register(server *admin.Server) {
+    prefix := "/admin/learn/" + learner.config.Name
+    server.HandleFunc("POST "+prefix+"/start", func(writer http.ResponseWriter, request *http.Request) {
+        duration, err := time.ParseDuration(request.URL.Query().Get("duration"))
+        if err != nil || duration <= 0 {
+            admin.WriteError(writer, http.StatusBadRequest, "duration must be a positive duration such as 10m")
+            return
+        }
+        learner.Start(duration)
+        admin.WriteJSON(writer, http.StatusAccepted, map[string]any{"learning": true, "until": time.Now().Add(duration)})
+    })
+    server.HandleFunc("POST "+prefix+"/stop", func(writer http.ResponseWriter, request *http.Request) {
+        learner.Stop()
+        admin.WriteJSON(writer, http.StatusOK, learner.Blueprint())
+    })
+    server.HandleFunc("GET "+prefix+"/blueprint", func(writer http.ResponseWriter, request *http.Request) {
+        admin.WriteJSON(writer, http.StatusOK, learner.Blueprint())
+    })
+}
+
+// prefix returns the first depth segments of path as a directory prefix,
+// e.g. /api/ for /api/v1/users at depth 1. A path with no more segments
+// than depth, such as /login, falls under its parent.
+func prefix(path string, depth int) string {
+    segments := strings.Split(strings.Trim(path, "/"), "/")
+    if !strings.HasSuffix(path, "/") {
+        segments = segments[:len(segments)-1]
+    }
+    if len(segments) > depth {
+        segments = segments[:depth]
+    }
+    if len(segments) == 0 || segments[0] == "" {
+        return "/"
+    }
+    return "/" + strings.Join(segments, "/") + "/"
+}
+
+func hostname(host string) string {
+    if name, _, err := net.SplitHostPort(host); err == nil {
+        host = name
+    }
+    return strings.ToLower(host)
+}
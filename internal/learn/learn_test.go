@@ -0,0 +1,106 @@
+package learn
+
+import (
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "testing"
+    "time"
+)
+
+func TestPrefix(t *testing.T) {
+    tests := []struct {
+        path     string
+        depth    int
+        expected string
+    }{
+        {path: "/", depth: 1, expected: "/"},
+        {path: "/login", depth: 1, expected: "/"},
+        {path: "/api/v1/users", depth: 1, expected: "/api/"},
+        {path: "/api/v1/users", depth: 2, expected: "/api/v1/"},
+        {path: "/api/", depth: 2, expected: "/api/"},
+        {path: "/static/css/site.css", depth: 3, expected: "/static/css/"},
+    }
+
+    for _, tt := range tests {
+        if actual := prefix(tt.path, tt.depth); actual != tt.expected {
+            t.Errorf("Expected prefix(%q, %d) = %q, got %q", tt.path, tt.depth, tt.expected, actual)
+        }
+    }
+}
+
+func TestLearner_Blueprint(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    learner, _ := New(Config{Name: "site", TopRoutes: 2, MinSamples: 10})
+    learner.Start(time.Minute)
+
+    now := time.Now()
+    for i := 1; i <= 100; i++ {
+        learner.observe("api.example.com", "/v1/", time.Duration(i)*10*time.Millisecond, now)
+    }
+    for i := 0; i < 50; i++ {
+        learner.observe("www.example.com", "/static/", time.Millisecond, now)
+    }
+    for i := 0; i < 5; i++ {
+        learner.observe("www.example.com", "/", time.Millisecond, now)
+    }
+
+    blueprint := learner.Blueprint()
+    if blueprint.Requests != 155 || len(blueprint.Hosts) != 2 || blueprint.Hosts[0].Host != "api.example.com" || blueprint.Hosts[1].Requests != 55 {
+        t.Fatalf("Expected 155 requests over two hosts, got %+v", blueprint)
+    }
+    if len(blueprint.Routes) != 2 {
+        t.Fatalf("Expected the top 2 routes, got %+v", blueprint.Routes)
+    }
+
+    api := blueprint.Routes[0]
+    if api.Name != "api.example.com-v1" || api.PathPrefix != "/v1/" || api.Latency.P50 != 500*time.Millisecond || api.Latency.P99 != 990*time.Millisecond {
+        t.Errorf("Expected the /v1/ route with p50 500ms and p99 990ms, got %+v", api)
+    }
+    if api.Timeout != 3*time.Second {
+        t.Errorf("Expected a 3s timeout, got %s", api.Timeout)
+    }
+    if static := blueprint.Routes[1]; static.Timeout != time.Second {
+        t.Errorf("Expected the minimum timeout for fast routes, got %s", static.Timeout)
+    }
+
+    routes := blueprint.BalancerRoutes("web")
+    if len(routes) != 2 || routes[0].Pool != "web" || routes[0].PathPrefix != "/static/" {
+        t.Errorf("Expected routes to the web pool, most specific first, got %+v", routes)
+    }
+}
+
+func TestLearner_Middleware(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    learner, _ := New(Config{Name: "site"})
+    handler := learner.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+    serve := func() {
+        request := httptest.NewRequest("GET", "http://Example.com:8080/api/users", nil)
+        handler.ServeHTTP(httptest.NewRecorder(), request)
+    }
+
+    serve()
+    if requests := learner.Blueprint().Requests; requests != 0 {
+        t.Errorf("Expected nothing observed before learning starts, got %d", requests)
+    }
+
+    learner.Start(time.Minute)
+    serve()
+    serve()
+    learner.Stop()
+    serve()
+
+    blueprint := learner.Blueprint()
+    if blueprint.Requests != 2 || len(blueprint.Routes) != 1 || blueprint.Routes[0].Host != "example.com" || blueprint.Routes[0].PathPrefix != "/api/" {
+        t.Errorf("Expected 2 requests to example.com /api/, got %+v", blueprint)
+    }
+    if blueprint.Routes[0].Timeout != 0 {
+        t.Errorf("Expected no timeout from 2 samples, got %s", blueprint.Routes[0].Timeout)
+    }
+}
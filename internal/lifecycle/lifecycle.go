@@ -0,0 +1,87 @@
+package lifecycle
+
+import (
+    "log"
+    "net/http"
+
+    "load-balancer/internal/admin"
+)
+
+type Action int
+
+const (
+    Reload Action = iota + 1
+    Drain
+    Shutdown
+)
+
+func (action Action) String() string {
+    switch action {
+    case Reload:
+        return "reload"
+    case Drain:
+        return "drain"
+    case Shutdown:
+        return "shutdown"
+    }
+    return "unknown"
+}
+
+// Controller delivers lifecycle actions from whichever triggers the platform
+// offers: signals on Unix, console events and service control requests on
+// Windows, and the admin API everywhere.
+type Controller struct {
+    actions chan Action
+}
+
+func NewController() *Controller {
+    return &Controller{actions: make(chan Action, 8)}
+}
+
+func (controller *Controller) Actions() <-chan Action {
+    return controller.actions
+}
+
+// Trigger queues action, dropping it if earlier actions have not been
+// handled yet. Shutdown is never dropped.
+func (controller *Controller) Trigger(action Action) bool {
+    if action == Shutdown {
+        go func() { controller.actions <- action }()
+        return true
+    }
+    select {
+    case controller.actions <- action:
+        return true
+    default:
+        log.Printf("lifecycle: dropping %s, %d actions pending\n", action, len(controller.actions))
+        return false
+    }
+}
+
+// Register exposes reload and drain over the admin API, which is the only
+// way to trigger them on Windows outside of a service.
+func (controller *Controller) Register(server *admin.Server) {
+    for _, action := range []Action{Reload, Drain} {
+        server.HandleFunc("POST /admin/lifecycle/"+action.String(), func(writer http.ResponseWriter, request *http.Request) {
+            if !controller.Trigger(action) {
+                admin.WriteError(writer, http.StatusServiceUnavailable, "too many pending lifecycle actions")
+                return
+            }
+            admin.WriteJSON(writer, http.StatusAccepted, map[string]string{"action": action.String()})
+        })
+    }
+}
+
+// Run calls run with a controller fed by the platform's triggers. On Windows,
+// when the process was started by the service control manager, it runs as
+// the service called name and reports run's completion as the service
+// stopping.
+func Run(name string, run func(controller *Controller) error) error {
+    controller := NewController()
+    if ran, err := runService(name, controller, run); ran {
+        return err
+    }
+    stop := controller.notify()
+    defer stop()
+    return run(controller)
+}
@@ -0,0 +1,66 @@
+package lifecycle
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "load-balancer/internal/admin"
+)
+
+func TestController_Register(t *testing.T) {
+    controller := NewController()
+    server := admin.NewServer(nil)
+    controller.Register(server)
+
+    tests := []struct {
+        name         string
+        path         string
+        expectedCode int
+        expected     Action
+    }{
+        {name: "reload", path: "/admin/lifecycle/reload", expectedCode: http.StatusAccepted, expected: Reload},
+        {name: "drain", path: "/admin/lifecycle/drain", expectedCode: http.StatusAccepted, expected: Drain},
+        {name: "shutdown is not exposed", path: "/admin/lifecycle/shutdown", expectedCode: http.StatusNotFound},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rr := httptest.NewRecorder()
+            server.ServeHTTP(rr, httptest.NewRequest("POST", tt.path, nil))
+
+            if rr.Code != tt.expectedCode {
+                t.Fatalf("Expected status %d, got %d", tt.expectedCode, rr.Code)
+            }
+            if tt.expected == 0 {
+                return
+            }
+            if action := <-controller.Actions(); action != tt.expected {
+                t.Errorf("Expected %s, got %s", tt.expected, action)
+            }
+        })
+    }
+}
+
+func TestController_TriggerDropsWhenFull(t *testing.T) {
+    controller := NewController()
+    for i := 0; i < cap(controller.actions); i++ {
+        if !controller.Trigger(Reload) {
+            t.Fatalf("Expected trigger %d to be queued", i)
+        }
+    }
+
+    if controller.Trigger(Drain) {
+        t.Errorf("Expected drain to be dropped once the queue is full")
+    }
+    if !controller.Trigger(Shutdown) {
+        t.Errorf("Expected shutdown never to be dropped")
+    }
+
+    for i := 0; i < cap(controller.actions); i++ {
+        <-controller.Actions()
+    }
+    if action := <-controller.Actions(); action != Shutdown {
+        t.Errorf("Expected shutdown after queued reloads, got %s", action)
+    }
+}
@@ -0,0 +1,161 @@
+package lifecycle
+
+import (
+    "errors"
+    "runtime"
+    "sync"
+    "syscall"
+    "unsafe"
+)
+
+const (
+    serviceWin32OwnProcess = 0x10
+
+    serviceStopped      = 1
+    serviceStartPending = 2
+    serviceStopPending  = 3
+    serviceRunning      = 4
+
+    serviceAcceptStop        = 0x1
+    serviceAcceptShutdown    = 0x4
+    serviceAcceptParamChange = 0x8
+
+    serviceControlStop        = 1
+    serviceControlInterrogate = 4
+    serviceControlShutdown    = 5
+    serviceControlParamChange = 6
+
+    // ServiceControlDrain is the user-defined control code that drains the
+    // service without stopping it: sc control <name> 128.
+    ServiceControlDrain = 128
+
+    errorFailedServiceControllerConnect = syscall.Errno(1063)
+    errorCallNotImplemented             = 120
+)
+
+var (
+    advapi32                         = syscall.NewLazyDLL("advapi32.dll")
+    procStartServiceCtrlDispatcherW  = advapi32.NewProc("StartServiceCtrlDispatcherW")
+    procRegisterServiceCtrlHandlerEx = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+    procSetServiceStatus             = advapi32.NewProc("SetServiceStatus")
+)
+
+type serviceStatus struct {
+    serviceType             uint32
+    currentState            uint32
+    controlsAccepted        uint32
+    win32ExitCode           uint32
+    serviceSpecificExitCode uint32
+    checkPoint              uint32
+    waitHint                uint32
+}
+
+type serviceTableEntry struct {
+    name *uint16
+    proc uintptr
+}
+
+// service holds the state shared between the service main and control
+// handler callbacks, which the service control manager calls on its own
+// threads.
+type service struct {
+    name       *uint16
+    controller *Controller
+    run        func(*Controller) error
+
+    mux    sync.Mutex
+    handle uintptr
+    status serviceStatus
+    err    error
+}
+
+func (svc *service) setState(state uint32, exitCode uint32) {
+    svc.mux.Lock()
+    defer svc.mux.Unlock()
+
+    svc.status.currentState = state
+    svc.status.win32ExitCode = exitCode
+    svc.status.controlsAccepted = 0
+    if state == serviceRunning {
+        svc.status.controlsAccepted = serviceAcceptStop | serviceAcceptShutdown | serviceAcceptParamChange
+    }
+    svc.reportLocked()
+}
+
+func (svc *service) reportLocked() {
+    procSetServiceStatus.Call(svc.handle, uintptr(unsafe.Pointer(&svc.status)))
+}
+
+func (svc *service) handler(control, eventType, eventData, context uintptr) uintptr {
+    switch control {
+    case serviceControlStop, serviceControlShutdown:
+        svc.setState(serviceStopPending, 0)
+        svc.controller.Trigger(Shutdown)
+    case serviceControlParamChange:
+        svc.controller.Trigger(Reload)
+    case ServiceControlDrain:
+        svc.controller.Trigger(Drain)
+    case serviceControlInterrogate:
+        svc.mux.Lock()
+        svc.reportLocked()
+        svc.mux.Unlock()
+    default:
+        return errorCallNotImplemented
+    }
+    return 0
+}
+
+func (svc *service) main(argc, argv uintptr) uintptr {
+    handle, _, err := procRegisterServiceCtrlHandlerEx.Call(
+        uintptr(unsafe.Pointer(svc.name)),
+        syscall.NewCallback(svc.handler),
+        0,
+    )
+    if handle == 0 {
+        svc.err = err
+        return 0
+    }
+
+    svc.mux.Lock()
+    svc.handle = handle
+    svc.status.serviceType = serviceWin32OwnProcess
+    svc.mux.Unlock()
+    svc.setState(serviceStartPending, 0)
+    svc.setState(serviceRunning, 0)
+
+    svc.err = svc.run(svc.controller)
+
+    var exitCode uint32
+    if svc.err != nil {
+        exitCode = 1
+    }
+    svc.setState(serviceStopped, exitCode)
+    return 0
+}
+
+// runService connects to the service control manager. It reports false when
+// the process was not started as a service, so Run falls back to console
+// signals.
+func runService(name string, controller *Controller, run func(*Controller) error) (bool, error) {
+    utf16Name, err := syscall.UTF16PtrFromString(name)
+    if err != nil {
+        return false, err
+    }
+    svc := &service{name: utf16Name, controller: controller, run: run}
+    table := []serviceTableEntry{
+        {name: utf16Name, proc: syscall.NewCallback(svc.main)},
+        {},
+    }
+
+    runtime.LockOSThread()
+    defer runtime.UnlockOSThread()
+
+    ok, _, err := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0])))
+    if ok == 0 {
+        if errors.Is(err, errorFailedServiceControllerConnect) {
+            return false, nil
+        }
+        return true, err
+    }
+    return true, svc.err
+}
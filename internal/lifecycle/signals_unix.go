@@ -0,0 +1,44 @@
+//go:build !windows
+
+package lifecycle
+
+import (
+    "os"
+    "os/signal"
+    "syscall"
+)
+
+// notify maps SIGHUP to Reload, SIGUSR1 to Drain, and SIGINT and SIGTERM to
+// Shutdown.
+func (controller *Controller) notify() func() {
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGINT, syscall.SIGTERM)
+    done := make(chan struct{})
+
+    go func() {
+        for {
+            select {
+            case <-done:
+                return
+            case received := <-signals:
+                switch received {
+                case syscall.SIGHUP:
+                    controller.Trigger(Reload)
+                case syscall.SIGUSR1:
+                    controller.Trigger(Drain)
+                default:
+                    controller.Trigger(Shutdown)
+                }
+            }
+        }
+    }()
+
+    return func() {
+        signal.Stop(signals)
+        close(done)
+    }
+}
+
+func runService(name string, controller *Controller, run func(*Controller) error) (bool, error) {
+    return false, nil
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package lifecycle
+
+import (
+    "syscall"
+    "testing"
+)
+
+func TestRun_MapsSignals(t *testing.T) {
+    var handled []Action
+    err := Run("lb", func(controller *Controller) error {
+        for _, signal := range []syscall.Signal{syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGTERM} {
+            syscall.Kill(syscall.Getpid(), signal)
+            action := <-controller.Actions()
+            handled = append(handled, action)
+            if action == Shutdown {
+                return nil
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("Run() error: %v", err)
+    }
+
+    expected := []Action{Reload, Drain, Shutdown}
+    if len(handled) != len(expected) {
+        t.Fatalf("Expected %v, got %v", expected, handled)
+    }
+    for i := range expected {
+        if handled[i] != expected[i] {
+            t.Errorf("Expected %v, got %v", expected, handled)
+        }
+    }
+}
@@ -0,0 +1,32 @@
+package lifecycle
+
+import (
+    "os"
+    "os/signal"
+    "syscall"
+)
+
+// notify maps Ctrl+C, Ctrl+Break and console close events to Shutdown.
+// Windows has no SIGHUP or SIGUSR1, so reload and drain come from the admin
+// API or, when running as a service, from service control requests.
+func (controller *Controller) notify() func() {
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+    done := make(chan struct{})
+
+    go func() {
+        for {
+            select {
+            case <-done:
+                return
+            case <-signals:
+                controller.Trigger(Shutdown)
+            }
+        }
+    }()
+
+    return func() {
+        signal.Stop(signals)
+        close(done)
+    }
+}
@@ -0,0 +1,155 @@
+package lifecycle
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "net"
+    "net/http"
+    "os"
+    "sort"
+    "strconv"
+    "time"
+
+    "load-balancer/internal/metrics"
+)
+
+// Check reports why part of the process is unhealthy, or nil when it is
+// fine. It must give up when ctx is done.
+type Check func(ctx context.Context) error
+
+// WatchdogConfig describes the self-check behind systemd's watchdog. Every
+// Interval all Checks run, and the watchdog is only fed when every one of
+// them passes, so a wedged process misses its deadline and systemd
+// restarts it. Interval defaults to half of the unit's WatchdogSec.
+type WatchdogConfig struct {
+    Interval time.Duration
+    Checks   map[string]Check
+    Registry *metrics.Registry
+}
+
+// Notify sends state, such as READY=1, to the service manager over
+// $NOTIFY_SOCKET, doing nothing when the process was not started by one.
+func Notify(state string) error {
+    socket := os.Getenv("NOTIFY_SOCKET")
+    if socket == "" {
+        return nil
+    }
+    if socket[0] == '@' {
+        socket = "\x00" + socket[1:]
+    }
+    conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+    if err != nil {
+        return fmt.Errorf("sd_notify: %w", err)
+    }
+    defer conn.Close()
+    if _, err := conn.Write([]byte(state)); err != nil {
+        return fmt.Errorf("sd_notify: %w", err)
+    }
+    return nil
+}
+
+// WatchdogTimeout returns the unit's WatchdogSec, and whether the service
+// manager expects this process to feed the watchdog.
+func WatchdogTimeout() (time.Duration, bool) {
+    usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+    if err != nil || usec <= 0 {
+        return 0, false
+    }
+    if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+        return 0, false
+    }
+    return time.Duration(usec) * time.Microsecond, true
+}
+
+// RunWatchdog feeds systemd's watchdog until ctx is cancelled, as long as
+// the checks pass. It returns at once when the watchdog is not enabled.
+func RunWatchdog(ctx context.Context, config WatchdogConfig) {
+    timeout, ok := WatchdogTimeout()
+    if !ok {
+        return
+    }
+    if config.Interval <= 0 {
+        config.Interval = timeout / 2
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+    names := make([]string, 0, len(config.Checks))
+    for name := range config.Checks {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    ticker := time.NewTicker(config.Interval)
+    defer ticker.Stop()
+    for {
+        if err := selfCheck(ctx, config, names); err != nil {
+            log.Printf("watchdog: not feeding systemd: %v\n", err)
+        } else if err := Notify("WATCHDOG=1"); err != nil {
+            log.Printf("watchdog: %v\n", err)
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// selfCheck runs the checks in turn, each within the interval, so one
+// that hangs counts as a failure instead of stalling the watchdog.
+func selfCheck(ctx context.Context, config WatchdogConfig, names []string) error {
+    for _, name := range names {
+        checkCtx, cancel := context.WithTimeout(ctx, config.Interval)
+        err := config.Checks[name](checkCtx)
+        cancel()
+        if err != nil {
+            config.Registry.Counter("lb_watchdog_check_failures_total", "Self-checks that kept the systemd watchdog from being fed.", "check", name).Inc()
+            return fmt.Errorf("%s: %w", name, err)
+        }
+    }
+    return nil
+}
+
+// Responsive checks that the runtime still schedules goroutines within
+// max, catching a process starved by runaway goroutines or stuck in GC.
+func Responsive(max time.Duration) Check {
+    return func(ctx context.Context) error {
+        start := time.Now()
+        ran := make(chan time.Duration, 1)
+        go func() { ran <- time.Since(start) }()
+        select {
+        case delay := <-ran:
+            if delay > max {
+                return fmt.Errorf("goroutine took %s to run", delay.Round(time.Millisecond))
+            }
+            return nil
+        case <-ctx.Done():
+            return errors.New("goroutine never ran")
+        }
+    }
+}
+
+// Accepting checks that the HTTP listener at url accepts and answers a
+// request. Any response counts, even an error status: it proves the accept
+// loop and the server behind it are alive.
+func Accepting(url string) Check {
+    client := &http.Client{
+        CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+    }
+    return func(ctx context.Context) error {
+        request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+        if err != nil {
+            return err
+        }
+        response, err := client.Do(request)
+        if err != nil {
+            return err
+        }
+        response.Body.Close()
+        return nil
+    }
+}
@@ -0,0 +1,132 @@
+//go:build !windows
+
+package lifecycle
+
+import (
+    "context"
+    "errors"
+    "io"
+    "log"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strconv"
+    "testing"
+    "time"
+
+    "load-balancer/internal/metrics"
+)
+
+// listenNotify stands in for systemd's notification socket.
+func listenNotify(t *testing.T) *net.UnixConn {
+    t.Helper()
+
+    path := filepath.Join(t.TempDir(), "notify")
+    conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+    if err != nil {
+        t.Fatalf("listen: %v", err)
+    }
+    t.Cleanup(func() { conn.Close() })
+    t.Setenv("NOTIFY_SOCKET", path)
+    return conn
+}
+
+func receive(conn *net.UnixConn, wait time.Duration) string {
+    conn.SetReadDeadline(time.Now().Add(wait))
+    buf := make([]byte, 64)
+    n, err := conn.Read(buf)
+    if err != nil {
+        return ""
+    }
+    return string(buf[:n])
+}
+
+func TestNotify(t *testing.T) {
+    conn := listenNotify(t)
+    if err := Notify("READY=1"); err != nil {
+        t.Fatalf("Notify() error: %v", err)
+    }
+    if state := receive(conn, time.Second); state != "READY=1" {
+        t.Errorf("Expected READY=1, got %q", state)
+    }
+
+    t.Setenv("NOTIFY_SOCKET", "")
+    if err := Notify("READY=1"); err != nil {
+        t.Errorf("Expected no error without a service manager, got %v", err)
+    }
+}
+
+func TestWatchdogTimeout(t *testing.T) {
+    tests := []struct {
+        name            string
+        usec            string
+        pid             string
+        expectedTimeout time.Duration
+        expectedOK      bool
+    }{
+        {name: "disabled"},
+        {name: "enabled", usec: "30000000", expectedTimeout: 30 * time.Second, expectedOK: true},
+        {name: "for this process", usec: "1000000", pid: strconv.Itoa(os.Getpid()), expectedTimeout: time.Second, expectedOK: true},
+        {name: "for another process", usec: "1000000", pid: "1"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            t.Setenv("WATCHDOG_USEC", tt.usec)
+            t.Setenv("WATCHDOG_PID", tt.pid)
+            timeout, ok := WatchdogTimeout()
+            if timeout != tt.expectedTimeout || ok != tt.expectedOK {
+                t.Errorf("Expected %s %v, got %s %v", tt.expectedTimeout, tt.expectedOK, timeout, ok)
+            }
+        })
+    }
+}
+
+func TestRunWatchdog(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusServiceUnavailable)
+    }))
+    defer server.Close()
+
+    tests := []struct {
+        name     string
+        check    Check
+        expected string
+    }{
+        {name: "healthy", check: Accepting(server.URL), expected: "WATCHDOG=1"},
+        {name: "failing check", check: func(ctx context.Context) error { return errors.New("wedged") }},
+        {name: "hanging check", check: func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() }},
+        {name: "listener gone", check: Accepting("http://127.0.0.1:1")},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            conn := listenNotify(t)
+            t.Setenv("WATCHDOG_USEC", "200000")
+            registry := metrics.NewRegistry()
+
+            ctx, cancel := context.WithCancel(context.Background())
+            done := make(chan struct{})
+            go func() {
+                RunWatchdog(ctx, WatchdogConfig{Checks: map[string]Check{"loop": Responsive(50 * time.Millisecond), "self": tt.check}, Registry: registry})
+                close(done)
+            }()
+            state := receive(conn, 300*time.Millisecond)
+            cancel()
+            <-done
+
+            if state != tt.expected {
+                t.Errorf("Expected %q, got %q", tt.expected, state)
+            }
+            failures := registry.Counter("lb_watchdog_check_failures_total", "", "check", "self").Value()
+            if (tt.expected == "") != (failures > 0) {
+                t.Errorf("Expected failures counted only when unhealthy, got %v", failures)
+            }
+        })
+    }
+}
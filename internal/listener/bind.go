@@ -0,0 +1,147 @@
+package listener
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "net"
+)
+
+// Binding is one address a listener binds, so a listener can bind several
+// explicitly rather than one implicitly. Address is host:port: an IPv4
+// host such as 0.0.0.0 binds IPv4 only and an IPv6 host such as [::] IPv6
+// only, so both can be bound on the same port side by side, while an empty
+// host binds every address of both families on one socket, as a single
+// implicit bind does. Family ("ipv4" or "ipv6") restricts an empty host to
+// one family. With Interface set, Address gives only the port and the
+// binding opens a socket on each of the interface's addresses of Family.
+// Disabled bindings are skipped, so one can be switched off without
+// removing it.
+type Binding struct {
+    Address   string `json:"address"`
+    Interface string `json:"interface,omitempty"`
+    Family    string `json:"family,omitempty"`
+    Disabled  bool   `json:"disabled,omitempty"`
+}
+
+// Bind opens a listener for each address of the enabled bindings. It fails,
+// closing whatever it opened, if any address cannot be bound or if no
+// binding is enabled. Serve the listeners with ServeAll.
+func Bind(ctx context.Context, bindings []Binding) ([]net.Listener, error) {
+    var listeners []net.Listener
+    fail := func(err error) ([]net.Listener, error) {
+        for _, opened := range listeners {
+            opened.Close()
+        }
+        return nil, err
+    }
+
+    for _, binding := range bindings {
+        if binding.Disabled {
+            log.Printf("listener: binding %s disabled\n", binding)
+            continue
+        }
+        addresses, err := binding.resolve()
+        if err != nil {
+            return fail(err)
+        }
+        for _, address := range addresses {
+            listener, err := (&net.ListenConfig{}).Listen(ctx, address.network, address.address)
+            if err != nil {
+                return fail(err)
+            }
+            listeners = append(listeners, listener)
+        }
+    }
+    if len(listeners) == 0 {
+        return nil, errors.New("listener: no binding enabled")
+    }
+    return listeners, nil
+}
+
+func (binding Binding) String() string {
+    if binding.Interface != "" {
+        return binding.Interface + binding.Address
+    }
+    return binding.Address
+}
+
+type bindAddress struct {
+    network string
+    address string
+}
+
+// resolve turns the binding into the network and address of each socket
+// it needs.
+func (binding Binding) resolve() ([]bindAddress, error) {
+    host, port, err := net.SplitHostPort(binding.Address)
+    if err != nil {
+        return nil, fmt.Errorf("listener: binding %s: %w", binding, err)
+    }
+    network := "tcp"
+    switch binding.Family {
+    case "":
+    case "ipv4":
+        network = "tcp4"
+    case "ipv6":
+        network = "tcp6"
+    default:
+        return nil, fmt.Errorf("listener: binding %s: unknown family %q", binding, binding.Family)
+    }
+
+    if binding.Interface != "" {
+        if host != "" {
+            return nil, fmt.Errorf("listener: binding %s: an interface binding takes only a port", binding)
+        }
+        return interfaceAddresses(binding.Interface, network, port)
+    }
+
+    if ip := net.ParseIP(host); ip != nil {
+        literal := "tcp6"
+        if ip.To4() != nil {
+            literal = "tcp4"
+        }
+        if network != "tcp" && network != literal {
+            return nil, fmt.Errorf("listener: binding %s: address is not %s", binding, binding.Family)
+        }
+        network = literal
+    }
+    return []bindAddress{{network: network, address: binding.Address}}, nil
+}
+
+// interfaceAddresses lists the addresses of the named interface in network,
+// with port.
+func interfaceAddresses(name, network, port string) ([]bindAddress, error) {
+    iface, err := net.InterfaceByName(name)
+    if err != nil {
+        return nil, fmt.Errorf("listener: interface %s: %w", name, err)
+    }
+    addrs, err := iface.Addrs()
+    if err != nil {
+        return nil, fmt.Errorf("listener: interface %s: %w", name, err)
+    }
+
+    var addresses []bindAddress
+    for _, addr := range addrs {
+        ipNet, ok := addr.(*net.IPNet)
+        if !ok {
+            continue
+        }
+        host, family := ipNet.IP.String(), "tcp4"
+        if ipNet.IP.To4() == nil {
+            family = "tcp6"
+            if ipNet.IP.IsLinkLocalUnicast() {
+                host += "%" + name
+            }
+        }
+        if network != "tcp" && network != family {
+            continue
+        }
+        addresses = append(addresses, bindAddress{network: family, address: net.JoinHostPort(host, port)})
+    }
+    if len(addresses) == 0 {
+        return nil, fmt.Errorf("listener: interface %s has no addresses to bind", name)
+    }
+    return addresses, nil
+}
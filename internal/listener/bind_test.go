@@ -0,0 +1,108 @@
+package listener
+
+import (
+    "context"
+    "io"
+    "log"
+    "net"
+    "os"
+    "strconv"
+    "testing"
+)
+
+func TestBind(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    tests := []struct {
+        name     string
+        bindings []Binding
+        expected []string
+        wantErr  bool
+    }{
+        {name: "ipv4 literal", bindings: []Binding{{Address: "127.0.0.1:0"}}, expected: []string{"tcp4"}},
+        {name: "disabled skipped", bindings: []Binding{{Address: "127.0.0.1:0"}, {Address: "127.0.0.2:0", Disabled: true}}, expected: []string{"tcp4"}},
+        {name: "family restricts an empty host", bindings: []Binding{{Address: ":0", Family: "ipv4"}}, expected: []string{"tcp4"}},
+        {name: "all disabled", bindings: []Binding{{Address: "127.0.0.1:0", Disabled: true}}, wantErr: true},
+        {name: "family mismatch", bindings: []Binding{{Address: "127.0.0.1:0", Family: "ipv6"}}, wantErr: true},
+        {name: "unknown family", bindings: []Binding{{Address: ":0", Family: "ipx"}}, wantErr: true},
+        {name: "missing port", bindings: []Binding{{Address: "127.0.0.1"}}, wantErr: true},
+        {name: "interface with host", bindings: []Binding{{Address: "127.0.0.1:0", Interface: "lo"}}, wantErr: true},
+        {name: "unknown interface", bindings: []Binding{{Address: ":0", Interface: "nonexistent0"}}, wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            listeners, err := Bind(context.Background(), tt.bindings)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+            }
+            if len(listeners) != len(tt.expected) {
+                t.Fatalf("Expected %d listeners, got %d", len(tt.expected), len(listeners))
+            }
+            for i, listener := range listeners {
+                defer listener.Close()
+                if family := addressFamily(listener.Addr()); family != tt.expected[i] {
+                    t.Errorf("Expected listener %d on %s, got %s", i, tt.expected[i], family)
+                }
+            }
+        })
+    }
+}
+
+func TestBind_DualStack(t *testing.T) {
+    probe, err := net.Listen("tcp6", "[::1]:0")
+    if err != nil {
+        t.Skip("IPv6 is not available")
+    }
+    port := strconv.Itoa(probe.Addr().(*net.TCPAddr).Port)
+    probe.Close()
+
+    // Both families on the same port need the IPv6 socket to be IPv6 only.
+    listeners, err := Bind(context.Background(), []Binding{{Address: "0.0.0.0:" + port}, {Address: "[::]:" + port}})
+    if err != nil {
+        t.Fatalf("Bind() error: %v", err)
+    }
+    for _, listener := range listeners {
+        defer listener.Close()
+    }
+    for _, address := range []string{"127.0.0.1:" + port, "[::1]:" + port} {
+        conn, err := net.Dial("tcp", address)
+        if err != nil {
+            t.Errorf("Expected %s to accept connections, got %v", address, err)
+            continue
+        }
+        conn.Close()
+    }
+}
+
+func TestBind_Interface(t *testing.T) {
+    loopback := ""
+    interfaces, _ := net.Interfaces()
+    for _, iface := range interfaces {
+        if iface.Flags&net.FlagLoopback != 0 {
+            loopback = iface.Name
+        }
+    }
+    if loopback == "" {
+        t.Skip("no loopback interface")
+    }
+
+    listeners, err := Bind(context.Background(), []Binding{{Address: ":0", Interface: loopback, Family: "ipv4"}})
+    if err != nil {
+        t.Fatalf("Bind() error: %v", err)
+    }
+    for _, listener := range listeners {
+        defer listener.Close()
+        if !listener.Addr().(*net.TCPAddr).IP.IsLoopback() {
+            t.Errorf("Expected a loopback address, got %s", listener.Addr())
+        }
+    }
+}
+
+func addressFamily(addr net.Addr) string {
+    if addr.(*net.TCPAddr).IP.To4() != nil {
+        return "tcp4"
+    }
+    return "tcp6"
+}
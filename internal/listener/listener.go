@@ -0,0 +1,257 @@
+package listener
+
+import (
+    "context"
+    "crypto/tls"
+    "errors"
+    "io"
+    "log"
+    "net"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "load-balancer/internal/metrics"
+)
+
+const defaultHandshakeTimeout = 10 * time.Second
+
+// Listener counts the connections accepted from, and closed after leaving,
+// the wrapped listener. On Linux it also exports the kernel accept queue
+// length so a saturated accept loop shows up before clients time out.
+type Listener struct {
+    net.Listener
+
+    accepted     *metrics.Counter
+    closed       *metrics.Counter
+    acceptErrors *metrics.Counter
+    rejected     *metrics.Counter
+    open         *metrics.Gauge
+
+    active    atomic.Int64
+    max       atomic.Int64
+    reject    atomic.Int32
+    tls       bool
+    lingering chan struct{}
+}
+
+// Rejection is what a listener at its connection limit does with the
+// connections it cannot take.
+type Rejection int32
+
+const (
+    // RejectHTTP answers 503 with Retry-After and closes, for HTTP
+    // listeners. TLS listeners reset instead, since answering would take a
+    // handshake.
+    RejectHTTP Rejection = iota
+    // RejectReset closes with a TCP reset, for L4 listeners.
+    RejectReset
+)
+
+const (
+    maxLingering = 64
+    rejectLinger = 250 * time.Millisecond
+)
+
+const rejectResponse = "HTTP/1.1 503 Service Unavailable\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: 20\r\nRetry-After: 1\r\nConnection: close\r\n\r\nService Unavailable\n"
+
+func New(inner net.Listener, name string, registry *metrics.Registry) *Listener {
+    if registry == nil {
+        registry = metrics.Default
+    }
+    listener := &Listener{
+        Listener:     inner,
+        accepted:     registry.Counter("lb_listener_connections_accepted_total", "Connections accepted by the listener.", "listener", name),
+        closed:       registry.Counter("lb_listener_connections_closed_total", "Accepted connections that have been closed.", "listener", name),
+        acceptErrors: registry.Counter("lb_listener_accept_errors_total", "Errors returned by accept.", "listener", name),
+        rejected:     registry.Counter("lb_listener_connections_rejected_total", "Connections turned away because the listener was at its connection limit.", "listener", name),
+        open:         registry.Gauge("lb_listener_connections_open", "Accepted connections currently open.", "listener", name),
+        lingering:    make(chan struct{}, maxLingering),
+    }
+    if address, ok := inner.Addr().(*net.TCPAddr); ok && acceptQueueSupported {
+        registry.GaugeFunc("lb_listener_accept_queue_length", "Connections waiting in the kernel accept queue.", func() float64 {
+            return float64(acceptQueue(address.Port))
+        }, "listener", name)
+    }
+    return listener
+}
+
+// SetMaxConnections caps the connections open at once; zero removes the
+// cap. Connections arriving while the listener is at the cap are turned
+// away as reject says without reaching the server, so a flood cannot run
+// the process out of file descriptors.
+func (listener *Listener) SetMaxConnections(max int, reject Rejection) {
+    listener.reject.Store(int32(reject))
+    listener.max.Store(int64(max))
+}
+
+func (listener *Listener) Accept() (net.Conn, error) {
+    for {
+        conn, err := listener.Listener.Accept()
+        if err != nil {
+            if !errors.Is(err, net.ErrClosed) {
+                listener.acceptErrors.Inc()
+            }
+            return nil, err
+        }
+        if max := listener.max.Load(); max > 0 && listener.active.Load() >= max {
+            listener.turnAway(conn)
+            continue
+        }
+        listener.accepted.Inc()
+        listener.open.Add(1)
+        listener.active.Add(1)
+        return &trackedConn{Conn: conn, listener: listener}, nil
+    }
+}
+
+// turnAway rejects conn without blocking the accept loop. A 503 is written
+// and the request drained briefly before closing, since closing with the
+// request unread would reset the connection and could discard the response
+// before the client reads it. At most maxLingering rejected connections
+// are drained at once; beyond that they are reset too.
+func (listener *Listener) turnAway(conn net.Conn) {
+    listener.rejected.Inc()
+    tcpConn, _ := conn.(*net.TCPConn)
+    if Rejection(listener.reject.Load()) == RejectHTTP && !listener.tls && tcpConn != nil {
+        select {
+        case listener.lingering <- struct{}{}:
+            go func() {
+                defer func() { <-listener.lingering }()
+                conn.SetDeadline(time.Now().Add(rejectLinger))
+                io.WriteString(conn, rejectResponse)
+                tcpConn.CloseWrite()
+                io.Copy(io.Discard, io.LimitReader(conn, 64*1024))
+                conn.Close()
+            }()
+            return
+        default:
+        }
+    }
+    if tcpConn != nil {
+        tcpConn.SetLinger(0)
+    }
+    conn.Close()
+}
+
+type trackedConn struct {
+    net.Conn
+    listener *Listener
+    once     sync.Once
+}
+
+func (conn *trackedConn) Close() error {
+    conn.once.Do(func() {
+        conn.listener.closed.Inc()
+        conn.listener.open.Add(-1)
+        conn.listener.active.Add(-1)
+    })
+    return conn.Conn.Close()
+}
+
+type accepted struct {
+    conn net.Conn
+    err  error
+}
+
+// TLSListener completes TLS handshakes before Accept returns, so handshake
+// failures and latency are measured per listener and a slow handshake does
+// not hold up the connections behind it. Accept still returns *tls.Conn, so
+// net/http negotiates ALPN as it would with tls.NewListener.
+type TLSListener struct {
+    *Listener
+    config  *tls.Config
+    timeout time.Duration
+
+    failures *metrics.Counter
+    latency  *metrics.Histogram
+
+    ready     chan accepted
+    done      chan struct{}
+    closeOnce sync.Once
+}
+
+func NewTLS(inner net.Listener, config *tls.Config, name string, registry *metrics.Registry) *TLSListener {
+    if registry == nil {
+        registry = metrics.Default
+    }
+    listener := &TLSListener{
+        Listener: New(inner, name, registry),
+        config:   config,
+        timeout:  defaultHandshakeTimeout,
+        failures: registry.Counter("lb_listener_tls_handshake_failures_total", "TLS handshakes that failed or timed out.", "listener", name),
+        latency:  registry.Histogram("lb_listener_tls_handshake_seconds", "Time taken to complete TLS handshakes.", metrics.DefaultBuckets, "listener", name),
+        ready:    make(chan accepted),
+        done:     make(chan struct{}),
+    }
+    listener.Listener.tls = true
+    go listener.acceptLoop()
+    return listener
+}
+
+// acceptLoop backs off and tries again on every accept error but the
+// listener closing, as http.Server.Serve does: running out of file
+// descriptors is an error too, and must not stop the listener for good.
+func (listener *TLSListener) acceptLoop() {
+    var delay time.Duration
+    for {
+        conn, err := listener.Listener.Accept()
+        if err != nil {
+            if errors.Is(err, net.ErrClosed) {
+                select {
+                case listener.ready <- accepted{err: err}:
+                case <-listener.done:
+                }
+                return
+            }
+            delay = min(max(2*delay, 5*time.Millisecond), time.Second)
+            var netErr net.Error
+            if !errors.As(err, &netErr) || !netErr.Timeout() {
+                log.Printf("TLS listener accept error: %v; retrying in %s\n", err, delay)
+            }
+            select {
+            case <-time.After(delay):
+            case <-listener.done:
+                return
+            }
+            continue
+        }
+        delay = 0
+        go listener.handshake(conn)
+    }
+}
+
+func (listener *TLSListener) handshake(conn net.Conn) {
+    ctx, cancel := context.WithTimeout(context.Background(), listener.timeout)
+    defer cancel()
+
+    start := time.Now()
+    tlsConn := tls.Server(conn, listener.config)
+    if err := tlsConn.HandshakeContext(ctx); err != nil {
+        listener.failures.Inc()
+        log.Printf("%s TLS handshake failed: %v\n", conn.RemoteAddr(), err)
+        conn.Close()
+        return
+    }
+    listener.latency.Observe(time.Since(start).Seconds())
+
+    select {
+    case listener.ready <- accepted{conn: tlsConn}:
+    case <-listener.done:
+        tlsConn.Close()
+    }
+}
+
+func (listener *TLSListener) Accept() (net.Conn, error) {
+    select {
+    case result := <-listener.ready:
+        return result.conn, result.err
+    case <-listener.done:
+        return nil, net.ErrClosed
+    }
+}
+
+func (listener *TLSListener) Close() error {
+    listener.closeOnce.Do(func() { close(listener.done) })
+    return listener.Listener.Close()
+}
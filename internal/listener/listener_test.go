@@ -0,0 +1,261 @@
+package listener
+
+import (
+    "io"
+    "log"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "syscall"
+    "testing"
+    "time"
+
+    "load-balancer/internal/metrics"
+)
+
+func waitFor(t *testing.T, condition func() bool) {
+    t.Helper()
+
+    deadline := time.Now().Add(2 * time.Second)
+    for !condition() {
+        if time.Now().After(deadline) {
+            t.Fatal("Timed out waiting for condition")
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+}
+
+func TestListener_CountsConnections(t *testing.T) {
+    inner, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    registry := metrics.NewRegistry()
+    listener := New(inner, "web", registry)
+    defer listener.Close()
+
+    clients := make([]net.Conn, 3)
+    servers := make([]net.Conn, 3)
+    for i := range clients {
+        if clients[i], err = net.Dial("tcp", inner.Addr().String()); err != nil {
+            t.Fatal(err)
+        }
+        defer clients[i].Close()
+        if servers[i], err = listener.Accept(); err != nil {
+            t.Fatalf("Accept() error: %v", err)
+        }
+    }
+    servers[0].Close()
+    servers[0].Close()
+
+    tests := []struct {
+        name     string
+        value    float64
+        expected float64
+    }{
+        {name: "accepted", value: listener.accepted.Value(), expected: 3},
+        {name: "closed once", value: listener.closed.Value(), expected: 1},
+        {name: "open", value: listener.open.Value(), expected: 2},
+        {name: "no accept errors", value: listener.acceptErrors.Value(), expected: 0},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if tt.value != tt.expected {
+                t.Errorf("Expected %v, got %v", tt.expected, tt.value)
+            }
+        })
+    }
+
+    var builder strings.Builder
+    registry.WriteText(&builder)
+    if !strings.Contains(builder.String(), "lb_listener_connections_open{listener=\"web\"} 2\n") {
+        t.Errorf("Expected open connection gauge in output, got:\n%s", builder.String())
+    }
+    if acceptQueueSupported && !strings.Contains(builder.String(), "lb_listener_accept_queue_length{listener=\"web\"}") {
+        t.Errorf("Expected accept queue gauge in output, got:\n%s", builder.String())
+    }
+}
+
+func TestListener_MaxConnections(t *testing.T) {
+    tests := []struct {
+        name     string
+        reject   Rejection
+        expected string
+    }{
+        {name: "http listener answers 503", reject: RejectHTTP, expected: "HTTP/1.1 503 Service Unavailable"},
+        {name: "l4 listener resets", reject: RejectReset, expected: ""},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            inner, err := net.Listen("tcp", "127.0.0.1:0")
+            if err != nil {
+                t.Fatal(err)
+            }
+            listener := New(inner, "web", metrics.NewRegistry())
+            listener.SetMaxConnections(1, tt.reject)
+            defer listener.Close()
+
+            accepted := make(chan net.Conn, 2)
+            go func() {
+                for {
+                    conn, err := listener.Accept()
+                    if err != nil {
+                        return
+                    }
+                    accepted <- conn
+                }
+            }()
+
+            first, err := net.Dial("tcp", inner.Addr().String())
+            if err != nil {
+                t.Fatal(err)
+            }
+            defer first.Close()
+            held := <-accepted
+
+            second, err := net.Dial("tcp", inner.Addr().String())
+            if err != nil {
+                t.Fatal(err)
+            }
+            defer second.Close()
+            io.WriteString(second, "GET / HTTP/1.1\r\nHost: example\r\n\r\n")
+            second.SetReadDeadline(time.Now().Add(2 * time.Second))
+            response, err := io.ReadAll(second)
+            if !strings.HasPrefix(string(response), tt.expected) || (tt.expected == "" && len(response) > 0) {
+                t.Errorf("Expected a response starting %q, got %q (%v)", tt.expected, response, err)
+            }
+            if tt.reject == RejectReset && err == nil {
+                t.Errorf("Expected the connection to be reset")
+            }
+            waitFor(t, func() bool { return listener.rejected.Value() == 1 })
+
+            held.Close()
+            third, err := net.Dial("tcp", inner.Addr().String())
+            if err != nil {
+                t.Fatal(err)
+            }
+            defer third.Close()
+            select {
+            case <-accepted:
+            case <-time.After(2 * time.Second):
+                t.Fatal("Expected a connection to be accepted once one closed")
+            }
+            if listener.accepted.Value() != 2 {
+                t.Errorf("Expected 2 accepted connections, got %v", listener.accepted.Value())
+            }
+        })
+    }
+}
+
+func TestListener_AcceptQueue(t *testing.T) {
+    if !acceptQueueSupported {
+        t.Skip("accept queue is only reported on Linux")
+    }
+    inner, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer inner.Close()
+    port := inner.Addr().(*net.TCPAddr).Port
+
+    for i := 0; i < 2; i++ {
+        conn, err := net.Dial("tcp", inner.Addr().String())
+        if err != nil {
+            t.Fatal(err)
+        }
+        defer conn.Close()
+    }
+
+    waitFor(t, func() bool { return acceptQueue(port) == 2 })
+}
+
+func TestTLSListener(t *testing.T) {
+    reference := httptest.NewTLSServer(http.NotFoundHandler())
+    defer reference.Close()
+
+    inner, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    listener := NewTLS(inner, reference.TLS.Clone(), "web-tls", metrics.NewRegistry())
+    server := &http.Server{Handler: http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        io.WriteString(writer, request.Proto)
+    })}
+    go server.Serve(listener)
+    defer server.Close()
+
+    plain, err := net.Dial("tcp", inner.Addr().String())
+    if err != nil {
+        t.Fatal(err)
+    }
+    io.WriteString(plain, "GET / HTTP/1.1\r\nHost: example\r\n\r\n")
+    waitFor(t, func() bool { return listener.failures.Value() == 1 })
+    plain.Close()
+
+    response, err := reference.Client().Get("https://" + inner.Addr().String())
+    if err != nil {
+        t.Fatalf("GET error: %v", err)
+    }
+    body, _ := io.ReadAll(response.Body)
+    response.Body.Close()
+    if response.StatusCode != http.StatusOK {
+        t.Errorf("Expected 200, got %d (%s)", response.StatusCode, body)
+    }
+
+    if listener.latency.Count() != 1 {
+        t.Errorf("Expected one handshake observation, got %d", listener.latency.Count())
+    }
+    if listener.accepted.Value() != 2 {
+        t.Errorf("Expected 2 accepted connections, got %v", listener.accepted.Value())
+    }
+    waitFor(t, func() bool { return listener.closed.Value() == 1 })
+}
+
+// failingListener fails its first Accept calls with err before accepting
+// from the wrapped listener.
+type failingListener struct {
+    net.Listener
+    failures int
+    err      error
+}
+
+func (listener *failingListener) Accept() (net.Conn, error) {
+    if listener.failures > 0 {
+        listener.failures--
+        return nil, listener.err
+    }
+    return listener.Listener.Accept()
+}
+
+func TestTLSListener_RetriesAcceptErrors(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    reference := httptest.NewTLSServer(http.NotFoundHandler())
+    defer reference.Close()
+
+    inner, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    exhausted := &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.EMFILE)}
+    listener := NewTLS(&failingListener{Listener: inner, failures: 3, err: exhausted}, reference.TLS.Clone(), "web-tls", metrics.NewRegistry())
+    server := &http.Server{Handler: http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {})}
+    go server.Serve(listener)
+    defer server.Close()
+
+    client := reference.Client()
+    client.Timeout = 5 * time.Second
+    response, err := client.Get("https://" + inner.Addr().String())
+    if err != nil {
+        t.Fatalf("Expected the listener to keep serving after accept errors: %v", err)
+    }
+    response.Body.Close()
+    if errors := listener.acceptErrors.Value(); errors != 3 {
+        t.Errorf("Expected 3 accept errors counted, got %v", errors)
+    }
+}
@@ -0,0 +1,47 @@
+package listener
+
+import (
+    "bufio"
+    "os"
+    "strconv"
+    "strings"
+)
+
+const acceptQueueSupported = true
+
+// acceptQueue sums the accept queue lengths of the listening sockets bound
+// to port; for sockets in the LISTEN state the kernel reports queued
+// connections as rx_queue.
+func acceptQueue(port int) int {
+    length := 0
+    for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+        file, err := os.Open(path)
+        if err != nil {
+            continue
+        }
+        scanner := bufio.NewScanner(file)
+        scanner.Scan()
+        for scanner.Scan() {
+            fields := strings.Fields(scanner.Text())
+            if len(fields) < 5 || fields[3] != "0A" {
+                continue
+            }
+            _, localPort, ok := strings.Cut(fields[1], ":")
+            if !ok {
+                continue
+            }
+            if parsed, err := strconv.ParseUint(localPort, 16, 16); err != nil || int(parsed) != port {
+                continue
+            }
+            _, rx, ok := strings.Cut(fields[4], ":")
+            if !ok {
+                continue
+            }
+            if queued, err := strconv.ParseUint(rx, 16, 32); err == nil {
+                length += int(queued)
+            }
+        }
+        file.Close()
+    }
+    return length
+}
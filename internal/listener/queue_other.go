@@ -0,0 +1,9 @@
+//go:build !linux
+
+package listener
+
+const acceptQueueSupported = false
+
+func acceptQueue(port int) int {
+    return 0
+}
@@ -0,0 +1,65 @@
+package listener
+
+import (
+    "context"
+    "errors"
+    "net"
+    "net/http"
+    "strconv"
+)
+
+// ListenReusePort opens sockets listening on address with
+// SO_REUSEPORT set, so the kernel spreads incoming connections across them
+// and each can be served by its own acceptor. When address has port 0 the
+// remaining sockets bind to the port chosen for the first. A count of 1 or
+// less opens a single ordinary listener.
+func ListenReusePort(ctx context.Context, network, address string, sockets int) ([]net.Listener, error) {
+    if sockets <= 1 {
+        listener, err := (&net.ListenConfig{}).Listen(ctx, network, address)
+        if err != nil {
+            return nil, err
+        }
+        return []net.Listener{listener}, nil
+    }
+    if !reusePortSupported {
+        return nil, errors.New("SO_REUSEPORT is not supported on this platform")
+    }
+
+    config := &net.ListenConfig{Control: setReusePort}
+    listeners := make([]net.Listener, 0, sockets)
+    for i := 0; i < sockets; i++ {
+        listener, err := config.Listen(ctx, network, address)
+        if err != nil {
+            for _, opened := range listeners {
+                opened.Close()
+            }
+            return nil, err
+        }
+        if i == 0 {
+            if tcp, ok := listener.Addr().(*net.TCPAddr); ok {
+                host, _, _ := net.SplitHostPort(address)
+                address = net.JoinHostPort(host, strconv.Itoa(tcp.Port))
+            }
+        }
+        listeners = append(listeners, listener)
+    }
+    return listeners, nil
+}
+
+// ServeAll runs one server.Serve acceptor per listener and returns once all
+// of them have stopped, with the first error other than http.ErrServerClosed.
+func ServeAll(server *http.Server, listeners []net.Listener) error {
+    errs := make(chan error, len(listeners))
+    for _, listener := range listeners {
+        go func() { errs <- server.Serve(listener) }()
+    }
+
+    var first error
+    for range listeners {
+        if err := <-errs; err != nil && !errors.Is(err, http.ErrServerClosed) && first == nil {
+            first = err
+            server.Close()
+        }
+    }
+    return first
+}
@@ -0,0 +1,16 @@
+package listener
+
+import "syscall"
+
+const reusePortSupported = true
+
+func setReusePort(network, address string, conn syscall.RawConn) error {
+    var err error
+    control := conn.Control(func(fd uintptr) {
+        err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+    })
+    if control != nil {
+        return control
+    }
+    return err
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package listener
+
+import "syscall"
+
+const reusePortSupported = false
+
+func setReusePort(network, address string, conn syscall.RawConn) error {
+    return nil
+}
@@ -0,0 +1,68 @@
+package listener
+
+import (
+    "context"
+    "io"
+    "net"
+    "net/http"
+    "testing"
+)
+
+func TestListenReusePort(t *testing.T) {
+    if !reusePortSupported {
+        t.Skip("SO_REUSEPORT is only used on Linux")
+    }
+
+    listeners, err := ListenReusePort(context.Background(), "tcp", "127.0.0.1:0", 4)
+    if err != nil {
+        t.Fatalf("ListenReusePort() error: %v", err)
+    }
+    if len(listeners) != 4 {
+        t.Fatalf("Expected 4 listeners, got %d", len(listeners))
+    }
+    address := listeners[0].Addr().String()
+    for _, listener := range listeners[1:] {
+        if listener.Addr().String() != address {
+            t.Errorf("Expected all listeners on %s, got %s", address, listener.Addr())
+        }
+    }
+
+    server := &http.Server{Handler: http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        io.WriteString(writer, "ok")
+    })}
+    done := make(chan error)
+    go func() { done <- ServeAll(server, listeners) }()
+
+    client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+    for i := 0; i < 20; i++ {
+        response, err := client.Get("http://" + address)
+        if err != nil {
+            t.Fatalf("GET error: %v", err)
+        }
+        body, _ := io.ReadAll(response.Body)
+        response.Body.Close()
+        if string(body) != "ok" {
+            t.Errorf("Expected body ok, got %q", body)
+        }
+    }
+
+    server.Close()
+    if err := <-done; err != nil {
+        t.Errorf("ServeAll() error: %v", err)
+    }
+}
+
+func TestListenReusePort_SingleSocket(t *testing.T) {
+    listeners, err := ListenReusePort(context.Background(), "tcp", "127.0.0.1:0", 0)
+    if err != nil {
+        t.Fatalf("ListenReusePort() error: %v", err)
+    }
+    defer listeners[0].Close()
+
+    if len(listeners) != 1 {
+        t.Fatalf("Expected 1 listener, got %d", len(listeners))
+    }
+    if _, err := net.Listen("tcp", listeners[0].Addr().String()); err == nil {
+        t.Errorf("Expected a second plain listener on the same port to fail")
+    }
+}
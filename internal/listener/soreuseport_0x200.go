@@ -0,0 +1,7 @@
+//go:build linux && (mips || mipsle || mips64 || mips64le || sparc64)
+
+package listener
+
+// soReusePort is SO_REUSEPORT on the architectures that keep their own
+// socket.h rather than asm-generic's.
+const soReusePort = 0x200
@@ -0,0 +1,7 @@
+//go:build !mips && !mipsle && !mips64 && !mips64le && !sparc64
+
+package listener
+
+// soReusePort is SO_REUSEPORT from asm-generic/socket.h, which the syscall
+// package does not define for Linux.
+const soReusePort = 0xf
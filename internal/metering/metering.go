@@ -0,0 +1,244 @@
+package metering
+
+import (
+    "bytes"
+    "context"
+    "encoding/csv"
+    "encoding/json"
+    "io"
+    "log"
+    "net/http"
+    "sort"
+    "strconv"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/balancer"
+)
+
+type Record struct {
+    PeriodStart   time.Time `json:"period_start"`
+    PeriodEnd     time.Time `json:"period_end"`
+    Tenant        string    `json:"tenant"`
+    Route         string    `json:"route"`
+    Requests      uint64    `json:"requests"`
+    BytesIn       uint64    `json:"bytes_in"`
+    BytesOut      uint64    `json:"bytes_out"`
+    ComputeMillis int64     `json:"compute_ms"`
+
+    // compute is the exact sum behind ComputeMillis, so requests shorter
+    // than a millisecond still add up.
+    compute time.Duration
+}
+
+type Config struct {
+    Tenant     func(request *http.Request) string
+    Route      func(request *http.Request) string
+    Interval   time.Duration
+    WebhookURL string
+    Retain     int
+}
+
+type key struct {
+    tenant string
+    route  string
+}
+
+type Meter struct {
+    config Config
+    client *http.Client
+
+    mux         sync.Mutex
+    periodStart time.Time
+    current     map[key]*Record
+    records     []Record
+}
+
+func NewMeter(config Config) *Meter {
+    if config.Tenant == nil {
+        config.Tenant = func(request *http.Request) string { return "" }
+    }
+    if config.Route == nil {
+        config.Route = func(request *http.Request) string {
+            if route := balancer.RouteFromContext(request.Context()); route != nil {
+                return route.Name
+            }
+            return ""
+        }
+    }
+    if config.Interval <= 0 {
+        config.Interval = time.Hour
+    }
+    if config.Retain <= 0 {
+        config.Retain = 10000
+    }
+
+    return &Meter{
+        config:      config,
+        client:      &http.Client{Timeout: 10 * time.Second},
+        periodStart: time.Now(),
+        current:     make(map[key]*Record),
+    }
+}
+
+func (meter *Meter) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        start := time.Now()
+        var bytesIn atomic.Uint64
+        if request.Body != nil && request.Body != http.NoBody {
+            request.Body = &countingBody{ReadCloser: request.Body, count: &bytesIn}
+        }
+        counter := &countingWriter{ResponseWriter: writer}
+
+        next.ServeHTTP(counter, request)
+
+        meter.add(key{tenant: meter.config.Tenant(request), route: meter.config.Route(request)}, bytesIn.Load(), counter.count, time.Since(start))
+    })
+}
+
+func (meter *Meter) add(k key, bytesIn, bytesOut uint64, elapsed time.Duration) {
+    meter.mux.Lock()
+    defer meter.mux.Unlock()
+
+    record, ok := meter.current[k]
+    if !ok {
+        record = &Record{Tenant: k.tenant, Route: k.route}
+        meter.current[k] = record
+    }
+    record.Requests++
+    record.BytesIn += bytesIn
+    record.BytesOut += bytesOut
+    record.compute += elapsed
+}
+
+func (meter *Meter) Flush(now time.Time) []Record {
+    meter.mux.Lock()
+    closed := make([]Record, 0, len(meter.current))
+    for _, record := range meter.current {
+        record.PeriodStart = meter.periodStart
+        record.PeriodEnd = now
+        record.ComputeMillis = record.compute.Milliseconds()
+        closed = append(closed, *record)
+    }
+    sort.Slice(closed, func(i, j int) bool {
+        if closed[i].Tenant != closed[j].Tenant {
+            return closed[i].Tenant < closed[j].Tenant
+        }
+        return closed[i].Route < closed[j].Route
+    })
+
+    meter.current = make(map[key]*Record)
+    meter.periodStart = now
+    meter.records = append(meter.records, closed...)
+    if overflow := len(meter.records) - meter.config.Retain; overflow > 0 {
+        meter.records = append([]Record(nil), meter.records[overflow:]...)
+    }
+    meter.mux.Unlock()
+
+    if len(closed) > 0 {
+        meter.push(closed)
+    }
+    return closed
+}
+
+func (meter *Meter) Records() []Record {
+    meter.mux.Lock()
+    defer meter.mux.Unlock()
+
+    return append([]Record(nil), meter.records...)
+}
+
+func (meter *Meter) Run(ctx context.Context) {
+    ticker := time.NewTicker(meter.config.Interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            meter.Flush(time.Now())
+            return
+        case now := <-ticker.C:
+            meter.Flush(now)
+        }
+    }
+}
+
+func (meter *Meter) Register(server *admin.Server) {
+    server.HandleFunc("GET /admin/usage", func(writer http.ResponseWriter, request *http.Request) {
+        records := meter.Records()
+        if request.URL.Query().Get("format") == "csv" {
+            writer.Header().Set("Content-Type", "text/csv")
+            WriteCSV(writer, records)
+            return
+        }
+        admin.WriteJSON(writer, http.StatusOK, records)
+    })
+}
+
+func (meter *Meter) push(records []Record) {
+    if meter.config.WebhookURL == "" {
+        return
+    }
+
+    body, err := json.Marshal(records)
+    if err != nil {
+        log.Printf("metering webhook: %v\n", err)
+        return
+    }
+    resp, err := meter.client.Post(meter.config.WebhookURL, "application/json", bytes.NewReader(body))
+    if err != nil {
+        log.Printf("metering webhook: %v\n", err)
+        return
+    }
+    resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        log.Printf("metering webhook: unexpected status %d\n", resp.StatusCode)
+    }
+}
+
+func WriteCSV(writer io.Writer, records []Record) error {
+    out := csv.NewWriter(writer)
+    out.Write([]string{"period_start", "period_end", "tenant", "route", "requests", "bytes_in", "bytes_out", "compute_ms"})
+    for _, record := range records {
+        out.Write([]string{
+            record.PeriodStart.UTC().Format(time.RFC3339),
+            record.PeriodEnd.UTC().Format(time.RFC3339),
+            record.Tenant,
+            record.Route,
+            strconv.FormatUint(record.Requests, 10),
+            strconv.FormatUint(record.BytesIn, 10),
+            strconv.FormatUint(record.BytesOut, 10),
+            strconv.FormatInt(record.ComputeMillis, 10),
+        })
+    }
+    out.Flush()
+    return out.Error()
+}
+
+type countingBody struct {
+    io.ReadCloser
+    count *atomic.Uint64
+}
+
+func (body *countingBody) Read(p []byte) (int, error) {
+    n, err := body.ReadCloser.Read(p)
+    body.count.Add(uint64(n))
+    return n, err
+}
+
+type countingWriter struct {
+    http.ResponseWriter
+    count uint64
+}
+
+func (writer *countingWriter) Write(p []byte) (int, error) {
+    n, err := writer.ResponseWriter.Write(p)
+    writer.count += uint64(n)
+    return n, err
+}
+
+func (writer *countingWriter) Unwrap() http.ResponseWriter {
+    return writer.ResponseWriter
+}
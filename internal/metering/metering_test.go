@@ -0,0 +1,164 @@
+package metering
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "load-balancer/internal/admin"
+)
+
+func newTestMeter(webhook string) *Meter {
+    return NewMeter(Config{
+        Tenant:     func(r *http.Request) string { return r.Header.Get("X-Tenant") },
+        Route:      func(r *http.Request) string { return strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")[0] },
+        WebhookURL: webhook,
+    })
+}
+
+func TestMeter_SumsSubMillisecondRequests(t *testing.T) {
+    meter := newTestMeter("")
+    for i := 0; i < 10; i++ {
+        meter.add(key{tenant: "acme", route: "orders"}, 0, 0, 300*time.Microsecond)
+    }
+
+    records := meter.Flush(time.Now())
+    if len(records) != 1 || records[0].ComputeMillis != 3 {
+        t.Errorf("Expected 3ms of compute from ten 300µs requests, got %+v", records)
+    }
+}
+
+func TestMeter_Aggregation(t *testing.T) {
+    meter := newTestMeter("")
+    handler := meter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        buf := make([]byte, 64)
+        r.Body.Read(buf)
+        w.Write([]byte("0123456789"))
+    }))
+
+    requests := []struct {
+        tenant string
+        path   string
+        body   string
+    }{
+        {tenant: "acme", path: "/orders/1", body: "abc"},
+        {tenant: "acme", path: "/orders/2", body: "abcde"},
+        {tenant: "acme", path: "/search", body: ""},
+        {tenant: "globex", path: "/orders/3", body: "x"},
+    }
+    for _, r := range requests {
+        req := httptest.NewRequest("POST", r.path, strings.NewReader(r.body))
+        req.Header.Set("X-Tenant", r.tenant)
+        handler.ServeHTTP(httptest.NewRecorder(), req)
+    }
+
+    end := time.Now()
+    records := meter.Flush(end)
+
+    tests := []struct {
+        tenant   string
+        route    string
+        requests uint64
+        bytesIn  uint64
+        bytesOut uint64
+    }{
+        {tenant: "acme", route: "orders", requests: 2, bytesIn: 8, bytesOut: 20},
+        {tenant: "acme", route: "search", requests: 1, bytesIn: 0, bytesOut: 10},
+        {tenant: "globex", route: "orders", requests: 1, bytesIn: 1, bytesOut: 10},
+    }
+
+    if len(records) != len(tests) {
+        t.Fatalf("Expected %d records, got %d: %+v", len(tests), len(records), records)
+    }
+    for i, tt := range tests {
+        t.Run(tt.tenant+"/"+tt.route, func(t *testing.T) {
+            record := records[i]
+            if record.Tenant != tt.tenant || record.Route != tt.route {
+                t.Fatalf("Unexpected record key %s/%s", record.Tenant, record.Route)
+            }
+            if record.Requests != tt.requests || record.BytesIn != tt.bytesIn || record.BytesOut != tt.bytesOut {
+                t.Errorf("Unexpected record %+v", record)
+            }
+            if !record.PeriodEnd.Equal(end) || record.PeriodStart.After(end) {
+                t.Errorf("Unexpected period %v - %v", record.PeriodStart, record.PeriodEnd)
+            }
+        })
+    }
+
+    if next := meter.Flush(time.Now()); len(next) != 0 {
+        t.Errorf("Expected empty period after flush, got %d records", len(next))
+    }
+    if len(meter.Records()) != 3 {
+        t.Errorf("Expected 3 retained records, got %d", len(meter.Records()))
+    }
+}
+
+func TestMeter_Webhook(t *testing.T) {
+    var mux sync.Mutex
+    var pushed []Record
+    webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        mux.Lock()
+        defer mux.Unlock()
+        json.NewDecoder(r.Body).Decode(&pushed)
+    }))
+    defer webhook.Close()
+
+    meter := newTestMeter(webhook.URL)
+    meter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+        ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/orders", nil))
+    meter.Flush(time.Now())
+
+    mux.Lock()
+    defer mux.Unlock()
+    if len(pushed) != 1 || pushed[0].Route != "orders" {
+        t.Errorf("Unexpected webhook payload %+v", pushed)
+    }
+}
+
+func TestMeter_Register(t *testing.T) {
+    meter := newTestMeter("")
+    meter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+        ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/orders", nil))
+    meter.Flush(time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC))
+
+    server := admin.NewServer(nil)
+    meter.Register(server)
+
+    tests := []struct {
+        name        string
+        target      string
+        contentType string
+        expected    string
+    }{
+        {
+            name:        "json",
+            target:      "/admin/usage",
+            contentType: "application/json",
+            expected:    `"route":"orders"`,
+        },
+        {
+            name:        "csv",
+            target:      "/admin/usage?format=csv",
+            contentType: "text/csv",
+            expected:    "period_start,period_end,tenant,route,requests,bytes_in,bytes_out,compute_ms\n",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rr := httptest.NewRecorder()
+            server.ServeHTTP(rr, httptest.NewRequest("GET", tt.target, nil))
+
+            if rr.Header().Get("Content-Type") != tt.contentType {
+                t.Errorf("Content-Type = %q, expected %q", rr.Header().Get("Content-Type"), tt.contentType)
+            }
+            if !strings.Contains(rr.Body.String(), tt.expected) {
+                t.Errorf("Expected body to contain %q, got %q", tt.expected, rr.Body.String())
+            }
+        })
+    }
+}
@@ -0,0 +1,249 @@
+package metrics
+
+import (
+    "fmt"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+)
+
+const (
+    kindCounter   = "counter"
+    kindGauge     = "gauge"
+    kindHistogram = "histogram"
+)
+
+// DefaultBuckets suit latencies measured in seconds, from 5ms to 10s.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type Registry struct {
+    mux      sync.RWMutex
+    families map[string]*family
+}
+
+type family struct {
+    name   string
+    help   string
+    kind   string
+    series map[string]*series
+}
+
+type series struct {
+    labels  string
+    value   atomic.Uint64
+    fn      func() float64
+    buckets []float64
+    counts  []atomic.Uint64
+    count   atomic.Uint64
+}
+
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+    return &Registry{families: make(map[string]*family)}
+}
+
+type Counter struct{ series *series }
+type Gauge struct{ series *series }
+type Histogram struct{ series *series }
+
+func (registry *Registry) Counter(name, help string, labels ...string) *Counter {
+    return &Counter{registry.lookup(name, help, kindCounter, labels, nil, nil)}
+}
+
+func (registry *Registry) Gauge(name, help string, labels ...string) *Gauge {
+    return &Gauge{registry.lookup(name, help, kindGauge, labels, nil, nil)}
+}
+
+func (registry *Registry) GaugeFunc(name, help string, fn func() float64, labels ...string) {
+    registry.lookup(name, help, kindGauge, labels, fn, nil)
+}
+
+// Histogram returns the series for name and labels, using buckets (sorted
+// upper bounds) when the series is first created.
+func (registry *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+    return &Histogram{registry.lookup(name, help, kindHistogram, labels, nil, buckets)}
+}
+
+func (counter *Counter) Inc() {
+    counter.Add(1)
+}
+
+func (counter *Counter) Add(delta float64) {
+    if delta < 0 {
+        return
+    }
+    counter.series.add(delta)
+}
+
+func (counter *Counter) Value() float64 {
+    return counter.series.load()
+}
+
+func (gauge *Gauge) Set(value float64) {
+    gauge.series.value.Store(math.Float64bits(value))
+}
+
+func (gauge *Gauge) Add(delta float64) {
+    gauge.series.add(delta)
+}
+
+func (gauge *Gauge) Value() float64 {
+    return gauge.series.load()
+}
+
+func (histogram *Histogram) Observe(value float64) {
+    s := histogram.series
+    for i, bound := range s.buckets {
+        if value <= bound {
+            s.counts[i].Add(1)
+        }
+    }
+    s.count.Add(1)
+    s.add(value)
+}
+
+func (histogram *Histogram) Count() uint64 {
+    return histogram.series.count.Load()
+}
+
+func (histogram *Histogram) Sum() float64 {
+    return histogram.series.load()
+}
+
+func (s *series) add(delta float64) {
+    for {
+        old := s.value.Load()
+        next := math.Float64bits(math.Float64frombits(old) + delta)
+        if s.value.CompareAndSwap(old, next) {
+            return
+        }
+    }
+}
+
+func (s *series) load() float64 {
+    if s.fn != nil {
+        return s.fn()
+    }
+    return math.Float64frombits(s.value.Load())
+}
+
+// lookup returns the series for name and labels, creating it when needed.
+// A new histogram series gets its buckets before it is registered, so a
+// concurrent scrape never sees it half built.
+func (registry *Registry) lookup(name, help, kind string, labels []string, fn func() float64, buckets []float64) *series {
+    if len(labels)%2 != 0 {
+        panic(fmt.Sprintf("metrics: odd number of label arguments for %s", name))
+    }
+    key := formatLabels(labels)
+
+    registry.mux.Lock()
+    defer registry.mux.Unlock()
+
+    fam, ok := registry.families[name]
+    if !ok {
+        fam = &family{name: name, help: help, kind: kind, series: make(map[string]*series)}
+        registry.families[name] = fam
+    } else if fam.kind != kind {
+        panic(fmt.Sprintf("metrics: %s registered as %s, requested as %s", name, fam.kind, kind))
+    }
+
+    s, ok := fam.series[key]
+    if !ok {
+        s = newSeries(key, kind, buckets)
+        fam.series[key] = s
+    }
+    if fn != nil {
+        s.fn = fn
+    }
+    return s
+}
+
+// newSeries builds a series, with its buckets when it is a histogram.
+func newSeries(key, kind string, buckets []float64) *series {
+    s := &series{labels: key}
+    if kind == kindHistogram {
+        s.buckets = append([]float64(nil), buckets...)
+        sort.Float64s(s.buckets)
+        s.counts = make([]atomic.Uint64, len(s.buckets))
+    }
+    return s
+}
+
+func formatLabels(labels []string) string {
+    if len(labels) == 0 {
+        return ""
+    }
+
+    pairs := make([]string, 0, len(labels)/2)
+    for i := 0; i < len(labels); i += 2 {
+        pairs = append(pairs, labels[i]+"="+strconv.Quote(labels[i+1]))
+    }
+    sort.Strings(pairs)
+    return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (registry *Registry) WriteText(builder *strings.Builder) {
+    registry.mux.RLock()
+    defer registry.mux.RUnlock()
+
+    names := make([]string, 0, len(registry.families))
+    for name := range registry.families {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    for _, name := range names {
+        fam := registry.families[name]
+        if fam.help != "" {
+            fmt.Fprintf(builder, "# HELP %s %s\n", fam.name, fam.help)
+        }
+        fmt.Fprintf(builder, "# TYPE %s %s\n", fam.name, fam.kind)
+
+        keys := make([]string, 0, len(fam.series))
+        for key := range fam.series {
+            keys = append(keys, key)
+        }
+        sort.Strings(keys)
+        for _, key := range keys {
+            if fam.kind == kindHistogram {
+                writeHistogram(builder, fam.name, key, fam.series[key])
+                continue
+            }
+            value := fam.series[key].load()
+            fmt.Fprintf(builder, "%s%s %s\n", fam.name, key, strconv.FormatFloat(value, 'g', -1, 64))
+        }
+    }
+}
+
+func writeHistogram(builder *strings.Builder, name, key string, s *series) {
+    for i, bound := range s.buckets {
+        fmt.Fprintf(builder, "%s_bucket%s %d\n", name, withLabel(key, "le", strconv.FormatFloat(bound, 'g', -1, 64)), s.counts[i].Load())
+    }
+    count := s.count.Load()
+    fmt.Fprintf(builder, "%s_bucket%s %d\n", name, withLabel(key, "le", "+Inf"), count)
+    fmt.Fprintf(builder, "%s_sum%s %s\n", name, key, strconv.FormatFloat(s.load(), 'g', -1, 64))
+    fmt.Fprintf(builder, "%s_count%s %d\n", name, key, count)
+}
+
+func withLabel(key, name, value string) string {
+    label := name + "=" + strconv.Quote(value)
+    if key == "" {
+        return "{" + label + "}"
+    }
+    return key[:len(key)-1] + "," + label + "}"
+}
+
+func (registry *Registry) Handler() http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        var builder strings.Builder
+        registry.WriteText(&builder)
+
+        writer.Header().Set("Content-Type", "text/plain; version=0.0.4")
+        writer.Write([]byte(builder.String()))
+    })
+}
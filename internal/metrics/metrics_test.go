@@ -0,0 +1,217 @@
+package metrics
+
+import (
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+)
+
+func TestRegistry_CounterAndGauge(t *testing.T) {
+    registry := NewRegistry()
+
+    counter := registry.Counter("lb_requests_total", "Requests served.", "pool", "api")
+    counter.Inc()
+    counter.Add(2)
+    counter.Add(-5)
+
+    if registry.Counter("lb_requests_total", "", "pool", "api").Value() != 3 {
+        t.Errorf("Expected same counter series to be returned with value 3")
+    }
+
+    gauge := registry.Gauge("lb_in_flight", "In-flight requests.")
+    gauge.Set(4)
+    gauge.Add(-1.5)
+    if gauge.Value() != 2.5 {
+        t.Errorf("Gauge value = %v, expected 2.5", gauge.Value())
+    }
+
+    registry.GaugeFunc("lb_backends", "Alive backends.", func() float64 { return 7 }, "pool", "api")
+
+    var builder strings.Builder
+    registry.WriteText(&builder)
+    output := builder.String()
+
+    tests := []struct {
+        name     string
+        expected string
+    }{
+        {name: "counter help", expected: "# HELP lb_requests_total Requests served.\n"},
+        {name: "counter type", expected: "# TYPE lb_requests_total counter\n"},
+        {name: "counter value", expected: "lb_requests_total{pool=\"api\"} 3\n"},
+        {name: "gauge value", expected: "lb_in_flight 2.5\n"},
+        {name: "gauge func value", expected: "lb_backends{pool=\"api\"} 7\n"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if !strings.Contains(output, tt.expected) {
+                t.Errorf("Expected output to contain %q, got:\n%s", tt.expected, output)
+            }
+        })
+    }
+}
+
+func TestRegistry_LabelOrderIsCanonical(t *testing.T) {
+    registry := NewRegistry()
+
+    registry.Counter("lb_errors_total", "", "pool", "a", "backend", "b").Inc()
+    registry.Counter("lb_errors_total", "", "backend", "b", "pool", "a").Inc()
+
+    var builder strings.Builder
+    registry.WriteText(&builder)
+    if !strings.Contains(builder.String(), "lb_errors_total{backend=\"b\",pool=\"a\"} 2\n") {
+        t.Errorf("Expected label order to be canonical, got:\n%s", builder.String())
+    }
+}
+
+func TestRegistry_KindMismatchPanics(t *testing.T) {
+    registry := NewRegistry()
+    registry.Counter("lb_thing", "")
+
+    defer func() {
+        if recover() == nil {
+            t.Error("Expected panic when registering a counter as a gauge")
+        }
+    }()
+    registry.Gauge("lb_thing", "")
+}
+
+func TestRegistry_Handler(t *testing.T) {
+    registry := NewRegistry()
+    registry.Counter("lb_requests_total", "").Inc()
+
+    rr := httptest.NewRecorder()
+    registry.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+    if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain") {
+        t.Errorf("Unexpected content type %q", rr.Header().Get("Content-Type"))
+    }
+    if !strings.Contains(rr.Body.String(), "lb_requests_total 1") {
+        t.Errorf("Unexpected body:\n%s", rr.Body.String())
+    }
+}
+
+func TestCounter_ConcurrentAdd(t *testing.T) {
+    counter := NewRegistry().Counter("lb_concurrent_total", "")
+
+    var wg sync.WaitGroup
+    for i := 0; i < 50; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 100; j++ {
+                counter.Inc()
+            }
+        }()
+    }
+    wg.Wait()
+
+    if counter.Value() != 5000 {
+        t.Errorf("Counter value = %v, expected 5000", counter.Value())
+    }
+}
+
+func TestRegistry_Histogram(t *testing.T) {
+    registry := NewRegistry()
+
+    histogram := registry.Histogram("lb_latency_seconds", "Latency.", []float64{1, 0.1}, "listener", "web")
+    histogram.Observe(0.05)
+    histogram.Observe(0.5)
+    histogram.Observe(3)
+
+    if histogram.Count() != 3 || histogram.Sum() != 3.55 {
+        t.Errorf("Expected count 3 and sum 3.55, got %d and %v", histogram.Count(), histogram.Sum())
+    }
+
+    var builder strings.Builder
+    registry.WriteText(&builder)
+    output := builder.String()
+
+    tests := []struct {
+        name     string
+        expected string
+    }{
+        {name: "type", expected: "# TYPE lb_latency_seconds histogram\n"},
+        {name: "lowest bucket", expected: "lb_latency_seconds_bucket{listener=\"web\",le=\"0.1\"} 1\n"},
+        {name: "cumulative bucket", expected: "lb_latency_seconds_bucket{listener=\"web\",le=\"1\"} 2\n"},
+        {name: "infinity bucket", expected: "lb_latency_seconds_bucket{listener=\"web\",le=\"+Inf\"} 3\n"},
+        {name: "sum", expected: "lb_latency_seconds_sum{listener=\"web\"} 3.55\n"},
+        {name: "count", expected: "lb_latency_seconds_count{listener=\"web\"} 3\n"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if !strings.Contains(output, tt.expected) {
+                t.Errorf("Expected output to contain %q, got:\n%s", tt.expected, output)
+            }
+        })
+    }
+}
+
+func TestRegistry_HistogramScrapedWhileCreated(t *testing.T) {
+    registry := NewRegistry()
+
+    var wg sync.WaitGroup
+    for i := 0; i < 20; i++ {
+        wg.Add(2)
+        go func() {
+            defer wg.Done()
+            registry.Histogram("lb_latency_seconds", "Latency.", DefaultBuckets).Observe(0.2)
+        }()
+        go func() {
+            defer wg.Done()
+            var builder strings.Builder
+            registry.WriteText(&builder)
+        }()
+    }
+    wg.Wait()
+
+    var builder strings.Builder
+    registry.WriteText(&builder)
+    if !strings.Contains(builder.String(), "lb_latency_seconds_bucket{le=\"0.25\"} 20\n") {
+        t.Errorf("Expected every observation counted, got:\n%s", builder.String())
+    }
+}
+
+func TestRegistry_SnapshotRestore(t *testing.T) {
+    before := NewRegistry()
+    before.Counter("lb_requests_total", "Requests served.", "pool", "api").Add(5)
+    before.Gauge("lb_in_flight", "", "pool", "api").Set(3)
+    before.Histogram("lb_latency_seconds", "", []float64{0.1, 1}, "pool", "api").Observe(0.5)
+    snapshot := before.Snapshot()
+
+    if _, ok := snapshot.Counters["lb_in_flight"]; ok {
+        t.Errorf("Expected gauges left out of the snapshot")
+    }
+
+    after := NewRegistry()
+    after.Counter("lb_requests_total", "Requests served.", "pool", "api").Add(2)
+    after.Restore(snapshot)
+    if value := after.Counter("lb_requests_total", "", "pool", "api").Value(); value != 7 {
+        t.Errorf("Expected the restored count added to the new one, got %v", value)
+    }
+    if value := after.Gauge("lb_in_flight", "", "pool", "api").Value(); value != 0 {
+        t.Errorf("Expected gauges not restored, got %v", value)
+    }
+    histogram := after.Histogram("lb_latency_seconds", "", []float64{0.1, 1}, "pool", "api")
+    histogram.Observe(0.05)
+    if histogram.Count() != 2 || histogram.Sum() != 0.55 {
+        t.Errorf("Expected 2 observations summing to 0.55, got %d and %v", histogram.Count(), histogram.Sum())
+    }
+
+    var builder strings.Builder
+    after.WriteText(&builder)
+    for _, expected := range []string{`lb_latency_seconds_bucket{pool="api",le="0.1"} 1`, `lb_latency_seconds_bucket{pool="api",le="1"} 2`, "# HELP lb_requests_total Requests served."} {
+        if !strings.Contains(builder.String(), expected) {
+            t.Errorf("Expected %q in:\n%s", expected, builder.String())
+        }
+    }
+
+    mismatched := NewRegistry()
+    mismatched.Gauge("lb_requests_total", "", "pool", "api")
+    mismatched.Restore(snapshot)
+    if value := mismatched.Gauge("lb_requests_total", "", "pool", "api").Value(); value != 0 {
+        t.Errorf("Expected a series of another kind left alone, got %v", value)
+    }
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+    "math"
+    "slices"
+)
+
+// Snapshot holds the cumulative series of a registry, counters and
+// histograms, keyed by family name and then by formatted labels. Gauges are
+// left out: they describe the present, which a restarted process measures
+// afresh.
+type Snapshot struct {
+    Counters   map[string]CounterFamily   `json:"counters"`
+    Histograms map[string]HistogramFamily `json:"histograms"`
+}
+
+type CounterFamily struct {
+    Help   string             `json:"help,omitempty"`
+    Series map[string]float64 `json:"series"`
+}
+
+type HistogramFamily struct {
+    Help   string                    `json:"help,omitempty"`
+    Series map[string]HistogramValue `json:"series"`
+}
+
+type HistogramValue struct {
+    Buckets []float64 `json:"buckets"`
+    Counts  []uint64  `json:"counts"`
+    Count   uint64    `json:"count"`
+    Sum     float64   `json:"sum"`
+}
+
+func (registry *Registry) Snapshot() Snapshot {
+    snapshot := Snapshot{Counters: make(map[string]CounterFamily), Histograms: make(map[string]HistogramFamily)}
+
+    registry.mux.RLock()
+    defer registry.mux.RUnlock()
+
+    for name, fam := range registry.families {
+        switch fam.kind {
+        case kindCounter:
+            counters := CounterFamily{Help: fam.help, Series: make(map[string]float64)}
+            for key, s := range fam.series {
+                if s.fn == nil {
+                    counters.Series[key] = s.load()
+                }
+            }
+            snapshot.Counters[name] = counters
+        case kindHistogram:
+            histograms := HistogramFamily{Help: fam.help, Series: make(map[string]HistogramValue)}
+            for key, s := range fam.series {
+                value := HistogramValue{Buckets: slices.Clone(s.buckets), Counts: make([]uint64, len(s.counts)), Count: s.count.Load(), Sum: s.load()}
+                for i := range s.counts {
+                    value.Counts[i] = s.counts[i].Load()
+                }
+                histograms.Series[key] = value
+            }
+            snapshot.Histograms[name] = histograms
+        }
+    }
+    return snapshot
+}
+
+// Restore adds a snapshot's values to the registry's series, creating the
+// ones that do not exist yet, so counts taken before a restart carry on
+// from where they were. Series registered as another kind since, and
+// histograms whose buckets changed, are skipped.
+func (registry *Registry) Restore(snapshot Snapshot) {
+    for name, counters := range snapshot.Counters {
+        for key, value := range counters.Series {
+            if s := registry.lookupKey(name, counters.Help, kindCounter, key, nil); s != nil && value > 0 && !math.IsInf(value, 0) {
+                s.add(value)
+            }
+        }
+    }
+    for name, histograms := range snapshot.Histograms {
+        for key, value := range histograms.Series {
+            if len(value.Counts) != len(value.Buckets) {
+                continue
+            }
+            s := registry.lookupKey(name, histograms.Help, kindHistogram, key, value.Buckets)
+            if s == nil || !slices.Equal(s.buckets, value.Buckets) {
+                continue
+            }
+            for i, count := range value.Counts {
+                s.counts[i].Add(count)
+            }
+            s.count.Add(value.Count)
+            s.add(value.Sum)
+        }
+    }
+}
+
+// lookupKey is lookup for labels already formatted, returning nil rather
+// than panicking when name is registered as another kind.
+func (registry *Registry) lookupKey(name, help, kind, key string, buckets []float64) *series {
+    registry.mux.Lock()
+    defer registry.mux.Unlock()
+
+    fam, ok := registry.families[name]
+    if !ok {
+        fam = &family{name: name, help: help, kind: kind, series: make(map[string]*series)}
+        registry.families[name] = fam
+    } else if fam.kind != kind {
+        return nil
+    }
+    s, ok := fam.series[key]
+    if !ok {
+        s = newSeries(key, kind, buckets)
+        fam.series[key] = s
+    }
+    return s
+}
@@ -0,0 +1,316 @@
+package oidc
+
+import (
+    "crypto/sha256"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "load-balancer/internal/metrics"
+)
+
+// loginTimeout bounds how long a browser may spend at the IdP.
+const loginTimeout = 10 * time.Minute
+
+// Config describes an OpenID Connect login in front of a route.
+//
+// Browsers without a session are sent to Issuer's login page and come back
+// to RedirectURL, whose path must be served by the route using the
+// middleware. Other clients get a 401. After login, the claims named in
+// Claims are kept in an encrypted session cookie (CookieName, default
+// lb_oidc, sealed with CookieSecret) for SessionTTL (default 8 hours) and
+// sent to backends in the mapped headers; by default sub, email and name go
+// in X-Auth-Subject, X-Auth-Email and X-Auth-Name. Those headers are always
+// removed from client requests first, so they cannot be spoofed. A GET to
+// LogoutPath, when set, ends the session. Use Middleware as a route's Auth
+// so the route's AuthBypass paths stay public, and Headers as its
+// AuthHeaders so the claim headers are stripped on those paths too.
+type Config struct {
+    Name         string
+    Issuer       string
+    ClientID     string
+    ClientSecret string
+    RedirectURL  string
+    Scopes       []string
+    CookieName   string
+    CookieSecret []byte
+    SessionTTL   time.Duration
+    Claims       map[string]string
+    LogoutPath   string
+    Client       *http.Client
+    Registry     *metrics.Registry
+}
+
+type Proxy struct {
+    config   Config
+    callback string
+    secure   bool
+    sealer   *sealer
+    provider *provider
+}
+
+func New(config Config) (*Proxy, error) {
+    if config.Name == "" || config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+        return nil, errors.New("oidc: name, issuer, client ID and redirect URL are required")
+    }
+    redirect, err := url.Parse(config.RedirectURL)
+    if err != nil || !redirect.IsAbs() {
+        return nil, fmt.Errorf("oidc %s: redirect URL must be absolute", config.Name)
+    }
+    sealer, err := newSealer(config.CookieSecret)
+    if err != nil {
+        return nil, fmt.Errorf("oidc %s: %w", config.Name, err)
+    }
+    if len(config.Scopes) == 0 {
+        config.Scopes = []string{"openid", "email", "profile"}
+    }
+    if config.CookieName == "" {
+        config.CookieName = "lb_oidc"
+    }
+    if config.SessionTTL <= 0 {
+        config.SessionTTL = 8 * time.Hour
+    }
+    if len(config.Claims) == 0 {
+        config.Claims = map[string]string{"sub": "X-Auth-Subject", "email": "X-Auth-Email", "name": "X-Auth-Name"}
+    }
+    if config.Client == nil {
+        config.Client = &http.Client{Timeout: 5 * time.Second}
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+    return &Proxy{
+        config:   config,
+        callback: redirect.Path,
+        secure:   redirect.Scheme == "https",
+        sealer:   sealer,
+        provider: &provider{issuer: config.Issuer, client: config.Client},
+    }, nil
+}
+
+// Headers returns the headers the claims are sent to backends in.
+func (proxy *Proxy) Headers() []string {
+    headers := make([]string, 0, len(proxy.config.Claims))
+    for _, header := range proxy.config.Claims {
+        headers = append(headers, header)
+    }
+    sort.Strings(headers)
+    return headers
+}
+
+// Middleware lets requests with a valid session through, carrying the
+// user's claims, and handles the login callback and logout paths.
+func (proxy *Proxy) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        switch {
+        case request.URL.Path == proxy.callback:
+            proxy.handleCallback(writer, request)
+            return
+        case proxy.config.LogoutPath != "" && request.URL.Path == proxy.config.LogoutPath:
+            proxy.clearCookie(writer, proxy.config.CookieName)
+            proxy.decision("logout")
+            http.Redirect(writer, request, "/", http.StatusFound)
+            return
+        }
+
+        for _, header := range proxy.config.Claims {
+            request.Header.Del(header)
+        }
+        if session, ok := proxy.session(request); ok {
+            for claim, header := range proxy.config.Claims {
+                if value := session.Claims[claim]; value != "" {
+                    request.Header.Set(header, value)
+                }
+            }
+            proxy.decision("session")
+            next.ServeHTTP(writer, request)
+            return
+        }
+
+        if !wantsHTML(request) {
+            proxy.decision("unauthorized")
+            writer.Header().Set("WWW-Authenticate", `Bearer realm="`+proxy.config.Name+`"`)
+            http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+            return
+        }
+        proxy.startLogin(writer, request)
+    })
+}
+
+func (proxy *Proxy) decision(decision string) {
+    proxy.config.Registry.Counter("lb_oidc_decisions_total", "OIDC proxy decisions by outcome.", "oidc", proxy.config.Name, "decision", decision).Inc()
+}
+
+func (proxy *Proxy) session(request *http.Request) (session, bool) {
+    var current session
+    cookie, err := request.Cookie(proxy.config.CookieName)
+    if err != nil {
+        return current, false
+    }
+    if err := proxy.sealer.open(proxy.config.CookieName, cookie.Value, &current); err != nil || time.Now().After(current.Expires) {
+        return current, false
+    }
+    return current, true
+}
+
+// startLogin redirects the browser to the IdP, remembering in a short-lived
+// cookie how to finish the login it starts.
+func (proxy *Proxy) startLogin(writer http.ResponseWriter, request *http.Request) {
+    authorization, _, err := proxy.provider.endpoints(request.Context())
+    if err != nil {
+        proxy.fail(writer, request, http.StatusBadGateway, err)
+        return
+    }
+
+    state := loginState{
+        State:    randomString(),
+        Nonce:    randomString(),
+        Verifier: randomString(),
+        Return:   request.URL.RequestURI(),
+        Expires:  time.Now().Add(loginTimeout),
+    }
+    sealed, err := proxy.sealer.seal(proxy.stateCookie(), state)
+    if err != nil {
+        proxy.fail(writer, request, http.StatusInternalServerError, err)
+        return
+    }
+    proxy.setCookie(writer, proxy.stateCookie(), sealed, loginTimeout)
+
+    challenge := sha256.Sum256([]byte(state.Verifier))
+    query := url.Values{
+        "response_type":         {"code"},
+        "client_id":             {proxy.config.ClientID},
+        "redirect_uri":          {proxy.config.RedirectURL},
+        "scope":                 {strings.Join(proxy.config.Scopes, " ")},
+        "state":                 {state.State},
+        "nonce":                 {state.Nonce},
+        "code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+        "code_challenge_method": {"S256"},
+    }
+    separator := "?"
+    if strings.Contains(authorization, "?") {
+        separator = "&"
+    }
+    proxy.decision("redirect")
+    http.Redirect(writer, request, authorization+separator+query.Encode(), http.StatusFound)
+}
+
+// handleCallback finishes a login: it checks the state, exchanges the code
+// for an ID token, verifies it and starts the session.
+func (proxy *Proxy) handleCallback(writer http.ResponseWriter, request *http.Request) {
+    var state loginState
+    cookie, err := request.Cookie(proxy.stateCookie())
+    if err != nil {
+        proxy.fail(writer, request, http.StatusBadRequest, errors.New("no login in progress"))
+        return
+    }
+    proxy.clearCookie(writer, proxy.stateCookie())
+    if err := proxy.sealer.open(proxy.stateCookie(), cookie.Value, &state); err != nil || time.Now().After(state.Expires) {
+        proxy.fail(writer, request, http.StatusBadRequest, errors.New("login expired or invalid"))
+        return
+    }
+    query := request.URL.Query()
+    if query.Get("state") != state.State {
+        proxy.fail(writer, request, http.StatusBadRequest, errors.New("state does not match the login"))
+        return
+    }
+    if message := query.Get("error"); message != "" {
+        proxy.fail(writer, request, http.StatusForbidden, fmt.Errorf("provider refused the login: %s %s", message, query.Get("error_description")))
+        return
+    }
+
+    token, err := proxy.provider.exchange(request.Context(), proxy.config.ClientID, proxy.config.ClientSecret, proxy.config.RedirectURL, query.Get("code"), state.Verifier)
+    if err != nil {
+        proxy.fail(writer, request, http.StatusBadGateway, err)
+        return
+    }
+    now := time.Now()
+    claims, err := proxy.provider.verify(request.Context(), token, proxy.config.ClientID, state.Nonce, now)
+    if err != nil {
+        proxy.fail(writer, request, http.StatusForbidden, err)
+        return
+    }
+
+    current := session{Claims: make(map[string]string), Expires: now.Add(proxy.config.SessionTTL)}
+    for claim := range proxy.config.Claims {
+        if value := claimString(claims[claim]); value != "" {
+            current.Claims[claim] = value
+        }
+    }
+    sealed, err := proxy.sealer.seal(proxy.config.CookieName, current)
+    if err != nil {
+        proxy.fail(writer, request, http.StatusInternalServerError, err)
+        return
+    }
+    proxy.setCookie(writer, proxy.config.CookieName, sealed, proxy.config.SessionTTL)
+    proxy.decision("login")
+    log.Printf("oidc %s: %s logged in\n", proxy.config.Name, claimString(claims["sub"]))
+
+    // Only return to a path on this site, never to another host.
+    target := state.Return
+    if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") {
+        target = "/"
+    }
+    http.Redirect(writer, request, target, http.StatusFound)
+}
+
+func (proxy *Proxy) fail(writer http.ResponseWriter, request *http.Request, status int, err error) {
+    proxy.decision("login_failed")
+    log.Printf("oidc %s: login failed for %s: %v\n", proxy.config.Name, request.RemoteAddr, err)
+    http.Error(writer, http.StatusText(status), status)
+}
+
+func (proxy *Proxy) stateCookie() string {
+    return proxy.config.CookieName + "_state"
+}
+
+func (proxy *Proxy) setCookie(writer http.ResponseWriter, name, value string, ttl time.Duration) {
+    http.SetCookie(writer, &http.Cookie{
+        Name:     name,
+        Value:    value,
+        Path:     "/",
+        MaxAge:   int(ttl.Seconds()),
+        Secure:   proxy.secure,
+        HttpOnly: true,
+        SameSite: http.SameSiteLaxMode,
+    })
+}
+
+func (proxy *Proxy) clearCookie(writer http.ResponseWriter, name string) {
+    http.SetCookie(writer, &http.Cookie{Name: name, Path: "/", MaxAge: -1, Secure: proxy.secure, HttpOnly: true})
+}
+
+// wantsHTML tells browsers, which can follow a login redirect, from API
+// clients, which cannot.
+func wantsHTML(request *http.Request) bool {
+    return request.Method == http.MethodGet && strings.Contains(request.Header.Get("Accept"), "text/html")
+}
+
+// claimString renders a claim for a header: lists, such as groups, are
+// joined with commas.
+func claimString(value any) string {
+    switch value := value.(type) {
+    case string:
+        return value
+    case bool:
+        return strconv.FormatBool(value)
+    case float64:
+        return strconv.FormatFloat(value, 'f', -1, 64)
+    case []any:
+        values := make([]string, 0, len(value))
+        for _, item := range value {
+            if text := claimString(item); text != "" {
+                values = append(values, text)
+            }
+        }
+        return strings.Join(values, ",")
+    }
+    return ""
+}
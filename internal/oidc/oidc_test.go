@@ -0,0 +1,258 @@
+package oidc
+
+import (
+    "crypto"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "io"
+    "log"
+    "math/big"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "load-balancer/internal/metrics"
+)
+
+// fakeIdP issues RS256 ID tokens for whatever code it is handed, echoing
+// the nonce of the last authorization request.
+type fakeIdP struct {
+    server *httptest.Server
+    key    *rsa.PrivateKey
+
+    mux      sync.Mutex
+    nonce    string
+    audience string
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+    t.Helper()
+
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatalf("generate key: %v", err)
+    }
+    idp := &fakeIdP{key: key, audience: "app"}
+    mux := http.NewServeMux()
+    mux.HandleFunc("GET /.well-known/openid-configuration", func(writer http.ResponseWriter, request *http.Request) {
+        json.NewEncoder(writer).Encode(map[string]string{
+            "issuer":                 idp.server.URL,
+            "authorization_endpoint": idp.server.URL + "/authorize",
+            "token_endpoint":         idp.server.URL + "/token",
+            "jwks_uri":               idp.server.URL + "/keys",
+        })
+    })
+    mux.HandleFunc("GET /keys", func(writer http.ResponseWriter, request *http.Request) {
+        json.NewEncoder(writer).Encode(map[string]any{"keys": []map[string]string{{
+            "kty": "RSA",
+            "kid": "k1",
+            "n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+            "e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+        }}})
+    })
+    mux.HandleFunc("POST /token", func(writer http.ResponseWriter, request *http.Request) {
+        if user, password, _ := request.BasicAuth(); user != "app" || password != "secret" || request.FormValue("code_verifier") == "" {
+            writer.WriteHeader(http.StatusUnauthorized)
+            json.NewEncoder(writer).Encode(map[string]string{"error": "invalid_client"})
+            return
+        }
+        idp.mux.Lock()
+        claims := map[string]any{
+            "iss":    idp.server.URL,
+            "aud":    idp.audience,
+            "sub":    "user-1",
+            "email":  "ada@example.com",
+            "groups": []string{"admins", "ops"},
+            "exp":    time.Now().Add(time.Hour).Unix(),
+            "nonce":  idp.nonce,
+        }
+        idp.mux.Unlock()
+        json.NewEncoder(writer).Encode(map[string]string{"id_token": idp.sign(claims)})
+    })
+    idp.server = httptest.NewServer(mux)
+    t.Cleanup(idp.server.Close)
+    return idp
+}
+
+func (idp *fakeIdP) sign(claims map[string]any) string {
+    header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+    payload, _ := json.Marshal(claims)
+    signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+    digest := sha256.Sum256([]byte(signed))
+    signature, _ := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+    return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// authorize plays the browser at the IdP: it records the nonce and returns
+// the callback URL the IdP would redirect to.
+func (idp *fakeIdP) authorize(t *testing.T, location string) string {
+    t.Helper()
+
+    redirect, err := url.Parse(location)
+    if err != nil || !strings.HasPrefix(location, idp.server.URL+"/authorize?") {
+        t.Fatalf("Expected a redirect to the IdP, got %q", location)
+    }
+    query := redirect.Query()
+    if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != "app" {
+        t.Errorf("Expected a PKCE request for the app, got %v", query)
+    }
+    idp.mux.Lock()
+    idp.nonce = query.Get("nonce")
+    idp.mux.Unlock()
+    return query.Get("redirect_uri") + "?code=abc&state=" + url.QueryEscape(query.Get("state"))
+}
+
+func newTestProxy(t *testing.T, idp *fakeIdP) (*Proxy, http.Handler) {
+    t.Helper()
+
+    proxy, err := New(Config{
+        Name:         "app",
+        Issuer:       idp.server.URL,
+        ClientID:     "app",
+        ClientSecret: "secret",
+        RedirectURL:  "https://app.example.com/oauth2/callback",
+        CookieSecret: []byte("0123456789abcdef0123456789abcdef"),
+        Claims:       map[string]string{"sub": "X-Auth-Subject", "email": "X-Auth-Email", "groups": "X-Auth-Groups"},
+        LogoutPath:   "/logout",
+        Registry:     metrics.NewRegistry(),
+    })
+    if err != nil {
+        t.Fatalf("new: %v", err)
+    }
+    backend := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        io.WriteString(writer, request.Header.Get("X-Auth-Subject")+" "+request.Header.Get("X-Auth-Email")+" "+request.Header.Get("X-Auth-Groups"))
+    })
+    return proxy, proxy.Middleware(backend)
+}
+
+func serve(handler http.Handler, target string, cookies []*http.Cookie, accept string) *httptest.ResponseRecorder {
+    request := httptest.NewRequest("GET", target, nil)
+    request.Header.Set("Accept", accept)
+    request.Header.Set("X-Auth-Subject", "spoofed")
+    for _, cookie := range cookies {
+        request.AddCookie(cookie)
+    }
+    rr := httptest.NewRecorder()
+    handler.ServeHTTP(rr, request)
+    return rr
+}
+
+func TestProxy_LoginFlow(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    idp := newFakeIdP(t)
+    _, handler := newTestProxy(t, idp)
+
+    if rr := serve(handler, "/reports", nil, "application/json"); rr.Code != http.StatusUnauthorized {
+        t.Errorf("Expected API clients to get 401, got %d", rr.Code)
+    }
+
+    rr := serve(handler, "/reports?year=2026", nil, "text/html")
+    if rr.Code != http.StatusFound {
+        t.Fatalf("Expected a login redirect, got %d", rr.Code)
+    }
+    stateCookies := rr.Result().Cookies()
+    callback := idp.authorize(t, rr.Header().Get("Location"))
+
+    rr = serve(handler, callback, stateCookies, "text/html")
+    if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/reports?year=2026" {
+        t.Fatalf("Expected a redirect back to the page, got %d to %q: %s", rr.Code, rr.Header().Get("Location"), rr.Body)
+    }
+    var sessionCookies []*http.Cookie
+    for _, cookie := range rr.Result().Cookies() {
+        if cookie.Name == "lb_oidc" {
+            sessionCookies = append(sessionCookies, cookie)
+            if !cookie.Secure || !cookie.HttpOnly {
+                t.Errorf("Expected a secure, HTTP-only session cookie, got %+v", cookie)
+            }
+        }
+    }
+
+    rr = serve(handler, "/reports", sessionCookies, "application/json")
+    if rr.Code != http.StatusOK || rr.Body.String() != "user-1 ada@example.com admins,ops" {
+        t.Errorf("Expected the claims forwarded to the backend, got %d: %q", rr.Code, rr.Body)
+    }
+
+    rr = serve(handler, "/logout", sessionCookies, "text/html")
+    if cookies := rr.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+        t.Errorf("Expected logout to clear the session cookie, got %v", cookies)
+    }
+}
+
+func TestProxy_RejectedLogins(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    tests := []struct {
+        name         string
+        tamper       func(idp *fakeIdP, callback string, cookies []*http.Cookie) (string, []*http.Cookie)
+        expectedCode int
+    }{
+        {name: "no state cookie", tamper: func(idp *fakeIdP, callback string, cookies []*http.Cookie) (string, []*http.Cookie) {
+            return callback, nil
+        }, expectedCode: http.StatusBadRequest},
+        {name: "forged state cookie", tamper: func(idp *fakeIdP, callback string, cookies []*http.Cookie) (string, []*http.Cookie) {
+            return callback, []*http.Cookie{{Name: "lb_oidc_state", Value: "forged"}}
+        }, expectedCode: http.StatusBadRequest},
+        {name: "state mismatch", tamper: func(idp *fakeIdP, callback string, cookies []*http.Cookie) (string, []*http.Cookie) {
+            return strings.Split(callback, "&state=")[0] + "&state=other", cookies
+        }, expectedCode: http.StatusBadRequest},
+        {name: "nonce mismatch", tamper: func(idp *fakeIdP, callback string, cookies []*http.Cookie) (string, []*http.Cookie) {
+            idp.nonce = "replayed"
+            return callback, cookies
+        }, expectedCode: http.StatusForbidden},
+        {name: "token for another client", tamper: func(idp *fakeIdP, callback string, cookies []*http.Cookie) (string, []*http.Cookie) {
+            idp.audience = "other"
+            return callback, cookies
+        }, expectedCode: http.StatusForbidden},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            idp := newFakeIdP(t)
+            _, handler := newTestProxy(t, idp)
+
+            rr := serve(handler, "/", nil, "text/html")
+            callback, cookies := tt.tamper(idp, idp.authorize(t, rr.Header().Get("Location")), rr.Result().Cookies())
+            rr = serve(handler, callback, cookies, "text/html")
+            if rr.Code != tt.expectedCode {
+                t.Errorf("Expected status %d, got %d", tt.expectedCode, rr.Code)
+            }
+            for _, cookie := range rr.Result().Cookies() {
+                if cookie.Name == "lb_oidc" {
+                    t.Errorf("Expected no session, got %+v", cookie)
+                }
+            }
+        })
+    }
+}
+
+func TestProxy_ForgedSession(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    idp := newFakeIdP(t)
+    proxy, handler := newTestProxy(t, idp)
+
+    // A state cookie is sealed with the same key but must not pass as a
+    // session.
+    sealed, _ := proxy.sealer.seal(proxy.stateCookie(), session{Claims: map[string]string{"sub": "admin"}, Expires: time.Now().Add(time.Hour)})
+    rr := serve(handler, "/", []*http.Cookie{{Name: "lb_oidc", Value: sealed}}, "application/json")
+    if rr.Code != http.StatusUnauthorized {
+        t.Errorf("Expected a cookie sealed for another name rejected, got %d", rr.Code)
+    }
+
+    expired, _ := proxy.sealer.seal("lb_oidc", session{Claims: map[string]string{"sub": "admin"}, Expires: time.Now().Add(-time.Minute)})
+    if rr := serve(handler, "/", []*http.Cookie{{Name: "lb_oidc", Value: expired}}, "application/json"); rr.Code != http.StatusUnauthorized {
+        t.Errorf("Expected an expired session rejected, got %d", rr.Code)
+    }
+}
@@ -0,0 +1,279 @@
+package oidc
+
+import (
+    "context"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rsa"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "math/big"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+)
+
+// keyRefreshInterval limits how often an unknown key ID makes the provider
+// refetch its keys, so forged tokens cannot hammer the IdP.
+const keyRefreshInterval = time.Minute
+
+// provider holds what the IdP's discovery document and key set say,
+// fetched on first use so the balancer starts even when the IdP is down.
+type provider struct {
+    issuer string
+    client *http.Client
+
+    mux           sync.Mutex
+    authorization string
+    token         string
+    jwksURI       string
+    keys          map[string]crypto.PublicKey
+    fetchedKeys   time.Time
+}
+
+type discovery struct {
+    Issuer                string `json:"issuer"`
+    AuthorizationEndpoint string `json:"authorization_endpoint"`
+    TokenEndpoint         string `json:"token_endpoint"`
+    JWKSURI               string `json:"jwks_uri"`
+}
+
+func (provider *provider) endpoints(ctx context.Context) (string, string, error) {
+    provider.mux.Lock()
+    defer provider.mux.Unlock()
+
+    if provider.token != "" {
+        return provider.authorization, provider.token, nil
+    }
+    var document discovery
+    if err := provider.getJSON(ctx, strings.TrimSuffix(provider.issuer, "/")+"/.well-known/openid-configuration", &document); err != nil {
+        return "", "", fmt.Errorf("discovery: %w", err)
+    }
+    if document.Issuer != provider.issuer {
+        return "", "", fmt.Errorf("discovery: issuer %q does not match %q", document.Issuer, provider.issuer)
+    }
+    if document.AuthorizationEndpoint == "" || document.TokenEndpoint == "" || document.JWKSURI == "" {
+        return "", "", errors.New("discovery: document is missing endpoints")
+    }
+    provider.authorization, provider.token, provider.jwksURI = document.AuthorizationEndpoint, document.TokenEndpoint, document.JWKSURI
+    return provider.authorization, provider.token, nil
+}
+
+func (provider *provider) getJSON(ctx context.Context, location string, value any) error {
+    request, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+    if err != nil {
+        return err
+    }
+    response, err := provider.client.Do(request)
+    if err != nil {
+        return err
+    }
+    defer response.Body.Close()
+    if response.StatusCode != http.StatusOK {
+        return fmt.Errorf("%s answered %s", location, response.Status)
+    }
+    return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(value)
+}
+
+// exchange trades an authorization code for the provider's ID token.
+func (provider *provider) exchange(ctx context.Context, clientID, clientSecret, redirectURL, code, verifier string) (string, error) {
+    _, tokenEndpoint, err := provider.endpoints(ctx)
+    if err != nil {
+        return "", err
+    }
+    form := url.Values{
+        "grant_type":    {"authorization_code"},
+        "code":          {code},
+        "redirect_uri":  {redirectURL},
+        "code_verifier": {verifier},
+    }
+    request, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenEndpoint, strings.NewReader(form.Encode()))
+    if err != nil {
+        return "", err
+    }
+    request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    request.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+    response, err := provider.client.Do(request)
+    if err != nil {
+        return "", err
+    }
+    defer response.Body.Close()
+
+    var result struct {
+        IDToken          string `json:"id_token"`
+        Error            string `json:"error"`
+        ErrorDescription string `json:"error_description"`
+    }
+    if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&result); err != nil {
+        return "", fmt.Errorf("token endpoint answered %s", response.Status)
+    }
+    if result.Error != "" {
+        return "", fmt.Errorf("token endpoint: %s %s", result.Error, result.ErrorDescription)
+    }
+    if result.IDToken == "" {
+        return "", errors.New("token endpoint returned no id_token")
+    }
+    return result.IDToken, nil
+}
+
+// verify checks an ID token's signature against the provider's keys and
+// its issuer, audience, expiry and nonce, returning its claims.
+func (provider *provider) verify(ctx context.Context, token, clientID, nonce string, now time.Time) (map[string]any, error) {
+    parts := strings.Split(token, ".")
+    if len(parts) != 3 {
+        return nil, errors.New("malformed id_token")
+    }
+    var header struct {
+        Alg string `json:"alg"`
+        Kid string `json:"kid"`
+    }
+    if err := decodeSegment(parts[0], &header); err != nil {
+        return nil, err
+    }
+    signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+    if err != nil {
+        return nil, err
+    }
+    key, err := provider.key(ctx, header.Kid, now)
+    if err != nil {
+        return nil, err
+    }
+    if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+        return nil, err
+    }
+
+    var claims map[string]any
+    if err := decodeSegment(parts[1], &claims); err != nil {
+        return nil, err
+    }
+    if issuer, _ := claims["iss"].(string); issuer != provider.issuer {
+        return nil, fmt.Errorf("id_token issuer %q is not %q", issuer, provider.issuer)
+    }
+    if !hasAudience(claims["aud"], clientID) {
+        return nil, errors.New("id_token is not for this client")
+    }
+    if expires, ok := claims["exp"].(float64); !ok || now.After(time.Unix(int64(expires), 0)) {
+        return nil, errors.New("id_token has expired")
+    }
+    if claimed, _ := claims["nonce"].(string); claimed != nonce {
+        return nil, errors.New("id_token nonce does not match the login")
+    }
+    return claims, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+    digest := sha256.Sum256([]byte(signed))
+    switch alg {
+    case "RS256":
+        rsaKey, ok := key.(*rsa.PublicKey)
+        if !ok {
+            return errors.New("id_token key is not an RSA key")
+        }
+        if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+            return errors.New("id_token signature is invalid")
+        }
+        return nil
+    case "ES256":
+        ecKey, ok := key.(*ecdsa.PublicKey)
+        if !ok || len(signature) != 64 {
+            return errors.New("id_token key is not a P-256 key")
+        }
+        r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+        if !ecdsa.Verify(ecKey, digest[:], r, s) {
+            return errors.New("id_token signature is invalid")
+        }
+        return nil
+    }
+    return fmt.Errorf("unsupported id_token algorithm %q", alg)
+}
+
+// key returns the signing key with kid, refetching the key set when it is
+// unknown, as providers rotate keys.
+func (provider *provider) key(ctx context.Context, kid string, now time.Time) (crypto.PublicKey, error) {
+    if _, _, err := provider.endpoints(ctx); err != nil {
+        return nil, err
+    }
+    provider.mux.Lock()
+    defer provider.mux.Unlock()
+
+    if key, ok := provider.keys[kid]; ok {
+        return key, nil
+    }
+    if now.Sub(provider.fetchedKeys) < keyRefreshInterval {
+        return nil, fmt.Errorf("unknown id_token key %q", kid)
+    }
+    provider.fetchedKeys = now
+
+    var set struct {
+        Keys []struct {
+            Kty string `json:"kty"`
+            Kid string `json:"kid"`
+            Use string `json:"use"`
+            N   string `json:"n"`
+            E   string `json:"e"`
+            Crv string `json:"crv"`
+            X   string `json:"x"`
+            Y   string `json:"y"`
+        } `json:"keys"`
+    }
+    if err := provider.getJSON(ctx, provider.jwksURI, &set); err != nil {
+        return nil, fmt.Errorf("keys: %w", err)
+    }
+    keys := make(map[string]crypto.PublicKey)
+    for _, jwk := range set.Keys {
+        if jwk.Use != "" && jwk.Use != "sig" {
+            continue
+        }
+        switch {
+        case jwk.Kty == "RSA":
+            n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+            e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+            if errN != nil || errE != nil || len(e) > 4 {
+                continue
+            }
+            keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+        case jwk.Kty == "EC" && jwk.Crv == "P-256":
+            x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+            y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+            if errX != nil || errY != nil {
+                continue
+            }
+            keys[jwk.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+        }
+    }
+    provider.keys = keys
+
+    if key, ok := keys[kid]; ok {
+        return key, nil
+    }
+    return nil, fmt.Errorf("unknown id_token key %q", kid)
+}
+
+func hasAudience(audience any, clientID string) bool {
+    switch audience := audience.(type) {
+    case string:
+        return audience == clientID
+    case []any:
+        for _, value := range audience {
+            if value == clientID {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+func decodeSegment(segment string, value any) error {
+    raw, err := base64.RawURLEncoding.DecodeString(segment)
+    if err != nil {
+        return err
+    }
+    return json.Unmarshal(raw, value)
+}
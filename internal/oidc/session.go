@@ -0,0 +1,84 @@
+package oidc
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "time"
+)
+
+// sealer encrypts and authenticates cookie values with AES-256-GCM, so
+// clients can neither read nor forge them.
+type sealer struct {
+    aead cipher.AEAD
+}
+
+func newSealer(secret []byte) (*sealer, error) {
+    if len(secret) < 16 {
+        return nil, errors.New("cookie secret must be at least 16 bytes")
+    }
+    key := sha256.Sum256(secret)
+    block, err := aes.NewCipher(key[:])
+    if err != nil {
+        return nil, err
+    }
+    aead, err := cipher.NewGCM(block)
+    if err != nil {
+        return nil, err
+    }
+    return &sealer{aead: aead}, nil
+}
+
+// seal encrypts value for the cookie called name; binding the name stops a
+// state cookie from being replayed as a session cookie.
+func (sealer *sealer) seal(name string, value any) (string, error) {
+    plaintext, err := json.Marshal(value)
+    if err != nil {
+        return "", err
+    }
+    nonce := make([]byte, sealer.aead.NonceSize())
+    if _, err := rand.Read(nonce); err != nil {
+        return "", err
+    }
+    return base64.RawURLEncoding.EncodeToString(sealer.aead.Seal(nonce, nonce, plaintext, []byte(name))), nil
+}
+
+func (sealer *sealer) open(name, sealed string, value any) error {
+    raw, err := base64.RawURLEncoding.DecodeString(sealed)
+    if err != nil || len(raw) < sealer.aead.NonceSize() {
+        return errors.New("malformed cookie")
+    }
+    size := sealer.aead.NonceSize()
+    plaintext, err := sealer.aead.Open(nil, raw[:size], raw[size:], []byte(name))
+    if err != nil {
+        return errors.New("cookie failed authentication")
+    }
+    return json.Unmarshal(plaintext, value)
+}
+
+// session is what the session cookie carries: the claims forwarded to
+// backends and when the login expires.
+type session struct {
+    Claims  map[string]string `json:"claims"`
+    Expires time.Time         `json:"expires"`
+}
+
+// loginState ties a callback to the login that started it: the state and
+// nonce sent to the provider, the PKCE verifier, and where to return to.
+type loginState struct {
+    State    string    `json:"state"`
+    Nonce    string    `json:"nonce"`
+    Verifier string    `json:"verifier"`
+    Return   string    `json:"return"`
+    Expires  time.Time `json:"expires"`
+}
+
+func randomString() string {
+    buf := make([]byte, 32)
+    rand.Read(buf)
+    return base64.RawURLEncoding.EncodeToString(buf)
+}
@@ -0,0 +1,414 @@
+package openapi
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+
+    "load-balancer/internal/jsonschema"
+    "load-balancer/internal/metrics"
+)
+
+type document struct {
+    OpenAPI string              `json:"openapi"`
+    Paths   map[string]pathItem `json:"paths"`
+}
+
+type pathItem struct {
+    Parameters []parameter           `json:"parameters"`
+    Operations map[string]*operation `json:"-"`
+}
+
+type operation struct {
+    Parameters  []parameter  `json:"parameters"`
+    RequestBody *requestBody `json:"requestBody"`
+}
+
+type parameter struct {
+    Name     string  `json:"name"`
+    In       string  `json:"in"`
+    Required bool    `json:"required"`
+    Schema   *schema `json:"schema"`
+}
+
+type schema struct {
+    Type string   `json:"type"`
+    Enum []string `json:"enum"`
+}
+
+type requestBody struct {
+    Required bool                       `json:"required"`
+    Content  map[string]json.RawMessage `json:"content"`
+}
+
+var methods = []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete, http.MethodOptions, http.MethodHead, http.MethodPatch, http.MethodTrace}
+
+func (item *pathItem) UnmarshalJSON(data []byte) error {
+    var raw map[string]json.RawMessage
+    if err := json.Unmarshal(data, &raw); err != nil {
+        return err
+    }
+    if parameters, ok := raw["parameters"]; ok {
+        if err := json.Unmarshal(parameters, &item.Parameters); err != nil {
+            return err
+        }
+    }
+    item.Operations = make(map[string]*operation)
+    for _, method := range methods {
+        body, ok := raw[strings.ToLower(method)]
+        if !ok {
+            continue
+        }
+        var op operation
+        if err := json.Unmarshal(body, &op); err != nil {
+            return fmt.Errorf("%s: %w", strings.ToLower(method), err)
+        }
+        item.Operations[method] = &op
+    }
+    return nil
+}
+
+// Spec is the part of an OpenAPI 3 document needed to check requests
+// against it: paths, their operations and parameters, and whether a body is
+// required. Parameter schemas are checked only for type and enum; JSON
+// body schemas are compiled for use with the jsonschema middleware.
+type Spec struct {
+    templates []template
+}
+
+type template struct {
+    path       string
+    segments   []string
+    literals   int
+    operations map[string]operationSpec
+}
+
+type operationSpec struct {
+    parameters []parameter
+    body       bool
+    bodySchema *jsonschema.Schema
+}
+
+// Load parses an OpenAPI 3 document in JSON.
+func Load(data []byte) (*Spec, error) {
+    var doc document
+    if err := json.Unmarshal(data, &doc); err != nil {
+        return nil, fmt.Errorf("openapi: %w", err)
+    }
+    if !strings.HasPrefix(doc.OpenAPI, "3.") {
+        return nil, fmt.Errorf("openapi: unsupported version %q", doc.OpenAPI)
+    }
+    if len(doc.Paths) == 0 {
+        return nil, errors.New("openapi: no paths")
+    }
+
+    spec := &Spec{}
+    for name, item := range doc.Paths {
+        if !strings.HasPrefix(name, "/") {
+            return nil, fmt.Errorf("openapi: path %q must start with /", name)
+        }
+        tmpl := template{path: name, segments: strings.Split(strings.Trim(name, "/"), "/"), operations: make(map[string]operationSpec)}
+        for _, segment := range tmpl.segments {
+            if !isParam(segment) {
+                tmpl.literals++
+            }
+        }
+        for method, op := range item.Operations {
+            compiled := operationSpec{
+                parameters: mergeParameters(item.Parameters, op.Parameters),
+                body:       op.RequestBody != nil && op.RequestBody.Required,
+            }
+            if op.RequestBody != nil {
+                schema, err := bodySchema(data, name, method, op.RequestBody)
+                if err != nil {
+                    return nil, fmt.Errorf("openapi: %s %s: %w", method, name, err)
+                }
+                compiled.bodySchema = schema
+            }
+            tmpl.operations[method] = compiled
+        }
+        spec.templates = append(spec.templates, tmpl)
+    }
+    // Concrete paths take precedence over templated ones, as the
+    // specification requires.
+    sort.Slice(spec.templates, func(i, j int) bool {
+        if spec.templates[i].literals != spec.templates[j].literals {
+            return spec.templates[i].literals > spec.templates[j].literals
+        }
+        return spec.templates[i].path < spec.templates[j].path
+    })
+    return spec, nil
+}
+
+// bodySchema compiles the schema of the operation's JSON request body, if
+// it declares one, in place in the document so its $refs resolve.
+func bodySchema(document []byte, name, method string, body *requestBody) (*jsonschema.Schema, error) {
+    mediaTypes := make([]string, 0, len(body.Content))
+    for mediaType := range body.Content {
+        mediaTypes = append(mediaTypes, mediaType)
+    }
+    sort.Strings(mediaTypes)
+    for _, mediaType := range mediaTypes {
+        base, _, _ := strings.Cut(mediaType, ";")
+        if base != "application/json" && !strings.HasSuffix(base, "+json") {
+            continue
+        }
+        var content struct {
+            Schema json.RawMessage `json:"schema"`
+        }
+        if err := json.Unmarshal(body.Content[mediaType], &content); err != nil || content.Schema == nil {
+            continue
+        }
+        return jsonschema.CompileRef(document, "#/paths/"+escapePointer(name)+"/"+strings.ToLower(method)+"/requestBody/content/"+escapePointer(mediaType)+"/schema")
+    }
+    return nil, nil
+}
+
+func escapePointer(token string) string {
+    return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+func LoadFile(name string) (*Spec, error) {
+    data, err := os.ReadFile(name)
+    if err != nil {
+        return nil, fmt.Errorf("openapi: %w", err)
+    }
+    return Load(data)
+}
+
+// mergeParameters lets an operation's parameters override the path's ones
+// with the same name and location.
+func mergeParameters(shared, own []parameter) []parameter {
+    merged := append([]parameter(nil), own...)
+    for _, candidate := range shared {
+        overridden := false
+        for _, param := range own {
+            if param.Name == candidate.Name && param.In == candidate.In {
+                overridden = true
+                break
+            }
+        }
+        if !overridden {
+            merged = append(merged, candidate)
+        }
+    }
+    return merged
+}
+
+func isParam(segment string) bool {
+    return len(segment) > 2 && segment[0] == '{' && segment[len(segment)-1] == '}'
+}
+
+// Validation errors, by the status the middleware answers them with.
+var (
+    ErrUnknownPath      = errors.New("no operation is defined for this path")
+    ErrMethodNotAllowed = errors.New("method not defined for this path")
+    ErrInvalidRequest   = errors.New("request does not match the operation")
+)
+
+// Validate checks request, whose path is relative to the spec's paths,
+// against the spec.
+func (spec *Spec) Validate(request *http.Request, requestPath string) error {
+    segments := strings.Split(strings.Trim(path.Clean("/"+requestPath), "/"), "/")
+    for _, tmpl := range spec.templates {
+        params, ok := tmpl.match(segments)
+        if !ok {
+            continue
+        }
+        op, ok := tmpl.operations[request.Method]
+        if !ok && request.Method == http.MethodHead {
+            op, ok = tmpl.operations[http.MethodGet]
+        }
+        if !ok {
+            return fmt.Errorf("%w: %s %s", ErrMethodNotAllowed, request.Method, tmpl.path)
+        }
+        return op.validate(request, params)
+    }
+    return fmt.Errorf("%w: %s", ErrUnknownPath, requestPath)
+}
+
+func (tmpl template) match(segments []string) (map[string]string, bool) {
+    if len(segments) != len(tmpl.segments) {
+        return nil, false
+    }
+    params := make(map[string]string)
+    for i, segment := range tmpl.segments {
+        if isParam(segment) {
+            if segments[i] == "" {
+                return nil, false
+            }
+            params[segment[1:len(segment)-1]] = segments[i]
+            continue
+        }
+        if segment != segments[i] {
+            return nil, false
+        }
+    }
+    return params, true
+}
+
+// BodySchema returns the JSON schema declared for the body of the
+// operation matching request, or nil when there is none.
+func (spec *Spec) BodySchema(request *http.Request, requestPath string) *jsonschema.Schema {
+    segments := strings.Split(strings.Trim(path.Clean("/"+requestPath), "/"), "/")
+    for _, tmpl := range spec.templates {
+        if _, ok := tmpl.match(segments); ok {
+            return tmpl.operations[request.Method].bodySchema
+        }
+    }
+    return nil
+}
+
+// BodySchemas looks up request body schemas for jsonschema.Config's Lookup,
+// for a route whose paths sit below basePath.
+func (spec *Spec) BodySchemas(basePath string) func(request *http.Request) *jsonschema.Schema {
+    basePath = strings.TrimSuffix(basePath, "/")
+    return func(request *http.Request) *jsonschema.Schema {
+        requestPath, ok := strings.CutPrefix(request.URL.Path, basePath)
+        if !ok || (requestPath != "" && requestPath[0] != '/') {
+            return nil
+        }
+        return spec.BodySchema(request, requestPath)
+    }
+}
+
+// allowed lists the methods defined for the template matching requestPath.
+func (spec *Spec) allowed(requestPath string) []string {
+    segments := strings.Split(strings.Trim(path.Clean("/"+requestPath), "/"), "/")
+    for _, tmpl := range spec.templates {
+        if _, ok := tmpl.match(segments); ok {
+            allowed := make([]string, 0, len(tmpl.operations))
+            for _, method := range methods {
+                if _, ok := tmpl.operations[method]; ok {
+                    allowed = append(allowed, method)
+                }
+            }
+            return allowed
+        }
+    }
+    return nil
+}
+
+func (op operationSpec) validate(request *http.Request, pathParams map[string]string) error {
+    var problems []string
+    query := request.URL.Query()
+    for _, param := range op.parameters {
+        var value string
+        present := false
+        switch param.In {
+        case "path":
+            value, present = pathParams[param.Name]
+        case "query":
+            present = query.Has(param.Name)
+            value = query.Get(param.Name)
+        case "header":
+            values := request.Header.Values(param.Name)
+            present = len(values) > 0
+            if present {
+                value = values[0]
+            }
+        case "cookie":
+            if cookie, err := request.Cookie(param.Name); err == nil {
+                value, present = cookie.Value, true
+            }
+        }
+        if !present {
+            if param.Required || param.In == "path" {
+                problems = append(problems, fmt.Sprintf("missing %s parameter %q", param.In, param.Name))
+            }
+            continue
+        }
+        if err := param.Schema.check(value); err != nil {
+            problems = append(problems, fmt.Sprintf("%s parameter %q %v", param.In, param.Name, err))
+        }
+    }
+    if op.body && request.ContentLength == 0 && request.Body == http.NoBody {
+        problems = append(problems, "missing request body")
+    }
+    if len(problems) > 0 {
+        return fmt.Errorf("%w: %s", ErrInvalidRequest, strings.Join(problems, "; "))
+    }
+    return nil
+}
+
+func (s *schema) check(value string) error {
+    if s == nil {
+        return nil
+    }
+    switch s.Type {
+    case "integer":
+        if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+            return errors.New("must be an integer")
+        }
+    case "number":
+        if _, err := strconv.ParseFloat(value, 64); err != nil {
+            return errors.New("must be a number")
+        }
+    case "boolean":
+        if value != "true" && value != "false" {
+            return errors.New("must be true or false")
+        }
+    }
+    if len(s.Enum) > 0 {
+        for _, allowed := range s.Enum {
+            if value == allowed {
+                return nil
+            }
+        }
+        return fmt.Errorf("must be one of %s", strings.Join(s.Enum, ", "))
+    }
+    return nil
+}
+
+// Config attaches a spec to a route. BasePath is stripped from request
+// paths before matching, typically the route's PathPrefix when the spec's
+// paths are relative to it.
+type Config struct {
+    Name     string
+    Spec     *Spec
+    BasePath string
+    Registry *metrics.Registry
+}
+
+// Middleware rejects requests the spec does not describe before they reach
+// a backend: unknown paths with 404, methods the path does not define with
+// 405 and an Allow header, and missing or malformed parameters or a missing
+// required body with 400.
+func Middleware(config Config) func(http.Handler) http.Handler {
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+    basePath := strings.TrimSuffix(config.BasePath, "/")
+
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+            requestPath, ok := strings.CutPrefix(request.URL.Path, basePath)
+            if !ok || (requestPath != "" && requestPath[0] != '/') {
+                next.ServeHTTP(writer, request)
+                return
+            }
+            err := config.Spec.Validate(request, requestPath)
+            if err == nil {
+                next.ServeHTTP(writer, request)
+                return
+            }
+
+            status, reason := http.StatusBadRequest, "invalid_request"
+            switch {
+            case errors.Is(err, ErrUnknownPath):
+                status, reason = http.StatusNotFound, "unknown_path"
+            case errors.Is(err, ErrMethodNotAllowed):
+                status, reason = http.StatusMethodNotAllowed, "method_not_allowed"
+                writer.Header().Set("Allow", strings.Join(config.Spec.allowed(requestPath), ", "))
+            }
+            config.Registry.Counter("lb_openapi_rejections_total", "Requests rejected for not matching the route's OpenAPI spec.", "spec", config.Name, "reason", reason).Inc()
+            http.Error(writer, err.Error(), status)
+        })
+    }
+}
@@ -0,0 +1,181 @@
+package openapi
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "load-balancer/internal/metrics"
+)
+
+const petstore = `{
+  "openapi": "3.0.3",
+  "info": {"title": "Pets", "version": "1"},
+  "paths": {
+    "/pets": {
+      "get": {
+        "parameters": [
+          {"name": "limit", "in": "query", "schema": {"type": "integer"}},
+          {"name": "status", "in": "query", "schema": {"type": "string", "enum": ["available", "sold"]}}
+        ]
+      },
+      "post": {
+        "parameters": [{"name": "X-Request-Source", "in": "header", "required": true}],
+        "requestBody": {"required": true, "content": {"application/json": {}}}
+      }
+    },
+    "/pets/{petId}": {
+      "parameters": [{"name": "petId", "in": "path", "required": true, "schema": {"type": "integer"}}],
+      "get": {},
+      "delete": {}
+    },
+    "/pets/mine": {
+      "get": {}
+    }
+  }
+}`
+
+func TestLoad_Errors(t *testing.T) {
+    tests := []struct {
+        name string
+        spec string
+    }{
+        {name: "not json", spec: "openapi: 3.0.0"},
+        {name: "swagger 2", spec: `{"swagger": "2.0", "paths": {"/a": {}}}`},
+        {name: "no paths", spec: `{"openapi": "3.1.0"}`},
+        {name: "relative path", spec: `{"openapi": "3.1.0", "paths": {"pets": {}}}`},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if _, err := Load([]byte(tt.spec)); err == nil {
+                t.Errorf("Expected an error")
+            }
+        })
+    }
+}
+
+func TestMiddleware(t *testing.T) {
+    spec, err := Load([]byte(petstore))
+    if err != nil {
+        t.Fatalf("Load() error: %v", err)
+    }
+    registry := metrics.NewRegistry()
+    handler := Middleware(Config{Name: "pets", Spec: spec, BasePath: "/api/", Registry: registry})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusOK)
+    }))
+
+    tests := []struct {
+        name           string
+        method         string
+        target         string
+        header         string
+        body           string
+        expectedStatus int
+        expectedAllow  string
+        expectedError  string
+    }{
+        {name: "defined operation", method: http.MethodGet, target: "/api/pets?limit=10", expectedStatus: http.StatusOK},
+        {name: "head follows get", method: http.MethodHead, target: "/api/pets", expectedStatus: http.StatusOK},
+        {name: "path template", method: http.MethodDelete, target: "/api/pets/42", expectedStatus: http.StatusOK},
+        {name: "concrete path wins", method: http.MethodGet, target: "/api/pets/mine", expectedStatus: http.StatusOK},
+        {name: "outside the base path", method: http.MethodGet, target: "/other", expectedStatus: http.StatusOK},
+        {name: "base path is a whole segment", method: http.MethodGet, target: "/apis/owners", expectedStatus: http.StatusOK},
+        {name: "unknown path", method: http.MethodGet, target: "/api/owners", expectedStatus: http.StatusNotFound},
+        {name: "too deep", method: http.MethodGet, target: "/api/pets/42/toys", expectedStatus: http.StatusNotFound},
+        {name: "wrong method", method: http.MethodPut, target: "/api/pets/42", expectedStatus: http.StatusMethodNotAllowed, expectedAllow: "GET, DELETE"},
+        {name: "malformed path parameter", method: http.MethodGet, target: "/api/pets/rex", expectedStatus: http.StatusBadRequest, expectedError: `path parameter "petId" must be an integer`},
+        {name: "malformed query parameter", method: http.MethodGet, target: "/api/pets?limit=ten", expectedStatus: http.StatusBadRequest, expectedError: "must be an integer"},
+        {name: "value outside enum", method: http.MethodGet, target: "/api/pets?status=lost", expectedStatus: http.StatusBadRequest, expectedError: "must be one of available, sold"},
+        {name: "missing required header and body", method: http.MethodPost, target: "/api/pets", expectedStatus: http.StatusBadRequest, expectedError: `missing header parameter "X-Request-Source"; missing request body`},
+        {name: "complete post", method: http.MethodPost, target: "/api/pets", header: "web", body: `{"name":"rex"}`, expectedStatus: http.StatusOK},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var request *http.Request
+            if tt.body != "" {
+                request = httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+            } else {
+                request = httptest.NewRequest(tt.method, tt.target, nil)
+            }
+            if tt.header != "" {
+                request.Header.Set("X-Request-Source", tt.header)
+            }
+            rr := httptest.NewRecorder()
+            handler.ServeHTTP(rr, request)
+
+            if rr.Code != tt.expectedStatus {
+                t.Fatalf("Expected status %d, got %d (%s)", tt.expectedStatus, rr.Code, rr.Body.String())
+            }
+            if allow := rr.Header().Get("Allow"); allow != tt.expectedAllow {
+                t.Errorf("Expected Allow %q, got %q", tt.expectedAllow, allow)
+            }
+            if !strings.Contains(rr.Body.String(), tt.expectedError) {
+                t.Errorf("Expected the error to mention %q, got %q", tt.expectedError, rr.Body.String())
+            }
+        })
+    }
+
+    if rejected := registry.Counter("lb_openapi_rejections_total", "", "spec", "pets", "reason", "invalid_request").Value(); rejected != 4 {
+        t.Errorf("Expected 4 invalid requests, got %v", rejected)
+    }
+}
+
+func TestSpec_BodySchemas(t *testing.T) {
+    spec, err := Load([]byte(`{
+      "openapi": "3.0.3",
+      "paths": {
+        "/pets": {
+          "post": {
+            "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}}
+          },
+          "get": {}
+        },
+        "/pets/{petId}/photo": {
+          "put": {"requestBody": {"content": {"image/png": {"schema": {"type": "string"}}}}}
+        }
+      },
+      "components": {
+        "schemas": {
+          "Pet": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}}
+        }
+      }
+    }`))
+    if err != nil {
+        t.Fatalf("Load() error: %v", err)
+    }
+    lookup := spec.BodySchemas("/api")
+
+    tests := []struct {
+        name     string
+        method   string
+        target   string
+        expected bool
+    }{
+        {name: "json body", method: http.MethodPost, target: "/api/pets", expected: true},
+        {name: "no body", method: http.MethodGet, target: "/api/pets"},
+        {name: "non-json body", method: http.MethodPut, target: "/api/pets/1/photo"},
+        {name: "unknown path", method: http.MethodPost, target: "/api/owners"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            schema := lookup(httptest.NewRequest(tt.method, tt.target, nil))
+            if (schema != nil) != tt.expected {
+                t.Fatalf("Expected a schema %v, got %v", tt.expected, schema != nil)
+            }
+            if schema == nil {
+                return
+            }
+            if errs := schema.Validate(map[string]any{}); len(errs) != 1 || !strings.Contains(errs[0].Message, `"name"`) {
+                t.Errorf("Expected the referenced Pet schema to require a name, got %v", errs)
+            }
+        })
+    }
+
+    if _, err := Load([]byte(`{"openapi": "3.0.3", "paths": {"/a": {"post": {"requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Missing"}}}}}}}}`)); err == nil {
+        t.Errorf("Expected an error for an unresolved body schema $ref")
+    }
+}
@@ -0,0 +1,219 @@
+package plan
+
+import (
+    "fmt"
+    "slices"
+    "sort"
+    "strings"
+
+    "load-balancer/internal/balancer"
+)
+
+// State is what a reload can change, reduced to comparable strings: the
+// address of each listener, the backend URLs of each pool and a description
+// of each route, all by name. Routes without a name or sharing one are
+// keyed by name and position instead ("#2", "api#3"), and RouteOrder lists
+// the route keys in the order they match, since moving a route changes
+// which requests it takes.
+type State struct {
+    Listeners  map[string]string   `json:"listeners"`
+    Pools      map[string][]string `json:"pools"`
+    Routes     map[string]string   `json:"routes"`
+    RouteOrder []string            `json:"route_order,omitempty"`
+}
+
+// Capture describes the running configuration of router, with listeners
+// given as addresses by name.
+func Capture(router *balancer.Router, listeners map[string]string) State {
+    state := State{Listeners: listeners, Pools: make(map[string][]string), Routes: make(map[string]string)}
+    for name, pool := range router.Pools() {
+        backends := []string{}
+        for _, peer := range pool.Backends() {
+            backends = append(backends, peer.URL.String())
+        }
+        state.Pools[name] = backends
+    }
+    routes := router.Routes()
+    state.RouteOrder = RouteKeys(routes)
+    for i, route := range routes {
+        state.Routes[state.RouteOrder[i]] = DescribeRoute(route)
+    }
+    return state
+}
+
+// RouteKeys returns the keys routes are known by in a State: their name
+// when it is set and unique, otherwise their name and 1-based position.
+func RouteKeys(routes []balancer.Route) []string {
+    names := make(map[string]int, len(routes))
+    for _, route := range routes {
+        names[route.Name]++
+    }
+    keys := make([]string, len(routes))
+    for i, route := range routes {
+        keys[i] = route.Name
+        if route.Name == "" || names[route.Name] > 1 {
+            keys[i] = fmt.Sprintf("%s#%d", route.Name, i+1)
+        }
+    }
+    return keys
+}
+
+// DescribeRoute sums up what a route matches and where it sends requests.
+// Middleware cannot be compared and is left out.
+func DescribeRoute(route balancer.Route) string {
+    var parts []string
+    add := func(key, value string) {
+        if value != "" {
+            parts = append(parts, key+"="+value)
+        }
+    }
+    add("host", route.Host)
+    add("prefix", route.PathPrefix)
+    add("methods", strings.Join(route.Methods, ","))
+    pool := route.Pool
+    if pool == "" {
+        pool = "(default)"
+    }
+    add("pool", pool)
+    if route.Timeout > 0 {
+        add("timeout", route.Timeout.String())
+    }
+    if route.Failover != nil {
+        add("failover", fmt.Sprintf("%s@%g", route.Failover.Secondary, route.Failover.Threshold))
+    }
+    if route.Fallback != nil {
+        add("fallback", route.Fallback.Pool)
+    }
+    if route.Stale != nil {
+        add("stale", "on")
+    }
+    if route.MaxResponseBytes > 0 {
+        add("max_response_bytes", fmt.Sprint(route.MaxResponseBytes))
+    }
+    if route.Auth != nil {
+        add("auth", "on")
+    }
+    return strings.Join(parts, " ")
+}
+
+// Change is one difference between two states. Kind is listener, pool,
+// backend or route; Action is add, remove, change, rebind for a listener
+// moving address or reorder for routes that match in a different order.
+// Backend changes are named by their pool.
+type Change struct {
+    Kind   string `json:"kind"`
+    Action string `json:"action"`
+    Name   string `json:"name"`
+    From   string `json:"from,omitempty"`
+    To     string `json:"to,omitempty"`
+}
+
+func (change Change) String() string {
+    switch change.Action {
+    case "add":
+        return fmt.Sprintf("+ %s %s: %s", change.Kind, change.Name, change.To)
+    case "remove":
+        return fmt.Sprintf("- %s %s: %s", change.Kind, change.Name, change.From)
+    }
+    return fmt.Sprintf("~ %s %s: %s -> %s (%s)", change.Kind, change.Name, change.From, change.To, change.Action)
+}
+
+// Plan lists the changes a reload would make, listeners first, then pools
+// and their backends, then routes.
+type Plan struct {
+    Changes []Change `json:"changes"`
+}
+
+func (plan Plan) Empty() bool {
+    return len(plan.Changes) == 0
+}
+
+// String renders the plan one change per line, + for additions, - for
+// removals and ~ for changes.
+func (plan Plan) String() string {
+    if plan.Empty() {
+        return "no changes"
+    }
+    lines := make([]string, len(plan.Changes))
+    for i, change := range plan.Changes {
+        lines[i] = change.String()
+    }
+    return strings.Join(lines, "\n")
+}
+
+// Diff computes the plan taking current to next.
+func Diff(current, next State) Plan {
+    var plan Plan
+    diffMap(&plan, "listener", "rebind", current.Listeners, next.Listeners)
+
+    for _, name := range keys(current.Pools, next.Pools) {
+        from, inCurrent := current.Pools[name]
+        to, inNext := next.Pools[name]
+        switch {
+        case !inCurrent:
+            plan.Changes = append(plan.Changes, Change{Kind: "pool", Action: "add", Name: name, To: fmt.Sprintf("%d backends", len(to))})
+        case !inNext:
+            plan.Changes = append(plan.Changes, Change{Kind: "pool", Action: "remove", Name: name, From: fmt.Sprintf("%d backends", len(from))})
+            continue
+        }
+        for _, url := range to {
+            if !slices.Contains(from, url) {
+                plan.Changes = append(plan.Changes, Change{Kind: "backend", Action: "add", Name: name, To: url})
+            }
+        }
+        for _, url := range from {
+            if !slices.Contains(to, url) {
+                plan.Changes = append(plan.Changes, Change{Kind: "backend", Action: "remove", Name: name, From: url})
+            }
+        }
+    }
+
+    diffMap(&plan, "route", "change", current.Routes, next.Routes)
+    if from, to := kept(current.RouteOrder, next.RouteOrder), kept(next.RouteOrder, current.RouteOrder); !slices.Equal(from, to) {
+        plan.Changes = append(plan.Changes, Change{Kind: "route", Action: "reorder", Name: "order", From: strings.Join(from, ","), To: strings.Join(to, ",")})
+    }
+    return plan
+}
+
+// kept returns the keys of order that other has too, so added and removed
+// routes do not count as reordering.
+func kept(order, other []string) []string {
+    var keys []string
+    for _, key := range order {
+        if slices.Contains(other, key) {
+            keys = append(keys, key)
+        }
+    }
+    return keys
+}
+
+func diffMap(plan *Plan, kind, changed string, current, next map[string]string) {
+    for _, name := range keys(current, next) {
+        from, inCurrent := current[name]
+        to, inNext := next[name]
+        switch {
+        case !inCurrent:
+            plan.Changes = append(plan.Changes, Change{Kind: kind, Action: "add", Name: name, To: to})
+        case !inNext:
+            plan.Changes = append(plan.Changes, Change{Kind: kind, Action: "remove", Name: name, From: from})
+        case from != to:
+            plan.Changes = append(plan.Changes, Change{Kind: kind, Action: changed, Name: name, From: from, To: to})
+        }
+    }
+}
+
+// keys returns the names found in either map, sorted so plans read the same
+// every time.
+func keys[V any](current, next map[string]V) []string {
+    var names []string
+    for name := range current {
+        names = append(names, name)
+    }
+    for name := range next {
+        if _, ok := current[name]; !ok {
+            names = append(names, name)
+        }
+    }
+    sort.Strings(names)
+    return names
+}
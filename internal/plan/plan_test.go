@@ -0,0 +1,160 @@
+package plan
+
+import (
+    "errors"
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+)
+
+func TestDiff(t *testing.T) {
+    current := State{
+        Listeners: map[string]string{"http": ":80", "https": ":443"},
+        Pools:     map[string][]string{"web": {"http://10.0.0.1", "http://10.0.0.2"}, "old": {"http://10.0.0.9"}},
+        Routes:    map[string]string{"api": "prefix=/api pool=web", "static": "prefix=/static pool=web"},
+    }
+    next := State{
+        Listeners: map[string]string{"http": ":80", "https": ":8443"},
+        Pools:     map[string][]string{"web": {"http://10.0.0.2", "http://10.0.0.3"}, "api": {"http://10.0.1.1"}},
+        Routes:    map[string]string{"api": "prefix=/api pool=api", "static": "prefix=/static pool=web"},
+    }
+
+    expected := []string{
+        "~ listener https: :443 -> :8443 (rebind)",
+        "+ pool api: 1 backends",
+        "+ backend api: http://10.0.1.1",
+        "- pool old: 1 backends",
+        "+ backend web: http://10.0.0.3",
+        "- backend web: http://10.0.0.1",
+        "~ route api: prefix=/api pool=web -> prefix=/api pool=api (change)",
+    }
+    if plan := Diff(current, next).String(); plan != strings.Join(expected, "\n") {
+        t.Errorf("Expected plan:\n%s\ngot:\n%s", strings.Join(expected, "\n"), plan)
+    }
+    if plan := Diff(next, next); !plan.Empty() || plan.String() != "no changes" {
+        t.Errorf("Expected no changes, got %q", plan.String())
+    }
+}
+
+func TestDiff_RouteOrder(t *testing.T) {
+    current := State{
+        Routes:     map[string]string{"api": "prefix=/api pool=web", "static": "prefix=/static pool=web", "old": "prefix=/old pool=web"},
+        RouteOrder: []string{"api", "old", "static"},
+    }
+    next := State{
+        Routes:     map[string]string{"api": "prefix=/api pool=web", "static": "prefix=/static pool=web", "new": "prefix=/new pool=web"},
+        RouteOrder: []string{"new", "static", "api"},
+    }
+
+    expected := []string{
+        "+ route new: prefix=/new pool=web",
+        "- route old: prefix=/old pool=web",
+        "~ route order: api,static -> static,api (reorder)",
+    }
+    if plan := Diff(current, next).String(); plan != strings.Join(expected, "\n") {
+        t.Errorf("Expected plan:\n%s\ngot:\n%s", strings.Join(expected, "\n"), plan)
+    }
+}
+
+func TestRouteKeys(t *testing.T) {
+    routes := []balancer.Route{{Name: "api"}, {}, {Name: "web"}, {Name: "web"}, {}}
+    expected := []string{"api", "#2", "web#3", "web#4", "#5"}
+    if keys := RouteKeys(routes); strings.Join(keys, " ") != strings.Join(expected, " ") {
+        t.Errorf("Expected keys %v, got %v", expected, keys)
+    }
+}
+
+func TestCapture(t *testing.T) {
+    router := balancer.NewRouter("web")
+    pool := balancer.NewServerPool()
+    serverURL, _ := url.Parse("http://10.0.0.1:8080")
+    pool.AddBackend(&backend.Backend{URL: serverURL, Alive: true})
+    router.AddPool("web", pool)
+    router.AddRoute(balancer.Route{Name: "api", Host: "example.com", PathPrefix: "/api", Methods: []string{"GET"}, Timeout: time.Second, Stale: &balancer.Stale{}})
+
+    state := Capture(router, map[string]string{"http": ":80"})
+    if backends := state.Pools["web"]; len(backends) != 1 || backends[0] != "http://10.0.0.1:8080" {
+        t.Errorf("Expected the web pool's backend, got %v", backends)
+    }
+    if route := state.Routes["api"]; route != "host=example.com prefix=/api methods=GET pool=(default) timeout=1s stale=on" {
+        t.Errorf("Expected the api route described, got %q", route)
+    }
+}
+
+func TestReloader(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    current := State{Pools: map[string][]string{"web": {"http://10.0.0.1"}}}
+    next := State{Pools: map[string][]string{"web": {"http://10.0.0.2"}}}
+
+    tests := []struct {
+        name            string
+        next            State
+        loadErr         error
+        planOnly        bool
+        expectedApplied bool
+        expectedChanges int
+        expectedErr     bool
+    }{
+        {name: "applies changes", next: next, expectedApplied: true, expectedChanges: 2},
+        {name: "plan only", next: next, planOnly: true, expectedChanges: 2},
+        {name: "nothing to change", next: current},
+        {name: "unreadable configuration", loadErr: errors.New("bad yaml"), expectedErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            applied := false
+            config := Config{
+                Load:     func() (State, error) { return tt.next, tt.loadErr },
+                Current:  func() State { return current },
+                PlanOnly: tt.planOnly,
+            }
+            if !tt.planOnly {
+                config.Apply = func() error { applied = true; return nil }
+            }
+            reloader, err := New(config)
+            if err != nil {
+                t.Fatalf("New() error: %v", err)
+            }
+
+            plan, ok, err := reloader.Reload()
+            if (err != nil) != tt.expectedErr {
+                t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+            }
+            if ok != tt.expectedApplied || applied != tt.expectedApplied {
+                t.Errorf("Expected applied %v, got %v (apply called %v)", tt.expectedApplied, ok, applied)
+            }
+            if len(plan.Changes) != tt.expectedChanges {
+                t.Errorf("Expected %d changes, got %d", tt.expectedChanges, len(plan.Changes))
+            }
+        })
+    }
+}
+
+func TestReloader_Register(t *testing.T) {
+    reloader, _ := New(Config{
+        Load:     func() (State, error) { return State{Listeners: map[string]string{"http": ":8080"}}, nil },
+        Current:  func() State { return State{Listeners: map[string]string{"http": ":80"}} },
+        PlanOnly: true,
+    })
+    server := admin.NewServer(nil)
+    reloader.Register(server)
+
+    rr := httptest.NewRecorder()
+    server.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/reload/plan?format=text", nil))
+    if rr.Code != http.StatusOK || rr.Body.String() != "~ listener http: :80 -> :8080 (rebind)\n" {
+        t.Errorf("Expected the text plan, got %d: %q", rr.Code, rr.Body.String())
+    }
+}
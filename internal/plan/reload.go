@@ -0,0 +1,103 @@
+package plan
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "strings"
+    "sync"
+
+    "load-balancer/internal/admin"
+)
+
+// Config describes a reload. Load reads the new configuration and returns
+// its state, Current returns the running state and Apply puts the
+// configuration Load last read into effect. With PlanOnly, as set by
+// --plan-only, reloads log their plan and change nothing, so operators can
+// check a configuration before it takes effect; Apply may then be nil.
+type Config struct {
+    Load     func() (State, error)
+    Current  func() State
+    Apply    func() error
+    PlanOnly bool
+}
+
+type Reloader struct {
+    config Config
+    mux    sync.Mutex
+}
+
+func New(config Config) (*Reloader, error) {
+    if config.Load == nil || config.Current == nil {
+        return nil, errors.New("plan: load and current are required")
+    }
+    if config.Apply == nil && !config.PlanOnly {
+        return nil, errors.New("plan: apply is required unless planning only")
+    }
+    return &Reloader{config: config}, nil
+}
+
+// Plan loads the new configuration and returns what reloading it would
+// change, without applying it.
+func (reloader *Reloader) Plan() (Plan, error) {
+    reloader.mux.Lock()
+    defer reloader.mux.Unlock()
+
+    return reloader.plan()
+}
+
+func (reloader *Reloader) plan() (Plan, error) {
+    next, err := reloader.config.Load()
+    if err != nil {
+        return Plan{}, fmt.Errorf("plan: loading configuration: %w", err)
+    }
+    return Diff(reloader.config.Current(), next), nil
+}
+
+// Reload logs the plan of the new configuration and applies it, unless
+// there is nothing to change or the reloader only plans. It returns the
+// plan and whether it was applied.
+func (reloader *Reloader) Reload() (Plan, bool, error) {
+    reloader.mux.Lock()
+    defer reloader.mux.Unlock()
+
+    plan, err := reloader.plan()
+    if err != nil {
+        return plan, false, err
+    }
+    for _, line := range strings.Split(plan.String(), "\n") {
+        log.Printf("reload plan: %s\n", line)
+    }
+    if plan.Empty() {
+        return plan, false, nil
+    }
+    if reloader.config.PlanOnly {
+        log.Printf("reload: planning only, %d changes not applied\n", len(plan.Changes))
+        return plan, false, nil
+    }
+    if err := reloader.config.Apply(); err != nil {
+        return plan, false, fmt.Errorf("plan: applying configuration: %w", err)
+    }
+    log.Printf("reload: applied %d changes\n", len(plan.Changes))
+    return plan, true, nil
+}
+
+// Register serves the plan of the configuration on disk at
+// GET /admin/reload/plan, as JSON or, for ?format=text, as the lines Reload
+// logs.
+func (reloader *Reloader) Register(server *admin.Server) {
+    server.HandleFunc("GET /admin/reload/plan", func(writer http.ResponseWriter, request *http.Request) {
+        plan, err := reloader.Plan()
+        if err != nil {
+            admin.WriteError(writer, http.StatusUnprocessableEntity, err.Error())
+            return
+        }
+        if request.URL.Query().Get("format") == "text" {
+            writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+            fmt.Fprintln(writer, plan.String())
+            return
+        }
+        admin.WriteJSON(writer, http.StatusOK, plan)
+    })
+}
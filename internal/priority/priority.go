@@ -0,0 +1,249 @@
+package priority
+
+import (
+    "container/list"
+    "fmt"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+)
+
+type Class int
+
+const (
+    Batch Class = iota + 1
+    Normal
+    Critical
+)
+
+var classNames = [...]string{Batch: "batch", Normal: "normal", Critical: "critical"}
+
+func (class Class) String() string {
+    if !class.valid() {
+        return fmt.Sprintf("class(%d)", int(class))
+    }
+    return classNames[class]
+}
+
+func ParseClass(name string) (Class, error) {
+    for class := Batch; class <= Critical; class++ {
+        if strings.EqualFold(name, classNames[class]) {
+            return class, nil
+        }
+    }
+    return Normal, fmt.Errorf("priority: unknown class %q", name)
+}
+
+// Config maps requests to classes. The header, when set and present, wins;
+// then the matched route's name; then the longest matching path prefix.
+// Default falls back to Normal. The header should only be trusted when it is
+// set by an upstream proxy.
+type Config struct {
+    MaxConcurrent int
+    MaxQueue      int
+    QueueTimeout  map[Class]time.Duration
+    Header        string
+    Routes        map[string]Class
+    PathPrefixes  map[string]Class
+    Default       Class
+    Registry      *metrics.Registry
+}
+
+type waiter struct {
+    class    Class
+    admitted chan bool
+}
+
+// Scheduler admits at most MaxConcurrent requests. Excess requests wait in
+// per-class queues and are released highest class first; when the queue is
+// full a newcomer displaces the newest waiter of a lower class, so batch
+// traffic is shed before normal traffic and critical traffic is shed last.
+type Scheduler struct {
+    config Config
+
+    mux      sync.Mutex
+    inFlight int
+    queues   [len(classNames)]*list.List
+    queued   int
+
+    depth [len(classNames)]*metrics.Gauge
+    shed  [len(classNames)]*metrics.Counter
+}
+
+// NewScheduler returns a scheduler for config, or an error when config
+// names a class that does not exist.
+func NewScheduler(config Config) (*Scheduler, error) {
+    if config.MaxConcurrent <= 0 {
+        config.MaxConcurrent = 100
+    }
+    if config.MaxQueue < 0 {
+        config.MaxQueue = 0
+    }
+    timeouts := map[Class]time.Duration{Critical: 10 * time.Second, Normal: 2 * time.Second, Batch: 30 * time.Second}
+    for class, timeout := range config.QueueTimeout {
+        timeouts[class] = timeout
+    }
+    config.QueueTimeout = timeouts
+    if config.Default == 0 {
+        config.Default = Normal
+    }
+    if err := config.validate(); err != nil {
+        return nil, err
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+
+    scheduler := &Scheduler{config: config}
+    for class := Batch; class <= Critical; class++ {
+        name := class.String()
+        scheduler.queues[class] = list.New()
+        scheduler.depth[class] = config.Registry.Gauge("lb_priority_queue_depth", "Requests waiting for admission.", "class", name)
+        scheduler.shed[class] = config.Registry.Counter("lb_priority_shed_total", "Requests rejected or displaced while waiting for admission.", "class", name)
+    }
+    return scheduler, nil
+}
+
+func (class Class) valid() bool {
+    return class >= Batch && class <= Critical
+}
+
+func (config Config) validate() error {
+    if !config.Default.valid() {
+        return fmt.Errorf("priority: invalid default %s", config.Default)
+    }
+    for class := range config.QueueTimeout {
+        if !class.valid() {
+            return fmt.Errorf("priority: queue timeout for invalid %s", class)
+        }
+    }
+    for route, class := range config.Routes {
+        if !class.valid() {
+            return fmt.Errorf("priority: invalid %s for route %q", class, route)
+        }
+    }
+    for prefix, class := range config.PathPrefixes {
+        if !class.valid() {
+            return fmt.Errorf("priority: invalid %s for path prefix %q", class, prefix)
+        }
+    }
+    return nil
+}
+
+func (scheduler *Scheduler) Classify(request *http.Request) Class {
+    if scheduler.config.Header != "" {
+        if value := request.Header.Get(scheduler.config.Header); value != "" {
+            if class, err := ParseClass(value); err == nil {
+                return class
+            }
+        }
+    }
+    if route := balancer.RouteFromContext(request.Context()); route != nil {
+        if class, ok := scheduler.config.Routes[route.Name]; ok {
+            return class
+        }
+    }
+
+    class, longest := scheduler.config.Default, -1
+    for prefix, candidate := range scheduler.config.PathPrefixes {
+        if strings.HasPrefix(request.URL.Path, prefix) && len(prefix) > longest {
+            class, longest = candidate, len(prefix)
+        }
+    }
+    return class
+}
+
+func (scheduler *Scheduler) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        class := scheduler.Classify(request)
+        if !scheduler.acquire(request, class) {
+            writer.Header().Set("Retry-After", "1")
+            http.Error(writer, "Service Unavailable", http.StatusServiceUnavailable)
+            return
+        }
+        defer scheduler.release()
+
+        next.ServeHTTP(writer, request)
+    })
+}
+
+func (scheduler *Scheduler) acquire(request *http.Request, class Class) bool {
+    scheduler.mux.Lock()
+    if scheduler.inFlight < scheduler.config.MaxConcurrent && scheduler.queued == 0 {
+        scheduler.inFlight++
+        scheduler.mux.Unlock()
+        return true
+    }
+    if scheduler.queued >= scheduler.config.MaxQueue && !scheduler.displaceLocked(class) {
+        scheduler.mux.Unlock()
+        scheduler.shed[class].Inc()
+        return false
+    }
+
+    current := &waiter{class: class, admitted: make(chan bool, 1)}
+    element := scheduler.queues[class].PushBack(current)
+    scheduler.queued++
+    scheduler.depth[class].Add(1)
+    scheduler.mux.Unlock()
+
+    timer := time.NewTimer(scheduler.config.QueueTimeout[class])
+    defer timer.Stop()
+
+    select {
+    case admitted := <-current.admitted:
+        return admitted
+    case <-timer.C:
+    case <-request.Context().Done():
+    }
+
+    scheduler.mux.Lock()
+    defer scheduler.mux.Unlock()
+    select {
+    case admitted := <-current.admitted:
+        return admitted
+    default:
+    }
+    scheduler.queues[class].Remove(element)
+    scheduler.queued--
+    scheduler.depth[class].Add(-1)
+    scheduler.shed[class].Inc()
+    return false
+}
+
+// displaceLocked rejects the newest waiter of the lowest class below class
+// to make room for it.
+func (scheduler *Scheduler) displaceLocked(class Class) bool {
+    for lower := Batch; lower < class; lower++ {
+        queue := scheduler.queues[lower]
+        if back := queue.Back(); back != nil {
+            queue.Remove(back)
+            scheduler.queued--
+            scheduler.depth[lower].Add(-1)
+            scheduler.shed[lower].Inc()
+            back.Value.(*waiter).admitted <- false
+            return true
+        }
+    }
+    return false
+}
+
+func (scheduler *Scheduler) release() {
+    scheduler.mux.Lock()
+    defer scheduler.mux.Unlock()
+
+    for class := Critical; class >= Batch; class-- {
+        queue := scheduler.queues[class]
+        if front := queue.Front(); front != nil {
+            queue.Remove(front)
+            scheduler.queued--
+            scheduler.depth[class].Add(-1)
+            front.Value.(*waiter).admitted <- true
+            return
+        }
+    }
+    scheduler.inFlight--
+}
@@ -0,0 +1,217 @@
+package priority
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "time"
+
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+)
+
+func TestParseClass(t *testing.T) {
+    tests := []struct {
+        name      string
+        expected  Class
+        expectErr bool
+    }{
+        {name: "critical", expected: Critical},
+        {name: "Normal", expected: Normal},
+        {name: "BATCH", expected: Batch},
+        {name: "urgent", expected: Normal, expectErr: true},
+    }
+
+    for _, tt := range tests {
+        class, err := ParseClass(tt.name)
+        if class != tt.expected || (err != nil) != tt.expectErr {
+            t.Errorf("ParseClass(%q) = %v, %v", tt.name, class, err)
+        }
+    }
+}
+
+func TestNewScheduler_InvalidClass(t *testing.T) {
+    tests := []struct {
+        name   string
+        config Config
+    }{
+        {name: "default", config: Config{Default: Class(7)}},
+        {name: "route", config: Config{Routes: map[string]Class{"payments": Class(-1)}}},
+        {name: "path prefix", config: Config{PathPrefixes: map[string]Class{"/reports": Class(4)}}},
+        {name: "queue timeout", config: Config{QueueTimeout: map[Class]time.Duration{Class(9): time.Second}}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            tt.config.Registry = metrics.NewRegistry()
+            if _, err := NewScheduler(tt.config); err == nil {
+                t.Errorf("Expected an error")
+            }
+        })
+    }
+}
+
+func TestScheduler_Classify(t *testing.T) {
+    scheduler, _ := NewScheduler(Config{
+        Header:       "X-Priority",
+        Routes:       map[string]Class{"payments": Critical},
+        PathPrefixes: map[string]Class{"/reports": Batch, "/reports/live": Normal, "/healthz": Critical},
+        Default:      Normal,
+        Registry:     metrics.NewRegistry(),
+    })
+
+    var routed *http.Request
+    router := balancer.NewRouter("default")
+    router.AddRoute(balancer.Route{Name: "payments", PathPrefix: "/pay", Middleware: []func(http.Handler) http.Handler{
+        func(http.Handler) http.Handler {
+            return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { routed = r })
+        },
+    }})
+
+    tests := []struct {
+        name     string
+        path     string
+        header   string
+        routed   bool
+        expected Class
+    }{
+        {name: "default", path: "/", expected: Normal},
+        {name: "path prefix", path: "/reports/2024", expected: Batch},
+        {name: "longest prefix wins", path: "/reports/live/1", expected: Normal},
+        {name: "route name", path: "/pay/card", routed: true, expected: Critical},
+        {name: "header overrides", path: "/healthz", header: "batch", expected: Batch},
+        {name: "unknown header value ignored", path: "/healthz", header: "vip", expected: Critical},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            req := httptest.NewRequest("GET", tt.path, nil)
+            if tt.header != "" {
+                req.Header.Set("X-Priority", tt.header)
+            }
+            if tt.routed {
+                router.ServeHTTP(httptest.NewRecorder(), req)
+                req = routed
+            }
+            if got := scheduler.Classify(req); got != tt.expected {
+                t.Errorf("Classify() = %v, expected %v", got, tt.expected)
+            }
+        })
+    }
+}
+
+func TestScheduler_PriorityOrder(t *testing.T) {
+    scheduler, _ := NewScheduler(Config{MaxConcurrent: 1, MaxQueue: 10, Registry: metrics.NewRegistry()})
+
+    background := httptest.NewRequest("GET", "/", nil)
+    if !scheduler.acquire(background, Normal) {
+        t.Fatal("Expected first request to be admitted")
+    }
+
+    var mux sync.Mutex
+    var order []Class
+    var wg sync.WaitGroup
+    for i, class := range []Class{Batch, Normal, Critical} {
+        wg.Add(1)
+        go func(class Class) {
+            defer wg.Done()
+            if scheduler.acquire(httptest.NewRequest("GET", "/", nil), class) {
+                mux.Lock()
+                order = append(order, class)
+                mux.Unlock()
+                scheduler.release()
+            }
+        }(class)
+        waitForQueued(t, scheduler, i+1)
+    }
+
+    scheduler.release()
+    wg.Wait()
+
+    expected := []Class{Critical, Normal, Batch}
+    for i := range expected {
+        if i >= len(order) || order[i] != expected[i] {
+            t.Fatalf("Admission order %v, expected %v", order, expected)
+        }
+    }
+}
+
+func waitForQueued(t *testing.T, scheduler *Scheduler, expected int) {
+    t.Helper()
+
+    deadline := time.Now().Add(2 * time.Second)
+    for {
+        scheduler.mux.Lock()
+        queued := scheduler.queued
+        scheduler.mux.Unlock()
+        if queued == expected {
+            return
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("Expected %d queued requests, got %d", expected, queued)
+        }
+        time.Sleep(time.Millisecond)
+    }
+}
+
+func TestScheduler_ShedsLowerClassesFirst(t *testing.T) {
+    registry := metrics.NewRegistry()
+    scheduler, _ := NewScheduler(Config{MaxConcurrent: 1, MaxQueue: 1, Registry: registry})
+    scheduler.acquire(httptest.NewRequest("GET", "/", nil), Normal)
+
+    batchResult := make(chan bool)
+    go func() { batchResult <- scheduler.acquire(httptest.NewRequest("GET", "/", nil), Batch) }()
+    waitForQueued(t, scheduler, 1)
+
+    criticalResult := make(chan bool)
+    go func() { criticalResult <- scheduler.acquire(httptest.NewRequest("GET", "/", nil), Critical) }()
+
+    if <-batchResult {
+        t.Error("Expected batch waiter to be displaced by critical request")
+    }
+    waitForQueued(t, scheduler, 1)
+
+    if scheduler.acquire(httptest.NewRequest("GET", "/", nil), Normal) {
+        t.Error("Expected normal request to be rejected while a critical request holds the queue")
+    }
+
+    scheduler.release()
+    if !<-criticalResult {
+        t.Error("Expected critical request to be admitted")
+    }
+}
+
+func TestScheduler_QueueTimeout(t *testing.T) {
+    scheduler, _ := NewScheduler(Config{
+        MaxConcurrent: 1,
+        MaxQueue:      5,
+        QueueTimeout:  map[Class]time.Duration{Normal: 20 * time.Millisecond},
+        Registry:      metrics.NewRegistry(),
+    })
+    handler := scheduler.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    scheduler.acquire(httptest.NewRequest("GET", "/", nil), Normal)
+
+    rr := httptest.NewRecorder()
+    handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+    if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+        t.Errorf("Expected 503 with Retry-After, got %d", rr.Code)
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    if scheduler.acquire(httptest.NewRequest("GET", "/", nil).WithContext(ctx), Batch) {
+        t.Error("Expected cancelled request not to be admitted")
+    }
+    if scheduler.queued != 0 {
+        t.Errorf("Expected queue to be empty, got %d", scheduler.queued)
+    }
+
+    scheduler.release()
+    rr = httptest.NewRecorder()
+    handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+    if rr.Code != http.StatusOK {
+        t.Errorf("Expected request to be admitted once capacity frees up, got %d", rr.Code)
+    }
+}
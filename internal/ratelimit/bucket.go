@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+    "sync"
+    "time"
+)
+
+type Bucket struct {
+    mux    sync.Mutex
+    rate   float64
+    burst  float64
+    tokens float64
+    last   time.Time
+}
+
+func NewBucket(rate, burst float64) *Bucket {
+    return &Bucket{
+        rate:   rate,
+        burst:  burst,
+        tokens: burst,
+        last:   time.Now(),
+    }
+}
+
+func (bucket *Bucket) Allow() bool {
+    return bucket.AllowN(time.Now(), 1)
+}
+
+func (bucket *Bucket) AllowN(now time.Time, cost float64) bool {
+    bucket.mux.Lock()
+    defer bucket.mux.Unlock()
+
+    bucket.refill(now)
+    if bucket.tokens < cost {
+        return false
+    }
+    bucket.tokens -= cost
+    return true
+}
+
+func (bucket *Bucket) Tokens(now time.Time) float64 {
+    bucket.mux.Lock()
+    defer bucket.mux.Unlock()
+
+    bucket.refill(now)
+    return bucket.tokens
+}
+
+func (bucket *Bucket) refill(now time.Time) {
+    elapsed := now.Sub(bucket.last).Seconds()
+    if elapsed <= 0 {
+        return
+    }
+    bucket.tokens += elapsed * bucket.rate
+    if bucket.tokens > bucket.burst {
+        bucket.tokens = bucket.burst
+    }
+    bucket.last = now
+}
+
+// Charge takes cost tokens whether or not the bucket holds them, leaving
+// it in debt that refills before anything else is allowed; a negative cost
+// gives tokens back, up to the burst. It settles costs only known after a
+// request was allowed.
+func (bucket *Bucket) Charge(now time.Time, cost float64) {
+    bucket.mux.Lock()
+    defer bucket.mux.Unlock()
+
+    bucket.refill(now)
+    bucket.tokens -= cost
+    if bucket.tokens > bucket.burst {
+        bucket.tokens = bucket.burst
+    }
+}
+
+// Wait returns how long until cost tokens are available, zero when they
+// already are. A cost above the burst is never available.
+func (bucket *Bucket) Wait(now time.Time, cost float64) time.Duration {
+    bucket.mux.Lock()
+    defer bucket.mux.Unlock()
+
+    bucket.refill(now)
+    if bucket.tokens >= cost {
+        return 0
+    }
+    return time.Duration((cost - bucket.tokens) / bucket.rate * float64(time.Second))
+}
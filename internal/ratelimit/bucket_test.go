@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+    "testing"
+    "time"
+)
+
+func TestBucket_AllowN(t *testing.T) {
+    start := time.Now()
+
+    tests := []struct {
+        name     string
+        offset   time.Duration
+        cost     float64
+        expected bool
+    }{
+        {name: "burst available", offset: 0, cost: 2, expected: true},
+        {name: "one token left", offset: 0, cost: 1, expected: true},
+        {name: "bucket empty", offset: 0, cost: 1, expected: false},
+        {name: "refilled after half a second", offset: 500 * time.Millisecond, cost: 1, expected: true},
+        {name: "cost above refill", offset: 500 * time.Millisecond, cost: 1, expected: false},
+        {name: "refill capped at burst", offset: time.Hour, cost: 4, expected: false},
+        {name: "full burst after long idle", offset: time.Hour, cost: 3, expected: true},
+    }
+
+    bucket := NewBucket(2, 3)
+    bucket.last = start
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := bucket.AllowN(start.Add(tt.offset), tt.cost); got != tt.expected {
+                t.Errorf("AllowN(%v) = %v, expected %v (tokens %v)", tt.cost, got, tt.expected, bucket.tokens)
+            }
+        })
+    }
+}
+
+func TestBucket_Tokens(t *testing.T) {
+    bucket := NewBucket(10, 5)
+    now := bucket.last
+
+    bucket.AllowN(now, 5)
+    if tokens := bucket.Tokens(now.Add(200 * time.Millisecond)); tokens != 2 {
+        t.Errorf("Tokens() = %v, expected 2", tokens)
+    }
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+    "errors"
+    "net/http"
+    "sync"
+
+    "load-balancer/internal/clientip"
+    "load-balancer/internal/metrics"
+)
+
+// ConcurrencyConfig caps the requests each client, as told apart by Key
+// (default the client IP), may have in flight at once at Max. It is
+// independent of rate limits: a client holding hundreds of slow requests
+// open can monopolize a pool at a request rate no limiter would notice.
+// Requests over the cap are answered 429 without reaching the backends.
+type ConcurrencyConfig struct {
+    Name     string
+    Max      int64
+    Key      func(request *http.Request) string
+    Registry *metrics.Registry
+}
+
+type Concurrency struct {
+    config   ConcurrencyConfig
+    rejected *metrics.Counter
+    clients  *metrics.Gauge
+
+    mux      sync.Mutex
+    inFlight map[string]int64
+}
+
+func NewConcurrency(config ConcurrencyConfig) (*Concurrency, error) {
+    if config.Name == "" {
+        return nil, errors.New("ratelimit: name is required")
+    }
+    if config.Max <= 0 {
+        return nil, errors.New("ratelimit: max must be positive")
+    }
+    if config.Key == nil {
+        config.Key = clientip.Peer
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+    return &Concurrency{
+        config:   config,
+        rejected: config.Registry.Counter("lb_ratelimit_concurrency_rejected_total", "Requests refused for a client already at its in-flight limit.", "limiter", config.Name),
+        clients:  config.Registry.Gauge("lb_ratelimit_concurrency_clients", "Clients with requests in flight.", "limiter", config.Name),
+        inFlight: make(map[string]int64),
+    }, nil
+}
+
+func (concurrency *Concurrency) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        key := concurrency.config.Key(request)
+        if !concurrency.acquire(key) {
+            concurrency.rejected.Inc()
+            writer.Header().Set("Retry-After", "1")
+            http.Error(writer, "Too Many Requests", http.StatusTooManyRequests)
+            return
+        }
+        defer concurrency.release(key)
+        next.ServeHTTP(writer, request)
+    })
+}
+
+// InFlight returns the requests key has in flight.
+func (concurrency *Concurrency) InFlight(key string) int64 {
+    concurrency.mux.Lock()
+    defer concurrency.mux.Unlock()
+
+    return concurrency.inFlight[key]
+}
+
+func (concurrency *Concurrency) acquire(key string) bool {
+    concurrency.mux.Lock()
+    defer concurrency.mux.Unlock()
+
+    if concurrency.inFlight[key] >= concurrency.config.Max {
+        return false
+    }
+    concurrency.inFlight[key]++
+    concurrency.clients.Set(float64(len(concurrency.inFlight)))
+    return true
+}
+
+// release ends one of key's requests, forgetting the client once it has
+// none left so idle clients take no memory.
+func (concurrency *Concurrency) release(key string) {
+    concurrency.mux.Lock()
+    defer concurrency.mux.Unlock()
+
+    if concurrency.inFlight[key]--; concurrency.inFlight[key] <= 0 {
+        delete(concurrency.inFlight, key)
+    }
+    concurrency.clients.Set(float64(len(concurrency.inFlight)))
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+
+    "load-balancer/internal/metrics"
+)
+
+func TestConcurrency_Middleware(t *testing.T) {
+    registry := metrics.NewRegistry()
+    concurrency, err := NewConcurrency(ConcurrencyConfig{Name: "api", Max: 2, Key: HeaderKey("X-API-Key"), Registry: registry})
+    if err != nil {
+        t.Fatalf("NewConcurrency() error: %v", err)
+    }
+
+    started := make(chan struct{})
+    release := make(chan struct{})
+    handler := concurrency.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/slow" {
+            started <- struct{}{}
+            <-release
+        }
+    }))
+    serve := func(path, client, apiKey string) *httptest.ResponseRecorder {
+        request := httptest.NewRequest("GET", path, nil)
+        request.RemoteAddr = client + ":1234"
+        if apiKey != "" {
+            request.Header.Set("X-API-Key", apiKey)
+        }
+        rr := httptest.NewRecorder()
+        handler.ServeHTTP(rr, request)
+        return rr
+    }
+
+    // Two slow requests take up 10.0.0.1's limit.
+    var wg sync.WaitGroup
+    for i := 0; i < 2; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            serve("/slow", "10.0.0.1", "")
+        }()
+        <-started
+    }
+
+    rr := serve("/", "10.0.0.1", "")
+    if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+        t.Errorf("Expected 429 with Retry-After over the limit, got %d", rr.Code)
+    }
+
+    // Other clients, by IP or API key, have limits of their own.
+    tests := []struct {
+        client string
+        apiKey string
+    }{
+        {client: "10.0.0.2"},
+        {client: "10.0.0.1", apiKey: "key-a"},
+    }
+    for _, tt := range tests {
+        if rr := serve("/", tt.client, tt.apiKey); rr.Code != http.StatusOK {
+            t.Errorf("Expected %s/%q to be served, got %d", tt.client, tt.apiKey, rr.Code)
+        }
+    }
+
+    close(release)
+    wg.Wait()
+    if inFlight := concurrency.InFlight("10.0.0.1"); inFlight != 0 {
+        t.Errorf("Expected no requests in flight, got %d", inFlight)
+    }
+    if len(concurrency.inFlight) != 0 {
+        t.Errorf("Expected idle clients forgotten, got %d", len(concurrency.inFlight))
+    }
+    if rejected := registry.Counter("lb_ratelimit_concurrency_rejected_total", "", "limiter", "api").Value(); rejected != 1 {
+        t.Errorf("Expected 1 rejected request, got %v", rejected)
+    }
+}
+
+func TestNewConcurrency(t *testing.T) {
+    tests := []struct {
+        name    string
+        config  ConcurrencyConfig
+        wantErr bool
+    }{
+        {name: "valid", config: ConcurrencyConfig{Name: "api", Max: 10}},
+        {name: "missing name", config: ConcurrencyConfig{Max: 10}, wantErr: true},
+        {name: "zero max", config: ConcurrencyConfig{Name: "api"}, wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if _, err := NewConcurrency(tt.config); (err != nil) != tt.wantErr {
+                t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+            }
+        })
+    }
+}
@@ -0,0 +1,215 @@
+package ratelimit
+
+import (
+    "container/list"
+    "errors"
+    "math"
+    "net"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/clientip"
+    "load-balancer/internal/metrics"
+)
+
+// Config describes a limiter giving each client, as told apart by Key
+// (default the client IP), a token bucket of Burst tokens (default Rate)
+// refilled at Rate tokens a second. Requests cost what Cost says they do, so
+// expensive endpoints use up more of a client's quota than cheap ones.
+// At most MaxClients buckets (default 10000) are kept; past that, the
+// bucket of the client seen least recently is dropped.
+type Config struct {
+    Name       string
+    Rate       float64
+    Burst      float64
+    Key        func(request *http.Request) string
+    Cost       Cost
+    MaxClients int
+    Registry   *metrics.Registry
+}
+
+// Cost prices requests. A request costs its route's entry in Routes, by
+// route name, or Default (default 1). Clients may declare a higher cost in
+// Header, such as a batch size, capped at the burst; a declared cost lower
+// than the route's is ignored so clients cannot talk their way out of
+// their quota. A backend that only knows the cost once it has answered can
+// report it in ResponseHeader: the difference is charged, or refunded, to
+// the client's bucket after the response, and the header is not passed on.
+// Routes only apply to a limiter used in a route's Middleware.
+type Cost struct {
+    Default        float64
+    Routes         map[string]float64
+    Header         string
+    ResponseHeader string
+}
+
+type Limiter struct {
+    config Config
+
+    mux     sync.Mutex
+    buckets map[string]*list.Element
+    order   *list.List
+}
+
+type clientBucket struct {
+    key    string
+    bucket *Bucket
+}
+
+func New(config Config) (*Limiter, error) {
+    if config.Name == "" {
+        return nil, errors.New("ratelimit: name is required")
+    }
+    if config.Rate <= 0 {
+        return nil, errors.New("ratelimit: rate must be positive")
+    }
+    if config.Burst <= 0 {
+        config.Burst = config.Rate
+    }
+    if config.Key == nil {
+        config.Key = clientip.Peer
+    }
+    if config.Cost.Default <= 0 {
+        config.Cost.Default = 1
+    }
+    if config.MaxClients <= 0 {
+        config.MaxClients = 10000
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+    return &Limiter{config: config, buckets: make(map[string]*list.Element), order: list.New()}, nil
+}
+
+// cost is what request is charged up front.
+func (limiter *Limiter) cost(request *http.Request) float64 {
+    cost := limiter.config.Cost.Default
+    if route := balancer.RouteFromContext(request.Context()); route != nil {
+        if routeCost, ok := limiter.config.Cost.Routes[route.Name]; ok {
+            cost = routeCost
+        }
+    }
+    if limiter.config.Cost.Header == "" {
+        return cost
+    }
+    declared, err := strconv.ParseFloat(request.Header.Get(limiter.config.Cost.Header), 64)
+    if err != nil || math.IsNaN(declared) || declared <= cost {
+        return cost
+    }
+    return math.Min(declared, limiter.config.Burst)
+}
+
+func (limiter *Limiter) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        bucket := limiter.bucket(limiter.config.Key(request))
+        cost := limiter.cost(request)
+        now := time.Now()
+        if !bucket.AllowN(now, cost) {
+            wait := bucket.Wait(now, cost)
+            writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+            limiter.config.Registry.Counter("lb_ratelimit_limited_total", "Requests refused by a rate limiter.", "limiter", limiter.config.Name).Inc()
+            http.Error(writer, "Too Many Requests", http.StatusTooManyRequests)
+            return
+        }
+        if limiter.config.Cost.ResponseHeader == "" {
+            limiter.spent(cost)
+            next.ServeHTTP(writer, request)
+            return
+        }
+
+        hinted := &hintWriter{ResponseWriter: writer, header: limiter.config.Cost.ResponseHeader}
+        next.ServeHTTP(hinted, request)
+        if !hinted.written {
+            hinted.WriteHeader(http.StatusOK)
+        }
+        if actual, err := strconv.ParseFloat(hinted.hint, 64); err == nil && actual >= 0 && !math.IsInf(actual, 0) {
+            bucket.Charge(time.Now(), actual-cost)
+            cost = actual
+        }
+        limiter.spent(cost)
+    })
+}
+
+func (limiter *Limiter) spent(cost float64) {
+    limiter.config.Registry.Counter("lb_ratelimit_cost_total", "Tokens charged by a rate limiter.", "limiter", limiter.config.Name).Add(cost)
+}
+
+func (limiter *Limiter) bucket(key string) *Bucket {
+    limiter.mux.Lock()
+    defer limiter.mux.Unlock()
+
+    if element, ok := limiter.buckets[key]; ok {
+        limiter.order.MoveToFront(element)
+        return element.Value.(*clientBucket).bucket
+    }
+    for limiter.order.Len() >= limiter.config.MaxClients {
+        oldest := limiter.order.Back()
+        limiter.order.Remove(oldest)
+        delete(limiter.buckets, oldest.Value.(*clientBucket).key)
+    }
+    bucket := NewBucket(limiter.config.Rate, limiter.config.Burst)
+    limiter.buckets[key] = limiter.order.PushFront(&clientBucket{key: key, bucket: bucket})
+    return bucket
+}
+
+// hintWriter takes the backend's cost hint out of the response headers.
+type hintWriter struct {
+    http.ResponseWriter
+    header  string
+    hint    string
+    written bool
+}
+
+func (writer *hintWriter) WriteHeader(status int) {
+    if !writer.written && status >= http.StatusOK {
+        writer.written = true
+        writer.hint = writer.Header().Get(writer.header)
+        writer.Header().Del(writer.header)
+    }
+    writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *hintWriter) Write(p []byte) (int, error) {
+    if !writer.written {
+        writer.WriteHeader(http.StatusOK)
+    }
+    return writer.ResponseWriter.Write(p)
+}
+
+func (writer *hintWriter) Flush() {
+    http.NewResponseController(writer.ResponseWriter).Flush()
+}
+
+func (writer *hintWriter) Unwrap() http.ResponseWriter {
+    return writer.ResponseWriter
+}
+
+// HeaderKey tells clients apart by the value of header, such as an API
+// key, and clients without it by their IP. The header is taken on trust:
+// a client sending a new value on every request gets a fresh bucket each
+// time, so header must be one set by something the client cannot bypass,
+// such as a route's Auth middleware or an authenticating proxy that
+// overwrites it. Given trusted networks, the header is only believed from
+// peers within them, and other clients are told apart by their IP.
+func HeaderKey(header string, trusted ...*net.IPNet) func(request *http.Request) string {
+    return func(request *http.Request) string {
+        ip := clientip.Peer(request)
+        if value := request.Header.Get(header); value != "" && (len(trusted) == 0 || contains(trusted, net.ParseIP(ip))) {
+            return header + ":" + value
+        }
+        return ip
+    }
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+    for _, network := range networks {
+        if network.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
+
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "testing"
+
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+)
+
+func TestLimiter_Cost(t *testing.T) {
+    registry := metrics.NewRegistry()
+    limiter, err := New(Config{
+        Name:     "api",
+        Rate:     0.001,
+        Burst:    10,
+        Cost:     Cost{Routes: map[string]float64{"search": 4}, Header: "X-Request-Cost", ResponseHeader: "X-Actual-Cost"},
+        Registry: registry,
+    })
+    if err != nil {
+        t.Fatalf("New() error: %v", err)
+    }
+
+    router := balancer.NewRouter("web")
+    backend := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        if actual := request.Header.Get("X-Report-Cost"); actual != "" {
+            writer.Header().Set("X-Actual-Cost", actual)
+        }
+    })
+    router.AddRoute(balancer.Route{Name: "search", PathPrefix: "/search", Middleware: []func(http.Handler) http.Handler{limiter.Middleware, func(http.Handler) http.Handler { return backend }}})
+    router.AddRoute(balancer.Route{Name: "other", Middleware: []func(http.Handler) http.Handler{limiter.Middleware, func(http.Handler) http.Handler { return backend }}})
+
+    tests := []struct {
+        name           string
+        client         string
+        path           string
+        declared       string
+        reported       string
+        expectedStatus int
+        expectedTokens float64
+    }{
+        {name: "cheap route", client: "10.0.0.1", path: "/", expectedStatus: http.StatusOK, expectedTokens: 9},
+        {name: "expensive route", client: "10.0.0.1", path: "/search", expectedStatus: http.StatusOK, expectedTokens: 5},
+        {name: "declared below route cost", client: "10.0.0.1", path: "/search", declared: "0", expectedStatus: http.StatusOK, expectedTokens: 1},
+        {name: "over quota", client: "10.0.0.1", path: "/search", expectedStatus: http.StatusTooManyRequests, expectedTokens: 1},
+        {name: "other client unaffected", client: "10.0.0.2", path: "/", declared: "6", expectedStatus: http.StatusOK, expectedTokens: 4},
+        {name: "declared above burst is capped", client: "10.0.0.3", path: "/", declared: "1000", expectedStatus: http.StatusOK, expectedTokens: 0},
+        {name: "backend reports a higher cost", client: "10.0.0.4", path: "/", reported: "7", expectedStatus: http.StatusOK, expectedTokens: 3},
+        {name: "backend refunds", client: "10.0.0.4", path: "/", reported: "0.5", expectedStatus: http.StatusOK, expectedTokens: 2.5},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            request := httptest.NewRequest("GET", tt.path, nil)
+            request.RemoteAddr = tt.client + ":1234"
+            if tt.declared != "" {
+                request.Header.Set("X-Request-Cost", tt.declared)
+            }
+            if tt.reported != "" {
+                request.Header.Set("X-Report-Cost", tt.reported)
+            }
+            rr := httptest.NewRecorder()
+            router.ServeHTTP(rr, request)
+            if rr.Code != tt.expectedStatus {
+                t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+            }
+            if rr.Header().Get("X-Actual-Cost") != "" {
+                t.Error("Expected the cost hint kept from the client")
+            }
+            if tt.expectedStatus == http.StatusTooManyRequests && rr.Header().Get("Retry-After") == "" {
+                t.Error("Expected a Retry-After header")
+            }
+            bucket := limiter.bucket(tt.client)
+            if tokens := bucket.Tokens(bucket.last); tokens < tt.expectedTokens-0.01 || tokens > tt.expectedTokens+0.01 {
+                t.Errorf("Expected %v tokens left, got %v", tt.expectedTokens, tokens)
+            }
+        })
+    }
+
+    if limited := registry.Counter("lb_ratelimit_limited_total", "", "limiter", "api").Value(); limited != 1 {
+        t.Errorf("Expected 1 limited request, got %v", limited)
+    }
+}
+
+func TestLimiter_EvictsLeastRecentClients(t *testing.T) {
+    limiter, _ := New(Config{Name: "api", Rate: 1, Burst: 2, MaxClients: 2, Registry: metrics.NewRegistry()})
+    limiter.bucket("idle")
+    limiter.bucket("busy").AllowN(limiter.bucket("busy").last, 2)
+    limiter.bucket("new")
+
+    if _, ok := limiter.buckets["idle"]; ok {
+        t.Error("Expected the least recent client's bucket dropped")
+    }
+    if _, ok := limiter.buckets["busy"]; !ok {
+        t.Error("Expected the busy client's bucket kept")
+    }
+
+    for i := 0; i < 100; i++ {
+        limiter.bucket(strconv.Itoa(i))
+    }
+    if len(limiter.buckets) != 2 || limiter.order.Len() != 2 {
+        t.Errorf("Expected at most 2 buckets kept, got %d", len(limiter.buckets))
+    }
+}
+
+func TestHeaderKey_Trusted(t *testing.T) {
+    _, gateway, _ := net.ParseCIDR("10.0.0.0/8")
+    key := HeaderKey("X-API-Key", gateway)
+
+    tests := []struct {
+        name     string
+        client   string
+        expected string
+    }{
+        {name: "from a trusted peer", client: "10.1.2.3", expected: "X-API-Key:key-a"},
+        {name: "from anyone else", client: "192.0.2.1", expected: "192.0.2.1"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            request := httptest.NewRequest("GET", "/", nil)
+            request.RemoteAddr = tt.client + ":1234"
+            request.Header.Set("X-API-Key", "key-a")
+            if got := key(request); got != tt.expected {
+                t.Errorf("Expected key %q, got %q", tt.expected, got)
+            }
+        })
+    }
+}
@@ -0,0 +1,35 @@
+package requestid
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "net/http"
+)
+
+const Header = "X-Request-Id"
+
+// Ensure returns the request's ID, generating one and setting it on the
+// request headers when the client did not send one, so the upstream and any
+// error page the balancer renders agree on the same value.
+func Ensure(request *http.Request) string {
+    if id := request.Header.Get(Header); id != "" {
+        return id
+    }
+    id := New()
+    request.Header.Set(Header, id)
+    return id
+}
+
+func New() string {
+    var raw [16]byte
+    rand.Read(raw[:])
+    return hex.EncodeToString(raw[:])
+}
+
+// Middleware tags every request with an ID and echoes it in the response.
+func Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        writer.Header().Set(Header, Ensure(request))
+        next.ServeHTTP(writer, request)
+    })
+}
@@ -0,0 +1,44 @@
+package requestid
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestMiddleware(t *testing.T) {
+    tests := []struct {
+        name     string
+        incoming string
+    }{
+        {name: "generates missing id"},
+        {name: "keeps client id", incoming: "abc-123"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var upstream string
+            handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                upstream = r.Header.Get(Header)
+            }))
+
+            req := httptest.NewRequest("GET", "/", nil)
+            if tt.incoming != "" {
+                req.Header.Set(Header, tt.incoming)
+            }
+            rr := httptest.NewRecorder()
+            handler.ServeHTTP(rr, req)
+
+            returned := rr.Header().Get(Header)
+            if returned == "" || returned != upstream {
+                t.Errorf("Expected upstream and response ids to match, got %q and %q", upstream, returned)
+            }
+            if tt.incoming != "" && returned != tt.incoming {
+                t.Errorf("Expected client id %q to be kept, got %q", tt.incoming, returned)
+            }
+            if tt.incoming == "" && len(returned) != 32 {
+                t.Errorf("Expected 32 hex character id, got %q", returned)
+            }
+        })
+    }
+}
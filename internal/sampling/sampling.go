@@ -0,0 +1,272 @@
+package sampling
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "log"
+    mathrand "math/rand"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+    "load-balancer/internal/requestid"
+)
+
+// Rates are the shares of requests, from 0 to 1, that are traced and that
+// get a debug log line.
+type Rates struct {
+    Trace float64 `json:"trace"`
+    Debug float64 `json:"debug"`
+}
+
+func (rates Rates) valid() bool {
+    return rates.Trace >= 0 && rates.Trace <= 1 && rates.Debug >= 0 && rates.Debug <= 1
+}
+
+// Config describes how requests are sampled for tracing and debug logging,
+// per route name, with Default for routes not listed. Rates can be changed
+// at runtime on the admin API.
+//
+// A traced request carries a W3C traceparent header to its backend with
+// the sampled flag set; untraced ones carry it with the flag clear, so
+// backends make the same decision. A request arriving with a traceparent
+// keeps its trace and its caller's decision, so traces are never cut in
+// half. Router, when set, finds the route of requests sampled outside a
+// route's own middleware.
+type Config struct {
+    Name     string
+    Default  Rates
+    Routes   map[string]Rates
+    Router   *balancer.Router
+    Registry *metrics.Registry
+}
+
+// Decision is what was decided for a request, as found in its context.
+type Decision struct {
+    TraceID string
+    Trace   bool
+    Debug   bool
+}
+
+type decisionContextKey struct{}
+
+// FromContext returns the sampling decision of the request ctx belongs to.
+func FromContext(ctx context.Context) Decision {
+    decision, _ := ctx.Value(decisionContextKey{}).(Decision)
+    return decision
+}
+
+type Sampler struct {
+    config Config
+
+    mux    sync.RWMutex
+    rates  Rates
+    routes map[string]Rates
+}
+
+func New(config Config) (*Sampler, error) {
+    if config.Name == "" {
+        return nil, errors.New("sampling: name is required")
+    }
+    if !config.Default.valid() {
+        return nil, errors.New("sampling: rates must be between 0 and 1")
+    }
+    routes := make(map[string]Rates, len(config.Routes))
+    for route, rates := range config.Routes {
+        if !rates.valid() {
+            return nil, errors.New("sampling: rates must be between 0 and 1")
+        }
+        routes[route] = rates
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+    return &Sampler{config: config, rates: config.Default, routes: routes}, nil
+}
+
+// Rates returns the rates in force for route.
+func (sampler *Sampler) Rates(route string) Rates {
+    sampler.mux.RLock()
+    defer sampler.mux.RUnlock()
+
+    if rates, ok := sampler.routes[route]; ok {
+        return rates
+    }
+    return sampler.rates
+}
+
+// SetRates changes the rates of route, or the default ones when route is
+// empty.
+func (sampler *Sampler) SetRates(route string, rates Rates) error {
+    if !rates.valid() {
+        return errors.New("rates must be between 0 and 1")
+    }
+    sampler.mux.Lock()
+    defer sampler.mux.Unlock()
+
+    if route == "" {
+        sampler.rates = rates
+    } else {
+        sampler.routes[route] = rates
+    }
+    return nil
+}
+
+// ResetRates makes route use the default rates again.
+func (sampler *Sampler) ResetRates(route string) {
+    sampler.mux.Lock()
+    delete(sampler.routes, route)
+    sampler.mux.Unlock()
+}
+
+func (sampler *Sampler) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        route := sampler.route(request)
+        rates := sampler.Rates(route)
+
+        traceID, trace, parented := parseTraceparent(request.Header.Get("Traceparent"))
+        if !parented {
+            traceID, trace = randomHex(16), mathrand.Float64() < rates.Trace
+        }
+        flags := "00"
+        if trace {
+            flags = "01"
+        }
+        request.Header.Set("Traceparent", "00-"+traceID+"-"+randomHex(8)+"-"+flags)
+
+        decision := Decision{TraceID: traceID, Trace: trace, Debug: mathrand.Float64() < rates.Debug}
+        if decision.Trace {
+            sampler.sampled(route, "trace")
+        }
+        request = request.WithContext(context.WithValue(request.Context(), decisionContextKey{}, decision))
+        if !decision.Debug {
+            next.ServeHTTP(writer, request)
+            return
+        }
+
+        sampler.sampled(route, "debug")
+        start := time.Now()
+        recorder := &statusWriter{ResponseWriter: writer, status: http.StatusOK}
+        next.ServeHTTP(recorder, request)
+        log.Printf("debug: route=%s method=%s host=%s path=%s status=%d duration=%s request_id=%s trace_id=%s\n",
+            route, request.Method, request.Host, request.URL.Path, recorder.status, time.Since(start).Round(time.Microsecond), request.Header.Get(requestid.Header), traceID)
+    })
+}
+
+func (sampler *Sampler) route(request *http.Request) string {
+    if route := balancer.RouteFromContext(request.Context()); route != nil {
+        return route.Name
+    }
+    if sampler.config.Router != nil {
+        return sampler.config.Router.Match(request).Name
+    }
+    return ""
+}
+
+func (sampler *Sampler) sampled(route, kind string) {
+    sampler.config.Registry.Counter("lb_sampled_requests_total", "Requests sampled for tracing or debug logging.", "sampler", sampler.config.Name, "route", route, "kind", kind).Inc()
+}
+
+type rateChange struct {
+    Route string `json:"route"`
+    Rates
+}
+
+type ratesView struct {
+    Default Rates            `json:"default"`
+    Routes  map[string]Rates `json:"routes"`
+}
+
+// Register exposes the rates on the admin API: GET lists them, PUT sets
+// those of a route (or the default ones, for an empty route) and DELETE
+// of a route returns it to the default rates.
+func (sampler *Sampler) Register(server *admin.Server) {
+    prefix := "/admin/sampling/" + sampler.config.Name
+    server.HandleFunc("GET "+prefix, func(writer http.ResponseWriter, request *http.Request) {
+        sampler.mux.RLock()
+        view := ratesView{Default: sampler.rates, Routes: make(map[string]Rates, len(sampler.routes))}
+        for route, rates := range sampler.routes {
+            view.Routes[route] = rates
+        }
+        sampler.mux.RUnlock()
+        admin.WriteJSON(writer, http.StatusOK, view)
+    })
+    server.HandleFunc("PUT "+prefix, func(writer http.ResponseWriter, request *http.Request) {
+        var change rateChange
+        if err := json.NewDecoder(request.Body).Decode(&change); err != nil {
+            admin.WriteError(writer, http.StatusBadRequest, "invalid rate change")
+            return
+        }
+        if err := sampler.SetRates(change.Route, change.Rates); err != nil {
+            admin.WriteError(writer, http.StatusBadRequest, err.Error())
+            return
+        }
+        log.Printf("sampling %s: rates of route %q set to trace %g, debug %g\n", sampler.config.Name, change.Route, change.Trace, change.Debug)
+        admin.WriteJSON(writer, http.StatusOK, change)
+    })
+    server.HandleFunc("DELETE "+prefix+"/{route}", func(writer http.ResponseWriter, request *http.Request) {
+        sampler.ResetRates(request.PathValue("route"))
+        writer.WriteHeader(http.StatusNoContent)
+    })
+}
+
+// parseTraceparent returns the trace ID and sampled flag of a W3C
+// traceparent header, and whether there was a valid one.
+func parseTraceparent(header string) (string, bool, bool) {
+    parts := strings.Split(strings.TrimSpace(header), "-")
+    if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+        return "", false, false
+    }
+    if parts[0] == "00" && len(parts) != 4 {
+        return "", false, false
+    }
+    for _, part := range parts[:4] {
+        if _, err := hex.DecodeString(part); err != nil || strings.ToLower(part) != part {
+            return "", false, false
+        }
+    }
+    if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+        return "", false, false
+    }
+    flags, _ := hex.DecodeString(parts[3])
+    return parts[1], flags[0]&1 == 1, true
+}
+
+func randomHex(n int) string {
+    raw := make([]byte, n)
+    rand.Read(raw)
+    return hex.EncodeToString(raw)
+}
+
+type statusWriter struct {
+    http.ResponseWriter
+    status  int
+    written bool
+}
+
+func (writer *statusWriter) WriteHeader(status int) {
+    if !writer.written && status >= http.StatusOK {
+        writer.status, writer.written = status, true
+    }
+    writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *statusWriter) Write(p []byte) (int, error) {
+    writer.written = true
+    return writer.ResponseWriter.Write(p)
+}
+
+func (writer *statusWriter) Flush() {
+    http.NewResponseController(writer.ResponseWriter).Flush()
+}
+
+func (writer *statusWriter) Unwrap() http.ResponseWriter {
+    return writer.ResponseWriter
+}
@@ -0,0 +1,124 @@
+package sampling
+
+import (
+    "bytes"
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+)
+
+const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestSampler_Middleware(t *testing.T) {
+    var logs bytes.Buffer
+    log.SetOutput(&logs)
+    defer log.SetOutput(os.Stderr)
+
+    router := balancer.NewRouter("web")
+    router.AddRoute(balancer.Route{Name: "checkout", PathPrefix: "/checkout"})
+    router.AddRoute(balancer.Route{Name: "assets", PathPrefix: "/assets"})
+    sampler, err := New(Config{
+        Name:     "edge",
+        Default:  Rates{Trace: 0, Debug: 0},
+        Routes:   map[string]Rates{"checkout": {Trace: 1, Debug: 1}},
+        Router:   router,
+        Registry: metrics.NewRegistry(),
+    })
+    if err != nil {
+        t.Fatalf("New() error: %v", err)
+    }
+
+    var seen *http.Request
+    handler := sampler.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        seen = request
+        writer.WriteHeader(http.StatusAccepted)
+    }))
+
+    tests := []struct {
+        name          string
+        path          string
+        traceparent   string
+        expectedTrace bool
+        expectedDebug bool
+        expectedID    string
+    }{
+        {name: "fully sampled route", path: "/checkout/pay", expectedTrace: true, expectedDebug: true},
+        {name: "unsampled route", path: "/assets/site.css"},
+        {name: "sampled parent is kept", path: "/assets/site.css", traceparent: parent, expectedTrace: true, expectedID: "4bf92f3577b34da6a3ce929d0e0e4736"},
+        {name: "unsampled parent is kept", path: "/checkout/pay", traceparent: strings.TrimSuffix(parent, "01") + "00", expectedDebug: true, expectedID: "4bf92f3577b34da6a3ce929d0e0e4736"},
+        {name: "invalid parent starts a trace", path: "/checkout/pay", traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", expectedTrace: true, expectedDebug: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            logs.Reset()
+            request := httptest.NewRequest("GET", tt.path, nil)
+            if tt.traceparent != "" {
+                request.Header.Set("Traceparent", tt.traceparent)
+            }
+            handler.ServeHTTP(httptest.NewRecorder(), request)
+
+            decision := FromContext(seen.Context())
+            if decision.Trace != tt.expectedTrace || decision.Debug != tt.expectedDebug {
+                t.Errorf("Expected trace %v and debug %v, got %+v", tt.expectedTrace, tt.expectedDebug, decision)
+            }
+            if tt.expectedID != "" && decision.TraceID != tt.expectedID {
+                t.Errorf("Expected trace %s to continue, got %s", tt.expectedID, decision.TraceID)
+            }
+            traceID, sampled, ok := parseTraceparent(seen.Header.Get("Traceparent"))
+            if !ok || traceID != decision.TraceID || sampled != decision.Trace {
+                t.Errorf("Expected the backend's traceparent to carry the decision, got %q", seen.Header.Get("Traceparent"))
+            }
+            if seen.Header.Get("Traceparent") == tt.traceparent {
+                t.Error("Expected a new span ID for the balancer's hop")
+            }
+            if logged := strings.Contains(logs.String(), "status=202"); logged != tt.expectedDebug {
+                t.Errorf("Expected debug log %v, got %q", tt.expectedDebug, logs.String())
+            }
+        })
+    }
+}
+
+func TestSampler_Register(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    sampler, _ := New(Config{Name: "edge", Default: Rates{Trace: 0.01}, Registry: metrics.NewRegistry()})
+    server := admin.NewServer(nil)
+    sampler.Register(server)
+
+    tests := []struct {
+        name           string
+        method         string
+        path           string
+        body           string
+        expectedStatus int
+        expectedRates  Rates
+    }{
+        {name: "set route rates", method: "PUT", path: "/admin/sampling/edge", body: `{"route":"checkout","trace":1,"debug":0.5}`, expectedStatus: http.StatusOK, expectedRates: Rates{Trace: 1, Debug: 0.5}},
+        {name: "rate out of range", method: "PUT", path: "/admin/sampling/edge", body: `{"route":"checkout","trace":2}`, expectedStatus: http.StatusBadRequest, expectedRates: Rates{Trace: 1, Debug: 0.5}},
+        {name: "reset route rates", method: "DELETE", path: "/admin/sampling/edge/checkout", expectedStatus: http.StatusNoContent, expectedRates: Rates{Trace: 0.01}},
+        {name: "set default rates", method: "PUT", path: "/admin/sampling/edge", body: `{"trace":0.1,"debug":0.01}`, expectedStatus: http.StatusOK, expectedRates: Rates{Trace: 0.1, Debug: 0.01}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rr := httptest.NewRecorder()
+            server.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+            if rr.Code != tt.expectedStatus {
+                t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+            }
+            if rates := sampler.Rates("checkout"); rates != tt.expectedRates {
+                t.Errorf("Expected rates %+v, got %+v", tt.expectedRates, rates)
+            }
+        })
+    }
+}
@@ -0,0 +1,276 @@
+package sanitize
+
+import (
+    "bytes"
+    "crypto/tls"
+    "io"
+    "log"
+    "net"
+    "net/url"
+    "strconv"
+    "strings"
+)
+
+const (
+    // maxHeadBytes is a little over net/http's default MaxHeaderBytes: a
+    // longer head is left for the server to reject.
+    maxHeadBytes = 1<<20 + 8192
+    maxLineBytes = 4096
+)
+
+// rejectHead replaces a rejected request so the server answers it with its
+// own 400 and closes the connection, in order after any response it is
+// still writing.
+var rejectHead = []byte("BAD\r\n\r\n")
+
+// Listener inspects the HTTP/1 request heads arriving on inner's
+// connections and turns away requests with duplicate Content-Length,
+// Transfer-Encoding alongside Content-Length or on HTTP/1.0, a
+// Transfer-Encoding other than chunked, several Host headers, a Host header
+// that disagrees with an absolute-form target or folded header lines. It
+// follows request bodies to find the next head, and stops inspecting a
+// connection once it switches protocols or speaks HTTP/2. TLS connections
+// are returned as they are, since net/http needs them unwrapped; wrap the
+// cleartext listener only.
+func (sanitizer *Sanitizer) Listener(inner net.Listener) net.Listener {
+    return &listener{Listener: inner, sanitizer: sanitizer}
+}
+
+type listener struct {
+    net.Listener
+    sanitizer *Sanitizer
+}
+
+func (listener *listener) Accept() (net.Conn, error) {
+    accepted, err := listener.Listener.Accept()
+    if err != nil {
+        return nil, err
+    }
+    if _, ok := accepted.(*tls.Conn); ok {
+        return accepted, nil
+    }
+    return &conn{Conn: accepted, sanitizer: listener.sanitizer, buf: make([]byte, 16<<10)}, nil
+}
+
+type state int
+
+const (
+    stateHead state = iota
+    stateBody
+    stateChunkSize
+    stateChunkData
+    stateChunkEnd
+    stateTrailer
+    statePassthrough
+    stateRejected
+)
+
+// conn holds each request head back until it is complete and checked, and
+// passes everything else through as it arrives.
+type conn struct {
+    net.Conn
+    sanitizer *Sanitizer
+
+    buf       []byte
+    out       []byte
+    head      []byte
+    line      []byte
+    state     state
+    remaining int64
+}
+
+func (conn *conn) Read(p []byte) (int, error) {
+    for len(conn.out) == 0 {
+        if conn.state == stateRejected {
+            return 0, io.EOF
+        }
+        n, err := conn.Conn.Read(conn.buf)
+        conn.feed(conn.buf[:n])
+        if err != nil && len(conn.out) == 0 {
+            return 0, err
+        }
+    }
+    n := copy(p, conn.out)
+    conn.out = conn.out[n:]
+    return n, nil
+}
+
+func (conn *conn) feed(data []byte) {
+    for len(data) > 0 {
+        switch conn.state {
+        case statePassthrough:
+            conn.out = append(conn.out, data...)
+            return
+        case stateRejected:
+            return
+        case stateHead:
+            conn.head = append(conn.head, data...)
+            data = nil
+            end := headEnd(conn.head)
+            if end < 0 {
+                if len(conn.head) > maxHeadBytes {
+                    conn.out = append(conn.out, conn.head...)
+                    conn.head = nil
+                    conn.state = statePassthrough
+                }
+                return
+            }
+            head, rest := conn.head[:end], conn.head[end:]
+            conn.head = nil
+            if reason := conn.inspect(head); reason != "" {
+                conn.sanitizer.rejected(reason)
+                log.Printf("sanitize %s: rejected request from %s: %s\n", conn.sanitizer.config.Name, conn.RemoteAddr(), reason)
+                conn.out = append(conn.out, rejectHead...)
+                conn.state = stateRejected
+                return
+            }
+            conn.out = append(conn.out, head...)
+            data = rest
+        case stateBody, stateChunkData:
+            n := int64(len(data))
+            if n > conn.remaining {
+                n = conn.remaining
+            }
+            conn.out = append(conn.out, data[:n]...)
+            data = data[n:]
+            conn.remaining -= n
+            if conn.remaining == 0 {
+                if conn.state == stateBody {
+                    conn.state = stateHead
+                } else {
+                    conn.state = stateChunkEnd
+                }
+            }
+        default:
+            i := bytes.IndexByte(data, '\n')
+            if i < 0 {
+                conn.line = append(conn.line, data...)
+                conn.out = append(conn.out, data...)
+                if len(conn.line) > maxLineBytes {
+                    conn.state = statePassthrough
+                }
+                return
+            }
+            conn.line = append(conn.line, data[:i+1]...)
+            conn.out = append(conn.out, data[:i+1]...)
+            data = data[i+1:]
+            line := strings.TrimRight(string(conn.line), "\r\n")
+            conn.line = conn.line[:0]
+            conn.endLine(line)
+        }
+    }
+}
+
+// endLine moves through a chunked body line by line; anything malformed is
+// passed through for the server to reject.
+func (conn *conn) endLine(line string) {
+    switch conn.state {
+    case stateChunkSize:
+        size, _, _ := strings.Cut(line, ";")
+        n, err := strconv.ParseInt(strings.TrimSpace(size), 16, 64)
+        switch {
+        case err != nil || n < 0:
+            conn.state = statePassthrough
+        case n == 0:
+            conn.state = stateTrailer
+        default:
+            conn.state, conn.remaining = stateChunkData, n
+        }
+    case stateChunkEnd:
+        if line != "" {
+            conn.state = statePassthrough
+            return
+        }
+        conn.state = stateChunkSize
+    case stateTrailer:
+        if line == "" {
+            conn.state = stateHead
+        }
+    }
+}
+
+// inspect checks a complete request head, returning why it is rejected,
+// and sets the state for what follows it.
+func (conn *conn) inspect(head []byte) string {
+    lines := strings.Split(strings.TrimRight(string(head), "\r\n"), "\n")
+    fields := strings.Fields(lines[0])
+    if len(fields) != 3 {
+        return ""
+    }
+    method, target, proto := fields[0], fields[1], fields[2]
+    if method == "PRI" && proto == "HTTP/2.0" {
+        conn.state = statePassthrough
+        return ""
+    }
+
+    var lengths, encodings, hosts []string
+    upgrade := false
+    for _, line := range lines[1:] {
+        line = strings.TrimSuffix(line, "\r")
+        if line == "" {
+            continue
+        }
+        if line[0] == ' ' || line[0] == '\t' {
+            return "obs_fold"
+        }
+        name, value, _ := strings.Cut(line, ":")
+        value = strings.TrimSpace(value)
+        switch strings.ToLower(name) {
+        case "content-length":
+            lengths = append(lengths, value)
+        case "transfer-encoding":
+            encodings = append(encodings, value)
+        case "host":
+            hosts = append(hosts, value)
+        case "upgrade":
+            upgrade = true
+        }
+    }
+
+    switch {
+    case len(lengths) > 1 || len(lengths) == 1 && strings.Contains(lengths[0], ","):
+        return "duplicate_content_length"
+    case len(encodings) > 0 && len(lengths) > 0:
+        return "transfer_encoding_with_content_length"
+    case len(encodings) > 0 && proto == "HTTP/1.0":
+        return "transfer_encoding_on_http10"
+    case len(encodings) > 1 || len(encodings) == 1 && !strings.EqualFold(encodings[0], "chunked"):
+        return "bad_transfer_encoding"
+    case len(hosts) > 1:
+        return "duplicate_host"
+    }
+    if len(hosts) == 1 && strings.Contains(target, "://") {
+        if parsed, err := url.Parse(target); err == nil && !sameHost(parsed.Host, hosts[0]) {
+            return "host_conflict"
+        }
+    }
+
+    switch {
+    case upgrade || method == "CONNECT":
+        conn.state = statePassthrough
+    case len(encodings) == 1:
+        conn.state = stateChunkSize
+    case len(lengths) == 1:
+        n, err := strconv.ParseInt(lengths[0], 10, 64)
+        switch {
+        case err != nil || n < 0:
+            conn.state = statePassthrough
+        case n > 0:
+            conn.state, conn.remaining = stateBody, n
+        }
+    }
+    return ""
+}
+
+// headEnd returns where the request head at the start of data ends, after
+// its blank line, or -1 while it is incomplete.
+func headEnd(data []byte) int {
+    end := -1
+    if i := bytes.Index(data, []byte("\r\n\r\n")); i >= 0 {
+        end = i + 4
+    }
+    if i := bytes.Index(data, []byte("\n\n")); i >= 0 && (end < 0 || i+2 < end) {
+        end = i + 2
+    }
+    return end
+}
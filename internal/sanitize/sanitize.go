@@ -0,0 +1,90 @@
+package sanitize
+
+import (
+    "net"
+    "net/http"
+    "strings"
+
+    "load-balancer/internal/metrics"
+)
+
+// Config describes the checks requests must pass before being proxied.
+//
+// Middleware rejects URLs longer than MaxURLLength (default 8192) with a
+// 414, absolute-form request targets whose host is not in Hosts with a 400
+// (any host is allowed when Hosts is empty; "*.example.com" matches
+// subdomains) and HTTP/2 requests whose Host header disagrees with their
+// :authority. Listener rejects the HTTP/1 framing that net/http would
+// otherwise quietly normalise before Middleware could see it.
+type Config struct {
+    Name         string
+    Hosts        []string
+    MaxURLLength int
+    Registry     *metrics.Registry
+}
+
+type Sanitizer struct {
+    config Config
+}
+
+func New(config Config) *Sanitizer {
+    if config.MaxURLLength <= 0 {
+        config.MaxURLLength = 8192
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+    return &Sanitizer{config: config}
+}
+
+func (sanitizer *Sanitizer) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        if len(request.RequestURI) > sanitizer.config.MaxURLLength {
+            sanitizer.reject(writer, http.StatusRequestURITooLong, "url_too_long")
+            return
+        }
+        if request.URL.IsAbs() && !sanitizer.allowed(request.URL.Host) {
+            sanitizer.reject(writer, http.StatusBadRequest, "host_not_allowed")
+            return
+        }
+        if host := request.Header.Get("Host"); request.ProtoMajor >= 2 && host != "" && !sameHost(host, request.Host) {
+            sanitizer.reject(writer, http.StatusBadRequest, "host_conflict")
+            return
+        }
+        next.ServeHTTP(writer, request)
+    })
+}
+
+func (sanitizer *Sanitizer) reject(writer http.ResponseWriter, status int, reason string) {
+    sanitizer.rejected(reason)
+    http.Error(writer, http.StatusText(status), status)
+}
+
+func (sanitizer *Sanitizer) rejected(reason string) {
+    sanitizer.config.Registry.Counter("lb_sanitize_rejected_total", "Requests rejected by request sanitization.", "sanitizer", sanitizer.config.Name, "reason", reason).Inc()
+}
+
+func (sanitizer *Sanitizer) allowed(host string) bool {
+    if len(sanitizer.config.Hosts) == 0 {
+        return true
+    }
+    host = strings.ToLower(hostname(host))
+    for _, pattern := range sanitizer.config.Hosts {
+        pattern = strings.ToLower(pattern)
+        if host == pattern || strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+            return true
+        }
+    }
+    return false
+}
+
+func hostname(host string) string {
+    if name, _, err := net.SplitHostPort(host); err == nil {
+        return name
+    }
+    return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+func sameHost(a, b string) bool {
+    return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
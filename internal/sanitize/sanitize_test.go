@@ -0,0 +1,115 @@
+package sanitize
+
+import (
+    "io"
+    "log"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "load-balancer/internal/metrics"
+)
+
+func TestSanitizer_Middleware(t *testing.T) {
+    sanitizer := New(Config{Name: "edge", Hosts: []string{"example.com", "*.example.org"}, MaxURLLength: 64, Registry: metrics.NewRegistry()})
+    handler := sanitizer.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+
+    tests := []struct {
+        name     string
+        target   string
+        proto    int
+        host     string
+        expected int
+    }{
+        {name: "origin form", target: "/path", expected: http.StatusOK},
+        {name: "url too long", target: "/" + strings.Repeat("a", 64), expected: http.StatusRequestURITooLong},
+        {name: "absolute form allowed", target: "http://example.com:8080/path", expected: http.StatusOK},
+        {name: "absolute form wildcard", target: "http://api.example.org/path", expected: http.StatusOK},
+        {name: "absolute form not allowed", target: "http://evil.test/path", expected: http.StatusBadRequest},
+        {name: "http2 host matches authority", target: "/path", proto: 2, host: "example.com", expected: http.StatusOK},
+        {name: "http2 host conflicts with authority", target: "/path", proto: 2, host: "evil.test", expected: http.StatusBadRequest},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            request := httptest.NewRequest("GET", tt.target, nil)
+            if tt.proto == 2 {
+                request.ProtoMajor = 2
+                request.Host = "example.com"
+                request.Header.Set("Host", tt.host)
+            }
+            recorder := httptest.NewRecorder()
+            handler.ServeHTTP(recorder, request)
+            if recorder.Code != tt.expected {
+                t.Errorf("Expected %d, got %d", tt.expected, recorder.Code)
+            }
+        })
+    }
+}
+
+func TestSanitizer_Listener(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    inner, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("listen: %v", err)
+    }
+    registry := metrics.NewRegistry()
+    sanitizer := New(Config{Name: "edge", Registry: registry})
+    server := &http.Server{Handler: http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        body, _ := io.ReadAll(request.Body)
+        io.WriteString(writer, request.URL.Path+":"+string(body))
+    })}
+    go server.Serve(sanitizer.Listener(inner))
+    defer server.Close()
+
+    // Each case is followed by a pipelined GET /next, which must only be
+    // served when the first request was framed unambiguously.
+    tests := []struct {
+        name     string
+        request  string
+        expected []string
+        reason   string
+    }{
+        {name: "content length body", request: "POST /a HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\n\r\nhello", expected: []string{"/a:hello", "/next:"}},
+        {name: "chunked body", request: "POST /a HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\nX-Trailer: 1\r\n\r\n", expected: []string{"/a:hello", "/next:"}},
+        {name: "absolute form with matching host", request: "GET http://x/a HTTP/1.1\r\nHost: x\r\n\r\n", expected: []string{"/a:", "/next:"}},
+        {name: "duplicate content length", request: "POST /a HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello", expected: []string{"400 Bad Request"}, reason: "duplicate_content_length"},
+        {name: "content length list", request: "POST /a HTTP/1.1\r\nHost: x\r\nContent-Length: 5, 5\r\n\r\nhello", expected: []string{"400 Bad Request"}, reason: "duplicate_content_length"},
+        {name: "te and cl", request: "POST /a HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", expected: []string{"400 Bad Request"}, reason: "transfer_encoding_with_content_length"},
+        {name: "te on http 1.0", request: "POST /a HTTP/1.0\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", expected: []string{"400 Bad Request"}, reason: "transfer_encoding_on_http10"},
+        {name: "obfuscated te", request: "POST /a HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: xchunked\r\n\r\n0\r\n\r\n", expected: []string{"400 Bad Request"}, reason: "bad_transfer_encoding"},
+        {name: "host conflicts with absolute form", request: "GET http://y/a HTTP/1.1\r\nHost: x\r\n\r\n", expected: []string{"400 Bad Request"}, reason: "host_conflict"},
+        {name: "folded header", request: "GET /a HTTP/1.1\r\nHost: x\r\nX-A: 1\r\n Transfer-Encoding: chunked\r\n\r\n", expected: []string{"400 Bad Request"}, reason: "obs_fold"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            conn, err := net.Dial("tcp", inner.Addr().String())
+            if err != nil {
+                t.Fatalf("dial: %v", err)
+            }
+            defer conn.Close()
+            conn.SetDeadline(time.Now().Add(2 * time.Second))
+            io.WriteString(conn, tt.request+"GET /next HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n")
+
+            response, _ := io.ReadAll(conn)
+            var bodies []string
+            for _, part := range strings.Split(string(response), "HTTP/1.1 ")[1:] {
+                _, body, _ := strings.Cut(part, "\r\n\r\n")
+                bodies = append(bodies, body)
+            }
+            if strings.Join(bodies, "|") != strings.Join(tt.expected, "|") {
+                t.Errorf("Expected responses %q, got %q", tt.expected, bodies)
+            }
+            if tt.reason != "" && registry.Counter("lb_sanitize_rejected_total", "", "sanitizer", "edge", "reason", tt.reason).Value() == 0 {
+                t.Errorf("Expected a rejection counted as %s", tt.reason)
+            }
+        })
+    }
+}
@@ -0,0 +1,302 @@
+package script
+
+import (
+    "fmt"
+    "net/http"
+    "net/netip"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "load-balancer/internal/clientip"
+)
+
+type tokenKind int
+
+const (
+    tokenIdent tokenKind = iota
+    tokenString
+    tokenNumber
+    tokenOperator
+)
+
+type token struct {
+    kind   tokenKind
+    value  string
+    number int
+}
+
+var operators = []string{"=>", "==", "!=", "^=", "$=", "*=", "=~", "&&", "||", "!", "(", ")", ","}
+
+func tokenize(line string) ([]token, error) {
+    var tokens []token
+    for i := 0; i < len(line); {
+        c := line[i]
+        switch {
+        case c == ' ' || c == '\t':
+            i++
+        case c == '"':
+            end := i + 1
+            for end < len(line) && line[end] != '"' {
+                if line[end] == '\\' {
+                    end++
+                }
+                end++
+            }
+            if end >= len(line) {
+                return nil, fmt.Errorf("unterminated string")
+            }
+            value, err := strconv.Unquote(line[i : end+1])
+            if err != nil {
+                return nil, fmt.Errorf("invalid string %s: %w", line[i:end+1], err)
+            }
+            tokens = append(tokens, token{kind: tokenString, value: value})
+            i = end + 1
+        case c >= '0' && c <= '9':
+            end := i
+            for end < len(line) && line[end] >= '0' && line[end] <= '9' {
+                end++
+            }
+            number, err := strconv.Atoi(line[i:end])
+            if err != nil {
+                return nil, err
+            }
+            tokens = append(tokens, token{kind: tokenNumber, value: line[i:end], number: number})
+            i = end
+        case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+            end := i
+            for end < len(line) && (line[end] == '_' || (line[end] >= 'a' && line[end] <= 'z') || (line[end] >= 'A' && line[end] <= 'Z') || (line[end] >= '0' && line[end] <= '9')) {
+                end++
+            }
+            tokens = append(tokens, token{kind: tokenIdent, value: line[i:end]})
+            i = end
+        default:
+            matched := false
+            for _, op := range operators {
+                if strings.HasPrefix(line[i:], op) {
+                    tokens = append(tokens, token{kind: tokenOperator, value: op})
+                    i += len(op)
+                    matched = true
+                    break
+                }
+            }
+            if !matched {
+                return nil, fmt.Errorf("unexpected character %q", c)
+            }
+        }
+    }
+    return tokens, nil
+}
+
+type node interface {
+    eval(request *http.Request) bool
+}
+
+type valueFunc func(request *http.Request) string
+
+type andNode struct{ left, right node }
+type orNode struct{ left, right node }
+type notNode struct{ inner node }
+type literalNode struct{ value bool }
+
+type compareNode struct {
+    left  valueFunc
+    op    string
+    right string
+    regex *regexp.Regexp
+    cidr  netip.Prefix
+}
+
+func (n andNode) eval(request *http.Request) bool     { return n.left.eval(request) && n.right.eval(request) }
+func (n orNode) eval(request *http.Request) bool      { return n.left.eval(request) || n.right.eval(request) }
+func (n notNode) eval(request *http.Request) bool     { return !n.inner.eval(request) }
+func (n literalNode) eval(request *http.Request) bool { return n.value }
+
+func (n compareNode) eval(request *http.Request) bool {
+    value := n.left(request)
+    switch n.op {
+    case "==":
+        return value == n.right
+    case "!=":
+        return value != n.right
+    case "^=":
+        return strings.HasPrefix(value, n.right)
+    case "$=":
+        return strings.HasSuffix(value, n.right)
+    case "*=":
+        return strings.Contains(value, n.right)
+    case "=~":
+        return n.regex.MatchString(value)
+    case "in":
+        addr, err := netip.ParseAddr(value)
+        return err == nil && n.cidr.Contains(addr.Unmap())
+    }
+    return false
+}
+
+type parser struct {
+    tokens []token
+    pos    int
+}
+
+func (parser *parser) done() bool {
+    return parser.pos >= len(parser.tokens)
+}
+
+func (parser *parser) peek() token {
+    if parser.done() {
+        return token{}
+    }
+    return parser.tokens[parser.pos]
+}
+
+func (parser *parser) next() token {
+    tok := parser.peek()
+    parser.pos++
+    return tok
+}
+
+func (parser *parser) accept(value string) bool {
+    if !parser.done() && parser.peek().kind != tokenString && parser.peek().value == value {
+        parser.pos++
+        return true
+    }
+    return false
+}
+
+func (parser *parser) parseExpression() (node, error) {
+    left, err := parser.parseAnd()
+    if err != nil {
+        return nil, err
+    }
+    for parser.accept("||") {
+        right, err := parser.parseAnd()
+        if err != nil {
+            return nil, err
+        }
+        left = orNode{left, right}
+    }
+    return left, nil
+}
+
+func (parser *parser) parseAnd() (node, error) {
+    left, err := parser.parseUnary()
+    if err != nil {
+        return nil, err
+    }
+    for parser.accept("&&") {
+        right, err := parser.parseUnary()
+        if err != nil {
+            return nil, err
+        }
+        left = andNode{left, right}
+    }
+    return left, nil
+}
+
+func (parser *parser) parseUnary() (node, error) {
+    if parser.accept("!") {
+        inner, err := parser.parseUnary()
+        if err != nil {
+            return nil, err
+        }
+        return notNode{inner}, nil
+    }
+    if parser.accept("(") {
+        inner, err := parser.parseExpression()
+        if err != nil {
+            return nil, err
+        }
+        if !parser.accept(")") {
+            return nil, fmt.Errorf("missing ')'")
+        }
+        return inner, nil
+    }
+    if parser.accept("true") {
+        return literalNode{true}, nil
+    }
+    if parser.accept("false") {
+        return literalNode{false}, nil
+    }
+    return parser.parseComparison()
+}
+
+func (parser *parser) parseComparison() (node, error) {
+    left, err := parser.parseAttribute()
+    if err != nil {
+        return nil, err
+    }
+
+    op := parser.next()
+    switch op.value {
+    case "==", "!=", "^=", "$=", "*=", "=~", "in":
+    default:
+        return nil, fmt.Errorf("expected comparison operator, got %q", op.value)
+    }
+
+    right := parser.next()
+    if right.kind != tokenString {
+        return nil, fmt.Errorf("expected quoted string after %q", op.value)
+    }
+
+    compare := compareNode{left: left, op: op.value, right: right.value}
+    switch op.value {
+    case "=~":
+        compare.regex, err = regexp.Compile(right.value)
+        if err != nil {
+            return nil, fmt.Errorf("invalid regex %q: %w", right.value, err)
+        }
+    case "in":
+        compare.cidr, err = netip.ParsePrefix(right.value)
+        if err != nil {
+            return nil, fmt.Errorf("invalid CIDR %q: %w", right.value, err)
+        }
+    }
+    return compare, nil
+}
+
+func (parser *parser) parseAttribute() (valueFunc, error) {
+    name := parser.next()
+    if name.kind != tokenIdent {
+        return nil, fmt.Errorf("expected request attribute, got %q", name.value)
+    }
+
+    switch name.value {
+    case "method":
+        return func(request *http.Request) string { return request.Method }, nil
+    case "path":
+        return func(request *http.Request) string { return request.URL.Path }, nil
+    case "host":
+        return func(request *http.Request) string { return request.Host }, nil
+    case "ip":
+        return clientip.Peer, nil
+    case "header", "query", "cookie":
+        if !parser.accept("(") {
+            return nil, fmt.Errorf("%s requires an argument", name.value)
+        }
+        arg := parser.next()
+        if arg.kind != tokenString {
+            return nil, fmt.Errorf("%s argument must be a quoted string", name.value)
+        }
+        if !parser.accept(")") {
+            return nil, fmt.Errorf("missing ')' after %s argument", name.value)
+        }
+        key := arg.value
+        switch name.value {
+        case "header":
+            return func(request *http.Request) string { return request.Header.Get(key) }, nil
+        case "query":
+            return func(request *http.Request) string { return request.URL.Query().Get(key) }, nil
+        default:
+            return func(request *http.Request) string {
+                cookie, err := request.Cookie(key)
+                if err != nil {
+                    return ""
+                }
+                return cookie.Value
+            }, nil
+        }
+    }
+    return nil, fmt.Errorf("unknown request attribute %q", name.value)
+}
+
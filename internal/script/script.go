@@ -0,0 +1,145 @@
+package script
+
+import (
+    "bufio"
+    "fmt"
+    "math/rand/v2"
+    "net/http"
+    "strings"
+)
+
+type Decision struct {
+    Pool   string
+    Reject bool
+    Status int
+}
+
+type rule struct {
+    line      int
+    condition node
+    decision  Decision
+    weight    int
+}
+
+type Program struct {
+    rules  []rule
+    random func(n int) int
+}
+
+func Compile(source string) (*Program, error) {
+    program := &Program{random: rand.IntN}
+
+    scanner := bufio.NewScanner(strings.NewReader(source))
+    lineNumber := 0
+    for scanner.Scan() {
+        lineNumber++
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        parsed, err := parseRule(line)
+        if err != nil {
+            return nil, fmt.Errorf("script line %d: %w", lineNumber, err)
+        }
+        parsed.line = lineNumber
+        program.rules = append(program.rules, parsed)
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, err
+    }
+
+    return program, nil
+}
+
+func (program *Program) Evaluate(request *http.Request) (Decision, bool) {
+    for _, rule := range program.rules {
+        if !rule.condition.eval(request) {
+            continue
+        }
+        if rule.weight < 100 && program.random(100) >= rule.weight {
+            continue
+        }
+        return rule.decision, true
+    }
+    return Decision{}, false
+}
+
+func parseRule(line string) (rule, error) {
+    tokens, err := tokenize(line)
+    if err != nil {
+        return rule{}, err
+    }
+
+    arrow := -1
+    for i, tok := range tokens {
+        if tok.kind == tokenOperator && tok.value == "=>" {
+            arrow = i
+            break
+        }
+    }
+    if arrow < 0 {
+        return rule{}, fmt.Errorf("missing '=>' between condition and action")
+    }
+
+    parser := &parser{tokens: tokens[:arrow]}
+    condition, err := parser.parseExpression()
+    if err != nil {
+        return rule{}, err
+    }
+    if !parser.done() {
+        return rule{}, fmt.Errorf("unexpected %q in condition", parser.peek().value)
+    }
+
+    parsed := rule{condition: condition, weight: 100}
+    if err := parseAction(tokens[arrow+1:], &parsed); err != nil {
+        return rule{}, err
+    }
+    return parsed, nil
+}
+
+func parseAction(tokens []token, parsed *rule) error {
+    if len(tokens) == 0 {
+        return fmt.Errorf("missing action after '=>'")
+    }
+    if tokens[0].kind != tokenIdent {
+        return fmt.Errorf("expected action, got %q", tokens[0].value)
+    }
+
+    switch tokens[0].value {
+    case "pool":
+        if len(tokens) < 2 || tokens[1].kind != tokenString {
+            return fmt.Errorf("pool action requires a quoted pool name")
+        }
+        parsed.decision.Pool = tokens[1].value
+        tokens = tokens[2:]
+        if len(tokens) > 0 && tokens[0].value == "weight" {
+            if len(tokens) < 2 || tokens[1].kind != tokenNumber {
+                return fmt.Errorf("weight requires a number")
+            }
+            if tokens[1].number < 0 || tokens[1].number > 100 {
+                return fmt.Errorf("weight must be between 0 and 100, got %d", tokens[1].number)
+            }
+            parsed.weight = tokens[1].number
+            tokens = tokens[2:]
+        }
+    case "reject":
+        parsed.decision.Reject = true
+        parsed.decision.Status = http.StatusForbidden
+        tokens = tokens[1:]
+        if len(tokens) > 0 && tokens[0].kind == tokenNumber {
+            if tokens[0].number < 400 || tokens[0].number > 599 {
+                return fmt.Errorf("reject status must be 4xx or 5xx, got %d", tokens[0].number)
+            }
+            parsed.decision.Status = tokens[0].number
+            tokens = tokens[1:]
+        }
+    default:
+        return fmt.Errorf("unknown action %q", tokens[0].value)
+    }
+
+    if len(tokens) > 0 {
+        return fmt.Errorf("unexpected %q after action", tokens[0].value)
+    }
+    return nil
+}
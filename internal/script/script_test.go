@@ -0,0 +1,202 @@
+package script
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestCompile_Errors(t *testing.T) {
+    tests := []struct {
+        name   string
+        source string
+        errMsg string
+    }{
+        {
+            name:   "missing arrow",
+            source: `path ^= "/api" pool "api"`,
+            errMsg: "missing '=>'",
+        },
+        {
+            name:   "unknown attribute",
+            source: `body == "x" => pool "api"`,
+            errMsg: "unknown request attribute",
+        },
+        {
+            name:   "unknown action",
+            source: `true => route "api"`,
+            errMsg: "unknown action",
+        },
+        {
+            name:   "weight out of range",
+            source: `true => pool "api" weight 150`,
+            errMsg: "between 0 and 100",
+        },
+        {
+            name:   "invalid regex",
+            source: `path =~ "([" => reject`,
+            errMsg: "invalid regex",
+        },
+        {
+            name:   "invalid cidr",
+            source: `ip in "10.0.0.0/99" => reject`,
+            errMsg: "invalid CIDR",
+        },
+        {
+            name:   "reports line number",
+            source: "# comment\n\ntrue => nope",
+            errMsg: "script line 3",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := Compile(tt.source)
+            if err == nil {
+                t.Fatal("Compile() expected error, got nil")
+            }
+            if !strings.Contains(err.Error(), tt.errMsg) {
+                t.Errorf("Compile() error = %q, expected it to contain %q", err.Error(), tt.errMsg)
+            }
+        })
+    }
+}
+
+func TestProgram_Evaluate(t *testing.T) {
+    source := `
+# beta testers and the new API go to the canary pool
+header("X-Beta") == "1" || path ^= "/v2/" => pool "canary"
+method == "DELETE" && !(ip in "10.0.0.0/8") => reject 405
+query("debug") != "" => reject
+cookie("region") == "eu" => pool "eu"
+path =~ "^/static/.*\\.css$" => pool "static"
+`
+    program, err := Compile(source)
+    if err != nil {
+        t.Fatalf("Compile() error: %v", err)
+    }
+
+    tests := []struct {
+        name     string
+        method   string
+        target   string
+        remote   string
+        header   string
+        cookie   string
+        matched  bool
+        expected Decision
+    }{
+        {
+            name:     "header routes to canary",
+            method:   "GET",
+            target:   "/",
+            header:   "1",
+            matched:  true,
+            expected: Decision{Pool: "canary"},
+        },
+        {
+            name:     "path prefix routes to canary",
+            method:   "GET",
+            target:   "/v2/users",
+            matched:  true,
+            expected: Decision{Pool: "canary"},
+        },
+        {
+            name:     "external delete is rejected",
+            method:   "DELETE",
+            target:   "/users/1",
+            remote:   "203.0.113.5:4000",
+            matched:  true,
+            expected: Decision{Reject: true, Status: 405},
+        },
+        {
+            name:    "internal delete falls through",
+            method:  "DELETE",
+            target:  "/users/1",
+            remote:  "10.1.2.3:4000",
+            matched: false,
+        },
+        {
+            name:     "reject defaults to forbidden",
+            method:   "GET",
+            target:   "/?debug=1",
+            matched:  true,
+            expected: Decision{Reject: true, Status: 403},
+        },
+        {
+            name:     "cookie match",
+            method:   "GET",
+            target:   "/",
+            cookie:   "eu",
+            matched:  true,
+            expected: Decision{Pool: "eu"},
+        },
+        {
+            name:     "regex match",
+            method:   "GET",
+            target:   "/static/site.css",
+            matched:  true,
+            expected: Decision{Pool: "static"},
+        },
+        {
+            name:    "no rule matches",
+            method:  "GET",
+            target:  "/static/site.js",
+            matched: false,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            req := httptest.NewRequest(tt.method, tt.target, nil)
+            if tt.remote != "" {
+                req.RemoteAddr = tt.remote
+            }
+            if tt.header != "" {
+                req.Header.Set("X-Beta", tt.header)
+            }
+            if tt.cookie != "" {
+                req.AddCookie(&http.Cookie{Name: "region", Value: tt.cookie})
+            }
+
+            decision, matched := program.Evaluate(req)
+            if matched != tt.matched {
+                t.Fatalf("Evaluate() matched = %v, expected %v", matched, tt.matched)
+            }
+            if decision != tt.expected {
+                t.Errorf("Evaluate() = %+v, expected %+v", decision, tt.expected)
+            }
+        })
+    }
+}
+
+func TestProgram_EvaluateWeight(t *testing.T) {
+    program, err := Compile("path ^= \"/api\" => pool \"canary\" weight 25\ntrue => pool \"stable\"")
+    if err != nil {
+        t.Fatalf("Compile() error: %v", err)
+    }
+
+    tests := []struct {
+        name     string
+        roll     int
+        expected string
+    }{
+        {name: "roll inside weight", roll: 24, expected: "canary"},
+        {name: "roll outside weight", roll: 25, expected: "stable"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            program.random = func(n int) int { return tt.roll }
+
+            decision, matched := program.Evaluate(httptest.NewRequest("GET", "/api/users", nil))
+            if !matched {
+                t.Fatal("Evaluate() expected a match")
+            }
+            if decision.Pool != tt.expected {
+                t.Errorf("Evaluate() pool = %q, expected %q", decision.Pool, tt.expected)
+            }
+        })
+    }
+}
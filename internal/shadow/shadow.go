@@ -0,0 +1,337 @@
+package shadow
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "io"
+    "math/rand"
+    "mime"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+    "load-balancer/internal/transform"
+)
+
+const maxSamples = 20
+
+// Compare turns on differential comparison of primary and shadow responses.
+// Headers lists the response headers that must match; IgnoreFields lists
+// dotted JSON paths (timestamps, request IDs) dropped before the body hash.
+type Compare struct {
+    Headers      []string
+    IgnoreFields []string
+}
+
+type Config struct {
+    Pool         *balancer.ServerPool
+    Percent      float64
+    Timeout      time.Duration
+    MaxBodyBytes int64
+    Compare      *Compare
+    Registry     *metrics.Registry
+}
+
+type Mismatch struct {
+    Time          time.Time `json:"time"`
+    Method        string    `json:"method"`
+    URI           string    `json:"uri"`
+    Fields        []string  `json:"fields"`
+    PrimaryStatus int       `json:"primary_status"`
+    ShadowStatus  int       `json:"shadow_status"`
+}
+
+type RouteReport struct {
+    Route        string            `json:"route"`
+    Mirrored     uint64            `json:"mirrored"`
+    Compared     uint64            `json:"compared"`
+    Mismatches   uint64            `json:"mismatches"`
+    MismatchRate float64           `json:"mismatch_rate"`
+    Fields       map[string]uint64 `json:"fields"`
+    Samples      []Mismatch        `json:"samples"`
+}
+
+type routeStats struct {
+    report   RouteReport
+    compared *metrics.Counter
+    mismatch *metrics.Counter
+}
+
+// Mirror copies a share of traffic to a shadow pool. Shadow responses are
+// discarded; when Compare is set they are diffed against the primary
+// response and mismatch rates are kept per route.
+type Mirror struct {
+    name   string
+    config Config
+
+    mux    sync.Mutex
+    routes map[string]*routeStats
+}
+
+func NewMirror(name string, config Config) *Mirror {
+    if config.Percent <= 0 {
+        config.Percent = 100
+    }
+    if config.Timeout <= 0 {
+        config.Timeout = 5 * time.Second
+    }
+    if config.MaxBodyBytes <= 0 {
+        config.MaxBodyBytes = 1 << 20
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+    return &Mirror{name: name, config: config, routes: make(map[string]*routeStats)}
+}
+
+func (mirror *Mirror) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        if mirror.config.Percent < 100 && rand.Float64()*100 >= mirror.config.Percent {
+            next.ServeHTTP(writer, request)
+            return
+        }
+        body, ok := bufferBody(request, mirror.config.MaxBodyBytes)
+        if !ok {
+            next.ServeHTTP(writer, request)
+            return
+        }
+
+        route := ""
+        if current := balancer.RouteFromContext(request.Context()); current != nil {
+            route = current.Name
+        }
+        mirror.mux.Lock()
+        mirror.statsLocked(route).report.Mirrored++
+        mirror.mux.Unlock()
+
+        // The shadow request outlives the handler, so it must not carry the
+        // server's context: ReverseProxy panics to abort a response it
+        // cannot finish copying when it finds one, which would kill the
+        // process from the detached goroutine.
+        ctx, cancel := context.WithTimeout(context.Background(), mirror.config.Timeout)
+        shadowRequest := request.Clone(ctx)
+        shadowRequest.Body = io.NopCloser(bytes.NewReader(body))
+        shadowRequest.ContentLength = int64(len(body))
+
+        shadowDone := make(chan digest, 1)
+        go func() {
+            defer cancel()
+            shadowDone <- mirror.shadow(shadowRequest)
+        }()
+
+        if mirror.config.Compare == nil {
+            next.ServeHTTP(writer, request)
+            return
+        }
+
+        primary := &digestWriter{ResponseWriter: writer, limit: mirror.config.MaxBodyBytes}
+        next.ServeHTTP(primary, request)
+        primaryDigest := primary.digest(mirror.config.Compare)
+        method, uri := request.Method, request.URL.RequestURI()
+
+        go func() {
+            mirror.record(route, method, uri, primaryDigest, <-shadowDone)
+        }()
+    })
+}
+
+func (mirror *Mirror) shadow(shadowRequest *http.Request) digest {
+    writer := &digestWriter{header: make(http.Header), limit: mirror.config.MaxBodyBytes}
+    mirror.config.Pool.LoadBalancerHandler(writer, shadowRequest)
+    if mirror.config.Compare == nil {
+        return digest{}
+    }
+    return writer.digest(mirror.config.Compare)
+}
+
+func (mirror *Mirror) record(route, method, uri string, primary, shadow digest) {
+    var fields []string
+    if primary.status != shadow.status {
+        fields = append(fields, "status")
+    }
+    for _, name := range mirror.config.Compare.Headers {
+        if primary.headers[name] != shadow.headers[name] {
+            fields = append(fields, "header:"+http.CanonicalHeaderKey(name))
+        }
+    }
+    if primary.body != "" && shadow.body != "" && primary.body != shadow.body {
+        fields = append(fields, "body")
+    }
+
+    mirror.mux.Lock()
+    defer mirror.mux.Unlock()
+
+    stats := mirror.statsLocked(route)
+    stats.report.Compared++
+    stats.compared.Inc()
+    if len(fields) == 0 {
+        return
+    }
+
+    stats.report.Mismatches++
+    stats.mismatch.Inc()
+    for _, field := range fields {
+        stats.report.Fields[field]++
+    }
+    stats.report.Samples = append(stats.report.Samples, Mismatch{
+        Time:          time.Now(),
+        Method:        method,
+        URI:           uri,
+        Fields:        fields,
+        PrimaryStatus: primary.status,
+        ShadowStatus:  shadow.status,
+    })
+    if len(stats.report.Samples) > maxSamples {
+        stats.report.Samples = stats.report.Samples[1:]
+    }
+}
+
+func (mirror *Mirror) statsLocked(route string) *routeStats {
+    stats, ok := mirror.routes[route]
+    if !ok {
+        stats = &routeStats{
+            report:   RouteReport{Route: route, Fields: make(map[string]uint64), Samples: []Mismatch{}},
+            compared: mirror.config.Registry.Counter("lb_shadow_compared_total", "Primary and shadow response pairs compared.", "mirror", mirror.name, "route", route),
+            mismatch: mirror.config.Registry.Counter("lb_shadow_mismatches_total", "Shadow responses that differed from the primary response.", "mirror", mirror.name, "route", route),
+        }
+        mirror.routes[route] = stats
+    }
+    return stats
+}
+
+func (mirror *Mirror) Report() []RouteReport {
+    mirror.mux.Lock()
+    defer mirror.mux.Unlock()
+
+    reports := make([]RouteReport, 0, len(mirror.routes))
+    for _, stats := range mirror.routes {
+        report := stats.report
+        report.Fields = make(map[string]uint64, len(stats.report.Fields))
+        for field, count := range stats.report.Fields {
+            report.Fields[field] = count
+        }
+        report.Samples = append([]Mismatch{}, stats.report.Samples...)
+        if report.Compared > 0 {
+            report.MismatchRate = float64(report.Mismatches) / float64(report.Compared)
+        }
+        reports = append(reports, report)
+    }
+    sort.Slice(reports, func(i, j int) bool { return reports[i].Route < reports[j].Route })
+    return reports
+}
+
+func (mirror *Mirror) Register(server *admin.Server) {
+    server.HandleFunc("GET /admin/shadow/"+mirror.name, func(writer http.ResponseWriter, request *http.Request) {
+        admin.WriteJSON(writer, http.StatusOK, mirror.Report())
+    })
+}
+
+// bufferBody reads the request body so it can be sent twice. Bodies larger
+// than limit are not mirrored; the bytes already read are stitched back in
+// front of the remainder so the primary request is unaffected.
+func bufferBody(request *http.Request, limit int64) ([]byte, bool) {
+    if request.Body == nil || request.Body == http.NoBody {
+        return nil, true
+    }
+    body, err := io.ReadAll(io.LimitReader(request.Body, limit+1))
+    if err != nil || int64(len(body)) > limit {
+        request.Body = struct {
+            io.Reader
+            io.Closer
+        }{io.MultiReader(bytes.NewReader(body), request.Body), request.Body}
+        return nil, false
+    }
+    request.Body.Close()
+    request.Body = io.NopCloser(bytes.NewReader(body))
+    return body, true
+}
+
+type digest struct {
+    status  int
+    headers map[string]string
+    body    string
+}
+
+// digestWriter records the status and a bounded copy of the body. It
+// forwards to ResponseWriter when set and discards otherwise.
+type digestWriter struct {
+    http.ResponseWriter
+    header   http.Header
+    limit    int64
+    status   int
+    body     bytes.Buffer
+    overflow bool
+}
+
+func (writer *digestWriter) Header() http.Header {
+    if writer.ResponseWriter != nil {
+        return writer.ResponseWriter.Header()
+    }
+    return writer.header
+}
+
+func (writer *digestWriter) WriteHeader(status int) {
+    if writer.status == 0 && status >= http.StatusOK {
+        writer.status = status
+    }
+    if writer.ResponseWriter != nil {
+        writer.ResponseWriter.WriteHeader(status)
+    }
+}
+
+func (writer *digestWriter) Write(p []byte) (int, error) {
+    if writer.status == 0 {
+        writer.status = http.StatusOK
+    }
+    if !writer.overflow {
+        if int64(writer.body.Len()+len(p)) > writer.limit {
+            writer.overflow = true
+            writer.body.Reset()
+        } else {
+            writer.body.Write(p)
+        }
+    }
+    if writer.ResponseWriter != nil {
+        return writer.ResponseWriter.Write(p)
+    }
+    return len(p), nil
+}
+
+func (writer *digestWriter) Unwrap() http.ResponseWriter {
+    return writer.ResponseWriter
+}
+
+func (writer *digestWriter) digest(compare *Compare) digest {
+    result := digest{status: writer.status, headers: make(map[string]string)}
+    if result.status == 0 {
+        result.status = http.StatusOK
+    }
+    header := writer.Header()
+    for _, name := range compare.Headers {
+        result.headers[name] = strings.Join(header.Values(name), ",")
+    }
+    if !writer.overflow {
+        result.body = hashBody(writer.body.Bytes(), header.Get("Content-Type"), compare.IgnoreFields)
+    }
+    return result
+}
+
+// hashBody hashes JSON objects in canonical form (sorted keys, ignored fields
+// removed) so formatting differences between backends are not mismatches.
+func hashBody(body []byte, contentType string, ignore []string) string {
+    if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) {
+        normalized := &transform.JSONTransform{Remove: ignore}
+        if canonical, err := normalized.Apply(body); err == nil {
+            body = canonical
+        }
+    }
+    sum := sha256.Sum256(body)
+    return hex.EncodeToString(sum[:])
+}
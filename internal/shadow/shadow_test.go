@@ -0,0 +1,215 @@
+package shadow
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+)
+
+func newPool(t *testing.T, handler http.HandlerFunc) *balancer.ServerPool {
+    t.Helper()
+
+    server := httptest.NewServer(handler)
+    t.Cleanup(server.Close)
+
+    serverURL, _ := url.Parse(server.URL)
+    pool := balancer.NewServerPool()
+    pool.AddBackend(&backend.Backend{URL: serverURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(serverURL)})
+    return pool
+}
+
+func waitForCompared(t *testing.T, mirror *Mirror, expected uint64) RouteReport {
+    t.Helper()
+
+    deadline := time.Now().Add(2 * time.Second)
+    for {
+        reports := mirror.Report()
+        if len(reports) == 1 && reports[0].Compared == expected {
+            return reports[0]
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("Expected %d comparisons, got %+v", expected, reports)
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+}
+
+func TestMirror_Compare(t *testing.T) {
+    primary := newPool(t, func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/json":
+            w.Header().Set("Content-Type", "application/json")
+            w.Write([]byte(`{"id":1,"name":"a","generated_at":"10:00"}`))
+        case "/header":
+            w.Header().Set("Cache-Control", "max-age=60")
+            w.Write([]byte("same"))
+        default:
+            w.Write([]byte("primary"))
+        }
+    })
+    shadow := newPool(t, func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/json":
+            w.Header().Set("Content-Type", "application/json")
+            w.Write([]byte(`{ "name": "a", "generated_at": "10:01", "id": 1 }`))
+        case "/header":
+            w.Header().Set("Cache-Control", "no-store")
+            w.Write([]byte("same"))
+        case "/status":
+            w.WriteHeader(http.StatusInternalServerError)
+            w.Write([]byte("primary"))
+        default:
+            w.Write([]byte("shadow"))
+        }
+    })
+
+    mirror := NewMirror("canary", Config{
+        Pool:     shadow,
+        Compare:  &Compare{Headers: []string{"Cache-Control"}, IgnoreFields: []string{"generated_at"}},
+        Registry: metrics.NewRegistry(),
+    })
+    router := balancer.NewRouter("primary")
+    router.AddPool("primary", primary)
+    router.AddRoute(balancer.Route{Name: "api", PathPrefix: "/", Middleware: []func(http.Handler) http.Handler{mirror.Middleware}})
+
+    tests := []struct {
+        path     string
+        expected []string
+    }{
+        {path: "/json"},
+        {path: "/header", expected: []string{"header:Cache-Control"}},
+        {path: "/status", expected: []string{"status"}},
+        {path: "/body", expected: []string{"body"}},
+    }
+
+    for _, tt := range tests {
+        rr := httptest.NewRecorder()
+        router.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+        if rr.Code != http.StatusOK {
+            t.Fatalf("%s: primary response status %d", tt.path, rr.Code)
+        }
+    }
+
+    report := waitForCompared(t, mirror, uint64(len(tests)))
+    if report.Route != "api" || report.Mirrored != 4 || report.Mismatches != 3 || report.MismatchRate != 0.75 {
+        t.Errorf("unexpected report %+v", report)
+    }
+
+    byURI := make(map[string][]string)
+    for _, sample := range report.Samples {
+        byURI[sample.URI] = sample.Fields
+    }
+    for _, tt := range tests {
+        if strings.Join(byURI[tt.path], ",") != strings.Join(tt.expected, ",") {
+            t.Errorf("%s: mismatched fields %v, expected %v", tt.path, byURI[tt.path], tt.expected)
+        }
+    }
+}
+
+func TestMirror_MirrorsRequestBody(t *testing.T) {
+    var shadowBody atomic.Value
+    primary := newPool(t, func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        w.Write(body)
+    })
+    shadow := newPool(t, func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        shadowBody.Store(string(body))
+    })
+
+    mirror := NewMirror("copy", Config{Pool: shadow, MaxBodyBytes: 16, Registry: metrics.NewRegistry()})
+    handler := mirror.Middleware(http.HandlerFunc(primary.LoadBalancerHandler))
+
+    tests := []struct {
+        name     string
+        body     string
+        mirrored bool
+    }{
+        {name: "small body mirrored", body: "payload", mirrored: true},
+        {name: "oversized body not mirrored", body: strings.Repeat("x", 64), mirrored: false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            shadowBody.Store("")
+            rr := httptest.NewRecorder()
+            handler.ServeHTTP(rr, httptest.NewRequest("POST", "/", strings.NewReader(tt.body)))
+
+            if rr.Body.String() != tt.body {
+                t.Errorf("primary received %q, expected %q", rr.Body.String(), tt.body)
+            }
+            if !tt.mirrored {
+                return
+            }
+            deadline := time.Now().Add(2 * time.Second)
+            for shadowBody.Load() != tt.body {
+                if time.Now().After(deadline) {
+                    t.Fatalf("shadow received %q, expected %q", shadowBody.Load(), tt.body)
+                }
+                time.Sleep(5 * time.Millisecond)
+            }
+        })
+    }
+
+    if reports := mirror.Report(); len(reports) != 1 || reports[0].Mirrored != 1 || reports[0].Compared != 0 {
+        t.Errorf("unexpected report %+v", reports)
+    }
+}
+
+func TestMirror_SlowStreamingShadow(t *testing.T) {
+    primary := newPool(t, func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte("primary"))
+    })
+    shadow := newPool(t, func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte("first chunk"))
+        w.(http.Flusher).Flush()
+        <-r.Context().Done()
+    })
+
+    mirror := NewMirror("slow", Config{Pool: shadow, Timeout: 50 * time.Millisecond, Compare: &Compare{}, Registry: metrics.NewRegistry()})
+    router := balancer.NewRouter("primary")
+    router.AddPool("primary", primary)
+    router.AddRoute(balancer.Route{Name: "api", PathPrefix: "/", Middleware: []func(http.Handler) http.Handler{mirror.Middleware}})
+    front := httptest.NewServer(router)
+    defer front.Close()
+
+    response, err := http.Get(front.URL + "/")
+    if err != nil {
+        t.Fatalf("GET /: %v", err)
+    }
+    body, _ := io.ReadAll(response.Body)
+    response.Body.Close()
+    if string(body) != "primary" {
+        t.Errorf("Expected the primary response, got %q", body)
+    }
+
+    // The shadow response is cut off by the timeout mid-body; it is
+    // compared once the copy gives up instead of crashing the process.
+    report := waitForCompared(t, mirror, 1)
+    if report.Mismatches != 1 {
+        t.Errorf("Expected the truncated shadow response to mismatch, got %+v", report)
+    }
+}
+
+func TestMirror_Register(t *testing.T) {
+    mirror := NewMirror("canary", Config{Registry: metrics.NewRegistry()})
+    server := admin.NewServer(nil)
+    mirror.Register(server)
+
+    rr := httptest.NewRecorder()
+    server.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/shadow/canary", nil))
+    if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != "[]" {
+        t.Errorf("unexpected response %d %q", rr.Code, rr.Body.String())
+    }
+}
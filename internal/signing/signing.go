@@ -0,0 +1,89 @@
+package signing
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "net/http"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+// DefaultMaxBodyBytes bounds the request bodies buffered to be hashed for
+// a signature when a signer sets no limit of its own.
+const DefaultMaxBodyBytes = 10 << 20
+
+// Signer adds a signature to a request on its way to a backend. The
+// request is a copy the signer may modify; it carries the backend's host
+// and path, exactly as it will be sent.
+type Signer interface {
+    Sign(request *http.Request, now time.Time) error
+}
+
+// Transport signs every request with Signer before passing it to Base
+// (http.DefaultTransport when nil).
+type Transport struct {
+    Base   http.RoundTripper
+    Signer Signer
+}
+
+func (transport *Transport) RoundTrip(request *http.Request) (*http.Response, error) {
+    base := transport.Base
+    if base == nil {
+        base = http.DefaultTransport
+    }
+    signed := request.Clone(request.Context())
+    if err := transport.Signer.Sign(signed, time.Now()); err != nil {
+        if request.Body != nil {
+            request.Body.Close()
+        }
+        return nil, fmt.Errorf("signing: %w", err)
+    }
+    return base.RoundTrip(signed)
+}
+
+func (transport *Transport) CloseIdleConnections() {
+    if closer, ok := transport.Base.(interface{ CloseIdleConnections() }); ok {
+        closer.CloseIdleConnections()
+    }
+}
+
+// Sign makes peer sign its requests with signer. Enable it after any other
+// transport option, such as connection recycling, since those expect the
+// plain transport.
+func Sign(peer *backend.Backend, signer Signer) {
+    peer.ReverseProxy.Transport = &Transport{Base: peer.ReverseProxy.Transport, Signer: signer}
+}
+
+// PayloadHash returns the hex SHA-256 of request's body, buffering the body
+// so it can still be sent. Bodies over limit bytes are refused rather than
+// held in memory.
+func PayloadHash(request *http.Request, limit int64) (string, error) {
+    if request.Body == nil || request.Body == http.NoBody {
+        return emptyHash, nil
+    }
+    if limit <= 0 {
+        limit = DefaultMaxBodyBytes
+    }
+    body, err := io.ReadAll(io.LimitReader(request.Body, limit+1))
+    request.Body.Close()
+    if err != nil {
+        return "", err
+    }
+    if int64(len(body)) > limit {
+        return "", fmt.Errorf("request body over %d bytes cannot be signed", limit)
+    }
+    request.Body = io.NopCloser(bytes.NewReader(body))
+    request.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+    request.ContentLength = int64(len(body))
+    sum := sha256.Sum256(body)
+    return hex.EncodeToString(sum[:]), nil
+}
+
+var emptyHash = func() string {
+    sum := sha256.Sum256(nil)
+    return hex.EncodeToString(sum[:])
+}()
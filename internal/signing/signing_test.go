@@ -0,0 +1,121 @@
+package signing
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+)
+
+func TestSigV4_Sign(t *testing.T) {
+    // The example request from the AWS Signature Version 4 documentation.
+    request := httptest.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+    request.Header = http.Header{"Content-Type": {"application/x-www-form-urlencoded; charset=utf-8"}}
+    signer := &SigV4{AccessKey: "AKIDEXAMPLE", SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", Region: "us-east-1", Service: "iam"}
+
+    if err := signer.Sign(request, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)); err != nil {
+        t.Fatalf("sign: %v", err)
+    }
+    expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+    if authorization := request.Header.Get("Authorization"); authorization != expected {
+        t.Errorf("Expected %q, got %q", expected, authorization)
+    }
+}
+
+func TestSigV4_S3Headers(t *testing.T) {
+    tests := []struct {
+        name            string
+        unsigned        bool
+        expectedPayload string
+    }{
+        {name: "hashed payload", expectedPayload: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+        {name: "unsigned payload", unsigned: true, expectedPayload: "UNSIGNED-PAYLOAD"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            request := httptest.NewRequest("PUT", "http://minio:9000/bucket/my%20object", strings.NewReader("hello"))
+            signer := &SigV4{AccessKey: "key", SecretKey: "secret", SessionToken: "token", Region: "us-east-1", Service: "s3", UnsignedPayload: tt.unsigned}
+            if err := signer.Sign(request, time.Now()); err != nil {
+                t.Fatalf("sign: %v", err)
+            }
+            if payload := request.Header.Get("X-Amz-Content-Sha256"); payload != tt.expectedPayload {
+                t.Errorf("Expected payload %q, got %q", tt.expectedPayload, payload)
+            }
+            if authorization := request.Header.Get("Authorization"); !strings.Contains(authorization, "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token,") {
+                t.Errorf("Expected the amz headers signed, got %q", authorization)
+            }
+            if body, _ := io.ReadAll(request.Body); string(body) != "hello" {
+                t.Errorf("Expected the body kept after hashing, got %q", body)
+            }
+        })
+    }
+}
+
+func TestCanonicalPath(t *testing.T) {
+    location, _ := url.Parse("http://example.com/docs/a%20b/c%2Fd")
+    if path := canonicalPath(location, false); path != "/docs/a%20b/c%2Fd" {
+        t.Errorf("Expected the S3 path encoded once, got %q", path)
+    }
+    if path := canonicalPath(location, true); path != "/docs/a%2520b/c%252Fd" {
+        t.Errorf("Expected the path encoded twice, got %q", path)
+    }
+}
+
+func TestSign_Backend(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    secret := []byte("shared")
+    server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        body, _ := io.ReadAll(request.Body)
+        sum := sha256.Sum256(body)
+        lines := []string{request.Method, request.URL.RequestURI(), request.Header.Get("X-Signature-Timestamp"), hex.EncodeToString(sum[:]), request.Header.Get("X-Tenant")}
+        mac := hmac.New(sha256.New, secret)
+        mac.Write([]byte(strings.Join(lines, "\n")))
+        expected := "keyId=lb,headers=x-tenant,signature=" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+        if request.Header.Get("X-Signature") != expected {
+            http.Error(writer, "bad signature", http.StatusUnauthorized)
+            return
+        }
+        writer.Write(body)
+    }))
+    defer server.Close()
+
+    backendURL, _ := url.Parse(server.URL)
+    peer := &backend.Backend{URL: backendURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(backendURL)}
+    Sign(peer, &HMAC{KeyID: "lb", Secret: secret, SignedHeaders: []string{"X-Tenant"}, MaxBodyBytes: 16})
+
+    tests := []struct {
+        name         string
+        body         string
+        expectedCode int
+    }{
+        {name: "signed", body: "order=1", expectedCode: http.StatusOK},
+        {name: "body too large to sign", body: strings.Repeat("x", 17), expectedCode: http.StatusBadGateway},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            request := httptest.NewRequest("POST", "/orders?page=2", strings.NewReader(tt.body))
+            request.Header.Set("X-Tenant", "acme")
+            rr := httptest.NewRecorder()
+            peer.ReverseProxy.ServeHTTP(rr, request)
+            if rr.Code != tt.expectedCode {
+                t.Errorf("Expected status %d, got %d: %s", tt.expectedCode, rr.Code, rr.Body)
+            }
+        })
+    }
+}
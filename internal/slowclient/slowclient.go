@@ -0,0 +1,158 @@
+package slowclient
+
+import (
+    "errors"
+    "io"
+    "log"
+    "net/http"
+    "time"
+
+    "load-balancer/internal/metrics"
+)
+
+// Config sets the minimum transfer rates, in bytes per second, a client must
+// sustain while sending the request body and receiving the response. A zero
+// rate disables that direction. Only time spent blocked on the client counts,
+// so a slow backend or an idle streaming response is never penalised.
+type Config struct {
+    MinReadRate  float64
+    MinWriteRate float64
+    Grace        time.Duration
+    Registry     *metrics.Registry
+}
+
+type budget struct {
+    rate        float64
+    grace       time.Duration
+    transferred int64
+    blocked     time.Duration
+}
+
+// deadline returns when the next transfer of n bytes must complete: the
+// client may spend Grace plus the time the minimum rate allows for
+// everything transferred so far, minus the time it has already been blocked.
+func (b *budget) deadline(now time.Time, n int) time.Time {
+    allowed := b.grace + time.Duration(float64(b.transferred+int64(n))/b.rate*float64(time.Second))
+    return now.Add(allowed - b.blocked)
+}
+
+func (b *budget) record(n int, elapsed time.Duration) {
+    b.transferred += int64(n)
+    b.blocked += elapsed
+}
+
+func Middleware(config Config) func(next http.Handler) http.Handler {
+    if config.Grace <= 0 {
+        config.Grace = 10 * time.Second
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+    slowReads := config.Registry.Counter("lb_slow_client_aborts_total", "Connections aborted for transferring below the minimum rate.", "direction", "read")
+    slowWrites := config.Registry.Counter("lb_slow_client_aborts_total", "Connections aborted for transferring below the minimum rate.", "direction", "write")
+
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+            controller := http.NewResponseController(writer)
+
+            if config.MinReadRate > 0 && request.Body != nil && request.Body != http.NoBody {
+                request.Body = &slowReader{
+                    ReadCloser: request.Body,
+                    controller: controller,
+                    budget:     budget{rate: config.MinReadRate, grace: config.Grace},
+                    aborts:     slowReads,
+                    client:     request.RemoteAddr,
+                }
+                defer controller.SetReadDeadline(time.Time{})
+            }
+            if config.MinWriteRate > 0 {
+                writer = &slowWriter{
+                    ResponseWriter: writer,
+                    controller:     controller,
+                    budget:         budget{rate: config.MinWriteRate, grace: config.Grace},
+                    aborts:         slowWrites,
+                    client:         request.RemoteAddr,
+                }
+                defer controller.SetWriteDeadline(time.Time{})
+            }
+
+            next.ServeHTTP(writer, request)
+        })
+    }
+}
+
+type slowReader struct {
+    io.ReadCloser
+    controller  *http.ResponseController
+    budget      budget
+    aborts      *metrics.Counter
+    client      string
+    unsupported bool
+}
+
+func (reader *slowReader) Read(p []byte) (int, error) {
+    if reader.unsupported {
+        return reader.ReadCloser.Read(p)
+    }
+
+    start := time.Now()
+    if err := reader.controller.SetReadDeadline(reader.budget.deadline(start, 1)); err != nil {
+        reader.unsupported = true
+        return reader.ReadCloser.Read(p)
+    }
+    n, err := reader.ReadCloser.Read(p)
+    reader.budget.record(n, time.Since(start))
+    if isTimeout(err) {
+        reader.aborts.Inc()
+        log.Printf("slowclient: %s sent request body below minimum rate, aborting\n", reader.client)
+    }
+    return n, err
+}
+
+type slowWriter struct {
+    http.ResponseWriter
+    controller  *http.ResponseController
+    budget      budget
+    aborts      *metrics.Counter
+    client      string
+    unsupported bool
+}
+
+func (writer *slowWriter) Write(p []byte) (int, error) {
+    if writer.unsupported {
+        return writer.ResponseWriter.Write(p)
+    }
+
+    start := time.Now()
+    if err := writer.controller.SetWriteDeadline(writer.budget.deadline(start, len(p))); err != nil {
+        writer.unsupported = true
+        return writer.ResponseWriter.Write(p)
+    }
+    n, err := writer.ResponseWriter.Write(p)
+    writer.budget.record(n, time.Since(start))
+    if isTimeout(err) {
+        writer.aborts.Inc()
+        log.Printf("slowclient: %s read response below minimum rate, aborting\n", writer.client)
+    }
+    return n, err
+}
+
+// Flush is where buffered writes actually block on the client, so it is
+// held to the same budget.
+func (writer *slowWriter) Flush() {
+    if !writer.unsupported {
+        start := time.Now()
+        writer.controller.SetWriteDeadline(writer.budget.deadline(start, 0))
+        defer func() { writer.budget.record(0, time.Since(start)) }()
+    }
+    writer.controller.Flush()
+}
+
+func (writer *slowWriter) Unwrap() http.ResponseWriter {
+    return writer.ResponseWriter
+}
+
+func isTimeout(err error) bool {
+    var timeout interface{ Timeout() bool }
+    return errors.As(err, &timeout) && timeout.Timeout()
+}
@@ -0,0 +1,154 @@
+package slowclient
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "load-balancer/internal/metrics"
+)
+
+func TestBudget_Deadline(t *testing.T) {
+    now := time.Unix(1000, 0)
+    tests := []struct {
+        name        string
+        transferred int64
+        blocked     time.Duration
+        next        int
+        expected    time.Duration
+    }{
+        {name: "grace only", next: 0, expected: time.Second},
+        {name: "credit for the next transfer", next: 100, expected: 2 * time.Second},
+        {name: "credit for earlier transfers", transferred: 200, blocked: time.Second, next: 100, expected: 3 * time.Second},
+        {name: "budget exhausted", transferred: 100, blocked: 5 * time.Second, expected: -3 * time.Second},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            b := budget{rate: 100, grace: time.Second, transferred: tt.transferred, blocked: tt.blocked}
+            if got := b.deadline(now, tt.next).Sub(now); got != tt.expected {
+                t.Errorf("deadline() = now%+v, expected now%+v", got, tt.expected)
+            }
+        })
+    }
+}
+
+func TestMiddleware_SlowRequestBody(t *testing.T) {
+    registry := metrics.NewRegistry()
+    results := make(chan error, 1)
+    server := httptest.NewServer(Middleware(Config{MinReadRate: 100, Grace: 100 * time.Millisecond, Registry: registry})(
+        http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            _, err := io.ReadAll(r.Body)
+            results <- err
+        }),
+    ))
+    defer server.Close()
+
+    tests := []struct {
+        name      string
+        interval  time.Duration
+        expectErr bool
+    }{
+        {name: "fast client", interval: 0},
+        {name: "dribbling client", interval: 100 * time.Millisecond, expectErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            conn, err := net.Dial("tcp", server.Listener.Addr().String())
+            if err != nil {
+                t.Fatal(err)
+            }
+            defer conn.Close()
+
+            body := strings.Repeat("x", 20)
+            fmt.Fprintf(conn, "POST / HTTP/1.1\r\nHost: test\r\nContent-Length: %d\r\n\r\n", len(body))
+            go func() {
+                for i := 0; i < len(body); i++ {
+                    if _, err := conn.Write([]byte{body[i]}); err != nil {
+                        return
+                    }
+                    time.Sleep(tt.interval)
+                }
+            }()
+
+            select {
+            case err := <-results:
+                if (err != nil) != tt.expectErr {
+                    t.Errorf("Expected error %v, got %v", tt.expectErr, err)
+                }
+            case <-time.After(3 * time.Second):
+                t.Fatal("handler did not finish reading")
+            }
+        })
+    }
+
+    var text strings.Builder
+    registry.WriteText(&text)
+    if !strings.Contains(text.String(), `lb_slow_client_aborts_total{direction="read"} 1`) {
+        t.Errorf("Expected one read abort in metrics, got:\n%s", text.String())
+    }
+}
+
+func TestMiddleware_SlowResponseReader(t *testing.T) {
+    results := make(chan error, 1)
+    server := httptest.NewServer(Middleware(Config{MinWriteRate: 100 << 20, Grace: 100 * time.Millisecond, Registry: metrics.NewRegistry()})(
+        http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            chunk := make([]byte, 32<<10)
+            for i := 0; i < 4096; i++ {
+                if _, err := w.Write(chunk); err != nil {
+                    results <- err
+                    return
+                }
+            }
+            results <- nil
+        }),
+    ))
+    defer server.Close()
+
+    conn, err := net.Dial("tcp", server.Listener.Addr().String())
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer conn.Close()
+    fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: test\r\n\r\n")
+    bufio.NewReader(conn).ReadString('\n')
+
+    select {
+    case err := <-results:
+        if !isTimeout(err) {
+            t.Errorf("Expected write timeout for a client that stopped reading, got %v", err)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("handler was not cut off")
+    }
+}
+
+func TestMiddleware_IdleStreamNotPenalised(t *testing.T) {
+    server := httptest.NewServer(Middleware(Config{MinWriteRate: 1000, Grace: 50 * time.Millisecond, Registry: metrics.NewRegistry()})(
+        http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            for i := 0; i < 3; i++ {
+                w.Write([]byte("tick\n"))
+                w.(http.Flusher).Flush()
+                time.Sleep(100 * time.Millisecond)
+            }
+        }),
+    ))
+    defer server.Close()
+
+    resp, err := http.Get(server.URL)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    body, err := io.ReadAll(resp.Body)
+    if err != nil || string(body) != "tick\ntick\ntick\n" {
+        t.Errorf("Expected full stream, got %q (%v)", body, err)
+    }
+}
@@ -0,0 +1,176 @@
+package snapshot
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/fs"
+    "log"
+    "os"
+    "path/filepath"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+)
+
+// Config describes where cumulative counts are kept across restarts: the
+// counters and histograms of Registry (default metrics.Default) and the
+// request and byte totals of the backends in Pools, keyed by pool name.
+// They are written to Path every Interval (default a minute) and when Run
+// stops.
+type Config struct {
+    Path     string
+    Interval time.Duration
+    Registry *metrics.Registry
+    Pools    map[string]*balancer.ServerPool
+}
+
+// file is the snapshot as written to disk.
+type file struct {
+    Saved    time.Time                    `json:"saved"`
+    Metrics  metrics.Snapshot             `json:"metrics"`
+    Backends map[string]map[string]totals `json:"backends"`
+}
+
+type totals struct {
+    Requests      uint64 `json:"requests"`
+    Errors        uint64 `json:"errors"`
+    ClientAborts  uint64 `json:"client_aborts"`
+    BytesIn       uint64 `json:"bytes_in"`
+    BytesOut      uint64 `json:"bytes_out"`
+    TLSHandshakes uint64 `json:"tls_handshakes"`
+    TLSResumed    uint64 `json:"tls_resumed"`
+    TLSFailures   uint64 `json:"tls_failures"`
+}
+
+type Snapshotter struct {
+    config Config
+}
+
+func New(config Config) (*Snapshotter, error) {
+    if config.Path == "" {
+        return nil, errors.New("snapshot: path is required")
+    }
+    if config.Interval <= 0 {
+        config.Interval = time.Minute
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+    return &Snapshotter{config: config}, nil
+}
+
+// Restore adds the saved counts to the registry and to the backends that
+// are still in their pools. Call it once at startup, before Run; a missing
+// file is not an error, as on the first start.
+func (snapshotter *Snapshotter) Restore() error {
+    data, err := os.ReadFile(snapshotter.config.Path)
+    if errors.Is(err, fs.ErrNotExist) {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("snapshot: %w", err)
+    }
+    var saved file
+    if err := json.Unmarshal(data, &saved); err != nil {
+        return fmt.Errorf("snapshot: %s: %w", snapshotter.config.Path, err)
+    }
+
+    snapshotter.config.Registry.Restore(saved.Metrics)
+    restored := 0
+    for name, pool := range snapshotter.config.Pools {
+        for _, peer := range pool.Backends() {
+            if counts, ok := saved.Backends[name][peer.URL.String()]; ok {
+                peer.RestoreStats(backend.Stats{
+                    Requests:      counts.Requests,
+                    Errors:        counts.Errors,
+                    ClientAborts:  counts.ClientAborts,
+                    BytesIn:       counts.BytesIn,
+                    BytesOut:      counts.BytesOut,
+                    TLSHandshakes: counts.TLSHandshakes,
+                    TLSResumed:    counts.TLSResumed,
+                    TLSFailures:   counts.TLSFailures,
+                })
+                restored++
+            }
+        }
+    }
+    log.Printf("snapshot: restored metrics saved %s ago and totals of %d backends\n", time.Since(saved.Saved).Round(time.Second), restored)
+    return nil
+}
+
+// Save writes the current counts, replacing the file atomically so a crash
+// mid-write leaves the previous snapshot intact.
+func (snapshotter *Snapshotter) Save() error {
+    saved := file{
+        Saved:    time.Now(),
+        Metrics:  snapshotter.config.Registry.Snapshot(),
+        Backends: make(map[string]map[string]totals),
+    }
+    for name, pool := range snapshotter.config.Pools {
+        backends := make(map[string]totals)
+        for _, peer := range pool.Backends() {
+            stats := peer.Stats()
+            backends[peer.URL.String()] = totals{
+                Requests:      stats.Requests,
+                Errors:        stats.Errors,
+                ClientAborts:  stats.ClientAborts,
+                BytesIn:       stats.BytesIn,
+                BytesOut:      stats.BytesOut,
+                TLSHandshakes: stats.TLSHandshakes,
+                TLSResumed:    stats.TLSResumed,
+                TLSFailures:   stats.TLSFailures,
+            }
+        }
+        saved.Backends[name] = backends
+    }
+    data, err := json.Marshal(saved)
+    if err != nil {
+        return fmt.Errorf("snapshot: %w", err)
+    }
+
+    temp, err := os.CreateTemp(filepath.Dir(snapshotter.config.Path), filepath.Base(snapshotter.config.Path)+".*")
+    if err != nil {
+        return fmt.Errorf("snapshot: %w", err)
+    }
+    defer os.Remove(temp.Name())
+    if _, err := temp.Write(data); err != nil {
+        temp.Close()
+        return fmt.Errorf("snapshot: %w", err)
+    }
+    if err := temp.Sync(); err != nil {
+        temp.Close()
+        return fmt.Errorf("snapshot: %w", err)
+    }
+    if err := temp.Close(); err != nil {
+        return fmt.Errorf("snapshot: %w", err)
+    }
+    if err := os.Rename(temp.Name(), snapshotter.config.Path); err != nil {
+        return fmt.Errorf("snapshot: %w", err)
+    }
+    return nil
+}
+
+// Run saves a snapshot every Interval until ctx is cancelled, then saves a
+// last one so a clean shutdown loses nothing.
+func (snapshotter *Snapshotter) Run(ctx context.Context) {
+    ticker := time.NewTicker(snapshotter.config.Interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            if err := snapshotter.Save(); err != nil {
+                log.Printf("%v\n", err)
+            }
+            return
+        case <-ticker.C:
+            if err := snapshotter.Save(); err != nil {
+                log.Printf("%v\n", err)
+            }
+        }
+    }
+}
@@ -0,0 +1,96 @@
+package snapshot
+
+import (
+    "context"
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+)
+
+func newPool(urls ...string) (*balancer.ServerPool, []*backend.Backend) {
+    pool := balancer.NewServerPool()
+    var backends []*backend.Backend
+    for _, raw := range urls {
+        backendURL, _ := url.Parse(raw)
+        peer := &backend.Backend{URL: backendURL, Alive: true}
+        pool.AddBackend(peer)
+        backends = append(backends, peer)
+    }
+    return pool, backends
+}
+
+func TestSnapshotter_SurvivesRestart(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    path := filepath.Join(t.TempDir(), "metrics.json")
+
+    registry := metrics.NewRegistry()
+    registry.Counter("lb_requests_total", "", "pool", "web").Add(41)
+    pool, backends := newPool("http://a:80", "http://b:80")
+    for i := 0; i < 3; i++ {
+        backends[0].Forward(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("hello")) }), httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+    }
+    snapshotter, _ := New(Config{Path: path, Interval: time.Hour, Registry: registry, Pools: map[string]*balancer.ServerPool{"web": pool}})
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    go func() {
+        snapshotter.Run(ctx)
+        close(done)
+    }()
+    cancel()
+    <-done
+
+    // A fresh process: new registry and backends, with b gone and c added.
+    restarted := metrics.NewRegistry()
+    restarted.Counter("lb_requests_total", "", "pool", "web").Inc()
+    pool, backends = newPool("http://a:80", "http://c:80")
+    snapshotter, _ = New(Config{Path: path, Registry: restarted, Pools: map[string]*balancer.ServerPool{"web": pool}})
+    if err := snapshotter.Restore(); err != nil {
+        t.Fatalf("Restore() error: %v", err)
+    }
+
+    if value := restarted.Counter("lb_requests_total", "", "pool", "web").Value(); value != 42 {
+        t.Errorf("Expected the counter to carry on at 42, got %v", value)
+    }
+    if stats := backends[0].Stats(); stats.Requests != 3 || stats.BytesOut != 15 {
+        t.Errorf("Expected a's totals restored, got %+v", stats)
+    }
+    if stats := backends[1].Stats(); stats.Requests != 0 {
+        t.Errorf("Expected c to start from zero, got %+v", stats)
+    }
+}
+
+func TestSnapshotter_Restore(t *testing.T) {
+    dir := t.TempDir()
+    corrupt := filepath.Join(dir, "corrupt.json")
+    os.WriteFile(corrupt, []byte("{"), 0o644)
+
+    tests := []struct {
+        name        string
+        path        string
+        expectedErr bool
+    }{
+        {name: "first start", path: filepath.Join(dir, "missing.json")},
+        {name: "corrupt file", path: corrupt, expectedErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            snapshotter, _ := New(Config{Path: tt.path, Registry: metrics.NewRegistry()})
+            if err := snapshotter.Restore(); (err != nil) != tt.expectedErr {
+                t.Errorf("Expected error %v, got %v", tt.expectedErr, err)
+            }
+        })
+    }
+}
@@ -0,0 +1,154 @@
+package sticky
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "load-balancer/internal/admin"
+)
+
+// maxSyncBytes bounds a batch of pins accepted from a peer.
+const maxSyncBytes = 8 << 20
+
+// Run replicates the table until ctx is cancelled. It first loads the pins
+// the peers already hold, so a restarted instance keeps existing sessions
+// where they are, then pushes new pins every SyncInterval. Pins a peer
+// misses while unreachable are retried on the next push. Run also forgets
+// expired pins, so it is needed even without peers.
+func (table *Table) Run(ctx context.Context) {
+    for _, peer := range table.config.Peers {
+        if err := table.pull(ctx, peer); err != nil {
+            log.Printf("sticky %s: loading pins from %s failed: %v\n", table.config.Name, peer, err)
+        }
+    }
+
+    ticker := time.NewTicker(table.config.SyncInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case now := <-ticker.C:
+            table.prune(now)
+            table.push(ctx, now)
+        }
+    }
+}
+
+func (table *Table) pull(ctx context.Context, peer string) error {
+    request, err := http.NewRequestWithContext(ctx, http.MethodGet, table.peerURL(peer, ""), nil)
+    if err != nil {
+        return err
+    }
+    response, err := table.config.Client.Do(request)
+    if err != nil {
+        return err
+    }
+    defer response.Body.Close()
+    if response.StatusCode != http.StatusOK {
+        return fmt.Errorf("unexpected status %s", response.Status)
+    }
+    var entries []Entry
+    if err := json.NewDecoder(io.LimitReader(response.Body, maxSyncBytes)).Decode(&entries); err != nil {
+        return err
+    }
+    table.Merge(entries)
+    return nil
+}
+
+// push sends each peer the pins queued for it, concurrently.
+func (table *Table) push(ctx context.Context, now time.Time) {
+    var wg sync.WaitGroup
+    for _, peer := range table.config.Peers {
+        entries := table.takePending(peer, now)
+        if len(entries) == 0 {
+            continue
+        }
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            if err := table.send(ctx, peer, entries); err != nil {
+                table.config.Registry.Counter("lb_sticky_sync_errors_total", "Failed pushes of sticky session pins to a peer.", "table", table.config.Name, "peer", peer).Inc()
+                log.Printf("sticky %s: pushing %d pins to %s failed: %v\n", table.config.Name, len(entries), peer, err)
+                table.requeue(peer, entries)
+                return
+            }
+            table.config.Registry.Counter("lb_sticky_synced_total", "Sticky session pins pushed to a peer.", "table", table.config.Name, "peer", peer).Add(float64(len(entries)))
+        }()
+    }
+    wg.Wait()
+}
+
+func (table *Table) send(ctx context.Context, peer string, entries []Entry) error {
+    body, err := json.Marshal(entries)
+    if err != nil {
+        return err
+    }
+    request, err := http.NewRequestWithContext(ctx, http.MethodPost, table.peerURL(peer, "/sync"), bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    request.Header.Set("Content-Type", "application/json")
+    response, err := table.config.Client.Do(request)
+    if err != nil {
+        return err
+    }
+    defer response.Body.Close()
+    io.Copy(io.Discard, response.Body)
+    if response.StatusCode != http.StatusNoContent {
+        return fmt.Errorf("unexpected status %s", response.Status)
+    }
+    return nil
+}
+
+func (table *Table) peerURL(peer, suffix string) string {
+    return strings.TrimSuffix(peer, "/") + "/admin/sticky/" + table.config.Name + suffix
+}
+
+// takePending removes and returns the unexpired pins queued for peer.
+func (table *Table) takePending(peer string, now time.Time) []Entry {
+    table.mux.Lock()
+    defer table.mux.Unlock()
+
+    pending := table.pending[peer]
+    entries := make([]Entry, 0, len(pending))
+    for session, entry := range pending {
+        if !table.expired(entry, now) {
+            entries = append(entries, entry)
+        }
+        delete(pending, session)
+    }
+    return entries
+}
+
+// requeue queues entries for peer again, unless a newer pin of the same
+// session was queued meanwhile.
+func (table *Table) requeue(peer string, entries []Entry) {
+    table.mux.Lock()
+    defer table.mux.Unlock()
+
+    pending := table.pending[peer]
+    for _, entry := range entries {
+        if queued, ok := pending[entry.Session]; !ok || newer(entry, queued) {
+            pending[entry.Session] = entry
+        }
+    }
+}
+
+func (table *Table) serveSync(writer http.ResponseWriter, request *http.Request) {
+    var entries []Entry
+    if err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, maxSyncBytes)).Decode(&entries); err != nil {
+        admin.WriteError(writer, http.StatusBadRequest, "invalid sync body: "+err.Error())
+        return
+    }
+    table.Merge(entries)
+    writer.WriteHeader(http.StatusNoContent)
+}
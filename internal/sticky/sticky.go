@@ -0,0 +1,311 @@
+package sticky
+
+import (
+    "container/list"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "net/http"
+    "sort"
+    "sync"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+)
+
+// Config describes a sticky session table. Clients are identified by
+// Cookie (default lb_sticky), which Middleware issues to clients without
+// one, and stay pinned to a backend for TTL (default 30 minutes) after
+// they were last seen. Peers lists the admin base URLs of the other
+// balancer instances serving the same clients, e.g. http://lb-2:9000; pins
+// are pushed to them every SyncInterval (default a second), so a client
+// landing on another instance still reaches its backend. At most
+// MaxEntries pins (default 100000) are kept; past that, the pin of the
+// session seen least recently is dropped, so clients that never send the
+// cookie back cannot grow the table without bound.
+type Config struct {
+    Name         string
+    Cookie       string
+    TTL          time.Duration
+    Peers        []string
+    SyncInterval time.Duration
+    MaxEntries   int
+    Client       *http.Client
+    Registry     *metrics.Registry
+}
+
+// Entry pins a session to a backend, identified by URL so it means the same
+// backend on every instance. Session is a hash of the session cookie, so
+// neither the table nor its admin endpoint hands out cookies that could be
+// replayed. Updated orders conflicting pins: the newest wins.
+type Entry struct {
+    Session string    `json:"session"`
+    Backend string    `json:"backend"`
+    Updated time.Time `json:"updated"`
+}
+
+type Table struct {
+    config  Config
+    entries *metrics.Gauge
+
+    mux     sync.Mutex
+    pins    map[string]*list.Element
+    order   *list.List
+    pending map[string]map[string]Entry
+}
+
+func New(config Config) (*Table, error) {
+    if config.Name == "" {
+        return nil, errors.New("sticky: name is required")
+    }
+    if config.Cookie == "" {
+        config.Cookie = "lb_sticky"
+    }
+    if config.TTL <= 0 {
+        config.TTL = 30 * time.Minute
+    }
+    if config.SyncInterval <= 0 {
+        config.SyncInterval = time.Second
+    }
+    if config.MaxEntries <= 0 {
+        config.MaxEntries = 100000
+    }
+    if config.Client == nil {
+        config.Client = &http.Client{Timeout: 2 * time.Second}
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+    table := &Table{
+        config:  config,
+        entries: config.Registry.Gauge("lb_sticky_entries", "Sessions pinned to a backend.", "table", config.Name),
+        pins:    make(map[string]*list.Element),
+        order:   list.New(),
+        pending: make(map[string]map[string]Entry),
+    }
+    for _, peer := range config.Peers {
+        table.pending[peer] = make(map[string]Entry)
+    }
+    return table, nil
+}
+
+// Middleware issues the session cookie to clients without one. The cookie
+// is also added to the request, so its first pick is already pinned.
+func (table *Table) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        if cookie, err := request.Cookie(table.config.Cookie); err != nil || cookie.Value == "" {
+            cookie := &http.Cookie{
+                Name:     table.config.Cookie,
+                Value:    newSession(),
+                Path:     "/",
+                HttpOnly: true,
+                SameSite: http.SameSiteLaxMode,
+            }
+            http.SetCookie(writer, cookie)
+            request.AddCookie(cookie)
+        }
+        next.ServeHTTP(writer, request)
+    })
+}
+
+func newSession() string {
+    buf := make([]byte, 16)
+    rand.Read(buf)
+    return hex.EncodeToString(buf)
+}
+
+// sessionID is the key a session cookie is pinned under.
+func sessionID(cookie string) string {
+    sum := sha256.Sum256([]byte(cookie))
+    return hex.EncodeToString(sum[:16])
+}
+
+// Strategy wraps base, sending each session to its pinned backend while
+// that backend is a candidate and pinning it to base's pick otherwise. A
+// nil base picks round robin.
+func (table *Table) Strategy(base balancer.Strategy) balancer.Strategy {
+    if base == nil {
+        base, _ = balancer.NewStrategy(balancer.StrategyConfig{Name: "round_robin"})
+    }
+    return &strategy{table: table, base: base}
+}
+
+type strategy struct {
+    table *Table
+    base  balancer.Strategy
+}
+
+func (strategy *strategy) Pick(request *http.Request, candidates []*backend.Backend) *backend.Backend {
+    if request == nil {
+        return strategy.base.Pick(request, candidates)
+    }
+    cookie, err := request.Cookie(strategy.table.config.Cookie)
+    if err != nil || cookie.Value == "" {
+        strategy.table.lookup("none")
+        return strategy.base.Pick(request, candidates)
+    }
+
+    now := time.Now()
+    session := sessionID(cookie.Value)
+    entry, ok := strategy.table.get(session, now)
+    if ok {
+        for _, peer := range candidates {
+            if peer.URL.String() == entry.Backend {
+                strategy.table.lookup("hit")
+                strategy.table.touch(entry, now)
+                return peer
+            }
+        }
+    }
+
+    peer := strategy.base.Pick(request, candidates)
+    if peer == nil {
+        return nil
+    }
+    if ok {
+        strategy.table.lookup("moved")
+    } else {
+        strategy.table.lookup("miss")
+    }
+    strategy.table.pin(Entry{Session: session, Backend: peer.URL.String(), Updated: now})
+    return peer
+}
+
+// Observe passes latency on to base when it learns from it.
+func (strategy *strategy) Observe(peer *backend.Backend, elapsed time.Duration) {
+    if observer, ok := strategy.base.(balancer.LatencyObserver); ok {
+        observer.Observe(peer, elapsed)
+    }
+}
+
+func (table *Table) lookup(result string) {
+    table.config.Registry.Counter("lb_sticky_lookups_total", "Sticky session lookups by result.", "table", table.config.Name, "result", result).Inc()
+}
+
+func (table *Table) get(session string, now time.Time) (Entry, bool) {
+    table.mux.Lock()
+    defer table.mux.Unlock()
+
+    element, ok := table.pins[session]
+    if !ok || table.expired(element.Value.(Entry), now) {
+        return Entry{}, false
+    }
+    table.order.MoveToFront(element)
+    return element.Value.(Entry), true
+}
+
+// touch renews a pin once it is half way to expiring, so a busy session is
+// not replicated on every request.
+func (table *Table) touch(entry Entry, now time.Time) {
+    if now.Sub(entry.Updated) < table.config.TTL/2 {
+        return
+    }
+    entry.Updated = now
+    table.pin(entry)
+}
+
+// pin records entry locally and queues it for the peers.
+func (table *Table) pin(entry Entry) {
+    table.mux.Lock()
+    table.setLocked(entry)
+    for _, pending := range table.pending {
+        pending[entry.Session] = entry
+    }
+    table.entries.Set(float64(len(table.pins)))
+    table.mux.Unlock()
+}
+
+// Merge applies entries learned from another instance, keeping whichever
+// pin of a session is newest. Merged entries are not pushed on again: every
+// instance pushes its own pins to all of its peers.
+func (table *Table) Merge(entries []Entry) {
+    now := time.Now()
+    table.mux.Lock()
+    defer table.mux.Unlock()
+
+    for _, entry := range entries {
+        if entry.Session == "" || entry.Backend == "" || table.expired(entry, now) {
+            continue
+        }
+        if current, ok := table.pins[entry.Session]; ok && !newer(entry, current.Value.(Entry)) {
+            continue
+        }
+        table.setLocked(entry)
+    }
+    table.entries.Set(float64(len(table.pins)))
+}
+
+// setLocked stores entry as the most recently used pin, dropping the least
+// recently used ones, and anything still queued for them, to stay within
+// MaxEntries.
+func (table *Table) setLocked(entry Entry) {
+    if element, ok := table.pins[entry.Session]; ok {
+        element.Value = entry
+        table.order.MoveToFront(element)
+        return
+    }
+    for table.order.Len() >= table.config.MaxEntries {
+        oldest := table.order.Remove(table.order.Back()).(Entry)
+        delete(table.pins, oldest.Session)
+        for _, pending := range table.pending {
+            delete(pending, oldest.Session)
+        }
+    }
+    table.pins[entry.Session] = table.order.PushFront(entry)
+}
+
+// newer reports whether a should replace b, breaking ties by backend so
+// every instance settles on the same pin.
+func newer(a, b Entry) bool {
+    if !a.Updated.Equal(b.Updated) {
+        return a.Updated.After(b.Updated)
+    }
+    return a.Backend > b.Backend
+}
+
+func (table *Table) expired(entry Entry, now time.Time) bool {
+    return now.Sub(entry.Updated) >= table.config.TTL
+}
+
+func (table *Table) prune(now time.Time) {
+    table.mux.Lock()
+    defer table.mux.Unlock()
+
+    for session, element := range table.pins {
+        if table.expired(element.Value.(Entry), now) {
+            table.order.Remove(element)
+            delete(table.pins, session)
+        }
+    }
+    table.entries.Set(float64(len(table.pins)))
+}
+
+// Entries returns the live pins, oldest first.
+func (table *Table) Entries() []Entry {
+    now := time.Now()
+    table.mux.Lock()
+    entries := make([]Entry, 0, len(table.pins))
+    for _, element := range table.pins {
+        if entry := element.Value.(Entry); !table.expired(entry, now) {
+            entries = append(entries, entry)
+        }
+    }
+    table.mux.Unlock()
+
+    sort.Slice(entries, func(i, j int) bool { return entries[i].Updated.Before(entries[j].Updated) })
+    return entries
+}
+
+// Register serves the table to peers and operators: GET lists the pins,
+// keyed by session hash, and POST .../sync merges pins pushed by a peer.
+func (table *Table) Register(server *admin.Server) {
+    prefix := "/admin/sticky/" + table.config.Name
+    server.HandleFunc("GET "+prefix, func(writer http.ResponseWriter, request *http.Request) {
+        admin.WriteJSON(writer, http.StatusOK, table.Entries())
+    })
+    server.HandleFunc("POST "+prefix+"/sync", table.serveSync)
+}
@@ -0,0 +1,202 @@
+package sticky
+
+import (
+    "context"
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/backend"
+    "load-balancer/internal/metrics"
+)
+
+func newBackends(names ...string) []*backend.Backend {
+    backends := make([]*backend.Backend, 0, len(names))
+    for _, name := range names {
+        backendURL, _ := url.Parse("http://" + name)
+        backends = append(backends, &backend.Backend{URL: backendURL, Alive: true})
+    }
+    return backends
+}
+
+func requestWithSession(session string) *http.Request {
+    request := httptest.NewRequest("GET", "/", nil)
+    request.AddCookie(&http.Cookie{Name: "lb_sticky", Value: session})
+    return request
+}
+
+func TestTable_Middleware(t *testing.T) {
+    table, _ := New(Config{Name: "web", Registry: metrics.NewRegistry()})
+    var seen string
+    handler := table.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        if cookie, err := request.Cookie("lb_sticky"); err == nil {
+            seen = cookie.Value
+        }
+    }))
+
+    rr := httptest.NewRecorder()
+    handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+    cookies := rr.Result().Cookies()
+    if len(cookies) != 1 || cookies[0].Value == "" || cookies[0].Value != seen {
+        t.Fatalf("Expected a new session cookie also seen by the handler, got %v and %q", cookies, seen)
+    }
+
+    rr = httptest.NewRecorder()
+    handler.ServeHTTP(rr, requestWithSession("abc"))
+    if len(rr.Result().Cookies()) != 0 || seen != "abc" {
+        t.Errorf("Expected the existing session kept, got %v and %q", rr.Result().Cookies(), seen)
+    }
+}
+
+func TestTable_Strategy(t *testing.T) {
+    registry := metrics.NewRegistry()
+    table, _ := New(Config{Name: "web", Registry: registry})
+    strategy := table.Strategy(nil)
+    backends := newBackends("a", "b", "c")
+
+    first := strategy.Pick(requestWithSession("s1"), backends)
+    for i := 0; i < 5; i++ {
+        if peer := strategy.Pick(requestWithSession("s1"), backends); peer != first {
+            t.Fatalf("Expected session pinned to %s, got %s", first.URL, peer.URL)
+        }
+    }
+
+    var remaining []*backend.Backend
+    for _, peer := range backends {
+        if peer != first {
+            remaining = append(remaining, peer)
+        }
+    }
+    moved := strategy.Pick(requestWithSession("s1"), remaining)
+    if moved == first || strategy.Pick(requestWithSession("s1"), backends) != moved {
+        t.Errorf("Expected the session re-pinned once its backend left, got %s", moved.URL)
+    }
+
+    for result, expected := range map[string]float64{"miss": 1, "hit": 6, "moved": 1} {
+        if count := registry.Counter("lb_sticky_lookups_total", "", "table", "web", "result", result).Value(); count != expected {
+            t.Errorf("Expected %v %s lookups, got %v", expected, result, count)
+        }
+    }
+}
+
+func TestTable_MaxEntries(t *testing.T) {
+    table, _ := New(Config{Name: "web", MaxEntries: 2, Peers: []string{"http://lb-2"}, Registry: metrics.NewRegistry()})
+    strategy := table.Strategy(nil)
+    backends := newBackends("a", "b", "c")
+
+    strategy.Pick(requestWithSession("s1"), backends)
+    strategy.Pick(requestWithSession("s2"), backends)
+    strategy.Pick(requestWithSession("s1"), backends)
+    strategy.Pick(requestWithSession("s3"), backends)
+
+    now := time.Now()
+    tests := []struct {
+        session string
+        pinned  bool
+    }{
+        {session: "s1", pinned: true},
+        {session: "s2", pinned: false},
+        {session: "s3", pinned: true},
+    }
+    for _, tt := range tests {
+        if _, ok := table.get(sessionID(tt.session), now); ok != tt.pinned {
+            t.Errorf("Expected %s pinned %v, got %v", tt.session, tt.pinned, ok)
+        }
+    }
+    if pending := table.takePending("http://lb-2", now); len(pending) != 2 {
+        t.Errorf("Expected only the kept pins queued for peers, got %d", len(pending))
+    }
+}
+
+func TestTable_RegisterHidesCookies(t *testing.T) {
+    table, _ := New(Config{Name: "web", Registry: metrics.NewRegistry()})
+    table.Strategy(nil).Pick(requestWithSession("secret-session"), newBackends("a"))
+
+    server := admin.NewServer(nil)
+    table.Register(server)
+    rr := httptest.NewRecorder()
+    server.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/sticky/web", nil))
+
+    if strings.Contains(rr.Body.String(), "secret-session") {
+        t.Errorf("Expected the session cookie kept out of the listing, got %s", rr.Body.String())
+    }
+    if !strings.Contains(rr.Body.String(), sessionID("secret-session")) {
+        t.Errorf("Expected the session listed by its hash, got %s", rr.Body.String())
+    }
+}
+
+func TestTable_Merge(t *testing.T) {
+    now := time.Now()
+    tests := []struct {
+        name     string
+        current  Entry
+        incoming Entry
+        expected string
+    }{
+        {name: "newer pin wins", current: Entry{Session: "s", Backend: "http://a", Updated: now.Add(-time.Minute)}, incoming: Entry{Session: "s", Backend: "http://b", Updated: now}, expected: "http://b"},
+        {name: "older pin ignored", current: Entry{Session: "s", Backend: "http://a", Updated: now}, incoming: Entry{Session: "s", Backend: "http://b", Updated: now.Add(-time.Minute)}, expected: "http://a"},
+        {name: "tie broken by backend", current: Entry{Session: "s", Backend: "http://b", Updated: now}, incoming: Entry{Session: "s", Backend: "http://a", Updated: now}, expected: "http://b"},
+        {name: "expired pin ignored", incoming: Entry{Session: "s", Backend: "http://b", Updated: now.Add(-time.Hour)}, expected: ""},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            table, _ := New(Config{Name: "web", Registry: metrics.NewRegistry()})
+            if tt.current.Session != "" {
+                table.pin(tt.current)
+            }
+            table.Merge([]Entry{tt.incoming})
+            entry, _ := table.get("s", time.Now())
+            if entry.Backend != tt.expected {
+                t.Errorf("Expected pin %q, got %q", tt.expected, entry.Backend)
+            }
+        })
+    }
+}
+
+func TestTable_Replication(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    // b is listed before its server exists, so give it a stable address.
+    serverB := httptest.NewUnstartedServer(nil)
+    serverA := httptest.NewUnstartedServer(nil)
+    tableA, _ := New(Config{Name: "web", Peers: []string{"http://" + serverB.Listener.Addr().String()}, SyncInterval: 10 * time.Millisecond, Registry: metrics.NewRegistry()})
+    tableB, _ := New(Config{Name: "web", Peers: []string{"http://" + serverA.Listener.Addr().String()}, SyncInterval: 10 * time.Millisecond, Registry: metrics.NewRegistry()})
+    for _, pair := range []struct {
+        server *httptest.Server
+        table  *Table
+    }{{serverA, tableA}, {serverB, tableB}} {
+        adminServer := admin.NewServer(nil)
+        pair.table.Register(adminServer)
+        pair.server.Config.Handler = adminServer
+        pair.server.Start()
+        defer pair.server.Close()
+    }
+
+    // Each instance has its own Backend values for the same URLs.
+    backendsA, backendsB := newBackends("a", "b", "c"), newBackends("a", "b", "c")
+    pinned := tableA.Strategy(nil).Pick(requestWithSession("s1"), backendsA)
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    go tableA.Run(ctx)
+    go tableB.Run(ctx)
+
+    deadline := time.Now().Add(2 * time.Second)
+    for len(tableB.Entries()) == 0 && time.Now().Before(deadline) {
+        time.Sleep(5 * time.Millisecond)
+    }
+    for i := 0; i < 3; i++ {
+        if peer := tableB.Strategy(nil).Pick(requestWithSession("s1"), backendsB); peer.URL.String() != pinned.URL.String() {
+            t.Fatalf("Expected the other instance to send the session to %s, got %s", pinned.URL, peer.URL)
+        }
+    }
+}
@@ -0,0 +1,283 @@
+package tap
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "io"
+    "net"
+    "net/http"
+    "slices"
+    "strconv"
+    "sync"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/balancer"
+)
+
+type ReplayOptions struct {
+    Pool        string  `json:"pool"`
+    Rate        float64 `json:"rate,omitempty"`
+    Concurrency int     `json:"concurrency,omitempty"`
+}
+
+type ReplayResult struct {
+    Pool       string         `json:"pool"`
+    Started    time.Time      `json:"started"`
+    Finished   time.Time      `json:"finished,omitempty"`
+    Running    bool           `json:"running"`
+    Total      int            `json:"total"`
+    Sent       int            `json:"sent"`
+    Skipped    int            `json:"skipped"`
+    Errors     int            `json:"errors"`
+    Mismatches int            `json:"status_mismatches"`
+    Statuses   map[string]int `json:"statuses"`
+}
+
+// Replay re-sends captured requests to handler, at most Rate requests per
+// second (unlimited when zero). Entries whose request body was truncated
+// or not recorded during capture are skipped rather than sent incomplete.
+func Replay(ctx context.Context, entries []Entry, handler http.Handler, options ReplayOptions) ReplayResult {
+    result := ReplayResult{
+        Pool:     options.Pool,
+        Started:  time.Now(),
+        Total:    len(entries),
+        Statuses: make(map[string]int),
+    }
+    replay(ctx, entries, handler, options, &result, &sync.Mutex{})
+    result.Finished = time.Now()
+    return result
+}
+
+// replay updates result under mux as requests complete, so a running replay
+// can be observed.
+func replay(ctx context.Context, entries []Entry, handler http.Handler, options ReplayOptions, result *ReplayResult, mux *sync.Mutex) {
+    if options.Concurrency <= 0 {
+        options.Concurrency = 1
+    }
+
+    jobs := make(chan Entry)
+    var wg sync.WaitGroup
+    for i := 0; i < options.Concurrency; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for entry := range jobs {
+                status := replayEntry(ctx, handler, entry)
+
+                mux.Lock()
+                result.Sent++
+                result.Statuses[strconv.Itoa(status)]++
+                if status >= http.StatusInternalServerError {
+                    result.Errors++
+                }
+                if status != entry.Status {
+                    result.Mismatches++
+                }
+                mux.Unlock()
+            }
+        }()
+    }
+
+    var tick <-chan time.Time
+    if options.Rate > 0 {
+        ticker := time.NewTicker(time.Duration(float64(time.Second) / options.Rate))
+        defer ticker.Stop()
+        tick = ticker.C
+    }
+
+dispatch:
+    for i, entry := range entries {
+        if entry.RequestBodyTruncated || entry.RequestBodyOmitted {
+            mux.Lock()
+            result.Skipped++
+            mux.Unlock()
+            continue
+        }
+        if tick != nil && i > 0 {
+            select {
+            case <-ctx.Done():
+                break dispatch
+            case <-tick:
+            }
+        }
+        select {
+        case <-ctx.Done():
+            break dispatch
+        case jobs <- entry:
+        }
+    }
+    close(jobs)
+    wg.Wait()
+}
+
+func replayEntry(ctx context.Context, handler http.Handler, entry Entry) int {
+    request, err := http.NewRequestWithContext(ctx, entry.Method, entry.URI, bytes.NewReader(entry.RequestBody))
+    if err != nil {
+        return http.StatusBadRequest
+    }
+    request.Header = entry.RequestHeader.Clone()
+    if request.Header == nil {
+        request.Header = make(http.Header)
+    }
+    for key, values := range request.Header {
+        if slices.Contains(values, redacted) {
+            request.Header.Del(key)
+        }
+    }
+    request.Header.Set("X-Replay", "true")
+    request.Host = entry.Host
+    request.RequestURI = entry.URI
+    request.ContentLength = int64(len(entry.RequestBody))
+    if entry.ClientIP != "" {
+        request.RemoteAddr = net.JoinHostPort(entry.ClientIP, "0")
+    }
+
+    writer := &discardWriter{header: make(http.Header)}
+    handler.ServeHTTP(writer, request)
+    if writer.status == 0 {
+        return http.StatusOK
+    }
+    return writer.status
+}
+
+type discardWriter struct {
+    header http.Header
+    status int
+}
+
+func (writer *discardWriter) Header() http.Header {
+    return writer.header
+}
+
+func (writer *discardWriter) WriteHeader(status int) {
+    if writer.status == 0 && status >= http.StatusOK {
+        writer.status = status
+    }
+}
+
+func (writer *discardWriter) Write(p []byte) (int, error) {
+    if writer.status == 0 {
+        writer.status = http.StatusOK
+    }
+    return len(p), nil
+}
+
+// Replayer runs one replay of the tap's current capture at a time against a
+// pool chosen by name from the router.
+type Replayer struct {
+    tap    *Tap
+    router *balancer.Router
+
+    mux    sync.Mutex
+    result *ReplayResult
+    cancel context.CancelFunc
+}
+
+var errReplayRunning = errors.New("a replay is already running")
+
+func NewReplayer(tap *Tap, router *balancer.Router) *Replayer {
+    return &Replayer{tap: tap, router: router}
+}
+
+func (replayer *Replayer) Start(options ReplayOptions) (*ReplayResult, error) {
+    pool, err := replayer.router.Lookup(options.Pool)
+    if err != nil {
+        return nil, err
+    }
+    capture := replayer.tap.Snapshot(time.Now())
+    if capture == nil || len(capture.Entries) == 0 {
+        return nil, errors.New("no captured requests to replay")
+    }
+
+    replayer.mux.Lock()
+    defer replayer.mux.Unlock()
+
+    if replayer.result != nil && replayer.result.Running {
+        return nil, errReplayRunning
+    }
+    ctx, cancel := context.WithCancel(context.Background())
+    replayer.cancel = cancel
+    result := &ReplayResult{
+        Pool:     options.Pool,
+        Started:  time.Now(),
+        Running:  true,
+        Total:    len(capture.Entries),
+        Statuses: make(map[string]int),
+    }
+    replayer.result = result
+
+    go func() {
+        defer cancel()
+        replay(ctx, capture.Entries, http.HandlerFunc(pool.LoadBalancerHandler), options, result, &replayer.mux)
+
+        replayer.mux.Lock()
+        result.Running = false
+        result.Finished = time.Now()
+        replayer.mux.Unlock()
+    }()
+    return replayer.statusLocked(), nil
+}
+
+func (replayer *Replayer) Stop() {
+    replayer.mux.Lock()
+    cancel := replayer.cancel
+    replayer.mux.Unlock()
+
+    if cancel != nil {
+        cancel()
+    }
+}
+
+func (replayer *Replayer) Status() *ReplayResult {
+    replayer.mux.Lock()
+    defer replayer.mux.Unlock()
+
+    return replayer.statusLocked()
+}
+
+func (replayer *Replayer) statusLocked() *ReplayResult {
+    if replayer.result == nil {
+        return nil
+    }
+    status := *replayer.result
+    status.Statuses = make(map[string]int, len(replayer.result.Statuses))
+    for code, count := range replayer.result.Statuses {
+        status.Statuses[code] = count
+    }
+    return &status
+}
+
+func (replayer *Replayer) Register(server *admin.Server) {
+    server.HandleFunc("POST /admin/tap/replay", func(writer http.ResponseWriter, request *http.Request) {
+        var options ReplayOptions
+        if err := json.NewDecoder(request.Body).Decode(&options); err != nil && err != io.EOF {
+            admin.WriteError(writer, http.StatusBadRequest, "invalid replay options")
+            return
+        }
+        result, err := replayer.Start(options)
+        if errors.Is(err, errReplayRunning) {
+            admin.WriteError(writer, http.StatusConflict, err.Error())
+            return
+        }
+        if err != nil {
+            admin.WriteError(writer, http.StatusBadRequest, err.Error())
+            return
+        }
+        admin.WriteJSON(writer, http.StatusAccepted, result)
+    })
+    server.HandleFunc("GET /admin/tap/replay", func(writer http.ResponseWriter, request *http.Request) {
+        result := replayer.Status()
+        if result == nil {
+            admin.WriteError(writer, http.StatusNotFound, "no replay has been started")
+            return
+        }
+        admin.WriteJSON(writer, http.StatusOK, result)
+    })
+    server.HandleFunc("DELETE /admin/tap/replay", func(writer http.ResponseWriter, request *http.Request) {
+        replayer.Stop()
+        writer.WriteHeader(http.StatusNoContent)
+    })
+}
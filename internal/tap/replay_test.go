@@ -0,0 +1,170 @@
+package tap
+
+import (
+    "context"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "net/http/httputil"
+    "net/url"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+)
+
+type receivedRequest struct {
+    method string
+    uri    string
+    host   string
+    body   string
+    replay string
+}
+
+func newRecordingPool(t *testing.T, status int) (*balancer.ServerPool, func() []receivedRequest) {
+    t.Helper()
+
+    var mux sync.Mutex
+    var received []receivedRequest
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        mux.Lock()
+        received = append(received, receivedRequest{
+            method: r.Method,
+            uri:    r.RequestURI,
+            host:   r.Host,
+            body:   string(body),
+            replay: r.Header.Get("X-Replay"),
+        })
+        mux.Unlock()
+        w.WriteHeader(status)
+    }))
+    t.Cleanup(server.Close)
+
+    serverURL, _ := url.Parse(server.URL)
+    proxy := httputil.NewSingleHostReverseProxy(serverURL)
+    director := proxy.Director
+    proxy.Director = func(r *http.Request) {
+        host := r.Host
+        director(r)
+        r.Host = host
+    }
+    pool := balancer.NewServerPool()
+    pool.AddBackend(&backend.Backend{URL: serverURL, Alive: true, ReverseProxy: proxy})
+
+    return pool, func() []receivedRequest {
+        mux.Lock()
+        defer mux.Unlock()
+        return append([]receivedRequest(nil), received...)
+    }
+}
+
+func TestReplay(t *testing.T) {
+    pool, received := newRecordingPool(t, http.StatusOK)
+
+    entries := []Entry{
+        {Method: "GET", URI: "/a?x=1", Host: "shop.example.com", Status: http.StatusOK},
+        {Method: "POST", URI: "/b", Host: "shop.example.com", RequestBody: []byte(`{"id":1}`), Status: http.StatusCreated},
+        {Method: "POST", URI: "/c", RequestBody: []byte("partial"), RequestBodyTruncated: true},
+        {Method: "PUT", URI: "/d", RequestBodyOmitted: true},
+    }
+
+    start := time.Now()
+    result := Replay(context.Background(), entries, http.HandlerFunc(pool.LoadBalancerHandler), ReplayOptions{Rate: 20})
+    elapsed := time.Since(start)
+
+    if result.Sent != 2 || result.Skipped != 2 || result.Mismatches != 1 || result.Statuses["200"] != 2 {
+        t.Errorf("unexpected result %+v", result)
+    }
+    if elapsed < 40*time.Millisecond {
+        t.Errorf("Expected replay to be paced at 20 rps, took %v", elapsed)
+    }
+
+    requests := received()
+    if len(requests) != 2 {
+        t.Fatalf("Expected 2 requests upstream, got %d", len(requests))
+    }
+    expected := []receivedRequest{
+        {method: "GET", uri: "/a?x=1", host: "shop.example.com", replay: "true"},
+        {method: "POST", uri: "/b", host: "shop.example.com", body: `{"id":1}`, replay: "true"},
+    }
+    for i := range expected {
+        if requests[i] != expected[i] {
+            t.Errorf("request %d = %+v, expected %+v", i, requests[i], expected[i])
+        }
+    }
+}
+
+func TestReplay_Cancelled(t *testing.T) {
+    pool, received := newRecordingPool(t, http.StatusOK)
+
+    entries := make([]Entry, 50)
+    for i := range entries {
+        entries[i] = Entry{Method: "GET", URI: "/", Status: http.StatusOK}
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    result := Replay(ctx, entries, http.HandlerFunc(pool.LoadBalancerHandler), ReplayOptions{Rate: 50})
+
+    if result.Sent >= len(entries) || len(received()) != result.Sent {
+        t.Errorf("Expected cancellation to stop the replay early, sent %d", result.Sent)
+    }
+}
+
+func TestReplayer_Register(t *testing.T) {
+    staging, received := newRecordingPool(t, http.StatusServiceUnavailable)
+    router := balancer.NewRouter("staging")
+    router.AddPool("staging", staging)
+
+    tap := New()
+    replayer := NewReplayer(tap, router)
+    server := admin.NewServer(nil)
+    replayer.Register(server)
+
+    post := func(body string) *httptest.ResponseRecorder {
+        rr := httptest.NewRecorder()
+        server.ServeHTTP(rr, httptest.NewRequest("POST", "/admin/tap/replay", strings.NewReader(body)))
+        return rr
+    }
+
+    if rr := post(`{"pool":"staging"}`); rr.Code != http.StatusBadRequest {
+        t.Errorf("Expected 400 with nothing captured, got %d", rr.Code)
+    }
+
+    tap.Start(Options{}, time.Now())
+    tap.Middleware(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/captured", nil))
+
+    if rr := post(`{"pool":"missing"}`); rr.Code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for unknown pool, got %d", rr.Code)
+    }
+    if rr := post(`{"pool":"staging"}`); rr.Code != http.StatusAccepted {
+        t.Fatalf("Expected 202, got %d: %s", rr.Code, rr.Body.String())
+    }
+
+    deadline := time.Now().Add(2 * time.Second)
+    for replayer.Status().Running {
+        if time.Now().After(deadline) {
+            t.Fatal("replay did not finish")
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+
+    result := replayer.Status()
+    if result.Sent != 1 || result.Errors != 1 || result.Mismatches != 1 {
+        t.Errorf("unexpected result %+v", result)
+    }
+    if requests := received(); len(requests) != 1 || requests[0].uri != "/captured" {
+        t.Errorf("unexpected upstream requests %+v", requests)
+    }
+
+    rr := httptest.NewRecorder()
+    server.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/tap/replay", nil))
+    if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"503":1`) {
+        t.Errorf("unexpected status response %d %s", rr.Code, rr.Body.String())
+    }
+}
@@ -0,0 +1,387 @@
+package tap
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/netip"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/clientip"
+)
+
+// redacted replaces the values of sensitive headers in captured entries.
+const redacted = "[redacted]"
+
+// sensitiveHeaders are always redacted, since a tap file holding them
+// would let anyone who reads it act as the client.
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+const (
+    defaultDuration   = time.Minute
+    maxDuration       = 10 * time.Minute
+    defaultMaxEntries = 1000
+    defaultBodyBytes  = 4096
+)
+
+// Filter selects the requests a capture records. Empty fields match
+// everything; all set fields must match.
+type Filter struct {
+    PathPrefix  string `json:"path_prefix,omitempty"`
+    ClientCIDR  string `json:"client_cidr,omitempty"`
+    Header      string `json:"header,omitempty"`
+    HeaderValue string `json:"header_value,omitempty"`
+
+    prefix netip.Prefix
+}
+
+// Options configure a capture. Authorization, Proxy-Authorization, Cookie
+// and Set-Cookie are always redacted from the recorded headers;
+// RedactHeaders names more, such as API key headers.
+type Options struct {
+    Filter        Filter   `json:"filter"`
+    Duration      string   `json:"duration,omitempty"`
+    MaxEntries    int      `json:"max_entries,omitempty"`
+    CaptureBody   bool     `json:"capture_body,omitempty"`
+    MaxBodyBytes  int      `json:"max_body_bytes,omitempty"`
+    RedactHeaders []string `json:"redact_headers,omitempty"`
+}
+
+type Entry struct {
+    Time                  time.Time   `json:"time"`
+    DurationMillis        float64     `json:"duration_ms"`
+    ClientIP              string      `json:"client_ip"`
+    Method                string      `json:"method"`
+    Host                  string      `json:"host"`
+    URI                   string      `json:"uri"`
+    Proto                 string      `json:"proto"`
+    Route                 string      `json:"route,omitempty"`
+    RequestHeader         http.Header `json:"request_header"`
+    RequestBody           []byte      `json:"request_body,omitempty"`
+    RequestBodyTruncated  bool        `json:"request_body_truncated,omitempty"`
+    RequestBodyOmitted    bool        `json:"request_body_omitted,omitempty"`
+    Status                int         `json:"status"`
+    ResponseHeader        http.Header `json:"response_header"`
+    ResponseBody          []byte      `json:"response_body,omitempty"`
+    ResponseBodyTruncated bool        `json:"response_body_truncated,omitempty"`
+}
+
+type Capture struct {
+    Filter      Filter    `json:"filter"`
+    Started     time.Time `json:"started"`
+    Expires     time.Time `json:"expires"`
+    MaxEntries  int       `json:"max_entries"`
+    CaptureBody bool      `json:"capture_body"`
+    Active      bool      `json:"active"`
+    Entries     []Entry   `json:"entries"`
+
+    maxBodyBytes int
+    redact       []string
+    stopped      bool
+}
+
+// Tap records request and response metadata for traffic matching an
+// admin-supplied filter, for a bounded duration and number of entries.
+type Tap struct {
+    mux     sync.Mutex
+    capture *Capture
+    armed   atomic.Bool
+}
+
+func New() *Tap {
+    return &Tap{}
+}
+
+func (tap *Tap) Start(options Options, now time.Time) (*Capture, error) {
+    duration := defaultDuration
+    if options.Duration != "" {
+        parsed, err := time.ParseDuration(options.Duration)
+        if err != nil || parsed <= 0 {
+            return nil, fmt.Errorf("invalid duration %q", options.Duration)
+        }
+        duration = parsed
+    }
+    if duration > maxDuration {
+        duration = maxDuration
+    }
+    if options.MaxEntries <= 0 {
+        options.MaxEntries = defaultMaxEntries
+    }
+    if options.MaxBodyBytes <= 0 {
+        options.MaxBodyBytes = defaultBodyBytes
+    }
+    if options.Filter.ClientCIDR != "" {
+        prefix, err := netip.ParsePrefix(options.Filter.ClientCIDR)
+        if err != nil {
+            return nil, fmt.Errorf("invalid client_cidr %q", options.Filter.ClientCIDR)
+        }
+        options.Filter.prefix = prefix.Masked()
+    }
+
+    capture := &Capture{
+        Filter:       options.Filter,
+        Started:      now,
+        Expires:      now.Add(duration),
+        MaxEntries:   options.MaxEntries,
+        CaptureBody:  options.CaptureBody,
+        Entries:      []Entry{},
+        maxBodyBytes: options.MaxBodyBytes,
+        redact:       append(append([]string(nil), sensitiveHeaders...), options.RedactHeaders...),
+    }
+
+    tap.mux.Lock()
+    tap.capture = capture
+    tap.armed.Store(true)
+    snapshot := tap.snapshotLocked(now)
+    tap.mux.Unlock()
+    return snapshot, nil
+}
+
+func (tap *Tap) Stop() {
+    tap.mux.Lock()
+    if tap.capture != nil {
+        tap.capture.stopped = true
+    }
+    tap.armed.Store(false)
+    tap.mux.Unlock()
+}
+
+// Snapshot returns a copy of the current or most recent capture, or nil if
+// none has been started.
+func (tap *Tap) Snapshot(now time.Time) *Capture {
+    tap.mux.Lock()
+    defer tap.mux.Unlock()
+
+    return tap.snapshotLocked(now)
+}
+
+func (tap *Tap) snapshotLocked(now time.Time) *Capture {
+    if tap.capture == nil {
+        return nil
+    }
+    snapshot := *tap.capture
+    snapshot.Entries = append([]Entry{}, tap.capture.Entries...)
+    snapshot.Active = tap.capture.activeAt(now)
+    return &snapshot
+}
+
+func (capture *Capture) activeAt(now time.Time) bool {
+    return !capture.stopped && now.Before(capture.Expires) && len(capture.Entries) < capture.MaxEntries
+}
+
+func (tap *Tap) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        if !tap.armed.Load() {
+            next.ServeHTTP(writer, request)
+            return
+        }
+
+        start := time.Now()
+        tap.mux.Lock()
+        capture := tap.capture
+        active := capture != nil && capture.activeAt(start)
+        if !active {
+            tap.armed.Store(false)
+        }
+        tap.mux.Unlock()
+        if !active || !capture.Filter.matches(request) {
+            next.ServeHTTP(writer, request)
+            return
+        }
+
+        entry := Entry{
+            Time:          start,
+            ClientIP:      clientip.Peer(request),
+            Method:        request.Method,
+            Host:          request.Host,
+            URI:           request.RequestURI,
+            Proto:         request.Proto,
+            RequestHeader: redact(request.Header, capture.redact),
+        }
+        if entry.URI == "" {
+            entry.URI = request.URL.RequestURI()
+        }
+
+        var requestBody *teeBody
+        if request.Body != nil && request.Body != http.NoBody {
+            if capture.CaptureBody {
+                requestBody = &teeBody{ReadCloser: request.Body, buffer: &limitedBuffer{limit: capture.maxBodyBytes}}
+                request.Body = requestBody
+            } else {
+                entry.RequestBodyOmitted = true
+            }
+        }
+        recorder := &recordingWriter{ResponseWriter: writer}
+        if capture.CaptureBody {
+            recorder.body = &limitedBuffer{limit: capture.maxBodyBytes}
+        }
+
+        next.ServeHTTP(recorder, request)
+
+        entry.DurationMillis = float64(time.Since(start).Microseconds()) / 1000
+        if route := balancer.RouteFromContext(request.Context()); route != nil {
+            entry.Route = route.Name
+        }
+        entry.Status = recorder.status
+        if entry.Status == 0 {
+            entry.Status = http.StatusOK
+        }
+        entry.ResponseHeader = redact(writer.Header(), capture.redact)
+        if requestBody != nil {
+            // A body the backend stopped reading early was only partly seen.
+            entry.RequestBody, entry.RequestBodyTruncated = requestBody.buffer.Bytes(), requestBody.buffer.truncated || !requestBody.done
+        }
+        if recorder.body != nil {
+            entry.ResponseBody, entry.ResponseBodyTruncated = recorder.body.Bytes(), recorder.body.truncated
+        }
+
+        tap.record(capture, entry)
+    })
+}
+
+func (tap *Tap) record(capture *Capture, entry Entry) {
+    tap.mux.Lock()
+    defer tap.mux.Unlock()
+
+    if len(capture.Entries) < capture.MaxEntries {
+        capture.Entries = append(capture.Entries, entry)
+    }
+}
+
+func (tap *Tap) Register(server *admin.Server) {
+    server.HandleFunc("POST /admin/tap", func(writer http.ResponseWriter, request *http.Request) {
+        var options Options
+        if err := json.NewDecoder(request.Body).Decode(&options); err != nil && err != io.EOF {
+            admin.WriteError(writer, http.StatusBadRequest, "invalid capture options")
+            return
+        }
+        capture, err := tap.Start(options, time.Now())
+        if err != nil {
+            admin.WriteError(writer, http.StatusBadRequest, err.Error())
+            return
+        }
+        admin.WriteJSON(writer, http.StatusCreated, capture)
+    })
+    server.HandleFunc("GET /admin/tap", func(writer http.ResponseWriter, request *http.Request) {
+        capture := tap.Snapshot(time.Now())
+        if capture == nil {
+            admin.WriteError(writer, http.StatusNotFound, "no capture has been started")
+            return
+        }
+        admin.WriteJSON(writer, http.StatusOK, capture)
+    })
+    server.HandleFunc("DELETE /admin/tap", func(writer http.ResponseWriter, request *http.Request) {
+        tap.Stop()
+        writer.WriteHeader(http.StatusNoContent)
+    })
+}
+
+func (filter *Filter) matches(request *http.Request) bool {
+    if !strings.HasPrefix(request.URL.Path, filter.PathPrefix) {
+        return false
+    }
+    if filter.prefix.IsValid() {
+        addr, err := netip.ParseAddr(clientip.Peer(request))
+        if err != nil || !filter.prefix.Contains(addr.Unmap()) {
+            return false
+        }
+    }
+    if filter.Header != "" {
+        values, ok := request.Header[http.CanonicalHeaderKey(filter.Header)]
+        if !ok {
+            return false
+        }
+        if filter.HeaderValue != "" && !contains(values, filter.HeaderValue) {
+            return false
+        }
+    }
+    return true
+}
+
+func contains(values []string, value string) bool {
+    for _, candidate := range values {
+        if candidate == value {
+            return true
+        }
+    }
+    return false
+}
+
+type limitedBuffer struct {
+    bytes.Buffer
+    limit     int
+    truncated bool
+}
+
+func (buffer *limitedBuffer) Write(p []byte) (int, error) {
+    if room := buffer.limit - buffer.Len(); room < len(p) {
+        buffer.truncated = true
+        if room > 0 {
+            buffer.Buffer.Write(p[:room])
+        }
+        return len(p), nil
+    }
+    return buffer.Buffer.Write(p)
+}
+
+type teeBody struct {
+    io.ReadCloser
+    buffer *limitedBuffer
+    done   bool
+}
+
+func (body *teeBody) Read(p []byte) (int, error) {
+    n, err := body.ReadCloser.Read(p)
+    body.buffer.Write(p[:n])
+    if err == io.EOF {
+        body.done = true
+    }
+    return n, err
+}
+
+type recordingWriter struct {
+    http.ResponseWriter
+    status int
+    body   *limitedBuffer
+}
+
+// redact returns a copy of header with the values of names replaced.
+func redact(header http.Header, names []string) http.Header {
+    header = header.Clone()
+    for _, name := range names {
+        if values, ok := header[http.CanonicalHeaderKey(name)]; ok {
+            for i := range values {
+                values[i] = redacted
+            }
+        }
+    }
+    return header
+}
+
+func (writer *recordingWriter) WriteHeader(status int) {
+    if writer.status == 0 && status >= http.StatusOK {
+        writer.status = status
+    }
+    writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *recordingWriter) Write(p []byte) (int, error) {
+    if writer.status == 0 {
+        writer.status = http.StatusOK
+    }
+    if writer.body != nil {
+        writer.body.Write(p)
+    }
+    return writer.ResponseWriter.Write(p)
+}
+
+func (writer *recordingWriter) Unwrap() http.ResponseWriter {
+    return writer.ResponseWriter
+}
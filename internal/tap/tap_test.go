@@ -0,0 +1,236 @@
+package tap
+
+import (
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "load-balancer/internal/admin"
+)
+
+func newUpstream() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        w.Header().Set("X-Upstream", "yes")
+        w.WriteHeader(http.StatusAccepted)
+        w.Write([]byte("echo:" + string(body)))
+    })
+}
+
+func TestFilter_Matches(t *testing.T) {
+    tests := []struct {
+        name     string
+        options  Options
+        path     string
+        remote   string
+        header   string
+        expected bool
+    }{
+        {name: "empty filter", path: "/x", remote: "1.2.3.4:5", expected: true},
+        {name: "path prefix", options: Options{Filter: Filter{PathPrefix: "/api"}}, path: "/api/users", remote: "1.2.3.4:5", expected: true},
+        {name: "path prefix mismatch", options: Options{Filter: Filter{PathPrefix: "/api"}}, path: "/static", remote: "1.2.3.4:5", expected: false},
+        {name: "client cidr", options: Options{Filter: Filter{ClientCIDR: "10.0.0.0/8"}}, path: "/", remote: "10.1.2.3:5", expected: true},
+        {name: "client cidr mismatch", options: Options{Filter: Filter{ClientCIDR: "10.0.0.0/8"}}, path: "/", remote: "192.168.1.1:5", expected: false},
+        {name: "header present", options: Options{Filter: Filter{Header: "x-debug"}}, path: "/", remote: "1.2.3.4:5", header: "1", expected: true},
+        {name: "header value mismatch", options: Options{Filter: Filter{Header: "X-Debug", HeaderValue: "2"}}, path: "/", remote: "1.2.3.4:5", header: "1", expected: false},
+        {name: "header missing", options: Options{Filter: Filter{Header: "X-Debug"}}, path: "/", remote: "1.2.3.4:5", expected: false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            tap := New()
+            capture, err := tap.Start(tt.options, time.Now())
+            if err != nil {
+                t.Fatalf("Start() error: %v", err)
+            }
+
+            req := httptest.NewRequest("GET", tt.path, nil)
+            req.RemoteAddr = tt.remote
+            if tt.header != "" {
+                req.Header.Set("X-Debug", tt.header)
+            }
+            filter := tap.capture.Filter
+            if got := filter.matches(req); got != tt.expected {
+                t.Errorf("matches() = %v, expected %v (filter %+v)", got, tt.expected, capture.Filter)
+            }
+        })
+    }
+}
+
+func TestTap_Middleware(t *testing.T) {
+    tap := New()
+    handler := tap.Middleware(newUpstream())
+
+    send := func(path, body string) *httptest.ResponseRecorder {
+        rr := httptest.NewRecorder()
+        handler.ServeHTTP(rr, httptest.NewRequest("POST", path, strings.NewReader(body)))
+        return rr
+    }
+
+    send("/api/before", "ignored")
+    if tap.Snapshot(time.Now()) != nil {
+        t.Fatal("Expected no capture before Start")
+    }
+
+    if _, err := tap.Start(Options{
+        Filter:       Filter{PathPrefix: "/api"},
+        MaxEntries:   2,
+        CaptureBody:  true,
+        MaxBodyBytes: 8,
+    }, time.Now()); err != nil {
+        t.Fatalf("Start() error: %v", err)
+    }
+
+    rr := send("/api/one", "hello")
+    if rr.Code != http.StatusAccepted || rr.Body.String() != "echo:hello" {
+        t.Fatalf("capture altered response: %d %q", rr.Code, rr.Body.String())
+    }
+    send("/static/skip", "x")
+    send("/api/two", "a much longer body")
+    send("/api/three", "over the entry limit")
+
+    capture := tap.Snapshot(time.Now())
+    if capture.Active {
+        t.Error("Expected capture to be inactive after reaching MaxEntries")
+    }
+    if len(capture.Entries) != 2 {
+        t.Fatalf("Expected 2 entries, got %d", len(capture.Entries))
+    }
+
+    first := capture.Entries[0]
+    if first.URI != "/api/one" || first.Method != "POST" || first.Status != http.StatusAccepted {
+        t.Errorf("unexpected entry %+v", first)
+    }
+    if string(first.RequestBody) != "hello" || first.RequestBodyTruncated {
+        t.Errorf("Expected request body %q, got %q (truncated %v)", "hello", first.RequestBody, first.RequestBodyTruncated)
+    }
+    if string(first.ResponseBody) != "echo:hel" || !first.ResponseBodyTruncated {
+        t.Errorf("Expected truncated response body, got %q (truncated %v)", first.ResponseBody, first.ResponseBodyTruncated)
+    }
+    if first.ResponseHeader.Get("X-Upstream") != "yes" {
+        t.Error("Expected response headers to be captured")
+    }
+
+    second := capture.Entries[1]
+    if string(second.RequestBody) != "a much l" || !second.RequestBodyTruncated {
+        t.Errorf("Expected truncated request body, got %q", second.RequestBody)
+    }
+}
+
+func TestTap_MarksOmittedBodies(t *testing.T) {
+    tap := New()
+    handler := tap.Middleware(newUpstream())
+    tap.Start(Options{}, time.Now())
+
+    handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/form", strings.NewReader("a=1")))
+    handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/page", nil))
+
+    capture := tap.Snapshot(time.Now())
+    if len(capture.Entries) != 2 {
+        t.Fatalf("Expected 2 entries, got %d", len(capture.Entries))
+    }
+    if !capture.Entries[0].RequestBodyOmitted || capture.Entries[1].RequestBodyOmitted {
+        t.Errorf("Expected only the POST's body marked omitted, got %v and %v", capture.Entries[0].RequestBodyOmitted, capture.Entries[1].RequestBodyOmitted)
+    }
+}
+
+func TestTap_RedactsSensitiveHeaders(t *testing.T) {
+    tap := New()
+    handler := tap.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Set-Cookie", "session=abc")
+    }))
+    tap.Start(Options{RedactHeaders: []string{"x-api-key"}}, time.Now())
+
+    req := httptest.NewRequest("GET", "/", nil)
+    req.Header.Set("Authorization", "Bearer secret")
+    req.Header.Set("Cookie", "session=abc")
+    req.Header.Set("X-Api-Key", "k1")
+    req.Header.Set("Accept", "text/plain")
+    rr := httptest.NewRecorder()
+    handler.ServeHTTP(rr, req)
+
+    entry := tap.Snapshot(time.Now()).Entries[0]
+    for _, name := range []string{"Authorization", "Cookie", "X-Api-Key"} {
+        if got := entry.RequestHeader.Get(name); got != redacted {
+            t.Errorf("Expected request header %s redacted, got %q", name, got)
+        }
+    }
+    if got := entry.RequestHeader.Get("Accept"); got != "text/plain" {
+        t.Errorf("Expected Accept kept, got %q", got)
+    }
+    if got := entry.ResponseHeader.Get("Set-Cookie"); got != redacted {
+        t.Errorf("Expected Set-Cookie redacted, got %q", got)
+    }
+    if got := rr.Header().Get("Set-Cookie"); got != "session=abc" {
+        t.Errorf("Expected the client to still get its cookie, got %q", got)
+    }
+    if got := req.Header.Get("Authorization"); got != "Bearer secret" {
+        t.Errorf("Expected the request's own headers untouched, got %q", got)
+    }
+}
+
+func TestTap_Expires(t *testing.T) {
+    tap := New()
+    handler := tap.Middleware(newUpstream())
+
+    start := time.Now().Add(-2 * time.Second)
+    tap.Start(Options{Duration: "1s"}, start)
+
+    handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+    capture := tap.Snapshot(time.Now())
+    if capture.Active || len(capture.Entries) != 0 {
+        t.Errorf("Expected expired capture with no entries, got active=%v entries=%d", capture.Active, len(capture.Entries))
+    }
+}
+
+func TestTap_Register(t *testing.T) {
+    tap := New()
+    server := admin.NewServer(nil)
+    tap.Register(server)
+    handler := tap.Middleware(newUpstream())
+
+    tests := []struct {
+        name     string
+        method   string
+        body     string
+        expected int
+    }{
+        {name: "no capture yet", method: "GET", expected: http.StatusNotFound},
+        {name: "invalid duration", method: "POST", body: `{"duration":"soon"}`, expected: http.StatusBadRequest},
+        {name: "invalid cidr", method: "POST", body: `{"filter":{"client_cidr":"nope"}}`, expected: http.StatusBadRequest},
+        {name: "start", method: "POST", body: `{"filter":{"path_prefix":"/"},"duration":"30s"}`, expected: http.StatusCreated},
+        {name: "read", method: "GET", expected: http.StatusOK},
+        {name: "stop", method: "DELETE", expected: http.StatusNoContent},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if tt.name == "read" {
+                handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/traced", nil))
+            }
+
+            rr := httptest.NewRecorder()
+            server.ServeHTTP(rr, httptest.NewRequest(tt.method, "/admin/tap", strings.NewReader(tt.body)))
+            if rr.Code != tt.expected {
+                t.Fatalf("Expected status %d, got %d: %s", tt.expected, rr.Code, rr.Body.String())
+            }
+
+            if tt.name == "read" {
+                var capture Capture
+                json.NewDecoder(rr.Body).Decode(&capture)
+                if !capture.Active || len(capture.Entries) != 1 || capture.Entries[0].URI != "/traced" {
+                    t.Errorf("unexpected capture %+v", capture)
+                }
+            }
+        })
+    }
+
+    if tap.Snapshot(time.Now()).Active {
+        t.Error("Expected capture to be stopped")
+    }
+}
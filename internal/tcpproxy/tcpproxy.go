@@ -0,0 +1,319 @@
+package tcpproxy
+
+import (
+    "errors"
+    "log"
+    "net"
+    "net/http"
+    "sort"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+)
+
+// Limits polices long-lived connections. ConnectionBytes caps the bytes
+// one connection may carry in both directions and ConnectionDuration how
+// long it may stay open. ClientBytes caps the bytes all of a client's
+// connections may carry per ClientWindow (default a minute); a client over
+// it has its connections closed and new ones refused until the window ends.
+// Zero means unlimited.
+type Limits struct {
+    ConnectionBytes    int64
+    ConnectionDuration time.Duration
+    ClientBytes        int64
+    ClientWindow       time.Duration
+}
+
+// Config describes a TCP (L4) listener proxying connections to Pool. The
+// pool's backend URLs only need a host and port, e.g. tcp://db-1:3306.
+type Config struct {
+    Name        string
+    Pool        *balancer.ServerPool
+    DialTimeout time.Duration
+    Limits      Limits
+    Registry    *metrics.Registry
+}
+
+// ConnectionStatus describes an open proxied connection. BytesIn counts
+// bytes sent by the client, BytesOut bytes sent back to it.
+type ConnectionStatus struct {
+    Client   string    `json:"client"`
+    Backend  string    `json:"backend"`
+    Opened   time.Time `json:"opened"`
+    BytesIn  int64     `json:"bytes_in"`
+    BytesOut int64     `json:"bytes_out"`
+}
+
+type connection struct {
+    client   string
+    backend  string
+    opened   time.Time
+    bytesIn  atomic.Int64
+    bytesOut atomic.Int64
+    close    func(reason string)
+}
+
+type clientUsage struct {
+    bytes  int64
+    window time.Time
+    open   int
+}
+
+type Proxy struct {
+    config Config
+    open   *metrics.Gauge
+
+    mux         sync.Mutex
+    connections map[*connection]struct{}
+    clients     map[string]*clientUsage
+    pruned      time.Time
+}
+
+func New(config Config) *Proxy {
+    if config.DialTimeout <= 0 {
+        config.DialTimeout = 5 * time.Second
+    }
+    if config.Limits.ClientWindow <= 0 {
+        config.Limits.ClientWindow = time.Minute
+    }
+    if config.Registry == nil {
+        config.Registry = metrics.Default
+    }
+    return &Proxy{
+        config:      config,
+        open:        config.Registry.Gauge("lb_tcp_connections_open", "Proxied TCP connections currently open.", "pool", config.Name),
+        connections: make(map[*connection]struct{}),
+        clients:     make(map[string]*clientUsage),
+    }
+}
+
+// Serve proxies every connection accepted from listener until it is closed.
+func (proxy *Proxy) Serve(listener net.Listener) error {
+    for {
+        conn, err := listener.Accept()
+        if err != nil {
+            if errors.Is(err, net.ErrClosed) {
+                return nil
+            }
+            return err
+        }
+        go proxy.Handle(conn)
+    }
+}
+
+// Handle proxies client to a backend picked from the pool and returns once
+// both directions are finished.
+func (proxy *Proxy) Handle(client net.Conn) {
+    defer client.Close()
+
+    address := clientIP(client.RemoteAddr())
+    if !proxy.admit(address, time.Now()) {
+        proxy.exceeded("client_bytes")
+        log.Printf("%s tcp connection refused [client byte limit]\n", address)
+        return
+    }
+    defer proxy.release(address)
+
+    peer, err := proxy.config.Pool.Pick(nil)
+    if err != nil {
+        log.Printf("%s tcp connection refused: %v\n", address, err)
+        return
+    }
+    upstream, err := net.DialTimeout("tcp", peer.URL.Host, proxy.config.DialTimeout)
+    if err != nil {
+        log.Printf("%s tcp connection to %s failed: %v\n", address, peer.URL, err)
+        return
+    }
+    upstream = peer.TrackConn(upstream)
+    defer upstream.Close()
+
+    conn := &connection{client: address, backend: peer.URL.String(), opened: time.Now()}
+    var closeOnce sync.Once
+    conn.close = func(reason string) {
+        closeOnce.Do(func() {
+            proxy.exceeded(reason)
+            log.Printf("%s tcp connection to %s closed after %s [%s limit]\n", address, conn.backend, time.Since(conn.opened).Round(time.Millisecond), reason)
+            client.Close()
+            upstream.Close()
+        })
+    }
+    proxy.track(conn)
+    defer proxy.untrack(conn)
+
+    if limit := proxy.config.Limits.ConnectionDuration; limit > 0 {
+        timer := time.AfterFunc(limit, func() { conn.close("connection_duration") })
+        defer timer.Stop()
+    }
+
+    labels := []string{"pool", proxy.config.Name, "backend", conn.backend}
+    proxy.config.Registry.Counter("lb_tcp_connections_total", "TCP connections proxied to the backend.", labels...).Inc()
+    sent := proxy.config.Registry.Counter("lb_tcp_bytes_total", "Bytes proxied over TCP connections.", append(labels, "direction", "in")...)
+    received := proxy.config.Registry.Counter("lb_tcp_bytes_total", "Bytes proxied over TCP connections.", append(labels, "direction", "out")...)
+
+    var wg sync.WaitGroup
+    wg.Add(2)
+    go func() {
+        defer wg.Done()
+        proxy.copy(conn, upstream, client, &conn.bytesIn, sent)
+    }()
+    go func() {
+        defer wg.Done()
+        proxy.copy(conn, client, upstream, &conn.bytesOut, received)
+    }()
+    wg.Wait()
+}
+
+// copy moves bytes from src to dst, charging them to the connection and its
+// client first, so a chunk that would break a limit is never forwarded.
+// When src finishes, dst is half-closed so the far end sees end of stream.
+func (proxy *Proxy) copy(conn *connection, dst, src net.Conn, count *atomic.Int64, counter *metrics.Counter) {
+    buf := make([]byte, 32*1024)
+    for {
+        n, err := src.Read(buf)
+        if n > 0 {
+            count.Add(int64(n))
+            total := conn.bytesIn.Load() + conn.bytesOut.Load()
+            if limit := proxy.config.Limits.ConnectionBytes; limit > 0 && total > limit {
+                conn.close("connection_bytes")
+                return
+            }
+            if !proxy.charge(conn.client, int64(n), time.Now()) {
+                conn.close("client_bytes")
+                return
+            }
+            counter.Add(float64(n))
+            if _, err := dst.Write(buf[:n]); err != nil {
+                return
+            }
+        }
+        if err != nil {
+            if closer, ok := dst.(interface{ CloseWrite() error }); ok {
+                closer.CloseWrite()
+            }
+            return
+        }
+    }
+}
+
+func (proxy *Proxy) exceeded(limit string) {
+    proxy.config.Registry.Counter("lb_tcp_limit_exceeded_total", "TCP connections closed or refused for exceeding a limit.", "pool", proxy.config.Name, "limit", limit).Inc()
+}
+
+// admit reports whether client is within its byte budget and counts the
+// connection as open.
+func (proxy *Proxy) admit(client string, now time.Time) bool {
+    proxy.mux.Lock()
+    defer proxy.mux.Unlock()
+
+    proxy.pruneLocked(now)
+    usage := proxy.usageLocked(client, now)
+    if limit := proxy.config.Limits.ClientBytes; limit > 0 && usage.bytes >= limit {
+        return false
+    }
+    usage.open++
+    return true
+}
+
+func (proxy *Proxy) release(client string) {
+    proxy.mux.Lock()
+    defer proxy.mux.Unlock()
+
+    if usage, ok := proxy.clients[client]; ok {
+        usage.open--
+        if usage.open <= 0 && proxy.config.Limits.ClientBytes <= 0 {
+            delete(proxy.clients, client)
+        }
+    }
+}
+
+// charge adds n bytes to client's usage, reporting whether it is still
+// within its budget.
+func (proxy *Proxy) charge(client string, n int64, now time.Time) bool {
+    limit := proxy.config.Limits.ClientBytes
+    if limit <= 0 {
+        return true
+    }
+    proxy.mux.Lock()
+    defer proxy.mux.Unlock()
+
+    usage := proxy.usageLocked(client, now)
+    usage.bytes += n
+    return usage.bytes <= limit
+}
+
+func (proxy *Proxy) usageLocked(client string, now time.Time) *clientUsage {
+    usage, ok := proxy.clients[client]
+    if !ok {
+        usage = &clientUsage{window: now}
+        proxy.clients[client] = usage
+    }
+    if now.Sub(usage.window) >= proxy.config.Limits.ClientWindow {
+        usage.bytes, usage.window = 0, now
+    }
+    return usage
+}
+
+// pruneLocked forgets, at most once per window, the clients with no open
+// connections whose window has ended.
+func (proxy *Proxy) pruneLocked(now time.Time) {
+    if now.Sub(proxy.pruned) < proxy.config.Limits.ClientWindow {
+        return
+    }
+    proxy.pruned = now
+    for client, usage := range proxy.clients {
+        if usage.open <= 0 && now.Sub(usage.window) >= proxy.config.Limits.ClientWindow {
+            delete(proxy.clients, client)
+        }
+    }
+}
+
+func (proxy *Proxy) track(conn *connection) {
+    proxy.mux.Lock()
+    proxy.connections[conn] = struct{}{}
+    proxy.mux.Unlock()
+    proxy.open.Add(1)
+}
+
+func (proxy *Proxy) untrack(conn *connection) {
+    proxy.mux.Lock()
+    delete(proxy.connections, conn)
+    proxy.mux.Unlock()
+    proxy.open.Add(-1)
+}
+
+// Connections returns the open connections, oldest first.
+func (proxy *Proxy) Connections() []ConnectionStatus {
+    proxy.mux.Lock()
+    statuses := make([]ConnectionStatus, 0, len(proxy.connections))
+    for conn := range proxy.connections {
+        statuses = append(statuses, ConnectionStatus{
+            Client:   conn.client,
+            Backend:  conn.backend,
+            Opened:   conn.opened,
+            BytesIn:  conn.bytesIn.Load(),
+            BytesOut: conn.bytesOut.Load(),
+        })
+    }
+    proxy.mux.Unlock()
+
+    sort.Slice(statuses, func(i, j int) bool { return statuses[i].Opened.Before(statuses[j].Opened) })
+    return statuses
+}
+
+func (proxy *Proxy) Register(server *admin.Server) {
+    server.HandleFunc("GET /admin/tcp/"+proxy.config.Name+"/connections", func(writer http.ResponseWriter, request *http.Request) {
+        admin.WriteJSON(writer, http.StatusOK, proxy.Connections())
+    })
+}
+
+func clientIP(address net.Addr) string {
+    host, _, err := net.SplitHostPort(address.String())
+    if err != nil {
+        return address.String()
+    }
+    return host
+}
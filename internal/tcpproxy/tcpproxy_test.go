@@ -0,0 +1,167 @@
+package tcpproxy
+
+import (
+    "io"
+    "log"
+    "net"
+    "net/http/httputil"
+    "net/url"
+    "os"
+    "testing"
+    "time"
+
+    "load-balancer/internal/backend"
+    "load-balancer/internal/balancer"
+    "load-balancer/internal/metrics"
+)
+
+// newEchoPool returns a pool with one backend echoing whatever it receives.
+func newEchoPool(t *testing.T) (*balancer.ServerPool, *backend.Backend) {
+    t.Helper()
+
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("listen: %v", err)
+    }
+    t.Cleanup(func() { listener.Close() })
+    go func() {
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            go func() {
+                defer conn.Close()
+                io.Copy(conn, conn)
+            }()
+        }
+    }()
+
+    backendURL, _ := url.Parse("tcp://" + listener.Addr().String())
+    peer := &backend.Backend{URL: backendURL, Alive: true, ReverseProxy: httputil.NewSingleHostReverseProxy(backendURL)}
+    pool := balancer.NewServerPool()
+    pool.AddBackend(peer)
+    return pool, peer
+}
+
+func startProxy(t *testing.T, proxy *Proxy) string {
+    t.Helper()
+
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("listen: %v", err)
+    }
+    t.Cleanup(func() { listener.Close() })
+    go proxy.Serve(listener)
+    return listener.Addr().String()
+}
+
+// exchange writes size bytes and reads back as many as arrive, reporting
+// how many bytes made the round trip before the connection closed.
+func exchange(t *testing.T, address string, size int) int {
+    t.Helper()
+
+    conn, err := net.Dial("tcp", address)
+    if err != nil {
+        t.Fatalf("dial: %v", err)
+    }
+    defer conn.Close()
+    conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+    go conn.Write(make([]byte, size))
+    received, _ := io.ReadFull(conn, make([]byte, size))
+    return received
+}
+
+func TestProxy_Accounting(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    pool, peer := newEchoPool(t)
+    registry := metrics.NewRegistry()
+    proxy := New(Config{Name: "db", Pool: pool, Registry: registry})
+    address := startProxy(t, proxy)
+
+    conn, err := net.Dial("tcp", address)
+    if err != nil {
+        t.Fatalf("dial: %v", err)
+    }
+    conn.Write([]byte("hello"))
+    io.ReadFull(conn, make([]byte, 5))
+
+    connections := proxy.Connections()
+    if len(connections) != 1 || connections[0].BytesIn != 5 || connections[0].BytesOut != 5 || connections[0].Backend != peer.URL.String() {
+        t.Fatalf("Expected one open connection with 5 bytes each way, got %+v", connections)
+    }
+    if inFlight := peer.Stats().InFlight; inFlight != 1 {
+        t.Errorf("Expected 1 connection in flight on the backend, got %d", inFlight)
+    }
+    conn.Close()
+
+    deadline := time.Now().Add(time.Second)
+    for (len(proxy.Connections()) > 0 || peer.Stats().InFlight > 0) && time.Now().Before(deadline) {
+        time.Sleep(5 * time.Millisecond)
+    }
+    stats := peer.Stats()
+    if stats.InFlight != 0 || stats.Requests != 1 || stats.BytesIn != 5 || stats.BytesOut != 5 {
+        t.Errorf("Expected the closed connection in the backend stats, got %+v", stats)
+    }
+    for _, direction := range []string{"in", "out"} {
+        if bytes := registry.Counter("lb_tcp_bytes_total", "", "pool", "db", "backend", peer.URL.String(), "direction", direction).Value(); bytes != 5 {
+            t.Errorf("Expected 5 bytes %s, got %v", direction, bytes)
+        }
+    }
+}
+
+func TestProxy_Limits(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    tests := []struct {
+        name            string
+        limits          Limits
+        size            int
+        firstComplete   bool
+        secondComplete  bool
+        expectedLimit   string
+        expectedExceeds float64
+    }{
+        {name: "unlimited", size: 64 * 1024, firstComplete: true, secondComplete: true},
+        {name: "connection bytes", limits: Limits{ConnectionBytes: 4096}, size: 64 * 1024, expectedLimit: "connection_bytes", expectedExceeds: 2},
+        {name: "connection duration", limits: Limits{ConnectionDuration: 50 * time.Millisecond}, size: 0, expectedLimit: "connection_duration", expectedExceeds: 2},
+        {name: "client bytes", limits: Limits{ClientBytes: 20 * 1024}, size: 8 * 1024, firstComplete: true, expectedLimit: "client_bytes", expectedExceeds: 1},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pool, _ := newEchoPool(t)
+            registry := metrics.NewRegistry()
+            address := startProxy(t, New(Config{Name: "db", Pool: pool, Limits: tt.limits, Registry: registry}))
+
+            if tt.size == 0 {
+                for i := 0; i < 2; i++ {
+                    conn, _ := net.Dial("tcp", address)
+                    conn.SetDeadline(time.Now().Add(2 * time.Second))
+                    if _, err := conn.Read(make([]byte, 1)); err == nil {
+                        t.Errorf("Expected the connection to be closed")
+                    }
+                    conn.Close()
+                }
+            } else {
+                if complete := exchange(t, address, tt.size) == tt.size; complete != tt.firstComplete {
+                    t.Errorf("Expected first exchange complete %v, got %v", tt.firstComplete, complete)
+                }
+                if complete := exchange(t, address, tt.size) == tt.size; complete != tt.secondComplete {
+                    t.Errorf("Expected second exchange complete %v, got %v", tt.secondComplete, complete)
+                }
+            }
+
+            if tt.expectedLimit == "" {
+                return
+            }
+            if exceeded := registry.Counter("lb_tcp_limit_exceeded_total", "", "pool", "db", "limit", tt.expectedLimit).Value(); exceeded < tt.expectedExceeds {
+                t.Errorf("Expected at least %v %s limit hits, got %v", tt.expectedExceeds, tt.expectedLimit, exceeded)
+            }
+        })
+    }
+}
@@ -0,0 +1,93 @@
+package tenant
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+)
+
+type Identifier func(request *http.Request) string
+
+func HeaderIdentifier(name string) Identifier {
+    return func(request *http.Request) string {
+        return request.Header.Get(name)
+    }
+}
+
+func APIKeyIdentifier(header string, keys map[string]string) Identifier {
+    return func(request *http.Request) string {
+        return keys[request.Header.Get(header)]
+    }
+}
+
+// JWTClaimIdentifier names the tenant after claim in the request's bearer
+// token. Only HS256 tokens signed with secret, and inside their exp and nbf
+// times, are trusted; without a secret no token is.
+func JWTClaimIdentifier(claim string, secret []byte) Identifier {
+    return func(request *http.Request) string {
+        token, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+        if !ok {
+            return ""
+        }
+        claims, err := parseJWT(token, secret, time.Now())
+        if err != nil {
+            return ""
+        }
+        value, _ := claims[claim].(string)
+        return value
+    }
+}
+
+func parseJWT(token string, secret []byte, now time.Time) (map[string]any, error) {
+    if len(secret) == 0 {
+        return nil, fmt.Errorf("no secret to verify the token with")
+    }
+    parts := strings.Split(token, ".")
+    if len(parts) != 3 {
+        return nil, fmt.Errorf("malformed token")
+    }
+
+    var header struct {
+        Alg string `json:"alg"`
+    }
+    if err := decodeSegment(parts[0], &header); err != nil {
+        return nil, err
+    }
+    if header.Alg != "HS256" {
+        return nil, fmt.Errorf("unsupported algorithm %q", header.Alg)
+    }
+    signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+    if err != nil {
+        return nil, err
+    }
+    mac := hmac.New(sha256.New, secret)
+    mac.Write([]byte(parts[0] + "." + parts[1]))
+    if !hmac.Equal(signature, mac.Sum(nil)) {
+        return nil, fmt.Errorf("invalid signature")
+    }
+
+    var claims map[string]any
+    if err := decodeSegment(parts[1], &claims); err != nil {
+        return nil, err
+    }
+    if exp, ok := claims["exp"].(float64); ok && !now.Before(time.Unix(int64(exp), 0)) {
+        return nil, fmt.Errorf("token expired")
+    }
+    if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0)) {
+        return nil, fmt.Errorf("token not valid yet")
+    }
+    return claims, nil
+}
+
+func decodeSegment(segment string, value any) error {
+    raw, err := base64.RawURLEncoding.DecodeString(segment)
+    if err != nil {
+        return err
+    }
+    return json.Unmarshal(raw, value)
+}
@@ -0,0 +1,185 @@
+package tenant
+
+import (
+    "net/http"
+    "sort"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "load-balancer/internal/admin"
+    "load-balancer/internal/ratelimit"
+)
+
+const Anonymous = "anonymous"
+
+// DefaultMaxTenants is how many tenants a Manager tracks by default.
+const DefaultMaxTenants = 10000
+
+type Limits struct {
+    RequestsPerSecond float64
+    Burst             int
+    MaxConcurrent     int64
+}
+
+type Usage struct {
+    Tenant            string `json:"tenant"`
+    Requests          uint64 `json:"requests"`
+    RateLimited       uint64 `json:"rate_limited"`
+    ConcurrencyCapped uint64 `json:"concurrency_capped"`
+    InFlight          int64  `json:"in_flight"`
+}
+
+type policy struct {
+    limits Limits
+    bucket *ratelimit.Bucket
+}
+
+type state struct {
+    policy      atomic.Pointer[policy]
+    requests    atomic.Uint64
+    rateLimited atomic.Uint64
+    capped      atomic.Uint64
+    inFlight    atomic.Int64
+}
+
+type Manager struct {
+    identify Identifier
+    defaults Limits
+
+    mux        sync.RWMutex
+    overrides  map[string]Limits
+    tenants    map[string]*state
+    unknown    int
+    maxTenants int
+}
+
+func NewManager(identify Identifier, defaults Limits) *Manager {
+    return &Manager{
+        identify:   identify,
+        defaults:   defaults,
+        overrides:  make(map[string]Limits),
+        tenants:    make(map[string]*state),
+        maxTenants: DefaultMaxTenants,
+    }
+}
+
+// SetMaxTenants bounds how many tenants without their own limits are
+// tracked (default DefaultMaxTenants), so clients cannot grow the table by
+// sending new tenant IDs. Once it is full, further unknown tenants share
+// the Anonymous tenant's limits; tenants given limits with SetLimits are
+// always tracked.
+func (manager *Manager) SetMaxTenants(max int) {
+    manager.mux.Lock()
+    manager.maxTenants = max
+    manager.mux.Unlock()
+}
+
+func (manager *Manager) SetLimits(tenant string, limits Limits) {
+    manager.mux.Lock()
+    defer manager.mux.Unlock()
+
+    manager.overrides[tenant] = limits
+    if existing, ok := manager.tenants[tenant]; ok {
+        existing.policy.Store(newPolicy(limits))
+    }
+}
+
+func (manager *Manager) Identify(request *http.Request) string {
+    if tenant := manager.identify(request); tenant != "" {
+        return tenant
+    }
+    return Anonymous
+}
+
+func (manager *Manager) Middleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        tenant := manager.state(manager.Identify(request))
+        tenant.requests.Add(1)
+        policy := tenant.policy.Load()
+
+        if policy.bucket != nil && !policy.bucket.AllowN(time.Now(), 1) {
+            tenant.rateLimited.Add(1)
+            http.Error(writer, "Too Many Requests", http.StatusTooManyRequests)
+            return
+        }
+
+        inFlight := tenant.inFlight.Add(1)
+        defer tenant.inFlight.Add(-1)
+        if policy.limits.MaxConcurrent > 0 && inFlight > policy.limits.MaxConcurrent {
+            tenant.capped.Add(1)
+            http.Error(writer, "Too Many Requests", http.StatusTooManyRequests)
+            return
+        }
+
+        next.ServeHTTP(writer, request)
+    })
+}
+
+func (manager *Manager) Usage() []Usage {
+    manager.mux.RLock()
+    defer manager.mux.RUnlock()
+
+    usage := make([]Usage, 0, len(manager.tenants))
+    for name, tenant := range manager.tenants {
+        usage = append(usage, Usage{
+            Tenant:            name,
+            Requests:          tenant.requests.Load(),
+            RateLimited:       tenant.rateLimited.Load(),
+            ConcurrencyCapped: tenant.capped.Load(),
+            InFlight:          tenant.inFlight.Load(),
+        })
+    }
+    sort.Slice(usage, func(i, j int) bool { return usage[i].Tenant < usage[j].Tenant })
+    return usage
+}
+
+func (manager *Manager) Register(server *admin.Server) {
+    server.HandleFunc("GET /admin/tenants", func(writer http.ResponseWriter, request *http.Request) {
+        admin.WriteJSON(writer, http.StatusOK, manager.Usage())
+    })
+}
+
+func (manager *Manager) state(name string) *state {
+    manager.mux.RLock()
+    tenant, ok := manager.tenants[name]
+    manager.mux.RUnlock()
+    if ok {
+        return tenant
+    }
+
+    manager.mux.Lock()
+    defer manager.mux.Unlock()
+
+    if tenant, ok := manager.tenants[name]; ok {
+        return tenant
+    }
+    limits, ok := manager.overrides[name]
+    if !ok && name != Anonymous && manager.unknown >= manager.maxTenants {
+        name = Anonymous
+        if tenant, ok := manager.tenants[name]; ok {
+            return tenant
+        }
+        limits, ok = manager.overrides[name]
+    }
+    if !ok {
+        limits = manager.defaults
+        manager.unknown++
+    }
+    tenant = &state{}
+    tenant.policy.Store(newPolicy(limits))
+    manager.tenants[name] = tenant
+    return tenant
+}
+
+func newPolicy(limits Limits) *policy {
+    policy := &policy{limits: limits}
+    if limits.RequestsPerSecond > 0 {
+        burst := float64(limits.Burst)
+        if burst < 1 {
+            burst = limits.RequestsPerSecond
+        }
+        policy.bucket = ratelimit.NewBucket(limits.RequestsPerSecond, burst)
+    }
+    return policy
+}
@@ -0,0 +1,258 @@
+package tenant
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "time"
+
+    "load-balancer/internal/admin"
+)
+
+func signJWT(t *testing.T, claims map[string]any, secret []byte) string {
+    t.Helper()
+
+    header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+    payload, _ := json.Marshal(claims)
+    body := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+    mac := hmac.New(sha256.New, secret)
+    mac.Write([]byte(body))
+    return body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestIdentifiers(t *testing.T) {
+    secret := []byte("s3cret")
+    token := signJWT(t, map[string]any{"tenant": "acme"}, secret)
+    forged := signJWT(t, map[string]any{"tenant": "acme"}, []byte("wrong"))
+    expired := signJWT(t, map[string]any{"tenant": "acme", "exp": time.Now().Add(-time.Minute).Unix()}, secret)
+    early := signJWT(t, map[string]any{"tenant": "acme", "nbf": time.Now().Add(time.Hour).Unix()}, secret)
+    current := signJWT(t, map[string]any{"tenant": "acme", "exp": time.Now().Add(time.Hour).Unix(), "nbf": time.Now().Add(-time.Minute).Unix()}, secret)
+
+    tests := []struct {
+        name       string
+        identifier Identifier
+        header     string
+        value      string
+        expected   string
+    }{
+        {
+            name:       "header",
+            identifier: HeaderIdentifier("X-Tenant-ID"),
+            header:     "X-Tenant-ID",
+            value:      "acme",
+            expected:   "acme",
+        },
+        {
+            name:       "known api key",
+            identifier: APIKeyIdentifier("X-API-Key", map[string]string{"k1": "acme"}),
+            header:     "X-API-Key",
+            value:      "k1",
+            expected:   "acme",
+        },
+        {
+            name:       "unknown api key",
+            identifier: APIKeyIdentifier("X-API-Key", map[string]string{"k1": "acme"}),
+            header:     "X-API-Key",
+            value:      "k2",
+            expected:   "",
+        },
+        {
+            name:       "verified jwt claim",
+            identifier: JWTClaimIdentifier("tenant", secret),
+            header:     "Authorization",
+            value:      "Bearer " + token,
+            expected:   "acme",
+        },
+        {
+            name:       "forged jwt",
+            identifier: JWTClaimIdentifier("tenant", secret),
+            header:     "Authorization",
+            value:      "Bearer " + forged,
+            expected:   "",
+        },
+        {
+            name:       "no jwt trusted without a secret",
+            identifier: JWTClaimIdentifier("tenant", nil),
+            header:     "Authorization",
+            value:      "Bearer " + forged,
+            expected:   "",
+        },
+        {
+            name:       "expired jwt",
+            identifier: JWTClaimIdentifier("tenant", secret),
+            header:     "Authorization",
+            value:      "Bearer " + expired,
+            expected:   "",
+        },
+        {
+            name:       "jwt not valid yet",
+            identifier: JWTClaimIdentifier("tenant", secret),
+            header:     "Authorization",
+            value:      "Bearer " + early,
+            expected:   "",
+        },
+        {
+            name:       "jwt within its validity",
+            identifier: JWTClaimIdentifier("tenant", secret),
+            header:     "Authorization",
+            value:      "Bearer " + current,
+            expected:   "acme",
+        },
+        {
+            name:       "malformed jwt",
+            identifier: JWTClaimIdentifier("tenant", secret),
+            header:     "Authorization",
+            value:      "Bearer abc",
+            expected:   "",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            req := httptest.NewRequest("GET", "/", nil)
+            req.Header.Set(tt.header, tt.value)
+            if got := tt.identifier(req); got != tt.expected {
+                t.Errorf("identifier = %q, expected %q", got, tt.expected)
+            }
+        })
+    }
+}
+
+func TestManager_RateLimit(t *testing.T) {
+    manager := NewManager(HeaderIdentifier("X-Tenant-ID"), Limits{RequestsPerSecond: 0.001, Burst: 2})
+    manager.SetLimits("big", Limits{RequestsPerSecond: 0.001, Burst: 5})
+
+    handler := manager.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+    send := func(tenant string) int {
+        req := httptest.NewRequest("GET", "/", nil)
+        if tenant != "" {
+            req.Header.Set("X-Tenant-ID", tenant)
+        }
+        rr := httptest.NewRecorder()
+        handler.ServeHTTP(rr, req)
+        return rr.Code
+    }
+
+    tests := []struct {
+        name     string
+        tenant   string
+        requests int
+        accepted int
+    }{
+        {name: "noisy tenant capped at burst", tenant: "noisy", requests: 5, accepted: 2},
+        {name: "other tenant unaffected", tenant: "quiet", requests: 2, accepted: 2},
+        {name: "override applies", tenant: "big", requests: 6, accepted: 5},
+        {name: "anonymous has own bucket", tenant: "", requests: 3, accepted: 2},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            accepted := 0
+            for i := 0; i < tt.requests; i++ {
+                if send(tt.tenant) == http.StatusOK {
+                    accepted++
+                }
+            }
+            if accepted != tt.accepted {
+                t.Errorf("accepted %d requests, expected %d", accepted, tt.accepted)
+            }
+        })
+    }
+
+    usage := manager.Usage()
+    if len(usage) != 4 || usage[0].Tenant != Anonymous {
+        t.Fatalf("Unexpected usage %+v", usage)
+    }
+    for _, u := range usage {
+        if u.Tenant == "noisy" && (u.Requests != 5 || u.RateLimited != 3) {
+            t.Errorf("Unexpected usage for noisy tenant: %+v", u)
+        }
+    }
+}
+
+func TestManager_ConcurrencyCap(t *testing.T) {
+    manager := NewManager(HeaderIdentifier("X-Tenant-ID"), Limits{MaxConcurrent: 2})
+
+    release := make(chan struct{})
+    var started sync.WaitGroup
+    started.Add(2)
+    handler := manager.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        started.Done()
+        <-release
+    }))
+
+    var done sync.WaitGroup
+    for i := 0; i < 2; i++ {
+        done.Add(1)
+        go func() {
+            defer done.Done()
+            req := httptest.NewRequest("GET", "/", nil)
+            req.Header.Set("X-Tenant-ID", "acme")
+            handler.ServeHTTP(httptest.NewRecorder(), req)
+        }()
+    }
+    started.Wait()
+
+    req := httptest.NewRequest("GET", "/", nil)
+    req.Header.Set("X-Tenant-ID", "acme")
+    rr := httptest.NewRecorder()
+    handler.ServeHTTP(rr, req)
+    if rr.Code != http.StatusTooManyRequests {
+        t.Errorf("Expected status 429 above concurrency cap, got %d", rr.Code)
+    }
+
+    close(release)
+    done.Wait()
+
+    usage := manager.Usage()
+    if usage[0].ConcurrencyCapped != 1 || usage[0].InFlight != 0 {
+        t.Errorf("Unexpected usage %+v", usage[0])
+    }
+}
+
+func TestManager_MaxTenants(t *testing.T) {
+    manager := NewManager(HeaderIdentifier("X-Tenant-ID"), Limits{})
+    manager.SetMaxTenants(2)
+    manager.SetLimits("vip", Limits{})
+    handler := manager.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+    for _, tenant := range []string{"a", "b", "c", "d", "vip"} {
+        req := httptest.NewRequest("GET", "/", nil)
+        req.Header.Set("X-Tenant-ID", tenant)
+        handler.ServeHTTP(httptest.NewRecorder(), req)
+    }
+
+    var names []string
+    for _, u := range manager.Usage() {
+        names = append(names, u.Tenant)
+    }
+    if len(names) != 4 || names[0] != "a" || names[1] != Anonymous || names[2] != "b" || names[3] != "vip" {
+        t.Errorf("Expected a, anonymous, b and vip tracked, got %v", names)
+    }
+}
+
+func TestManager_Register(t *testing.T) {
+    manager := NewManager(HeaderIdentifier("X-Tenant-ID"), Limits{})
+    manager.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+        ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+    server := admin.NewServer(nil)
+    manager.Register(server)
+
+    rr := httptest.NewRecorder()
+    server.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/tenants", nil))
+
+    var usage []Usage
+    if err := json.NewDecoder(rr.Body).Decode(&usage); err != nil {
+        t.Fatalf("invalid JSON: %v", err)
+    }
+    if len(usage) != 1 || usage[0].Tenant != Anonymous || usage[0].Requests != 1 {
+        t.Errorf("Unexpected usage %+v", usage)
+    }
+}
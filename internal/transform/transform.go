@@ -0,0 +1,277 @@
+package transform
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "mime"
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+type JSONTransform struct {
+    Set    map[string]any
+    Remove []string
+}
+
+type Replacement struct {
+    Old string
+    New string
+}
+
+type Config struct {
+    Request      *JSONTransform
+    Response     *JSONTransform
+    Replacements []Replacement
+    ContentTypes []string
+}
+
+func (transform *JSONTransform) Apply(body []byte) ([]byte, error) {
+    var document map[string]any
+    if err := json.Unmarshal(body, &document); err != nil {
+        return nil, fmt.Errorf("transform: body is not a JSON object: %w", err)
+    }
+
+    for _, path := range transform.Remove {
+        removePath(document, strings.Split(path, "."))
+    }
+    for path, value := range transform.Set {
+        setPath(document, strings.Split(path, "."), value)
+    }
+    return json.Marshal(document)
+}
+
+func removePath(document map[string]any, keys []string) {
+    for len(keys) > 1 {
+        child, ok := document[keys[0]].(map[string]any)
+        if !ok {
+            return
+        }
+        document, keys = child, keys[1:]
+    }
+    delete(document, keys[0])
+}
+
+func setPath(document map[string]any, keys []string, value any) {
+    for len(keys) > 1 {
+        child, ok := document[keys[0]].(map[string]any)
+        if !ok {
+            child = make(map[string]any)
+            document[keys[0]] = child
+        }
+        document, keys = child, keys[1:]
+    }
+    document[keys[0]] = value
+}
+
+func Middleware(config Config) func(next http.Handler) http.Handler {
+    if len(config.ContentTypes) == 0 {
+        config.ContentTypes = []string{"text/html"}
+    }
+
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+            if config.Request != nil && isJSON(request.Header.Get("Content-Type")) && request.Body != nil {
+                if err := transformRequest(config.Request, request); err != nil {
+                    http.Error(writer, "Bad Request", http.StatusBadRequest)
+                    return
+                }
+            }
+
+            if config.Response == nil && len(config.Replacements) == 0 {
+                next.ServeHTTP(writer, request)
+                return
+            }
+
+            request.Header.Del("Accept-Encoding")
+            transformer := &responseTransformer{ResponseWriter: writer, config: &config}
+            next.ServeHTTP(transformer, request)
+            transformer.finish()
+        })
+    }
+}
+
+func transformRequest(transform *JSONTransform, request *http.Request) error {
+    body, err := io.ReadAll(request.Body)
+    request.Body.Close()
+    if err != nil {
+        return err
+    }
+    if len(body) == 0 {
+        request.Body = http.NoBody
+        return nil
+    }
+
+    transformed, err := transform.Apply(body)
+    if err != nil {
+        return err
+    }
+    request.Body = io.NopCloser(bytes.NewReader(transformed))
+    request.ContentLength = int64(len(transformed))
+    request.Header.Set("Content-Length", strconv.Itoa(len(transformed)))
+    return nil
+}
+
+func isJSON(contentType string) bool {
+    mediaType, _, err := mime.ParseMediaType(contentType)
+    return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+func matchesContentType(contentType string, accepted []string) bool {
+    mediaType, _, err := mime.ParseMediaType(contentType)
+    if err != nil {
+        return false
+    }
+    for _, candidate := range accepted {
+        if mediaType == candidate {
+            return true
+        }
+    }
+    return false
+}
+
+const (
+    modePassthrough = iota + 1
+    modeJSON
+    modeReplace
+)
+
+type responseTransformer struct {
+    http.ResponseWriter
+    config   *Config
+    mode     int
+    status   int
+    buffer   bytes.Buffer
+    replacer *streamReplacer
+}
+
+func (transformer *responseTransformer) WriteHeader(status int) {
+    if transformer.mode != 0 {
+        return
+    }
+
+    header := transformer.Header()
+    contentType := header.Get("Content-Type")
+    switch {
+    case header.Get("Content-Encoding") != "":
+        transformer.mode = modePassthrough
+    case transformer.config.Response != nil && isJSON(contentType):
+        transformer.mode = modeJSON
+        transformer.status = status
+        return
+    case len(transformer.config.Replacements) > 0 && matchesContentType(contentType, transformer.config.ContentTypes):
+        transformer.mode = modeReplace
+        transformer.replacer = newStreamReplacer(transformer.ResponseWriter, transformer.config.Replacements)
+        header.Del("Content-Length")
+    default:
+        transformer.mode = modePassthrough
+    }
+    transformer.ResponseWriter.WriteHeader(status)
+}
+
+func (transformer *responseTransformer) Write(p []byte) (int, error) {
+    if transformer.mode == 0 {
+        transformer.WriteHeader(http.StatusOK)
+    }
+
+    switch transformer.mode {
+    case modeJSON:
+        return transformer.buffer.Write(p)
+    case modeReplace:
+        return transformer.replacer.Write(p)
+    }
+    return transformer.ResponseWriter.Write(p)
+}
+
+func (transformer *responseTransformer) Flush() {
+    if transformer.mode == modeJSON {
+        return
+    }
+    if transformer.mode == modeReplace {
+        transformer.replacer.flushSafe()
+    }
+    http.NewResponseController(transformer.ResponseWriter).Flush()
+}
+
+func (transformer *responseTransformer) finish() {
+    switch transformer.mode {
+    case modeJSON:
+        body := transformer.buffer.Bytes()
+        if transformed, err := transformer.config.Response.Apply(body); err == nil {
+            body = transformed
+        } else {
+            log.Printf("transform: leaving response untouched: %v\n", err)
+        }
+        transformer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+        transformer.ResponseWriter.WriteHeader(transformer.status)
+        transformer.ResponseWriter.Write(body)
+    case modeReplace:
+        transformer.replacer.Close()
+    }
+}
+
+type streamReplacer struct {
+    out          io.Writer
+    replacements []Replacement
+    pending      []byte
+    holdBack     int
+}
+
+func newStreamReplacer(out io.Writer, replacements []Replacement) *streamReplacer {
+    replacer := &streamReplacer{out: out, replacements: replacements}
+    for _, replacement := range replacements {
+        if len(replacement.Old)-1 > replacer.holdBack {
+            replacer.holdBack = len(replacement.Old) - 1
+        }
+    }
+    return replacer
+}
+
+func (replacer *streamReplacer) Write(p []byte) (int, error) {
+    replacer.pending = append(replacer.pending, p...)
+    if err := replacer.emit(false); err != nil {
+        return 0, err
+    }
+    return len(p), nil
+}
+
+func (replacer *streamReplacer) flushSafe() {
+    replacer.emit(false)
+}
+
+func (replacer *streamReplacer) Close() error {
+    return replacer.emit(true)
+}
+
+func (replacer *streamReplacer) emit(final bool) error {
+    var output bytes.Buffer
+    i := 0
+    for i < len(replacer.pending) {
+        if !final && len(replacer.pending)-i <= replacer.holdBack {
+            break
+        }
+        matched := false
+        for _, replacement := range replacer.replacements {
+            if replacement.Old != "" && bytes.HasPrefix(replacer.pending[i:], []byte(replacement.Old)) {
+                output.WriteString(replacement.New)
+                i += len(replacement.Old)
+                matched = true
+                break
+            }
+        }
+        if !matched {
+            output.WriteByte(replacer.pending[i])
+            i++
+        }
+    }
+
+    replacer.pending = append(replacer.pending[:0], replacer.pending[i:]...)
+    if output.Len() == 0 {
+        return nil
+    }
+    _, err := replacer.out.Write(output.Bytes())
+    return err
+}
@@ -0,0 +1,191 @@
+package transform
+
+import (
+    "bytes"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+func TestJSONTransform_Apply(t *testing.T) {
+    tests := []struct {
+        name      string
+        transform JSONTransform
+        input     string
+        expected  map[string]any
+        expectErr bool
+    }{
+        {
+            name:      "set top level field",
+            transform: JSONTransform{Set: map[string]any{"source": "edge"}},
+            input:     `{"id":1}`,
+            expected:  map[string]any{"id": float64(1), "source": "edge"},
+        },
+        {
+            name:      "remove nested field",
+            transform: JSONTransform{Remove: []string{"user.password"}},
+            input:     `{"user":{"name":"a","password":"b"}}`,
+            expected:  map[string]any{"user": map[string]any{"name": "a"}},
+        },
+        {
+            name:      "set creates intermediate objects",
+            transform: JSONTransform{Set: map[string]any{"meta.gateway.region": "eu"}},
+            input:     `{}`,
+            expected:  map[string]any{"meta": map[string]any{"gateway": map[string]any{"region": "eu"}}},
+        },
+        {
+            name:      "remove missing path is a no-op",
+            transform: JSONTransform{Remove: []string{"a.b.c"}},
+            input:     `{"a":1}`,
+            expected:  map[string]any{"a": float64(1)},
+        },
+        {
+            name:      "non-object body",
+            transform: JSONTransform{Remove: []string{"a"}},
+            input:     `[1,2]`,
+            expectErr: true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            output, err := tt.transform.Apply([]byte(tt.input))
+            if tt.expectErr {
+                if err == nil {
+                    t.Error("Apply() expected error, got nil")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("Apply() error: %v", err)
+            }
+
+            var actual map[string]any
+            json.Unmarshal(output, &actual)
+            if !reflect.DeepEqual(actual, tt.expected) {
+                t.Errorf("Apply() = %v, expected %v", actual, tt.expected)
+            }
+        })
+    }
+}
+
+func TestStreamReplacer_AcrossChunks(t *testing.T) {
+    replacements := []Replacement{
+        {Old: "http://10.0.0.5:8080", New: "https://shop.example.com"},
+        {Old: "foo", New: "bar"},
+    }
+    input := `<a href="http://10.0.0.5:8080/cart">foo</a><img src="http://10.0.0.5:8080/x.png">`
+    expected := `<a href="https://shop.example.com/cart">bar</a><img src="https://shop.example.com/x.png">`
+
+    for chunkSize := 1; chunkSize <= len(input); chunkSize += 7 {
+        var out bytes.Buffer
+        replacer := newStreamReplacer(&out, replacements)
+        for i := 0; i < len(input); i += chunkSize {
+            end := i + chunkSize
+            if end > len(input) {
+                end = len(input)
+            }
+            replacer.Write([]byte(input[i:end]))
+        }
+        replacer.Close()
+
+        if out.String() != expected {
+            t.Errorf("chunk size %d: got %q, expected %q", chunkSize, out.String(), expected)
+        }
+    }
+}
+
+func TestMiddleware(t *testing.T) {
+    upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        switch r.URL.Path {
+        case "/echo":
+            w.Header().Set("Content-Type", "application/json")
+            w.Header().Set("Content-Length", "999")
+            w.Write(body)
+        case "/page":
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            w.Write([]byte(`<a href="http://internal:8080/`))
+            w.Write([]byte(`home">x</a>`))
+        case "/gzip":
+            w.Header().Set("Content-Type", "text/html")
+            w.Header().Set("Content-Encoding", "gzip")
+            w.Write([]byte("http://internal:8080"))
+        default:
+            w.Header().Set("Content-Type", "text/plain")
+            w.Write([]byte("http://internal:8080"))
+        }
+    })
+
+    handler := Middleware(Config{
+        Request:      &JSONTransform{Set: map[string]any{"injected": true}, Remove: []string{"secret"}},
+        Response:     &JSONTransform{Remove: []string{"internal"}},
+        Replacements: []Replacement{{Old: "http://internal:8080", New: "https://public.example.com"}},
+    })(upstream)
+
+    tests := []struct {
+        name     string
+        path     string
+        body     string
+        expected string
+    }{
+        {
+            name:     "request and response JSON transforms",
+            path:     "/echo",
+            body:     `{"secret":"s","internal":"i","keep":1}`,
+            expected: `{"injected":true,"keep":1}`,
+        },
+        {
+            name:     "html rewritten across writes",
+            path:     "/page",
+            expected: `<a href="https://public.example.com/home">x</a>`,
+        },
+        {
+            name:     "encoded responses pass through",
+            path:     "/gzip",
+            expected: "http://internal:8080",
+        },
+        {
+            name:     "other content types pass through",
+            path:     "/text",
+            expected: "http://internal:8080",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+            req.Header.Set("Content-Type", "application/json")
+            rr := httptest.NewRecorder()
+
+            handler.ServeHTTP(rr, req)
+
+            if rr.Body.String() != tt.expected {
+                t.Errorf("Expected body %q, got %q", tt.expected, rr.Body.String())
+            }
+            if cl := rr.Header().Get("Content-Length"); cl != "" && cl != strconv.Itoa(len(tt.expected)) {
+                t.Errorf("Content-Length = %s, expected %d", cl, len(tt.expected))
+            }
+        })
+    }
+}
+
+func TestMiddleware_InvalidRequestJSON(t *testing.T) {
+    handler := Middleware(Config{Request: &JSONTransform{Remove: []string{"a"}}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        t.Error("upstream should not be called")
+    }))
+
+    req := httptest.NewRequest("POST", "/", strings.NewReader("not json"))
+    req.Header.Set("Content-Type", "application/json")
+    rr := httptest.NewRecorder()
+    handler.ServeHTTP(rr, req)
+
+    if rr.Code != http.StatusBadRequest {
+        t.Errorf("Expected status 400, got %d", rr.Code)
+    }
+}